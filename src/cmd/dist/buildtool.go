@@ -79,6 +79,7 @@ var bootstrapDirs = []string{
 	"cmd/link/internal/sym",
 	"cmd/link/internal/x86",
 	"container/heap",
+	"debug/binary",
 	"debug/dwarf",
 	"debug/elf",
 	"debug/macho",
@@ -0,0 +1,72 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package binary defines a small view of executable and object
+// files that is common to formats such as PE, ELF and Mach-O, so
+// that tools like symbolizers and size analyzers can be written
+// once for all of them.
+//
+// The File types of the format packages implement the interfaces
+// of this package. debug/pe is the first to do so.
+package binary
+
+// A Symbol is a symbol of a binary.
+type Symbol struct {
+	Name string
+	Addr uint64 // virtual address, or 0 for undefined symbols
+	Size uint64 // 0 if the format does not record it
+
+	// Section is the index of the symbol's section in the
+	// result of BinarySections, or -1 for symbols that are
+	// undefined, absolute or otherwise not in a section.
+	Section int
+}
+
+// A Section is a section of a binary.
+type Section struct {
+	Name     string
+	Addr     uint64 // virtual address once loaded
+	Size     uint64 // size in memory
+	FileSize uint64 // size of the contents stored in the file
+}
+
+// A SymbolTable is a binary with a symbol table.
+type SymbolTable interface {
+	// BinarySymbols returns the symbols
+	// of the binary, in table order.
+	BinarySymbols() ([]Symbol, error)
+}
+
+// A SectionTable is a binary made of sections.
+type SectionTable interface {
+	// BinarySections returns the sections
+	// of the binary, in table order.
+	BinarySections() []Section
+}
+
+// An Importer is a binary that imports dynamic libraries.
+// The File types of debug/elf, debug/macho and debug/pe
+// all implement it.
+type Importer interface {
+	// ImportedLibraries returns the names of
+	// the libraries the binary imports.
+	ImportedLibraries() ([]string, error)
+}
+
+// A Memory is a binary whose contents
+// can be read by virtual address.
+type Memory interface {
+	// ReadAtAddr reads len(p) bytes starting at virtual
+	// address addr, as laid out in memory once the binary is
+	// loaded. It has the semantics of io.ReaderAt.ReadAt.
+	ReadAtAddr(p []byte, addr uint64) (n int, err error)
+}
+
+// A File is a binary that provides all the views of this package.
+type File interface {
+	SymbolTable
+	SectionTable
+	Importer
+	Memory
+}
@@ -0,0 +1,364 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// A Frame is a source location of a code address,
+// as returned by File.Addr2Line.
+type Frame struct {
+	Function string // name of the function, or "" if unknown
+	File     string // path of the source file, or "" if unknown
+	Line     int    // line number, or 0 if unknown
+}
+
+// Addr2Line returns the source locations of the code at the virtual
+// address addr of f, innermost first. If the DWARF information of f
+// shows that the code was inlined, the first frame is that of the
+// inlined function and each following frame is that of its caller,
+// at the call site, up to the function actually containing addr.
+// Without DWARF information for addr, Addr2Line falls back on the
+// COFF symbols, which only give the name of the function.
+// It returns no frames if addr is in no known function.
+func (f *File) Addr2Line(addr uint64) ([]Frame, error) {
+	f.dwarfOnce.Do(func() {
+		f.dwarf, f.dwarfErr = f.DWARF()
+		if f.dwarfErr == nil {
+			f.dwarfLine, f.dwarfErr = f.debugSection("line")
+		}
+	})
+	if f.dwarfErr == nil {
+		frames, err := dwarfFrames(f.dwarf, f.dwarfLine, addr)
+		if frames != nil || err != nil {
+			return frames, err
+		}
+	}
+	name, err := f.symbolFor(addr)
+	if name == "" || err != nil {
+		return nil, err
+	}
+	return []Frame{{Function: name}}, nil
+}
+
+// dwarfFrames returns the frames of addr according to d, whose
+// .debug_line section is line, or none if d does not cover addr.
+func dwarfFrames(d *dwarf.Data, line []byte, addr uint64) ([]Frame, error) {
+	r := d.Reader()
+	cu, err := r.SeekPC(addr)
+	if err == dwarf.ErrUnknownPC {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var chain []*dwarf.Entry
+	if cu.Children {
+		chain, err = scopesAt(d, r, addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var files []string
+	var le dwarf.LineEntry
+	lr, err := d.LineReader(cu)
+	if err != nil {
+		return nil, err
+	}
+	if lr != nil {
+		if err := lr.SeekPC(addr, &le); err != nil && err != dwarf.ErrUnknownPC {
+			return nil, err
+		}
+		if off, ok := cu.Val(dwarf.AttrStmtList).(int64); ok {
+			compDir, _ := cu.Val(dwarf.AttrCompDir).(string)
+			files = lineFileNames(line, off, compDir)
+		}
+	}
+
+	// The line table gives the innermost location. Each inlined
+	// subroutine, from the innermost out, gives the location of
+	// the call in the enclosing function.
+	frame := Frame{Line: le.Line}
+	if le.File != nil {
+		frame.File = le.File.Name
+	}
+	if len(chain) == 0 {
+		if frame.Line == 0 {
+			return nil, nil
+		}
+		return []Frame{frame}, nil
+	}
+	var frames []Frame
+	for i := len(chain) - 1; i >= 0; i-- {
+		e := chain[i]
+		frame.Function, err = entryName(d, e)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+		frame = Frame{}
+		if n, ok := e.Val(dwarf.AttrCallFile).(int64); ok && n > 0 && n < int64(len(files)) {
+			frame.File = files[n]
+		}
+		if n, ok := e.Val(dwarf.AttrCallLine).(int64); ok {
+			frame.Line = int(n)
+		}
+	}
+	return frames, nil
+}
+
+// scopesAt reads the children of an entry from r and returns the
+// subprogram containing addr, followed by the inlined subroutines
+// containing addr, outermost first.
+func scopesAt(d *dwarf.Data, r *dwarf.Reader, addr uint64) ([]*dwarf.Entry, error) {
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil || e.Tag == 0 {
+			return nil, nil
+		}
+		switch e.Tag {
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine, dwarf.TagLexDwarfBlock:
+			ranges, err := d.Ranges(e)
+			if err != nil {
+				return nil, err
+			}
+			if !inRanges(ranges, addr) {
+				break
+			}
+			var inner []*dwarf.Entry
+			if e.Children {
+				inner, err = scopesAt(d, r, addr)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if e.Tag == dwarf.TagLexDwarfBlock {
+				return inner, nil
+			}
+			return append([]*dwarf.Entry{e}, inner...), nil
+		case dwarf.TagNamespace, dwarf.TagModule:
+			if !e.Children {
+				break
+			}
+			inner, err := scopesAt(d, r, addr)
+			if inner != nil || err != nil {
+				return inner, err
+			}
+			continue
+		}
+		r.SkipChildren()
+	}
+}
+
+func inRanges(ranges [][2]uint64, addr uint64) bool {
+	for _, r := range ranges {
+		if r[0] <= addr && addr < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// entryName returns the name of the function described by e,
+// following the abstract origin of inlined and out-of-line
+// instances and the specification of C++ member functions.
+func entryName(d *dwarf.Data, e *dwarf.Entry) (string, error) {
+	for i := 0; i < 8; i++ {
+		if name, ok := e.Val(dwarf.AttrName).(string); ok {
+			return name, nil
+		}
+		off, ok := e.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			off, ok = e.Val(dwarf.AttrSpecification).(dwarf.Offset)
+		}
+		if !ok {
+			return "", nil
+		}
+		r := d.Reader()
+		r.Seek(off)
+		var err error
+		if e, err = r.Next(); err != nil {
+			return "", err
+		}
+		if e == nil {
+			return "", fmt.Errorf("pe: DWARF reference to missing entry %#x", off)
+		}
+	}
+	return "", nil
+}
+
+// symbolFor returns the name of the function symbol of f
+// whose code is the closest before addr in its section.
+func (f *File) symbolFor(addr uint64) (string, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return "", err
+	}
+	base := f.imageBase()
+	var best *Symbol
+	var bestAddr uint64
+	for _, s := range f.Symbols {
+		sec := f.SymbolSection(s)
+		if sec == nil || !s.IsFunction() && s.StorageClass != IMAGE_SYM_CLASS_EXTERNAL {
+			continue
+		}
+		start := base + uint64(sec.VirtualAddress)
+		if sec.Characteristics&(IMAGE_SCN_CNT_CODE|IMAGE_SCN_MEM_EXECUTE) == 0 || addr < start || addr-start >= uint64(sec.virtualSize()) {
+			continue
+		}
+		a := start + uint64(s.Value)
+		if a <= addr && (best == nil || a > bestAddr) {
+			best, bestAddr = s, a
+		}
+	}
+	if best == nil {
+		return "", nil
+	}
+	return best.Name, nil
+}
+
+// lineFileNames returns the file names listed in the header of the
+// line number program at offset off of the .debug_line section line,
+// for a compilation unit compiled in compDir, indexed as attributes
+// such as DW_AT_call_file refer to them: entry 0, which means no
+// file, is "". As debug/dwarf, it reads versions 2 to 4 of the
+// header. It returns the names read before any error, and leaves
+// out the files the line number program itself defines.
+func lineFileNames(line []byte, off int64, compDir string) []string {
+	if off < 0 || off >= int64(len(line)) {
+		return nil
+	}
+	b := line[off:]
+	// fixed consumes n bytes of b, reporting whether it held them.
+	fixed := func(n int) ([]byte, bool) {
+		if n > len(b) {
+			return nil, false
+		}
+		v := b[:n]
+		b = b[n:]
+		return v, true
+	}
+	cstr := func() (string, bool) {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			return "", false
+		}
+		s := string(b[:i])
+		b = b[i+1:]
+		return s, true
+	}
+	uleb := func() bool {
+		_, n := binary.Uvarint(b)
+		if n <= 0 {
+			return false
+		}
+		b = b[n:]
+		return true
+	}
+
+	lenSize := 4 // size of unit_length and header_length
+	if v, ok := fixed(4); !ok {
+		return nil
+	} else if binary.LittleEndian.Uint32(v) == 0xffffffff {
+		if _, ok := fixed(8); !ok {
+			return nil
+		}
+		lenSize = 8
+	}
+	v, ok := fixed(2)
+	if !ok {
+		return nil
+	}
+	version := binary.LittleEndian.Uint16(v)
+	if version < 2 || version > 4 {
+		return nil
+	}
+	// header_length, minimum_instruction_length, maximum_operations_per_instruction
+	// in version 4, default_is_stmt, line_base and line_range.
+	skip := lenSize + 4
+	if version >= 4 {
+		skip++
+	}
+	if _, ok := fixed(skip); !ok {
+		return nil
+	}
+	v, ok = fixed(1) // opcode_base
+	if !ok || v[0] == 0 {
+		return nil
+	}
+	if _, ok := fixed(int(v[0]) - 1); !ok { // standard_opcode_lengths
+		return nil
+	}
+
+	// The compilation directory is implicitly directory 0.
+	dirs := []string{compDir}
+	for {
+		dir, ok := cstr()
+		if !ok {
+			return nil
+		}
+		if dir == "" {
+			break
+		}
+		dirs = append(dirs, joinDWARFPath(compDir, dir))
+	}
+	files := []string{""}
+	for {
+		name, ok := cstr()
+		if !ok || name == "" {
+			return files
+		}
+		d, n := binary.Uvarint(b)
+		if n <= 0 {
+			return files
+		}
+		b = b[n:]
+		if !uleb() || !uleb() { // modification time and length
+			return files
+		}
+		if d < uint64(len(dirs)) {
+			name = joinDWARFPath(dirs[d], name)
+		}
+		files = append(files, name)
+	}
+}
+
+// joinDWARFPath joins the directory dir and the file name name from
+// DWARF line number information, unless name is absolute. As the
+// paths may come from Windows or from Unix, a dir starting with a
+// drive letter or a UNC prefix is joined with a backslash,
+// as debug/dwarf does.
+func joinDWARFPath(dir, name string) string {
+	if dir == "" || isAbsDWARFPath(name) {
+		return name
+	}
+	if len(dir) >= 2 && (dir[1] == ':' || isSlash(dir[0]) && isSlash(dir[1])) {
+		if !strings.HasSuffix(dir, `\`) && !strings.HasSuffix(dir, "/") {
+			dir += `\`
+		}
+		return dir + name
+	}
+	return path.Join(dir, name)
+}
+
+// isAbsDWARFPath reports whether the Unix or Windows path p is absolute.
+func isAbsDWARFPath(p string) bool {
+	if len(p) >= 2 && p[1] == ':' {
+		p = p[2:]
+	}
+	return len(p) > 0 && isSlash(p[0])
+}
+
+func isSlash(c byte) bool {
+	return c == '/' || c == '\\'
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddr2Line(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var main uint64
+	for _, s := range f.Symbols {
+		if s.Name == "main" {
+			main = f.imageBase() + uint64(f.Sections[s.SectionNumber-1].VirtualAddress) + uint64(s.Value)
+		}
+	}
+	tests := []struct {
+		addr uint64
+		want []Frame
+	}{
+		// NtCurrentTeb, inlined in __tmainCRTStartup,
+		// with __readgsqword inlined in it.
+		{0x4011af, []Frame{
+			{"__readgsqword", "winnt.h", 1593},
+			{"NtCurrentTeb", "winnt.h", 6418},
+			{"__tmainCRTStartup", "crtexe.c", 225},
+		}},
+		// mainCRTStartup, not inlined.
+		{0x4014e0, []Frame{{"mainCRTStartup", "crtexe.c", 180}}},
+		// main, without DWARF.
+		{main + 3, []Frame{{"main", "", 0}}},
+		// Not code.
+		{0x100, nil},
+	}
+	for _, tt := range tests {
+		frames, err := f.Addr2Line(tt.addr)
+		if err != nil {
+			t.Errorf("Addr2Line(%#x): %v", tt.addr, err)
+			continue
+		}
+		for i := range frames {
+			// Keep the base name of the file, whatever the separators.
+			frames[i].File = frames[i].File[strings.LastIndexAny(frames[i].File, `/\`)+1:]
+		}
+		if !reflect.DeepEqual(frames, tt.want) {
+			t.Errorf("Addr2Line(%#x) = %v, want %v", tt.addr, frames, tt.want)
+		}
+	}
+}
+
+func TestLineFileNames(t *testing.T) {
+	hdr := []byte{
+		2, 0, // version
+		0, 0, 0, 0, // header_length, unused
+		1, 1, 0xfb, 14, // minimum_instruction_length, default_is_stmt, line_base, line_range
+		4, 0, 1, 1, // opcode_base and standard_opcode_lengths
+	}
+	hdr = append(hdr, "inc\x00/usr/include\x00\x00"...)
+	hdr = append(hdr, "a.c\x00\x00\x00\x00"...)
+	hdr = append(hdr, "b.h\x00\x01\x00\x00"...)
+	hdr = append(hdr, "c.h\x00\x02\x00\x00"...)
+	hdr = append(hdr, "/abs/d.h\x00\x01\x00\x00\x00"...)
+	unit := []byte{byte(len(hdr)), 0, 0, 0}
+	line := append([]byte{0xff}, append(unit, hdr...)...) // at offset 1
+
+	for _, tt := range []struct {
+		compDir string
+		want    []string
+	}{
+		{"/src", []string{"", "/src/a.c", "/src/inc/b.h", "/usr/include/c.h", "/abs/d.h"}},
+		{`c:\src`, []string{"", `c:\src\a.c`, `c:\src\inc\b.h`, "/usr/include/c.h", "/abs/d.h"}},
+	} {
+		if got := lineFileNames(line, 1, tt.compDir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lineFileNames(%q) = %q, want %q", tt.compDir, got, tt.want)
+		}
+	}
+	if got := lineFileNames(line[:len(line)-3], 1, ""); len(got) != 4 {
+		t.Errorf("lineFileNames of a truncated header = %q, want the first 3 files", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A GUID is a Windows globally unique identifier.
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// String returns g in the usual
+// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", g.Data1, g.Data2, g.Data3, g.Data4[:2], g.Data4[2:])
+}
+
+// MarshalText implements encoding.TextMarshaler,
+// so that g is serialized in its String form.
+func (g GUID) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// decodeGUID decodes the 16 bytes of b into a GUID.
+func decodeGUID(b []byte) GUID {
+	g := GUID{
+		Data1: binary.LittleEndian.Uint32(b[0:]),
+		Data2: binary.LittleEndian.Uint16(b[4:]),
+		Data3: binary.LittleEndian.Uint16(b[6:]),
+	}
+	copy(g.Data4[:], b[8:16])
+	return g
+}
+
+// AnonObjectHeader is the header of an anonymous object
+// (ANON_OBJECT_HEADER, ANON_OBJECT_HEADER_V2 or
+// ANON_OBJECT_HEADER_BIGOBJ), which object files that are not
+// plain COFF start with. Such files include objects compiled with
+// link-time code generation (/GL), whose contents are private to
+// the compiler, and objects in the big object format (/bigobj).
+// The ClassID identifies the format of the rest of the file.
+type AnonObjectHeader struct {
+	Version       uint16
+	Machine       uint16
+	TimeDateStamp uint32
+	ClassID       GUID
+	SizeOfData    uint32
+
+	// These fields are only present for Version 2 and later.
+	Flags          uint32
+	MetaDataSize   uint32
+	MetaDataOffset uint32
+}
+
+// anonObjectHeaderSize is the size of ANON_OBJECT_HEADER,
+// and anonObjectHeaderV2Size that of ANON_OBJECT_HEADER_V2.
+const (
+	anonObjectHeaderSize   = 32
+	anonObjectHeaderV2Size = 44
+)
+
+// isImportOrAnon reports whether b, the start of a file, has the
+// signature shared by short import objects and anonymous objects.
+func isImportOrAnon(b []byte) bool {
+	return len(b) >= 4 && binary.LittleEndian.Uint16(b[0:]) == IMAGE_FILE_MACHINE_UNKNOWN &&
+		binary.LittleEndian.Uint16(b[2:]) == 0xffff
+}
+
+// ReadAnonObjectHeader reads the anonymous object header from the
+// start of r. It fails if r does not start with such a header.
+func ReadAnonObjectHeader(r io.ReaderAt) (*AnonObjectHeader, error) {
+	var b [anonObjectHeaderV2Size]byte
+	n, err := r.ReadAt(b[:], 0)
+	if n < 6 || !isImportOrAnon(b[:]) {
+		return nil, &FormatError{0, "anonymous object header", ErrBadMagic, b[0:4]}
+	}
+	if binary.LittleEndian.Uint16(b[4:]) == 0 {
+		// Version 0 is IMPORT_OBJECT_HEADER.
+		return nil, &FormatError{0, "anonymous object header", errShortImport, nil}
+	}
+	if n < anonObjectHeaderSize {
+		return nil, formatError(0, "anonymous object header", err)
+	}
+	h := &AnonObjectHeader{
+		Version:       binary.LittleEndian.Uint16(b[4:]),
+		Machine:       binary.LittleEndian.Uint16(b[6:]),
+		TimeDateStamp: binary.LittleEndian.Uint32(b[8:]),
+		ClassID:       decodeGUID(b[12:28]),
+		SizeOfData:    binary.LittleEndian.Uint32(b[28:]),
+	}
+	if h.Version >= 2 {
+		if n < anonObjectHeaderV2Size {
+			return nil, formatError(0, "anonymous object header", err)
+		}
+		h.Flags = binary.LittleEndian.Uint32(b[32:])
+		h.MetaDataSize = binary.LittleEndian.Uint32(b[36:])
+		h.MetaDataOffset = binary.LittleEndian.Uint32(b[40:])
+	}
+	return h, nil
+}
+
+// errShortImport is reported when NewFile is
+// given a short import object.
+var errShortImport = errors.New("short import object; use NewShortImport")
+
+// An AnonObjectError is returned by NewFile for anonymous
+// objects other than big object files, such as objects
+// compiled with link-time code generation.
+type AnonObjectError struct {
+	Header *AnonObjectHeader
+}
+
+func (e *AnonObjectError) Error() string {
+	return fmt.Sprintf("pe: anonymous object of class %v, version %d; not a COFF object (compiled with /GL?)", e.Header.ClassID, e.Header.Version)
+}
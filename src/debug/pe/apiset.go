@@ -0,0 +1,163 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// An APISetResolver maps the names of API set contracts, virtual
+// DLLs such as "api-ms-win-core-file-l1-1-0.dll", to the DLLs that
+// implement them. Host DLLs may differ by importing module.
+type APISetResolver interface {
+	// ResolveAPISet returns the file name of the DLL implementing
+	// the contract when imported by the module named importer,
+	// which may be empty, and whether the contract is known.
+	ResolveAPISet(contract, importer string) (host string, ok bool)
+}
+
+// IsAPISetName reports whether the DLL named name is an
+// API set contract rather than a file.
+func IsAPISetName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "api-") || strings.HasPrefix(name, "ext-")
+}
+
+// ResolveAPISets sets the Host of each import of imps from an API set
+// contract to the DLL implementing it for the module named importer,
+// according to r. Other imports are left unchanged.
+func ResolveAPISets(imps []Import, r APISetResolver, importer string) {
+	for i := range imps {
+		if !IsAPISetName(imps[i].DLL) {
+			continue
+		}
+		if host, ok := r.ResolveAPISet(imps[i].DLL, importer); ok {
+			imps[i].Host = host
+		}
+	}
+}
+
+// An APISetSchema is the API set map of Windows 10 and later,
+// stored in the .apiset section of apisetschema.dll.
+// It implements APISetResolver.
+type APISetSchema struct {
+	// contracts maps contract names, in lower case and without
+	// their last version number and extension, to their hosts.
+	contracts map[string]*apiSetContract
+}
+
+type apiSetContract struct {
+	host      string            // default host, or "" if none
+	importers map[string]string // lower-case importer to host
+}
+
+// Sizes of the API_SET_NAMESPACE, API_SET_NAMESPACE_ENTRY and
+// API_SET_VALUE_ENTRY structures of version 6 of the schema.
+const (
+	apiSetNamespaceSize = 28
+	apiSetEntrySize     = 24
+	apiSetValueSize     = 20
+)
+
+// APISetSchema returns the API set schema in the .apiset
+// section of f, which must be apisetschema.dll.
+func (f *File) APISetSchema() (*APISetSchema, error) {
+	s := f.Section(".apiset")
+	if s == nil {
+		return nil, errors.New("pe: no .apiset section")
+	}
+	b, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	return ParseAPISetSchema(b)
+}
+
+// ParseAPISetSchema parses b, an API set schema as found in the
+// .apiset section of apisetschema.dll. Only version 6, used since
+// Windows 10, is supported.
+func ParseAPISetSchema(b []byte) (*APISetSchema, error) {
+	if len(b) < apiSetNamespaceSize {
+		return nil, &FormatError{-1, "API set schema", ErrTruncated, len(b)}
+	}
+	if v := binary.LittleEndian.Uint32(b[0:]); v != 6 {
+		return nil, &FormatError{-1, "API set schema", errors.New("unsupported version"), v}
+	}
+	count := binary.LittleEndian.Uint32(b[12:])
+	entries := binary.LittleEndian.Uint32(b[16:])
+	if uint64(entries)+uint64(count)*apiSetEntrySize > uint64(len(b)) {
+		return nil, &FormatError{-1, "API set schema", ErrOutOfBounds, count}
+	}
+	str := func(off, n uint32) (string, error) {
+		if n%2 != 0 || uint64(off)+uint64(n) > uint64(len(b)) {
+			return "", &FormatError{-1, "API set schema string", ErrOutOfBounds, off}
+		}
+		return strings.ToLower(decodeUTF16(b[off : off+n])), nil
+	}
+	s := &APISetSchema{contracts: make(map[string]*apiSetContract, count)}
+	for i := uint32(0); i < count; i++ {
+		e := b[entries+i*apiSetEntrySize:]
+		// Only the first HashedLength bytes of the
+		// name, up to the last hyphen, identify it.
+		hashed := binary.LittleEndian.Uint32(e[12:])
+		if hashed > binary.LittleEndian.Uint32(e[8:]) {
+			return nil, &FormatError{-1, "API set schema entry", ErrOutOfBounds, hashed}
+		}
+		name, err := str(binary.LittleEndian.Uint32(e[4:]), hashed)
+		if err != nil {
+			return nil, err
+		}
+		values := binary.LittleEndian.Uint32(e[16:])
+		nvalues := binary.LittleEndian.Uint32(e[20:])
+		if uint64(values)+uint64(nvalues)*apiSetValueSize > uint64(len(b)) {
+			return nil, &FormatError{-1, "API set schema entry " + name, ErrOutOfBounds, nvalues}
+		}
+		c := &apiSetContract{}
+		for j := uint32(0); j < nvalues; j++ {
+			v := b[values+j*apiSetValueSize:]
+			importer, err := str(binary.LittleEndian.Uint32(v[4:]), binary.LittleEndian.Uint32(v[8:]))
+			if err != nil {
+				return nil, err
+			}
+			host, err := str(binary.LittleEndian.Uint32(v[12:]), binary.LittleEndian.Uint32(v[16:]))
+			if err != nil {
+				return nil, err
+			}
+			if importer == "" {
+				c.host = host
+				continue
+			}
+			if c.importers == nil {
+				c.importers = make(map[string]string)
+			}
+			c.importers[importer] = host
+		}
+		s.contracts[name] = c
+	}
+	return s, nil
+}
+
+// ResolveAPISet implements APISetResolver. As the loader does, it
+// ignores the case of names and the last version number of the
+// contract, so "API-MS-Win-Core-File-L1-2-0.dll" matches the schema
+// entry of "api-ms-win-core-file-l1-2-4". Contracts without a host,
+// which Windows does not implement, are not known.
+func (s *APISetSchema) ResolveAPISet(contract, importer string) (string, bool) {
+	name := strings.ToLower(contract)
+	name = strings.TrimSuffix(name, ".dll")
+	if i := strings.LastIndex(name, "-"); i >= 0 {
+		name = name[:i]
+	}
+	c := s.contracts[name]
+	if c == nil {
+		return "", false
+	}
+	if host, ok := c.importers[strings.ToLower(importer)]; ok && host != "" {
+		return host, true
+	}
+	return c.host, c.host != ""
+}
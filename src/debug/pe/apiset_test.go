@@ -0,0 +1,160 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// A testContract describes an entry of a schema built by makeAPISetSchema.
+type testContract struct {
+	name  string            // full name, without .dll
+	host  string            // default host
+	hosts map[string]string // importer to host
+}
+
+// makeAPISetSchema returns a version 6 API set schema of contracts.
+func makeAPISetSchema(contracts []testContract) []byte {
+	var strs bytes.Buffer
+	var values [][5]uint32
+	var entries [][6]uint32
+	// Strings go after the fixed-size records, whose
+	// size is known once all values are counted.
+	str := func(s string) (off, n uint32) {
+		off = uint32(strs.Len())
+		for _, u := range utf16.Encode([]rune(s)) {
+			binary.Write(&strs, binary.LittleEndian, u)
+		}
+		return off, uint32(strs.Len()) - off
+	}
+	for _, c := range contracts {
+		noff, nlen := str(c.name)
+		hashed := uint32(2 * bytes.LastIndexByte([]byte(c.name), '-'))
+		first := uint32(len(values))
+		hoff, hlen := str(c.host)
+		values = append(values, [5]uint32{0, 0, 0, hoff, hlen})
+		for imp, host := range c.hosts {
+			ioff, ilen := str(imp)
+			hoff, hlen := str(host)
+			values = append(values, [5]uint32{0, ioff, ilen, hoff, hlen})
+		}
+		entries = append(entries, [6]uint32{0, noff, nlen, hashed, first, uint32(len(values)) - first})
+	}
+	entryOff := uint32(apiSetNamespaceSize)
+	valueOff := entryOff + uint32(len(entries))*apiSetEntrySize
+	strOff := valueOff + uint32(len(values))*apiSetValueSize
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, [7]uint32{6, strOff + uint32(strs.Len()), 0, uint32(len(entries)), entryOff, 0, 0})
+	for _, e := range entries {
+		e[1] += strOff
+		e[4] = valueOff + e[4]*apiSetValueSize
+		binary.Write(&b, binary.LittleEndian, e)
+	}
+	for _, v := range values {
+		if v[2] > 0 {
+			v[1] += strOff
+		}
+		v[3] += strOff
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.Write(strs.Bytes())
+	return b.Bytes()
+}
+
+func TestAPISetSchema(t *testing.T) {
+	s, err := ParseAPISetSchema(makeAPISetSchema([]testContract{
+		{name: "api-ms-win-core-file-l1-2-4", host: "kernelbase.dll"},
+		{name: "api-ms-win-core-com-l1-1-3", host: "combase.dll", hosts: map[string]string{"ole32.dll": "ole32.dll"}},
+		{name: "ext-ms-win-missing-l1-1-0", host: ""},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		contract, importer string
+		host               string
+		ok                 bool
+	}{
+		{"api-ms-win-core-file-l1-2-4.dll", "", "kernelbase.dll", true},
+		{"API-MS-Win-Core-File-L1-2-0.DLL", "app.exe", "kernelbase.dll", true},
+		{"api-ms-win-core-file-l1-1-0.dll", "", "", false},
+		{"api-ms-win-core-com-l1-1-0.dll", "app.exe", "combase.dll", true},
+		{"api-ms-win-core-com-l1-1-0.dll", "OLE32.dll", "ole32.dll", true},
+		{"ext-ms-win-missing-l1-1-0.dll", "", "", false},
+	} {
+		host, ok := s.ResolveAPISet(tt.contract, tt.importer)
+		if host != tt.host || ok != tt.ok {
+			t.Errorf("ResolveAPISet(%q, %q) = %q, %v; want %q, %v", tt.contract, tt.importer, host, ok, tt.host, tt.ok)
+		}
+	}
+
+	imps := []Import{
+		{DLL: "KERNEL32.dll", Name: "CreateFileW"},
+		{DLL: "api-ms-win-core-file-l1-1-0.dll", Name: "ReadFile"},
+		{DLL: "api-ms-win-core-file-l1-2-0.dll", Name: "GetTempPath2W"},
+	}
+	ResolveAPISets(imps, s, "app.exe")
+	for i, want := range []string{"", "", "kernelbase.dll"} {
+		if imps[i].Host != want {
+			t.Errorf("import %s!%s has host %q, want %q", imps[i].DLL, imps[i].Name, imps[i].Host, want)
+		}
+	}
+
+	if _, err := ParseAPISetSchema([]byte{2, 0, 0, 0}); err == nil {
+		t.Errorf("parsing a truncated schema succeeded")
+	}
+	b := makeAPISetSchema([]testContract{{name: "api-ms-win-a-l1-1-0", host: "a.dll"}})
+	binary.LittleEndian.PutUint32(b[0:], 4)
+	if _, err := ParseAPISetSchema(b); err == nil {
+		t.Errorf("parsing a version 4 schema succeeded")
+	}
+}
+
+func TestExportResolverAPISets(t *testing.T) {
+	open := func(name string, exports []testExport) *File {
+		f, err := NewFile(bytes.NewReader(makeTestDLL(name, 1, exports)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	s, err := ParseAPISetSchema(makeAPISetSchema([]testContract{
+		{name: "api-ms-win-core-file-l1-1-0", host: "kernelbase.dll", hosts: map[string]string{"kernelbase.dll": "kernel32.dll"}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &ExportResolver{
+		Files: map[string]*File{
+			"kernel32.dll": open("KERNEL32.dll", []testExport{
+				{name: "CreateFileW", forwarder: "api-ms-win-core-file-l1-1-0.CreateFileW"},
+				{name: "OldFunc"},
+			}),
+			"kernelbase.dll": open("KERNELBASE.dll", []testExport{
+				{name: "CreateFileW"},
+				{name: "OldFunc", forwarder: "api-ms-win-core-file-l1-1-0.OldFunc"},
+			}),
+		},
+		APISets: s,
+	}
+	for _, tt := range []struct {
+		importer, dll, name string
+		want                string
+	}{
+		{"", "kernel32.dll", "CreateFileW", "kernelbase.dll"},
+		{"app.exe", "api-ms-win-core-file-l1-1-0.dll", "CreateFileW", "kernelbase.dll"},
+		// kernelbase.dll gets the contract from kernel32.dll.
+		{"app.exe", "api-ms-win-core-file-l1-1-0", "OldFunc", "kernel32.dll"},
+		{"kernelbase.dll", "api-ms-win-core-file-l1-1-0", "OldFunc", "kernel32.dll"},
+	} {
+		dll, _, err := r.ResolveFrom(tt.importer, tt.dll, tt.name)
+		if err != nil || dll != tt.want {
+			t.Errorf("ResolveFrom(%q, %q, %q) = %q, %v; want %q", tt.importer, tt.dll, tt.name, dll, err, tt.want)
+		}
+	}
+}
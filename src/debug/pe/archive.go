@@ -0,0 +1,239 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// archiveMagic starts every COFF archive, such as a static
+// library or an import library (.lib file).
+const archiveMagic = "!<arch>\n"
+
+// An ArchiveMember is a member of a COFF archive.
+type ArchiveMember struct {
+	Name   string // file name, resolved through the long names member
+	Date   int64  // modification time, in seconds since the Unix epoch
+	Mode   uint32
+	Size   int64
+	Offset int64 // file offset of the member data
+
+	// Embed ReaderAt for ReadAt method.
+	io.ReaderAt
+	sr *io.SectionReader
+}
+
+// Open returns a new ReadSeeker reading the member data.
+func (m *ArchiveMember) Open() io.ReadSeeker {
+	return io.NewSectionReader(m.sr, 0, 1<<63-1)
+}
+
+// File parses the member as a COFF object file.
+// It fails for short import objects; see ShortImport.
+func (m *ArchiveMember) File() (*File, error) {
+	if m.IsShortImport() {
+		return nil, errors.New("pe: archive member " + m.Name + " is a short import object")
+	}
+	return NewFile(m.sr)
+}
+
+// An ArchiveSymbol is a symbol listed in the
+// symbol index of a COFF archive.
+type ArchiveSymbol struct {
+	Name   string
+	Member *ArchiveMember // the member that defines the symbol
+}
+
+// An Archive is a COFF archive, such as a static
+// library or an import library.
+type Archive struct {
+	// Members holds the object members of the archive,
+	// in file order. The linker and long names
+	// members are not included.
+	Members []*ArchiveMember
+
+	// Symbols holds the symbol index of the archive.
+	Symbols []ArchiveSymbol
+
+	closer io.Closer
+}
+
+// OpenArchive opens the named file using os.Open
+// and prepares it for use as a COFF archive.
+func OpenArchive(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewArchive(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a.closer = f
+	return a, nil
+}
+
+// Close closes the Archive.
+// If the Archive was created using NewArchive directly instead
+// of OpenArchive, Close has no effect.
+func (a *Archive) Close() error {
+	var err error
+	if a.closer != nil {
+		err = a.closer.Close()
+		a.closer = nil
+	}
+	return err
+}
+
+// IsArchive reports whether the data read from r
+// starts with the COFF archive signature.
+func IsArchive(r io.ReaderAt) bool {
+	var magic [len(archiveMagic)]byte
+	_, err := r.ReadAt(magic[:], 0)
+	return err == nil && string(magic[:]) == archiveMagic
+}
+
+// archiveHeaderSize is the size of an archive member header.
+const archiveHeaderSize = 60
+
+// NewArchive creates a new Archive for accessing
+// a COFF archive in an underlying reader.
+func NewArchive(r io.ReaderAt) (*Archive, error) {
+	if !IsArchive(r) {
+		return nil, &FormatError{0, "archive", ErrBadMagic, nil}
+	}
+	size := readerSize(r)
+	a := new(Archive)
+	var longNames []byte
+	var index []byte // the first linker member
+	byOffset := make(map[int64]*ArchiveMember)
+	for off := int64(len(archiveMagic)); size < 0 || off < size; {
+		var hdr [archiveHeaderSize]byte
+		if _, err := r.ReadAt(hdr[:], off); err != nil {
+			if err == io.EOF && size < 0 {
+				break
+			}
+			return nil, formatError(off, "archive member header", err)
+		}
+		if hdr[58] != '`' || hdr[59] != '\n' {
+			return nil, &FormatError{off, "archive member header", ErrBadMagic, hdr[58:]}
+		}
+		name := strings.TrimRight(string(hdr[0:16]), " ")
+		msize, err := strconv.ParseInt(strings.TrimRight(string(hdr[48:58]), " "), 10, 64)
+		if err != nil || msize < 0 || size >= 0 && msize > size-off-archiveHeaderSize {
+			return nil, &FormatError{off, "archive member size", ErrOutOfBounds, string(hdr[48:58])}
+		}
+		data := off + archiveHeaderSize
+		switch {
+		case name == "/" && index == nil:
+			if index, err = readArchiveData(r, data, msize); err != nil {
+				return nil, err
+			}
+		case name == "/":
+			// The second linker member repeats the symbol index
+			// in another form; the first one is enough.
+		case name == "//":
+			if longNames, err = readArchiveData(r, data, msize); err != nil {
+				return nil, err
+			}
+		default:
+			m := &ArchiveMember{Size: msize, Offset: data}
+			if m.Name, err = archiveMemberName(name, longNames); err != nil {
+				return nil, &FormatError{off, "archive member name", err, name}
+			}
+			m.Date, _ = strconv.ParseInt(strings.TrimRight(string(hdr[16:28]), " "), 10, 64)
+			mode, _ := strconv.ParseUint(strings.TrimRight(string(hdr[40:48]), " "), 8, 32)
+			m.Mode = uint32(mode)
+			m.sr = io.NewSectionReader(r, data, msize)
+			m.ReaderAt = m.sr
+			a.Members = append(a.Members, m)
+			byOffset[off] = m
+		}
+		// Members are aligned to even offsets.
+		off = data + msize + msize&1
+	}
+	if index != nil {
+		syms, err := parseArchiveIndex(index, byOffset)
+		if err != nil {
+			return nil, err
+		}
+		a.Symbols = syms
+	}
+	return a, nil
+}
+
+// readArchiveData reads the size bytes of member data at off.
+func readArchiveData(r io.ReaderAt, off, size int64) ([]byte, error) {
+	b := make([]byte, size)
+	if n, err := r.ReadAt(b, off); n < len(b) {
+		return nil, formatError(off, "archive member", err)
+	}
+	return b, nil
+}
+
+// archiveMemberName decodes the name field of an archive member
+// header, which is either "name/" or, for long names, "/offset"
+// into the long names member.
+func archiveMemberName(name string, longNames []byte) (string, error) {
+	if !strings.HasPrefix(name, "/") {
+		return strings.TrimSuffix(name, "/"), nil
+	}
+	off, err := strconv.Atoi(name[1:])
+	if err != nil {
+		return "", err
+	}
+	if off < 0 || off >= len(longNames) {
+		return "", ErrOutOfBounds
+	}
+	b := longNames[off:]
+	// Long names end with a NUL or, as written
+	// by GNU tools, with "/\n".
+	for i, c := range b {
+		if c == 0 || c == '\n' {
+			return strings.TrimSuffix(string(b[:i]), "/"), nil
+		}
+	}
+	return string(b), nil
+}
+
+// parseArchiveIndex parses the first linker member of an archive,
+// which lists the symbols the archive defines: a big-endian count,
+// that many big-endian member header offsets, and that many
+// NUL-terminated symbol names.
+func parseArchiveIndex(b []byte, members map[int64]*ArchiveMember) ([]ArchiveSymbol, error) {
+	if len(b) < 4 {
+		return nil, &FormatError{-1, "archive symbol index", ErrTruncated, nil}
+	}
+	n := binary.BigEndian.Uint32(b)
+	if int64(n)*4 > int64(len(b)-4) {
+		return nil, &FormatError{-1, "archive symbol index", ErrOutOfBounds, n}
+	}
+	offs := b[4 : 4+4*n]
+	names := b[4+4*n:]
+	syms := make([]ArchiveSymbol, n)
+	for i := range syms {
+		end := 0
+		for end < len(names) && names[end] != 0 {
+			end++
+		}
+		if end == len(names) {
+			return nil, &FormatError{-1, "archive symbol index", ErrTruncated, nil}
+		}
+		off := int64(binary.BigEndian.Uint32(offs[4*i:]))
+		m := members[off]
+		if m == nil {
+			return nil, &FormatError{-1, "archive symbol index", errors.New("symbol refers to no member"), off}
+		}
+		syms[i] = ArchiveSymbol{Name: string(names[:end]), Member: m}
+		names = names[end+1:]
+	}
+	return syms, nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// A testMember is a member of an archive built by makeTestArchive.
+type testMember struct {
+	name    string
+	data    []byte
+	symbols []string
+}
+
+// makeTestArchive returns a COFF archive holding members,
+// with a symbol index and, if needed, a long names member.
+func makeTestArchive(members []testMember) []byte {
+	var longNames bytes.Buffer
+	names := make([]string, len(members))
+	for i, m := range members {
+		if len(m.name) < 16 {
+			names[i] = m.name + "/"
+		} else {
+			names[i] = fmt.Sprintf("/%d", longNames.Len())
+			longNames.WriteString(m.name + "\x00")
+		}
+	}
+	header := func(b *bytes.Buffer, name string, size int) {
+		fmt.Fprintf(b, "%-16s%-12d%-6s%-6s%-8o%-10d`\n", name, 0, "", "", 0644, size)
+	}
+	pad := func(n int) int { return n + n&1 }
+
+	// Lay out the members to learn their offsets.
+	var nsyms, symNames int
+	for _, m := range members {
+		nsyms += len(m.symbols)
+		for _, s := range m.symbols {
+			symNames += len(s) + 1
+		}
+	}
+	indexSize := 4 + 4*nsyms + symNames
+	off := len(archiveMagic) + archiveHeaderSize + pad(indexSize)
+	if longNames.Len() > 0 {
+		off += archiveHeaderSize + pad(longNames.Len())
+	}
+	var index bytes.Buffer
+	binary.Write(&index, binary.BigEndian, uint32(nsyms))
+	var strs bytes.Buffer
+	for _, m := range members {
+		for _, s := range m.symbols {
+			binary.Write(&index, binary.BigEndian, uint32(off))
+			strs.WriteString(s + "\x00")
+		}
+		off += archiveHeaderSize + pad(len(m.data))
+	}
+	index.Write(strs.Bytes())
+
+	var b bytes.Buffer
+	b.WriteString(archiveMagic)
+	write := func(name string, data []byte) {
+		header(&b, name, len(data))
+		b.Write(data)
+		if len(data)&1 != 0 {
+			b.WriteByte('\n')
+		}
+	}
+	write("/", index.Bytes())
+	if longNames.Len() > 0 {
+		write("//", longNames.Bytes())
+	}
+	for i, m := range members {
+		write(names[i], m.data)
+	}
+	return b.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	obj64, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj32, err := ioutil.ReadFile("testdata/gcc-386-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := makeTestArchive([]testMember{
+		{"hello64.o", obj64, []string{"main"}},
+		{"a-rather-long-member-name.o", obj32, []string{"_main", "_other"}},
+	})
+	if !IsArchive(bytes.NewReader(data)) {
+		t.Fatal("IsArchive reports false")
+	}
+	a, err := NewArchive(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Members) != 2 {
+		t.Fatalf("got %d members, want 2", len(a.Members))
+	}
+	wantNames := []string{"hello64.o", "a-rather-long-member-name.o"}
+	wantMachines := []uint16{IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386}
+	for i, m := range a.Members {
+		if m.Name != wantNames[i] {
+			t.Errorf("member %d is named %q, want %q", i, m.Name, wantNames[i])
+		}
+		if m.Mode != 0644 {
+			t.Errorf("member %d has mode %o, want 644", i, m.Mode)
+		}
+		f, err := m.File()
+		if err != nil {
+			t.Errorf("member %d: %v", i, err)
+			continue
+		}
+		if f.Machine != wantMachines[i] {
+			t.Errorf("member %d has machine %#x, want %#x", i, f.Machine, wantMachines[i])
+		}
+	}
+	wantSyms := []struct {
+		name   string
+		member int
+	}{{"main", 0}, {"_main", 1}, {"_other", 1}}
+	if len(a.Symbols) != len(wantSyms) {
+		t.Fatalf("got %d symbols, want %d", len(a.Symbols), len(wantSyms))
+	}
+	for i, s := range wantSyms {
+		if a.Symbols[i].Name != s.name || a.Symbols[i].Member != a.Members[s.member] {
+			t.Errorf("symbol %d = %q in %q, want %q in %q", i, a.Symbols[i].Name, a.Symbols[i].Member.Name, s.name, a.Members[s.member].Name)
+		}
+	}
+
+	if IsArchive(bytes.NewReader(obj64)) {
+		t.Errorf("IsArchive reports true for an object file")
+	}
+	if _, err := NewArchive(bytes.NewReader(data[:len(data)-100])); err == nil {
+		t.Errorf("NewArchive succeeded on a truncated archive")
+	}
+}
+
+// makeShortImport returns a short import object.
+func makeShortImport(typ, nameType, ordinal uint16, names ...string) []byte {
+	data := strings.Join(names, "\x00") + "\x00"
+	b := make([]byte, shortImportHeaderSize, shortImportHeaderSize+len(data))
+	binary.LittleEndian.PutUint16(b[2:], 0xffff)
+	binary.LittleEndian.PutUint16(b[6:], IMAGE_FILE_MACHINE_I386)
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint16(b[16:], ordinal)
+	binary.LittleEndian.PutUint16(b[18:], typ|nameType<<2)
+	return append(b, data...)
+}
+
+func TestShortImport(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		typ      uint16
+		nameType uint16
+		symbol   string
+		name     string
+	}{
+		{makeShortImport(IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME, 3, "CreateFileW", "KERNEL32.dll"), IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME, "CreateFileW", "CreateFileW"},
+		{makeShortImport(IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME_UNDECORATE, 0, "_Sleep@4", "KERNEL32.dll"), IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME_UNDECORATE, "_Sleep@4", "Sleep"},
+		{makeShortImport(IMPORT_OBJECT_DATA, IMPORT_OBJECT_NAME_NOPREFIX, 0, "_environ", "KERNEL32.dll"), IMPORT_OBJECT_DATA, IMPORT_OBJECT_NAME_NOPREFIX, "_environ", "environ"},
+		{makeShortImport(IMPORT_OBJECT_CODE, IMPORT_OBJECT_ORDINAL, 42, "_Ordinal42", "KERNEL32.dll"), IMPORT_OBJECT_CODE, IMPORT_OBJECT_ORDINAL, "_Ordinal42", ""},
+		{makeShortImport(IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME_EXPORTAS, 0, "_Foo", "KERNEL32.dll", "RealFoo"), IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME_EXPORTAS, "_Foo", "RealFoo"},
+	}
+	var members []testMember
+	for _, tt := range tests {
+		members = append(members, testMember{"KERNEL32.dll", tt.data, []string{tt.symbol}})
+	}
+	a, err := NewArchive(bytes.NewReader(makeTestArchive(members)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		m := a.Members[i]
+		if !m.IsShortImport() {
+			t.Errorf("member %d is not a short import", i)
+			continue
+		}
+		imp, err := m.ShortImport()
+		if err != nil {
+			t.Errorf("member %d: %v", i, err)
+			continue
+		}
+		if imp.Type != tt.typ || imp.NameType != tt.nameType || imp.Symbol != tt.symbol || imp.DLL != "KERNEL32.dll" || imp.Machine != IMAGE_FILE_MACHINE_I386 {
+			t.Errorf("member %d = %+v", i, imp)
+		}
+		if name := imp.Name(); name != tt.name {
+			t.Errorf("member %d: Name() = %q, want %q", i, name, tt.name)
+		}
+	}
+	if imp, _ := a.Members[3].ShortImport(); imp.OrdinalOrHint != 42 {
+		t.Errorf("ordinal = %d, want 42", imp.OrdinalOrHint)
+	}
+	if _, err := a.Members[0].File(); err == nil {
+		t.Errorf("parsing a short import as a COFF object succeeded")
+	}
+	if _, err := NewShortImport(bytes.NewReader(tests[0].data[:25])); err == nil {
+		t.Errorf("parsing a truncated short import succeeded")
+	}
+}
+
+// makeAnonObject returns an anonymous object header
+// of the given version and class.
+func makeAnonObject(version uint16, class GUID) []byte {
+	b := make([]byte, anonObjectHeaderV2Size)
+	binary.LittleEndian.PutUint16(b[2:], 0xffff)
+	binary.LittleEndian.PutUint16(b[4:], version)
+	binary.LittleEndian.PutUint16(b[6:], IMAGE_FILE_MACHINE_AMD64)
+	binary.LittleEndian.PutUint32(b[12:], class.Data1)
+	binary.LittleEndian.PutUint16(b[16:], class.Data2)
+	binary.LittleEndian.PutUint16(b[18:], class.Data3)
+	copy(b[20:28], class.Data4[:])
+	binary.LittleEndian.PutUint32(b[32:], 1) // Flags
+	return b
+}
+
+func TestAnonObject(t *testing.T) {
+	class := GUID{0x0cb3fe38, 0xd9a5, 0x4dab, [8]byte{0xac, 0x9b, 0xd6, 0xb6, 0x22, 0x26, 0x53, 0xc2}}
+	if s := class.String(); s != "0cb3fe38-d9a5-4dab-ac9b-d6b6222653c2" {
+		t.Errorf("GUID.String() = %s", s)
+	}
+	for _, version := range []uint16{1, 2} {
+		obj := makeAnonObject(version, class)
+		_, err := NewFile(bytes.NewReader(obj))
+		aerr, ok := err.(*AnonObjectError)
+		if !ok {
+			t.Errorf("version %d: NewFile returned %v, want an AnonObjectError", version, err)
+			continue
+		}
+		h := aerr.Header
+		if h.Version != version || h.Machine != IMAGE_FILE_MACHINE_AMD64 || h.ClassID != class {
+			t.Errorf("version %d: got header %+v", version, h)
+		}
+		if wantFlags := uint32(version - 1); h.Flags != wantFlags {
+			t.Errorf("version %d: Flags = %d, want %d", version, h.Flags, wantFlags)
+		}
+	}
+	_, err := NewFile(bytes.NewReader(makeShortImport(IMPORT_OBJECT_CODE, IMPORT_OBJECT_NAME, 0, "f", "x.dll")))
+	if fe, ok := err.(*FormatError); !ok || fe.Err != errShortImport {
+		t.Errorf("NewFile of a short import returned %v", err)
+	}
+}
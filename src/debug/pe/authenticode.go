@@ -0,0 +1,350 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// A CertificateInfo summarizes an X.509 certificate found in an
+// Authenticode signature. Raw can be parsed with crypto/x509 for
+// the rest of the certificate.
+type CertificateInfo struct {
+	Raw          []byte // DER encoding of the certificate
+	SerialNumber *big.Int
+	Issuer       pkix.Name
+	Subject      pkix.Name
+	NotBefore    time.Time
+	NotAfter     time.Time
+}
+
+// A Timestamp is a countersignature of an Authenticode signature by a
+// time-stamping authority (TSA), attesting that the signature existed
+// at Time. It lets the signature outlive the signing certificate.
+type Timestamp struct {
+	Time    time.Time
+	RFC3161 bool             // an RFC 3161 time-stamp token, not a PKCS #9 countersignature
+	TSA     *CertificateInfo // certificate of the TSA, or nil if not included
+}
+
+// An AuthenticodeSignature describes an Authenticode signature, the
+// PKCS #7 SignedData of a WIN_CERT_TYPE_PKCS_SIGNED_DATA attribute
+// certificate. Its cryptographic validity is not checked.
+type AuthenticodeSignature struct {
+	Signer       *CertificateInfo   // certificate of the signer, or nil if not included
+	Certificates []*CertificateInfo // all included certificates, for building chains
+	Timestamps   []Timestamp
+
+	// SigningTime is the time the signer claims to have signed
+	// at, or the zero time. Unlike Timestamps, it is not vouched
+	// for by a third party. Signing tools rarely set it.
+	SigningTime time.Time
+}
+
+// Object identifiers found in Authenticode signatures.
+var (
+	oidSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSigningTime        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidCounterSignature   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidTSTInfo            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidNestedSignature    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 4, 1}
+	oidRFC3161Countersign = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+)
+
+// The ASN.1 structures below are those of PKCS #7 (RFC 2315),
+// CMS (RFC 5652), X.509 (RFC 5280) and RFC 3161, reduced to the
+// fields this package uses. Trailing fields are ignored.
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"` // explicitly tagged
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue     `asn1:"optional,tag:1"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	SignerIdentifier          asn1.RawValue // IssuerAndSerialNumber, or a CMS SubjectKeyIdentifier
+	DigestAlgorithm           asn1.RawValue
+	AuthenticatedAttributes   []pkcs7Attribute `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm asn1.RawValue
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes []pkcs7Attribute `asn1:"optional,tag:1"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type x509Certificate struct {
+	TBSCertificate x509TBSCertificate
+}
+
+type x509TBSCertificate struct {
+	Version      int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber *big.Int
+	Signature    asn1.RawValue
+	Issuer       asn1.RawValue
+	Validity     struct{ NotBefore, NotAfter time.Time }
+	Subject      asn1.RawValue
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint asn1.RawValue
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// AuthenticodeSignatures returns the Authenticode signatures in the
+// attribute certificate table of f. Signatures nested in another,
+// as when a file is signed with both SHA-1 and SHA-256, follow the
+// one holding them.
+func (f *File) AuthenticodeSignatures() ([]*AuthenticodeSignature, error) {
+	certs, err := f.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	var sigs []*AuthenticodeSignature
+	for _, c := range certs {
+		if c.Type != WIN_CERT_TYPE_PKCS_SIGNED_DATA {
+			continue
+		}
+		s, err := parseAuthenticode(c.Data, 0)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, s...)
+	}
+	return sigs, nil
+}
+
+// ParseAuthenticode parses data, the PKCS #7 SignedData of an
+// Authenticode signature, followed by any nested signatures.
+func ParseAuthenticode(data []byte) ([]*AuthenticodeSignature, error) {
+	return parseAuthenticode(data, 0)
+}
+
+// maxNestedSignatures limits the depth of nested signatures.
+const maxNestedSignatures = 4
+
+func parseAuthenticode(data []byte, depth int) ([]*AuthenticodeSignature, error) {
+	if depth > maxNestedSignatures {
+		return nil, authenticodeError(errors.New("signatures nested too deeply"))
+	}
+	sd, err := parseSignedData(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, authenticodeError(errors.New("not exactly one signer"))
+	}
+	certs := parseCertificates(sd.Certificates.Bytes)
+	si := &sd.SignerInfos[0]
+	sig := &AuthenticodeSignature{
+		Signer:       findCertificate(certs, si.SignerIdentifier),
+		Certificates: certs,
+	}
+	if t, ok, err := signingTime(si.AuthenticatedAttributes); err != nil {
+		return nil, err
+	} else if ok {
+		sig.SigningTime = t
+	}
+	sigs := []*AuthenticodeSignature{sig}
+	for _, attr := range si.UnauthenticatedAttributes {
+		for _, v := range attributeValues(attr) {
+			switch {
+			case attr.Type.Equal(oidCounterSignature):
+				var cs pkcs7SignerInfo
+				if _, err := asn1.Unmarshal(v.FullBytes, &cs); err != nil {
+					return nil, authenticodeError(err)
+				}
+				t, _, err := signingTime(cs.AuthenticatedAttributes)
+				if err != nil {
+					return nil, err
+				}
+				sig.Timestamps = append(sig.Timestamps, Timestamp{
+					Time: t,
+					TSA:  findCertificate(certs, cs.SignerIdentifier),
+				})
+			case attr.Type.Equal(oidRFC3161Countersign):
+				ts, err := parseTimeStampToken(v.FullBytes)
+				if err != nil {
+					return nil, err
+				}
+				sig.Timestamps = append(sig.Timestamps, *ts)
+			case attr.Type.Equal(oidNestedSignature):
+				nested, err := parseAuthenticode(v.FullBytes, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				sigs = append(sigs, nested...)
+			}
+		}
+	}
+	return sigs, nil
+}
+
+// parseSignedData parses b, a ContentInfo holding a SignedData.
+func parseSignedData(b []byte) (*pkcs7SignedData, error) {
+	var ci pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(b, &ci); err != nil {
+		return nil, authenticodeError(err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, authenticodeError(errors.New("not a PKCS #7 SignedData"))
+	}
+	sd := new(pkcs7SignedData)
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, sd); err != nil {
+		return nil, authenticodeError(err)
+	}
+	return sd, nil
+}
+
+// parseTimeStampToken parses b, an RFC 3161 time-stamp token.
+func parseTimeStampToken(b []byte) (*Timestamp, error) {
+	sd, err := parseSignedData(b)
+	if err != nil {
+		return nil, err
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) == 0 {
+		return nil, authenticodeError(errors.New("malformed time-stamp token"))
+	}
+	// The TSTInfo is DER inside an OCTET STRING.
+	var der []byte
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &der); err != nil {
+		return nil, authenticodeError(err)
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, authenticodeError(err)
+	}
+	return &Timestamp{
+		Time:    info.GenTime,
+		RFC3161: true,
+		TSA:     findCertificate(parseCertificates(sd.Certificates.Bytes), sd.SignerInfos[0].SignerIdentifier),
+	}, nil
+}
+
+// parseCertificates parses b, the contents of the certificates field
+// of a SignedData. Entries that are not X.509 certificates, such as
+// attribute certificates, or that cannot be parsed are skipped.
+func parseCertificates(b []byte) []*CertificateInfo {
+	var certs []*CertificateInfo
+	for len(b) > 0 {
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(b, &raw)
+		if err != nil {
+			break
+		}
+		b = rest
+		if c, err := parseCertificateInfo(raw.FullBytes); err == nil {
+			certs = append(certs, c)
+		}
+	}
+	return certs
+}
+
+// parseCertificateInfo parses the DER certificate der.
+func parseCertificateInfo(der []byte) (*CertificateInfo, error) {
+	var cert x509Certificate
+	if _, err := asn1.Unmarshal(der, &cert); err != nil {
+		return nil, err
+	}
+	tbs := &cert.TBSCertificate
+	c := &CertificateInfo{
+		Raw:          der,
+		SerialNumber: tbs.SerialNumber,
+		NotBefore:    tbs.Validity.NotBefore,
+		NotAfter:     tbs.Validity.NotAfter,
+	}
+	for _, n := range []struct {
+		raw  asn1.RawValue
+		name *pkix.Name
+	}{{tbs.Issuer, &c.Issuer}, {tbs.Subject, &c.Subject}} {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(n.raw.FullBytes, &rdns); err != nil {
+			return nil, err
+		}
+		n.name.FillFromRDNSequence(&rdns)
+	}
+	return c, nil
+}
+
+// findCertificate returns the certificate of certs identified by sid,
+// the issuer and serial number of a SignerInfo, or nil if there is
+// none. Signers identified by subject key identifier are not found.
+func findCertificate(certs []*CertificateInfo, sid asn1.RawValue) *CertificateInfo {
+	var ias pkcs7IssuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil || ias.SerialNumber == nil {
+		return nil
+	}
+	for _, c := range certs {
+		var cert x509Certificate
+		if _, err := asn1.Unmarshal(c.Raw, &cert); err != nil {
+			continue
+		}
+		if bytes.Equal(cert.TBSCertificate.Issuer.FullBytes, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// signingTime returns the value of the signing time attribute
+// among attrs, and whether there is one.
+func signingTime(attrs []pkcs7Attribute) (time.Time, bool, error) {
+	for _, attr := range attrs {
+		if !attr.Type.Equal(oidSigningTime) {
+			continue
+		}
+		for _, v := range attributeValues(attr) {
+			var t time.Time
+			if _, err := asn1.Unmarshal(v.FullBytes, &t); err != nil {
+				return time.Time{}, false, authenticodeError(err)
+			}
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// attributeValues returns the values of the attribute attr.
+func attributeValues(attr pkcs7Attribute) []asn1.RawValue {
+	var vs []asn1.RawValue
+	for b := attr.Values.Bytes; len(b) > 0; {
+		var v asn1.RawValue
+		rest, err := asn1.Unmarshal(b, &v)
+		if err != nil {
+			break
+		}
+		vs = append(vs, v)
+		b = rest
+	}
+	return vs
+}
+
+func authenticodeError(err error) error {
+	return &FormatError{-1, "Authenticode signature", err, nil}
+}
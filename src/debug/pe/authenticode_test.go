@@ -0,0 +1,188 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func mustMarshal(t *testing.T, v interface{}, params string) []byte {
+	b, err := asn1.MarshalWithParams(v, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testCertificate returns a self-signed certificate for name.
+func testCertificate(t *testing.T, name string, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Gopher"}},
+		NotBefore:    time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// testSignerInfo returns a SignerInfo of cert with the given attributes.
+// The signature is not valid.
+func testSignerInfo(t *testing.T, cert *x509.Certificate, auth, unauth []pkcs7Attribute) pkcs7SignerInfo {
+	alg := mustMarshal(t, pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}, "")
+	return pkcs7SignerInfo{
+		Version:                   1,
+		SignerIdentifier:          asn1.RawValue{FullBytes: mustMarshal(t, pkcs7IssuerAndSerial{asn1.RawValue{FullBytes: cert.RawIssuer}, cert.SerialNumber}, "")},
+		DigestAlgorithm:           asn1.RawValue{FullBytes: alg},
+		AuthenticatedAttributes:   auth,
+		DigestEncryptionAlgorithm: asn1.RawValue{FullBytes: alg},
+		EncryptedDigest:           []byte("signature"),
+		UnauthenticatedAttributes: unauth,
+	}
+}
+
+// testSignedData returns a ContentInfo holding a SignedData
+// of content, with the given certificates and signer.
+func testSignedData(t *testing.T, contentType asn1.ObjectIdentifier, content []byte, certs []*x509.Certificate, si pkcs7SignerInfo) []byte {
+	var raw []byte
+	for _, c := range certs {
+		raw = append(raw, c.Raw...)
+	}
+	sd := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      pkcs7ContentInfo{contentType, explicitTag0(content)},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw},
+		SignerInfos:      []pkcs7SignerInfo{si},
+	}
+	return mustMarshal(t, pkcs7ContentInfo{oidSignedData, explicitTag0(mustMarshal(t, sd, ""))}, "")
+}
+
+// explicitTag0 returns the explicitly tagged [0] field holding the DER b.
+func explicitTag0(b []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+}
+
+func testAttribute(t *testing.T, oid asn1.ObjectIdentifier, value []byte) pkcs7Attribute {
+	return pkcs7Attribute{oid, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value}}
+}
+
+func TestAuthenticode(t *testing.T) {
+	signer := testCertificate(t, "Signer", 1)
+	tsa := testCertificate(t, "TSA", 2)
+	other := testCertificate(t, "TSA", 3)
+	spc := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	spcContent := mustMarshal(t, []int{1, 2}, "")
+	legacy := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	rfc3161 := time.Date(2017, 3, 2, 12, 0, 0, 0, time.UTC)
+	claimed := time.Date(2017, 3, 3, 12, 0, 0, 0, time.UTC)
+
+	// A legacy countersignature by tsa, whose
+	// certificate is in the outer SignedData.
+	cs := testSignerInfo(t, tsa, []pkcs7Attribute{
+		testAttribute(t, oidSigningTime, mustMarshal(t, legacy, "")),
+	}, nil)
+
+	// An RFC 3161 token by other, carrying its own certificate.
+	info := tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: asn1.RawValue{FullBytes: spcContent},
+		SerialNumber:   big.NewInt(42),
+		GenTime:        rfc3161,
+	}
+	econtent := mustMarshal(t, mustMarshal(t, info, ""), "") // an OCTET STRING
+	token := testSignedData(t, oidTSTInfo, econtent, []*x509.Certificate{other}, testSignerInfo(t, other, nil, nil))
+
+	// A nested signature, with a signing time but no timestamp.
+	nested := testSignedData(t, spc, spcContent, []*x509.Certificate{signer}, testSignerInfo(t, signer, []pkcs7Attribute{
+		testAttribute(t, oidSigningTime, mustMarshal(t, claimed, "")),
+	}, nil))
+
+	data := testSignedData(t, spc, spcContent, []*x509.Certificate{tsa, signer}, testSignerInfo(t, signer, nil, []pkcs7Attribute{
+		testAttribute(t, oidCounterSignature, mustMarshal(t, cs, "")),
+		testAttribute(t, oidRFC3161Countersign, token),
+		testAttribute(t, oidNestedSignature, nested),
+	}))
+
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteCertificates(&buf, []Certificate{{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, data}}); err != nil {
+		t.Fatal(err)
+	}
+	f, err = NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs, err := f.AuthenticodeSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(sigs))
+	}
+
+	isCert := func(c *CertificateInfo, want *x509.Certificate) bool {
+		return c != nil && bytes.Equal(c.Raw, want.Raw) && c.Subject.CommonName == want.Subject.CommonName &&
+			c.Issuer.CommonName == want.Issuer.CommonName && c.SerialNumber.Cmp(want.SerialNumber) == 0 &&
+			c.NotBefore.Equal(want.NotBefore) && c.NotAfter.Equal(want.NotAfter)
+	}
+	s := sigs[0]
+	if !isCert(s.Signer, signer) {
+		t.Errorf("Signer = %+v, want %s", s.Signer, signer.Subject.CommonName)
+	}
+	if len(s.Certificates) != 2 || !isCert(s.Certificates[0], tsa) {
+		t.Errorf("got %d certificates", len(s.Certificates))
+	}
+	if !s.SigningTime.IsZero() {
+		t.Errorf("SigningTime = %v, want zero", s.SigningTime)
+	}
+	if len(s.Timestamps) != 2 {
+		t.Fatalf("got %d timestamps, want 2", len(s.Timestamps))
+	}
+	if ts := s.Timestamps[0]; !ts.Time.Equal(legacy) || ts.RFC3161 || !isCert(ts.TSA, tsa) {
+		t.Errorf("legacy timestamp = %v, %v, %+v", ts.Time, ts.RFC3161, ts.TSA)
+	}
+	if ts := s.Timestamps[1]; !ts.Time.Equal(rfc3161) || !ts.RFC3161 || !isCert(ts.TSA, other) {
+		t.Errorf("RFC 3161 timestamp = %v, %v, %+v", ts.Time, ts.RFC3161, ts.TSA)
+	}
+	if s := sigs[1]; !isCert(s.Signer, signer) || !s.SigningTime.Equal(claimed) || len(s.Timestamps) != 0 {
+		t.Errorf("nested signature = %+v", s)
+	}
+
+	for _, b := range [][]byte{nil, []byte("not DER"), spcContent, nested[:len(nested)-1], token[:20]} {
+		if _, err := ParseAuthenticode(b); err == nil {
+			t.Errorf("ParseAuthenticode(%x) succeeded", b)
+		}
+	}
+}
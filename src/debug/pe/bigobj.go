@@ -0,0 +1,211 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// BigObjHeader is the header of an object file in the big object
+// format (ANON_OBJECT_HEADER_BIGOBJ), which compilers produce with
+// /bigobj or -mbig-obj. It takes the place of the COFF file header
+// and allows up to 2^31 sections.
+type BigObjHeader struct {
+	Version              uint16
+	Machine              uint16
+	TimeDateStamp        uint32
+	ClassID              GUID
+	SizeOfData           uint32
+	Flags                uint32
+	MetaDataSize         uint32
+	MetaDataOffset       uint32
+	NumberOfSections     uint32
+	PointerToSymbolTable uint32
+	NumberOfSymbols      uint32
+}
+
+// bigObjHeaderSize is the size of ANON_OBJECT_HEADER_BIGOBJ.
+const bigObjHeaderSize = 56
+
+// bigObjClassID is the class ID of big object files.
+var bigObjClassID = GUID{0xd1baa1c7, 0xbaee, 0x4ba9, [8]byte{0xaf, 0x20, 0xfa, 0xf6, 0x6a, 0xa4, 0xdc, 0xb8}}
+
+// isBigObj reports whether h is the header of a big object file.
+func isBigObj(h *AnonObjectHeader) bool {
+	return h.Version >= 2 && h.ClassID == bigObjClassID
+}
+
+// COFFBigSymbolSize is the size of a symbol
+// table record in a big object file.
+const COFFBigSymbolSize = 20
+
+// COFFBigSymbol represents a single symbol table record of a big
+// object file. It differs from COFFSymbol in having a 32-bit
+// section number.
+type COFFBigSymbol struct {
+	Name               [8]uint8
+	Value              uint32
+	SectionNumber      int32
+	Type               uint16
+	StorageClass       uint8
+	NumberOfAuxSymbols uint8
+}
+
+// IsBigObj reports whether f is in the big object format.
+// If so, f.BigObjHeader holds its header and f.COFFBigSymbols
+// its symbol table records.
+func (f *File) IsBigObj() bool {
+	return f.BigObjHeader != nil
+}
+
+// symbolSize returns the size of the symbol table records of f.
+func (f *File) symbolSize() int64 {
+	if f.BigObjHeader != nil {
+		return COFFBigSymbolSize
+	}
+	return COFFSymbolSize
+}
+
+// numberOfSections returns the number of sections in the section
+// table of f, which for big object files can exceed 65535.
+func (f *File) numberOfSections() int64 {
+	if f.BigObjHeader != nil {
+		return int64(f.BigObjHeader.NumberOfSections)
+	}
+	return int64(f.NumberOfSections)
+}
+
+// readBigObjHeader reads the header of the big object file f and
+// fills in f.FileHeader from it. NumberOfSections is capped at
+// 65535; f.BigObjHeader holds the real count.
+func (f *File) readBigObjHeader() error {
+	var b [bigObjHeaderSize]byte
+	if _, err := f.r.ReadAt(b[:], 0); err != nil {
+		return formatError(0, "big object header", err)
+	}
+	h := &BigObjHeader{
+		Version:              binary.LittleEndian.Uint16(b[4:]),
+		Machine:              binary.LittleEndian.Uint16(b[6:]),
+		TimeDateStamp:        binary.LittleEndian.Uint32(b[8:]),
+		ClassID:              decodeGUID(b[12:28]),
+		SizeOfData:           binary.LittleEndian.Uint32(b[28:]),
+		Flags:                binary.LittleEndian.Uint32(b[32:]),
+		MetaDataSize:         binary.LittleEndian.Uint32(b[36:]),
+		MetaDataOffset:       binary.LittleEndian.Uint32(b[40:]),
+		NumberOfSections:     binary.LittleEndian.Uint32(b[44:]),
+		PointerToSymbolTable: binary.LittleEndian.Uint32(b[48:]),
+		NumberOfSymbols:      binary.LittleEndian.Uint32(b[52:]),
+	}
+	f.BigObjHeader = h
+	f.FileHeader = FileHeader{
+		Machine:              h.Machine,
+		NumberOfSections:     uint16(h.NumberOfSections),
+		TimeDateStamp:        h.TimeDateStamp,
+		PointerToSymbolTable: h.PointerToSymbolTable,
+		NumberOfSymbols:      h.NumberOfSymbols,
+	}
+	if h.NumberOfSections > 0xffff {
+		f.FileHeader.NumberOfSections = 0xffff
+	}
+	return nil
+}
+
+// decodeCOFFBigSymbol decodes the COFFBigSymbolSize bytes of b into sym.
+func decodeCOFFBigSymbol(b []byte, sym *COFFBigSymbol) {
+	copy(sym.Name[:], b[0:8])
+	sym.Value = binary.LittleEndian.Uint32(b[8:12])
+	sym.SectionNumber = int32(binary.LittleEndian.Uint32(b[12:16]))
+	sym.Type = binary.LittleEndian.Uint16(b[16:18])
+	sym.StorageClass = b[18]
+	sym.NumberOfAuxSymbols = b[19]
+}
+
+// encodeCOFFBigSymbol encodes sym into the COFFBigSymbolSize bytes of b.
+func encodeCOFFBigSymbol(b []byte, sym *COFFBigSymbol) {
+	copy(b[0:8], sym.Name[:])
+	binary.LittleEndian.PutUint32(b[8:12], sym.Value)
+	binary.LittleEndian.PutUint32(b[12:16], uint32(sym.SectionNumber))
+	binary.LittleEndian.PutUint16(b[16:18], sym.Type)
+	b[18] = sym.StorageClass
+	b[19] = sym.NumberOfAuxSymbols
+}
+
+// readBigSymbols reads the symbol table of the big object file f,
+// as described by fh, into f.COFFBigSymbols and returns the records
+// converted to COFFSymbols. Auxiliary records share the layout of
+// regular COFF ones, padded to the larger size, so they are
+// converted by dropping the padding. On error, the records read so
+// far are kept, for recovery mode.
+func (f *File) readBigSymbols(fh *FileHeader) ([]COFFSymbol, error) {
+	if fh.PointerToSymbolTable == 0 || fh.NumberOfSymbols == 0 {
+		return nil, nil
+	}
+	if err := checkSymbolTable(fh, COFFBigSymbolSize, f.size); err != nil {
+		return nil, err
+	}
+	n, err := symbolCount(fh)
+	if err != nil {
+		return nil, err
+	}
+	sr := io.NewSectionReader(f.r, int64(fh.PointerToSymbolTable), int64(n)*COFFBigSymbolSize)
+	buf := make([]byte, walkChunk*COFFBigSymbolSize)
+	var big []COFFBigSymbol
+	var syms []COFFSymbol
+	aux := 0
+	// As in readCOFFSymbols, grow the table as data arrives.
+	for len(big) < n {
+		chunk := n - len(big)
+		if chunk > walkChunk {
+			chunk = walkChunk
+		}
+		b := buf[:chunk*COFFBigSymbolSize]
+		if _, err = io.ReadFull(sr, b); err != nil {
+			err = formatError(int64(fh.PointerToSymbolTable), "symbol table", err)
+			break
+		}
+		for i := 0; i < chunk; i++ {
+			rec := b[i*COFFBigSymbolSize:]
+			var sym COFFBigSymbol
+			var csym COFFSymbol
+			decodeCOFFBigSymbol(rec, &sym)
+			if aux > 0 {
+				decodeCOFFSymbol(rec, &csym)
+				aux--
+			} else {
+				csym = sym.coffSymbol()
+				aux = int(sym.NumberOfAuxSymbols)
+			}
+			big = append(big, sym)
+			syms = append(syms, csym)
+		}
+	}
+	f.COFFBigSymbols = big
+	return syms, err
+}
+
+// coffSymbol converts sym to a COFFSymbol, truncating its section
+// number. The Symbols of the file keep the full number, as returned
+// by Symbol.FullSectionNumber.
+func (sym *COFFBigSymbol) coffSymbol() COFFSymbol {
+	return COFFSymbol{
+		Name:               sym.Name,
+		Value:              sym.Value,
+		SectionNumber:      int16(sym.SectionNumber),
+		Type:               sym.Type,
+		StorageClass:       sym.StorageClass,
+		NumberOfAuxSymbols: sym.NumberOfAuxSymbols,
+	}
+}
+
+// FullName finds real name of symbol sym. Normally name is stored
+// in sym.Name, but if it is longer then 8 characters, it is stored
+// in COFF string table st instead.
+func (sym *COFFBigSymbol) FullName(st StringTable) (string, error) {
+	if ok, offset := isSymNameOffset(sym.Name); ok {
+		return st.String(offset)
+	}
+	return cstring(sym.Name[:]), nil
+}
@@ -0,0 +1,274 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// makeBigObj converts the COFF object obj to the big object
+// format. The section table and section contents are moved to
+// follow the larger header, and a converted copy of the symbol
+// and string tables is appended to the file.
+func makeBigObj(obj []byte) []byte {
+	var fh FileHeader
+	binary.Read(bytes.NewReader(obj), binary.LittleEndian, &fh)
+	const shift = bigObjHeaderSize - 20
+
+	out := make([]byte, bigObjHeaderSize, len(obj)+shift)
+	out = append(out, obj[20:]...)
+	for i := 0; i < int(fh.NumberOfSections); i++ {
+		sh := out[bigObjHeaderSize+int(fh.SizeOfOptionalHeader)+40*i:]
+		for _, off := range []int{20, 24, 28} { // PointerToRawData, PointerToRelocations, PointerToLinenumbers
+			if p := binary.LittleEndian.Uint32(sh[off:]); p != 0 {
+				binary.LittleEndian.PutUint32(sh[off:], p+shift)
+			}
+		}
+	}
+
+	symtab := uint32(len(out))
+	syms := obj[fh.PointerToSymbolTable:]
+	aux := 0
+	for i := 0; i < int(fh.NumberOfSymbols); i++ {
+		rec := syms[i*COFFSymbolSize : (i+1)*COFFSymbolSize]
+		if aux > 0 {
+			// Auxiliary records keep their layout, padded to the
+			// larger record size.
+			out = append(out, rec...)
+			out = append(out, 0, 0)
+			aux--
+			continue
+		}
+		var b [COFFBigSymbolSize]byte
+		copy(b[0:12], rec[0:12])
+		binary.LittleEndian.PutUint32(b[12:], uint32(int32(int16(binary.LittleEndian.Uint16(rec[12:])))))
+		copy(b[16:20], rec[14:18])
+		out = append(out, b[:]...)
+		aux = int(rec[17])
+	}
+	out = append(out, syms[int(fh.NumberOfSymbols)*COFFSymbolSize:]...) // string table
+
+	h := out[:bigObjHeaderSize]
+	binary.LittleEndian.PutUint16(h[2:], 0xffff)
+	binary.LittleEndian.PutUint16(h[4:], 2)
+	binary.LittleEndian.PutUint16(h[6:], fh.Machine)
+	binary.LittleEndian.PutUint32(h[8:], fh.TimeDateStamp)
+	binary.LittleEndian.PutUint32(h[12:], bigObjClassID.Data1)
+	binary.LittleEndian.PutUint16(h[16:], bigObjClassID.Data2)
+	binary.LittleEndian.PutUint16(h[18:], bigObjClassID.Data3)
+	copy(h[20:28], bigObjClassID.Data4[:])
+	binary.LittleEndian.PutUint32(h[44:], uint32(fh.NumberOfSections))
+	binary.LittleEndian.PutUint32(h[48:], symtab)
+	binary.LittleEndian.PutUint32(h[52:], fh.NumberOfSymbols)
+	return out
+}
+
+func TestBigObj(t *testing.T) {
+	for _, name := range []string{"testdata/gcc-amd64-mingw-obj", "testdata/gcc-386-mingw-obj"} {
+		obj, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := NewFile(bytes.NewReader(obj))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want.IsBigObj() {
+			t.Errorf("%s: regular object reported as big object", name)
+		}
+		big := makeBigObj(obj)
+		f, err := NewFile(bytes.NewReader(big))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !f.IsBigObj() {
+			t.Fatalf("%s: big object not reported as such", name)
+		}
+		h := f.BigObjHeader
+		if h.Machine != want.Machine || h.NumberOfSections != uint32(want.NumberOfSections) || h.NumberOfSymbols != want.NumberOfSymbols {
+			t.Errorf("%s: big object header = %+v", name, h)
+		}
+		if f.Machine != want.Machine || f.NumberOfSections != want.NumberOfSections {
+			t.Errorf("%s: file header = %+v, want %+v", name, f.FileHeader, want.FileHeader)
+		}
+		if len(f.Sections) != len(want.Sections) {
+			t.Fatalf("%s: got %d sections, want %d", name, len(f.Sections), len(want.Sections))
+		}
+		for i, s := range f.Sections {
+			w := want.Sections[i]
+			if s.Name != w.Name || s.Size != w.Size || !reflect.DeepEqual(s.Relocs, w.Relocs) {
+				t.Errorf("%s: section %d = %+v, want %+v", name, i, s.SectionHeader, w.SectionHeader)
+			}
+			sd, _ := s.Data()
+			wd, _ := w.Data()
+			if !bytes.Equal(sd, wd) {
+				t.Errorf("%s: section %s has different contents", name, s.Name)
+			}
+		}
+		if !reflect.DeepEqual(f.Symbols, want.Symbols) {
+			t.Errorf("%s: symbols differ", name)
+		}
+		if !reflect.DeepEqual(f.COFFSymbols, want.COFFSymbols) {
+			t.Errorf("%s: COFF symbols differ", name)
+		}
+		if len(f.COFFBigSymbols) != len(want.COFFSymbols) {
+			t.Errorf("%s: got %d big symbols, want %d", name, len(f.COFFBigSymbols), len(want.COFFSymbols))
+		}
+		if l := f.HeaderLayout(); l.SectionTable.Offset != bigObjHeaderSize {
+			t.Errorf("%s: section table at %#x, want %#x", name, l.SectionTable.Offset, bigObjHeaderSize)
+		}
+	}
+}
+
+func TestBase64SectionName(t *testing.T) {
+	st := StringTable("\x00\x00\x00\x00a-long-section-name\x00")
+	sh := SectionHeader32{Name: [8]byte{'/', '/', 'A', 'A', 'A', 'A', 'A', 'I'}} // offset 8
+	name, err := sh.fullName(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "a-long-section-name" {
+		t.Errorf("got name %q, want %q", name, "a-long-section-name")
+	}
+}
+
+func TestManySections(t *testing.T) {
+	const n = 100000
+	f := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64}}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf(".text$f%d", i)
+		f.Sections = append(f.Sections, NewSection(SectionHeader{Name: name, Characteristics: IMAGE_SCN_CNT_CODE | IMAGE_SCN_LNK_COMDAT}, []byte{0xc3}))
+		sym := COFFBigSymbol{SectionNumber: int32(i + 1), StorageClass: IMAGE_SYM_CLASS_STATIC}
+		copy(sym.Name[:], ".text")
+		f.COFFBigSymbols = append(f.COFFBigSymbols, sym)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	for _, mode := range []ParseMode{ParseDefault, ParseStrict} {
+		g, err := NewFileWithOptions(bytes.NewReader(b), &Options{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !g.IsBigObj() || len(g.Sections) != n || g.Sections[n-1].Name != ".text$f99999" {
+			t.Fatalf("got %d sections, the last named %q", len(g.Sections), g.Sections[len(g.Sections)-1].Name)
+		}
+		if len(g.COFFBigSymbols) != n || g.COFFBigSymbols[n-1].SectionNumber != n {
+			t.Errorf("got %d symbols, the last in section %d", len(g.COFFBigSymbols), g.COFFBigSymbols[len(g.COFFBigSymbols)-1].SectionNumber)
+		}
+		if s := g.Symbols[40000]; g.SymbolSection(s) != g.Sections[40000] {
+			t.Errorf("symbol 40000 in section %d, want 40001", s.FullSectionNumber())
+		}
+		if mode == ParseDefault {
+			for _, fd := range g.Validate() {
+				if fd.Severity > SeverityInfo {
+					t.Errorf("Validate: %v", fd)
+				}
+			}
+		}
+	}
+
+	// A section table cut short in its second
+	// chunk keeps the sections before the cut.
+	const cut = sectionChunk + 500
+	sectab := bigObjHeaderSize
+	g, err := NewFileWithOptions(bytes.NewReader(b[:sectab+cut*40+20]), &Options{Recover: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Sections) != cut {
+		t.Errorf("got %d sections from a truncated section table, want %d", len(g.Sections), cut)
+	}
+	found := false
+	for _, err := range g.Errors {
+		if fe, ok := err.(*FormatError); ok && fe.What == "section header" {
+			found = true
+			if fe.Off != int64(sectab+cut*40) || fe.Err != ErrTruncated {
+				t.Errorf("got error %v, want a truncated section header at %#x", err, sectab+cut*40)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no section header error in %v", g.Errors)
+	}
+}
+
+func TestBigSectionNumbers(t *testing.T) {
+	// Symbols in these sections have 16-bit section
+	// numbers that are negative or special.
+	numbers := []int32{32768, 65534, 65535, 65536}
+	const n = 65536
+	f := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64}}
+	for i := 0; i < n; i++ {
+		f.Sections = append(f.Sections, NewSection(SectionHeader{Name: ".data", Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA}, []byte{0}))
+	}
+	for _, sn := range numbers {
+		sym := COFFBigSymbol{SectionNumber: sn, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}
+		copy(sym.Name[:], fmt.Sprintf("s%d", sn))
+		f.COFFBigSymbols = append(f.COFFBigSymbols, sym)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bsyms, err := g.BinarySymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Symbols) != len(numbers) {
+		t.Fatalf("got %d symbols, want %d", len(g.Symbols), len(numbers))
+	}
+	for i, s := range g.Symbols {
+		sn := numbers[i]
+		if s.FullSectionNumber() != sn {
+			t.Errorf("symbol %s: FullSectionNumber = %d, want %d", s.Name, s.FullSectionNumber(), sn)
+		}
+		if s.IsUndefined() || s.IsAbsolute() || s.IsDebug() {
+			t.Errorf("symbol %s in section %d is undefined, absolute or a debugging symbol", s.Name, sn)
+		}
+		if sec := g.SymbolSection(s); sec != g.Sections[sn-1] {
+			t.Errorf("symbol %s: SymbolSection = %p, want section %d", s.Name, sec, sn)
+		}
+		if _, err := g.SymbolAddress(s); err != nil {
+			t.Errorf("SymbolAddress(%s): %v", s.Name, err)
+		}
+		if bsyms[i].Section != int(sn)-1 {
+			t.Errorf("binary symbol %s in section %d, want %d", bsyms[i].Name, bsyms[i].Section, sn-1)
+		}
+	}
+
+	st, err := g.SymbolTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range st.Symbols {
+		if !reflect.DeepEqual(&st.Symbols[i], g.Symbols[i]) {
+			t.Errorf("SymbolTable symbol %d = %+v, want %+v", i, st.Symbols[i], *g.Symbols[i])
+		}
+	}
+	var got []string
+	g.FilterSymbols(&SymbolFilter{SectionNumbers: []int32{65535}, Defined: true})(func(s *Symbol, err error) bool {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s.Name)
+		return true
+	})
+	if len(got) != 1 || got[0] != "s65535" {
+		t.Errorf("FilterSymbols selected %q, want [s65535]", got)
+	}
+}
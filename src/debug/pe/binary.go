@@ -0,0 +1,110 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"debug/binary"
+	"fmt"
+)
+
+// File implements the format-independent view of debug/binary.
+var _ binary.File = (*File)(nil)
+
+// imageBase returns the preferred load address of f,
+// or 0 for object files.
+func (f *File) imageBase() uint64 {
+	if oh := f.optionalHeader(); oh != nil {
+		return oh.imageBase
+	}
+	return 0
+}
+
+// BinarySections returns the sections of f in the form of package
+// debug/binary. Addresses are virtual addresses: the image base
+// plus the section's relative virtual address.
+func (f *File) BinarySections() []binary.Section {
+	base := f.imageBase()
+	secs := make([]binary.Section, len(f.Sections))
+	for i, s := range f.Sections {
+		secs[i] = binary.Section{
+			Name:     s.Name,
+			Addr:     base + uint64(s.VirtualAddress),
+			Size:     uint64(s.virtualSize()),
+			FileSize: uint64(s.Size),
+		}
+		if s.Offset == 0 {
+			secs[i].FileSize = 0
+		}
+	}
+	return secs
+}
+
+// BinarySymbols returns the COFF symbols of f in the form of
+// package debug/binary. COFF does not record symbol sizes, so
+// they are left zero.
+func (f *File) BinarySymbols() ([]binary.Symbol, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return nil, err
+	}
+	base := f.imageBase()
+	syms := make([]binary.Symbol, len(f.Symbols))
+	for i, s := range f.Symbols {
+		syms[i] = binary.Symbol{Name: s.Name, Section: -1}
+		if addr, ok := f.symbolAddress(s, base); ok {
+			syms[i].Addr = addr
+		}
+		if f.SymbolSection(s) != nil {
+			syms[i].Section = int(s.FullSectionNumber()) - 1
+		}
+	}
+	return syms, nil
+}
+
+// SymbolSection returns the section that s, one of the symbols of f,
+// is defined in, or nil if s is undefined, absolute or a debugging
+// symbol, or if its section number is out of range.
+func (f *File) SymbolSection(s *Symbol) *Section {
+	n := s.FullSectionNumber()
+	if n <= 0 || int64(n) > int64(len(f.Sections)) {
+		return nil
+	}
+	return f.Sections[n-1]
+}
+
+// SymbolAddress returns the virtual address of s, one of the symbols
+// of f: the image base, plus the relative virtual address of its
+// section, plus its Value. In object files, which have neither, that
+// is the offset of s in its section. For absolute symbols it is their
+// Value. Undefined and debugging symbols have no address.
+func (f *File) SymbolAddress(s *Symbol) (uint64, error) {
+	addr, ok := f.symbolAddress(s, f.imageBase())
+	if !ok {
+		return 0, fmt.Errorf("pe: symbol %s has no address", s.Name)
+	}
+	return addr, nil
+}
+
+// symbolAddress is SymbolAddress for an image based at base.
+func (f *File) symbolAddress(s *Symbol, base uint64) (uint64, bool) {
+	if s.IsAbsolute() {
+		return uint64(s.Value), true
+	}
+	sec := f.SymbolSection(s)
+	if sec == nil {
+		return 0, false
+	}
+	return base + uint64(sec.VirtualAddress) + uint64(s.Value), true
+}
+
+// ReadAtAddr reads len(p) bytes of f starting at the virtual
+// address addr, as laid out in memory once the image is loaded;
+// see ReadRVA. It follows the contract of io.ReaderAt.
+func (f *File) ReadAtAddr(p []byte, addr uint64) (n int, err error) {
+	base := f.imageBase()
+	if addr < base || addr-base >= 1<<32 {
+		return 0, fmt.Errorf("pe: address %#x is outside the image", addr)
+	}
+	return f.readMapped(p, int64(addr-base))
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBinary(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	base := f.OptionalHeader.(*OptionalHeader64).ImageBase
+
+	secs := f.BinarySections()
+	if len(secs) != len(f.Sections) {
+		t.Fatalf("got %d sections, want %d", len(secs), len(f.Sections))
+	}
+	text := f.Section(".text")
+	if s := secs[0]; s.Name != ".text" || s.Addr != base+uint64(text.VirtualAddress) || s.Size != uint64(text.VirtualSize) || s.FileSize != uint64(text.Size) {
+		t.Errorf("section 0 = %+v", s)
+	}
+
+	syms, err := f.BinarySymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syms) != len(f.Symbols) {
+		t.Fatalf("got %d symbols, want %d", len(syms), len(f.Symbols))
+	}
+	var main *uint64
+	for i, s := range syms {
+		if s.Name == "main" {
+			if s.Section != 0 {
+				t.Errorf("main is in section %d, want 0", s.Section)
+			}
+			main = &syms[i].Addr
+		}
+	}
+	if main == nil {
+		t.Fatal("no main symbol")
+	}
+	data, err := text.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := *main - base - uint64(text.VirtualAddress)
+	p := make([]byte, 16)
+	if n, err := f.ReadAtAddr(p, *main); err != nil || n != len(p) {
+		t.Fatalf("ReadAtAddr(%#x) = %d, %v", *main, n, err)
+	}
+	if !bytes.Equal(p, data[off:off+16]) {
+		t.Errorf("ReadAtAddr(%#x) = %x, want %x", *main, p, data[off:off+16])
+	}
+	if _, err := f.ReadAtAddr(p, base-1); err == nil {
+		t.Errorf("ReadAtAddr below the image base succeeded")
+	}
+}
+
+func TestSymbolAddress(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	base := f.OptionalHeader.(*OptionalHeader64).ImageBase
+	text := f.Section(".text")
+
+	var kinds [4]int // section-relative, absolute, undefined, debug
+	for _, s := range f.Symbols {
+		addr, err := f.SymbolAddress(s)
+		switch {
+		case s.IsAbsolute():
+			kinds[1]++
+			if err != nil || addr != uint64(s.Value) {
+				t.Errorf("SymbolAddress(%s) = %#x, %v; want %#x", s.Name, addr, err, s.Value)
+			}
+		case s.IsUndefined(), s.IsDebug():
+			if s.IsUndefined() {
+				kinds[2]++
+			} else {
+				kinds[3]++
+			}
+			if err == nil || f.SymbolSection(s) != nil {
+				t.Errorf("symbol %s in section %d has an address or a section", s.Name, s.SectionNumber)
+			}
+		default:
+			kinds[0]++
+			sec := f.SymbolSection(s)
+			if sec == nil || err != nil || addr != base+uint64(sec.VirtualAddress)+uint64(s.Value) {
+				t.Errorf("symbol %s: section %v, address %#x, %v", s.Name, sec, addr, err)
+			}
+			if s.Name == "main" && sec != text {
+				t.Errorf("main is in section %s, want .text", sec.Name)
+			}
+		}
+	}
+	if kinds[0] == 0 || kinds[1] == 0 || kinds[3] == 0 {
+		t.Errorf("found %d section-relative, %d absolute, %d undefined and %d debugging symbols", kinds[0], kinds[1], kinds[2], kinds[3])
+	}
+}
+
+func TestReadVA(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oh := f.OptionalHeader.(*OptionalHeader64)
+
+	// Build the loaded image section by section.
+	want := make([]byte, oh.SizeOfImage)
+	if _, err := f.r.ReadAt(want[:oh.SizeOfHeaders], 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range f.Sections {
+		if _, err := s.VirtualReader().ReadAt(want[s.VirtualAddress:s.VirtualAddress+s.VirtualSize], 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Read across the end of .text, the gap after
+	// it and the start of the next section.
+	s0, s1 := f.Sections[0], f.Sections[1]
+	rva := s0.VirtualAddress + s0.VirtualSize - 8
+	n := int(s1.VirtualAddress-rva) + 8
+	for _, tt := range []struct {
+		rva uint32
+		n   int
+	}{{0, 64}, {rva, n}, {oh.SizeOfImage - 16, 16}} {
+		b, err := f.ReadRVA(tt.rva, tt.n)
+		if err != nil {
+			t.Fatalf("ReadRVA(%#x, %d): %v", tt.rva, tt.n, err)
+		}
+		if w := want[tt.rva : tt.rva+uint32(tt.n)]; !bytes.Equal(b, w) {
+			t.Errorf("ReadRVA(%#x, %d) = %x, want %x", tt.rva, tt.n, b, w)
+		}
+		if b, err := f.ReadVA(oh.ImageBase+uint64(tt.rva), tt.n); err != nil || !bytes.Equal(b, want[tt.rva:tt.rva+uint32(tt.n)]) {
+			t.Errorf("ReadVA(%#x, %d) = %x, %v", oh.ImageBase+uint64(tt.rva), tt.n, b, err)
+		}
+	}
+	if _, err := f.ReadRVA(oh.SizeOfImage-16, 17); err == nil {
+		t.Errorf("ReadRVA past SizeOfImage succeeded")
+	}
+
+	r := io.NewSectionReader(f.ReaderAtVA(), int64(oh.ImageBase), int64(oh.SizeOfImage))
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("reading the image through ReaderAtVA differs from reading each section")
+	}
+}
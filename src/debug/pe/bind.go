@@ -0,0 +1,183 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// CheckImportHints checks the functions f imports by name against
+// the export name tables of the DLLs in r.Files, which the loader
+// searches for them. The table of each DLL must be sorted, since
+// the loader looks names up by binary search, and must hold the
+// names imported from it. The hint of each import should be the
+// index of its name in the table, where the loader looks first; a
+// wrong hint only slows loading down. Imports from DLLs not in
+// r.Files are not checked. The findings are sorted as by Validate.
+func (f *File) CheckImportHints(r *ExportResolver) ([]Finding, error) {
+	imps, err := f.Imports()
+	if err != nil {
+		return nil, err
+	}
+	var v validator
+	tables := make(map[string]map[string]int)
+	for _, imp := range imps {
+		if imp.ByOrdinal {
+			continue
+		}
+		dll := r.module("", imp.DLL)
+		index, ok := tables[dll]
+		if !ok {
+			lib := r.Files[dll]
+			if lib == nil {
+				continue
+			}
+			names, err := lib.exportNameTable()
+			if err != nil {
+				return nil, err
+			}
+			index = make(map[string]int, len(names))
+			for i, name := range names {
+				if i > 0 && names[i-1] >= name {
+					v.add(SeverityError, -1, "export name table of "+dll, "names are not sorted", i)
+				}
+				index[name] = i
+			}
+			tables[dll] = index
+		}
+		what := "import " + dll + "!" + imp.Name
+		i, ok := index[imp.Name]
+		switch {
+		case !ok:
+			v.add(SeverityError, -1, what, "name is not exported", nil)
+		case i != int(imp.Hint):
+			v.add(SeverityInfo, -1, what, "hint is not the index of the name in the export name table, "+strconv.Itoa(i), imp.Hint)
+		}
+	}
+	return v.sorted(), nil
+}
+
+// WriteBound writes the image f to w with its imports bound to the
+// DLLs in r.Files, as the BIND tool does, for offline binding and
+// emulation. The import address table slot of each function holds
+// its address at the preferred image base of the DLL, and the import
+// descriptor holds the TimeDateStamp of the DLL and a ForwarderChain
+// of -1. Finding the DLL unchanged at that base, the loader keeps the
+// addresses; otherwise, it resolves the imports again.
+//
+// The imports of a descriptor are bound all together or not at all.
+// Descriptors are left as they are if their DLL is not in r.Files
+// or is not of the same format, PE32 or PE32+, as f, if one of their
+// functions is missing or forwarded to another DLL, or if they have
+// no import lookup table, without which binding would lose the names
+// of the functions. The bound import directory,
+// which no longer matches, is cleared, and the checksum is updated.
+// An attribute certificate table is removed, since the signature it
+// holds no longer applies.
+//
+// WriteBound fails if the size of the file is not known or if f was
+// created by NewFileFromImage.
+func (f *File) WriteBound(w io.Writer, r *ExportResolver) error {
+	b, err := f.unsignedImage("WriteBound")
+	if err != nil {
+		return err
+	}
+	oh := f.optionalHeader()
+	bySlot, err := f.ImportsBySlot()
+	if err != nil {
+		return err
+	}
+	thunkSize := uint32(4)
+	if oh.pe64 {
+		thunkSize = 8
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	for i := uint32(0); dd.VirtualAddress != 0; i++ {
+		if i == maxImportDescriptors {
+			return &FormatError{-1, "import directory", errors.New("too many descriptors"), i}
+		}
+		rva, err := addRVA(dd.VirtualAddress, 20*uint64(i))
+		if err != nil {
+			return err
+		}
+		var d [20]byte
+		if err := f.readRVA(d[:], rva); err != nil {
+			return err
+		}
+		if d == [20]byte{} {
+			break
+		}
+		oft := binary.LittleEndian.Uint32(d[0:4])
+		ft := binary.LittleEndian.Uint32(d[16:20])
+		if oft == 0 || ft == 0 {
+			continue
+		}
+		addrs, lib := f.bindDescriptor(r, bySlot, ft, thunkSize)
+		if lib == nil {
+			continue
+		}
+		off, err := f.fileOffset(ft, uint32(len(addrs))*thunkSize)
+		if err != nil {
+			return err
+		}
+		if off+int64(len(addrs))*int64(thunkSize) > int64(len(b)) {
+			return &FormatError{off, "import address table", ErrTruncated, nil}
+		}
+		for j, a := range addrs {
+			p := b[off+int64(j)*int64(thunkSize):]
+			if oh.pe64 {
+				binary.LittleEndian.PutUint64(p, a)
+			} else {
+				binary.LittleEndian.PutUint32(p, uint32(a))
+			}
+		}
+		if off, err = f.fileOffset(rva, 20); err != nil {
+			return err
+		}
+		if off+20 > int64(len(b)) {
+			return &FormatError{off, "import directory", ErrTruncated, nil}
+		}
+		binary.LittleEndian.PutUint32(b[off+4:], lib.TimeDateStamp)
+		binary.LittleEndian.PutUint32(b[off+8:], 0xffffffff)
+	}
+	if oh.numberOfRvaAndSizes > IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT && f.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT+1) <= int(f.base)+20+int(f.SizeOfOptionalHeader) {
+		f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT, DataDirectory{})
+	}
+	f.setChecksum(b)
+	_, err = w.Write(b)
+	return err
+}
+
+// bindDescriptor returns the addresses to bind the imports of the
+// descriptor whose import address table is at ft to, and the DLL
+// they are bound to, or a nil DLL if they cannot all be bound.
+func (f *File) bindDescriptor(r *ExportResolver, bySlot map[uint32]Import, ft, thunkSize uint32) ([]uint64, *File) {
+	var addrs []uint64
+	var lib *File
+	for slot := ft; ; slot += thunkSize {
+		imp, ok := bySlot[slot]
+		if !ok {
+			break
+		}
+		dll := r.module("", imp.DLL)
+		name := imp.Name
+		if imp.ByOrdinal {
+			name = "#" + strconv.Itoa(int(imp.Ordinal))
+		}
+		impl, e, err := r.Resolve(dll, name)
+		if err != nil || impl != dll {
+			return nil, nil
+		}
+		lib = r.Files[dll]
+		if loh := lib.optionalHeader(); loh == nil || loh.pe64 != f.optionalHeader().pe64 {
+			return nil, nil
+		}
+		addrs = append(addrs, lib.imageBase()+uint64(e.RVA))
+	}
+	return addrs, lib
+}
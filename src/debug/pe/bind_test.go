@@ -0,0 +1,208 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// bindTestDLLs returns DLLs exporting, in sorted order, the
+// functions imps imports by name, and the timestamps they carry.
+func bindTestDLLs(t *testing.T, imps []Import) (map[string]*File, map[string]uint32) {
+	names := make(map[string][]string)
+	for _, imp := range imps {
+		dll := strings.ToLower(imp.DLL)
+		names[dll] = append(names[dll], imp.Name)
+	}
+	files := make(map[string]*File)
+	stamps := make(map[string]uint32)
+	for dll, n := range names {
+		sort.Strings(n)
+		exports := make([]testExport, len(n))
+		for i := range n {
+			exports[i].name = n[i]
+		}
+		b := makeTestDLL(dll, 1, exports)
+		stamps[dll] = uint32(0x5a000000 + len(stamps))
+		binary.LittleEndian.PutUint32(b[0x48:], stamps[dll]) // FileHeader.TimeDateStamp
+		f, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[dll] = f
+	}
+	return files, stamps
+}
+
+func TestCheckImportHints(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	imps, err := f.Imports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := bindTestDLLs(t, imps)
+	r := &ExportResolver{Files: files}
+	findings, err := f.CheckImportHints(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range findings {
+		if fd.Severity != SeverityInfo {
+			t.Errorf("unexpected finding %v", fd)
+		}
+	}
+
+	// Drop the first import of the first DLL, and
+	// put the names of the other DLL out of order.
+	missing := imps[0]
+	var other string
+	for _, imp := range imps {
+		if !strings.EqualFold(imp.DLL, missing.DLL) {
+			other = strings.ToLower(imp.DLL)
+		}
+	}
+	if other == "" {
+		t.Fatal("test image imports from a single DLL")
+	}
+	var kept []testExport
+	for _, imp := range imps {
+		if strings.EqualFold(imp.DLL, missing.DLL) && imp.Name != missing.Name {
+			kept = append(kept, testExport{name: imp.Name})
+		}
+	}
+	r = &ExportResolver{Files: map[string]*File{
+		strings.ToLower(missing.DLL): openTestDLL(t, missing.DLL, kept),
+		other:                        openTestDLL(t, other, []testExport{{name: "Z"}, {name: "A"}}),
+	}}
+	findings, err = f.CheckImportHints(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unsorted, notExported bool
+	for _, fd := range findings {
+		if fd.Severity != SeverityError {
+			continue
+		}
+		switch fd.Err.What {
+		case "export name table of " + other:
+			unsorted = true
+		case "import " + strings.ToLower(missing.DLL) + "!" + missing.Name:
+			notExported = true
+		}
+	}
+	if !unsorted || !notExported {
+		t.Errorf("findings %v do not report the unsorted table of %s and the missing %s", findings, other, missing.Name)
+	}
+}
+
+func openTestDLL(t *testing.T, name string, exports []testExport) *File {
+	f, err := NewFile(bytes.NewReader(makeTestDLL(name, 1, exports)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWriteBound(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		orig, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		imps, err := f.Imports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, stamps := bindTestDLLs(t, imps)
+		// Leave the DLL of the first import out, so that its
+		// descriptor stays unbound. The PE32+ test DLLs cannot
+		// be bound to a PE32 image at all.
+		first := strings.ToLower(imps[0].DLL)
+		delete(files, first)
+		pe64 := f.optionalHeader().pe64
+		isUnbound := func(dll string) bool { return dll == first || !pe64 }
+		var buf bytes.Buffer
+		if err := f.WriteBound(&buf, &ExportResolver{Files: files}); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := g.Imports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(have, imps) {
+			t.Errorf("%s: Imports = %+v, want %+v", file, have, imps)
+		}
+		slot := func(f *File, rva uint32) uint64 {
+			var b [8]byte
+			if err := f.readRVA(b[:], rva); err != nil {
+				t.Fatal(err)
+			}
+			if f.optionalHeader().pe64 {
+				return binary.LittleEndian.Uint64(b[:])
+			}
+			return uint64(binary.LittleEndian.Uint32(b[:]))
+		}
+		for _, imp := range imps {
+			dll := strings.ToLower(imp.DLL)
+			have := slot(g, imp.Slot)
+			if isUnbound(dll) {
+				if want := slot(f, imp.Slot); have != want {
+					t.Errorf("%s: unbound slot %#x = %#x, want %#x", file, imp.Slot, have, want)
+				}
+				continue
+			}
+			_, e, err := (&ExportResolver{Files: files}).Resolve(dll, imp.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := files[dll].imageBase() + uint64(e.RVA); have != want {
+				t.Errorf("%s: slot %#x for %s!%s = %#x, want %#x", file, imp.Slot, dll, imp.Name, have, want)
+			}
+		}
+		desc := g.optionalHeader().dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT).VirtualAddress
+		for ; ; desc += 20 {
+			var d [20]byte
+			if err := g.readRVA(d[:], desc); err != nil {
+				t.Fatal(err)
+			}
+			if d == [20]byte{} {
+				break
+			}
+			name, err := g.readStringRVA(binary.LittleEndian.Uint32(d[12:]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			stamp, chain := binary.LittleEndian.Uint32(d[4:]), binary.LittleEndian.Uint32(d[8:])
+			if dll := strings.ToLower(name); isUnbound(dll) {
+				if stamp != 0 {
+					t.Errorf("%s: unbound descriptor of %s has TimeDateStamp %#x", file, name, stamp)
+				}
+			} else if stamp != stamps[dll] || chain != 0xffffffff {
+				t.Errorf("%s: descriptor of %s has TimeDateStamp %#x and ForwarderChain %#x, want %#x and 0xffffffff", file, name, stamp, chain, stamps[dll])
+			}
+		}
+		if have, want := headerChecksum(t, buf.Bytes()); have != want {
+			t.Errorf("%s: CheckSum = %#x, want %#x", file, have, want)
+		}
+	}
+}
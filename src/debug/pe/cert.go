@@ -0,0 +1,122 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Revisions and types of attribute certificates.
+const (
+	WIN_CERT_REVISION_1_0 = 0x0100
+	WIN_CERT_REVISION_2_0 = 0x0200
+
+	WIN_CERT_TYPE_X509             = 0x0001
+	WIN_CERT_TYPE_PKCS_SIGNED_DATA = 0x0002
+	WIN_CERT_TYPE_RESERVED_1       = 0x0003
+	WIN_CERT_TYPE_TS_STACK_SIGNED  = 0x0004
+)
+
+// A Certificate is an entry of the attribute certificate table of
+// an image (WIN_CERTIFICATE). Authenticode signatures are stored
+// as WIN_CERT_REVISION_2_0 entries of type
+// WIN_CERT_TYPE_PKCS_SIGNED_DATA holding a PKCS #7 SignedData.
+type Certificate struct {
+	Revision uint16
+	Type     uint16
+	Data     []byte
+}
+
+// certificateTable returns the file offset and size of
+// the attribute certificate table of f, or zeros if f
+// has none.
+func (f *File) certificateTable() (off, size uint32) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return 0, 0
+	}
+	// The table is not mapped into memory,
+	// so its VirtualAddress is a file offset.
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_SECURITY)
+	return dd.VirtualAddress, dd.Size
+}
+
+// Certificates returns the entries of the attribute certificate
+// table of f, or nil if f has none. It fails if f was created by
+// NewFileFromImage, since the table is not loaded into memory.
+func (f *File) Certificates() ([]Certificate, error) {
+	if f.imageLayout {
+		return nil, errors.New("pe: loaded images have no certificate table")
+	}
+	off, size := f.certificateTable()
+	if off == 0 {
+		return nil, nil
+	}
+	if f.size >= 0 && int64(off)+int64(size) > f.size {
+		return nil, &FormatError{int64(off), "certificate table", ErrOutOfBounds, size}
+	}
+	b := make([]byte, size)
+	if _, err := f.r.ReadAt(b, int64(off)); err != nil {
+		return nil, formatError(int64(off), "certificate table", err)
+	}
+	var certs []Certificate
+	for p := int64(0); p+8 <= int64(len(b)); {
+		n := int64(binary.LittleEndian.Uint32(b[p:]))
+		if n < 8 || n > int64(len(b))-p {
+			return nil, &FormatError{int64(off) + p, "attribute certificate", ErrOutOfBounds, n}
+		}
+		certs = append(certs, Certificate{
+			Revision: binary.LittleEndian.Uint16(b[p+4:]),
+			Type:     binary.LittleEndian.Uint16(b[p+6:]),
+			Data:     b[p+8 : p+n : p+n],
+		})
+		// Entries start on 8-byte boundaries.
+		p = alignUp(p+n, 8)
+	}
+	return certs, nil
+}
+
+// WriteCertificates writes the underlying file of f to w with its
+// attribute certificate table replaced by certs, as when attaching
+// an Authenticode signature made elsewhere. The table is appended to
+// the file, aligned to 8 bytes, and each entry is padded to 8 bytes.
+// An empty certs removes the table. The security data directory and
+// the checksum of the optional header are updated accordingly.
+//
+// An existing table must be at the end of the file, where signing
+// tools put it. WriteCertificates fails if the size of the file is
+// not known or if f was created by NewFileFromImage.
+func (f *File) WriteCertificates(w io.Writer, certs []Certificate) error {
+	b, err := f.unsignedImage("WriteCertificates")
+	if err != nil {
+		return err
+	}
+
+	var dd DataDirectory
+	if len(certs) > 0 {
+		b = append(b, make([]byte, alignUp(int64(len(b)), 8)-int64(len(b)))...)
+		start := len(b)
+		for _, c := range certs {
+			n := 8 + len(c.Data)
+			if uint64(len(b))+uint64(n) > 1<<32-1 {
+				return errors.New("pe: certificate table too large")
+			}
+			var hdr [8]byte
+			binary.LittleEndian.PutUint32(hdr[0:], uint32(n))
+			binary.LittleEndian.PutUint16(hdr[4:], c.Revision)
+			binary.LittleEndian.PutUint16(hdr[6:], c.Type)
+			b = append(b, hdr[:]...)
+			b = append(b, c.Data...)
+			b = append(b, make([]byte, alignUp(int64(n), 8)-int64(n))...)
+		}
+		dd = DataDirectory{VirtualAddress: uint32(start), Size: uint32(len(b) - start)}
+	}
+	f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_SECURITY, dd)
+	f.setChecksum(b)
+	_, err = w.Write(b)
+	return err
+}
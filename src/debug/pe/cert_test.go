@@ -0,0 +1,132 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// headerChecksum returns the CheckSum field of the image b
+// and the checksum computed from its contents.
+func headerChecksum(t *testing.T, b []byte) (have, want uint32) {
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off := int(f.base) + 20 + 64
+	return f.optionalHeader().checkSum, checksum(b, off)
+}
+
+func TestCertificates(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		orig, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The linker set the checksum of the test files.
+		if have, want := headerChecksum(t, orig); have != want {
+			t.Errorf("%s: CheckSum = %#x, computed %#x", file, have, want)
+		}
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs := []Certificate{
+			{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("signed data")},
+			{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("12345678")},
+		}
+		var buf bytes.Buffer
+		if err := f.WriteCertificates(&buf, certs); err != nil {
+			t.Fatal(err)
+		}
+		signed := append([]byte(nil), buf.Bytes()...)
+		g, err := NewFile(bytes.NewReader(signed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := g.Certificates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(have, certs) {
+			t.Errorf("%s: Certificates = %+v, want %+v", file, have, certs)
+		}
+		off, size := g.certificateTable()
+		if off%8 != 0 || size != 8+16+8+8 || int(off+size) != len(signed) {
+			t.Errorf("%s: certificate table at %#x, size %#x, in file of size %#x", file, off, size, len(signed))
+		}
+		if have, want := headerChecksum(t, signed); have != want {
+			t.Errorf("%s: CheckSum = %#x, want %#x", file, have, want)
+		}
+
+		// Replace the table, then remove it.
+		buf.Reset()
+		if err := g.WriteCertificates(&buf, certs[1:]); err != nil {
+			t.Fatal(err)
+		}
+		if g, err = NewFile(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		if have, _ := g.Certificates(); !reflect.DeepEqual(have, certs[1:]) {
+			t.Errorf("%s: Certificates after replacement = %+v, want %+v", file, have, certs[1:])
+		}
+		buf.Reset()
+		if err := g.WriteCertificates(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		unsigned := buf.Bytes()
+		if have, want := headerChecksum(t, unsigned); have != want {
+			t.Errorf("%s: CheckSum = %#x, want %#x", file, have, want)
+		}
+		// Only the checksum and the padding before
+		// the table remain of the signing.
+		ck := int(f.base) + 20 + 64
+		binary.LittleEndian.PutUint32(unsigned[ck:], f.optionalHeader().checkSum)
+		if !bytes.Equal(bytes.TrimRight(unsigned[len(orig):], "\x00"), nil) || !bytes.Equal(unsigned[:len(orig)], orig) {
+			t.Errorf("%s: unsigned file differs from the original", file)
+		}
+		if g, err = NewFile(bytes.NewReader(unsigned)); err != nil {
+			t.Fatal(err)
+		}
+		if have, err := g.Certificates(); have != nil || err != nil {
+			t.Errorf("%s: Certificates after removal = %+v, %v", file, have, err)
+		}
+
+		// A table followed by other data is not replaced.
+		signed = append(signed, "trailing"...)
+		if g, err = NewFile(bytes.NewReader(signed)); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.WriteCertificates(ioutil.Discard, nil); err == nil {
+			t.Errorf("%s: WriteCertificates replaced a table not at the end of the file", file)
+		}
+	}
+}
+
+func TestCertificatesBadLength(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if err := f.WriteCertificates(&buf, []Certificate{{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("x")}}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _ := g.certificateTable()
+	binary.LittleEndian.PutUint32(b[off:], 0x100)
+	if _, err := g.Certificates(); err == nil {
+		t.Error("Certificates accepted an entry longer than the table")
+	}
+}
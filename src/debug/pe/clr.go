@@ -0,0 +1,327 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// A CLRHeader is the CLR runtime header, IMAGE_COR20_HEADER, of a
+// .NET assembly, which locates its metadata and managed resources.
+type CLRHeader struct {
+	Cb                      uint32 // size of the header, 72
+	MajorRuntimeVersion     uint16
+	MinorRuntimeVersion     uint16
+	MetaData                DataDirectory
+	Flags                   uint32
+	EntryPointToken         uint32 // or the RVA of a native entry point
+	Resources               DataDirectory
+	StrongNameSignature     DataDirectory
+	CodeManagerTable        DataDirectory
+	VTableFixups            DataDirectory
+	ExportAddressTableJumps DataDirectory
+	ManagedNativeHeader     DataDirectory
+}
+
+// clrHeaderSize is the size of the CLR runtime header.
+const clrHeaderSize = 72
+
+// CLRHeader returns the CLR runtime header of f, found through
+// the IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR data directory, or nil
+// if f is not a .NET assembly.
+func (f *File) CLRHeader() (*CLRHeader, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR)
+	if dd.VirtualAddress == 0 {
+		return nil, nil
+	}
+	b := make([]byte, clrHeaderSize)
+	if err := f.readRVA(b, dd.VirtualAddress); err != nil {
+		return nil, err
+	}
+	h := new(CLRHeader)
+	if err := decodeLE(b, h, "CLR header"); err != nil {
+		return nil, err
+	}
+	if h.Cb < clrHeaderSize {
+		return nil, &FormatError{-1, "CLR header", errors.New("header too small"), h.Cb}
+	}
+	return h, nil
+}
+
+// The metadata tables used by this package, by number.
+const (
+	mdTableModuleRef        = 0x1a
+	mdTableAssemblyRef      = 0x23
+	mdTableFile             = 0x26
+	mdTableExportedType     = 0x27
+	mdTableManifestResource = 0x28
+)
+
+// An mdColumn is the kind of a column of a metadata table, which
+// determines its size: mdTable+t is an index into table t.
+type mdColumn uint8
+
+const (
+	mdU16 mdColumn = iota
+	mdU32
+	mdString
+	mdGUID
+	mdBlob
+	mdTypeDefOrRef // the coded indexes start here
+	mdHasConstant
+	mdHasCustomAttribute
+	mdHasFieldMarshal
+	mdHasDeclSecurity
+	mdMemberRefParent
+	mdHasSemantics
+	mdMethodDefOrRef
+	mdMemberForwarded
+	mdImplementation
+	mdCustomAttributeType
+	mdResolutionScope
+	mdTable
+)
+
+// mdCodedIndexes holds the tables that each kind of coded index,
+// from mdTypeDefOrRef on, refers to, by tag. -1 marks unused tags.
+var mdCodedIndexes = [...][]int{
+	mdTypeDefOrRef - mdTypeDefOrRef:        {0x02, 0x01, 0x1b},
+	mdHasConstant - mdTypeDefOrRef:         {0x04, 0x08, 0x17},
+	mdHasCustomAttribute - mdTypeDefOrRef:  {0x06, 0x04, 0x01, 0x02, 0x08, 0x09, 0x0a, 0x00, 0x0e, 0x17, 0x14, 0x11, 0x1a, 0x1b, 0x20, 0x23, 0x26, 0x27, 0x28, 0x2a, 0x2c, 0x2b},
+	mdHasFieldMarshal - mdTypeDefOrRef:     {0x04, 0x08},
+	mdHasDeclSecurity - mdTypeDefOrRef:     {0x02, 0x06, 0x20},
+	mdMemberRefParent - mdTypeDefOrRef:     {0x02, 0x01, 0x1a, 0x06, 0x1b},
+	mdHasSemantics - mdTypeDefOrRef:        {0x14, 0x17},
+	mdMethodDefOrRef - mdTypeDefOrRef:      {0x06, 0x0a},
+	mdMemberForwarded - mdTypeDefOrRef:     {0x04, 0x06},
+	mdImplementation - mdTypeDefOrRef:      {0x26, 0x23, 0x27},
+	mdCustomAttributeType - mdTypeDefOrRef: {-1, -1, 0x06, 0x0a, -1},
+	mdResolutionScope - mdTypeDefOrRef:     {0x00, 0x1a, 0x23, 0x01},
+}
+
+// mdSchemas holds the columns of the metadata tables up to
+// ManifestResource, by table number, as given by ECMA-335,
+// Partition II, section 22. Reading ManifestResource rows only
+// requires the sizes of the tables before it.
+var mdSchemas = [...][]mdColumn{
+	0x00: {mdU16, mdString, mdGUID, mdGUID, mdGUID},                                   // Module
+	0x01: {mdResolutionScope, mdString, mdString},                                     // TypeRef
+	0x02: {mdU32, mdString, mdString, mdTypeDefOrRef, mdTable + 0x04, mdTable + 0x06}, // TypeDef
+	0x03: {mdTable + 0x04},                                                            // FieldPtr
+	0x04: {mdU16, mdString, mdBlob},                                                   // Field
+	0x05: {mdTable + 0x06},                                                            // MethodPtr
+	0x06: {mdU32, mdU16, mdU16, mdString, mdBlob, mdTable + 0x08},                     // MethodDef
+	0x07: {mdTable + 0x08},                                                            // ParamPtr
+	0x08: {mdU16, mdU16, mdString},                                                    // Param
+	0x09: {mdTable + 0x02, mdTypeDefOrRef},                                            // InterfaceImpl
+	0x0a: {mdMemberRefParent, mdString, mdBlob},                                       // MemberRef
+	0x0b: {mdU16, mdHasConstant, mdBlob},                                              // Constant
+	0x0c: {mdHasCustomAttribute, mdCustomAttributeType, mdBlob},                       // CustomAttribute
+	0x0d: {mdHasFieldMarshal, mdBlob},                                                 // FieldMarshal
+	0x0e: {mdU16, mdHasDeclSecurity, mdBlob},                                          // DeclSecurity
+	0x0f: {mdU16, mdU32, mdTable + 0x02},                                              // ClassLayout
+	0x10: {mdU32, mdTable + 0x04},                                                     // FieldLayout
+	0x11: {mdBlob},                                                                    // StandAloneSig
+	0x12: {mdTable + 0x02, mdTable + 0x14},                                            // EventMap
+	0x13: {mdTable + 0x14},                                                            // EventPtr
+	0x14: {mdU16, mdString, mdTypeDefOrRef},                                           // Event
+	0x15: {mdTable + 0x02, mdTable + 0x17},                                            // PropertyMap
+	0x16: {mdTable + 0x17},                                                            // PropertyPtr
+	0x17: {mdU16, mdString, mdBlob},                                                   // Property
+	0x18: {mdU16, mdTable + 0x06, mdHasSemantics},                                     // MethodSemantics
+	0x19: {mdTable + 0x02, mdMethodDefOrRef, mdMethodDefOrRef},                        // MethodImpl
+	0x1a: {mdString},                                                                  // ModuleRef
+	0x1b: {mdBlob},                                                                    // TypeSpec
+	0x1c: {mdU16, mdMemberForwarded, mdString, mdTable + 0x1a},                        // ImplMap
+	0x1d: {mdU32, mdTable + 0x04},                                                     // FieldRVA
+	0x1e: {mdU32, mdU32},                                                              // EncLog
+	0x1f: {mdU32},                                                                     // EncMap
+	0x20: {mdU32, mdU16, mdU16, mdU16, mdU16, mdU32, mdBlob, mdString, mdString},      // Assembly
+	0x21: {mdU32},                                                                     // AssemblyProcessor
+	0x22: {mdU32, mdU32, mdU32},                                                       // AssemblyOS
+	0x23: {mdU16, mdU16, mdU16, mdU16, mdU32, mdBlob, mdString, mdString, mdBlob},     // AssemblyRef
+	0x24: {mdU32, mdTable + 0x23},                                                     // AssemblyRefProcessor
+	0x25: {mdU32, mdU32, mdU32, mdTable + 0x23},                                       // AssemblyRefOS
+	0x26: {mdU32, mdString, mdBlob},                                                   // File
+	0x27: {mdU32, mdU32, mdString, mdString, mdImplementation},                        // ExportedType
+	0x28: {mdU32, mdU32, mdString, mdImplementation},                                  // ManifestResource
+}
+
+// Bits of the HeapSizes field of the metadata tables stream.
+const (
+	mdBigStrings = 0x01
+	mdBigGUIDs   = 0x02
+	mdBigBlobs   = 0x04
+	mdExtraData  = 0x40 // four bytes follow the row counts
+)
+
+// clrMetadata is the metadata of a .NET assembly, as far as
+// this package reads it: the tables and the string heap.
+type clrMetadata struct {
+	tables    []byte // the #~ or #- stream
+	strings   []byte // the #Strings heap
+	heapSizes uint8
+	rows      [64]uint32
+	start     int // offset of the first table in tables
+}
+
+// clrMetadata reads the metadata of f, located by h.
+func (f *File) clrMetadata(h *CLRHeader) (*clrMetadata, error) {
+	b, err := f.ReadRVA(h.MetaData.VirtualAddress, int(h.MetaData.Size))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 16 || binary.LittleEndian.Uint32(b) != 0x424a5342 { // "BSJB"
+		return nil, &FormatError{-1, "CLR metadata", errors.New("bad signature"), nil}
+	}
+	p := 16 + uint64(binary.LittleEndian.Uint32(b[12:])) // past the version string
+	if p+4 > uint64(len(b)) {
+		return nil, &FormatError{-1, "CLR metadata", ErrTruncated, nil}
+	}
+	nstreams := int(binary.LittleEndian.Uint16(b[p+2:]))
+	p += 4
+	m := new(clrMetadata)
+	for i := 0; i < nstreams; i++ {
+		if p+8 > uint64(len(b)) {
+			return nil, &FormatError{-1, "CLR metadata stream header", ErrTruncated, i}
+		}
+		off := uint64(binary.LittleEndian.Uint32(b[p:]))
+		size := uint64(binary.LittleEndian.Uint32(b[p+4:]))
+		name := cstring(b[p+8:])
+		p += 8 + uint64(alignUp(int64(len(name))+1, 4))
+		if off+size > uint64(len(b)) {
+			return nil, &FormatError{-1, "CLR metadata stream " + name, ErrOutOfBounds, off + size}
+		}
+		switch name {
+		case "#~", "#-":
+			m.tables = b[off : off+size]
+		case "#Strings":
+			m.strings = b[off : off+size]
+		}
+	}
+	if m.tables == nil {
+		return nil, &FormatError{-1, "CLR metadata", errors.New("no tables stream"), nil}
+	}
+	t := m.tables
+	if len(t) < 24 {
+		return nil, &FormatError{-1, "CLR metadata tables", ErrTruncated, len(t)}
+	}
+	m.heapSizes = t[6]
+	valid := binary.LittleEndian.Uint64(t[8:])
+	p = 24
+	for i := range m.rows {
+		if valid&(1<<uint(i)) == 0 {
+			continue
+		}
+		if p+4 > uint64(len(t)) {
+			return nil, &FormatError{-1, "CLR metadata tables", ErrTruncated, len(t)}
+		}
+		m.rows[i] = binary.LittleEndian.Uint32(t[p:])
+		p += 4
+	}
+	if m.heapSizes&mdExtraData != 0 {
+		p += 4
+	}
+	m.start = int(p)
+	return m, nil
+}
+
+// columnSize returns the size in bytes of a column of kind c.
+func (m *clrMetadata) columnSize(c mdColumn) int {
+	switch {
+	case c == mdU16:
+		return 2
+	case c == mdU32:
+		return 4
+	case c == mdString:
+		return m.heapIndexSize(mdBigStrings)
+	case c == mdGUID:
+		return m.heapIndexSize(mdBigGUIDs)
+	case c == mdBlob:
+		return m.heapIndexSize(mdBigBlobs)
+	case c >= mdTable:
+		if m.rows[c-mdTable] >= 1<<16 {
+			return 4
+		}
+		return 2
+	}
+	tables := mdCodedIndexes[c-mdTypeDefOrRef]
+	bits := uint(0)
+	for 1<<bits < len(tables) {
+		bits++
+	}
+	for _, t := range tables {
+		if t >= 0 && m.rows[t] >= 1<<(16-bits) {
+			return 4
+		}
+	}
+	return 2
+}
+
+func (m *clrMetadata) heapIndexSize(big uint8) int {
+	if m.heapSizes&big != 0 {
+		return 4
+	}
+	return 2
+}
+
+// rowSize returns the size in bytes of a row of table t.
+func (m *clrMetadata) rowSize(t int) int {
+	n := 0
+	for _, c := range mdSchemas[t] {
+		n += m.columnSize(c)
+	}
+	return n
+}
+
+// table returns the rows of table t, each the values of its
+// columns. Tables after ManifestResource cannot be read.
+func (m *clrMetadata) table(t int) ([][]uint32, error) {
+	off := uint64(m.start)
+	for i := 0; i < t; i++ {
+		off += uint64(m.rows[i]) * uint64(m.rowSize(i))
+	}
+	size := uint64(m.rowSize(t))
+	if off+uint64(m.rows[t])*size > uint64(len(m.tables)) {
+		return nil, &FormatError{-1, "CLR metadata table", ErrOutOfBounds, t}
+	}
+	rows := make([][]uint32, m.rows[t])
+	for i := range rows {
+		b := m.tables[off+uint64(i)*size:]
+		row := make([]uint32, len(mdSchemas[t]))
+		for j, c := range mdSchemas[t] {
+			if m.columnSize(c) == 4 {
+				row[j] = binary.LittleEndian.Uint32(b)
+				b = b[4:]
+			} else {
+				row[j] = uint32(binary.LittleEndian.Uint16(b))
+				b = b[2:]
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// string returns the string at offset off of the #Strings heap.
+func (m *clrMetadata) string(off uint32) (string, error) {
+	if uint64(off) >= uint64(len(m.strings)) {
+		if off == 0 {
+			return "", nil
+		}
+		return "", &FormatError{-1, "CLR metadata string", ErrOutOfBounds, off}
+	}
+	b := m.strings[off:]
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// A testResourceItem is an item of a resource set built by
+// makeResourceSet: its name, type code and encoded value.
+type testResourceItem struct {
+	name string
+	code byte
+	data []byte
+}
+
+// makeResourceSet returns a version 2 .resources file
+// holding items, whose user types are listed in types.
+func makeResourceSet(types []string, items []testResourceItem) []byte {
+	var b bytes.Buffer
+	le := func(v uint32) { binary.Write(&b, binary.LittleEndian, v) }
+	str := func(w *bytes.Buffer, s string) {
+		w.WriteByte(byte(len(s)))
+		w.WriteString(s)
+	}
+	var hdr bytes.Buffer
+	str(&hdr, "System.Resources.ResourceReader, mscorlib")
+	str(&hdr, "System.Resources.RuntimeResourceSet")
+	le(resourceSetMagic)
+	le(1)
+	le(uint32(hdr.Len()))
+	b.Write(hdr.Bytes())
+	le(2)
+	le(uint32(len(items)))
+	le(uint32(len(types)))
+	for _, t := range types {
+		str(&b, t)
+	}
+	for i := 0; b.Len()%8 != 0; i++ {
+		b.WriteByte("PAD"[i%3])
+	}
+	var names, data bytes.Buffer
+	var pos []uint32
+	for _, item := range items {
+		pos = append(pos, uint32(names.Len()))
+		u := utf16.Encode([]rune(item.name))
+		names.WriteByte(byte(2 * len(u)))
+		binary.Write(&names, binary.LittleEndian, u)
+		binary.Write(&names, binary.LittleEndian, uint32(data.Len()))
+		data.WriteByte(item.code)
+		data.Write(item.data)
+	}
+	for range items {
+		le(0) // name hash, unchecked
+	}
+	for _, p := range pos {
+		le(p)
+	}
+	le(uint32(b.Len() + 4 + names.Len()))
+	b.Write(names.Bytes())
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+// makeTestAssembly returns a .NET assembly with an embedded resource
+// App.Strings.resources holding rsrc and a resource Shared.resources
+// held by the assembly Lib.
+func makeTestAssembly(rsrc []byte) []byte {
+	const (
+		metadataOff  = 0x100
+		resourcesOff = 0x400
+	)
+	d := make([]byte, resourcesOff)
+	put16 := func(b []byte, v uint16) []byte {
+		return append(b, byte(v), byte(v>>8))
+	}
+	put32 := func(b []byte, v uint32) []byte {
+		return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+
+	strs := []byte("\x00App.dll\x00App.Strings.resources\x00Shared.resources\x00Lib\x00")
+	var tables []byte
+	tables = put32(tables, 0)
+	tables = append(tables, 2, 0, 0, 1)
+	tables = put32(tables, 1) // Valid: Module, AssemblyRef, ManifestResource
+	tables = put32(tables, 1<<(mdTableAssemblyRef-32)|1<<(mdTableManifestResource-32))
+	tables = append(tables, make([]byte, 8)...)  // Sorted
+	tables = put32(tables, 1)                    // Module rows
+	tables = put32(tables, 1)                    // AssemblyRef rows
+	tables = put32(tables, 2)                    // ManifestResource rows
+	tables = put16(tables, 0)                    // Module: Generation
+	tables = put16(tables, 1)                    // Name
+	tables = append(tables, make([]byte, 6)...)  // Mvid, EncId, EncBaseId
+	tables = append(tables, make([]byte, 14)...) // AssemblyRef: Version, Flags, PublicKeyOrToken
+	tables = put16(tables, 48)                   // Name
+	tables = append(tables, make([]byte, 4)...)  // Culture, HashValue
+	tables = put32(tables, 0)                    // ManifestResource: Offset
+	tables = put32(tables, mrPublic)             // Flags
+	tables = put16(tables, 9)                    // Name
+	tables = put16(tables, 0)                    // Implementation: embedded
+	tables = put32(tables, 0)
+	tables = put32(tables, 2)      // private
+	tables = put16(tables, 31)     // Name
+	tables = put16(tables, 1<<2|1) // Implementation: AssemblyRef 1
+
+	md := []byte("BSJB\x01\x00\x01\x00\x00\x00\x00\x00")
+	md = put32(md, 12)
+	md = append(md, "v4.0.30319\x00\x00"...)
+	md = put16(md, 0)
+	md = put16(md, 2)
+	hdrSize := len(md) + 12 + 20
+	md = put32(md, uint32(hdrSize))
+	md = put32(md, uint32(len(tables)))
+	md = append(md, "#~\x00\x00"...)
+	md = put32(md, uint32(hdrSize+len(tables)))
+	md = put32(md, uint32(len(strs)))
+	md = append(md, "#Strings\x00\x00\x00\x00"...)
+	md = append(md, tables...)
+	md = append(md, strs...)
+	copy(d[metadataOff:], md)
+
+	res := put32(nil, uint32(len(rsrc)))
+	res = append(res, rsrc...)
+	d = append(d, res...)
+
+	hdr := CLRHeader{
+		Cb:                  clrHeaderSize,
+		MajorRuntimeVersion: 2,
+		MinorRuntimeVersion: 5,
+		MetaData:            DataDirectory{testSectionRVA + metadataOff, uint32(len(md))},
+		Resources:           DataDirectory{testSectionRVA + resourcesOff, uint32(len(res))},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &hdr)
+	copy(d, b.Bytes())
+	return makeTestImage(d, map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR: {testSectionRVA, clrHeaderSize},
+	})
+}
+
+func TestManagedResources(t *testing.T) {
+	items := []testResourceItem{
+		{"Greeting", 0x01, []byte("\x05hello")},
+		{"Logo", 0x20, []byte("\x02\x00\x00\x00\x89P")},
+		{"Count", 0x08, []byte("\x2a\x00\x00\x00")},
+		{"Custom", 0x40, []byte("serialized")},
+		{"Nothing", 0x00, nil},
+	}
+	rsrc := makeResourceSet([]string{"My.Type, MyAssembly"}, items)
+	f, err := NewFile(bytes.NewReader(makeTestAssembly(rsrc)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := f.CLRHeader()
+	if err != nil || h == nil || h.MajorRuntimeVersion != 2 {
+		t.Fatalf("CLRHeader() = %+v, %v", h, err)
+	}
+	res, err := f.ManagedResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ManagedResource{
+		{Name: "App.Strings.resources", Public: true, Data: rsrc},
+		{Name: "Shared.resources", Assembly: "Lib"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("ManagedResources() = %+v, want %+v", res, want)
+	}
+
+	set, err := ParseResourceSet(res[0].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSet := &ResourceSet{
+		ReaderType: "System.Resources.ResourceReader, mscorlib",
+		Version:    2,
+		Items: []ResourceSetItem{
+			{"Greeting", "System.String", []byte("hello")},
+			{"Logo", "System.Byte[]", []byte("\x89P")},
+			{"Count", "System.Int32", []byte("\x2a\x00\x00\x00")},
+			{"Custom", "My.Type, MyAssembly", []byte("serialized")},
+			{"Nothing", "", []byte{}},
+		},
+	}
+	if !reflect.DeepEqual(set, wantSet) {
+		t.Errorf("ParseResourceSet() = %+v, want %+v", set, wantSet)
+	}
+	for n := 0; n < len(rsrc); n++ {
+		if _, err := ParseResourceSet(rsrc[:n]); err == nil {
+			t.Errorf("parsing %d of %d bytes succeeded", n, len(rsrc))
+			break
+		}
+	}
+
+	c, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if res, err := c.ManagedResources(); res != nil || err != nil {
+		t.Errorf("C program: ManagedResources() = %v, %v", res, err)
+	}
+}
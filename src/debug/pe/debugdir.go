@@ -0,0 +1,215 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Types of debug directory entries. See DebugDirectory.
+const (
+	IMAGE_DEBUG_TYPE_UNKNOWN               = 0
+	IMAGE_DEBUG_TYPE_COFF                  = 1
+	IMAGE_DEBUG_TYPE_CODEVIEW              = 2
+	IMAGE_DEBUG_TYPE_FPO                   = 3
+	IMAGE_DEBUG_TYPE_MISC                  = 4
+	IMAGE_DEBUG_TYPE_EXCEPTION             = 5
+	IMAGE_DEBUG_TYPE_FIXUP                 = 6
+	IMAGE_DEBUG_TYPE_OMAP_TO_SRC           = 7
+	IMAGE_DEBUG_TYPE_OMAP_FROM_SRC         = 8
+	IMAGE_DEBUG_TYPE_BORLAND               = 9
+	IMAGE_DEBUG_TYPE_CLSID                 = 11
+	IMAGE_DEBUG_TYPE_VC_FEATURE            = 12
+	IMAGE_DEBUG_TYPE_POGO                  = 13
+	IMAGE_DEBUG_TYPE_ILTCG                 = 14
+	IMAGE_DEBUG_TYPE_MPX                   = 15
+	IMAGE_DEBUG_TYPE_REPRO                 = 16
+	IMAGE_DEBUG_TYPE_SPGO                  = 18
+	IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS = 20
+)
+
+// Extended DLL characteristics, from the debug directory entry of
+// type IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS. See DllCharacteristicsEx.
+const (
+	IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT                                 = 0x01
+	IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT_STRICT_MODE                     = 0x02
+	IMAGE_DLLCHARACTERISTICS_EX_CET_SET_CONTEXT_IP_VALIDATION_RELAXED_MODE = 0x04
+	IMAGE_DLLCHARACTERISTICS_EX_CET_DYNAMIC_APIS_ALLOW_IN_PROC             = 0x08
+	IMAGE_DLLCHARACTERISTICS_EX_FORWARD_CFI_COMPAT                         = 0x40
+	IMAGE_DLLCHARACTERISTICS_EX_HOTPATCH_COMPATIBLE                        = 0x80
+)
+
+// A DebugDirectory is an entry of the debug directory of an image
+// (IMAGE_DEBUG_DIRECTORY), which locates debugging or tooling data
+// of the given Type.
+type DebugDirectory struct {
+	Characteristics  uint32
+	TimeDateStamp    uint32
+	MajorVersion     uint16
+	MinorVersion     uint16
+	Type             uint32 // IMAGE_DEBUG_TYPE_* value
+	SizeOfData       uint32
+	AddressOfRawData uint32 // RVA of the data, or 0 if not mapped
+	PointerToRawData uint32 // file offset of the data
+}
+
+// debugDirectorySize is the size of a DebugDirectory in the file.
+const debugDirectorySize = 28
+
+// DebugDirectories returns the entries of the debug directory
+// of f, or nil if f has none.
+func (f *File) DebugDirectories() ([]DebugDirectory, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_DEBUG)
+	if dd.VirtualAddress == 0 || dd.Size < debugDirectorySize {
+		return nil, nil
+	}
+	if uint64(dd.VirtualAddress)+uint64(dd.Size) > uint64(oh.sizeOfImage) {
+		return nil, &FormatError{-1, "debug directory", ErrOutOfBounds, dd.Size}
+	}
+	b := make([]byte, dd.Size/debugDirectorySize*debugDirectorySize)
+	if err := f.readRVA(b, dd.VirtualAddress); err != nil {
+		return nil, err
+	}
+	dirs := make([]DebugDirectory, len(b)/debugDirectorySize)
+	for i := range dirs {
+		if err := decodeLE(b[i*debugDirectorySize:(i+1)*debugDirectorySize], &dirs[i], "debug directory entry"); err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// DebugData returns the data that the debug directory entry d
+// points to. Data mapped into memory is read at AddressOfRawData;
+// other data, such as COFF symbols, is read from the file at
+// PointerToRawData, which fails for loaded images.
+func (f *File) DebugData(d *DebugDirectory) ([]byte, error) {
+	what := fmt.Sprintf("debug data of type %d", d.Type)
+	if d.AddressOfRawData != 0 {
+		if oh := f.optionalHeader(); oh != nil && uint64(d.AddressOfRawData)+uint64(d.SizeOfData) > uint64(oh.sizeOfImage) {
+			return nil, &FormatError{-1, what, ErrOutOfBounds, d.SizeOfData}
+		}
+		b := make([]byte, d.SizeOfData)
+		if err := f.readRVA(b, d.AddressOfRawData); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if d.PointerToRawData == 0 {
+		return nil, nil
+	}
+	if f.imageLayout {
+		return nil, errors.New("pe: loaded images have no unmapped debug data")
+	}
+	off := int64(d.PointerToRawData)
+	if f.size >= 0 && off+int64(d.SizeOfData) > f.size {
+		return nil, &FormatError{off, what, ErrOutOfBounds, d.SizeOfData}
+	}
+	b := make([]byte, d.SizeOfData)
+	if _, err := f.r.ReadAt(b, off); err != nil {
+		return nil, formatError(off, what, err)
+	}
+	return b, nil
+}
+
+// debugData returns the data of the first debug
+// directory entry of f of type typ, or nil if none.
+func (f *File) debugData(typ uint32) ([]byte, error) {
+	dirs, err := f.DebugDirectories()
+	if err != nil {
+		return nil, err
+	}
+	for i := range dirs {
+		if dirs[i].Type == typ {
+			return f.DebugData(&dirs[i])
+		}
+	}
+	return nil, nil
+}
+
+// DllCharacteristicsEx returns the extended DLL characteristics of
+// f, IMAGE_DLLCHARACTERISTICS_EX_* flags that opt it into mitigations
+// such as CET shadow stacks, or 0 if f has none.
+func (f *File) DllCharacteristicsEx() (uint32, error) {
+	b, err := f.debugData(IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS)
+	if b == nil || err != nil {
+		return 0, err
+	}
+	if len(b) < 4 {
+		return 0, &FormatError{-1, "extended DLL characteristics", ErrTruncated, len(b)}
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// A PGOInfo is the profile-guided optimization data of an image,
+// from a debug directory entry of type IMAGE_DEBUG_TYPE_POGO or
+// IMAGE_DEBUG_TYPE_SPGO: the ranges of the image the linker laid
+// out, named after the sections they came from.
+type PGOInfo struct {
+	Signature uint32 // such as "PGU\0" or "LTCG", little-endian
+	Entries   []PGOEntry
+}
+
+// A PGOEntry is a range of an image described by a PGOInfo.
+type PGOEntry struct {
+	RVA  uint32
+	Size uint32
+	Name string // such as .text$mn
+}
+
+// POGOInfo returns the data of the IMAGE_DEBUG_TYPE_POGO debug
+// directory entry of f, written by linkers for profile-guided and
+// link-time code generation builds, or nil if f has none.
+func (f *File) POGOInfo() (*PGOInfo, error) {
+	return f.pgoInfo(IMAGE_DEBUG_TYPE_POGO, "POGO debug data")
+}
+
+// SPGOInfo returns the data of the IMAGE_DEBUG_TYPE_SPGO debug
+// directory entry of f, written for sample profile-guided
+// optimization, or nil if f has none. It has the layout of
+// the POGO data.
+func (f *File) SPGOInfo() (*PGOInfo, error) {
+	return f.pgoInfo(IMAGE_DEBUG_TYPE_SPGO, "SPGO debug data")
+}
+
+// pgoInfo parses the data of the first debug directory entry
+// of type typ as a PGOInfo. what names it in errors.
+func (f *File) pgoInfo(typ uint32, what string) (*PGOInfo, error) {
+	b, err := f.debugData(typ)
+	if b == nil || err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, &FormatError{-1, what, ErrTruncated, len(b)}
+	}
+	info := &PGOInfo{Signature: binary.LittleEndian.Uint32(b)}
+	// Each entry is an RVA and a size followed by a
+	// NUL-terminated name, padded to 4 bytes.
+	for p := 4; p < len(b); {
+		if len(b)-p < 9 {
+			return nil, &FormatError{-1, what, ErrTruncated, p}
+		}
+		e := PGOEntry{
+			RVA:  binary.LittleEndian.Uint32(b[p:]),
+			Size: binary.LittleEndian.Uint32(b[p+4:]),
+		}
+		name := b[p+8:]
+		n := bytes.IndexByte(name, 0)
+		if n < 0 {
+			return nil, &FormatError{-1, what, errors.New("unterminated name"), p}
+		}
+		e.Name = string(name[:n])
+		info.Entries = append(info.Entries, e)
+		p += int(alignUp(int64(8+n+1), 4))
+	}
+	return info, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestDebugDirectories(t *testing.T) {
+	const dataOff = 0x100
+	pgo := []byte("PGU\x00" +
+		"\x00\x10\x00\x00\x20\x00\x00\x00.text$mn\x00\x00\x00\x00" +
+		"\x20\x10\x00\x00\x08\x00\x00\x00.rdata\x00\x00")
+	dirs := []DebugDirectory{
+		{Type: IMAGE_DEBUG_TYPE_EX_DLLCHARACTERISTICS, SizeOfData: 4, AddressOfRawData: testSectionRVA + dataOff},
+		{Type: IMAGE_DEBUG_TYPE_SPGO, SizeOfData: uint32(len(pgo)), AddressOfRawData: testSectionRVA + dataOff + 4},
+		{Type: IMAGE_DEBUG_TYPE_COFF, SizeOfData: 2, PointerToRawData: 0},
+		{Type: IMAGE_DEBUG_TYPE_MISC, SizeOfData: 2, PointerToRawData: 0x40},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, dirs)
+	d := make([]byte, dataOff)
+	copy(d, b.Bytes())
+	d = append(d, 0x41, 0, 0, 0) // CET_COMPAT | FORWARD_CFI_COMPAT
+	d = append(d, pgo...)
+	f, err := NewFile(bytes.NewReader(makeTestImage(d, map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_DEBUG: {testSectionRVA, uint32(b.Len())},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.DebugDirectories()
+	if err != nil || !reflect.DeepEqual(got, dirs) {
+		t.Fatalf("DebugDirectories() = %+v, %v, want %+v", got, err, dirs)
+	}
+	if data, err := f.DebugData(&got[2]); data != nil || err != nil {
+		t.Errorf("DebugData(%+v) = %q, %v, want nil", got[2], data, err)
+	}
+	if data, err := f.DebugData(&got[3]); err != nil || len(data) != 2 {
+		t.Errorf("DebugData(%+v) = %q, %v, want 2 bytes from the file", got[3], data, err)
+	}
+	ex, err := f.DllCharacteristicsEx()
+	if want := uint32(IMAGE_DLLCHARACTERISTICS_EX_CET_COMPAT | IMAGE_DLLCHARACTERISTICS_EX_FORWARD_CFI_COMPAT); ex != want || err != nil {
+		t.Errorf("DllCharacteristicsEx() = %#x, %v, want %#x", ex, err, want)
+	}
+	spgo, err := f.SPGOInfo()
+	want := &PGOInfo{
+		Signature: 0x00554750,
+		Entries: []PGOEntry{
+			{0x1000, 0x20, ".text$mn"},
+			{0x1020, 0x08, ".rdata"},
+		},
+	}
+	if err != nil || !reflect.DeepEqual(spgo, want) {
+		t.Errorf("SPGOInfo() = %+v, %v, want %+v", spgo, err, want)
+	}
+	if pogo, err := f.POGOInfo(); pogo != nil || err != nil {
+		t.Errorf("POGOInfo() = %+v, %v, want nil", pogo, err)
+	}
+
+	// A name running to the end of the data is an error.
+	copy(d[dataOff+4+len(pgo)-2:], "ab")
+	f, err = NewFile(bytes.NewReader(makeTestImage(d, map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_DEBUG: {testSectionRVA, uint32(b.Len())},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.SPGOInfo(); err == nil {
+		t.Error("SPGOInfo succeeded with an unterminated name")
+	}
+
+	c, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ex, err := c.DllCharacteristicsEx(); ex != 0 || err != nil {
+		t.Errorf("mingw: DllCharacteristicsEx() = %#x, %v", ex, err)
+	}
+}
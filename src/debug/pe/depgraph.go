@@ -0,0 +1,163 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Dependency is an import of a module of a DependencyGraph,
+// resolved through forwarders and API sets to the module that
+// implements it.
+type Dependency struct {
+	Importer string // key of the importing module
+	Import   Import
+
+	// Module is the key of the module implementing the import,
+	// and Export its entry for it. Module is empty, and Err
+	// says why, if the import is unresolved.
+	Module string
+	Export Export
+	Err    error
+}
+
+// A DependencyGraph records which modules of a set of PE files
+// import what from which others, for checking that an installation
+// is complete or finding out why a DLL fails to load.
+type DependencyGraph struct {
+	// Resolver holds the modules of the graph in its Files,
+	// keyed by lower-case file name.
+	Resolver *ExportResolver
+
+	// Dependencies holds the imports of every module, by
+	// module key and then in the order of Imports.
+	Dependencies []Dependency
+
+	files []*File // opened by OpenDependencyGraph
+}
+
+// NewDependencyGraph resolves the imports of every module in
+// r.Files against the others. An import from a DLL missing from
+// r.Files, or of a function its DLL does not export, is recorded
+// as unresolved. NewDependencyGraph only fails if the imports of
+// a module cannot be read.
+func NewDependencyGraph(r *ExportResolver) (*DependencyGraph, error) {
+	names := make([]string, 0, len(r.Files))
+	for name := range r.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	g := &DependencyGraph{Resolver: r}
+	for _, name := range names {
+		imps, err := r.Files[name].Imports()
+		if err != nil {
+			return nil, fmt.Errorf("pe: imports of %s: %v", name, err)
+		}
+		for _, imp := range imps {
+			sym := imp.Name
+			if imp.ByOrdinal {
+				sym = "#" + strconv.Itoa(int(imp.Ordinal))
+			}
+			d := Dependency{Importer: name, Import: imp}
+			d.Module, d.Export, d.Err = r.ResolveFrom(name, imp.DLL, sym)
+			g.Dependencies = append(g.Dependencies, d)
+		}
+	}
+	return g, nil
+}
+
+// OpenDependencyGraph opens the named PE files with Open and
+// builds the DependencyGraph of their imports, keying each by the
+// lower-case base name of its path. It fails if two files have
+// the same base name. Call Close to close the files.
+func OpenDependencyGraph(paths ...string) (*DependencyGraph, error) {
+	r := &ExportResolver{Files: make(map[string]*File, len(paths))}
+	var files []*File
+	fail := func(err error) (*DependencyGraph, error) {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, err
+	}
+	for _, path := range paths {
+		name := strings.ToLower(filepath.Base(path))
+		if r.Files[name] != nil {
+			return fail(fmt.Errorf("pe: %s and another file are both named %s", path, name))
+		}
+		f, err := Open(path)
+		if err != nil {
+			return fail(err)
+		}
+		files = append(files, f)
+		r.Files[name] = f
+	}
+	g, err := NewDependencyGraph(r)
+	if err != nil {
+		return fail(err)
+	}
+	g.files = files
+	return g, nil
+}
+
+// Close closes the files opened by OpenDependencyGraph.
+func (g *DependencyGraph) Close() error {
+	var err error
+	for _, f := range g.files {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	g.files = nil
+	return err
+}
+
+// Unresolved returns the dependencies of g that
+// could not be resolved, in the order of g.Dependencies.
+func (g *DependencyGraph) Unresolved() []Dependency {
+	var deps []Dependency
+	for _, d := range g.Dependencies {
+		if d.Err != nil {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+// Imports returns the sorted keys of the modules that
+// the module with key name imports from, once forwarders
+// and API sets are resolved.
+func (g *DependencyGraph) Imports(name string) []string {
+	return g.collect(func(d *Dependency) (string, bool) {
+		return d.Module, d.Importer == name && d.Err == nil
+	})
+}
+
+// Importers returns the sorted keys of the modules
+// that import from the module with key name, once
+// forwarders and API sets are resolved.
+func (g *DependencyGraph) Importers(name string) []string {
+	return g.collect(func(d *Dependency) (string, bool) {
+		return d.Importer, d.Module == name && d.Err == nil
+	})
+}
+
+// collect returns the sorted, distinct keys
+// sel returns for the dependencies of g.
+func (g *DependencyGraph) collect(sel func(*Dependency) (string, bool)) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for i := range g.Dependencies {
+		if name, ok := sel(&g.Dependencies[i]); ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/hex"
+	"unicode/utf8"
+)
+
+// A Description is a structured dump of a File, made only of
+// plain values, so that it can be serialized, for example as JSON
+// with encoding/json, and diffed or queried with tools such as jq.
+// Field names match those of the PE specification and of the other
+// types of this package, and are kept stable.
+//
+// Byte strings that are not text, such as the MS-DOS stub and
+// auxiliary symbol records, are hexadecimal strings. Section and
+// symbol names are stored as strings, which encoders like
+// encoding/json require to be valid UTF-8; names that are not
+// also have their raw bytes in hexadecimal in RawName.
+type Description struct {
+	Kind           string     // "image", "object", "bigobj" or "te"
+	DOSHeader      *DOSHeader `json:",omitempty"`
+	DOSStub        string     `json:",omitempty"`
+	FileHeader     FileHeader
+	BigObjHeader   *BigObjHeader `json:",omitempty"`
+	TEHeader       *TEHeader     `json:",omitempty"`
+	OptionalHeader interface{}   `json:",omitempty"` // *OptionalHeader32 or *OptionalHeader64
+	Sections       []SectionDescription
+	Symbols        []SymbolDescription    `json:",omitempty"`
+	Directories    []DirectoryDescription `json:",omitempty"`
+	Imports        []Import               `json:",omitempty"`
+	Exports        *ExportDirectory       `json:",omitempty"`
+
+	// Warnings and Errors hold the messages of File.Warnings
+	// and File.Errors, and of errors met while reading the
+	// symbols and data directories for the Description.
+	Warnings []string `json:",omitempty"`
+	Errors   []string `json:",omitempty"`
+}
+
+// A SectionDescription describes a section in a Description.
+type SectionDescription struct {
+	Name                 string
+	RawName              string `json:",omitempty"`
+	VirtualSize          uint32
+	VirtualAddress       uint32
+	Size                 uint32
+	Offset               uint32
+	PointerToRelocations uint32
+	PointerToLineNumbers uint32
+	NumberOfRelocations  uint16
+	NumberOfLineNumbers  uint16
+	Characteristics      uint32
+	Relocs               []Reloc `json:",omitempty"`
+}
+
+// A SymbolDescription describes a symbol in a Description.
+type SymbolDescription struct {
+	Index         int // index of the symbol's record in the symbol table
+	Name          string
+	RawName       string `json:",omitempty"`
+	Value         uint32
+	SectionNumber int32
+	Type          uint16
+	StorageClass  uint8
+	Aux           []string `json:",omitempty"` // auxiliary records, in hexadecimal
+}
+
+// A DirectoryDescription describes a data directory in a Description.
+type DirectoryDescription struct {
+	Index int
+	Name  string
+	DataDirectory
+}
+
+// describeName returns name for use in a Description and, if it is
+// not valid UTF-8, its bytes in hexadecimal.
+func describeName(name string) (string, string) {
+	if utf8.ValidString(name) {
+		return name, ""
+	}
+	return name, hex.EncodeToString([]byte(name))
+}
+
+// Describe returns a Description of f. Problems reading the
+// symbols, imports or exports of f do not make it fail; they are
+// recorded in the Errors of the Description instead.
+func (f *File) Describe() *Description {
+	d := &Description{
+		Kind:           "object",
+		DOSHeader:      f.DOSHeader,
+		FileHeader:     f.FileHeader,
+		BigObjHeader:   f.BigObjHeader,
+		TEHeader:       f.TEHeader,
+		OptionalHeader: f.OptionalHeader,
+		Sections:       []SectionDescription{},
+	}
+	switch {
+	case f.TEHeader != nil:
+		d.Kind = "te"
+	case f.OptionalHeader != nil:
+		d.Kind = "image"
+	case f.BigObjHeader != nil:
+		d.Kind = "bigobj"
+	}
+	if f.DOSStub != nil {
+		d.DOSStub = hex.EncodeToString(f.DOSStub)
+	}
+	for _, s := range f.Sections {
+		sd := SectionDescription{
+			VirtualSize:          s.VirtualSize,
+			VirtualAddress:       s.VirtualAddress,
+			Size:                 s.Size,
+			Offset:               s.Offset,
+			PointerToRelocations: s.PointerToRelocations,
+			PointerToLineNumbers: s.PointerToLineNumbers,
+			NumberOfRelocations:  s.NumberOfRelocations,
+			NumberOfLineNumbers:  s.NumberOfLineNumbers,
+			Characteristics:      s.Characteristics,
+			Relocs:               s.Relocs,
+		}
+		sd.Name, sd.RawName = describeName(s.Name)
+		d.Sections = append(d.Sections, sd)
+	}
+	if err := f.describeSymbols(d); err != nil {
+		d.Errors = append(d.Errors, err.Error())
+	}
+	if oh := f.optionalHeader(); oh != nil {
+		for i := range oh.dataDirectories {
+			if uint32(i) >= oh.numberOfRvaAndSizes {
+				break
+			}
+			d.Directories = append(d.Directories, DirectoryDescription{i, directoryNames[i], oh.dataDirectories[i]})
+		}
+		if oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT).VirtualAddress != 0 {
+			imps, err := f.Imports()
+			if err != nil {
+				d.Errors = append(d.Errors, err.Error())
+			}
+			d.Imports = imps
+		}
+		if oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_EXPORT).VirtualAddress != 0 {
+			exps, err := f.Exports()
+			if err != nil {
+				d.Errors = append(d.Errors, err.Error())
+			}
+			d.Exports = exps
+		}
+	}
+	for _, err := range f.Warnings {
+		d.Warnings = append(d.Warnings, err.Error())
+	}
+	for _, err := range f.Errors {
+		d.Errors = append(d.Errors, err.Error())
+	}
+	return d
+}
+
+// describeSymbols adds the symbols of f to d.
+func (f *File) describeSymbols(d *Description) error {
+	if err := f.ensureSymbols(); err != nil {
+		return err
+	}
+	var sd *SymbolDescription
+	for i := range f.COFFSymbols {
+		sym := &f.COFFSymbols[i]
+		if sd != nil && len(sd.Aux) < cap(sd.Aux) {
+			var b [COFFSymbolSize]byte
+			encodeCOFFSymbol(b[:], sym)
+			sd.Aux = append(sd.Aux, hex.EncodeToString(b[:]))
+			continue
+		}
+		name, err := sym.FullName(f.StringTable)
+		if err != nil {
+			return err
+		}
+		d.Symbols = append(d.Symbols, SymbolDescription{
+			Index:         i,
+			Value:         sym.Value,
+			SectionNumber: bigSectionNumber(sym.SectionNumber),
+			Type:          sym.Type,
+			StorageClass:  sym.StorageClass,
+		})
+		sd = &d.Symbols[len(d.Symbols)-1]
+		sd.Name, sd.RawName = describeName(name)
+		if i < len(f.COFFBigSymbols) {
+			sd.SectionNumber = f.COFFBigSymbols[i].SectionNumber
+		}
+		if sym.NumberOfAuxSymbols > 0 {
+			sd.Aux = make([]string, 0, sym.NumberOfAuxSymbols)
+		}
+	}
+	return nil
+}
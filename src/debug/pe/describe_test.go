@@ -0,0 +1,93 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := json.Marshal(f.Describe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d struct {
+		Kind           string
+		DOSStub        string
+		FileHeader     struct{ Machine uint16 }
+		OptionalHeader struct{ ImageBase uint64 }
+		Sections       []struct{ Name string }
+		Symbols        []struct {
+			Index int
+			Name  string
+			Aux   []string
+		}
+		Directories []struct {
+			Name           string
+			VirtualAddress uint32
+		}
+		Imports []struct{ DLL, Name string }
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Kind != "image" || d.FileHeader.Machine != IMAGE_FILE_MACHINE_AMD64 || d.OptionalHeader.ImageBase != 0x400000 {
+		t.Errorf("got kind %q, header %+v, optional header %+v", d.Kind, d.FileHeader, d.OptionalHeader)
+	}
+	if want := len(f.DOSStub) * 2; len(d.DOSStub) != want {
+		t.Errorf("DOS stub has %d hex digits, want %d", len(d.DOSStub), want)
+	}
+	if len(d.Sections) != len(f.Sections) || d.Sections[0].Name != ".text" {
+		t.Errorf("got sections %+v", d.Sections)
+	}
+	if len(d.Symbols) != len(f.Symbols) {
+		t.Errorf("got %d symbols, want %d", len(d.Symbols), len(f.Symbols))
+	}
+	for _, s := range d.Symbols {
+		if n := f.COFFSymbols[s.Index].NumberOfAuxSymbols; len(s.Aux) != int(n) {
+			t.Errorf("symbol %s has %d auxiliary records, want %d", s.Name, len(s.Aux), n)
+		}
+	}
+	if len(d.Directories) != 16 || d.Directories[1].Name != "Import" || d.Directories[1].VirtualAddress == 0 {
+		t.Errorf("got directories %+v", d.Directories)
+	}
+	if len(d.Imports) == 0 || d.Imports[0].DLL != "KERNEL32.dll" {
+		t.Errorf("got imports %+v", d.Imports)
+	}
+}
+
+func TestDescribeNames(t *testing.T) {
+	obj, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(makeBigObj(obj)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Sections[0].Name = ".t\xffxt"
+	d := f.Describe()
+	if d.Kind != "bigobj" {
+		t.Errorf("got kind %q, want bigobj", d.Kind)
+	}
+	if s := d.Sections[0]; s.RawName != "2e74ff7874" {
+		t.Errorf("got name %q, raw name %q", s.Name, s.RawName)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b, []byte(`"ClassID":"d1baa1c7-baee-4ba9-af20-faf66aa4dcb8"`)) {
+		t.Errorf("big object class ID not serialized as a string")
+	}
+}
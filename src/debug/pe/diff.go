@@ -0,0 +1,383 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A FileDiff is the structural difference between two files,
+// as computed by Diff. Its slices are empty if the files are
+// the same in that respect.
+type FileDiff struct {
+	// Fields lists the header fields that differ: those of the
+	// MS-DOS, COFF file, big object, TE and optional headers.
+	Fields []FieldChange
+
+	// Sections lists the sections added, removed or changed.
+	Sections []SectionChange
+
+	AddedImports   []Import
+	RemovedImports []Import
+	AddedExports   []Export
+	RemovedExports []Export
+	ChangedExports []ExportChange
+
+	// Ranges lists the ranges of file offsets at which the bytes
+	// of the two files differ. If one file is longer, the rest of
+	// it makes up the last range.
+	Ranges []ByteRange
+}
+
+// A FieldChange is a header field that differs between two files.
+// Name is the path to the field, such as "FileHeader.TimeDateStamp"
+// or "OptionalHeader.DataDirectory[4].Size". Old or New is nil if
+// the header is missing from that file.
+type FieldChange struct {
+	Name     string
+	Old, New interface{}
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Name, diffValue(c.Old), diffValue(c.New))
+}
+
+// diffValue formats v for a report: integers in hexadecimal
+// and missing values as "none".
+func diffValue(v interface{}) string {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Invalid:
+		return "none"
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%#x", v)
+	}
+	return fmt.Sprint(v)
+}
+
+// A SectionChange describes a section added, removed or changed
+// between two files. Sections are matched by name, in order.
+type SectionChange struct {
+	Name        string
+	Old, New    *SectionHeader // nil if the section was added or removed
+	Fields      []FieldChange  // the header fields that differ
+	DataChanged bool           // whether the raw data differs
+}
+
+// An ExportChange is an export whose name, or ordinal if it has
+// no name, is found in both files, but whose address, forwarder
+// or ordinal differ.
+type ExportChange struct {
+	Old, New Export
+}
+
+// A ByteRange is a range of file offsets.
+type ByteRange struct {
+	Off, Size int64
+}
+
+// Diff compares the files a and b and returns their structural
+// differences. Comparing the bytes of the files requires their
+// size to be known.
+func Diff(a, b *File) (*FileDiff, error) {
+	d := new(FileDiff)
+	headers := []struct {
+		name string
+		a, b interface{}
+	}{
+		{"DOSHeader", a.DOSHeader, b.DOSHeader},
+		{"FileHeader", a.FileHeader, b.FileHeader},
+		{"BigObjHeader", a.BigObjHeader, b.BigObjHeader},
+		{"TEHeader", a.TEHeader, b.TEHeader},
+		{"OptionalHeader", a.OptionalHeader, b.OptionalHeader},
+	}
+	for _, h := range headers {
+		d.Fields = diffFields(d.Fields, h.name, reflect.ValueOf(h.a), reflect.ValueOf(h.b))
+	}
+
+	if err := d.diffSections(a, b); err != nil {
+		return nil, err
+	}
+	if err := d.diffImports(a, b); err != nil {
+		return nil, err
+	}
+	if err := d.diffExports(a, b); err != nil {
+		return nil, err
+	}
+
+	ra, err := a.fileReader()
+	if err != nil {
+		return nil, err
+	}
+	rb, err := b.fileReader()
+	if err != nil {
+		return nil, err
+	}
+	if d.Ranges, err = diffBytes(ra, rb, -1); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// diffFields appends to list the fields that differ between
+// a and b, values of the same type, or invalid if missing.
+func diffFields(list []FieldChange, name string, a, b reflect.Value) []FieldChange {
+	if a.Kind() == reflect.Interface || a.Kind() == reflect.Ptr {
+		if !a.IsNil() {
+			a = a.Elem()
+		} else {
+			a = reflect.Value{}
+		}
+	}
+	if b.Kind() == reflect.Interface || b.Kind() == reflect.Ptr {
+		if !b.IsNil() {
+			b = b.Elem()
+		} else {
+			b = reflect.Value{}
+		}
+	}
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		if a.IsValid() || b.IsValid() {
+			list = append(list, FieldChange{name, diffInterface(a), diffInterface(b)})
+		}
+		return list
+	}
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			list = diffFields(list, name+"."+a.Type().Field(i).Name, a.Field(i), b.Field(i))
+		}
+	case reflect.Array:
+		for i := 0; i < a.Len(); i++ {
+			list = diffFields(list, name+"["+strconv.Itoa(i)+"]", a.Index(i), b.Index(i))
+		}
+	default:
+		if a.Interface() != b.Interface() {
+			list = append(list, FieldChange{name, a.Interface(), b.Interface()})
+		}
+	}
+	return list
+}
+
+// diffInterface returns the value held by v, or nil if v is invalid.
+func diffInterface(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// diffSections records the sections that differ between a and b.
+func (d *FileDiff) diffSections(a, b *File) error {
+	matched := make([]bool, len(b.Sections))
+	for _, sa := range a.Sections {
+		var sb *Section
+		for j, s := range b.Sections {
+			if !matched[j] && s.Name == sa.Name {
+				matched[j] = true
+				sb = s
+				break
+			}
+		}
+		if sb == nil {
+			h := sa.SectionHeader
+			d.Sections = append(d.Sections, SectionChange{Name: sa.Name, Old: &h})
+			continue
+		}
+		fields := diffFields(nil, "", reflect.ValueOf(sa.SectionHeader), reflect.ValueOf(sb.SectionHeader))
+		for i := range fields {
+			fields[i].Name = fields[i].Name[1:]
+		}
+		ranges, err := diffBytes(sa.Open(), sb.Open(), 1)
+		if err != nil {
+			return err
+		}
+		if len(fields) > 0 || len(ranges) > 0 {
+			ha, hb := sa.SectionHeader, sb.SectionHeader
+			d.Sections = append(d.Sections, SectionChange{sa.Name, &ha, &hb, fields, len(ranges) > 0})
+		}
+	}
+	for j, s := range b.Sections {
+		if !matched[j] {
+			h := s.SectionHeader
+			d.Sections = append(d.Sections, SectionChange{Name: s.Name, New: &h})
+		}
+	}
+	return nil
+}
+
+// importKey identifies an import across files: DLL names
+// are not case-sensitive.
+func importKey(imp Import) string {
+	if imp.ByOrdinal {
+		return strings.ToLower(imp.DLL) + "!#" + strconv.Itoa(int(imp.Ordinal))
+	}
+	return strings.ToLower(imp.DLL) + "!" + imp.Name
+}
+
+// diffImports records the imports found in only one of a and b.
+func (d *FileDiff) diffImports(a, b *File) error {
+	ia, err := a.Imports()
+	if err != nil {
+		return err
+	}
+	ib, err := b.Imports()
+	if err != nil {
+		return err
+	}
+	inA := make(map[string]bool)
+	for _, imp := range ia {
+		inA[importKey(imp)] = true
+	}
+	inB := make(map[string]bool)
+	for _, imp := range ib {
+		inB[importKey(imp)] = true
+		if !inA[importKey(imp)] {
+			d.AddedImports = append(d.AddedImports, imp)
+		}
+	}
+	for _, imp := range ia {
+		if !inB[importKey(imp)] {
+			d.RemovedImports = append(d.RemovedImports, imp)
+		}
+	}
+	return nil
+}
+
+// exportKey identifies an export across files.
+func exportKey(e Export) string {
+	if e.Name == "" {
+		return "#" + strconv.Itoa(int(e.Ordinal))
+	}
+	return e.Name
+}
+
+// diffExports records the exports added, removed or changed from a to b.
+func (d *FileDiff) diffExports(a, b *File) error {
+	var ea, eb []Export
+	if dir, err := a.Exports(); err != nil {
+		return err
+	} else if dir != nil {
+		ea = dir.Exports
+	}
+	if dir, err := b.Exports(); err != nil {
+		return err
+	} else if dir != nil {
+		eb = dir.Exports
+	}
+	inA := make(map[string]Export)
+	for _, e := range ea {
+		inA[exportKey(e)] = e
+	}
+	inB := make(map[string]bool)
+	for _, e := range eb {
+		inB[exportKey(e)] = true
+		old, ok := inA[exportKey(e)]
+		switch {
+		case !ok:
+			d.AddedExports = append(d.AddedExports, e)
+		case old != e:
+			d.ChangedExports = append(d.ChangedExports, ExportChange{old, e})
+		}
+	}
+	for _, e := range ea {
+		if !inB[exportKey(e)] {
+			d.RemovedExports = append(d.RemovedExports, e)
+		}
+	}
+	return nil
+}
+
+// diffBytes returns the ranges of offsets at which the data read
+// from a and b differ, stopping after max ranges if max >= 0.
+func diffBytes(a, b io.Reader, max int) ([]ByteRange, error) {
+	var ranges []ByteRange
+	bufA := make([]byte, 32<<10)
+	bufB := make([]byte, len(bufA))
+	var off int64
+	for max < 0 || len(ranges) < max {
+		na, errA := io.ReadFull(a, bufA)
+		nb, errB := io.ReadFull(b, bufB)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return nil, errA
+		}
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return nil, errB
+		}
+		n := na
+		if nb > n {
+			n = nb
+		}
+		pa, pb := bufA[:na], bufB[:nb]
+		if !bytes.Equal(pa, pb) {
+			for i := 0; i < n; i++ {
+				if i < na && i < nb && pa[i] == pb[i] {
+					continue
+				}
+				// Extend the previous range if it ends here.
+				if k := len(ranges) - 1; k >= 0 && ranges[k].Off+ranges[k].Size == off+int64(i) {
+					ranges[k].Size++
+				} else {
+					ranges = append(ranges, ByteRange{off + int64(i), 1})
+				}
+			}
+		}
+		off += int64(n)
+		if na < len(bufA) && nb < len(bufB) {
+			break
+		}
+	}
+	if max >= 0 && len(ranges) > max {
+		ranges = ranges[:max]
+	}
+	return ranges, nil
+}
+
+// String returns a report of the differences in d, one per line.
+func (d *FileDiff) String() string {
+	var buf bytes.Buffer
+	for _, c := range d.Fields {
+		fmt.Fprintf(&buf, "field %v\n", c)
+	}
+	for _, s := range d.Sections {
+		switch {
+		case s.Old == nil:
+			fmt.Fprintf(&buf, "section %s: added, size %#x\n", s.Name, s.New.Size)
+		case s.New == nil:
+			fmt.Fprintf(&buf, "section %s: removed\n", s.Name)
+		default:
+			for _, c := range s.Fields {
+				fmt.Fprintf(&buf, "section %s: %v\n", s.Name, c)
+			}
+			if s.DataChanged {
+				fmt.Fprintf(&buf, "section %s: data changed\n", s.Name)
+			}
+		}
+	}
+	for _, imp := range d.AddedImports {
+		fmt.Fprintf(&buf, "import %s: added\n", importKey(imp))
+	}
+	for _, imp := range d.RemovedImports {
+		fmt.Fprintf(&buf, "import %s: removed\n", importKey(imp))
+	}
+	for _, e := range d.AddedExports {
+		fmt.Fprintf(&buf, "export %s: added\n", exportKey(e))
+	}
+	for _, e := range d.RemovedExports {
+		fmt.Fprintf(&buf, "export %s: removed\n", exportKey(e))
+	}
+	for _, c := range d.ChangedExports {
+		fmt.Fprintf(&buf, "export %s: %+v -> %+v\n", exportKey(c.New), c.Old, c.New)
+	}
+	for _, r := range d.Ranges {
+		fmt.Fprintf(&buf, "bytes %#x-%#x differ\n", r.Off, r.Off+r.Size)
+	}
+	return buf.String()
+}
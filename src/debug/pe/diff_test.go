@@ -0,0 +1,111 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	const file = "testdata/gcc-amd64-mingw-exec"
+	orig, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Diff(a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := d.String(); s != "" {
+		t.Errorf("Diff of a file with itself:\n%s", s)
+	}
+
+	// Change the time stamp, a byte of .text
+	// and the name of the first import.
+	b := append([]byte(nil), orig...)
+	binary.LittleEndian.PutUint32(b[a.base+4:], a.TimeDateStamp+1)
+	text := a.Section(".text")
+	b[text.Offset+0x10] ^= 0xff
+	imps, err := a.Imports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := imps[0]
+	i := bytes.Index(b, []byte(imp.Name+"\x00"))
+	b[i] = 'X'
+	renamed := "X" + imp.Name[1:]
+
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err = Diff(a, f); err != nil {
+		t.Fatal(err)
+	}
+	wantFields := []FieldChange{{"FileHeader.TimeDateStamp", a.TimeDateStamp, a.TimeDateStamp + 1}}
+	if !reflect.DeepEqual(d.Fields, wantFields) {
+		t.Errorf("Fields = %v, want %v", d.Fields, wantFields)
+	}
+	if len(d.Sections) < 1 || d.Sections[0].Name != ".text" || !d.Sections[0].DataChanged || d.Sections[0].Fields != nil {
+		t.Errorf("Sections = %+v, want .text with changed data first", d.Sections)
+	}
+	if len(d.AddedImports) != 1 || d.AddedImports[0].Name != renamed {
+		t.Errorf("AddedImports = %+v, want %s", d.AddedImports, renamed)
+	}
+	if !reflect.DeepEqual(d.RemovedImports, []Import{imp}) {
+		t.Errorf("RemovedImports = %+v, want %+v", d.RemovedImports, imp)
+	}
+	wantRanges := []ByteRange{{a.base + 4, 1}, {int64(text.Offset) + 0x10, 1}, {int64(i), 1}}
+	if !reflect.DeepEqual(d.Ranges, wantRanges) {
+		t.Errorf("Ranges = %v, want %v", d.Ranges, wantRanges)
+	}
+
+	// Append a certificate table.
+	var buf bytes.Buffer
+	if err := a.WriteCertificates(&buf, []Certificate{{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("x")}}); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = NewFile(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = Diff(a, f); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range d.Fields {
+		names = append(names, c.Name)
+	}
+	wantNames := []string{"OptionalHeader.CheckSum", "OptionalHeader.DataDirectory[4].VirtualAddress", "OptionalHeader.DataDirectory[4].Size"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("changed fields %q, want %q", names, wantNames)
+	}
+	if r := d.Ranges[len(d.Ranges)-1]; r.Off+r.Size != int64(buf.Len()) {
+		t.Errorf("last range %v does not end with the file, of size %#x", r, buf.Len())
+	}
+
+	// An image and an object.
+	obj, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if d, err = Diff(a, obj); err != nil {
+		t.Fatal(err)
+	}
+	if c := d.Fields[0]; c.Name != "DOSHeader" || c.New != nil {
+		t.Errorf("first changed field %v, want removed DOSHeader", c)
+	}
+	if s := d.String(); !bytes.Contains([]byte(s), []byte("field OptionalHeader: ")) {
+		t.Errorf("report does not show the removed optional header:\n%s", s)
+	}
+}
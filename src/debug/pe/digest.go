@@ -0,0 +1,185 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"hash"
+	"io"
+	"math"
+)
+
+// Entropy returns the Shannon entropy, in bits per byte, of the raw
+// data of s. It ranges from 0, for data that consists of a single
+// repeated byte, to 8, for uniformly random data; compressed or
+// encrypted data is typically above 7.
+func (s *Section) Entropy() (float64, error) {
+	return entropy(s.Open())
+}
+
+// Sum writes the raw data of s to h and returns the resulting
+// digest, for example s.Sum(sha256.New()).
+func (s *Section) Sum(h hash.Hash) ([]byte, error) {
+	if _, err := io.Copy(h, s.Open()); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// fileReader returns a reader for the whole underlying file of f.
+func (f *File) fileReader() (*io.SectionReader, error) {
+	if f.size < 0 {
+		return nil, errors.New("pe: file size unknown")
+	}
+	return io.NewSectionReader(f.r, 0, f.size), nil
+}
+
+// Entropy returns the Shannon entropy, in bits per byte,
+// of the whole underlying file of f. See Section.Entropy.
+// It fails if the size of the file is not known.
+func (f *File) Entropy() (float64, error) {
+	r, err := f.fileReader()
+	if err != nil {
+		return 0, err
+	}
+	return entropy(r)
+}
+
+// Sum writes the whole underlying file of f to h and returns
+// the resulting digest. It fails if the size of the file
+// is not known.
+func (f *File) Sum(h hash.Hash) ([]byte, error) {
+	r, err := f.fileReader()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// MappedSum writes f to h as WriteMapped does and returns the
+// resulting digest, for comparing a file with a memory dump of
+// the image loaded from it.
+func (f *File) MappedSum(h hash.Hash) ([]byte, error) {
+	if err := f.WriteMapped(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// AuthenticodeDigest returns the Authenticode digest of f computed
+// with h, the digest an Authenticode signature of f signs. See
+// AuthenticodeDigests.
+func (f *File) AuthenticodeDigest(h hash.Hash) ([]byte, error) {
+	sums, err := f.AuthenticodeDigests(h)
+	if err != nil {
+		return nil, err
+	}
+	return sums[0], nil
+}
+
+// AuthenticodeDigests returns the Authenticode digests of f
+// computed with each of hs, reading the file only once, for example
+// f.AuthenticodeDigests(md5.New(), sha1.New(), sha256.New()).
+//
+// The digests cover the whole underlying file except the CheckSum
+// field of the optional header, the security data directory and
+// the attribute certificate table, so that signing does not change
+// them. AuthenticodeDigests fails if the size of the file is not
+// known, if f is not a PE image or if f was created by
+// NewFileFromImage.
+func (f *File) AuthenticodeDigests(hs ...hash.Hash) ([][]byte, error) {
+	if f.imageLayout {
+		return nil, errors.New("pe: AuthenticodeDigests called on a loaded image")
+	}
+	oh := f.optionalHeader()
+	if oh == nil || f.TEHeader != nil {
+		return nil, errors.New("pe: AuthenticodeDigests called on a file that is not a PE image")
+	}
+	if f.size < 0 {
+		return nil, errors.New("pe: file size unknown")
+	}
+
+	// The ranges to skip, as offset and size. Short optional
+	// headers may stop before the security data directory.
+	skip := [][2]int64{{f.base + 20 + ohCheckSum, 4}}
+	if oh.numberOfRvaAndSizes > IMAGE_DIRECTORY_ENTRY_SECURITY && int(f.base)+20+int(f.SizeOfOptionalHeader) >= f.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_SECURITY+1) {
+		skip = append(skip, [2]int64{int64(f.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_SECURITY)), 8})
+		if off, size := f.certificateTable(); off != 0 {
+			if int64(off)+int64(size) > f.size {
+				return nil, &FormatError{int64(off), "certificate table", ErrOutOfBounds, size}
+			}
+			skip = append(skip, [2]int64{int64(off), int64(size)})
+		}
+	}
+	skip = append(skip, [2]int64{f.size, 0})
+	for i := 1; i < len(skip); i++ {
+		for j := i; j > 0 && skip[j][0] < skip[j-1][0]; j-- {
+			skip[j], skip[j-1] = skip[j-1], skip[j]
+		}
+	}
+
+	ws := make([]io.Writer, len(hs))
+	for i, h := range hs {
+		ws[i] = h
+	}
+	w := io.MultiWriter(ws...)
+	var pos int64
+	for _, s := range skip {
+		if s[0] > pos {
+			if _, err := io.Copy(w, io.NewSectionReader(f.r, pos, s[0]-pos)); err != nil {
+				return nil, err
+			}
+		}
+		if end := s[0] + s[1]; end > pos {
+			pos = end
+		}
+	}
+	sums := make([][]byte, len(hs))
+	for i, h := range hs {
+		sums[i] = h.Sum(nil)
+	}
+	return sums, nil
+}
+
+// entropy returns the Shannon entropy of the data read from r.
+func entropy(r io.Reader) (float64, error) {
+	var counts [256]int64
+	var total int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+		total += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return entropyOf(&counts, total), nil
+}
+
+// entropyOf returns the Shannon entropy of data
+// with the given byte counts and total length.
+func entropyOf(counts *[256]int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	var e float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(total)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
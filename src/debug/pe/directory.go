@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"strconv"
+)
+
+// directoryNames are the names of the data directories, by index.
+var directoryNames = [IMAGE_NUMBEROF_DIRECTORY_ENTRIES]string{
+	"Export", "Import", "Resource", "Exception",
+	"Security", "BaseReloc", "Debug", "Architecture",
+	"GlobalPtr", "TLS", "LoadConfig", "BoundImport",
+	"IAT", "DelayImport", "COMDescriptor", "Reserved",
+}
+
+// DirectoryName returns the name of data directory i, such as
+// "Export" for IMAGE_DIRECTORY_ENTRY_EXPORT, or "Directory(i)"
+// if i is not the index of a data directory.
+func DirectoryName(i int) string {
+	if i < 0 || i >= len(directoryNames) {
+		return "Directory(" + strconv.Itoa(i) + ")"
+	}
+	return directoryNames[i]
+}
+
+// Directory returns data directory i of oh, such as
+// IMAGE_DIRECTORY_ENTRY_IMPORT, and reports whether oh has it:
+// NumberOfRvaAndSizes may leave out the last directories.
+func (oh *OptionalHeader32) Directory(i int) (DataDirectory, bool) {
+	return directory(&oh.DataDirectory, oh.NumberOfRvaAndSizes, i)
+}
+
+// Directory returns data directory i of oh, such as
+// IMAGE_DIRECTORY_ENTRY_IMPORT, and reports whether oh has it:
+// NumberOfRvaAndSizes may leave out the last directories.
+func (oh *OptionalHeader64) Directory(i int) (DataDirectory, bool) {
+	return directory(&oh.DataDirectory, oh.NumberOfRvaAndSizes, i)
+}
+
+func directory(dirs *[IMAGE_NUMBEROF_DIRECTORY_ENTRIES]DataDirectory, n uint32, i int) (DataDirectory, bool) {
+	if i < 0 || i >= len(dirs) || uint32(i) >= n {
+		return DataDirectory{}, false
+	}
+	return dirs[i], true
+}
+
+// A Directory is a data directory of an image,
+// as returned by File.DataDirectory.
+type Directory struct {
+	DataDirectory
+
+	// Data is the parsed contents of the directory,
+	// or nil if the directory is empty or this package
+	// does not parse it. Its type depends on the directory:
+	//
+	//	IMAGE_DIRECTORY_ENTRY_EXPORT       *ExportDirectory
+	//	IMAGE_DIRECTORY_ENTRY_IMPORT       []Import
+	//	IMAGE_DIRECTORY_ENTRY_RESOURCE     *ResourceDirectory
+	//	IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG  *LoadConfig
+	Data interface{}
+}
+
+// directoryParsers holds the parsers of the data directories
+// this package understands, by directory index.
+var directoryParsers = map[int]func(f *File) (interface{}, error){
+	IMAGE_DIRECTORY_ENTRY_EXPORT:      func(f *File) (interface{}, error) { return f.Exports() },
+	IMAGE_DIRECTORY_ENTRY_IMPORT:      func(f *File) (interface{}, error) { return f.Imports() },
+	IMAGE_DIRECTORY_ENTRY_RESOURCE:    func(f *File) (interface{}, error) { return f.Resources() },
+	IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG: func(f *File) (interface{}, error) { return f.LoadConfig() },
+}
+
+// DataDirectory returns data directory i of f, both as stored in
+// the optional header and, where this package can parse it, in
+// parsed form. It fails if f has no optional header or if the
+// optional header has fewer than i+1 data directories.
+func (f *File) DataDirectory(i int) (*Directory, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, errors.New("pe: file has no optional header")
+	}
+	if i < 0 || i >= len(oh.dataDirectories) || uint32(i) >= oh.numberOfRvaAndSizes {
+		return nil, &FormatError{-1, "data directory", ErrOutOfBounds, i}
+	}
+	d := &Directory{DataDirectory: oh.dataDirectory(i)}
+	if d.VirtualAddress == 0 {
+		return d, nil
+	}
+	if parse := directoryParsers[i]; parse != nil {
+		data, err := parse(f)
+		if err != nil {
+			return nil, err
+		}
+		d.Data = data
+	}
+	return d, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// A LinkerDirective is a linker option found in the .drectve
+// section of an object file, such as /DEFAULTLIB:kernel32.lib,
+// /EXPORT:name[,@ordinal][,NONAME][,DATA][,PRIVATE],
+// /ALTERNATENAME:name=default or /INCLUDE:symbol.
+type LinkerDirective struct {
+	Name  string // option name, in upper case, without the leading / or -
+	Value string // text after the colon, without quotes, or "" if none
+}
+
+// LinkerDirectives returns the linker options in the .drectve
+// sections of f, in order. It returns none if f has no such
+// section, as is the case of images.
+func (f *File) LinkerDirectives() ([]LinkerDirective, error) {
+	var ds []LinkerDirective
+	for _, s := range f.Sections {
+		if s.Name != ".drectve" {
+			continue
+		}
+		b, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseDirectives(b)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d...)
+	}
+	return ds, nil
+}
+
+// parseDirectives parses the contents of a .drectve section: options
+// separated by spaces, in ASCII or in UTF-8 after a byte order mark.
+// Double quotes protect spaces and are removed.
+func parseDirectives(b []byte) ([]LinkerDirective, error) {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	b = bytes.TrimRight(b, "\x00")
+	var ds []LinkerDirective
+	for _, tok := range splitDirectives(string(b)) {
+		if tok == "" || tok[0] != '/' && tok[0] != '-' {
+			return nil, &FormatError{-1, ".drectve section", errors.New("not an option"), tok}
+		}
+		d := LinkerDirective{Name: tok[1:]}
+		if i := strings.IndexByte(tok, ':'); i >= 0 {
+			d.Name, d.Value = tok[1:i], tok[i+1:]
+		}
+		d.Name = strings.ToUpper(d.Name)
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// splitDirectives splits s at white space
+// outside double quotes and removes the quotes.
+func splitDirectives(s string) []string {
+	var toks []string
+	var tok []byte
+	in, quoted := false, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			quoted = !quoted
+			in = true
+		case !quoted && (c == ' ' || c == '\t' || c == '\r' || c == '\n'):
+			if in {
+				toks = append(toks, string(tok))
+			}
+			tok, in = tok[:0], false
+		default:
+			tok = append(tok, c)
+			in = true
+		}
+	}
+	if in {
+		toks = append(toks, string(tok))
+	}
+	return toks
+}
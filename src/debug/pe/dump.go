@@ -0,0 +1,206 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// DumpFlags selects the parts of a file that Dump prints.
+type DumpFlags uint
+
+const (
+	DumpHeaders DumpFlags = 1 << iota // file, optional and section headers
+	DumpImports                       // imported functions
+	DumpExports                       // exported functions
+	DumpRelocs                        // relocations of each section
+	DumpSymbols                       // COFF symbol table
+
+	DumpAll = DumpHeaders | DumpImports | DumpExports | DumpRelocs | DumpSymbols
+)
+
+// DumpOptions are the options of Dump.
+type DumpOptions struct {
+	// Flags selects the parts of the file to print.
+	// Zero means DumpAll.
+	Flags DumpFlags
+}
+
+// A dumper writes the text of Dump and remembers the first error.
+type dumper struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (d *dumper) printf(format string, args ...interface{}) {
+	fmt.Fprintf(d.w, format, args...)
+}
+
+// fail prints err in place of the part of the dump it prevents.
+func (d *dumper) fail(err error) {
+	d.printf("  error: %v\n", err)
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// Dump writes a textual description of f to w, in the spirit of
+// dumpbin and objdump, made of the parts selected by opts. A nil
+// opts is the same as a zero DumpOptions. The format is meant for
+// people and may change; use Describe for a stable structure.
+//
+// Dump prints as much of f as it can: an error reading one part
+// is printed in place of that part and returned once the dump is
+// complete, unless writing to w fails first.
+func Dump(w io.Writer, f *File, opts *DumpOptions) error {
+	flags := DumpAll
+	if opts != nil && opts.Flags != 0 {
+		flags = opts.Flags
+	}
+	d := &dumper{w: bufio.NewWriter(w)}
+	syms := &Description{}
+	if flags&(DumpRelocs|DumpSymbols) != 0 {
+		if err := f.describeSymbols(syms); err != nil {
+			d.fail(err)
+		}
+	}
+	if flags&DumpHeaders != 0 {
+		d.headers(f)
+	}
+	if flags&DumpImports != 0 {
+		d.imports(f)
+	}
+	if flags&DumpExports != 0 {
+		d.exports(f)
+	}
+	if flags&DumpRelocs != 0 {
+		d.relocs(f, syms.Symbols)
+	}
+	if flags&DumpSymbols != 0 {
+		d.symbols(syms.Symbols)
+	}
+	if err := d.w.Flush(); err != nil {
+		return err
+	}
+	return d.err
+}
+
+func (d *dumper) headers(f *File) {
+	fh := &f.FileHeader
+	d.printf("FILE HEADER\n")
+	d.printf("  Machine              %#x\n", fh.Machine)
+	d.printf("  Sections             %d\n", len(f.Sections))
+	d.printf("  TimeDateStamp        %#x\n", fh.TimeDateStamp)
+	d.printf("  PointerToSymbolTable %#x\n", fh.PointerToSymbolTable)
+	d.printf("  Symbols              %d\n", len(f.COFFSymbols))
+	d.printf("  Characteristics      %#x\n", fh.Characteristics)
+	if f.IsBigObj() {
+		d.printf("  ClassID              %v (big object)\n", f.BigObjHeader.ClassID)
+	}
+	if f.TEHeader != nil {
+		d.printf("  StrippedSize         %#x (TE image)\n", f.TEHeader.StrippedSize)
+	}
+	if oh := f.optionalHeader(); oh != nil {
+		magic := "PE32"
+		if oh.pe64 {
+			magic = "PE32+"
+		}
+		d.printf("\nOPTIONAL HEADER (%s)\n", magic)
+		d.printf("  AddressOfEntryPoint  %#x\n", oh.addressOfEntryPoint)
+		d.printf("  ImageBase            %#x\n", oh.imageBase)
+		d.printf("  SectionAlignment     %#x\n", oh.sectionAlignment)
+		d.printf("  FileAlignment        %#x\n", oh.fileAlignment)
+		d.printf("  SizeOfImage          %#x\n", oh.sizeOfImage)
+		d.printf("  SizeOfHeaders        %#x\n", oh.sizeOfHeaders)
+		d.printf("  CheckSum             %#x\n", oh.checkSum)
+		d.printf("  Subsystem            %d\n", oh.subsystem)
+		d.printf("  DllCharacteristics   %#x\n", oh.dllCharacteristics)
+		d.printf("\nDATA DIRECTORIES\n")
+		for i, dd := range oh.dataDirectories {
+			if uint32(i) >= oh.numberOfRvaAndSizes {
+				break
+			}
+			d.printf("  %2d %-13s %08x %08x\n", i, directoryNames[i], dd.VirtualAddress, dd.Size)
+		}
+	}
+	d.printf("\nSECTIONS\n")
+	d.printf("  Idx Name     VirtSize VirtAddr RawSize  RawPtr   Relocs Flags\n")
+	for i, s := range f.Sections {
+		d.printf("  %3d %-8s %08x %08x %08x %08x %6d %08x\n", i+1, s.Name,
+			s.VirtualSize, s.VirtualAddress, s.Size, s.Offset, len(s.Relocs), s.Characteristics)
+	}
+	d.printf("\n")
+}
+
+func (d *dumper) imports(f *File) {
+	d.printf("IMPORTS\n")
+	imps, err := f.Imports()
+	if err != nil {
+		d.fail(err)
+	}
+	for i, imp := range imps {
+		if i == 0 || imp.DLL != imps[i-1].DLL {
+			d.printf("  %s\n", imp.DLL)
+		}
+		if imp.ByOrdinal {
+			d.printf("    %08x      #%d\n", imp.Slot, imp.Ordinal)
+		} else {
+			d.printf("    %08x %5d %s\n", imp.Slot, imp.Hint, imp.Name)
+		}
+	}
+	d.printf("\n")
+}
+
+func (d *dumper) exports(f *File) {
+	d.printf("EXPORTS\n")
+	exps, err := f.Exports()
+	if err != nil {
+		d.fail(err)
+	}
+	if exps != nil {
+		d.printf("  %s (ordinal base %d)\n", exps.Name, exps.Base)
+		for _, e := range exps.Exports {
+			name := e.Name
+			if name == "" {
+				name = "[NONAME]"
+			}
+			if e.Forwarder != "" {
+				d.printf("    %5d %8s %s -> %s\n", e.Ordinal, "", name, e.Forwarder)
+			} else {
+				d.printf("    %5d %08x %s\n", e.Ordinal, e.RVA, name)
+			}
+		}
+	}
+	d.printf("\n")
+}
+
+func (d *dumper) relocs(f *File, syms []SymbolDescription) {
+	names := make(map[uint32]string, len(syms))
+	for _, s := range syms {
+		names[uint32(s.Index)] = s.Name
+	}
+	for _, s := range f.Sections {
+		if len(s.Relocs) == 0 {
+			continue
+		}
+		d.printf("RELOCATIONS %s\n", s.Name)
+		for _, r := range s.Relocs {
+			d.printf("  %08x %-28s %5d %s\n", r.VirtualAddress,
+				RelocTypeString(f.Machine, r.Type), r.SymbolTableIndex, names[r.SymbolTableIndex])
+		}
+		d.printf("\n")
+	}
+}
+
+func (d *dumper) symbols(syms []SymbolDescription) {
+	d.printf("SYMBOLS\n")
+	for _, s := range syms {
+		d.printf("  [%4d] sec %3d type %04x class %3d aux %d %08x %s\n", s.Index,
+			s.SectionNumber, s.Type, s.StorageClass, len(s.Aux), s.Value, s.Name)
+	}
+	d.printf("\n")
+}
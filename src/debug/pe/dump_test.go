@@ -0,0 +1,60 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	tests := []struct {
+		file  string
+		flags DumpFlags
+		want  []string
+		not   []string
+	}{
+		{
+			"testdata/gcc-amd64-mingw-exec", 0,
+			[]string{"OPTIONAL HEADER (PE32+)", "ImageBase            0x400000", " 1 Import ", "  KERNEL32.dll\n", " .text ", "SYMBOLS\n", " main\n"},
+			nil,
+		},
+		{
+			"testdata/gcc-amd64-mingw-obj", DumpRelocs,
+			[]string{"RELOCATIONS .text\n", "IMAGE_REL_AMD64_REL32", " puts\n"},
+			[]string{"FILE HEADER", "SYMBOLS", "IMPORTS"},
+		},
+		{
+			"testdata/gcc-386-mingw-exec", DumpHeaders | DumpImports,
+			[]string{"OPTIONAL HEADER (PE32)", "IMPORTS\n", "msvcrt.dll\n"},
+			[]string{"RELOCATIONS", "SYMBOLS"},
+		},
+	}
+	for _, tt := range tests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = Dump(&buf, f, &DumpOptions{Flags: tt.flags})
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		out := buf.String()
+		for _, s := range tt.want {
+			if !strings.Contains(out, s) {
+				t.Errorf("%s: output does not contain %q:\n%s", tt.file, s, out)
+			}
+		}
+		for _, s := range tt.not {
+			if strings.Contains(out, s) {
+				t.Errorf("%s: output contains %q", tt.file, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+// DWARF returns the DWARF debug information of f.
+// Sections compressed by GNU and LLVM tools, either under a
+// .zdebug_ name or with a compression header, are decompressed.
+// In AMD64, I386 and ARM64 object files, the relocations of the
+// debug sections are applied.
+func (f *File) DWARF() (*dwarf.Data, error) {
+	// There are many other DWARF sections, but these
+	// are the ones the debug/dwarf package uses.
+	// Don't bother loading others.
+	var names = [...]string{"abbrev", "info", "line", "ranges", "str"}
+	var dat [len(names)][]byte
+	for i, name := range names {
+		b, err := f.debugSection(name)
+		if err != nil {
+			return nil, err
+		}
+		dat[i] = b
+	}
+
+	abbrev, info, line, ranges, str := dat[0], dat[1], dat[2], dat[3], dat[4]
+	return dwarf.New(abbrev, nil, nil, info, line, nil, ranges, str)
+}
+
+// debugSection returns the contents of the DWARF section
+// .debug_name or .zdebug_name of f, decompressed and relocated,
+// or nil if f has no such section.
+func (f *File) debugSection(name string) ([]byte, error) {
+	s := f.Section(".debug_" + name)
+	if s == nil {
+		s = f.Section(".zdebug_" + name)
+	}
+	if s == nil {
+		return nil, nil
+	}
+	b, err := s.dwarfData()
+	if err != nil {
+		return nil, err
+	}
+	return f.relocateDWARF(s, b)
+}
+
+// dwarfData returns the contents of the DWARF section s,
+// without padding and decompressed.
+func (s *Section) dwarfData() ([]byte, error) {
+	b, err := s.Data()
+	if err != nil && uint32(len(b)) < s.Size {
+		return nil, err
+	}
+	if 0 < s.VirtualSize && s.VirtualSize < s.Size {
+		b = b[:s.VirtualSize]
+	}
+	b, err = decompressDWARF(s.Name, b)
+	if err != nil {
+		return nil, &FormatError{int64(s.Offset), "section " + s.Name, err, nil}
+	}
+	return b, nil
+}
+
+// relocateDWARF applies the relocations of the debug section s of
+// an object file to its contents b, as debug/elf does: references
+// to other debug sections become offsets in those sections, and
+// addresses become offsets in the section holding their symbol.
+// It returns b as is for images and unsupported machines.
+func (f *File) relocateDWARF(s *Section, b []byte) ([]byte, error) {
+	if f.OptionalHeader != nil || len(s.Relocs) == 0 {
+		return b, nil
+	}
+	switch f.Machine {
+	case IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386, IMAGE_FILE_MACHINE_ARM64:
+	default:
+		return b, nil
+	}
+	// Do not modify the data cached by s.
+	b = append([]byte(nil), b...)
+	if err := f.Relocate(s, b, &RelocateOptions{SymbolAddress: f.dwarfSymbolAddress}); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// dwarfSymbolAddress returns the address of symbol i for
+// relocateDWARF: its value, or 0 for undefined symbols.
+func (f *File) dwarfSymbolAddress(i uint32) (uint64, error) {
+	sym := &f.COFFSymbols[i]
+	section := int32(sym.SectionNumber)
+	if int(i) < len(f.COFFBigSymbols) {
+		section = f.COFFBigSymbols[i].SectionNumber
+	}
+	if section == 0 {
+		return 0, nil
+	}
+	return uint64(sym.Value), nil
+}
+
+// Compression types of ELF compression headers.
+const (
+	compressZlib = 1 // ELFCOMPRESS_ZLIB
+	compressZstd = 2 // ELFCOMPRESS_ZSTD
+)
+
+var errZstd = errors.New("zstd compressed DWARF is not supported")
+
+// decompressDWARF returns the decompressed contents of the DWARF
+// section name, whose contents are b. It recognizes the "ZLIB"
+// header that GNU tools put at the start of .zdebug_ sections,
+// and the ELF compression headers that LLVM and binutils write
+// with --compress-debug-sections. Uncompressed data is returned
+// as is.
+//
+// PE sections carry no flag marking them as compressed, so an
+// ELF header is only taken as such if the data it introduces
+// starts like a compressed stream.
+func decompressDWARF(name string, b []byte) ([]byte, error) {
+	if len(b) >= 12 && string(b[:4]) == "ZLIB" {
+		return inflate(b[12:], binary.BigEndian.Uint64(b[4:12]))
+	}
+	// Elf64_Chdr: type, reserved, size and alignment.
+	if len(b) >= 24 && binary.LittleEndian.Uint32(b[4:8]) == 0 && isAlignment(binary.LittleEndian.Uint64(b[16:24])) {
+		switch typ := binary.LittleEndian.Uint32(b[0:4]); {
+		case typ == compressZlib && isZlib(b[24:]):
+			return inflate(b[24:], binary.LittleEndian.Uint64(b[8:16]))
+		case typ == compressZstd && isZstd(b[24:]):
+			return nil, errZstd
+		}
+	}
+	// Elf32_Chdr: type, size and alignment.
+	if len(b) >= 12 && isAlignment(uint64(binary.LittleEndian.Uint32(b[8:12]))) {
+		switch typ := binary.LittleEndian.Uint32(b[0:4]); {
+		case typ == compressZlib && isZlib(b[12:]):
+			return inflate(b[12:], uint64(binary.LittleEndian.Uint32(b[4:8])))
+		case typ == compressZstd && isZstd(b[12:]):
+			return nil, errZstd
+		}
+	}
+	if strings.HasPrefix(name, ".zdebug_") {
+		return nil, errors.New("unknown compression format")
+	}
+	return b, nil
+}
+
+// isAlignment reports whether a is a plausible section alignment.
+func isAlignment(a uint64) bool {
+	return a != 0 && a <= 1<<16 && a&(a-1) == 0
+}
+
+// isZlib reports whether b starts with a zlib stream header.
+func isZlib(b []byte) bool {
+	return len(b) >= 2 && b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
+
+// isZstd reports whether b starts with a zstd frame.
+func isZstd(b []byte) bool {
+	return len(b) >= 4 && binary.LittleEndian.Uint32(b) == 0xfd2fb528
+}
+
+// inflate decompresses the zlib stream b,
+// which must hold exactly size bytes.
+func inflate(b []byte, size uint64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	// Do not trust size to preallocate: let the buffer
+	// grow with the data actually there.
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(r, int64(size&(1<<62-1))+1)); err != nil {
+		return nil, err
+	}
+	if uint64(buf.Len()) != size {
+		return nil, errors.New("decompressed size does not match header")
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
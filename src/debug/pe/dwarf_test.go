@@ -0,0 +1,185 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/dwarf"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compressSections replaces the DWARF sections of f with
+// copies compressed by compress, which also names them.
+func compressSections(t *testing.T, f *File, compress func(name string, b []byte) (string, []byte)) {
+	for i, s := range f.Sections {
+		if !strings.HasPrefix(s.Name, ".debug_") {
+			continue
+		}
+		b, err := s.dwarfData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write(b)
+		w.Close()
+		h := s.SectionHeader
+		var data []byte
+		h.Name, data = compress(s.Name, append(encodeUint64(uint64(len(b))), z.Bytes()...))
+		f.Sections[i] = NewSection(h, data)
+	}
+}
+
+func encodeUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+// dwarfEntries returns all the entries of d.
+func dwarfEntries(t *testing.T, d *dwarf.Data) []*dwarf.Entry {
+	var all []*dwarf.Entry
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			return all
+		}
+		all = append(all, e)
+	}
+}
+
+func TestCompressedDWARF(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := f.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := dwarfEntries(t, d)
+	if len(want) == 0 {
+		t.Fatal("no DWARF entries")
+	}
+
+	tests := []struct {
+		name     string
+		compress func(name string, b []byte) (string, []byte)
+	}{
+		{"zdebug", func(name string, b []byte) (string, []byte) {
+			binary.BigEndian.PutUint64(b, binary.LittleEndian.Uint64(b))
+			return ".z" + name[1:], append([]byte("ZLIB"), b...)
+		}},
+		{"elf64", func(name string, b []byte) (string, []byte) {
+			hdr := []byte{compressZlib, 0, 0, 0, 0, 0, 0, 0}
+			hdr = append(hdr, b[:8]...)
+			hdr = append(hdr, 1, 0, 0, 0, 0, 0, 0, 0)
+			return name, append(hdr, b[8:]...)
+		}},
+		{"elf32", func(name string, b []byte) (string, []byte) {
+			hdr := []byte{compressZlib, 0, 0, 0}
+			hdr = append(hdr, b[:4]...)
+			hdr = append(hdr, 1, 0, 0, 0)
+			return name, append(hdr, b[8:]...)
+		}},
+	}
+	for _, tt := range tests {
+		g, err := Open("testdata/gcc-amd64-mingw-exec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressSections(t, g, tt.compress)
+		d, err := g.DWARF()
+		g.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := dwarfEntries(t, d); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: DWARF entries differ", tt.name)
+		}
+	}
+
+	zstd := []byte{compressZstd, 0, 0, 0, 0, 0, 0, 0, 100, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0x28, 0xb5, 0x2f, 0xfd}
+	if _, err := decompressDWARF(".debug_info", zstd); err != errZstd {
+		t.Errorf("zstd section: got error %v, want %v", err, errZstd)
+	}
+	if _, err := decompressDWARF(".zdebug_info", []byte("ZLIB\x00\x00\x00\x00\x00\x00\x00\x10garbage")); err == nil {
+		t.Errorf("corrupt zlib section: no error")
+	}
+}
+
+func TestObjectDWARFRelocs(t *testing.T) {
+	tests := []struct {
+		machine      uint16
+		ptrSize      int
+		secrel, addr uint16
+	}{
+		{IMAGE_FILE_MACHINE_AMD64, 8, IMAGE_REL_AMD64_SECREL, IMAGE_REL_AMD64_ADDR64},
+		{IMAGE_FILE_MACHINE_I386, 4, IMAGE_REL_I386_SECREL, IMAGE_REL_I386_DIR32},
+		{IMAGE_FILE_MACHINE_ARM64, 8, IMAGE_REL_ARM64_SECREL, IMAGE_REL_ARM64_ADDR64},
+	}
+	for _, tt := range tests {
+		// A compile unit with a DW_FORM_strp name
+		// and a DW_FORM_addr low PC, both relocated.
+		abbrev := []byte{1, 0x11, 0, 0x03, 0x0e, 0x11, 0x01, 0, 0, 0}
+		info := []byte{0, 0, 0, 0, 4, 0, 0, 0, 0, 0, byte(tt.ptrSize), 1, 0, 0, 0, 0}
+		info = append(info, make([]byte, tt.ptrSize)...)
+		info[len(info)-tt.ptrSize] = 4 // addend
+		binary.LittleEndian.PutUint32(info, uint32(len(info)-4))
+		str := []byte("first\x00second\x00")
+		text := make([]byte, 0x20)
+
+		infoSec := NewSection(SectionHeader{Name: ".debug_info"}, info)
+		infoSec.Relocs = []Reloc{
+			{12, 4, tt.secrel},
+			{16, 1, tt.addr},
+		}
+		f := &File{
+			FileHeader: FileHeader{Machine: tt.machine},
+			Sections: []*Section{
+				NewSection(SectionHeader{Name: ".text"}, text),
+				NewSection(SectionHeader{Name: ".debug_abbrev"}, abbrev),
+				infoSec,
+				NewSection(SectionHeader{Name: ".debug_str"}, str),
+			},
+			COFFSymbols: []COFFSymbol{
+				{Name: [8]byte{'u'}, StorageClass: IMAGE_SYM_CLASS_EXTERNAL},
+				{Name: [8]byte{'f'}, Value: 0x10, SectionNumber: 1, StorageClass: IMAGE_SYM_CLASS_EXTERNAL},
+				{Name: [8]byte{'.', 't', 'e', 'x', 't'}, SectionNumber: 1, StorageClass: 3},
+				{Name: [8]byte{'.', 'd', 'e', 'b', 'u', 'g', '_', 's'}, SectionNumber: 4, StorageClass: 3},
+				{Name: [8]byte{'s', 'e', 'c', 'o', 'n', 'd'}, Value: 6, SectionNumber: 4, StorageClass: 3},
+			},
+		}
+		d, err := f.DWARF()
+		if err != nil {
+			t.Errorf("machine %#x: %v", tt.machine, err)
+			continue
+		}
+		e, err := d.Reader().Next()
+		if err != nil {
+			t.Errorf("machine %#x: %v", tt.machine, err)
+			continue
+		}
+		if name, _ := e.Val(dwarf.AttrName).(string); name != "second" {
+			t.Errorf("machine %#x: name = %q, want %q", tt.machine, name, "second")
+		}
+		if pc, _ := e.Val(dwarf.AttrLowpc).(uint64); pc != 0x14 {
+			t.Errorf("machine %#x: low PC = %#x, want %#x", tt.machine, pc, 0x14)
+		}
+		if !bytes.Equal(info[12:16], []byte{0, 0, 0, 0}) {
+			t.Errorf("machine %#x: section data modified", tt.machine)
+		}
+	}
+}
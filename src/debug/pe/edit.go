@@ -0,0 +1,183 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+)
+
+// unsignedImage returns the contents of the underlying file of f,
+// which must be a PE image, without its attribute certificate
+// table, which must be at the end of the file. The security data
+// directory of the contents is cleared. caller names the function
+// to blame in errors.
+func (f *File) unsignedImage(caller string) ([]byte, error) {
+	if f.imageLayout {
+		return nil, errors.New("pe: " + caller + " called on a loaded image")
+	}
+	oh := f.optionalHeader()
+	if oh == nil || f.TEHeader != nil {
+		return nil, errors.New("pe: " + caller + " called on a file that is not a PE image")
+	}
+	// Short optional headers, found in firmware,
+	// may stop before the security data directory.
+	if oh.numberOfRvaAndSizes <= IMAGE_DIRECTORY_ENTRY_SECURITY || int(f.base)+20+int(f.SizeOfOptionalHeader) < f.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_SECURITY+1) {
+		return nil, errors.New("pe: optional header has no security data directory")
+	}
+	r, err := f.fileReader()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if off, size := f.certificateTable(); off != 0 {
+		if int64(off)+int64(size) != int64(len(b)) {
+			return nil, &FormatError{int64(off), "certificate table", errors.New("not at the end of the file"), size}
+		}
+		b = b[:off]
+		f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_SECURITY, DataDirectory{})
+	}
+	return b, nil
+}
+
+// The offsets of fields of the optional header
+// that are the same in PE32 and PE32+.
+const (
+	ohSizeOfCode              = 4
+	ohSizeOfInitializedData   = 8
+	ohSizeOfUninitializedData = 12
+	ohSizeOfImage             = 56
+	ohSizeOfHeaders           = 60
+	ohCheckSum                = 64
+)
+
+// dataDirectoryOffset returns the file offset of data directory i.
+// The directories start at offset 96 of the optional header in PE32
+// and 112 in PE32+; the optional header follows the file header.
+func (f *File) dataDirectoryOffset(i int) int {
+	off := int(f.base) + 20 + 96 + 8*i
+	if f.optionalHeader().pe64 {
+		off += 16
+	}
+	return off
+}
+
+// setDataDirectory sets data directory i in b, the contents
+// of the image f, which must have that directory.
+func (f *File) setDataDirectory(b []byte, i int, dd DataDirectory) {
+	off := f.dataDirectoryOffset(i)
+	binary.LittleEndian.PutUint32(b[off:], dd.VirtualAddress)
+	binary.LittleEndian.PutUint32(b[off+4:], dd.Size)
+}
+
+// setChecksum sets the CheckSum field of b,
+// the contents of the image f, for its contents.
+func (f *File) setChecksum(b []byte) {
+	off := int(f.base) + 20 + ohCheckSum
+	binary.LittleEndian.PutUint32(b[off:], checksum(b, off))
+}
+
+// checksum returns the image checksum of the file b, whose CheckSum
+// field is at offset off, as computed by CheckSumMappedFile: the
+// 16-bit one's complement sum of the file, skipping the field, plus
+// the size of the file.
+func checksum(b []byte, off int) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 2 {
+		if i == off || i == off+2 {
+			continue
+		}
+		w := uint32(b[i])
+		if i+1 < len(b) {
+			w |= uint32(b[i+1]) << 8
+		}
+		sum += w
+		sum = sum&0xffff + sum>>16
+	}
+	return sum + uint32(len(b))
+}
+
+// nextSectionRVA returns the relative virtual address
+// of a section added after the last one of the image f.
+func (f *File) nextSectionRVA() int64 {
+	oh := f.optionalHeader()
+	va := int64(oh.sizeOfImage)
+	for _, s := range f.Sections {
+		if end := int64(s.VirtualAddress) + s.virtualSize(); end > va {
+			va = end
+		}
+	}
+	return alignUp(va, oh.sectionAlignment)
+}
+
+// addSection appends a section named name, with contents c and
+// characteristics chars, to b, the contents of the image f returned
+// by unsignedImage, and returns the new contents. The section is at
+// va, as returned by nextSectionRVA. Its header goes after the last
+// one, in space left free in the headers, where the bound import
+// directory, which is then cleared, is often found. NumberOfSections,
+// SizeOfImage and SizeOfInitializedData are updated.
+func (f *File) addSection(b []byte, name string, va int64, c []byte, chars uint32) ([]byte, error) {
+	oh := f.optionalHeader()
+	if len(f.Sections) >= 0xffff {
+		return nil, errors.New("pe: too many sections")
+	}
+	if err := checkFileAlignment(oh.fileAlignment); err != nil {
+		return nil, err
+	}
+	sectab := int64(f.base) + 20 + int64(f.SizeOfOptionalHeader)
+	sh := sectab + 40*int64(len(f.Sections))
+	limit := int64(oh.sizeOfHeaders)
+	for _, s := range f.Sections {
+		if s.Offset != 0 && s.Size != 0 && int64(s.Offset) < limit {
+			limit = int64(s.Offset)
+		}
+	}
+	errNoRoom := errors.New("pe: no room in the headers for a new section header")
+	if sh+40 > limit || sh+40 > int64(len(b)) {
+		return nil, errNoRoom
+	}
+	// The bound import directory is in the headers, so
+	// its VirtualAddress is also a file offset.
+	bound := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT)
+	bstart, bend := int64(bound.VirtualAddress), int64(bound.VirtualAddress)+int64(bound.Size)
+	for i := sh; i < sh+40; i++ {
+		if b[i] != 0 && (i < bstart || i >= bend) {
+			return nil, errNoRoom
+		}
+	}
+	if bstart < sh+40 && bend > sh {
+		f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT, DataDirectory{})
+	}
+
+	raw := alignUp(int64(len(b)), oh.fileAlignment)
+	rawSize := alignUp(int64(len(c)), oh.fileAlignment)
+	if va+int64(len(c)) > 1<<32-1 || raw+rawSize > 1<<32-1 {
+		return nil, errors.New("pe: image too large for a new section")
+	}
+	h := b[sh : sh+40]
+	for i := range h {
+		h[i] = 0
+	}
+	copy(h[0:8], name)
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(c)))
+	binary.LittleEndian.PutUint32(h[12:], uint32(va))
+	binary.LittleEndian.PutUint32(h[16:], uint32(rawSize))
+	binary.LittleEndian.PutUint32(h[20:], uint32(raw))
+	binary.LittleEndian.PutUint32(h[36:], chars)
+	binary.LittleEndian.PutUint16(b[f.base+2:], uint16(len(f.Sections)+1))
+	ohoff := int64(f.base) + 20
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfImage:], uint32(alignUp(va+int64(len(c)), oh.sectionAlignment)))
+	initialized := binary.LittleEndian.Uint32(b[ohoff+ohSizeOfInitializedData:])
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfInitializedData:], initialized+uint32(rawSize))
+
+	b = append(b, make([]byte, raw-int64(len(b)))...)
+	b = append(b, c...)
+	return append(b, make([]byte, rawSize-int64(len(c)))...), nil
+}
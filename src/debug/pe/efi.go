@@ -0,0 +1,34 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+// IsEFI reports whether f is a UEFI image, in PE or TE format:
+// an EFI application, boot service driver, runtime driver or
+// option ROM, according to the subsystem in its optional header.
+func (f *File) IsEFI() bool {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return false
+	}
+	switch oh.subsystem {
+	case IMAGE_SUBSYSTEM_EFI_APPLICATION, IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER,
+		IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER, IMAGE_SUBSYSTEM_EFI_ROM:
+		return true
+	}
+	return false
+}
+
+// EntrySection returns the section holding the entry point of the
+// image f, or nil if f has no entry point or it lies in no section.
+// Firmware drivers are often linked with all code and data in one
+// section, so the name of the section says little; EntrySection
+// finds it by address.
+func (f *File) EntrySection() *Section {
+	oh := f.optionalHeader()
+	if oh == nil || oh.addressOfEntryPoint == 0 {
+		return nil
+	}
+	return f.sectionForRVA(oh.addressOfEntryPoint)
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// makeEFI turns the PE32+ image in file into an EFI application
+// with the given file and section alignment and number of data
+// directories, as firmware toolchains produce.
+func makeEFI(t *testing.T, file string, align uint32, ndirs int) []byte {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := f.HeaderLayout()
+	oh := raw[l.OptionalHeader.Offset:]
+	binary.LittleEndian.PutUint16(oh[68:], IMAGE_SUBSYSTEM_EFI_APPLICATION)
+	if align != 0 {
+		binary.LittleEndian.PutUint32(oh[32:], align)
+		binary.LittleEndian.PutUint32(oh[36:], align)
+	}
+	if ndirs == 16 {
+		return raw
+	}
+	// Drop the last data directories and move
+	// the section table up to follow the others.
+	size := int64(sizeofOptionalHeader64) - 8*int64(16-ndirs)
+	binary.LittleEndian.PutUint32(oh[108:], uint32(ndirs))
+	binary.LittleEndian.PutUint16(raw[l.FileHeader.Offset+16:], uint16(size))
+	out := append([]byte(nil), raw[:l.OptionalHeader.Offset+size]...)
+	out = append(out, raw[l.SectionTable.Offset:l.SectionTable.End()]...)
+	out = append(out, make([]byte, l.OptionalHeader.Size-size)...)
+	return append(out, raw[l.SectionTable.End():]...)
+}
+
+func TestEFI(t *testing.T) {
+	const file = "testdata/gcc-amd64-mingw-exec"
+	pf, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pf.Close()
+	if pf.IsEFI() {
+		t.Errorf("%s: IsEFI = true", file)
+	}
+	pimps, err := pf.ImportedLibraries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		align uint32
+		ndirs int
+	}{
+		{"plain", 0, 16},
+		{"aligned32", 32, 16},
+		{"dirs6", 0, 6},
+		{"aligned32dirs2", 32, 2},
+	}
+	for _, tt := range tests {
+		b := makeEFI(t, file, tt.align, tt.ndirs)
+		f, err := NewFileWithOptions(bytes.NewReader(b), &Options{Mode: ParseStrict})
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !f.IsEFI() {
+			t.Errorf("%s: IsEFI = false", tt.name)
+		}
+		oh, ok := f.OptionalHeader.(*OptionalHeader64)
+		if !ok {
+			t.Errorf("%s: OptionalHeader is %T", tt.name, f.OptionalHeader)
+			continue
+		}
+		if oh.NumberOfRvaAndSizes != uint32(tt.ndirs) {
+			t.Errorf("%s: NumberOfRvaAndSizes = %d, want %d", tt.name, oh.NumberOfRvaAndSizes, tt.ndirs)
+		}
+		s := f.EntrySection()
+		if s == nil || s.Name != ".text" {
+			t.Errorf("%s: EntrySection = %v, want .text", tt.name, s)
+		}
+		imps, err := f.ImportedLibraries()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.ndirs > IMAGE_DIRECTORY_ENTRY_IMPORT && len(imps) != len(pimps) {
+			t.Errorf("%s: imported libraries = %q, want %q", tt.name, imps, pimps)
+		}
+		if tt.ndirs <= IMAGE_DIRECTORY_ENTRY_IMPORT && len(imps) != 0 {
+			t.Errorf("%s: imported libraries = %q, want none", tt.name, imps)
+		}
+	}
+}
+
+func TestEFITE(t *testing.T) {
+	_, te := makeTE(t, "testdata/gcc-amd64-mingw-exec")
+	te[5] = IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER
+	f, err := NewFile(bytes.NewReader(te))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.IsEFI() {
+		t.Error("IsEFI = false")
+	}
+	if s := f.EntrySection(); s == nil || s.Name != ".text" {
+		t.Errorf("EntrySection = %v, want .text", s)
+	}
+}
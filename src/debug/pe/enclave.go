@@ -0,0 +1,154 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Enclave policy and image flags and the ways
+// enclave imports match the images they name.
+const (
+	IMAGE_ENCLAVE_POLICY_DEBUGGABLE = 0x00000001
+
+	IMAGE_ENCLAVE_FLAG_PRIMARY_IMAGE = 0x00000001
+
+	IMAGE_ENCLAVE_IMPORT_MATCH_NONE      = 0
+	IMAGE_ENCLAVE_IMPORT_MATCH_UNIQUE_ID = 1
+	IMAGE_ENCLAVE_IMPORT_MATCH_AUTHOR_ID = 2
+	IMAGE_ENCLAVE_IMPORT_MATCH_FAMILY_ID = 3
+	IMAGE_ENCLAVE_IMPORT_MATCH_IMAGE_ID  = 4
+)
+
+// An EnclaveConfig is the configuration of an image that runs in
+// an enclave, such as an Intel SGX or VBS enclave
+// (IMAGE_ENCLAVE_CONFIG32 or IMAGE_ENCLAVE_CONFIG64).
+type EnclaveConfig struct {
+	Size                      uint32
+	MinimumRequiredConfigSize uint32
+	PolicyFlags               uint32 // IMAGE_ENCLAVE_POLICY_* flags
+	FamilyID                  [16]byte
+	ImageID                   [16]byte
+	ImageVersion              uint32
+	SecurityVersion           uint32
+	EnclaveSize               uint64
+	NumberOfThreads           uint32
+	EnclaveFlags              uint32 // IMAGE_ENCLAVE_FLAG_* flags
+
+	// Imports lists the images the enclave may load,
+	// from the ImportList of the configuration.
+	Imports []EnclaveImport
+}
+
+// An EnclaveImport is an image an enclave may load
+// (IMAGE_ENCLAVE_IMPORT), which must match the
+// identifiers that MatchType selects.
+type EnclaveImport struct {
+	MatchType              uint32 // IMAGE_ENCLAVE_IMPORT_MATCH_* value
+	MinimumSecurityVersion uint32
+	UniqueOrAuthorID       [32]byte
+	FamilyID               [16]byte
+	ImageID                [16]byte
+	Name                   string // from the ImportName RVA
+}
+
+// Sizes of the enclave structures, as far as this package knows them.
+const (
+	maxEnclaveConfigSize = 80
+	enclaveImportSize    = 80
+)
+
+// bytes reads len(p) bytes into p, leaving
+// as zero those past the end of the structure.
+func (r *loadConfigReader) bytes(p []byte) {
+	if r.off < len(r.b) {
+		copy(p, r.b[r.off:])
+	}
+	r.off += len(p)
+}
+
+// EnclaveConfig returns the enclave configuration that the
+// load configuration of f points to, or nil if f has none.
+func (f *File) EnclaveConfig() (*EnclaveConfig, error) {
+	lc, err := f.LoadConfig()
+	if lc == nil || lc.EnclaveConfigurationPointer == 0 || err != nil {
+		return nil, err
+	}
+	rva, err := f.loadConfigRVA(lc.EnclaveConfigurationPointer, "enclave configuration")
+	if err != nil {
+		return nil, err
+	}
+	oh := f.optionalHeader()
+	var sz [4]byte
+	if err := f.readRVA(sz[:], rva); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(sz[:])
+	if n > maxEnclaveConfigSize {
+		n = maxEnclaveConfigSize
+	}
+	if n < 24 {
+		return nil, &FormatError{-1, "enclave configuration", ErrTruncated, n}
+	}
+	b := make([]byte, n)
+	if err := f.readRVA(b, rva); err != nil {
+		return nil, err
+	}
+	r := &loadConfigReader{b: b, pe64: oh.pe64}
+	ec := &EnclaveConfig{
+		Size:                      r.u32(),
+		MinimumRequiredConfigSize: r.u32(),
+		PolicyFlags:               r.u32(),
+	}
+	count := r.u32()
+	list := r.u32()
+	entrySize := r.u32()
+	r.bytes(ec.FamilyID[:])
+	r.bytes(ec.ImageID[:])
+	ec.ImageVersion = r.u32()
+	ec.SecurityVersion = r.u32()
+	ec.EnclaveSize = r.ptr()
+	ec.NumberOfThreads = r.u32()
+	ec.EnclaveFlags = r.u32()
+	if count == 0 {
+		return ec, nil
+	}
+
+	if entrySize == 0 {
+		return nil, &FormatError{-1, "enclave import list", errors.New("zero entry size"), nil}
+	}
+	// The count comes from the file, so check that
+	// the list fits in the image before allocating.
+	if uint64(list)+uint64(count)*uint64(entrySize) > uint64(oh.sizeOfImage) {
+		return nil, &FormatError{-1, "enclave import list", ErrOutOfBounds, count}
+	}
+	// Entries may be larger than this package knows;
+	// the fields it does not know are skipped.
+	n = entrySize
+	if n > enclaveImportSize {
+		n = enclaveImportSize
+	}
+	ec.Imports = make([]EnclaveImport, count)
+	for i := range ec.Imports {
+		b := make([]byte, n)
+		if err := f.readRVA(b, list+uint32(i)*entrySize); err != nil {
+			return nil, err
+		}
+		r := &loadConfigReader{b: b}
+		imp := &ec.Imports[i]
+		imp.MatchType = r.u32()
+		imp.MinimumSecurityVersion = r.u32()
+		r.bytes(imp.UniqueOrAuthorID[:])
+		r.bytes(imp.FamilyID[:])
+		r.bytes(imp.ImageID[:])
+		if name := r.u32(); name != 0 {
+			if imp.Name, err = f.readStringRVA(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ec, nil
+}
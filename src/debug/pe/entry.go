@@ -0,0 +1,75 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "encoding/binary"
+
+// EntryPoint describes the entry point of an image.
+type EntryPoint struct {
+	RVA     uint32   // AddressOfEntryPoint
+	VA      uint64   // address of the entry point at the preferred image base
+	Section *Section // section holding the entry point, or nil
+	Offset  int64    // file offset of the entry point, or -1 if the file holds no data for it
+	Code    []byte   // first bytes at the entry point, as loaded
+
+	// CLR reports whether the image is a .NET assembly, with
+	// a CLR runtime header. The entry point of such an image
+	// is a stub that jumps to _CorExeMain or _CorDllMain in
+	// mscoree.dll, and says nothing about the managed code.
+	CLR bool
+
+	// Thunk is the relative virtual address of the import
+	// address table slot through which the stub at the entry
+	// point of a .NET assembly jumps, or 0 if the entry point
+	// is not such a stub.
+	Thunk uint32
+}
+
+// EntryPoint returns the entry point of the image f, with its
+// first n bytes of code, or fewer if the image ends sooner.
+// It returns nil if f has no entry point: object files have none,
+// and DLLs and .NET assemblies for 64-bit targets may do without.
+func (f *File) EntryPoint(n int) (*EntryPoint, error) {
+	oh := f.optionalHeader()
+	if oh == nil || oh.addressOfEntryPoint == 0 {
+		return nil, nil
+	}
+	rva := oh.addressOfEntryPoint
+	if rva >= oh.sizeOfImage {
+		return nil, &FormatError{-1, "entry point", ErrOutOfBounds, rva}
+	}
+	e := &EntryPoint{
+		RVA:     rva,
+		VA:      oh.imageBase + uint64(rva),
+		Section: f.sectionForRVA(rva),
+		Offset:  -1,
+		CLR:     oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR).VirtualAddress != 0,
+	}
+	switch s := e.Section; {
+	case s != nil:
+		if off := rva - s.VirtualAddress; s.Offset != 0 && off < s.Size {
+			e.Offset = int64(s.Offset) + int64(off)
+		}
+	case rva < oh.sizeOfHeaders:
+		// The headers are mapped at the same offset as in the file.
+		e.Offset = int64(rva)
+	}
+	if max := oh.sizeOfImage - rva; n > 0 && uint64(n) > uint64(max) {
+		n = int(max)
+	}
+	code, err := f.ReadRVA(rva, n)
+	if err != nil {
+		return nil, err
+	}
+	e.Code = code
+	if e.CLR && !oh.pe64 && len(code) >= 6 && code[0] == 0xff && code[1] == 0x25 {
+		// jmp dword ptr [addr], with addr the absolute
+		// address of the import address table slot.
+		if va := uint64(binary.LittleEndian.Uint32(code[2:])); va >= oh.imageBase && va-oh.imageBase < uint64(oh.sizeOfImage) {
+			e.Thunk = uint32(va - oh.imageBase)
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEntryPoint(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := f.EntryPoint(16)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		s := f.EntrySection()
+		if e == nil || e.Section != s || s == nil || e.CLR || e.Thunk != 0 {
+			t.Fatalf("%s: EntryPoint = %+v, want one in section %v", file, e, s)
+		}
+		data, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		off := e.RVA - s.VirtualAddress
+		if e.Offset != int64(s.Offset+off) || !bytes.Equal(e.Code, data[off:off+16]) {
+			t.Errorf("%s: entry point at offset %#x, code %x; want %#x, %x", file, e.Offset, e.Code, s.Offset+off, data[off:off+16])
+		}
+		if e.VA != f.imageBase()+uint64(e.RVA) {
+			t.Errorf("%s: entry point at address %#x, RVA %#x", file, e.VA, e.RVA)
+		}
+		f.Close()
+	}
+
+	// A .NET assembly for x86 enters through jmp [_CorExeMain].
+	text := []byte{0xcc, 0xcc, 0xff, 0x25, 0x00, 0x20, 0x40, 0x00}
+	oh := &OptionalHeader32{AddressOfEntryPoint: 0x1002, ImageBase: 0x400000, SizeOfImage: 0x3000, NumberOfRvaAndSizes: 16}
+	oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR] = DataDirectory{0x2008, 0x48}
+	f := &File{
+		OptionalHeader: oh,
+		Sections: []*Section{
+			NewSection(SectionHeader{Name: ".text", VirtualAddress: 0x1000, VirtualSize: 0x1000}, text),
+			NewSection(SectionHeader{Name: ".rdata", VirtualAddress: 0x2000, VirtualSize: 0x1000}, make([]byte, 0x50)),
+		},
+	}
+	e, err := f.EntryPoint(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.CLR || e.Thunk != 0x2000 || e.Offset != -1 || len(e.Code) != 64 || !bytes.Equal(e.Code[:6], text[2:]) {
+		t.Errorf(".NET stub: EntryPoint = %+v", e)
+	}
+
+	// The code is cut off at the end of the image.
+	oh.AddressOfEntryPoint = 0x2ff8
+	if e, err := f.EntryPoint(64); err != nil || len(e.Code) != 8 || e.Thunk != 0 {
+		t.Errorf("EntryPoint near the end of the image = %+v, %v", e, err)
+	}
+	oh.AddressOfEntryPoint = 0x3000
+	if e, err := f.EntryPoint(64); err == nil {
+		t.Errorf("EntryPoint past the end of the image = %+v", e)
+	}
+
+	// DLLs and .NET assemblies for x64 may have no entry point.
+	oh.AddressOfEntryPoint = 0
+	if e, err := f.EntryPoint(64); e != nil || err != nil {
+		t.Errorf("EntryPoint of an image without one = %+v, %v", e, err)
+	}
+}
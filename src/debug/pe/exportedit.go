@@ -0,0 +1,197 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// exportOrdinals returns the ordinal base of d and the exports of d
+// indexed by ordinal minus the base, nil for unused ordinals. Exports
+// with a zero Ordinal get the lowest unused ordinals. If d.Base is
+// zero, the base is the lowest ordinal given, or 1.
+func (d *ExportDirectory) exportOrdinals() (uint32, []*Export, error) {
+	base := d.Base
+	if base == 0 {
+		for _, e := range d.Exports {
+			if e.Ordinal != 0 && (base == 0 || uint32(e.Ordinal) < base) {
+				base = uint32(e.Ordinal)
+			}
+		}
+		if base == 0 {
+			base = 1
+		}
+	}
+	var table []*Export
+	names := make(map[string]bool)
+	var unordered []*Export
+	for i := range d.Exports {
+		e := &d.Exports[i]
+		if e.RVA == 0 && e.Forwarder == "" || e.RVA != 0 && e.Forwarder != "" {
+			return 0, nil, fmt.Errorf("pe: export %s must have either an RVA or a forwarder", exportKey(*e))
+		}
+		if e.Name != "" {
+			if names[e.Name] {
+				return 0, nil, fmt.Errorf("pe: duplicate export %s", e.Name)
+			}
+			names[e.Name] = true
+		}
+		if e.Ordinal == 0 {
+			unordered = append(unordered, e)
+			continue
+		}
+		if uint32(e.Ordinal) < base {
+			return 0, nil, fmt.Errorf("pe: export %s has an ordinal below the base %d", exportKey(*e), base)
+		}
+		i := int(uint32(e.Ordinal) - base)
+		for len(table) <= i {
+			table = append(table, nil)
+		}
+		if table[i] != nil {
+			return 0, nil, fmt.Errorf("pe: duplicate export ordinal %d", e.Ordinal)
+		}
+		table[i] = e
+	}
+	i := 0
+	for _, e := range unordered {
+		for i < len(table) && table[i] != nil {
+			i++
+		}
+		if base+uint32(i) > 0xffff {
+			return 0, nil, errors.New("pe: too many exports")
+		}
+		if i == len(table) {
+			table = append(table, nil)
+		}
+		table[i] = e
+	}
+	return base, table, nil
+}
+
+// encode lays out d as an export directory at the relative virtual
+// address rva: the directory table, the export address table, the
+// name pointer and ordinal tables, then the DLL name, the names of
+// the exports and the forwarder strings.
+func (d *ExportDirectory) encode(rva uint32) ([]byte, error) {
+	base, table, err := d.exportOrdinals()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	ordinals := make(map[string]uint16)
+	for i, e := range table {
+		if e != nil && e.Name != "" {
+			names = append(names, e.Name)
+			ordinals[e.Name] = uint16(i)
+		}
+	}
+	// The loader looks names up by binary search.
+	sort.Strings(names)
+
+	eat := int64(40)
+	npt := eat + 4*int64(len(table))
+	ot := npt + 4*int64(len(names))
+	off := ot + 2*int64(len(names))
+	strs := make(map[string]int64)
+	addString := func(s string) {
+		if _, ok := strs[s]; !ok {
+			strs[s] = off
+			off += int64(len(s)) + 1
+		}
+	}
+	addString(d.Name)
+	for _, name := range names {
+		addString(name)
+	}
+	for _, e := range table {
+		if e != nil && e.Forwarder != "" {
+			addString(e.Forwarder)
+		}
+	}
+	if int64(rva)+off > 1<<32-1 {
+		return nil, errors.New("pe: export directory too large")
+	}
+
+	b := make([]byte, off)
+	binary.LittleEndian.PutUint32(b[4:], d.TimeDateStamp)
+	binary.LittleEndian.PutUint32(b[12:], rva+uint32(strs[d.Name]))
+	binary.LittleEndian.PutUint32(b[16:], base)
+	binary.LittleEndian.PutUint32(b[20:], uint32(len(table)))
+	binary.LittleEndian.PutUint32(b[24:], uint32(len(names)))
+	binary.LittleEndian.PutUint32(b[28:], rva+uint32(eat))
+	binary.LittleEndian.PutUint32(b[32:], rva+uint32(npt))
+	binary.LittleEndian.PutUint32(b[36:], rva+uint32(ot))
+	for i, e := range table {
+		switch {
+		case e == nil:
+		case e.Forwarder != "":
+			binary.LittleEndian.PutUint32(b[eat+4*int64(i):], rva+uint32(strs[e.Forwarder]))
+		default:
+			binary.LittleEndian.PutUint32(b[eat+4*int64(i):], e.RVA)
+		}
+	}
+	for i, name := range names {
+		binary.LittleEndian.PutUint32(b[npt+4*int64(i):], rva+uint32(strs[name]))
+		binary.LittleEndian.PutUint16(b[ot+2*int64(i):], ordinals[name])
+	}
+	for s, soff := range strs {
+		copy(b[soff:], s)
+	}
+	return b, nil
+}
+
+// NewExportSection returns a .edata section holding the export
+// directory d, for an image in which the section is at the relative
+// virtual address rva. The export data directory must cover the whole
+// section, since the addresses of forwarded exports point to their
+// forwarder strings in it. Exports with a zero Ordinal get the lowest
+// unused ordinals, and if d.Base is zero, the ordinal base is the
+// lowest ordinal in d, or 1. The name pointer table is sorted, as the
+// loader requires. The VirtualSize and Size of the section are the
+// size of its contents, which the caller may need to align.
+func NewExportSection(d *ExportDirectory, rva uint32) (*Section, error) {
+	b, err := d.encode(rva)
+	if err != nil {
+		return nil, err
+	}
+	return NewSection(SectionHeader{
+		Name:            ".edata",
+		VirtualSize:     uint32(len(b)),
+		VirtualAddress:  rva,
+		Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ,
+	}, b), nil
+}
+
+// WriteWithExports writes the image f to w with its export
+// directory replaced by d, as when making a proxy DLL that forwards
+// the exports of another. The directory is built as by
+// NewExportSection in a new .edata section, added as by
+// WriteWithImports, and the checksum is updated. The old export
+// directory, if any, is left in place, unreferenced.
+func (f *File) WriteWithExports(w io.Writer, d *ExportDirectory) error {
+	b, err := f.unsignedImage("WriteWithExports")
+	if err != nil {
+		return err
+	}
+	va := f.nextSectionRVA()
+	if va > 1<<32-1 {
+		return errors.New("pe: image too large for a new section")
+	}
+	c, err := d.encode(uint32(va))
+	if err != nil {
+		return err
+	}
+	if b, err = f.addSection(b, ".edata", va, c, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ); err != nil {
+		return err
+	}
+	f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_EXPORT, DataDirectory{VirtualAddress: uint32(va), Size: uint32(len(c))})
+	f.setChecksum(b)
+	_, err = w.Write(b)
+	return err
+}
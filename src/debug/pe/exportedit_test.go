@@ -0,0 +1,117 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestWriteWithExports(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := &ExportDirectory{
+		Name:          "proxy.dll",
+		TimeDateStamp: 0x5a000000,
+		Exports: []Export{
+			{Name: "Foo", RVA: 0x1000},
+			{Name: "Bar", Forwarder: "real.Bar"},
+			{Ordinal: 10, RVA: 0x1010},
+			{Name: "alpha", RVA: 0x1020},
+			{Name: "Zed", Ordinal: 14, Forwarder: "real.#3"},
+		},
+	}
+	var buf bytes.Buffer
+	if err := f.WriteWithExports(&buf, d); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFileWithOptions(bytes.NewReader(buf.Bytes()), &Options{Mode: ParseStrict})
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := g.Exports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ExportDirectory{
+		Name:          "proxy.dll",
+		TimeDateStamp: 0x5a000000,
+		Base:          10,
+		Exports: []Export{
+			{Ordinal: 10, RVA: 0x1010},
+			{Name: "Foo", Ordinal: 11, RVA: 0x1000},
+			{Name: "Bar", Ordinal: 12, Forwarder: "real.Bar"},
+			{Name: "alpha", Ordinal: 13, RVA: 0x1020},
+			{Name: "Zed", Ordinal: 14, Forwarder: "real.#3"},
+		},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("Exports = %+v, want %+v", have, want)
+	}
+
+	// The name pointer table is in byte order.
+	dd := g.optionalHeader().dataDirectory(IMAGE_DIRECTORY_ENTRY_EXPORT)
+	var hdr [40]byte
+	if err := g.readRVA(hdr[:], dd.VirtualAddress); err != nil {
+		t.Fatal(err)
+	}
+	ptrs, err := g.readRVAUint32s(binary.LittleEndian.Uint32(hdr[32:]), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range ptrs {
+		name, err := g.readStringRVA(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if want := []string{"Bar", "Foo", "Zed", "alpha"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("name pointer table %q, want %q", names, want)
+	}
+	if e, ok := have.Lookup("alpha"); !ok || e.Ordinal != 13 {
+		t.Errorf("Lookup(alpha) = %+v, %v", e, ok)
+	}
+	if have, want := headerChecksum(t, buf.Bytes()); have != want {
+		t.Errorf("CheckSum = %#x, want %#x", have, want)
+	}
+}
+
+func TestExportDirectoryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		d    ExportDirectory
+	}{
+		{"duplicate name", ExportDirectory{Exports: []Export{{Name: "F", RVA: 1}, {Name: "F", RVA: 2}}}},
+		{"duplicate ordinal", ExportDirectory{Exports: []Export{{Ordinal: 2, RVA: 1}, {Ordinal: 2, RVA: 2}}}},
+		{"no address", ExportDirectory{Exports: []Export{{Name: "F"}}}},
+		{"address and forwarder", ExportDirectory{Exports: []Export{{Name: "F", RVA: 1, Forwarder: "a.F"}}}},
+		{"ordinal below base", ExportDirectory{Base: 5, Exports: []Export{{Ordinal: 4, RVA: 1}}}},
+		{"too many", ExportDirectory{Exports: []Export{{Ordinal: 0xffff, RVA: 1}, {Name: "F", RVA: 1}, {Name: "G", RVA: 1}}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewExportSection(&tt.d, 0x1000); err == nil {
+			t.Errorf("%s: NewExportSection succeeded", tt.name)
+		}
+	}
+
+	s, err := NewExportSection(&ExportDirectory{Name: "a.dll", Exports: []Export{{Name: "F", RVA: 0x2000}}}, 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != ".edata" || s.VirtualAddress != 0x1000 || s.VirtualSize != s.Size {
+		t.Errorf("section header %+v", s.SectionHeader)
+	}
+	if b, _ := ioutil.ReadAll(s.Open()); len(b) != int(s.Size) {
+		t.Errorf("read %d bytes of data, want %d", len(b), s.Size)
+	}
+}
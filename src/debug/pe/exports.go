@@ -0,0 +1,350 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// An Export is a function or variable exported by a PE image.
+type Export struct {
+	Name    string // empty if exported by ordinal only
+	Ordinal uint16
+	RVA     uint32 // address of the export; zero for forwarders
+
+	// Forwarder, if not empty, names the export of another DLL
+	// that this export is forwarded to, in the form "DLL.Name"
+	// or "DLL.#Ordinal", where DLL has no ".dll" extension.
+	Forwarder string
+}
+
+// ExportDirectory is the parsed export directory of a PE image.
+type ExportDirectory struct {
+	Name          string // name of the DLL, as recorded by the linker
+	TimeDateStamp uint32
+	Base          uint32 // ordinal of the first entry of the export address table
+	Exports       []Export
+}
+
+// maxExports limits the size of the export address
+// and name tables read from malformed files.
+const maxExports = 1 << 20
+
+// Exports returns the export directory of f,
+// or nil if f does not export anything.
+// Exports are sorted by ordinal.
+func (f *File) Exports() (*ExportDirectory, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if dd.VirtualAddress == 0 {
+		return nil, nil
+	}
+	var hdr [40]byte
+	if err := f.readRVA(hdr[:], dd.VirtualAddress); err != nil {
+		return nil, err
+	}
+	d := &ExportDirectory{
+		TimeDateStamp: binary.LittleEndian.Uint32(hdr[4:8]),
+		Base:          binary.LittleEndian.Uint32(hdr[16:20]),
+	}
+	name, err := f.readStringRVA(binary.LittleEndian.Uint32(hdr[12:16]))
+	if err != nil {
+		return nil, err
+	}
+	d.Name = name
+	nfuncs := binary.LittleEndian.Uint32(hdr[20:24])
+	nnames := binary.LittleEndian.Uint32(hdr[24:28])
+	if nfuncs > maxExports || nnames > maxExports {
+		return nil, &FormatError{-1, "export directory", ErrOutOfBounds, nfuncs}
+	}
+	funcs, err := f.readRVAUint32s(binary.LittleEndian.Uint32(hdr[28:32]), nfuncs)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.readRVAUint32s(binary.LittleEndian.Uint32(hdr[32:36]), nnames)
+	if err != nil {
+		return nil, err
+	}
+	ordinals := make([]byte, 2*nnames)
+	if err := f.readRVA(ordinals, binary.LittleEndian.Uint32(hdr[36:40])); err != nil {
+		return nil, err
+	}
+	fnames := make([]string, nfuncs)
+	for i, rva := range names {
+		j := binary.LittleEndian.Uint16(ordinals[2*i:])
+		if uint32(j) >= nfuncs {
+			return nil, &FormatError{-1, "export name table", ErrOutOfBounds, j}
+		}
+		if fnames[j], err = f.readStringRVA(rva); err != nil {
+			return nil, err
+		}
+	}
+	for i, rva := range funcs {
+		if rva == 0 {
+			continue // unused ordinal
+		}
+		e := Export{Name: fnames[i], Ordinal: uint16(d.Base + uint32(i)), RVA: rva}
+		// An address inside the export directory
+		// points to the name of a forwarded export.
+		if rva >= dd.VirtualAddress && int64(rva) < int64(dd.VirtualAddress)+int64(dd.Size) {
+			if e.Forwarder, err = f.readStringRVA(rva); err != nil {
+				return nil, err
+			}
+			e.RVA = 0
+		}
+		d.Exports = append(d.Exports, e)
+	}
+	return d, nil
+}
+
+// exportNameTable returns the names in the export name table
+// of f, in the order of the table, or nil if f exports nothing.
+func (f *File) exportNameTable() ([]string, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if dd.VirtualAddress == 0 {
+		return nil, nil
+	}
+	var hdr [40]byte
+	if err := f.readRVA(hdr[:], dd.VirtualAddress); err != nil {
+		return nil, err
+	}
+	nnames := binary.LittleEndian.Uint32(hdr[24:28])
+	if nnames > maxExports {
+		return nil, &FormatError{-1, "export directory", ErrOutOfBounds, nnames}
+	}
+	rvas, err := f.readRVAUint32s(binary.LittleEndian.Uint32(hdr[32:36]), nnames)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(rvas))
+	for i, rva := range rvas {
+		if names[i], err = f.readStringRVA(rva); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// readRVAUint32s reads n little-endian uint32
+// values starting at relative virtual address rva.
+func (f *File) readRVAUint32s(rva, n uint32) ([]uint32, error) {
+	b := make([]byte, 4*n)
+	if err := f.readRVA(b, rva); err != nil {
+		return nil, err
+	}
+	v := make([]uint32, n)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return v, nil
+}
+
+// Lookup returns the export with the given name, or, if name
+// has the form "#123", with the given ordinal.
+func (d *ExportDirectory) Lookup(name string) (Export, bool) {
+	if strings.HasPrefix(name, "#") {
+		ord, err := strconv.ParseUint(name[1:], 10, 16)
+		if err != nil {
+			return Export{}, false
+		}
+		for _, e := range d.Exports {
+			if e.Ordinal == uint16(ord) {
+				return e, true
+			}
+		}
+		return Export{}, false
+	}
+	for _, e := range d.Exports {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Export{}, false
+}
+
+// ResolveOrdinals sets the Name of each import of imps by ordinal
+// from the DLL named dll, which d is the export directory of, to
+// the name d exports the ordinal under. DLL names are compared
+// without regard to case. The imports keep ByOrdinal and Ordinal,
+// so that they are still written and loaded by ordinal, and those
+// of other DLLs or of ordinals d has no name for are left unchanged.
+func (d *ExportDirectory) ResolveOrdinals(imps []Import, dll string) {
+	var names map[uint16]string
+	for i := range imps {
+		imp := &imps[i]
+		if !imp.ByOrdinal || imp.Name != "" || !strings.EqualFold(imp.DLL, dll) {
+			continue
+		}
+		if names == nil {
+			names = d.ordinalNames()
+		}
+		imp.Name = names[imp.Ordinal]
+	}
+}
+
+// ordinalNames maps the ordinals of the named exports of d to their names.
+func (d *ExportDirectory) ordinalNames() map[uint16]string {
+	names := make(map[uint16]string)
+	for _, e := range d.Exports {
+		if e.Name != "" {
+			names[e.Ordinal] = e.Name
+		}
+	}
+	return names
+}
+
+// An ExportResolver follows export forwarder chains
+// across a set of DLLs to the module that implements
+// an export. Its methods are safe for concurrent use once
+// Files, Redirect and APISets are set.
+type ExportResolver struct {
+	// Files holds the DLLs to search, keyed by lower-case
+	// file name, such as "kernelbase.dll".
+	Files map[string]*File
+
+	// Redirect, if not nil, maps the lower-case name of a DLL
+	// that is not itself implemented, such as an API set
+	// contract like "api-ms-win-core-file-l1-1-0.dll", to the
+	// name of the DLL that implements it. It returns the empty
+	// string if the name is not redirected.
+	Redirect func(dll string) string
+
+	// APISets, if not nil, maps API set contracts to the DLLs that
+	// implement them, for the DLL whose import or forwarder refers
+	// to them. It is consulted before Redirect.
+	APISets APISetResolver
+
+	mu      sync.Mutex // protects exports
+	exports map[string]*ExportDirectory
+}
+
+// maxForwards limits the length of forwarder chains,
+// so that cycles are detected.
+const maxForwards = 32
+
+// Resolve follows the forwarder chain starting at the export
+// named name, or "#ordinal", of the DLL named dll, and returns the
+// name of the DLL that finally implements it and its export entry.
+func (r *ExportResolver) Resolve(dll, name string) (string, Export, error) {
+	return r.ResolveFrom("", dll, name)
+}
+
+// ResolveFrom is like Resolve, for an import of the module named
+// importer, which selects the host of API set contracts it imports
+// from. Those in forwarders are resolved for the forwarding DLL.
+func (r *ExportResolver) ResolveFrom(importer, dll, name string) (string, Export, error) {
+	for i := 0; i < maxForwards; i++ {
+		dll = r.module(importer, dll)
+		d, err := r.exportsOf(dll)
+		if err != nil {
+			return "", Export{}, err
+		}
+		e, ok := d.Lookup(name)
+		if !ok {
+			return "", Export{}, fmt.Errorf("pe: %s does not export %s", dll, name)
+		}
+		if e.Forwarder == "" {
+			return dll, e, nil
+		}
+		// The DLL name may itself contain dots,
+		// so split at the last one.
+		dot := strings.LastIndex(e.Forwarder, ".")
+		if dot < 0 {
+			return "", Export{}, fmt.Errorf("pe: %s!%s has malformed forwarder %q", dll, name, e.Forwarder)
+		}
+		importer = dll
+		dll, name = e.Forwarder[:dot], e.Forwarder[dot+1:]
+	}
+	return "", Export{}, errors.New("pe: export forwarder chain too long or cyclic")
+}
+
+// ResolveOrdinals is like ExportDirectory.ResolveOrdinals for the
+// imports of imps from all the DLLs in r.Files, as imported by the
+// module named importer. Forwarders are not followed: the names are
+// those the imported DLL itself exports the ordinals under. Imports
+// of other DLLs are left unchanged.
+func (r *ExportResolver) ResolveOrdinals(imps []Import, importer string) error {
+	names := make(map[string]map[uint16]string)
+	for i := range imps {
+		imp := &imps[i]
+		if !imp.ByOrdinal || imp.Name != "" {
+			continue
+		}
+		dll := r.module(importer, imp.DLL)
+		if r.Files[dll] == nil {
+			continue
+		}
+		m, ok := names[dll]
+		if !ok {
+			d, err := r.exportsOf(dll)
+			if err != nil {
+				return err
+			}
+			m = d.ordinalNames()
+			names[dll] = m
+		}
+		imp.Name = m[imp.Ordinal]
+	}
+	return nil
+}
+
+// module returns the key in r.Files of the DLL named dll,
+// as imported by the module named importer: the lower-case
+// name, with a .dll extension if it has none, of the DLL
+// dll is redirected to, if any.
+func (r *ExportResolver) module(importer, dll string) string {
+	dll = strings.ToLower(dll)
+	if !strings.Contains(dll, ".") {
+		dll += ".dll"
+	}
+	if r.APISets != nil && IsAPISetName(dll) {
+		if host, ok := r.APISets.ResolveAPISet(dll, importer); ok {
+			dll = strings.ToLower(host)
+		}
+	}
+	if r.Redirect != nil {
+		if to := r.Redirect(dll); to != "" {
+			dll = strings.ToLower(to)
+		}
+	}
+	return dll
+}
+
+// exportsOf returns the export directory of the named DLL.
+func (r *ExportResolver) exportsOf(dll string) (*ExportDirectory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d, ok := r.exports[dll]; ok {
+		return d, nil
+	}
+	f := r.Files[dll]
+	if f == nil {
+		return nil, fmt.Errorf("pe: unknown DLL %s", dll)
+	}
+	d, err := f.Exports()
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		d = new(ExportDirectory)
+	}
+	if r.exports == nil {
+		r.exports = make(map[string]*ExportDirectory)
+	}
+	r.exports[dll] = d
+	return d, nil
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSectionRVA is the RVA of the only section of
+// the images built by makeTestImage.
+const testSectionRVA = 0x1000
+
+// makeTestImage returns a minimal PE32+ image with a single
+// section holding data, mapped at testSectionRVA, and the
+// given data directories.
+func makeTestImage(data []byte, dirs map[int]DataDirectory) []byte {
+	const (
+		lfanew     = 0x40
+		headerSize = 0x200
+	)
+	raw := (len(data) + 0x1ff) &^ 0x1ff
+	var b bytes.Buffer
+	dos := DOSHeader{Magic: 0x5a4d, Lfanew: lfanew}
+	binary.Write(&b, binary.LittleEndian, &dos)
+	b.WriteString("PE\x00\x00")
+	binary.Write(&b, binary.LittleEndian, &FileHeader{
+		Machine:              IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: sizeofOptionalHeader64,
+		Characteristics:      0x2022, // executable, large address aware, DLL
+	})
+	oh := OptionalHeader64{
+		Magic:               0x20b,
+		SectionAlignment:    0x1000,
+		FileAlignment:       0x200,
+		SizeOfImage:         testSectionRVA + uint32(len(data)+0xfff)&^0xfff,
+		SizeOfHeaders:       headerSize,
+		ImageBase:           0x180000000,
+		Subsystem:           3,
+		NumberOfRvaAndSizes: 16,
+	}
+	for i, d := range dirs {
+		oh.DataDirectory[i] = d
+	}
+	binary.Write(&b, binary.LittleEndian, &oh)
+	sh := SectionHeader32{
+		VirtualSize:      uint32(len(data)),
+		VirtualAddress:   testSectionRVA,
+		SizeOfRawData:    uint32(raw),
+		PointerToRawData: headerSize,
+		Characteristics:  0x40000040, // initialized data, readable
+	}
+	copy(sh.Name[:], ".data")
+	binary.Write(&b, binary.LittleEndian, &sh)
+	b.Write(make([]byte, headerSize-b.Len()))
+	b.Write(data)
+	b.Write(make([]byte, raw-len(data)))
+	return b.Bytes()
+}
+
+// A testExport describes an export of a DLL built by makeTestDLL.
+type testExport struct {
+	name      string // empty to export by ordinal only
+	forwarder string // empty for a regular export
+}
+
+// makeTestDLL returns a DLL named name whose exports, with
+// ordinals starting at base, are described by exports.
+func makeTestDLL(name string, base uint32, exports []testExport) []byte {
+	n := uint32(len(exports))
+	var named []int
+	for i, e := range exports {
+		if e.name != "" {
+			named = append(named, i)
+		}
+	}
+	funcs := uint32(40)
+	names := funcs + 4*n
+	ords := names + 4*uint32(len(named))
+	strs := ords + 2*uint32(len(named))
+
+	d := make([]byte, strs)
+	addString := func(s string) uint32 {
+		rva := testSectionRVA + uint32(len(d))
+		d = append(d, s...)
+		d = append(d, 0)
+		return rva
+	}
+	nameRVA := addString(name)
+	binary.LittleEndian.PutUint32(d[12:], nameRVA)
+	binary.LittleEndian.PutUint32(d[16:], base)
+	binary.LittleEndian.PutUint32(d[20:], n)
+	binary.LittleEndian.PutUint32(d[24:], uint32(len(named)))
+	binary.LittleEndian.PutUint32(d[28:], testSectionRVA+funcs)
+	binary.LittleEndian.PutUint32(d[32:], testSectionRVA+names)
+	binary.LittleEndian.PutUint32(d[36:], testSectionRVA+ords)
+	for i, e := range exports {
+		rva := uint32(0x2000 + 0x10*i) // outside the directory
+		if e.forwarder != "" {
+			rva = addString(e.forwarder)
+		}
+		binary.LittleEndian.PutUint32(d[funcs+4*uint32(i):], rva)
+	}
+	for j, i := range named {
+		rva := addString(exports[i].name)
+		binary.LittleEndian.PutUint32(d[names+4*uint32(j):], rva)
+		binary.LittleEndian.PutUint16(d[ords+2*uint32(j):], uint16(i))
+	}
+	return makeTestImage(d, map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_EXPORT: {testSectionRVA, uint32(len(d))},
+	})
+}
+
+func TestExports(t *testing.T) {
+	dll := makeTestDLL("test.dll", 5, []testExport{
+		{name: "Alpha"},
+		{},
+		{name: "Gamma", forwarder: "other.Delta"},
+	})
+	f, err := NewFile(bytes.NewReader(dll))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := f.Exports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "test.dll" || d.Base != 5 {
+		t.Errorf("got directory %q with base %d, want test.dll with base 5", d.Name, d.Base)
+	}
+	want := []Export{
+		{Name: "Alpha", Ordinal: 5, RVA: 0x2000},
+		{Ordinal: 6, RVA: 0x2010},
+		{Name: "Gamma", Ordinal: 7, Forwarder: "other.Delta"},
+	}
+	if len(d.Exports) != len(want) {
+		t.Fatalf("got %d exports, want %d", len(d.Exports), len(want))
+	}
+	for i := range want {
+		if d.Exports[i] != want[i] {
+			t.Errorf("export %d = %+v, want %+v", i, d.Exports[i], want[i])
+		}
+	}
+	if e, ok := d.Lookup("#6"); !ok || e.RVA != 0x2010 {
+		t.Errorf("Lookup(#6) = %+v, %v", e, ok)
+	}
+	dd, err := f.DataDirectory(IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dd.Data.(*ExportDirectory); !ok {
+		t.Errorf("export directory parsed as %T, want *ExportDirectory", dd.Data)
+	}
+}
+
+func TestExportResolver(t *testing.T) {
+	open := func(name string, exports []testExport) *File {
+		f, err := NewFile(bytes.NewReader(makeTestDLL(name, 1, exports)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	r := &ExportResolver{
+		Files: map[string]*File{
+			"kernel32.dll": open("KERNEL32.dll", []testExport{
+				{name: "CreateFileW", forwarder: "api-ms-win-core-file-l1-1-0.CreateFileW"},
+				{name: "Loop", forwarder: "kernel32.Loop"},
+				{name: "ByOrdinal", forwarder: "kernelbase.#2"},
+			}),
+			"kernelbase.dll": open("KERNELBASE.dll", []testExport{
+				{name: "CreateFileW"},
+				{name: "Other"},
+			}),
+		},
+		Redirect: func(dll string) string {
+			if dll == "api-ms-win-core-file-l1-1-0.dll" {
+				return "kernelbase.dll"
+			}
+			return ""
+		},
+	}
+	dll, e, err := r.Resolve("KERNEL32", "CreateFileW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dll != "kernelbase.dll" || e.Name != "CreateFileW" || e.Ordinal != 1 {
+		t.Errorf("CreateFileW resolved to %s %+v", dll, e)
+	}
+	dll, e, err = r.Resolve("kernel32.dll", "ByOrdinal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dll != "kernelbase.dll" || e.Name != "Other" {
+		t.Errorf("ByOrdinal resolved to %s %+v", dll, e)
+	}
+	if _, _, err := r.Resolve("kernel32.dll", "Loop"); err == nil {
+		t.Errorf("resolving a cyclic forwarder succeeded")
+	}
+	if _, _, err := r.Resolve("user32.dll", "MessageBoxW"); err == nil {
+		t.Errorf("resolving an export of an unknown DLL succeeded")
+	}
+}
+
+func TestResolveOrdinals(t *testing.T) {
+	ws2, err := NewFile(bytes.NewReader(makeTestDLL("WS2_32.dll", 114, []testExport{
+		{name: ""},
+		{name: "WSAStartup"},
+		{name: "Forwarded", forwarder: "other.#1"},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imps := []Import{
+		{DLL: "WS2_32.dll", Ordinal: 115, ByOrdinal: true},
+		{DLL: "ws2_32", Ordinal: 116, ByOrdinal: true},
+		{DLL: "ws2_32.dll", Ordinal: 114, ByOrdinal: true},
+		{DLL: "ws2_32.dll", Name: "WSAStartup"},
+		{DLL: "user32.dll", Ordinal: 115, ByOrdinal: true},
+	}
+	want := append([]Import(nil), imps...)
+	want[0].Name = "WSAStartup"
+	want[1].Name = "Forwarded"
+
+	got := append([]Import(nil), imps...)
+	r := &ExportResolver{Files: map[string]*File{"ws2_32.dll": ws2}}
+	if err := r.ResolveOrdinals(got, "app.exe"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExportResolver.ResolveOrdinals:\n got %+v\nwant %+v", got, want)
+	}
+
+	d, err := ws2.Exports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append([]Import(nil), imps...)
+	d.ResolveOrdinals(got, "ws2_32.DLL")
+	want[1].Name = "" // "ws2_32" is not "ws2_32.DLL"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExportDirectory.ResolveOrdinals:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDependencyGraph(t *testing.T) {
+	exe, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imps, err := f.Imports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kernel32.dll exports all but the first function the
+	// program imports from it and forwards the second one to
+	// kernelbase.dll. msvcrt.dll is missing.
+	var k32 []testExport
+	var missing, forwarded string
+	for _, imp := range imps {
+		if !strings.EqualFold(imp.DLL, "kernel32.dll") {
+			continue
+		}
+		switch {
+		case missing == "":
+			missing = imp.Name
+		case forwarded == "":
+			forwarded = imp.Name
+			k32 = append(k32, testExport{name: imp.Name, forwarder: "KERNELBASE." + imp.Name})
+		default:
+			k32 = append(k32, testExport{name: imp.Name})
+		}
+	}
+	dir, err := ioutil.TempDir("", "pe-depgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"App.exe":        exe,
+		"kernel32.dll":   makeTestDLL("KERNEL32.dll", 1, k32),
+		"KernelBase.dll": makeTestDLL("KERNELBASE.dll", 1, []testExport{{name: forwarded}}),
+	}
+	var paths []string
+	for name, b := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, b, 0666); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	g, err := OpenDependencyGraph(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if len(g.Dependencies) != len(imps) {
+		t.Fatalf("got %d dependencies, want one per import of the program, %d", len(g.Dependencies), len(imps))
+	}
+	for i, d := range g.Dependencies {
+		if d.Importer != "app.exe" || d.Import != imps[i] {
+			t.Errorf("dependency %d is %s importing %+v, want app.exe importing %+v", i, d.Importer, d.Import, imps[i])
+		}
+		want := ""
+		switch {
+		case d.Import.Name == forwarded:
+			want = "kernelbase.dll"
+		case strings.EqualFold(d.Import.DLL, "kernel32.dll") && d.Import.Name != missing:
+			want = "kernel32.dll"
+		}
+		if d.Module != want || (d.Err == nil) != (want != "") {
+			t.Errorf("%s!%s resolved to %q, %v; want %q", d.Import.DLL, d.Import.Name, d.Module, d.Err, want)
+		}
+	}
+	if n := len(g.Unresolved()); n != len(imps)-len(k32) {
+		t.Errorf("%d unresolved imports, want %d", n, len(imps)-len(k32))
+	}
+	if have, want := g.Imports("app.exe"), []string{"kernel32.dll", "kernelbase.dll"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("Imports(app.exe) = %q, want %q", have, want)
+	}
+	if have, want := g.Importers("kernelbase.dll"), []string{"app.exe"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("Importers(kernelbase.dll) = %q, want %q", have, want)
+	}
+
+	if _, err := OpenDependencyGraph(paths[0], paths[0]); err == nil {
+		t.Errorf("opening a graph with two files of the same name succeeded")
+	}
+}
@@ -6,17 +6,31 @@
 package pe
 
 import (
+	"bytes"
 	"debug/dwarf"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 )
 
-// Avoid use of post-Go 1.4 io features, to make safe for toolchain bootstrap.
-const seekStart = 0
-
 // A File represents an open PE file.
+//
+// The methods of a File are safe for concurrent use by multiple
+// goroutines as long as none of them changes the file: the data
+// that is read lazily, such as the symbols of a file opened with
+// Options.LazySymbols, the mapped sections of Options.MapSections
+// and the debug information used by Addr2Line, is loaded under a
+// lock. Methods that edit the file, such as AddSymbol, and direct
+// changes to its fields must not run concurrently with any other
+// use of the file.
+//
+// A File only reads its underlying reader with ReadAt, at offsets
+// of its own; it never uses the Read or Seek methods the reader may
+// have. Callers may thus keep reading the reader themselves, for
+// instance through their own io.SectionReader, while using the File.
 type File struct {
 	FileHeader
 	OptionalHeader interface{} // of type *OptionalHeader32 or *OptionalHeader64
@@ -24,22 +38,177 @@ type File struct {
 	Symbols        []*Symbol    // COFF symbols with auxiliary symbol records removed
 	COFFSymbols    []COFFSymbol // all COFF symbols (including auxiliary symbol records)
 	StringTable    StringTable
+	DOSHeader      *DOSHeader      // nil if there is no MS-DOS header, as in object files
+	DOSStub        []byte          // the bytes between the MS-DOS header and the PE signature
+	BigObjHeader   *BigObjHeader   // nil unless the file is a big object file
+	TEHeader       *TEHeader       // nil unless the file is a TE image
+	COFFBigSymbols []COFFBigSymbol // all COFF symbols of a big object file
+
+	// Warnings lists the problems tolerated while parsing
+	// a file opened with Options.Mode set to ParsePermissive.
+	Warnings []error
+
+	// Errors lists the parts of a file opened with Options.Recover
+	// that could not be read, one error per damaged component.
+	Errors []error
 
 	closer io.Closer
+
+	// mode is the ParseMode the file was opened with.
+	mode ParseMode
+
+	// recover is set if the file was opened with Options.Recover.
+	recover bool
+
+	// r is the underlying reader. It is kept so that the
+	// symbol table can be read after NewFile returns.
+	// Only its ReadAt method may be used.
+	r io.ReaderAt
+
+	// base is the file offset of the COFF file header.
+	base int64
+
+	// size is the size of the underlying file in bytes,
+	// or -1 if it is not known.
+	size int64
+
+	// data holds the contents of the file if it is in memory,
+	// for example because it was opened with OpenMmap.
+	data []byte
+
+	// imageLayout reports whether the file is laid out
+	// as a loaded image; see NewFileFromImage.
+	imageLayout bool
+
+	// symbolsLoaded reports whether Symbols and COFFSymbols
+	// have been read from the file. symbolsMu protects
+	// the three of them while the symbols are loaded.
+	symbolsLoaded bool
+	symbolsMu     sync.Mutex
+
+	// index is the Options.Index the file was opened with.
+	index *FileIndex
+
+	// maxResourceDepth and maxResourceEntries are the
+	// limits set by the Options the file was opened with.
+	maxResourceDepth   int
+	maxResourceEntries int
+
+	// dwarf and dwarfErr cache the result of DWARF for
+	// Addr2Line, and dwarfLine the .debug_line section.
+	dwarf     *dwarf.Data
+	dwarfErr  error
+	dwarfLine []byte
+	dwarfOnce sync.Once
+}
+
+// Options controls optional behavior of OpenWithOptions and
+// NewFileWithOptions. The zero value is equivalent to using
+// Open and NewFile.
+type Options struct {
+	// LazySymbols defers reading the COFF symbol table.
+	// If set, File.Symbols and File.COFFSymbols are nil until
+	// File.LoadSymbols is called. Symbols can also be streamed
+	// with File.WalkCOFFSymbols without ever reading the whole
+	// table into memory.
+	LazySymbols bool
+
+	// Mode selects how strictly the file is checked
+	// against the PE specification.
+	Mode ParseMode
+
+	// Recover keeps what can be parsed of a truncated or damaged
+	// file instead of failing. If the section table, symbol table,
+	// string table or a relocation list is cut short, the entries
+	// read before the damage are kept and the error is recorded in
+	// File.Errors. The file and COFF headers must still be intact.
+	Recover bool
+
+	// MapSections makes the Files returned by OpenWithOptions
+	// memory-map the raw data of each section the first time
+	// Section.Data is called, rather than reading it into memory.
+	// The operating system then only pages in the parts actually
+	// used, which makes File.DWARF practical on debug sections of
+	// several gigabytes. As with OpenMmap, Data returns read-only
+	// slices that must not be used after the File is closed.
+	// It has no effect on NewFileWithOptions.
+	MapSections bool
+
+	// Parallelism, if greater than 1, is the number of goroutines
+	// NewFileWithOptions uses to read the symbol table and the
+	// relocations of each section, which lie in disjoint parts of
+	// the file, concurrently. The underlying io.ReaderAt must then
+	// be safe for concurrent use, as os.File and bytes.Reader are.
+	// The symbol table is read last rather than first, so if it is
+	// damaged, its error comes after those of the section table in
+	// File.Errors and File.Warnings; the File is otherwise the same.
+	Parallelism int
+
+	// Index, if not nil, is the index File.Index made of the file
+	// when it was last parsed. NewFileWithOptions then takes the
+	// section headers from the index instead of the section table
+	// and defers reading the symbol table as if LazySymbols were
+	// set; File.LookupSymbol finds symbols through the index. The
+	// relocations and the string table are still read. If the
+	// index does not match the file, NewFileWithOptions fails
+	// with ErrStaleIndex.
+	Index *FileIndex
+
+	// MaxResourceDepth and MaxResourceEntries limit the resource
+	// tree File.Resources reads: the number of nested directories,
+	// counting the root, and the total number of directory entries.
+	// The loader only uses three levels, but a malformed tree can
+	// nest much deeper or share subdirectories so that the entries
+	// to read multiply. Zero selects the defaults of 32 levels and
+	// 65536 entries. Resources fails with a *ResourceLimitError
+	// when a limit is exceeded.
+	MaxResourceDepth   int
+	MaxResourceEntries int
+
+	// Done, if not nil, is called by NewFileWithOptions between the
+	// phases of parsing: before the symbol table, the optional header
+	// and section table, and the relocations of each section, and
+	// before the checks of ParseStrict. If it returns an error,
+	// parsing stops with that error. Services parsing untrusted files
+	// can use it to bound the time spent, for example by passing
+	// the Err method of a context.Context.
+	//
+	// Done only applies to parsing itself. Parts of the file read
+	// later by methods, such as the imports and exports, or the
+	// symbol table with LazySymbols, are not covered.
+	Done func() error
+
+	// imageLayout is set by NewFileFromImage.
+	imageLayout bool
 }
 
 // Open opens the named file using os.Open and prepares it for use as a PE binary.
 func Open(name string) (*File, error) {
+	return OpenWithOptions(name, nil)
+}
+
+// OpenWithOptions is like Open, but uses opts to control
+// how the file is parsed. A nil opts is the same as Open.
+func OpenWithOptions(name string, opts *Options) (*File, error) {
 	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
-	ff, err := NewFile(f)
+	ff, err := NewFileWithOptions(f, opts)
 	if err != nil {
 		f.Close()
 		return nil, err
 	}
 	ff.closer = f
+	if opts != nil && opts.MapSections && !ff.imageLayout {
+		m := &sectionMapper{f: f}
+		for _, s := range ff.Sections {
+			if s.hasRawData() && s.data == nil && s.missing == 0 {
+				s.mapper = m
+			}
+		}
+		ff.closer = m
+	}
 	return ff, nil
 }
 
@@ -55,21 +224,177 @@ func (f *File) Close() error {
 	return err
 }
 
+// dosHeaderSize is the size of the MS-DOS header.
+const dosHeaderSize = 64
+
 var (
 	sizeofOptionalHeader32 = uint16(binary.Size(OptionalHeader32{}))
 	sizeofOptionalHeader64 = uint16(binary.Size(OptionalHeader64{}))
 )
 
-// TODO(brainman): add Load function, as a replacement for NewFile, that does not call removeAuxSymbols (for performance)
+// optionalHeaderInfo holds the fields of OptionalHeader32
+// and OptionalHeader64 that code in this package needs,
+// so that it can handle both without type switches.
+type optionalHeaderInfo struct {
+	pe64                bool
+	addressOfEntryPoint uint32
+	imageBase           uint64
+	sectionAlignment    uint32
+	fileAlignment       uint32
+	sizeOfImage         uint32
+	sizeOfHeaders       uint32
+	checkSum            uint32
+	subsystem           uint16
+	dllCharacteristics  uint16
+	win32VersionValue   uint32
+	loaderFlags         uint32
+	numberOfRvaAndSizes uint32
+	dataDirectories     [16]DataDirectory
+}
+
+// optionalHeader returns the fields of f.OptionalHeader,
+// or nil if f has no optional header.
+func (f *File) optionalHeader() *optionalHeaderInfo {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return &optionalHeaderInfo{
+			addressOfEntryPoint: oh.AddressOfEntryPoint,
+			imageBase:           uint64(oh.ImageBase),
+			sectionAlignment:    oh.SectionAlignment,
+			fileAlignment:       oh.FileAlignment,
+			sizeOfImage:         oh.SizeOfImage,
+			sizeOfHeaders:       oh.SizeOfHeaders,
+			checkSum:            oh.CheckSum,
+			subsystem:           oh.Subsystem,
+			dllCharacteristics:  oh.DllCharacteristics,
+			win32VersionValue:   oh.Win32VersionValue,
+			loaderFlags:         oh.LoaderFlags,
+			numberOfRvaAndSizes: oh.NumberOfRvaAndSizes,
+			dataDirectories:     oh.DataDirectory,
+		}
+	case *OptionalHeader64:
+		return &optionalHeaderInfo{
+			pe64:                true,
+			addressOfEntryPoint: oh.AddressOfEntryPoint,
+			imageBase:           oh.ImageBase,
+			sectionAlignment:    oh.SectionAlignment,
+			fileAlignment:       oh.FileAlignment,
+			sizeOfImage:         oh.SizeOfImage,
+			sizeOfHeaders:       oh.SizeOfHeaders,
+			checkSum:            oh.CheckSum,
+			subsystem:           oh.Subsystem,
+			dllCharacteristics:  oh.DllCharacteristics,
+			win32VersionValue:   oh.Win32VersionValue,
+			loaderFlags:         oh.LoaderFlags,
+			numberOfRvaAndSizes: oh.NumberOfRvaAndSizes,
+			dataDirectories:     oh.DataDirectory,
+		}
+	}
+	return nil
+}
+
+// dataDirectory returns data directory i, or a zero
+// DataDirectory if the optional header does not have it.
+func (oh *optionalHeaderInfo) dataDirectory(i int) DataDirectory {
+	if i < 0 || i >= len(oh.dataDirectories) || uint32(i) >= oh.numberOfRvaAndSizes {
+		return DataDirectory{}
+	}
+	return oh.dataDirectories[i]
+}
 
 // NewFile creates a new File for accessing a PE binary in an underlying reader.
+// If the reader holds something else, such as an MS-DOS executable or
+// a COFF archive, the error is a *NotPEError saying what it is.
 func NewFile(r io.ReaderAt) (*File, error) {
+	return NewFileWithOptions(r, nil)
+}
+
+// NewFileWithOptions is like NewFile, but uses opts to control
+// how the file is parsed. A nil opts is the same as NewFile.
+func NewFileWithOptions(r io.ReaderAt, opts *Options) (*File, error) {
+	return newFile(r, nil, opts)
+}
+
+// NewFileSize is like NewFileWithOptions for a reader of the given
+// size that cannot report it, such as an HTTP range reader or a
+// compressed archive entry. NewFile only knows the size of regular
+// files and of readers with a Size method; without it, the offsets
+// and counts in the headers cannot be checked against the size of
+// the file up front, and features such as File.Overlay are not
+// available. NewFileSize never reads r past size.
+func NewFileSize(r io.ReaderAt, size int64, opts *Options) (*File, error) {
+	if size < 0 {
+		return nil, errors.New("pe: negative file size")
+	}
+	return newFile(io.NewSectionReader(r, 0, size), nil, opts)
+}
+
+// NewFileFromBytes is like NewFileWithOptions for a PE binary held
+// in data, for callers that already have the whole file in memory.
+// It does not copy: Section.Data returns slices of data, and the
+// symbol and string tables are decoded straight from it. The caller
+// must not modify data while the File is in use.
+func NewFileFromBytes(data []byte, opts *Options) (*File, error) {
+	return newFile(bytes.NewReader(data), data, opts)
+}
+
+// newFile creates a new File reading from r. If the
+// whole file is already in memory, data holds its contents.
+func newFile(r io.ReaderAt, data []byte, opts *Options) (*File, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
 	f := new(File)
-	sr := io.NewSectionReader(r, 0, 1<<63-1)
+	f.r = r
+	f.data = data
+	f.size = readerSize(r)
+	f.imageLayout = opts.imageLayout
+	f.mode = opts.Mode
+	f.recover = opts.Recover
+	f.maxResourceDepth = opts.MaxResourceDepth
+	f.maxResourceEntries = opts.MaxResourceEntries
+	if err := opts.checkDone(); err != nil {
+		return nil, err
+	}
+	if opts.Index != nil {
+		if err := opts.Index.check(r, f.size); err != nil {
+			return nil, err
+		}
+		f.index = opts.Index
+		o := *opts
+		o.LazySymbols = true
+		opts = &o
+	}
+
+	var sig [4]byte
+	_, err := r.ReadAt(sig[:], 0)
+	if err == nil && isImportOrAnon(sig[:]) {
+		h, err := ReadAnonObjectHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		if !isBigObj(h) {
+			return nil, &AnonObjectError{h}
+		}
+		if err := f.readBigObjHeader(); err != nil {
+			return nil, err
+		}
+		return f.parse(r, bigObjHeaderSize, opts)
+	}
+	if err == nil && isTE(sig[:]) {
+		if err := f.readTEHeader(); err != nil {
+			return nil, err
+		}
+		return f.parse(r, teHeaderSize, opts)
+	}
+
+	if IsArchive(r) {
+		return nil, &NotPEError{Kind: NotPEArchive}
+	}
 
 	var dosheader [96]byte
 	if _, err := r.ReadAt(dosheader[0:], 0); err != nil {
-		return nil, err
+		return nil, formatError(0, "file header", err)
 	}
 	var base int64
 	if dosheader[0] == 'M' && dosheader[1] == 'Z' {
@@ -77,77 +402,293 @@ func NewFile(r io.ReaderAt) (*File, error) {
 		var sign [4]byte
 		r.ReadAt(sign[:], signoff)
 		if !(sign[0] == 'P' && sign[1] == 'E' && sign[2] == 0 && sign[3] == 0) {
-			return nil, fmt.Errorf("Invalid PE COFF file signature of %v.", sign)
+			return nil, notPESignature(sign[:])
 		}
 		base = signoff + 4
+		f.DOSHeader = new(DOSHeader)
+		binary.Read(bytes.NewReader(dosheader[:]), binary.LittleEndian, f.DOSHeader)
+		if signoff > dosHeaderSize {
+			// The signature was found, so the stub is all there.
+			f.DOSStub = make([]byte, signoff-dosHeaderSize)
+			if _, err := r.ReadAt(f.DOSStub, dosHeaderSize); err != nil {
+				return nil, formatError(dosHeaderSize, "MS-DOS stub", err)
+			}
+		}
 	} else {
 		base = int64(0)
 	}
-	sr.Seek(base, seekStart)
-	if err := binary.Read(sr, binary.LittleEndian, &f.FileHeader); err != nil {
-		return nil, err
+	f.base = base
+	if err := binary.Read(io.NewSectionReader(r, base, 20), binary.LittleEndian, &f.FileHeader); err != nil {
+		return nil, formatError(base, "COFF file header", err)
+	}
+	return f.parse(r, base+int64(binary.Size(f.FileHeader)), opts)
+}
+
+// checkDone returns the error of o.Done, if any.
+func (o *Options) checkDone() error {
+	if o.Done == nil {
+		return nil
 	}
+	return o.Done()
+}
+
+// parse parses the rest of f, whose file header has been read
+// and ends at file offset ohoff, where the optional header starts.
+func (f *File) parse(r io.ReaderAt, ohoff int64, opts *Options) (*File, error) {
+	base := f.base
+	data := f.data
 	switch f.FileHeader.Machine {
-	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386:
+	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_I386,
+		IMAGE_FILE_MACHINE_ARM, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_EBC:
 	default:
-		return nil, fmt.Errorf("Unrecognised COFF file header machine value of 0x%x.", f.FileHeader.Machine)
+		err := error(&FormatError{base, "COFF file header", ErrUnknownMachine, f.FileHeader.Machine})
+		if f.DOSHeader == nil && f.BigObjHeader == nil && f.TEHeader == nil && !knownMachine(f.Machine) {
+			err = &NotPEError{Kind: NotPEUnrecognized}
+		}
+		if err := f.tolerate(err); err != nil {
+			return nil, err
+		}
 	}
 
-	var err error
-
-	// Read string table.
-	f.StringTable, err = readStringTable(&f.FileHeader, sr)
-	if err != nil {
+	if err := opts.checkDone(); err != nil {
 		return nil, err
 	}
 
-	// Read symbol table.
-	f.COFFSymbols, err = readCOFFSymbols(&f.FileHeader, sr)
-	if err != nil {
-		return nil, err
+	// The COFF symbol and string tables are not
+	// mapped into memory when an image is loaded.
+	if !f.imageLayout {
+		// The string table follows the symbol table,
+		// so check the symbol table is sane first.
+		symtabCut := false
+		if err := checkSymbolTable(&f.FileHeader, f.symbolSize(), f.size); err != nil {
+			if f.recover {
+				// Keep the symbol records that are present.
+				// The string table, which follows them, is lost.
+				f.Errors = append(f.Errors, err)
+				symtabCut = true
+			} else if err := f.tolerate(err); err != nil {
+				return nil, err
+			} else {
+				// Carry on without symbols.
+				f.symbolsLoaded = true
+			}
+		}
+
+		// Read string table.
+		if !f.symbolsLoaded && !symtabCut {
+			var st StringTable
+			var err error
+			if data != nil {
+				st, err = sliceStringTable(&f.FileHeader, f.symbolSize(), data)
+			} else {
+				st, err = readStringTable(&f.FileHeader, f.symbolSize(), r, f.size)
+			}
+			if err != nil {
+				if err := f.salvage(err); err != nil {
+					return nil, err
+				}
+			}
+			f.StringTable = st
+		}
+
+		// Read symbol table, unless readTablesParallel does.
+		if !opts.LazySymbols && !f.symbolsLoaded && opts.Parallelism <= 1 {
+			if err := opts.checkDone(); err != nil {
+				return nil, err
+			}
+			if err := f.LoadSymbols(); err != nil {
+				if err := f.salvage(err); err != nil {
+					return nil, err
+				}
+				f.symbolsLoaded = true
+			}
+		}
+	} else {
+		f.symbolsLoaded = true
 	}
-	f.Symbols, err = removeAuxSymbols(f.COFFSymbols, f.StringTable)
-	if err != nil {
+
+	if err := opts.checkDone(); err != nil {
 		return nil, err
 	}
 
 	// Read optional header.
-	sr.Seek(base, seekStart)
-	if err := binary.Read(sr, binary.LittleEndian, &f.FileHeader); err != nil {
-		return nil, err
-	}
+	sr := io.NewSectionReader(r, ohoff, int64(f.SizeOfOptionalHeader))
 	var oh32 OptionalHeader32
 	var oh64 OptionalHeader64
 	switch f.FileHeader.SizeOfOptionalHeader {
 	case sizeofOptionalHeader32:
 		if err := binary.Read(sr, binary.LittleEndian, &oh32); err != nil {
-			return nil, err
+			err = formatError(ohoff, "optional header", err)
+			if !f.recover {
+				return nil, err
+			}
+			f.Errors = append(f.Errors, err)
+			break
 		}
 		if oh32.Magic != 0x10b { // PE32
-			return nil, fmt.Errorf("pe32 optional header has unexpected Magic of 0x%x", oh32.Magic)
+			if err := f.tolerate(&FormatError{ohoff, "PE32 optional header", ErrBadMagic, oh32.Magic}); err != nil {
+				return nil, err
+			}
 		}
 		f.OptionalHeader = &oh32
 	case sizeofOptionalHeader64:
 		if err := binary.Read(sr, binary.LittleEndian, &oh64); err != nil {
-			return nil, err
+			err = formatError(ohoff, "optional header", err)
+			if !f.recover {
+				return nil, err
+			}
+			f.Errors = append(f.Errors, err)
+			break
 		}
 		if oh64.Magic != 0x20b { // PE32+
-			return nil, fmt.Errorf("pe32+ optional header has unexpected Magic of 0x%x", oh64.Magic)
+			if err := f.tolerate(&FormatError{ohoff, "PE32+ optional header", ErrBadMagic, oh64.Magic}); err != nil {
+				return nil, err
+			}
 		}
 		f.OptionalHeader = &oh64
+	default:
+		if f.SizeOfOptionalHeader != 0 && f.hasShortOptionalHeader(ohoff) {
+			// Fewer than 16 data directories, as in some
+			// firmware drivers. The missing ones read as empty.
+			if err := f.readOddOptionalHeader(ohoff); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if f.SizeOfOptionalHeader != 0 {
+			err := &FormatError{ohoff, "optional header", errors.New("unexpected size"), f.SizeOfOptionalHeader}
+			switch f.mode {
+			case ParseStrict:
+				return nil, err
+			case ParsePermissive:
+				// The loader only requires the optional header
+				// to be large enough, so read it according to
+				// its magic and skip any excess.
+				f.Warnings = append(f.Warnings, err)
+				if err := f.readOddOptionalHeader(ohoff); err != nil {
+					return nil, err
+				}
+			}
+		}
 	}
 
 	// Process sections.
-	f.Sections = make([]*Section, f.FileHeader.NumberOfSections)
-	for i := 0; i < int(f.FileHeader.NumberOfSections); i++ {
-		sh := new(SectionHeader32)
-		if err := binary.Read(sr, binary.LittleEndian, sh); err != nil {
+	if opts.Index != nil {
+		f.Sections = make([]*Section, len(opts.Index.Sections))
+		for i := range opts.Index.Sections {
+			s := &Section{SectionHeader: opts.Index.Sections[i]}
+			f.initSection(s, r)
+			f.Sections[i] = s
+		}
+	} else if err := f.readSectionTable(r, ohoff); err != nil {
+		return nil, err
+	}
+	if opts.Parallelism > 1 {
+		if err := f.readTablesParallel(r, opts); err != nil {
+			return nil, err
+		}
+	}
+	for i := range f.Sections {
+		if f.imageLayout || opts.Parallelism > 1 {
+			break // relocations are not loaded, or already are
+		}
+		if err := opts.checkDone(); err != nil {
 			return nil, err
 		}
-		name, err := sh.fullName(f.StringTable)
+		var err error
+		f.Sections[i].Relocs, err = readRelocs(&f.Sections[i].SectionHeader, r, f.size)
 		if err != nil {
+			if err := f.salvage(err); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := opts.checkDone(); err != nil {
+		return nil, err
+	}
+	if f.mode == ParseStrict {
+		if err := f.checkStrict(); err != nil {
 			return nil, err
 		}
+	}
+
+	return f, nil
+}
+
+// readSectionTable reads the section table of f from r. It
+// follows the optional header, which starts at file offset ohoff.
+func (f *File) readSectionTable(r io.ReaderAt, ohoff int64) error {
+	nsections := f.numberOfSections()
+	sectab := ohoff + int64(f.SizeOfOptionalHeader)
+	if f.size >= 0 && sectab+nsections*40 > f.size && !f.recover {
+		return &FormatError{sectab, "section table", ErrOutOfBounds, nsections}
+	}
+	if f.size >= 0 && nsections > f.size/40 {
+		// Only in recovery mode; do not allocate
+		// for section headers that are not there.
+		nsections = f.size / 40
+	}
+	f.Sections = make([]*Section, nsections)
+	// Read the section table a chunk at a time rather than one
+	// header at a time: big objects can have 100,000 sections.
+	n := nsections
+	if n > sectionChunk {
+		n = sectionChunk
+	}
+	buf := make([]byte, n*40)
+	var chunk []byte // headers read but not decoded yet
+	for i := 0; i < int(nsections); i++ {
+		if len(chunk) == 0 {
+			n := nsections - int64(i)
+			if n > sectionChunk {
+				n = sectionChunk
+			}
+			k, err := r.ReadAt(buf[:n*40], sectab+int64(i)*40)
+			chunk = buf[:k-k%40]
+			if len(chunk) == 0 {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				err = formatError(sectab+int64(i)*40, "section header", err)
+				if !f.recover {
+					return err
+				}
+				// Keep the sections before the damage.
+				f.Errors = append(f.Errors, err)
+				f.Sections = f.Sections[:i]
+				break
+			}
+		}
+		sh := new(SectionHeader32)
+		decodeSectionHeader(chunk, sh)
+		chunk = chunk[40:]
+		var name string
+		if f.imageLayout || f.PointerToSymbolTable == 0 {
+			// Long names refer to the string table,
+			// which is not available.
+			name = cstring(sh.Name[:])
+		} else {
+			var err error
+			name, err = sh.fullName(f.StringTable)
+			if err != nil {
+				if err := f.salvage(err); err != nil {
+					return err
+				}
+				name = cstring(sh.Name[:])
+			}
+		}
+		if f.TEHeader != nil && sh.PointerToRawData != 0 {
+			// Section offsets are those of the original
+			// PE image; make them offsets in the TE image.
+			off, err := f.teOffset(sh.PointerToRawData)
+			if err != nil {
+				if err := f.salvage(err); err != nil {
+					return err
+				}
+			}
+			sh.PointerToRawData = off
+		}
 		s := new(Section)
 		s.SectionHeader = SectionHeader{
 			Name:                 name,
@@ -161,23 +702,65 @@ func NewFile(r io.ReaderAt) (*File, error) {
 			NumberOfLineNumbers:  sh.NumberOfLineNumbers,
 			Characteristics:      sh.Characteristics,
 		}
-		r2 := r
-		if sh.PointerToRawData == 0 { // .bss must have all 0s
-			r2 = zeroReaderAt{}
-		}
-		s.sr = io.NewSectionReader(r2, int64(s.SectionHeader.Offset), int64(s.SectionHeader.Size))
-		s.ReaderAt = s.sr
+		f.initSection(s, r)
 		f.Sections[i] = s
 	}
-	for i := range f.Sections {
-		var err error
-		f.Sections[i].Relocs, err = readRelocs(&f.Sections[i].SectionHeader, sr)
-		if err != nil {
-			return nil, err
+	return nil
+}
+
+// initSection sets up the readers of the contents of s,
+// whose header has been read, for a File reading from r.
+func (f *File) initSection(s *Section, r io.ReaderAt) {
+	r2 := r
+	start := int64(s.Offset)
+	if f.imageLayout {
+		// The loader places section contents at their
+		// virtual address, zero-filling any part of the
+		// section with no raw data.
+		start = int64(s.VirtualAddress)
+		if f.size >= 0 {
+			r2 = &zeroFillReaderAt{r, f.size}
 		}
+	} else if s.Offset == 0 { // .bss must have all 0s
+		r2 = zeroReaderAt{}
+	}
+	s.sr = io.NewSectionReader(r2, start, int64(s.Size))
+	s.ReaderAt = s.sr
+	end := start + int64(s.Size)
+	if r2 == r && f.size >= 0 && end > f.size {
+		s.missing = end - f.size
+	} else if limit := f.zeroFillLimit(); r2 != r && end > limit {
+		// The zeros are not in the file, so bound
+		// them by the image instead of trusting Size.
+		s.missing = end - limit
 	}
+	if s.missing > int64(s.Size) {
+		s.missing = int64(s.Size)
+	}
+	if f.data != nil && (f.imageLayout || s.Offset != 0) {
+		end := start + int64(s.Size)
+		if end <= int64(len(f.data)) {
+			s.data = f.data[start:end:end]
+		}
+	}
+}
 
-	return f, nil
+// maxZeroFill limits the size of the contents of sections of
+// object files that have no raw data, such as .bss, which read
+// as zeros.
+const maxZeroFill = 1 << 30
+
+// zeroFillLimit returns the offset, in the layout sections of f are
+// read in, past which sections that read as zeros are cut short:
+// SizeOfImage for images, and maxZeroFill for object files.
+func (f *File) zeroFillLimit() int64 {
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		return int64(oh.SizeOfImage)
+	case *OptionalHeader64:
+		return int64(oh.SizeOfImage)
+	}
+	return maxZeroFill
 }
 
 // zeroReaderAt is ReaderAt that reads 0s.
@@ -216,32 +799,6 @@ func (f *File) Section(name string) *Section {
 	return nil
 }
 
-func (f *File) DWARF() (*dwarf.Data, error) {
-	// There are many other DWARF sections, but these
-	// are the ones the debug/dwarf package uses.
-	// Don't bother loading others.
-	var names = [...]string{"abbrev", "info", "line", "ranges", "str"}
-	var dat [len(names)][]byte
-	for i, name := range names {
-		name = ".debug_" + name
-		s := f.Section(name)
-		if s == nil {
-			continue
-		}
-		b, err := s.Data()
-		if err != nil && uint32(len(b)) < s.Size {
-			return nil, err
-		}
-		if 0 < s.VirtualSize && s.VirtualSize < s.Size {
-			b = b[:s.VirtualSize]
-		}
-		dat[i] = b
-	}
-
-	abbrev, info, line, ranges, str := dat[0], dat[1], dat[2], dat[3], dat[4]
-	return dwarf.New(abbrev, nil, nil, info, line, nil, ranges, str)
-}
-
 // TODO(brainman): document ImportDirectory once we decide what to do with it.
 
 type ImportDirectory struct {
@@ -259,18 +816,32 @@ type ImportDirectory struct {
 // satisfied by other libraries at dynamic load time.
 // It does not return weak symbols.
 func (f *File) ImportedSymbols() ([]string, error) {
+	var all []string
+	err := f.walkImportedSymbols(func(sym string) bool {
+		all = append(all, sym)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// walkImportedSymbols calls fn for every symbol ImportedSymbols
+// returns, in the same order, until fn returns false.
+func (f *File) walkImportedSymbols(fn func(sym string) bool) error {
 	pe64 := f.Machine == IMAGE_FILE_MACHINE_AMD64
 	ds := f.Section(".idata")
 	if ds == nil {
 		// not dynamic, so no libraries
-		return nil, nil
+		return nil
 	}
 	d, err := ds.Data()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	var ida []ImportDirectory
-	for len(d) > 0 {
+	for len(d) >= 20 {
 		var dt ImportDirectory
 		dt.OriginalFirstThunk = binary.LittleEndian.Uint32(d[0:4])
 		dt.Name = binary.LittleEndian.Uint32(d[12:16])
@@ -288,13 +859,19 @@ func (f *File) ImportedSymbols() ([]string, error) {
 	//  Why ds.Data() called again and again in the loop?
 	//  Needs test before rewrite.
 	names, _ := ds.Data()
-	var all []string
 	for _, dt := range ida {
 		dt.dll, _ = getString(names, int(dt.Name-ds.VirtualAddress))
 		d, _ = ds.Data()
 		// seek to OriginalFirstThunk
-		d = d[dt.OriginalFirstThunk-ds.VirtualAddress:]
+		off := int64(dt.OriginalFirstThunk) - int64(ds.VirtualAddress)
+		if off < 0 || off > int64(len(d)) {
+			return &FormatError{-1, "import directory", ErrOutOfBounds, dt.OriginalFirstThunk}
+		}
+		d = d[off:]
 		for len(d) > 0 {
+			if pe64 && len(d) < 8 || len(d) < 4 {
+				return &FormatError{-1, "import lookup table", ErrTruncated, dt.OriginalFirstThunk}
+			}
 			if pe64 { // 64bit
 				va := binary.LittleEndian.Uint64(d[0:8])
 				d = d[8:]
@@ -304,8 +881,10 @@ func (f *File) ImportedSymbols() ([]string, error) {
 				if va&0x8000000000000000 > 0 { // is Ordinal
 					// TODO add dynimport ordinal support.
 				} else {
-					fn, _ := getString(names, int(uint32(va)-ds.VirtualAddress+2))
-					all = append(all, fn+":"+dt.dll)
+					name, _ := getString(names, int(uint32(va)-ds.VirtualAddress+2))
+					if !fn(name + ":" + dt.dll) {
+						return nil
+					}
 				}
 			} else { // 32bit
 				va := binary.LittleEndian.Uint32(d[0:4])
@@ -317,14 +896,16 @@ func (f *File) ImportedSymbols() ([]string, error) {
 					// TODO add dynimport ordinal support.
 					//ord := va&0x0000FFFF
 				} else {
-					fn, _ := getString(names, int(va-ds.VirtualAddress+2))
-					all = append(all, fn+":"+dt.dll)
+					name, _ := getString(names, int(va-ds.VirtualAddress+2))
+					if !fn(name + ":" + dt.dll) {
+						return nil
+					}
 				}
 			}
 		}
 	}
 
-	return all, nil
+	return nil
 }
 
 // ImportedLibraries returns the names of all libraries
@@ -336,11 +917,67 @@ func (f *File) ImportedLibraries() ([]string, error) {
 	return nil, nil
 }
 
-// FormatError is unused.
-// The type is retained for compatibility.
+// A FormatError is returned by operations that find that the data
+// does not have the correct format for a PE file. It records the
+// structure being parsed and where it is.
 type FormatError struct {
+	Off  int64       // file offset of the structure, or -1 if not applicable
+	What string      // the structure being parsed, such as "symbol table"
+	Err  error       // the problem; often one of the Err variables below
+	Val  interface{} // the offending value, if any
 }
 
 func (e *FormatError) Error() string {
-	return "unknown error"
+	msg := e.What
+	if msg == "" && e.Err == nil {
+		msg = "unknown error"
+	}
+	if e.Off >= 0 {
+		msg += fmt.Sprintf(" at offset %#x", e.Off)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Val != nil {
+		msg += fmt.Sprintf(" (%#x)", e.Val)
+	}
+	return msg
+}
+
+// Errors commonly found in the Err field of a FormatError.
+var (
+	ErrTruncated      = errors.New("unexpected end of file")
+	ErrBadMagic       = errors.New("bad magic number")
+	ErrUnknownMachine = errors.New("unrecognized machine type")
+	ErrOutOfBounds    = errors.New("offset or size out of bounds")
+)
+
+// formatError returns a FormatError for the failure err to read
+// what at offset off. End of file errors become ErrTruncated.
+func formatError(off int64, what string, err error) *FormatError {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return &FormatError{Off: off, What: what, Err: err}
+}
+
+// sizer is implemented by readers that know their size,
+// such as *io.SectionReader, *bytes.Reader and *strings.Reader.
+type sizer interface {
+	Size() int64
+}
+
+// readerSize returns the size of the data available through r,
+// or -1 if it cannot be determined.
+func readerSize(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case sizer:
+		return r.Size()
+	case *os.File:
+		fi, err := r.Stat()
+		if err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return -1
 }
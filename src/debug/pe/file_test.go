@@ -5,8 +5,16 @@
 package pe
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
 	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"hash"
 	"internal/testenv"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -15,6 +23,8 @@ import (
 	"regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"text/template"
 )
@@ -47,22 +57,22 @@ var fileTests = []fileTest{
 			{".debug_aranges", 0, 0, 32, 1408, 1590, 0, 2, 0, 1108344832},
 		},
 		symbols: []*Symbol{
-			{".file", 0x0, -2, 0x0, 0x67},
-			{"_main", 0x0, 1, 0x20, 0x2},
-			{".text", 0x0, 1, 0x0, 0x3},
-			{".data", 0x0, 2, 0x0, 0x3},
-			{".bss", 0x0, 3, 0x0, 0x3},
-			{".debug_abbrev", 0x0, 4, 0x0, 0x3},
-			{".debug_info", 0x0, 5, 0x0, 0x3},
-			{".debug_line", 0x0, 6, 0x0, 0x3},
-			{".rdata", 0x0, 7, 0x0, 0x3},
-			{".debug_frame", 0x0, 8, 0x0, 0x3},
-			{".debug_loc", 0x0, 9, 0x0, 0x3},
-			{".debug_pubnames", 0x0, 10, 0x0, 0x3},
-			{".debug_pubtypes", 0x0, 11, 0x0, 0x3},
-			{".debug_aranges", 0x0, 12, 0x0, 0x3},
-			{"___main", 0x0, 0, 0x20, 0x2},
-			{"_puts", 0x0, 0, 0x20, 0x2},
+			{Name: ".file", Value: 0x0, SectionNumber: -2, Type: 0x0, StorageClass: 0x67},
+			{Name: "_main", Value: 0x0, SectionNumber: 1, Type: 0x20, StorageClass: 0x2},
+			{Name: ".text", Value: 0x0, SectionNumber: 1, Type: 0x0, StorageClass: 0x3},
+			{Name: ".data", Value: 0x0, SectionNumber: 2, Type: 0x0, StorageClass: 0x3},
+			{Name: ".bss", Value: 0x0, SectionNumber: 3, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_abbrev", Value: 0x0, SectionNumber: 4, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_info", Value: 0x0, SectionNumber: 5, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_line", Value: 0x0, SectionNumber: 6, Type: 0x0, StorageClass: 0x3},
+			{Name: ".rdata", Value: 0x0, SectionNumber: 7, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_frame", Value: 0x0, SectionNumber: 8, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_loc", Value: 0x0, SectionNumber: 9, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_pubnames", Value: 0x0, SectionNumber: 10, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_pubtypes", Value: 0x0, SectionNumber: 11, Type: 0x0, StorageClass: 0x3},
+			{Name: ".debug_aranges", Value: 0x0, SectionNumber: 12, Type: 0x0, StorageClass: 0x3},
+			{Name: "___main", Value: 0x0, SectionNumber: 0, Type: 0x20, StorageClass: 0x2},
+			{Name: "_puts", Value: 0x0, SectionNumber: 0, Type: 0x20, StorageClass: 0x2},
 		},
 	},
 	{
@@ -154,16 +164,16 @@ var fileTests = []fileTest{
 			{".pdata", 0x0, 0x0, 0xc, 0x150, 0x17a, 0x0, 0x3, 0x0, 0x40300040},
 		},
 		symbols: []*Symbol{
-			{".file", 0x0, -2, 0x0, 0x67},
-			{"main", 0x0, 1, 0x20, 0x2},
-			{".text", 0x0, 1, 0x0, 0x3},
-			{".data", 0x0, 2, 0x0, 0x3},
-			{".bss", 0x0, 3, 0x0, 0x3},
-			{".rdata", 0x0, 4, 0x0, 0x3},
-			{".xdata", 0x0, 5, 0x0, 0x3},
-			{".pdata", 0x0, 6, 0x0, 0x3},
-			{"__main", 0x0, 0, 0x20, 0x2},
-			{"puts", 0x0, 0, 0x20, 0x2},
+			{Name: ".file", Value: 0x0, SectionNumber: -2, Type: 0x0, StorageClass: 0x67},
+			{Name: "main", Value: 0x0, SectionNumber: 1, Type: 0x20, StorageClass: 0x2},
+			{Name: ".text", Value: 0x0, SectionNumber: 1, Type: 0x0, StorageClass: 0x3},
+			{Name: ".data", Value: 0x0, SectionNumber: 2, Type: 0x0, StorageClass: 0x3},
+			{Name: ".bss", Value: 0x0, SectionNumber: 3, Type: 0x0, StorageClass: 0x3},
+			{Name: ".rdata", Value: 0x0, SectionNumber: 4, Type: 0x0, StorageClass: 0x3},
+			{Name: ".xdata", Value: 0x0, SectionNumber: 5, Type: 0x0, StorageClass: 0x3},
+			{Name: ".pdata", Value: 0x0, SectionNumber: 6, Type: 0x0, StorageClass: 0x3},
+			{Name: "__main", Value: 0x0, SectionNumber: 0, Type: 0x20, StorageClass: 0x2},
+			{Name: "puts", Value: 0x0, SectionNumber: 0, Type: 0x20, StorageClass: 0x2},
 		},
 		hasNoDwarfInfo: true,
 	},
@@ -532,3 +542,1335 @@ func TestBuildingWindowsGUI(t *testing.T) {
 		t.Fatalf("unexpected OptionalHeader type: have %T, but want *pe.OptionalHeader32 or *pe.OptionalHeader64", oh)
 	}
 }
+
+func TestLazySymbols(t *testing.T) {
+	for i := range fileTests {
+		tt := &fileTests[i]
+
+		f, err := OpenWithOptions(tt.file, &Options{LazySymbols: true})
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if f.Symbols != nil || f.COFFSymbols != nil {
+			t.Errorf("open %s: symbols read despite LazySymbols", tt.file)
+		}
+
+		var walked []COFFSymbol
+		err = f.WalkCOFFSymbols(func(i int, sym *COFFSymbol) bool {
+			if i != len(walked) {
+				t.Errorf("open %s: WalkCOFFSymbols index = %d, want %d", tt.file, i, len(walked))
+			}
+			walked = append(walked, *sym)
+			return true
+		})
+		if err != nil {
+			t.Errorf("open %s: WalkCOFFSymbols: %v", tt.file, err)
+		}
+		if len(walked) != int(f.NumberOfSymbols) {
+			t.Errorf("open %s: WalkCOFFSymbols visited %d records, want %d", tt.file, len(walked), f.NumberOfSymbols)
+		}
+
+		if err := f.LoadSymbols(); err != nil {
+			t.Errorf("open %s: LoadSymbols: %v", tt.file, err)
+			f.Close()
+			continue
+		}
+		if len(walked) > 0 && !reflect.DeepEqual(walked, f.COFFSymbols) {
+			t.Errorf("open %s: WalkCOFFSymbols and LoadSymbols disagree", tt.file)
+		}
+		for i, want := range tt.symbols {
+			if i >= len(f.Symbols) {
+				t.Errorf("open %s: have %d symbols, want %d", tt.file, len(f.Symbols), len(tt.symbols))
+				break
+			}
+			if have := f.Symbols[i]; !reflect.DeepEqual(have, want) {
+				t.Errorf("open %s, symbol %d:\n\thave %#v\n\twant %#v\n", tt.file, i, have, want)
+			}
+		}
+		f.Close()
+	}
+}
+
+// readerAtOnly hides all methods of its ReaderAt except ReadAt,
+// so that NewFile cannot determine the size of the data.
+type readerAtOnly struct {
+	r io.ReaderAt
+}
+
+func (r readerAtOnly) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
+
+func TestHugeNumberOfSymbols(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Object files have no DOS header, so the COFF file header
+	// is at the start of the file.
+	binary.LittleEndian.PutUint32(data[12:], 0x7fffffff) // NumberOfSymbols
+
+	_, err = NewFile(bytes.NewReader(data))
+	if _, ok := err.(*FormatError); !ok {
+		t.Errorf("NewFile with huge NumberOfSymbols: have error %v, want *FormatError", err)
+	}
+
+	_, err = NewFile(readerAtOnly{bytes.NewReader(data)})
+	if err == nil {
+		t.Errorf("NewFile with huge NumberOfSymbols and unknown size succeeded unexpectedly")
+	}
+}
+
+func TestSectionVirtualReader(t *testing.T) {
+	f, err := Open("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, s := range f.Sections {
+		raw, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		vr := s.VirtualReader()
+		if vr.Size() != int64(s.VirtualSize) {
+			t.Errorf("section %s: VirtualReader size = %#x, want %#x", s.Name, vr.Size(), s.VirtualSize)
+		}
+		want := make([]byte, s.VirtualSize)
+		copy(want, raw)
+		have, err := ioutil.ReadAll(vr)
+		if err != nil {
+			t.Fatalf("section %s: %v", s.Name, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("section %s: VirtualReader data does not match raw data with zero fill", s.Name)
+		}
+
+		cr := CachedReader(vr, 64, 4)
+		for off := 0; off < len(want); off += 37 {
+			p := make([]byte, 100)
+			n, err := cr.ReadAt(p, int64(off))
+			if n < len(p) && err != io.EOF {
+				t.Fatalf("section %s: CachedReader.ReadAt(%d): %v", s.Name, off, err)
+			}
+			if !bytes.Equal(p[:n], want[off:off+n]) {
+				t.Errorf("section %s: CachedReader.ReadAt(%d) returned wrong data", s.Name, off)
+			}
+		}
+	}
+}
+
+func TestOpenMmap(t *testing.T) {
+	openers := []struct {
+		name string
+		open func(name string) (*File, error)
+	}{
+		{"OpenMmap", func(name string) (*File, error) {
+			return OpenMmap(name, nil)
+		}},
+		{"MapSections", func(name string) (*File, error) {
+			return OpenWithOptions(name, &Options{MapSections: true})
+		}},
+		{"NewFileFromBytes", func(name string) (*File, error) {
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			return NewFileFromBytes(data, nil)
+		}},
+	}
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range openers {
+			mf, err := o.open(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(f.COFFSymbols, mf.COFFSymbols) || !reflect.DeepEqual(f.Symbols, mf.Symbols) || !bytes.Equal(f.StringTable, mf.StringTable) {
+				t.Errorf("%s: %s: mapped file symbols differ", o.name, tt.file)
+			}
+			for i, s := range f.Sections {
+				want, err := s.Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				have, err := mf.Sections[i].Data()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(have, want) {
+					t.Errorf("%s: %s: section %s: mapped data differs", o.name, tt.file, s.Name)
+				}
+				if o.name == "MapSections" && s.hasRawData() && mf.Sections[i].mapper == nil {
+					t.Errorf("%s: section %s is not mapped", tt.file, s.Name)
+				}
+			}
+			if !tt.hasNoDwarfInfo {
+				if _, err := mf.DWARF(); err != nil {
+					t.Errorf("%s: %s: DWARF: %v", o.name, tt.file, err)
+				}
+			}
+			if err := mf.Close(); err != nil {
+				t.Errorf("%s: %s: Close: %v", o.name, tt.file, err)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestNewFileFromBytes(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFileFromBytes(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inData reports whether b is a slice of data.
+	inData := func(b []byte) bool {
+		if len(b) == 0 {
+			return false
+		}
+		for i := range data {
+			if &data[i] == &b[0] {
+				return i+len(b) <= len(data)
+			}
+		}
+		return false
+	}
+	for _, s := range f.Sections {
+		b, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 0 && !inData(b) {
+			t.Errorf("section %s: Data copied the file", s.Name)
+		}
+	}
+	if !inData(f.StringTable) {
+		t.Errorf("StringTable copied the file")
+	}
+
+	// Adding symbols must not write to data.
+	orig := append([]byte(nil), data...)
+	if _, err := f.AddSymbol(&Symbol{Name: "a_rather_long_symbol_name", StorageClass: IMAGE_SYM_CLASS_EXTERNAL}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, orig) {
+		t.Errorf("adding a symbol modified the data of the file")
+	}
+}
+
+// readAtOnly is a reader whose Read and Seek methods fail
+// the test, to check that a File only uses ReadAt.
+type readAtOnly struct {
+	t *testing.T
+	r *bytes.Reader
+}
+
+func (r *readAtOnly) ReadAt(p []byte, off int64) (int, error) { return r.r.ReadAt(p, off) }
+func (r *readAtOnly) Size() int64                             { return r.r.Size() }
+
+func (r *readAtOnly) Read(p []byte) (int, error) {
+	r.t.Error("File called Read on its reader")
+	return 0, io.EOF
+}
+
+func (r *readAtOnly) Seek(int64, int) (int64, error) {
+	r.t.Error("File called Seek on its reader")
+	return 0, errors.New("cannot seek")
+}
+
+func TestReadAtOnly(t *testing.T) {
+	for _, tt := range fileTests {
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFileWithOptions(&readAtOnly{t, bytes.NewReader(data)}, &Options{LazySymbols: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.LoadSymbols(); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range f.Sections {
+			if _, err := s.Data(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ioutil.ReadAll(s.Open()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.SymbolsSeq()(func(*Symbol, error) bool { return true })
+		f.ImportedSymbols()
+		f.Exports()
+		f.Resources()
+		f.Overlay()
+		f.Sum(md5.New())
+		if f.OptionalHeader != nil {
+			f.AuthenticodeDigest(md5.New())
+		}
+		if !tt.hasNoDwarfInfo {
+			if _, err := f.DWARF(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	f, err := OpenWithOptions("testdata/gcc-amd64-mingw-exec", &Options{LazySymbols: true, MapSections: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*8)
+	for i := 0; i < 8; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			errs <- f.LoadSymbols()
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := f.SymbolTable()
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			for _, s := range f.Sections {
+				if _, err := s.Data(); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := f.Addr2Line(0x4014e0)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if f.Symbols == nil {
+		t.Error("symbols not loaded")
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	for _, tt := range fileTests {
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		off, r, err := f.Overlay()
+		if err != nil {
+			t.Fatalf("%s: Overlay: %v", tt.file, err)
+		}
+		if r.Size() != 0 {
+			t.Errorf("%s: unexpected overlay of %d bytes at %#x", tt.file, r.Size(), off)
+		}
+
+		payload := []byte("appended payload")
+		f, err = NewFile(bytes.NewReader(append(data, payload...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		off2, r, err := f.Overlay()
+		if err != nil {
+			t.Fatalf("%s: Overlay: %v", tt.file, err)
+		}
+		if off2 != int64(len(data)) {
+			t.Errorf("%s: overlay offset = %#x, want %#x", tt.file, off2, len(data))
+		}
+		have, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, payload) {
+			t.Errorf("%s: overlay = %q, want %q", tt.file, have, payload)
+		}
+	}
+}
+
+func TestFileRegions(t *testing.T) {
+	for _, tt := range fileTests {
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, "appended payload"...)
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		regions, err := f.FileRegions()
+		if err != nil {
+			t.Fatalf("%s: FileRegions: %v", tt.file, err)
+		}
+		// The regions tile the file.
+		var off int64
+		var kinds [RegionGap + 1]int64
+		sections := 0
+		for _, r := range regions {
+			if r.Offset != off || r.Size <= 0 {
+				t.Fatalf("%s: region %v %+v follows offset %#x", tt.file, r.Kind, r.Region, off)
+			}
+			off = r.End()
+			kinds[r.Kind] += r.Size
+			if r.Kind == RegionSection {
+				sections++
+				if r.Offset != int64(r.Section.Offset) || r.Size != int64(r.Section.Size) {
+					t.Errorf("%s: region of section %s = %+v", tt.file, r.Section.Name, r.Region)
+				}
+			}
+		}
+		if off != int64(len(data)) {
+			t.Errorf("%s: regions end at %#x, want %#x", tt.file, off, len(data))
+		}
+		if kinds[RegionHeaders] == 0 || kinds[RegionOverlay] != int64(len("appended payload")) || sections == 0 {
+			t.Errorf("%s: bytes by kind of region = %v", tt.file, kinds)
+		}
+		if f.PointerToSymbolTable != 0 && kinds[RegionSymbols] == 0 {
+			t.Errorf("%s: no symbol table region", tt.file)
+		}
+	}
+
+	// Without its size, the file cannot be accounted for.
+	data, err := ioutil.ReadFile(fileTests[0].file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(struct{ io.ReaderAt }{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regions, err := f.FileRegions(); err == nil {
+		t.Errorf("FileRegions of a file of unknown size = %v", regions)
+	}
+}
+
+func TestSlackRegions(t *testing.T) {
+	img := makeTestImage([]byte("section contents"), nil)
+	copy(img[0x200+16:], "cave")
+	copy(img[0x1f0:], "hidden")
+	f, err := NewFile(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slack, err := f.SlackRegions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tableEnd := f.HeaderLayout().SectionTable.End()
+	want := []struct {
+		kind   SlackKind
+		region Region
+		rva    uint32
+		data   string
+	}{
+		{SlackHeaders, Region{tableEnd, 0x200 - tableEnd}, uint32(tableEnd), "hidden"},
+		{SlackSectionTail, Region{0x210, 0x1f0}, testSectionRVA + 16, "cave"},
+	}
+	if len(slack) != len(want) {
+		t.Fatalf("SlackRegions() = %+v, want %d regions", slack, len(want))
+	}
+	for i, w := range want {
+		s := &slack[i]
+		if s.Kind != w.kind || s.Region != w.region || s.RVA != w.rva {
+			t.Errorf("region %d = %v %+v at RVA %#x, want %v %+v at RVA %#x", i, s.Kind, s.Region, s.RVA, w.kind, w.region, w.rva)
+		}
+		b, err := s.Data()
+		if err != nil || int64(len(b)) != s.Size || !bytes.Contains(b, []byte(w.data)) {
+			t.Errorf("region %d: Data() = %q, %v, want %d bytes holding %q", i, b, err, s.Size, w.data)
+		}
+	}
+	if slack[1].Section != f.Sections[0] {
+		t.Errorf("section tail belongs to %v", slack[1].Section)
+	}
+
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slack, err := f.SlackRegions()
+		if err != nil {
+			t.Errorf("%s: SlackRegions: %v", tt.file, err)
+		}
+		for _, s := range slack {
+			n, err := io.Copy(ioutil.Discard, s.Open())
+			if err != nil || n != s.Size {
+				t.Errorf("%s: read %d bytes of %v %+v: %v", tt.file, n, s.Kind, s.Region, err)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestNewFileSize(t *testing.T) {
+	for _, tt := range fileTests {
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := []byte("appended payload")
+		r := readerAtOnly{bytes.NewReader(append(data, payload...))}
+		f, err := NewFile(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := f.Overlay(); err == nil {
+			t.Errorf("%s: Overlay succeeded without a file size", tt.file)
+		}
+
+		// Hide the payload from the parser.
+		f, err = NewFileSize(r, int64(len(data)), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if !reflect.DeepEqual(f.FileHeader, want.FileHeader) || !reflect.DeepEqual(f.OptionalHeader, want.OptionalHeader) || !reflect.DeepEqual(f.COFFSymbols, want.COFFSymbols) {
+			t.Errorf("%s: headers or symbols differ", tt.file)
+		}
+		for i, s := range f.Sections {
+			if !reflect.DeepEqual(s.SectionHeader, want.Sections[i].SectionHeader) || !reflect.DeepEqual(s.Relocs, want.Sections[i].Relocs) {
+				t.Errorf("%s: section %d = %+v, want %+v", tt.file, i, s.SectionHeader, want.Sections[i].SectionHeader)
+			}
+		}
+		if off, or, err := f.Overlay(); err != nil || or.Size() != 0 {
+			t.Errorf("%s: Overlay() = %#x, %v, want no overlay", tt.file, off, err)
+		}
+
+		if tt.symbols != nil {
+			// The string table follows the symbol table
+			// at the end of these files.
+			if _, err := NewFileSize(r, int64(len(data))-2, nil); err == nil {
+				t.Errorf("%s: truncated file parsed without error", tt.file)
+			}
+		}
+	}
+}
+
+func TestEntropyAndSum(t *testing.T) {
+	if e := entropyOf(&[256]int64{'a': 10}, 10); e != 0 {
+		t.Errorf("entropy of constant data = %v, want 0", e)
+	}
+	var uniform [256]int64
+	for i := range uniform {
+		uniform[i] = 1
+	}
+	if e := entropyOf(&uniform, 256); e != 8 {
+		t.Errorf("entropy of uniform data = %v, want 8", e)
+	}
+
+	data, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := f.Sum(sha256.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256(data); !bytes.Equal(sum, want[:]) {
+		t.Errorf("File.Sum = %x, want %x", sum, want)
+	}
+	for _, s := range f.Sections {
+		raw, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := s.Sum(md5.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := md5.Sum(raw); !bytes.Equal(sum, want[:]) {
+			t.Errorf("section %s: Sum = %x, want %x", s.Name, sum, want)
+		}
+		e, err := s.Entropy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e < 0 || e > 8 || (len(raw) > 0 && e == 0 && !bytes.Equal(raw, make([]byte, len(raw)))) {
+			t.Errorf("section %s: implausible entropy %v", s.Name, e)
+		}
+	}
+}
+
+func TestImpHash(t *testing.T) {
+	for _, tt := range []struct {
+		dll, name string
+		ordinal   uint16
+		byOrdinal bool
+		want      string
+	}{
+		{"KERNEL32.dll", "ExitProcess", 0, false, "kernel32.exitprocess"},
+		{"msvcrt.DLL", "printf", 0, false, "msvcrt.printf"},
+		{"foo.bar.ocx", "Thing", 0, false, "foo.bar.thing"},
+		{"custom.exe", "f", 0, false, "custom.exe.f"},
+		{"WS2_32.dll", "", 115, true, "ws2_32.wsastartup"},
+		{"oleaut32.dll", "", 6, true, "oleaut32.sysfreestring"},
+		{"oleaut32.dll", "", 200, true, "oleaut32.geterrorinfo"},
+		{"wsock32.dll", "", 24, true, "wsock32.getaddrinfow"},
+		{"WS2_32.dll", "", 116, true, "ws2_32.wsacleanup"},
+		{"ws2_32", "", 115, true, "ws2_32.ord115"},
+		{"user32.dll", "", 42, true, "user32.ord42"},
+	} {
+		if have := imphashEntry(tt.dll, tt.name, tt.ordinal, tt.byOrdinal); have != tt.want {
+			t.Errorf("imphashEntry(%q, %q, %d, %v) = %q, want %q", tt.dll, tt.name, tt.ordinal, tt.byOrdinal, have, tt.want)
+		}
+	}
+
+	// The imphashes of the test files, computed independently
+	// of this package following pefile's get_imphash.
+	for _, tt := range []struct {
+		file, want string
+	}{
+		{"testdata/gcc-386-mingw-exec", "afe54265af0ee5570cb87b013a2f38da"},
+		{"testdata/gcc-amd64-mingw-exec", "66a73da58ce4083636bcd1bf6a51870c"},
+		{"testdata/gcc-amd64-mingw-obj", ""},
+	} {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := f.ImpHash()
+		if err != nil {
+			t.Fatalf("%s: ImpHash: %v", tt.file, err)
+		}
+		if have != tt.want {
+			t.Errorf("%s: ImpHash = %q, want %q", tt.file, have, tt.want)
+		}
+		f.Close()
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peoff := int64(binary.LittleEndian.Uint32(data[0x3c:]))
+
+	for _, tt := range []struct {
+		name   string
+		modify func([]byte) []byte
+		off    int64
+		err    error
+	}{
+		{"bad machine", func(b []byte) []byte { b[peoff+4] = 0x12; b[peoff+5] = 0x34; return b }, peoff + 4, ErrUnknownMachine},
+		{"bad optional header magic", func(b []byte) []byte { b[peoff+24] = 0; return b }, peoff + 24, ErrBadMagic},
+		{"symbol table past end of file", func(b []byte) []byte { return b[:peoff+30] }, 0x3c00, ErrOutOfBounds},
+		{"truncated optional header", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[peoff+12:], 0) // PointerToSymbolTable
+			return b[:peoff+30]
+		}, peoff + 24, ErrTruncated},
+	} {
+		b := tt.modify(append([]byte(nil), data...))
+		_, err := NewFile(bytes.NewReader(b))
+		fe, ok := err.(*FormatError)
+		if !ok {
+			t.Errorf("%s: have error %v (%T), want *FormatError", tt.name, err, err)
+			continue
+		}
+		if fe.Off != tt.off {
+			t.Errorf("%s: FormatError.Off = %#x, want %#x", tt.name, fe.Off, tt.off)
+		}
+		if fe.Err != tt.err {
+			t.Errorf("%s: FormatError.Err = %v, want %v", tt.name, fe.Err, tt.err)
+		}
+		if fe.Error() == "" {
+			t.Errorf("%s: empty error message", tt.name)
+		}
+	}
+
+	for _, tt := range []struct {
+		err  *FormatError
+		want string
+	}{
+		{&FormatError{}, "unknown error at offset 0x0"},
+		{&FormatError{-1, "", nil, nil}, "unknown error"},
+		{&FormatError{0x10, "section table", nil, 3}, "section table at offset 0x10 (0x3)"},
+	} {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("%#v.Error() = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestNotPE(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peoff := int64(binary.LittleEndian.Uint32(data[0x3c:]))
+	withSignature := func(sig string) []byte {
+		b := append([]byte(nil), data...)
+		copy(b[peoff:], sig)
+		return b
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want *NotPEError
+	}{
+		{"MS-DOS", withSignature("XE\x00\x00"), &NotPEError{Kind: NotPEMSDOS}},
+		{"PE signature past the end", data[:peoff], &NotPEError{Kind: NotPEMSDOS}},
+		{"NE", withSignature("NE\x05\x0a"), &NotPEError{NotPELegacy, "NE"}},
+		{"LX", withSignature("LX\x00\x00"), &NotPEError{NotPELegacy, "LX"}},
+		{"archive", makeTestArchive([]testMember{{name: "a.obj", data: []byte("x")}}), &NotPEError{Kind: NotPEArchive}},
+		{"text", []byte(strings.Repeat("This is not a PE file.\n", 10)), &NotPEError{Kind: NotPEUnrecognized}},
+	}
+	for _, tt := range tests {
+		_, err := NewFile(bytes.NewReader(tt.data))
+		if !reflect.DeepEqual(err, tt.want) {
+			t.Errorf("%s: NewFile error = %v (%T), want %v", tt.name, err, err, tt.want)
+		}
+		if tt.name == "PE signature past the end" {
+			continue // Sniff cannot tell a short stream from a short file
+		}
+		_, err = Sniff(bytes.NewReader(tt.data))
+		if !reflect.DeepEqual(err, tt.want) {
+			t.Errorf("%s: Sniff error = %v (%T), want %v", tt.name, err, err, tt.want)
+		}
+	}
+
+	// Object files for machines the package does not support
+	// are still recognized as such.
+	obj, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint16(obj, IMAGE_FILE_MACHINE_IA64)
+	_, err = NewFile(bytes.NewReader(obj))
+	if fe, ok := err.(*FormatError); !ok || fe.Err != ErrUnknownMachine {
+		t.Errorf("IA-64 object: NewFile error = %v, want ErrUnknownMachine", err)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := OpenWithOptions(tt.file, &Options{Mode: ParseStrict})
+		if err != nil {
+			t.Errorf("%s: strict parsing failed: %v", tt.file, err)
+			continue
+		}
+		f.Close()
+	}
+
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peoff := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	fh := peoff + 4
+	sectab := fh + 20 + int(binary.LittleEndian.Uint16(data[fh+16:]))
+
+	// Misaligned second section.
+	b := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(b[sectab+40+20:], binary.LittleEndian.Uint32(b[sectab+40+20:])+1)
+	if _, err := NewFile(bytes.NewReader(b)); err != nil {
+		t.Errorf("default parsing of misaligned section failed: %v", err)
+	}
+	if _, err := NewFileWithOptions(bytes.NewReader(b), &Options{Mode: ParseStrict}); err == nil {
+		t.Errorf("strict parsing of misaligned section succeeded")
+	}
+
+	// Unknown machine type.
+	b = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint16(b[fh:], 0x1234)
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Errorf("default parsing of unknown machine succeeded")
+	}
+	f, err := NewFileWithOptions(bytes.NewReader(b), &Options{Mode: ParsePermissive})
+	if err != nil {
+		t.Fatalf("permissive parsing of unknown machine failed: %v", err)
+	}
+	if len(f.Warnings) != 1 {
+		t.Fatalf("permissive parsing recorded %d warnings, want 1: %v", len(f.Warnings), f.Warnings)
+	}
+	if fe, ok := f.Warnings[0].(*FormatError); !ok || fe.Err != ErrUnknownMachine {
+		t.Errorf("warning = %v, want ErrUnknownMachine", f.Warnings[0])
+	}
+	if len(f.Sections) != 17 || len(f.Symbols) == 0 {
+		t.Errorf("permissive parsing lost sections or symbols")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the file off in the middle of the symbol table.
+	n := len(full.COFFSymbols) / 2
+	b := data[:int(full.PointerToSymbolTable)+n*COFFSymbolSize+COFFSymbolSize/2]
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Errorf("parsing file with truncated symbol table succeeded")
+	}
+	f, err := NewFileWithOptions(bytes.NewReader(b), &Options{Recover: true})
+	if err != nil {
+		t.Fatalf("recovering file with truncated symbol table failed: %v", err)
+	}
+	if len(f.Errors) == 0 {
+		t.Errorf("no errors recorded for truncated symbol table")
+	}
+	if len(f.Sections) != len(full.Sections) {
+		t.Errorf("recovered %d sections, want %d", len(f.Sections), len(full.Sections))
+	}
+	if len(f.COFFSymbols) != n {
+		t.Fatalf("recovered %d COFF symbols, want %d", len(f.COFFSymbols), n)
+	}
+	for i := range f.COFFSymbols {
+		if f.COFFSymbols[i] != full.COFFSymbols[i] {
+			t.Fatalf("COFF symbol %d = %+v, want %+v", i, f.COFFSymbols[i], full.COFFSymbols[i])
+		}
+	}
+
+	// Cut the file off in the middle of the section table.
+	peoff := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	sectab := peoff + 4 + 20 + int(full.SizeOfOptionalHeader)
+	b = data[:sectab+3*40+10]
+	if _, err := NewFile(bytes.NewReader(b)); err == nil {
+		t.Errorf("parsing file with truncated section table succeeded")
+	}
+	f, err = NewFileWithOptions(bytes.NewReader(b), &Options{Recover: true})
+	if err != nil {
+		t.Fatalf("recovering file with truncated section table failed: %v", err)
+	}
+	if len(f.Sections) != 3 {
+		t.Fatalf("recovered %d sections, want 3", len(f.Sections))
+	}
+	for i, s := range f.Sections {
+		if s.Name != full.Sections[i].Name {
+			t.Errorf("section %d is named %q, want %q", i, s.Name, full.Sections[i].Name)
+		}
+	}
+	if f.OptionalHeader == nil {
+		t.Errorf("optional header was not recovered")
+	}
+	if len(f.Errors) == 0 {
+		t.Errorf("no errors recorded for truncated section table")
+	}
+}
+
+func TestMalformedSizes(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A huge string table length must be rejected
+	// rather than allocated.
+	b := append([]byte(nil), data...)
+	stoff := int(f.PointerToSymbolTable) + int(f.NumberOfSymbols)*COFFSymbolSize
+	binary.LittleEndian.PutUint32(b[stoff:], 0xfffffff0)
+	_, err = NewFile(bytes.NewReader(b))
+	if fe, ok := err.(*FormatError); !ok || fe.Err != ErrOutOfBounds {
+		t.Errorf("huge string table: got error %v, want ErrOutOfBounds", err)
+	}
+
+	// So must a relocation list running past the end of the file.
+	b = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint16(b[20+32:], 0xffff) // NumberOfRelocations of the first section
+	_, err = NewFile(bytes.NewReader(b))
+	if fe, ok := err.(*FormatError); !ok || fe.Err != ErrOutOfBounds {
+		t.Errorf("huge relocation count: got error %v, want ErrOutOfBounds", err)
+	}
+
+	// Truncated files must fail cleanly.
+	for _, name := range []string{"testdata/gcc-amd64-mingw-exec", "testdata/gcc-386-mingw-obj"} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < len(data); n += 61 {
+			for _, opts := range []*Options{nil, {Mode: ParsePermissive}, {Recover: true}} {
+				f, err := NewFileWithOptions(bytes.NewReader(data[:n]), opts)
+				if err != nil {
+					continue
+				}
+				f.ImportedSymbols()
+				f.ImpHash()
+				for _, s := range f.Sections {
+					if _, err := s.Data(); err == nil && int64(s.Offset)+int64(s.Size) > int64(n) && s.Offset != 0 {
+						t.Errorf("%s truncated to %d bytes: reading section %s succeeded", name, n, s.Name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLargeOffsets(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Offsets close to 4 GiB must not wrap around, or turn
+	// negative on 32-bit hosts, when converted to int.
+	b := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(b[20+20:], 0xfffffe00) // PointerToRawData of the first section
+	f, err := NewFileWithOptions(bytes.NewReader(b), &Options{Mode: ParsePermissive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := f.Sections[0]; s.Offset != 0xfffffe00 {
+		t.Errorf("section offset = %#x, want 0xfffffe00", s.Offset)
+	} else if _, err := s.Data(); err == nil {
+		t.Errorf("reading a section at offset %#x of a %d-byte file succeeded", s.Offset, len(b))
+	}
+
+	b = append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(b[8:], 0xfffffff0) // PointerToSymbolTable
+	_, err = NewFile(bytes.NewReader(b))
+	if fe, ok := err.(*FormatError); !ok || fe.Err != ErrOutOfBounds {
+		t.Errorf("symbol table at 0xfffffff0: got error %v, want ErrOutOfBounds", err)
+	}
+
+	// An import directory ending at 4 GiB must not continue
+	// at RVA 0, nor must strings that run up to 4 GiB.
+	const va = 0xfffff000
+	sec := make([]byte, 0x1000)
+	copy(sec[0x10:], "k.dll\x00")
+	desc := sec[len(sec)-20:]
+	binary.LittleEndian.PutUint32(desc[0:], va)       // OriginalFirstThunk, empty
+	binary.LittleEndian.PutUint32(desc[12:], va+0x10) // Name
+	binary.LittleEndian.PutUint32(desc[16:], va)      // FirstThunk
+	highImage := func(sec []byte) *File {
+		img := makeTestImage(sec, map[int]DataDirectory{IMAGE_DIRECTORY_ENTRY_IMPORT: {va + 0x1000 - 20, 20}})
+		binary.LittleEndian.PutUint32(img[0x40+4+20+int(sizeofOptionalHeader64)+12:], va) // VirtualAddress of the section
+		f, err := NewFile(bytes.NewReader(img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	if _, err := highImage(sec).Imports(); err == nil {
+		t.Errorf("Imports succeeded on a directory wrapping around 4 GiB")
+	}
+	if s, err := highImage(bytes.Repeat([]byte{'A'}, 0x1000)).readStringRVA(0xfffffff0); err == nil {
+		t.Errorf("readStringRVA(0xfffffff0) = %q, want error", s)
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	for _, tt := range fileTests {
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Also parse a copy whose last relocation list is cut off.
+		cut := append([]byte(nil), data...)
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := len(f.Sections) - 1; i >= 0; i-- {
+			if s := f.Sections[i]; len(s.Relocs) > 0 {
+				cut = cut[:s.PointerToRelocations+1]
+				break
+			}
+		}
+		for _, b := range [][]byte{data, cut} {
+			want, werr := NewFileWithOptions(bytes.NewReader(b), &Options{Recover: true})
+			got, gerr := NewFileWithOptions(bytes.NewReader(b), &Options{Recover: true, Parallelism: 4})
+			if (werr == nil) != (gerr == nil) {
+				t.Fatalf("%s: got error %v, want %v", tt.file, gerr, werr)
+			}
+			if werr != nil {
+				continue
+			}
+			for i, s := range want.Sections {
+				if !reflect.DeepEqual(got.Sections[i].Relocs, s.Relocs) {
+					t.Errorf("%s: section %s: relocations differ", tt.file, s.Name)
+				}
+			}
+			if !reflect.DeepEqual(got.COFFSymbols, want.COFFSymbols) || !reflect.DeepEqual(got.Symbols, want.Symbols) {
+				t.Errorf("%s: symbols differ", tt.file)
+			}
+			if !reflect.DeepEqual(got.Errors, want.Errors) {
+				t.Errorf("%s: got errors %v, want %v", tt.file, got.Errors, want.Errors)
+			}
+		}
+	}
+}
+
+func TestDOSHeader(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h := f.DOSHeader
+	if h == nil {
+		t.Fatal("no MS-DOS header")
+	}
+	if h.Magic != 0x5a4d {
+		t.Errorf("Magic = %#x, want 0x5a4d", h.Magic)
+	}
+	if h.Lfanew != 0x80 {
+		t.Errorf("Lfanew = %#x, want 0x80", h.Lfanew)
+	}
+	if len(f.DOSStub) != int(h.Lfanew)-64 {
+		t.Errorf("len(DOSStub) = %d, want %d", len(f.DOSStub), h.Lfanew-64)
+	}
+	if !bytes.Contains(f.DOSStub, []byte("This program cannot be run in DOS mode")) {
+		t.Errorf("DOSStub does not contain the usual message: %q", f.DOSStub)
+	}
+
+	obj, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if obj.DOSHeader != nil || obj.DOSStub != nil {
+		t.Errorf("object file has an MS-DOS header")
+	}
+}
+
+func TestHeaderLayout(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := f.HeaderLayout()
+		fh, err := f.ReadRegion(l.FileHeader)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if m := binary.LittleEndian.Uint16(fh); m != f.Machine {
+			t.Errorf("%s: machine in raw file header = %#x, want %#x", tt.file, m, f.Machine)
+		}
+		st, err := f.ReadRegion(l.SectionTable)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		for i, s := range f.Sections {
+			if off := binary.LittleEndian.Uint32(st[i*40+20:]); off != s.Offset {
+				t.Errorf("%s: raw PointerToRawData of section %d = %#x, want %#x", tt.file, i, off, s.Offset)
+			}
+		}
+		if f.DOSHeader != nil {
+			sig, err := f.ReadRegion(l.Signature)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.file, err)
+			}
+			if string(sig) != "PE\x00\x00" {
+				t.Errorf("%s: signature = %q", tt.file, sig)
+			}
+			if l.DOSStub.End() != l.Signature.Offset {
+				t.Errorf("%s: stub ends at %#x, signature starts at %#x", tt.file, l.DOSStub.End(), l.Signature.Offset)
+			}
+		} else if l.Signature.Size != 0 {
+			t.Errorf("%s: object file has a PE signature", tt.file)
+		}
+		if _, err := f.ReadRegion(Region{0, 1 << 40}); err == nil {
+			t.Errorf("%s: reading past the end of the file succeeded", tt.file)
+		}
+		f.Close()
+	}
+}
+
+func TestDataDirectory(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := f.DataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oh := f.OptionalHeader.(*OptionalHeader64)
+	if d.DataDirectory != oh.DataDirectory[1] {
+		t.Errorf("import directory = %+v, want %+v", d.DataDirectory, oh.DataDirectory[1])
+	}
+	if dd, ok := oh.Directory(IMAGE_DIRECTORY_ENTRY_IMPORT); !ok || dd != d.DataDirectory {
+		t.Errorf("OptionalHeader64.Directory(IMAGE_DIRECTORY_ENTRY_IMPORT) = %+v, %v", dd, ok)
+	}
+	short := OptionalHeader32{NumberOfRvaAndSizes: IMAGE_DIRECTORY_ENTRY_SECURITY}
+	short.DataDirectory[IMAGE_DIRECTORY_ENTRY_SECURITY] = DataDirectory{0x1000, 8}
+	for _, i := range []int{IMAGE_DIRECTORY_ENTRY_SECURITY, -1, IMAGE_NUMBEROF_DIRECTORY_ENTRIES} {
+		if dd, ok := short.Directory(i); ok {
+			t.Errorf("OptionalHeader32.Directory(%d) = %+v, want none", i, dd)
+		}
+	}
+	for i, want := range map[int]string{
+		IMAGE_DIRECTORY_ENTRY_EXPORT:         "Export",
+		IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR: "COMDescriptor",
+		IMAGE_NUMBEROF_DIRECTORY_ENTRIES - 1: "Reserved",
+		IMAGE_NUMBEROF_DIRECTORY_ENTRIES:     "Directory(16)",
+	} {
+		if got := DirectoryName(i); got != want {
+			t.Errorf("DirectoryName(%d) = %q, want %q", i, got, want)
+		}
+	}
+	imports, ok := d.Data.([]Import)
+	if !ok {
+		t.Fatalf("import directory parsed as %T, want []Import", d.Data)
+	}
+	syms, err := f.ImportedSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imports) != len(syms) {
+		t.Fatalf("got %d imports, want %d", len(imports), len(syms))
+	}
+	for i, imp := range imports {
+		if s := imp.Name + ":" + imp.DLL; s != syms[i] {
+			t.Errorf("import %d = %q, want %q", i, s, syms[i])
+		}
+	}
+
+	if _, err := f.DataDirectory(16); err == nil {
+		t.Errorf("DataDirectory(16) succeeded")
+	}
+	obj, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if _, err := obj.DataDirectory(1); err == nil {
+		t.Errorf("DataDirectory succeeded on an object file")
+	}
+}
+
+func TestDecodedSection(t *testing.T) {
+	f := &File{
+		Sections: []*Section{
+			NewSection(SectionHeader{Name: ".drectve"}, []byte("/DEFAULTLIB:kernel32.lib ")),
+			NewSection(SectionHeader{Name: ".custom"}, []byte("payload")),
+		},
+	}
+	d, err := f.DecodedSection(".drectve")
+	if want := []LinkerDirective{{"DEFAULTLIB", "kernel32.lib"}}; err != nil || !reflect.DeepEqual(d, want) {
+		t.Errorf("DecodedSection(.drectve) = %#v, %v; want %#v", d, err, want)
+	}
+	if d, err := f.DecodedSection(".sxdata"); d != nil || err != nil {
+		t.Errorf("DecodedSection of a missing section = %v, %v; want nil", d, err)
+	}
+	if _, err := f.DecodedSection(".custom"); err == nil {
+		t.Errorf("DecodedSection of a section without decoder succeeded")
+	}
+
+	RegisterSectionDecoder(".custom", func(f *File, s *Section) (interface{}, error) {
+		b, err := s.Data()
+		return string(b), err
+	})
+	d, err = f.DecodedSection(".custom")
+	if err != nil || d != "payload" {
+		t.Errorf("DecodedSection(.custom) = %#v, %v; want \"payload\"", d, err)
+	}
+	RegisterSectionDecoder(".custom", nil)
+	if _, err := f.DecodedSection(".custom"); err == nil {
+		t.Errorf("DecodedSection succeeded after removing the decoder")
+	}
+}
+
+func TestAuthenticodeDigests(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pad the file as signing tools do, so
+	// that signing does not change it.
+	orig = append(orig, make([]byte, alignUp(int64(len(orig)), 8)-int64(len(orig)))...)
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteCertificates(&buf, []Certificate{{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("signed data")}}); err != nil {
+		t.Fatal(err)
+	}
+	signed := buf.Bytes()
+	g, err := NewFile(bytes.NewReader(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hash the signed file by hand.
+	ck := int(g.base) + 20 + ohCheckSum
+	dd := g.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_SECURITY)
+	off, _ := g.certificateTable()
+	h := sha256.New()
+	h.Write(signed[:ck])
+	h.Write(signed[ck+4 : dd])
+	h.Write(signed[dd+8 : off])
+	want := h.Sum(nil)
+
+	sums, err := g.AuthenticodeDigests(md5.New(), sha1.New(), sha256.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sums[2], want) {
+		t.Errorf("SHA-256 digest = %x, want %x", sums[2], want)
+	}
+	for i, h := range []hash.Hash{md5.New(), sha1.New(), sha256.New()} {
+		sum, err := g.AuthenticodeDigest(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sum, sums[i]) {
+			t.Errorf("AuthenticodeDigest = %x, AuthenticodeDigests = %x", sum, sums[i])
+		}
+	}
+
+	// Signing must not change the digest.
+	sum, err := f.AuthenticodeDigest(sha256.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sum, want) {
+		t.Errorf("digest of the unsigned file = %x, want %x", sum, want)
+	}
+}
+
+func TestTooManyImports(t *testing.T) {
+	// Descriptors sharing one lookup table
+	// must not add up to too many imports.
+	const thunks, descs = 4096, maxImports/4096 + 1
+	sec := make([]byte, 8*(thunks+1)+0x10+20*(descs+1))
+	for i := 0; i < thunks; i++ {
+		binary.LittleEndian.PutUint64(sec[8*i:], 1<<63|uint64(i)) // by ordinal
+	}
+	name := 8 * (thunks + 1)
+	copy(sec[name:], "k.dll\x00")
+	dir := name + 0x10
+	for i := 0; i < descs; i++ {
+		desc := sec[dir+20*i:]
+		binary.LittleEndian.PutUint32(desc[0:], testSectionRVA)               // OriginalFirstThunk
+		binary.LittleEndian.PutUint32(desc[12:], testSectionRVA+uint32(name)) // Name
+		binary.LittleEndian.PutUint32(desc[16:], testSectionRVA)              // FirstThunk
+	}
+	img := makeTestImage(sec, map[int]DataDirectory{IMAGE_DIRECTORY_ENTRY_IMPORT: {testSectionRVA + uint32(dir), 20 * (descs + 1)}})
+	f, err := NewFile(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Imports(); err == nil {
+		t.Errorf("Imports succeeded with %d imports", thunks*descs)
+	} else if fe, ok := err.(*FormatError); !ok || fe.Err != ErrOutOfBounds {
+		t.Errorf("Imports with %d imports: got error %v, want ErrOutOfBounds", thunks*descs, err)
+	}
+}
+
+func TestZeroFillSize(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sectab := int(f.base) + 20 + int(f.SizeOfOptionalHeader)
+	found := false
+	for i, s := range f.Sections {
+		if s.Name != ".idata" {
+			continue
+		}
+		found = true
+		// An .idata section with no raw data and a huge
+		// SizeOfRawData must not be read as gigabytes of zeros.
+		b := append([]byte(nil), data...)
+		sh := b[sectab+40*i:]
+		binary.LittleEndian.PutUint32(sh[16:], 0xe4000400) // SizeOfRawData
+		binary.LittleEndian.PutUint32(sh[20:], 0)          // PointerToRawData
+		g, err := NewFile(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := int(g.OptionalHeader.(*OptionalHeader32).SizeOfImage)
+		if d, err := g.Sections[i].Data(); len(d) != size || err != io.EOF {
+			t.Errorf("Data of .idata = %d bytes, %v; want %d bytes, io.EOF", len(d), err, size)
+		}
+		if _, err := g.ImportedSymbols(); err == nil {
+			t.Errorf("ImportedSymbols succeeded on an empty .idata section")
+		}
+
+		// The same goes for images, which read as zeros
+		// wherever the dump has no data.
+		img, err := NewFileFromImage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, _ := img.Sections[i].Data(); len(d) > size {
+			t.Errorf("Data of .idata in an image = %d bytes, want at most %d", len(d), size)
+		}
+	}
+	if !found {
+		t.Fatal("no .idata section")
+	}
+}
+
+func TestOptionsDone(t *testing.T) {
+	const name = "testdata/gcc-amd64-mingw-obj"
+	errCanceled := errors.New("canceled")
+	// countdown returns a Done function that fails
+	// after it has been called n times.
+	countdown := func(n int) func() error {
+		return func() error {
+			if n <= 0 {
+				return errCanceled
+			}
+			n--
+			return nil
+		}
+	}
+
+	// Cancel at each phase in turn, until parsing completes.
+	for n := 0; ; n++ {
+		if n > 100 {
+			t.Fatal("parsing never completes")
+		}
+		f, err := OpenWithOptions(name, &Options{Mode: ParseStrict, Done: countdown(n)})
+		if err == nil {
+			if n < 4 {
+				t.Errorf("parsing completed after %d checks", n)
+			}
+			f.Close()
+			break
+		}
+		if err != errCanceled {
+			t.Fatalf("done after %d checks: got error %v, want %v", n, err, errCanceled)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A FrameTable holds the DWARF call frame information of an image
+// or object, from its .eh_frame or .debug_frame section. Binaries
+// built by MinGW for 386 have no exception directory, so unwinding
+// them relies on this information.
+type FrameTable struct {
+	Section *Section
+	CIEs    []*CIE // in order of offset
+	FDEs    []*FDE // in order of offset
+}
+
+// A CIE is a common information entry of a FrameTable,
+// holding what its frame description entries share.
+type CIE struct {
+	Offset                int64 // offset of the entry in its section
+	Version               uint8
+	Augmentation          string
+	AddressSize           uint8 // size of addresses in the FDEs
+	CodeAlignmentFactor   uint64
+	DataAlignmentFactor   int64
+	ReturnAddressRegister uint64
+
+	// FDEEncoding and LSDAEncoding are the DW_EH_PE pointer
+	// encodings of the addresses in the FDEs and of their
+	// language-specific data areas, given by the "R" and "L"
+	// augmentations. Personality is the address of the
+	// personality routine, given by the "P" augmentation.
+	// SignalFrame reports the "S" augmentation.
+	FDEEncoding  uint8
+	LSDAEncoding uint8
+	Personality  uint64
+	SignalFrame  bool
+
+	// InitialInstructions are the call frame instructions
+	// that set up the rules for every FDE, undecoded.
+	InitialInstructions []byte
+}
+
+// An FDE is a frame description entry of a FrameTable, describing
+// how to unwind the frame of the code from Begin to Begin+Size.
+type FDE struct {
+	Offset int64 // offset of the entry in its section
+	CIE    *CIE
+	Begin  uint64
+	Size   uint64
+	LSDA   uint64 // address of the language-specific data area, or 0
+
+	// Instructions are the call frame instructions of the
+	// entry, which follow the InitialInstructions of its CIE,
+	// undecoded.
+	Instructions []byte
+}
+
+// Contains reports whether the code at address pc is described by e.
+func (e *FDE) Contains(pc uint64) bool {
+	return e.Begin <= pc && pc-e.Begin < e.Size
+}
+
+// FDE returns the frame description entry of t
+// describing the code at address pc, or nil if none does.
+func (t *FrameTable) FDE(pc uint64) *FDE {
+	for _, e := range t.FDEs {
+		if e.Contains(pc) {
+			return e
+		}
+	}
+	return nil
+}
+
+// Pointer encodings (DW_EH_PE) of .eh_frame. The low bits give the
+// format of the value, the high bits what it is relative to.
+const (
+	ehPtrAbs     = 0x00
+	ehPtrULEB128 = 0x01
+	ehPtrUData2  = 0x02
+	ehPtrUData4  = 0x03
+	ehPtrUData8  = 0x04
+	ehPtrSLEB128 = 0x09
+	ehPtrSData2  = 0x0a
+	ehPtrSData4  = 0x0b
+	ehPtrSData8  = 0x0c
+	ehPtrPCRel   = 0x10
+	ehPtrOmit    = 0xff
+)
+
+// FrameTable returns the call frame information in the section name
+// of f, either ".eh_frame" or ".debug_frame", or nil if f has no such
+// section. As for DWARF, compressed sections are decompressed and in
+// object files relocations are applied, which makes addresses offsets
+// in the section holding their symbol. In images, addresses are
+// virtual addresses. Pointers encoded relative to other things than
+// their own location, which MinGW does not use, are left as stored.
+func (f *File) FrameTable(name string) (*FrameTable, error) {
+	var eh bool
+	switch name {
+	case ".eh_frame":
+		eh = true
+	case ".debug_frame":
+	default:
+		return nil, errors.New("pe: no call frame information in section " + name)
+	}
+	s := f.Section(name)
+	if s == nil && !eh {
+		s = f.Section(".zdebug_frame")
+	}
+	if s == nil {
+		return nil, nil
+	}
+	b, err := s.dwarfData()
+	if err != nil {
+		return nil, err
+	}
+	if b, err = f.relocateDWARF(s, b); err != nil {
+		return nil, err
+	}
+	addrSize := uint8(4)
+	if oh := f.optionalHeader(); oh != nil && oh.pe64 || f.Machine == IMAGE_FILE_MACHINE_AMD64 || f.Machine == IMAGE_FILE_MACHINE_ARM64 {
+		addrSize = 8
+	}
+	r := &frameReader{
+		b:        b,
+		eh:       eh,
+		addrSize: addrSize,
+		cies:     make(map[int64]*CIE),
+		t:        &FrameTable{Section: s},
+	}
+	if f.OptionalHeader != nil {
+		r.base = f.imageBase() + uint64(s.VirtualAddress)
+	}
+	for off := int64(0); off < int64(len(b)); {
+		next, err := r.entry(off)
+		if err != nil {
+			if s.Offset != 0 {
+				err.Off = int64(s.Offset) + off
+			}
+			return nil, err
+		}
+		if next < 0 {
+			break
+		}
+		off = next
+	}
+	return r.t, nil
+}
+
+// A frameReader reads the entries of a FrameTable from b,
+// the contents of its section, which is at address base.
+type frameReader struct {
+	b        []byte
+	eh       bool // reading .eh_frame rather than .debug_frame
+	addrSize uint8
+	base     uint64
+	cies     map[int64]*CIE
+	t        *FrameTable
+}
+
+// entry reads the entry at offset off and returns the offset of the
+// next one, or -1 if the entry is the terminator of .eh_frame.
+func (r *frameReader) entry(off int64) (int64, *FormatError) {
+	d := &frameData{r: r, b: r.b, off: int(off)}
+	length, dwarf64 := d.initialLength()
+	if d.err != nil {
+		return 0, d.err
+	}
+	if length == 0 {
+		if r.eh {
+			return -1, nil
+		}
+		return int64(d.off), nil
+	}
+	if length > uint64(len(r.b)-d.off) {
+		return 0, &FormatError{-1, "call frame entry", ErrOutOfBounds, length}
+	}
+	end := d.off + int(length)
+	d.b = r.b[:end]
+	idOff := d.off
+	var id uint64
+	if dwarf64 {
+		id = d.u64()
+	} else {
+		id = uint64(d.u32())
+	}
+	switch {
+	case r.eh && id == 0, !r.eh && (id == 0xffffffff || dwarf64 && id == 1<<64-1):
+		if _, err := r.cie(off); err != nil {
+			return 0, err
+		}
+	default:
+		cieOff := int64(id)
+		if r.eh {
+			// The pointer is relative to its own location.
+			cieOff = int64(idOff) - int64(id)
+		}
+		c, err := r.cie(cieOff)
+		if err != nil {
+			return 0, err
+		}
+		e := &FDE{Offset: off, CIE: c}
+		if r.eh {
+			e.Begin = d.pointer(c.FDEEncoding)
+			e.Size = d.pointer(c.FDEEncoding &^ 0x70)
+			if c.Augmentation != "" && c.Augmentation[0] == 'z' {
+				n := d.uleb()
+				augEnd := d.off + int(n)
+				if n > uint64(len(d.b)-d.off) {
+					return 0, &FormatError{-1, "call frame entry augmentation", ErrOutOfBounds, n}
+				}
+				if hasByte(c.Augmentation, 'L') && c.LSDAEncoding != ehPtrOmit {
+					e.LSDA = d.pointer(c.LSDAEncoding)
+				}
+				d.off = augEnd
+			}
+		} else {
+			e.Begin = d.addr(c.AddressSize)
+			e.Size = d.addr(c.AddressSize)
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+		e.Instructions = d.b[d.off:end:end]
+		r.t.FDEs = append(r.t.FDEs, e)
+	}
+	return int64(end), nil
+}
+
+// cie returns the CIE at offset off, reading it on first use.
+func (r *frameReader) cie(off int64) (*CIE, *FormatError) {
+	if c, ok := r.cies[off]; ok {
+		return c, nil
+	}
+	if off < 0 || off >= int64(len(r.b)) {
+		return nil, &FormatError{-1, "call frame CIE pointer", ErrOutOfBounds, off}
+	}
+	d := &frameData{r: r, b: r.b, off: int(off)}
+	length, dwarf64 := d.initialLength()
+	if d.err == nil && length > uint64(len(r.b)-d.off) {
+		return nil, &FormatError{-1, "call frame CIE", ErrOutOfBounds, length}
+	}
+	end := d.off + int(length)
+	d.b = r.b[:end]
+	var id uint64
+	if dwarf64 {
+		id = d.u64()
+	} else {
+		id = uint64(d.u32())
+	}
+	if d.err == nil && (r.eh && id != 0 || !r.eh && id != 0xffffffff && !(dwarf64 && id == 1<<64-1)) {
+		return nil, &FormatError{-1, "call frame CIE pointer", errors.New("does not point to a CIE"), off}
+	}
+	c := &CIE{Offset: off, AddressSize: r.addrSize, FDEEncoding: ehPtrAbs, LSDAEncoding: ehPtrOmit}
+	c.Version = d.u8()
+	switch c.Version {
+	case 1, 3, 4:
+	default:
+		if d.err == nil {
+			return nil, &FormatError{-1, "call frame CIE version", errors.New("unsupported"), c.Version}
+		}
+	}
+	c.Augmentation = d.cstring()
+	if c.Augmentation == "eh" {
+		// Old GCC versions store the address of
+		// the exception table here.
+		d.addr(r.addrSize)
+	}
+	if c.Version >= 4 {
+		c.AddressSize = d.u8()
+		d.u8() // segment selector size
+		if d.err == nil && c.AddressSize != 4 && c.AddressSize != 8 {
+			return nil, &FormatError{-1, "call frame CIE address size", errors.New("unsupported"), c.AddressSize}
+		}
+	}
+	c.CodeAlignmentFactor = d.uleb()
+	c.DataAlignmentFactor = d.sleb()
+	if c.Version == 1 {
+		c.ReturnAddressRegister = uint64(d.u8())
+	} else {
+		c.ReturnAddressRegister = d.uleb()
+	}
+	if c.Augmentation != "" && c.Augmentation[0] == 'z' {
+		n := d.uleb()
+		if d.err == nil && n > uint64(len(d.b)-d.off) {
+			return nil, &FormatError{-1, "call frame CIE augmentation", ErrOutOfBounds, n}
+		}
+		augEnd := d.off + int(n)
+		for _, a := range c.Augmentation[1:] {
+			switch a {
+			case 'L':
+				c.LSDAEncoding = d.u8()
+			case 'P':
+				c.Personality = d.pointer(d.u8())
+			case 'R':
+				c.FDEEncoding = d.u8()
+			case 'S':
+				c.SignalFrame = true
+			}
+		}
+		d.off = augEnd
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	c.InitialInstructions = d.b[d.off:end:end]
+	r.cies[off] = c
+	r.t.CIEs = append(r.t.CIEs, c)
+	if len(r.t.CIEs) > 1 && r.t.CIEs[len(r.t.CIEs)-2].Offset > off {
+		// A CIE read ahead of its turn; keep them in order.
+		for i := len(r.t.CIEs) - 1; i > 0 && r.t.CIEs[i-1].Offset > off; i-- {
+			r.t.CIEs[i], r.t.CIEs[i-1] = r.t.CIEs[i-1], r.t.CIEs[i]
+		}
+	}
+	return c, nil
+}
+
+// hasByte reports whether s holds the byte c.
+func hasByte(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// frameData decodes the fields of a call frame entry in b, starting
+// at off. The first error is kept in err, after which reads return
+// zero values.
+type frameData struct {
+	r   *frameReader
+	b   []byte
+	off int
+	err *FormatError
+}
+
+func (d *frameData) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.b)-d.off {
+		d.err = &FormatError{-1, "call frame entry", ErrTruncated, d.off}
+		return nil
+	}
+	p := d.b[d.off : d.off+n]
+	d.off += n
+	return p
+}
+
+func (d *frameData) u8() uint8 {
+	if p := d.bytes(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (d *frameData) u16() uint16 {
+	if p := d.bytes(2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (d *frameData) u32() uint32 {
+	if p := d.bytes(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (d *frameData) u64() uint64 {
+	if p := d.bytes(8); p != nil {
+		return binary.LittleEndian.Uint64(p)
+	}
+	return 0
+}
+
+// addr reads an address of size bytes.
+func (d *frameData) addr(size uint8) uint64 {
+	if size == 8 {
+		return d.u64()
+	}
+	return uint64(d.u32())
+}
+
+// initialLength reads the length of an entry and
+// reports whether it is in the 64-bit DWARF format.
+func (d *frameData) initialLength() (uint64, bool) {
+	n := d.u32()
+	if n == 0xffffffff {
+		return d.u64(), true
+	}
+	return uint64(n), false
+}
+
+func (d *frameData) cstring() string {
+	if d.err != nil {
+		return ""
+	}
+	for i := d.off; i < len(d.b); i++ {
+		if d.b[i] == 0 {
+			s := string(d.b[d.off:i])
+			d.off = i + 1
+			return s
+		}
+	}
+	d.err = &FormatError{-1, "call frame entry", ErrTruncated, d.off}
+	return ""
+}
+
+func (d *frameData) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		c := d.u8()
+		if shift < 64 {
+			v |= uint64(c&0x7f) << shift
+		}
+		if c&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func (d *frameData) sleb() int64 {
+	var v int64
+	shift := uint(0)
+	for {
+		c := d.u8()
+		if shift < 64 {
+			v |= int64(c&0x7f) << shift
+		}
+		shift += 7
+		if c&0x80 == 0 {
+			if shift < 64 && c&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v
+		}
+	}
+}
+
+// pointer reads a pointer in the DW_EH_PE encoding enc.
+func (d *frameData) pointer(enc uint8) uint64 {
+	if enc == ehPtrOmit {
+		return 0
+	}
+	at := d.r.base + uint64(d.off)
+	var v uint64
+	switch enc & 0x0f {
+	case ehPtrAbs:
+		v = d.addr(d.r.addrSize)
+	case ehPtrULEB128:
+		v = d.uleb()
+	case ehPtrUData2:
+		v = uint64(d.u16())
+	case ehPtrUData4:
+		v = uint64(d.u32())
+	case ehPtrUData8, ehPtrSData8:
+		v = d.u64()
+	case ehPtrSLEB128:
+		v = uint64(d.sleb())
+	case ehPtrSData2:
+		v = uint64(int16(d.u16()))
+	case ehPtrSData4:
+		v = uint64(int32(d.u32()))
+	default:
+		if d.err == nil {
+			d.err = &FormatError{-1, "call frame pointer encoding", errors.New("unsupported"), enc}
+		}
+		return 0
+	}
+	if enc&0x70 == ehPtrPCRel {
+		v += at
+	}
+	if d.r.addrSize == 4 {
+		v = uint64(uint32(v))
+	}
+	return v
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFrameTable(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec", "testdata/gcc-386-mingw-obj"} {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ft, err := f.FrameTable(".eh_frame"); ft != nil || err != nil {
+			t.Errorf("%s: FrameTable(.eh_frame) = %v, %v, want none", file, ft, err)
+		}
+		ft, err := f.FrameTable(".debug_frame")
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if ft == nil || len(ft.CIEs) == 0 || len(ft.FDEs) == 0 {
+			t.Fatalf("%s: FrameTable(.debug_frame) = %+v", file, ft)
+		}
+		for _, c := range ft.CIEs {
+			if c.Version != 1 || c.CodeAlignmentFactor != 1 || c.DataAlignmentFactor != -int64(c.AddressSize) || len(c.InitialInstructions) == 0 {
+				t.Errorf("%s: CIE %+v", file, c)
+			}
+		}
+		for _, e := range ft.FDEs {
+			if e.Size == 0 || e.CIE == nil {
+				t.Errorf("%s: FDE %+v", file, e)
+			}
+		}
+		// The 386 binaries describe main. In images, it is found
+		// by address; in objects, the relocated FDE gives its
+		// offset in .text.
+		for _, s := range f.Symbols {
+			if f.Machine != IMAGE_FILE_MACHINE_I386 {
+				break
+			}
+			if s.Name != "main" && s.Name != "_main" || s.SectionNumber <= 0 {
+				continue
+			}
+			pc := uint64(s.Value)
+			if f.OptionalHeader != nil {
+				if pc, err = f.SymbolAddress(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if e := ft.FDE(pc); e == nil || e.Begin != pc {
+				t.Errorf("%s: FDE(%#x) = %+v", file, pc, e)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestEHFrame(t *testing.T) {
+	const base, rva = 0x400000, 0x3000
+	var b []byte
+	u32 := func(v uint32) {
+		var p [4]byte
+		binary.LittleEndian.PutUint32(p[:], v)
+		b = append(b, p[:]...)
+	}
+
+	// A CIE with a personality routine, LSDA pointers
+	// and PC-relative FDE addresses, as GCC emits.
+	u32(0) // length, set below
+	u32(0) // CIE ID
+	b = append(b, 1, 'z', 'P', 'L', 'R', 0, 1, 0x7c, 8)
+	b = append(b, 7, 0x00)
+	u32(0x401800) // personality
+	b = append(b, 0x00, 0x1b, 0x0c, 0x04, 0x04)
+	binary.LittleEndian.PutUint32(b, uint32(len(b)-4))
+
+	fde := len(b)
+	u32(0)                                        // length, set below
+	u32(uint32(len(b)))                           // CIE pointer
+	u32(uint32(0x401000 - (base + rva + len(b)))) // PC-relative begin
+	u32(0x20)                                     // size
+	b = append(b, 4)
+	u32(0x402000) // LSDA
+	b = append(b, 0x41, 0x0e, 0x08)
+	binary.LittleEndian.PutUint32(b[fde:], uint32(len(b)-fde-4))
+	u32(0) // terminator
+	b = append(b, "garbage"...)
+
+	f := &File{
+		OptionalHeader: &OptionalHeader32{ImageBase: base},
+		Sections:       []*Section{NewSection(SectionHeader{Name: ".eh_frame", VirtualAddress: rva}, b)},
+	}
+	ft, err := f.FrameTable(".eh_frame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.CIEs) != 1 || len(ft.FDEs) != 1 {
+		t.Fatalf("FrameTable = %+v", ft)
+	}
+	c, e := ft.CIEs[0], ft.FDEs[0]
+	if c.Augmentation != "zPLR" || c.Personality != 0x401800 || c.FDEEncoding != 0x1b || c.DataAlignmentFactor != -4 || c.ReturnAddressRegister != 8 || !bytes.Equal(c.InitialInstructions, []byte{0x0c, 0x04, 0x04}) {
+		t.Errorf("CIE = %+v", c)
+	}
+	if e.CIE != c || e.Begin != 0x401000 || e.Size != 0x20 || e.LSDA != 0x402000 || !bytes.Equal(e.Instructions, []byte{0x41, 0x0e, 0x08}) {
+		t.Errorf("FDE = %+v", e)
+	}
+	if ft.FDE(0x40101f) != e || ft.FDE(0x401020) != nil {
+		t.Errorf("FDE lookup failed")
+	}
+
+	// A bad CIE pointer is reported.
+	binary.LittleEndian.PutUint32(b[fde+4:], uint32(fde+8))
+	if ft, err := f.FrameTable(".eh_frame"); err == nil {
+		t.Errorf("FrameTable with a bad CIE pointer = %+v", ft)
+	}
+	if _, err := f.FrameTable(".text"); err == nil {
+		t.Errorf("FrameTable(.text) succeeded")
+	}
+}
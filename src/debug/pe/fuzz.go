@@ -0,0 +1,205 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package pe
+
+import (
+	"bytes"
+	"crypto/md5"
+	"io/ioutil"
+)
+
+// This file holds entry points for go-fuzz
+// (https://github.com/dvyukov/go-fuzz), one for each
+// parser in the package. Select one with go-fuzz -func.
+
+// fuzzModes are the ways FuzzNewFile opens its input.
+var fuzzModes = []*Options{
+	nil,
+	{Mode: ParseStrict},
+	{Mode: ParsePermissive},
+	{Recover: true},
+	{LazySymbols: true, Recover: true},
+	{Recover: true, Parallelism: 4},
+}
+
+// fuzzRelocateOptions are the options FuzzNewFile relocates with.
+var fuzzRelocateOptions = &RelocateOptions{
+	Address:       0x10000,
+	SymbolAddress: func(i uint32) (uint64, error) { return 0x20000 + uint64(i)*16, nil },
+}
+
+// FuzzNewFile exercises the header, section,
+// symbol, string table and relocation parsers,
+// the file index, the object writer, the
+// relocation engine and Sniff.
+func FuzzNewFile(data []byte) int {
+	Sniff(bytes.NewReader(data))
+	score := 0
+	for _, opts := range fuzzModes {
+		f, err := NewFileWithOptions(bytes.NewReader(data), opts)
+		if err != nil {
+			continue
+		}
+		score = 1
+		f.LoadSymbols()
+		f.SymbolTable()
+		f.FrameTable(".eh_frame")
+		f.FrameTable(".debug_frame")
+		f.GoBuildID()
+		f.GoSymTable()
+		if x, err := f.Index(); err == nil {
+			var buf bytes.Buffer
+			x.WriteTo(&buf)
+			if x, err := ReadFileIndex(&buf); err == nil {
+				if g, err := NewFileWithOptions(bytes.NewReader(data), &Options{Index: x}); err == nil {
+					if len(x.Symbols) > 0 {
+						g.LookupSymbol(x.Symbols[0].Name)
+					}
+				}
+			}
+		}
+		for _, s := range f.Sections {
+			// Uninitialized data legitimately reads
+			// as any number of zeros, so skip it.
+			if s.Offset != 0 {
+				if d, err := s.Data(); err == nil {
+					f.Relocate(s, d, fuzzRelocateOptions)
+				}
+			}
+			s.VirtualReader().ReadAt(make([]byte, 16), 0)
+			f.ReadRVA(s.VirtualAddress, 64)
+		}
+		f.Overlay()
+		f.FileRegions()
+		if slack, err := f.SlackRegions(); err == nil {
+			for i := range slack {
+				slack[i].Data()
+			}
+		}
+		f.OwnerOf(0x100)
+		f.Sum(md5.New())
+		if oh := f.optionalHeader(); oh != nil && oh.sizeOfImage <= 16<<20 {
+			f.MappedSum(md5.New())
+		}
+		if f.OptionalHeader == nil {
+			f.WriteObject(ioutil.Discard, nil)
+			f.WriteObject(ioutil.Discard, &WriteOptions{Deterministic: true})
+		}
+	}
+	return score
+}
+
+// FuzzImports exercises the import, export, resource, debug, CLR,
+// load configuration and certificate directory parsers.
+func FuzzImports(data []byte) int {
+	f, err := NewFileWithOptions(bytes.NewReader(data), &Options{Mode: ParsePermissive})
+	if err != nil {
+		return 0
+	}
+	f.ImportedSymbols()
+	f.Exports()
+	f.IAT()
+	if d, err := f.Resources(); err == nil && d != nil {
+		d.Resources()
+	}
+	f.GuardCFFunctions()
+	f.GuardLongJumpTargets()
+	f.GuardEHContinuations()
+	f.HotPatchInfo()
+	f.EnclaveConfig()
+	f.VolatileMetadata()
+	f.APISetSchema()
+	f.DllCharacteristicsEx()
+	f.Toolchain()
+	f.POGOInfo()
+	f.SPGOInfo()
+	if res, err := f.ManagedResources(); err == nil {
+		for _, r := range res {
+			ParseResourceSet(r.Data)
+		}
+	}
+	f.AuthenticodeSignatures()
+	f.AuthenticodeDigest(md5.New())
+	f.EntryPoint(64)
+	// Bind f to its own exports.
+	self := &ExportResolver{
+		Files:    map[string]*File{"self.dll": f},
+		Redirect: func(string) string { return "self.dll" },
+	}
+	f.CheckImportHints(self)
+	f.WriteBound(ioutil.Discard, self)
+	if imps, err := f.Imports(); err == nil {
+		self.ResolveOrdinals(imps, "self.dll")
+	}
+	if _, err := f.ImpHash(); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzImage exercises the parsing of loaded images, the
+// detection of IAT hooks and unmapping.
+func FuzzImage(data []byte) int {
+	f, err := NewFileFromImage(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	// Check the hooks of the image against its own exports.
+	f.IATHooks(&ExportResolver{Files: map[string]*File{"self.dll": f}})
+	if err := f.Unmap(ioutil.Discard, &UnmapOptions{RestoreIAT: true}); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzSymbols exercises the COFF symbol table readers
+// on a file in memory and streamed, and the other
+// parsers of object file sections.
+func FuzzSymbols(data []byte) int {
+	f, err := NewFileFromBytes(data, nil)
+	if err != nil {
+		return 0
+	}
+	f.WalkCOFFSymbols(func(int, *COFFSymbol) bool { return true })
+	f.ValidateSymbols()
+	f.SymbolsSeq()(func(*Symbol, error) bool { return true })
+	f.LinkerDirectives()
+	f.Feat00()
+	f.SafeSEHHandlers()
+	for _, s := range f.Sections {
+		f.DecodedSection(s.Name)
+	}
+	return 1
+}
+
+// FuzzRes exercises the .res file reader and writer
+// and the decoders of resource data.
+func FuzzRes(data []byte) int {
+	res, err := ReadRes(bytes.NewReader(data))
+	if err != nil {
+		return 0
+	}
+	if _, err := NewResourceDirectory(res); err != nil {
+		return 0
+	}
+	if err := WriteRes(ioutil.Discard, res); err != nil {
+		panic(err)
+	}
+	for _, r := range res {
+		switch r.Type {
+		case ResourceID{ID: RT_DIALOG}:
+			ParseDialog(r.Data)
+		case ResourceID{ID: RT_MENU}:
+			ParseMenu(r.Data)
+		case ResourceID{ID: RT_ACCELERATOR}:
+			ParseAccelerators(r.Data)
+		case ResourceID{Name: "MUI"}:
+			ParseMUI(r.Data)
+		}
+	}
+	return 1
+}
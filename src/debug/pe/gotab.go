@@ -0,0 +1,239 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"debug/gosym"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// buildInfoMagic starts the build information blob
+// that the Go linker writes into binaries since Go 1.13.
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+// The Go linker writes the build ID as a quoted
+// string between these markers.
+var (
+	goBuildIDPrefix = []byte("\xff Go build ID: \"")
+	goBuildIDSuffix = []byte("\"\n \xff")
+)
+
+// goBuildIDSearchSize is how far into the text section
+// GoBuildID looks, as "go tool buildid" does.
+const goBuildIDSearchSize = 32 << 10
+
+// GoPCLNTab locates the Go line table, runtime.pclntab, in f and
+// returns its virtual address and contents, for use with
+// debug/gosym. It returns a nil slice if f has none.
+//
+// The table is found from a .gopclntab section if there is one,
+// then from the runtime.pclntab and runtime.epclntab symbols, and
+// failing that, in stripped binaries, by looking in the sections
+// for the table header. In the last case the end of the table is
+// unknown and the returned data runs to the end of its section;
+// debug/gosym ignores the extra bytes.
+func (f *File) GoPCLNTab() (addr uint64, data []byte, err error) {
+	if s := f.Section(".gopclntab"); s != nil {
+		data, err := s.Data()
+		if err != nil {
+			return 0, nil, err
+		}
+		return f.imageBase() + uint64(s.VirtualAddress), data, nil
+	}
+	if err := f.ensureSymbols(); err != nil {
+		return 0, nil, err
+	}
+	for _, names := range [][2]string{{"runtime.pclntab", "runtime.epclntab"}, {"pclntab", "epclntab"}} {
+		addr, data, err := f.goSymbolTable(names[0], names[1])
+		if data != nil || err != nil {
+			return addr, data, err
+		}
+	}
+	return f.scanGoTable(isPCLNTabHeader, 4)
+}
+
+// GoSymTable returns the symbol table of a Go binary in f, built
+// from the Go line table found by GoPCLNTab and, in binaries of Go
+// 1.2 and earlier, the symbols between runtime.symtab and
+// runtime.esymtab. It returns nil if f has no Go line table.
+//
+// The text segment is taken to start at the runtime.text symbol if
+// f has one, and otherwise at the .text section.
+func (f *File) GoSymTable() (*gosym.Table, error) {
+	_, pclntab, err := f.GoPCLNTab()
+	if pclntab == nil || err != nil {
+		return nil, err
+	}
+	var symtab []byte
+	for _, names := range [][2]string{{"runtime.symtab", "runtime.esymtab"}, {"symtab", "esymtab"}} {
+		_, symtab, err = f.goSymbolTable(names[0], names[1])
+		if symtab != nil || err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	text, _, err := f.goSymbolTable("runtime.text", "")
+	if err != nil {
+		return nil, err
+	}
+	if text == 0 {
+		if s := f.Section(".text"); s != nil {
+			text = f.imageBase() + uint64(s.VirtualAddress)
+		}
+	}
+	return gosym.NewTable(symtab, gosym.NewLineTable(pclntab, text))
+}
+
+// GoBuildInfo locates the build information blob of a Go binary
+// in f, as read by debug/buildinfo and "go version", and returns
+// its virtual address and contents. The contents start with the
+// "\xff Go buildinf:" magic and run to the end of the section
+// holding the blob. It returns a nil slice if f has none.
+//
+// The blob is found from a .go.buildinfo section if there is one,
+// then from the go:buildinfo symbol, and failing that, in stripped
+// binaries, by looking in the data sections for the magic.
+func (f *File) GoBuildInfo() (addr uint64, data []byte, err error) {
+	if s := f.Section(".go.buildinfo"); s != nil {
+		data, err := s.Data()
+		if err != nil {
+			return 0, nil, err
+		}
+		return f.imageBase() + uint64(s.VirtualAddress), data, nil
+	}
+	if err := f.ensureSymbols(); err != nil {
+		return 0, nil, err
+	}
+	for _, name := range []string{"go:buildinfo", "go.buildinfo"} {
+		addr, data, err := f.goSymbolTable(name, "")
+		if data != nil || err != nil {
+			return addr, data, err
+		}
+	}
+	return f.scanGoTable(func(b []byte) bool { return bytes.HasPrefix(b, buildInfoMagic) }, 16)
+}
+
+// GoBuildID returns the build ID of a Go binary in f, as printed by
+// "go tool buildid", or "" if f has none. The Go linker writes the
+// ID at the start of the text section, so only the first 32 kB of
+// the first code section are searched.
+func (f *File) GoBuildID() (string, error) {
+	var text *Section
+	for _, s := range f.Sections {
+		if s.Characteristics&IMAGE_SCN_CNT_CODE != 0 && s.hasRawData() {
+			text = s
+			break
+		}
+	}
+	if text == nil {
+		return "", nil
+	}
+	n := int64(goBuildIDSearchSize)
+	if sz := text.sr.Size() - text.missing; sz < n {
+		n = sz
+	}
+	b := make([]byte, n)
+	if _, err := text.ReadAt(b, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	i := bytes.Index(b, goBuildIDPrefix)
+	if i < 0 {
+		return "", nil
+	}
+	// Unquote from the opening quote to the closing one.
+	start := i + len(goBuildIDPrefix) - 1
+	j := bytes.Index(b[start+1:], goBuildIDSuffix)
+	if j < 0 {
+		return "", &FormatError{int64(text.Offset) + int64(i), "Go build ID", ErrTruncated, nil}
+	}
+	id, err := strconv.Unquote(string(b[start : start+1+j+1]))
+	if err != nil {
+		return "", &FormatError{int64(text.Offset) + int64(i), "Go build ID", err, nil}
+	}
+	return id, nil
+}
+
+// goSymbolTable returns the address and contents of the data
+// between symbols start and end, or from start to the end of its
+// section if end is empty. It returns a nil slice if the symbols
+// are not in f.
+func (f *File) goSymbolTable(start, end string) (uint64, []byte, error) {
+	var ssym, esym *Symbol
+	for _, s := range f.Symbols {
+		switch s.Name {
+		case start:
+			ssym = s
+		case end:
+			esym = s
+		}
+	}
+	if ssym == nil || end != "" && esym == nil {
+		return 0, nil, nil
+	}
+	s := f.SymbolSection(ssym)
+	if s == nil {
+		return 0, nil, fmt.Errorf("pe: symbol %s has bad section number %d", start, ssym.FullSectionNumber())
+	}
+	data, err := s.Data()
+	if err != nil {
+		return 0, nil, err
+	}
+	lo, hi := uint64(ssym.Value), uint64(len(data))
+	if esym != nil {
+		if esym.FullSectionNumber() != ssym.FullSectionNumber() {
+			return 0, nil, fmt.Errorf("pe: symbols %s and %s are in different sections", start, end)
+		}
+		hi = uint64(esym.Value)
+	}
+	if lo > hi || hi > uint64(len(data)) {
+		return 0, nil, fmt.Errorf("pe: symbols %s and %s are out of the bounds of section %s", start, end, s.Name)
+	}
+	return f.imageBase() + uint64(s.VirtualAddress) + lo, data[lo:hi], nil
+}
+
+// scanGoTable looks in the sections of f that hold initialized
+// data for the first offset, a multiple of align, at which match
+// reports a table header. It returns the address of the table and
+// the data from there to the end of the section.
+func (f *File) scanGoTable(match func([]byte) bool, align int) (uint64, []byte, error) {
+	for _, s := range f.Sections {
+		if !s.hasRawData() {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return 0, nil, err
+		}
+		for off := 0; off < len(data); off += align {
+			if match(data[off:]) {
+				return f.imageBase() + uint64(s.VirtualAddress) + uint64(off), data[off:], nil
+			}
+		}
+	}
+	return 0, nil, nil
+}
+
+// isPCLNTabHeader reports whether b starts with the header of
+// a Go line table: one of the magic numbers of Go 1.2 and later,
+// two zero bytes, the pc quantum and the pointer size.
+func isPCLNTabHeader(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(b) {
+	case 0xfffffffb, 0xfffffffa, 0xfffffff0, 0xfffffff1:
+	default:
+		return false
+	}
+	return b[4] == 0 && b[5] == 0 &&
+		(b[6] == 1 || b[6] == 2 || b[6] == 4) &&
+		(b[7] == 4 || b[7] == 8)
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+func TestGoTables(t *testing.T) {
+	pclntab := []byte{0xfb, 0xff, 0xff, 0xff, 0, 0, 1, 8, 'p', 'c'}
+	buildinfo := append(append([]byte{}, buildInfoMagic...), 8, 2)
+	rdata := make([]byte, 0x100)
+	copy(rdata[0x24:], pclntab)
+	data := make([]byte, 0x100)
+	copy(data[0x18:], buildinfo) // misaligned: not found by scanning
+	copy(data[0x40:], buildinfo)
+	newFile := func(syms []*Symbol) *File {
+		return &File{
+			OptionalHeader: &OptionalHeader64{ImageBase: 0x400000},
+			Sections: []*Section{
+				NewSection(SectionHeader{Name: ".text", VirtualAddress: 0x1000}, []byte{0xc3}),
+				NewSection(SectionHeader{Name: ".rdata", VirtualAddress: 0x2000}, rdata),
+				NewSection(SectionHeader{Name: ".data", VirtualAddress: 0x3000}, data),
+			},
+			Symbols: syms,
+		}
+	}
+	tests := []struct {
+		name           string
+		f              *File
+		pcAddr, biAddr uint64
+		pcData         []byte
+	}{
+		{
+			"symbols",
+			newFile([]*Symbol{
+				{Name: "runtime.pclntab", Value: 0x24, SectionNumber: 2},
+				{Name: "runtime.epclntab", Value: 0x24 + uint32(len(pclntab)), SectionNumber: 2},
+				{Name: "go:buildinfo", Value: 0x18, SectionNumber: 3},
+			}),
+			0x402024, 0x403018, pclntab,
+		},
+		{
+			"stripped",
+			newFile(nil),
+			0x402024, 0x403040, rdata[0x24:],
+		},
+	}
+	for _, tt := range tests {
+		addr, b, err := tt.f.GoPCLNTab()
+		if err != nil || addr != tt.pcAddr || !bytes.Equal(b, tt.pcData) {
+			t.Errorf("%s: GoPCLNTab() = %#x, %x, %v, want %#x, %x", tt.name, addr, b, err, tt.pcAddr, tt.pcData)
+		}
+		addr, b, err = tt.f.GoBuildInfo()
+		if err != nil || addr != tt.biAddr || !bytes.HasPrefix(b, buildinfo) {
+			t.Errorf("%s: GoBuildInfo() = %#x, %x, %v, want %#x", tt.name, addr, b, err, tt.biAddr)
+		}
+	}
+
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, b, err := f.GoPCLNTab(); b != nil || err != nil {
+		t.Errorf("C program: GoPCLNTab() = %x, %v", b, err)
+	}
+	if _, b, err := f.GoBuildInfo(); b != nil || err != nil {
+		t.Errorf("C program: GoBuildInfo() = %x, %v", b, err)
+	}
+}
+
+func TestGoBuildID(t *testing.T) {
+	const id = "abc/def\"ghi"
+	text := make([]byte, 0x100)
+	copy(text[0x10:], "\xff Go build ID: "+strconv.Quote(id)+"\n \xff")
+	newFile := func(text []byte) *File {
+		return &File{
+			Sections: []*Section{
+				NewSection(SectionHeader{Name: ".rdata", Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA}, []byte("\xff Go build ID: \"rdata\"\n \xff")),
+				NewSection(SectionHeader{Name: ".text", Characteristics: IMAGE_SCN_CNT_CODE}, text),
+			},
+		}
+	}
+	if got, err := newFile(text).GoBuildID(); got != id || err != nil {
+		t.Errorf("GoBuildID() = %q, %v, want %q", got, err, id)
+	}
+	if got, err := newFile(text[:0x20]).GoBuildID(); got != "" || err == nil {
+		t.Errorf("GoBuildID() of a truncated ID = %q, %v, want an error", got, err)
+	}
+
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, err := f.GoBuildID(); got != "" || err != nil {
+		t.Errorf("C program: GoBuildID() = %q, %v", got, err)
+	}
+}
+
+func TestGoSymTable(t *testing.T) {
+	// A Go 1.2 line table for a single function, main.main, of 16
+	// bytes at 0x401000, with 64-bit pointers and no file names.
+	pclntab := make([]byte, 88)
+	binary.LittleEndian.PutUint32(pclntab[0:], 0xfffffffb)
+	pclntab[6], pclntab[7] = 1, 8
+	binary.LittleEndian.PutUint64(pclntab[8:], 1)         // nfunctab
+	binary.LittleEndian.PutUint64(pclntab[16:], 0x401000) // entry
+	binary.LittleEndian.PutUint64(pclntab[24:], 48)       // func offset
+	binary.LittleEndian.PutUint64(pclntab[32:], 0x401010) // end
+	binary.LittleEndian.PutUint32(pclntab[40:], 44)       // filetab offset
+	binary.LittleEndian.PutUint32(pclntab[44:], 1)        // nfiletab
+	binary.LittleEndian.PutUint64(pclntab[48:], 0x401000) // func entry
+	binary.LittleEndian.PutUint32(pclntab[56:], 88)       // name offset
+	pclntab = append(pclntab, "main.main\x00"...)
+
+	f := &File{
+		OptionalHeader: &OptionalHeader64{ImageBase: 0x400000},
+		Sections: []*Section{
+			NewSection(SectionHeader{Name: ".text", VirtualAddress: 0x1000}, make([]byte, 0x10)),
+			NewSection(SectionHeader{Name: ".rdata", VirtualAddress: 0x2000}, pclntab),
+		},
+		Symbols: []*Symbol{
+			{Name: "runtime.text", SectionNumber: 1},
+			{Name: "runtime.pclntab", SectionNumber: 2},
+			{Name: "runtime.epclntab", Value: uint32(len(pclntab)), SectionNumber: 2},
+		},
+	}
+	tab, err := f.GoSymTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn := tab.PCToFunc(0x401008); fn == nil || fn.Name != "main.main" || fn.Entry != 0x401000 {
+		t.Errorf("PCToFunc(0x401008) = %+v, want main.main at 0x401000", fn)
+	}
+	if fn := tab.LookupFunc("main.main"); fn == nil {
+		t.Error("LookupFunc(main.main) = nil")
+	}
+
+	c, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if tab, err := c.GoSymTable(); tab != nil || err != nil {
+		t.Errorf("C program: GoSymTable() = %v, %v", tab, err)
+	}
+}
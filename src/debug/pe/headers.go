@@ -0,0 +1,63 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+// A Region is a range of bytes in a file.
+type Region struct {
+	Offset int64
+	Size   int64
+}
+
+// End returns the offset just past the end of r.
+func (r Region) End() int64 {
+	return r.Offset + r.Size
+}
+
+// HeaderLayout records where the headers of a file are.
+// Regions of headers the file does not have are empty.
+type HeaderLayout struct {
+	DOSHeader      Region
+	DOSStub        Region
+	Signature      Region // the "PE\0\0" signature
+	FileHeader     Region // or the BigObjHeader or TEHeader of big object files and TE images
+	OptionalHeader Region // SizeOfOptionalHeader bytes
+	SectionTable   Region
+}
+
+// HeaderLayout returns the file offsets and sizes of the headers of f,
+// as needed by tools that patch or sign files in place.
+func (f *File) HeaderLayout() *HeaderLayout {
+	l := new(HeaderLayout)
+	if f.DOSHeader != nil {
+		l.DOSHeader = Region{0, dosHeaderSize}
+		l.DOSStub = Region{dosHeaderSize, int64(len(f.DOSStub))}
+		l.Signature = Region{f.base - 4, 4}
+	}
+	l.FileHeader = Region{f.base, 20}
+	switch {
+	case f.BigObjHeader != nil:
+		l.FileHeader.Size = bigObjHeaderSize
+	case f.TEHeader != nil:
+		l.FileHeader.Size = teHeaderSize
+	}
+	l.OptionalHeader = Region{l.FileHeader.End(), int64(f.SizeOfOptionalHeader)}
+	l.SectionTable = Region{l.OptionalHeader.End(), f.numberOfSections() * 40}
+	return l
+}
+
+// ReadRegion returns the raw bytes of region r of the file.
+// Together with HeaderLayout, it gives access to the headers
+// exactly as stored, including fields and padding this package
+// does not parse.
+func (f *File) ReadRegion(r Region) ([]byte, error) {
+	if r.Offset < 0 || r.Size < 0 || f.size >= 0 && r.End() > f.size {
+		return nil, &FormatError{r.Offset, "region", ErrOutOfBounds, r.Size}
+	}
+	b := make([]byte, r.Size)
+	if n, err := f.r.ReadAt(b, r.Offset); n < len(b) {
+		return nil, formatError(r.Offset, "region", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "encoding/binary"
+
+// Flags of the base images of a hot patch.
+const (
+	IMAGE_HOT_PATCH_BASE_OBLIGATORY    = 0x00000001
+	IMAGE_HOT_PATCH_BASE_CAN_ROLL_BACK = 0x00000002
+)
+
+// A HotPatchInfo is the hot patch table of an image
+// (IMAGE_HOT_PATCH_INFO), which describes the images
+// a hot patch applies to.
+type HotPatchInfo struct {
+	Version        uint32
+	Size           uint32
+	SequenceNumber uint32
+	BufferOffset   uint32 // version 2 and later
+	ExtraPatchSize uint32 // version 3 and later
+
+	// Bases lists the images the patch applies to,
+	// from the BaseImageList of the table.
+	Bases []HotPatchBase
+}
+
+// A HotPatchBase describes an image a hot patch applies
+// to (IMAGE_HOT_PATCH_BASE), identified by the timestamp
+// and checksum of its headers.
+type HotPatchBase struct {
+	SequenceNumber        uint32
+	Flags                 uint32 // IMAGE_HOT_PATCH_BASE_* flags
+	OriginalTimeDateStamp uint32
+	OriginalCheckSum      uint32
+	CodeIntegrityInfo     uint32
+	CodeIntegritySize     uint32
+	PatchTable            uint32
+	BufferOffset          uint32 // version 2 and later
+}
+
+// maxHotPatchInfoSize is the size of the largest
+// known hot patch table header.
+const maxHotPatchInfoSize = 28
+
+// HotPatchInfo returns the hot patch table that the load
+// configuration of f points to, or nil if f has none.
+// HotPatchTableOffset and BaseImageList are RVAs, BaseImageList
+// pointing to BaseImageCount RVAs of HotPatchBase structures.
+func (f *File) HotPatchInfo() (*HotPatchInfo, error) {
+	lc, err := f.LoadConfig()
+	if lc == nil || lc.HotPatchTableOffset == 0 || err != nil {
+		return nil, err
+	}
+	rva := lc.HotPatchTableOffset
+	var hdr [8]byte
+	if err := f.readRVA(hdr[:], rva); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(hdr[4:]) // Size
+	if n > maxHotPatchInfoSize {
+		n = maxHotPatchInfoSize
+	}
+	if n < 20 {
+		return nil, &FormatError{-1, "hot patch table", ErrTruncated, n}
+	}
+	b := make([]byte, n)
+	if err := f.readRVA(b, rva); err != nil {
+		return nil, err
+	}
+	r := &loadConfigReader{b: b}
+	hp := &HotPatchInfo{
+		Version:        r.u32(),
+		Size:           r.u32(),
+		SequenceNumber: r.u32(),
+	}
+	list := r.u32()
+	count := r.u32()
+	hp.BufferOffset = r.u32()
+	hp.ExtraPatchSize = r.u32()
+	if count == 0 {
+		return hp, nil
+	}
+
+	// The count comes from the file, so check that
+	// the list fits in the image before allocating.
+	if uint64(count)*4 > uint64(f.optionalHeader().sizeOfImage) {
+		return nil, &FormatError{-1, "hot patch base image list", ErrOutOfBounds, count}
+	}
+	offs := make([]byte, 4*count)
+	if err := f.readRVA(offs, list); err != nil {
+		return nil, err
+	}
+	baseSize := 28
+	if hp.Version >= 2 {
+		baseSize = 32
+	}
+	hp.Bases = make([]HotPatchBase, count)
+	for i := range hp.Bases {
+		b := make([]byte, baseSize)
+		if err := f.readRVA(b, binary.LittleEndian.Uint32(offs[4*i:])); err != nil {
+			return nil, err
+		}
+		r := &loadConfigReader{b: b}
+		hp.Bases[i] = HotPatchBase{
+			SequenceNumber:        r.u32(),
+			Flags:                 r.u32(),
+			OriginalTimeDateStamp: r.u32(),
+			OriginalCheckSum:      r.u32(),
+			CodeIntegrityInfo:     r.u32(),
+			CodeIntegritySize:     r.u32(),
+			PatchTable:            r.u32(),
+			BufferOffset:          r.u32(),
+		}
+	}
+	return hp, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "encoding/binary"
+
+// An IATSlot is a slot of the import address table of an image.
+type IATSlot struct {
+	RVA uint32
+
+	// Value is the contents of the slot in the file: a copy of
+	// the import lookup table entry, or the address of the
+	// function if the image is bound. The loader overwrites it.
+	Value uint64
+
+	// Import is the function imported through the slot, or nil
+	// if no import descriptor refers to it, as for the null
+	// slots ending the table of each DLL.
+	Import *Import
+}
+
+// IAT returns the slots of the import address table of f, as given by
+// its IAT data directory, which the loader makes writable while it
+// binds imports. The directory is read on its own, apart from the
+// import descriptors; Import links each slot to its function. IAT
+// returns nil if f has no IAT directory, in which case ImportsBySlot
+// still maps the slots of the imports found by Imports.
+func (f *File) IAT() ([]IATSlot, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IAT)
+	if dd.VirtualAddress == 0 || dd.Size == 0 {
+		return nil, nil
+	}
+	thunkSize := uint32(4)
+	if oh.pe64 {
+		thunkSize = 8
+	}
+	n := dd.Size / thunkSize
+	if n > maxImportThunks {
+		return nil, &FormatError{-1, "IAT directory", ErrOutOfBounds, dd.Size}
+	}
+	b, err := f.ReadRVA(dd.VirtualAddress, int(n*thunkSize))
+	if err != nil {
+		return nil, err
+	}
+	imps, err := f.ImportsBySlot()
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]IATSlot, n)
+	for i := range slots {
+		s := &slots[i]
+		s.RVA = dd.VirtualAddress + uint32(i)*thunkSize
+		if oh.pe64 {
+			s.Value = binary.LittleEndian.Uint64(b[i*8:])
+		} else {
+			s.Value = uint64(binary.LittleEndian.Uint32(b[i*4:]))
+		}
+		if imp, ok := imps[s.RVA]; ok {
+			s.Import = &imp
+		}
+	}
+	return slots, nil
+}
+
+// ImportsBySlot returns the functions imported by f, as returned by
+// Imports, keyed by the RVA of their import address table slot. Tools
+// watching a loaded image use it to tell which function a pointer read
+// from, or a call made through, a given address refers to.
+func (f *File) ImportsBySlot() (map[uint32]Import, error) {
+	imps, err := f.Imports()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[uint32]Import, len(imps))
+	for _, imp := range imps {
+		m[imp.Slot] = imp
+	}
+	return m, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestIAT(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		imps, err := f.Imports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bySlot, err := f.ImportsBySlot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imps) == 0 || len(bySlot) != len(imps) {
+			t.Fatalf("%s: %d imports, %d by slot", file, len(imps), len(bySlot))
+		}
+		for _, imp := range imps {
+			if bySlot[imp.Slot] != imp {
+				t.Errorf("%s: ImportsBySlot()[%#x] = %+v, want %+v", file, imp.Slot, bySlot[imp.Slot], imp)
+			}
+		}
+
+		// If the IAT directory is missing, as in the 386 binary,
+		// cover the slots of all imports, with the null slot
+		// ending the table of the last DLL.
+		thunkSize := uint32(4)
+		if f.optionalHeader().pe64 {
+			thunkSize = 8
+		}
+		start, end := imps[0].Slot, imps[len(imps)-1].Slot+2*thunkSize
+		slots, err := f.IAT()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slots == nil {
+			f.setDataDirectory(raw, IMAGE_DIRECTORY_ENTRY_IAT, DataDirectory{start, end - start})
+			g, err := NewFile(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slots, err = g.IAT(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(slots) != int((end-start)/thunkSize) {
+			t.Fatalf("%s: IAT has %d slots, want %d", file, len(slots), (end-start)/thunkSize)
+		}
+		n := 0
+		for i, s := range slots {
+			if s.RVA != start+uint32(i)*thunkSize {
+				t.Errorf("%s: slot %d at %#x", file, i, s.RVA)
+			}
+			if s.Import == nil {
+				if s.Value != 0 {
+					t.Errorf("%s: slot %#x holds %#x but imports nothing", file, s.RVA, s.Value)
+				}
+				continue
+			}
+			if *s.Import != bySlot[s.RVA] || s.Value == 0 {
+				t.Errorf("%s: slot %#x = %#x, %+v, want %+v", file, s.RVA, s.Value, *s.Import, bySlot[s.RVA])
+			}
+			n++
+		}
+		if n != len(imps) {
+			t.Errorf("%s: %d slots have imports, want %d", file, n, len(imps))
+		}
+	}
+}
+
+func TestIATHooks(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		imps, err := f.Imports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.IATHooks(&ExportResolver{}); err == nil {
+			t.Errorf("%s: IATHooks of a file on disk succeeded", file)
+		}
+
+		// Make up the DLLs the file imports from,
+		// loaded one after the other from 0x10000000.
+		names := make(map[string][]testExport)
+		var dlls []string
+		for _, imp := range imps {
+			dll := strings.ToLower(imp.DLL)
+			if names[dll] == nil {
+				dlls = append(dlls, dll)
+			}
+			names[dll] = append(names[dll], testExport{name: imp.Name})
+		}
+		r := &ExportResolver{Files: make(map[string]*File)}
+		for i, dll := range dlls {
+			lib, err := NewFile(bytes.NewReader(makeTestDLL(dll, 1, names[dll])))
+			if err != nil {
+				t.Fatal(err)
+			}
+			lib.OptionalHeader.(*OptionalHeader64).ImageBase = uint64(i+1) << 28
+			r.Files[dll] = lib
+		}
+
+		// Bind the image as the loader would, then hook
+		// the first import into the last DLL, and the
+		// second one into no DLL at all.
+		var buf bytes.Buffer
+		if err := f.WriteMapped(&buf); err != nil {
+			t.Fatal(err)
+		}
+		mem := buf.Bytes()
+		pe64 := f.optionalHeader().pe64
+		put := func(slot uint32, addr uint64) {
+			if pe64 {
+				binary.LittleEndian.PutUint64(mem[slot:], addr)
+			} else {
+				binary.LittleEndian.PutUint32(mem[slot:], uint32(addr))
+			}
+		}
+		for _, imp := range imps {
+			dll, e, err := r.Resolve(imp.DLL, imp.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			put(imp.Slot, r.Files[dll].imageBase()+uint64(e.RVA))
+		}
+		last := dlls[len(dlls)-1]
+		put(imps[0].Slot, r.Files[last].imageBase()+0x10)
+		put(imps[1].Slot, 0xdead0000)
+
+		img, err := NewFileFromImage(bytes.NewReader(mem))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hooks, err := img.IATHooks(r)
+		if err != nil {
+			t.Fatalf("%s: IATHooks: %v", file, err)
+		}
+		if len(hooks) != 2 {
+			t.Fatalf("%s: IATHooks() = %+v, want 2 hooks", file, hooks)
+		}
+		for i, want := range []struct {
+			got    uint64
+			target string
+		}{
+			{r.Files[last].imageBase() + 0x10, last},
+			{0xdead0000, ""},
+		} {
+			h := hooks[i]
+			if h.Import != imps[i] || h.Module != strings.ToLower(imps[i].DLL) || h.Got != want.got || h.Target != want.target || h.Want == h.Got {
+				t.Errorf("%s: hook %d = %+v, want slot of %s holding %#x in %q", file, i, h, imps[i].Name, want.got, want.target)
+			}
+		}
+	}
+}
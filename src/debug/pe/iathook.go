@@ -0,0 +1,125 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// An IATHook is a slot of the import address table of a loaded
+// image that does not hold the address of the function it imports,
+// as when the function has been hooked by patching the table.
+type IATHook struct {
+	Import Import
+
+	// Module is the key in ExportResolver.Files of the DLL
+	// implementing the import, and Want the address of the
+	// function there.
+	Module string
+	Want   uint64
+
+	// Got is the address found in the slot, and Target the key
+	// of the DLL it lies in, or empty if it lies in none of them.
+	Got    uint64
+	Target string
+}
+
+// IATHooks compares the import address table of f, an image
+// created by NewFileFromImage from the memory of a process, with
+// the exports of the DLLs in r.Files, and returns the slots that
+// do not hold the address of the function they import, in the
+// order of Imports.
+//
+// The address of a function is the ImageBase of the DLL that
+// implements it, once forwarders are followed, plus the RVA of its
+// export. The loader records the address a DLL is loaded at in the
+// ImageBase of its headers in memory, so the DLLs should be read
+// from the same process with NewFileFromImage, or have their
+// OptionalHeader.ImageBase set to their load address. Imports of
+// DLLs missing from r.Files, and imports that cannot be resolved,
+// are not checked. Delay-load imports are not checked either.
+func (f *File) IATHooks(r *ExportResolver) ([]IATHook, error) {
+	if !f.imageLayout {
+		return nil, errors.New("pe: IATHooks requires an image loaded in memory")
+	}
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	imports, err := f.Imports()
+	if err != nil {
+		return nil, err
+	}
+	// Find the DLL an address lies in from
+	// the DLLs sorted by load address.
+	var dlls []string
+	for name, lib := range r.Files {
+		if lib.optionalHeader() != nil {
+			dlls = append(dlls, name)
+		}
+	}
+	sort.Strings(dlls)
+	sort.Stable(byImageBase{dlls, r.Files})
+	target := func(addr uint64) string {
+		i := sort.Search(len(dlls), func(i int) bool { return r.Files[dlls[i]].imageBase() > addr })
+		if i == 0 {
+			return ""
+		}
+		lib := r.Files[dlls[i-1]]
+		if addr-lib.imageBase() >= uint64(lib.optionalHeader().sizeOfImage) {
+			return ""
+		}
+		return dlls[i-1]
+	}
+
+	var hooks []IATHook
+	var b [8]byte
+	for _, imp := range imports {
+		name := imp.Name
+		if imp.ByOrdinal {
+			name = "#" + strconv.Itoa(int(imp.Ordinal))
+		}
+		module, e, err := r.ResolveFrom("", imp.DLL, name)
+		if err != nil {
+			continue
+		}
+		lib := r.Files[module]
+		if lib.optionalHeader() == nil {
+			continue
+		}
+		want := lib.imageBase() + uint64(e.RVA)
+		var got uint64
+		if oh.pe64 {
+			if err := f.readRVA(b[:8], imp.Slot); err != nil {
+				return nil, err
+			}
+			got = binary.LittleEndian.Uint64(b[:])
+		} else {
+			if err := f.readRVA(b[:4], imp.Slot); err != nil {
+				return nil, err
+			}
+			got = uint64(binary.LittleEndian.Uint32(b[:]))
+		}
+		if got != want {
+			hooks = append(hooks, IATHook{imp, module, want, got, target(got)})
+		}
+	}
+	return hooks, nil
+}
+
+// byImageBase sorts the keys of DLLs by image base.
+type byImageBase struct {
+	names []string
+	files map[string]*File
+}
+
+func (s byImageBase) Len() int { return len(s.names) }
+func (s byImageBase) Less(i, j int) bool {
+	return s.files[s.names[i]].imageBase() < s.files[s.names[j]].imageBase()
+}
+func (s byImageBase) Swap(i, j int) { s.names[i], s.names[j] = s.names[j], s.names[i] }
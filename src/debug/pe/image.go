@@ -0,0 +1,248 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// NewFileFromImage creates a new File for accessing a PE image
+// that has been loaded into memory, such as one read from a process
+// memory dump. Unlike NewFile, which expects the on-disk layout,
+// it expects the contents of each section at the section's
+// VirtualAddress rather than at its PointerToRawData, so all
+// section data, and everything located through it, is read
+// using virtual offsets.
+//
+// The COFF symbol table, string table and relocations are not
+// part of a loaded image, so the returned File has no symbols or
+// relocations, and section names longer than 8 bytes are
+// reported in their raw "/offset" form.
+func NewFileFromImage(r io.ReaderAt) (*File, error) {
+	return newFile(r, nil, &Options{imageLayout: true})
+}
+
+// IsImageLayout reports whether f was created by NewFileFromImage,
+// that is, whether its sections are read at their virtual addresses.
+func (f *File) IsImageLayout() bool {
+	return f.imageLayout
+}
+
+// UnmapOptions controls the behavior of File.Unmap.
+type UnmapOptions struct {
+	// RestoreIAT restores the import address table of every
+	// imported DLL from its import lookup table, undoing the
+	// binding done by the loader, so the written file can be
+	// loaded again.
+	RestoreIAT bool
+}
+
+// Unmap writes the loaded image f, which must have been created
+// by NewFileFromImage, to w in on-disk layout, reconstructing a PE
+// file from a memory dump. Section data is read from each section's
+// virtual address and written at a new PointerToRawData, packed
+// after the headers and aligned to FileAlignment. The pointer to
+// the COFF symbol table, which is not part of a loaded image, is
+// cleared. A nil opts is the same as the zero UnmapOptions.
+func (f *File) Unmap(w io.Writer, opts *UnmapOptions) error {
+	if !f.imageLayout {
+		return errors.New("pe: Unmap called on a file not created by NewFileFromImage")
+	}
+	if opts == nil {
+		opts = new(UnmapOptions)
+	}
+	oh := f.optionalHeader()
+	if oh == nil {
+		return errors.New("pe: Unmap called on a file without optional header")
+	}
+	// SizeOfImage comes from the file, so do not
+	// allocate more than the dump actually holds.
+	size := int64(oh.sizeOfImage)
+	if f.size >= 0 && f.size < size {
+		size = f.size
+	}
+	if int64(oh.sizeOfHeaders) > size {
+		return &FormatError{-1, "optional header", ErrOutOfBounds, oh.sizeOfHeaders}
+	}
+	if err := checkFileAlignment(oh.fileAlignment); err != nil {
+		return err
+	}
+	img := make([]byte, size)
+	if n, err := f.r.ReadAt(img, 0); err != nil && !(err == io.EOF && n >= int(oh.sizeOfHeaders)) {
+		return err
+	}
+	if opts.RestoreIAT {
+		if err := f.restoreIAT(img, oh); err != nil {
+			return err
+		}
+	}
+
+	hdr := img[:oh.sizeOfHeaders]
+	var base int64 // offset of the COFF file header
+	if len(hdr) >= 2 && hdr[0] == 'M' && hdr[1] == 'Z' {
+		if len(hdr) < dosHeaderSize {
+			return &FormatError{-1, "optional header", errors.New("SizeOfHeaders too small for the MS-DOS header"), oh.sizeOfHeaders}
+		}
+		lfanew := binary.LittleEndian.Uint32(hdr[0x3c:])
+		base = int64(lfanew) + 4
+		if base+20 > int64(len(hdr)) {
+			return &FormatError{0x3c, "MS-DOS header", ErrOutOfBounds, lfanew}
+		}
+	} else if len(hdr) < 20 {
+		return errors.New("pe: image headers are truncated")
+	}
+	binary.LittleEndian.PutUint32(hdr[base+8:], 0)  // PointerToSymbolTable
+	binary.LittleEndian.PutUint32(hdr[base+12:], 0) // NumberOfSymbols
+	sectab := int(base) + 20 + int(f.SizeOfOptionalHeader)
+
+	out := make([]byte, alignUp(int64(oh.sizeOfHeaders), oh.fileAlignment))
+	var total int64
+	for i, s := range f.Sections {
+		sh := sectab + i*40
+		if sh+40 > len(hdr) {
+			return errors.New("pe: image section table is truncated")
+		}
+		if s.Size == 0 {
+			binary.LittleEndian.PutUint32(hdr[sh+20:], 0)
+			continue
+		}
+		// Sections of a valid image lie within it and do not
+		// overlap, so their total size is bounded by the image.
+		total += int64(s.Size)
+		if int64(s.VirtualAddress)+int64(s.Size) > int64(len(img)) || total > int64(len(img)) {
+			return &FormatError{-1, "section " + s.Name, errors.New("extends beyond the image"), s.Size}
+		}
+		rawSize := alignUp(int64(s.Size), oh.fileAlignment)
+		if rawSize > int64(oh.sizeOfImage) {
+			return &FormatError{-1, "section " + s.Name, errors.New("extends beyond the image"), s.Size}
+		}
+		binary.LittleEndian.PutUint32(hdr[sh+20:], uint32(len(out)))
+		raw := make([]byte, rawSize)
+		copy(raw[:s.Size], img[s.VirtualAddress:])
+		out = append(out, raw...)
+	}
+	copy(out, hdr)
+	_, err := w.Write(out)
+	return err
+}
+
+// WriteMapped writes f to w as the loader maps it into memory:
+// SizeOfImage bytes, with the headers at the start and the contents
+// of each section, as read by Section.VirtualReader, at its virtual
+// address, and zeros everywhere else. The data is streamed from the
+// file rather than assembled in memory.
+//
+// A File created by NewFileFromImage is written the same way, so that
+// the output for a memory dump of an image matches the output for the
+// file it was loaded from, except where the loader applied base
+// relocations or bound imports. WriteMapped fails if f has no
+// optional header or if its sections overlap each other, the headers
+// or the end of the image.
+func (f *File) WriteMapped(w io.Writer) error {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return errors.New("pe: WriteMapped called on a file without optional header")
+	}
+	size := int64(oh.sizeOfImage)
+	hdr := int64(oh.sizeOfHeaders)
+	if hdr > size {
+		return &FormatError{-1, "optional header", ErrOutOfBounds, oh.sizeOfHeaders}
+	}
+	var r io.ReaderAt = f.r
+	if f.size >= 0 {
+		r = &zeroFillReaderAt{f.r, f.size}
+	}
+	if _, err := io.Copy(w, io.NewSectionReader(r, 0, hdr)); err != nil {
+		return err
+	}
+	secs := make([]*Section, len(f.Sections))
+	copy(secs, f.Sections)
+	sort.Stable(sectionAddressOrder(secs))
+	pos := hdr
+	for _, s := range secs {
+		va, vsize := int64(s.VirtualAddress), s.virtualSize()
+		if vsize == 0 {
+			continue
+		}
+		if va < pos || va+vsize > size {
+			return &FormatError{-1, "section " + s.Name, errors.New("overlaps the headers, another section or the end of the image"), s.VirtualAddress}
+		}
+		if err := writeZeros(w, va-pos); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, s.VirtualReader()); err != nil {
+			return err
+		}
+		pos = va + vsize
+	}
+	return writeZeros(w, size-pos)
+}
+
+// writeZeros writes n zero bytes to w.
+func writeZeros(w io.Writer, n int64) error {
+	_, err := io.Copy(w, io.NewSectionReader(zeroReaderAt{}, 0, n))
+	return err
+}
+
+// sectionAddressOrder sorts sections by virtual address.
+type sectionAddressOrder []*Section
+
+func (s sectionAddressOrder) Len() int           { return len(s) }
+func (s sectionAddressOrder) Less(i, j int) bool { return s[i].VirtualAddress < s[j].VirtualAddress }
+func (s sectionAddressOrder) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// restoreIAT copies the import lookup table of every import
+// descriptor in img over its import address table.
+func (f *File) restoreIAT(img []byte, oh *optionalHeaderInfo) error {
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if dd.VirtualAddress == 0 {
+		return nil
+	}
+	thunkSize := uint64(4)
+	if oh.pe64 {
+		thunkSize = 8
+	}
+	for d := uint64(dd.VirtualAddress); d+20 <= uint64(len(img)); d += 20 {
+		oft := uint64(binary.LittleEndian.Uint32(img[d:]))
+		ft := uint64(binary.LittleEndian.Uint32(img[d+16:]))
+		if oft == 0 && ft == 0 {
+			break
+		}
+		if oft == 0 {
+			continue // no lookup table to restore from
+		}
+		for ; oft+thunkSize <= uint64(len(img)) && ft+thunkSize <= uint64(len(img)); oft, ft = oft+thunkSize, ft+thunkSize {
+			copy(img[ft:ft+thunkSize], img[oft:oft+thunkSize])
+			if binary.LittleEndian.Uint32(img[oft:]) == 0 && (!oh.pe64 || binary.LittleEndian.Uint32(img[oft+4:]) == 0) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// checkFileAlignment returns a FormatError if fa, the FileAlignment
+// of an optional header, is not a power of 2 of at most 64K, so that
+// it is safe to pad data to it.
+func checkFileAlignment(fa uint32) error {
+	if fa == 0 || fa > 64<<10 || fa&(fa-1) != 0 {
+		return &FormatError{-1, "optional header", errors.New("FileAlignment is not a power of 2 of at most 64K"), fa}
+	}
+	return nil
+}
+
+// alignUp rounds n up to a multiple of align. An align
+// that is not a power of two, which only a malformed
+// file has, is treated as no alignment.
+func alignUp(n int64, align uint32) int64 {
+	if align == 0 || align&(align-1) != 0 {
+		return n
+	}
+	a := int64(align)
+	return (n + a - 1) &^ (a - 1)
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// loadImage lays out the PE file in data the way the Windows
+// loader would, with each section at its virtual address.
+func loadImage(t *testing.T, data []byte) []byte {
+	f, err := NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizeOfImage, sizeOfHeaders uint32
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		sizeOfImage, sizeOfHeaders = oh.SizeOfImage, oh.SizeOfHeaders
+	case *OptionalHeader64:
+		sizeOfImage, sizeOfHeaders = oh.SizeOfImage, oh.SizeOfHeaders
+	default:
+		t.Fatal("not an image file")
+	}
+	image := make([]byte, sizeOfImage)
+	copy(image, data[:sizeOfHeaders])
+	for _, s := range f.Sections {
+		raw, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) > int(s.VirtualSize) {
+			raw = raw[:s.VirtualSize]
+		}
+		copy(image[s.VirtualAddress:], raw)
+	}
+	return image
+}
+
+func TestNewFileFromImage(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := NewFileFromImage(bytes.NewReader(loadImage(t, data)))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !img.IsImageLayout() || f.IsImageLayout() {
+			t.Errorf("%s: wrong IsImageLayout result", file)
+		}
+		if !reflect.DeepEqual(img.OptionalHeader, f.OptionalHeader) {
+			t.Errorf("%s: optional headers differ", file)
+		}
+		if len(img.Symbols) != 0 {
+			t.Errorf("%s: image has %d symbols, want none", file, len(img.Symbols))
+		}
+		if len(img.Sections) != len(f.Sections) {
+			t.Fatalf("%s: image has %d sections, want %d", file, len(img.Sections), len(f.Sections))
+		}
+		for i, s := range f.Sections {
+			want, err := ioutil.ReadAll(s.VirtualReader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			have, err := ioutil.ReadAll(img.Sections[i].VirtualReader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Errorf("%s: section %d (%s): contents differ", file, i, s.Name)
+			}
+		}
+		want, err := f.ImportedSymbols()
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := img.ImportedSymbols()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: image imports %q, want %q", file, have, want)
+		}
+	}
+}
+
+func TestUnmap(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		image := loadImage(t, data)
+
+		// Simulate the loader binding the imports
+		// by scribbling over the IAT.
+		idata := f.Section(".idata")
+		var iat []byte
+		if idata != nil {
+			oh := f.optionalHeader()
+			dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+			ft := binary.LittleEndian.Uint32(image[dd.VirtualAddress+16:])
+			iat = append([]byte(nil), image[ft:ft+8]...)
+			copy(image[ft:ft+8], "\xde\xad\xbe\xef\xde\xad\xbe\xef")
+		}
+
+		img, err := NewFileFromImage(bytes.NewReader(image))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := img.Unmap(&buf, &UnmapOptions{RestoreIAT: true}); err != nil {
+			t.Fatalf("%s: Unmap: %v", file, err)
+		}
+		g, err := NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: parsing unmapped file: %v", file, err)
+		}
+		if g.PointerToSymbolTable != 0 || g.NumberOfSymbols != 0 {
+			t.Errorf("%s: unmapped file still points to a symbol table", file)
+		}
+		for i, s := range f.Sections {
+			gs := g.Sections[i]
+			if gs.Offset%g.optionalHeader().fileAlignment != 0 {
+				t.Errorf("%s: section %d is not aligned in unmapped file", file, i)
+			}
+			want, _ := ioutil.ReadAll(s.VirtualReader())
+			have, _ := ioutil.ReadAll(gs.VirtualReader())
+			if !bytes.Equal(have, want) {
+				t.Errorf("%s: section %d (%s): contents differ after unmapping", file, i, s.Name)
+			}
+		}
+		if iat != nil {
+			oh := g.optionalHeader()
+			dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+			gimage := loadImage(t, buf.Bytes())
+			ft := binary.LittleEndian.Uint32(gimage[dd.VirtualAddress+16:])
+			if !bytes.Equal(gimage[ft:ft+8], iat) {
+				t.Errorf("%s: IAT not restored: have %x, want %x", file, gimage[ft:ft+8], iat)
+			}
+		}
+
+		// SizeOfHeaders too small for the MS-DOS
+		// header or for the COFF file header.
+		sizeOfHeaders := int(f.DOSHeader.Lfanew) + 4 + 20 + 60
+		for _, size := range []uint32{0x10, f.DOSHeader.Lfanew} {
+			bad := append([]byte(nil), image...)
+			binary.LittleEndian.PutUint32(bad[sizeOfHeaders:], size)
+			img, err := NewFileFromImage(bytes.NewReader(bad))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = img.Unmap(ioutil.Discard, nil)
+			if _, ok := err.(*FormatError); !ok {
+				t.Errorf("%s: Unmap with SizeOfHeaders %#x: %v, want a FormatError", file, size, err)
+			}
+		}
+
+		// A huge FileAlignment must fail
+		// before anything is padded to it.
+		fileAlignment := int(f.DOSHeader.Lfanew) + 4 + 20 + 36
+		for _, fa := range []uint32{0, 0x300, 0x20000, 0x80000000} {
+			bad := append([]byte(nil), image...)
+			binary.LittleEndian.PutUint32(bad[fileAlignment:], fa)
+			img, err := NewFileFromImage(bytes.NewReader(bad))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = img.Unmap(ioutil.Discard, nil)
+			if _, ok := err.(*FormatError); !ok {
+				t.Errorf("%s: Unmap with FileAlignment %#x: %v, want a FormatError", file, fa, err)
+			}
+		}
+	}
+}
+
+func TestWriteMapped(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := loadImage(t, data)
+		var buf bytes.Buffer
+		if err := f.WriteMapped(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: WriteMapped does not match the loaded image", file)
+		}
+		img, err := NewFileFromImage(bytes.NewReader(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsum, err := f.MappedSum(sha256.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		isum, err := img.MappedSum(sha256.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(fsum, isum) {
+			t.Errorf("%s: MappedSum of the file %x and of the image %x differ", file, fsum, isum)
+		}
+		if sum := sha256.Sum256(want); !bytes.Equal(fsum, sum[:]) {
+			t.Errorf("%s: MappedSum = %x, want %x", file, fsum, sum)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// importSectionName is the name of the section WriteWithImports adds.
+const importSectionName = ".idata2"
+
+// WriteWithImports writes the image f to w with imports added to
+// its import directory, as instrumentation tools do to have the
+// loader load a DLL into a program. The Name, or Ordinal if
+// ByOrdinal is set, DLL and Hint of each import are used.
+//
+// A new section, named .idata2, holds a copy of the import
+// descriptors of f followed by new descriptors for the DLLs of
+// imports, in order of first appearance, with their import lookup
+// and address tables and names. The copied descriptors still point
+// to the original thunks, so code that uses the existing import
+// address tables is unaffected. The import data directory is set
+// to the new descriptors, the bound import directory, which no
+// longer matches them, is cleared, and the checksum is updated.
+// An attribute certificate table is removed, since the signature
+// it holds no longer applies.
+//
+// The headers must have room for one more section header.
+// WriteWithImports fails if the size of the file is not known or
+// if f was created by NewFileFromImage.
+func (f *File) WriteWithImports(w io.Writer, imports []Import) error {
+	if len(imports) == 0 {
+		return errors.New("pe: no imports to add")
+	}
+	b, err := f.unsignedImage("WriteWithImports")
+	if err != nil {
+		return err
+	}
+	oh := f.optionalHeader()
+
+	// The existing import descriptors, without the null one.
+	var old []byte
+	if dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT); dd.VirtualAddress != 0 {
+		for i := uint32(0); ; i++ {
+			if i == maxImportDescriptors {
+				return &FormatError{-1, "import directory", errors.New("too many descriptors"), i}
+			}
+			var d [20]byte
+			rva, err := addRVA(dd.VirtualAddress, 20*uint64(i))
+			if err != nil {
+				return err
+			}
+			if err := f.readRVA(d[:], rva); err != nil {
+				return err
+			}
+			if d == [20]byte{} {
+				break
+			}
+			old = append(old, d[:]...)
+		}
+	}
+
+	var dlls []string
+	byDLL := make(map[string][]int) // indexes in imports
+	for i, imp := range imports {
+		if imp.DLL == "" || !imp.ByOrdinal && imp.Name == "" {
+			return errors.New("pe: import without DLL or function name")
+		}
+		if _, ok := byDLL[imp.DLL]; !ok {
+			dlls = append(dlls, imp.DLL)
+		}
+		byDLL[imp.DLL] = append(byDLL[imp.DLL], i)
+	}
+
+	// Lay out the section: the descriptors, then the import lookup
+	// and address tables of each DLL, the hint/name entries of the
+	// functions and the names of the DLLs.
+	thunkSize := int64(4)
+	if oh.pe64 {
+		thunkSize = 8
+	}
+	descSize := int64(len(old)) + 20*int64(len(dlls)+1)
+	off := alignUp(descSize, 8)
+	ilt := make(map[string]int64)
+	iat := make(map[string]int64)
+	for _, dll := range dlls {
+		n := int64(len(byDLL[dll]) + 1)
+		ilt[dll], iat[dll] = off, off+n*thunkSize
+		off += 2 * n * thunkSize
+	}
+	hintNames := make([]int64, len(imports))
+	for i, imp := range imports {
+		if !imp.ByOrdinal {
+			hintNames[i] = off
+			off = alignUp(off+2+int64(len(imp.Name))+1, 2)
+		}
+	}
+	names := make(map[string]int64)
+	for _, dll := range dlls {
+		names[dll] = off
+		off += int64(len(dll)) + 1
+	}
+	size := off
+
+	va := f.nextSectionRVA()
+	c := make([]byte, size)
+	copy(c, old)
+	for i, dll := range dlls {
+		d := c[int64(len(old))+20*int64(i):]
+		binary.LittleEndian.PutUint32(d[0:], uint32(va+ilt[dll]))
+		binary.LittleEndian.PutUint32(d[12:], uint32(va+names[dll]))
+		binary.LittleEndian.PutUint32(d[16:], uint32(va+iat[dll]))
+		copy(c[names[dll]:], dll)
+		for j, k := range byDLL[dll] {
+			imp := imports[k]
+			var thunk uint64
+			if imp.ByOrdinal {
+				thunk = uint64(imp.Ordinal) | 1<<uint(8*thunkSize-1)
+			} else {
+				hn := hintNames[k]
+				binary.LittleEndian.PutUint16(c[hn:], imp.Hint)
+				copy(c[hn+2:], imp.Name)
+				thunk = uint64(va + hn)
+			}
+			for _, t := range []int64{ilt[dll], iat[dll]} {
+				p := c[t+int64(j)*thunkSize:]
+				if oh.pe64 {
+					binary.LittleEndian.PutUint64(p, thunk)
+				} else {
+					binary.LittleEndian.PutUint32(p, uint32(thunk))
+				}
+			}
+		}
+	}
+
+	if b, err = f.addSection(b, importSectionName, va, c, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_WRITE); err != nil {
+		return err
+	}
+	f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_IMPORT, DataDirectory{VirtualAddress: uint32(va), Size: uint32(descSize)})
+	if oh.numberOfRvaAndSizes > IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT && f.dataDirectoryOffset(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT+1) <= int(f.base)+20+int(f.SizeOfOptionalHeader) {
+		f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT, DataDirectory{})
+	}
+	f.setChecksum(b)
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestWriteWithImports(t *testing.T) {
+	added := []Import{
+		{DLL: "instr.dll", Name: "Init", Hint: 7},
+		{DLL: "hook.dll", Ordinal: 5, ByOrdinal: true},
+		{DLL: "instr.dll", Name: "Attach"},
+	}
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		orig, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		imps, err := f.Imports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := f.WriteWithImports(&buf, added); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFileWithOptions(bytes.NewReader(buf.Bytes()), &Options{Mode: ParseStrict})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := g.Sections[len(g.Sections)-1]
+		if s.Name != ".idata2" || s.Characteristics != IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ|IMAGE_SCN_MEM_WRITE {
+			t.Fatalf("%s: last section %s has characteristics %#x", file, s.Name, s.Characteristics)
+		}
+		have, err := g.Imports()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(have) != len(imps)+len(added) || !reflect.DeepEqual(have[:len(imps)], imps) {
+			t.Fatalf("%s: Imports = %+v, want the original ones followed by %d new ones", file, have, len(added))
+		}
+		// The DLLs are in order of first appearance.
+		for i, j := range []int{0, 2, 1} {
+			imp := have[len(imps)+i]
+			if g.sectionForRVA(imp.Slot) != s {
+				t.Errorf("%s: import %s slot %#x is not in the new section", file, imp.Name, imp.Slot)
+			}
+			imp.Slot = 0
+			if imp != added[j] {
+				t.Errorf("%s: import %d = %+v, want %+v", file, len(imps)+i, imp, added[j])
+			}
+		}
+		if have, want := headerChecksum(t, buf.Bytes()); have != want {
+			t.Errorf("%s: CheckSum = %#x, want %#x", file, have, want)
+		}
+		if oh := g.optionalHeader(); oh.sizeOfImage != uint32(alignUp(int64(s.VirtualAddress)+int64(s.VirtualSize), oh.sectionAlignment)) {
+			t.Errorf("%s: SizeOfImage = %#x, new section ends at %#x", file, oh.sizeOfImage, s.VirtualAddress+s.VirtualSize)
+		}
+		if d, err := Diff(f, g); err != nil {
+			t.Fatal(err)
+		} else if len(d.Sections) != 1 || d.Sections[0].Old != nil {
+			t.Errorf("%s: changed sections %+v, want one added", file, d.Sections)
+		}
+	}
+}
+
+func TestWriteWithImportsNoRoom(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fill the space after the section table.
+	end := int(f.base) + 20 + int(f.SizeOfOptionalHeader) + 40*len(f.Sections)
+	orig[end+10] = 1
+	if f, err = NewFile(bytes.NewReader(orig)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.WriteWithImports(ioutil.Discard, []Import{{DLL: "a.dll", Name: "F"}}); err == nil {
+		t.Error("WriteWithImports overwrote data after the section table")
+	}
+}
+
+func TestWriteWithImportsBadFileAlignment(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(orig[f.base+20+36:], 0x80000000) // FileAlignment
+	if f, err = NewFile(bytes.NewReader(orig)); err != nil {
+		t.Fatal(err)
+	}
+	err = f.WriteWithImports(ioutil.Discard, []Import{{DLL: "a.dll", Name: "F"}})
+	if _, ok := err.(*FormatError); !ok {
+		t.Errorf("WriteWithImports with FileAlignment 0x80000000: %v, want a FormatError", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "encoding/binary"
+
+// An Import is a single function imported by a PE image,
+// as described by the import directory.
+type Import struct {
+	DLL       string
+	Name      string // empty if imported by ordinal, unless set by ResolveOrdinals
+	Hint      uint16 // index into the export name table of DLL suggested to the loader
+	Ordinal   uint16 // valid if ByOrdinal is set
+	ByOrdinal bool
+	Slot      uint32 // RVA of the function's import address table slot
+
+	// Host is the DLL the function is loaded from if DLL is
+	// an API set contract, as set by ResolveAPISets.
+	Host string
+}
+
+// Limits on the size of the import directory, to avoid
+// looping over garbage in malformed files. Descriptors may share
+// their thunks, so maxImports also bounds the total.
+const (
+	maxImportDescriptors = 1 << 16
+	maxImportThunks      = 1 << 20
+	maxImports           = 1 << 20
+)
+
+// Imports returns the functions imported by f, in the order
+// of the import directory. Unlike ImportedSymbols, it reads the
+// import directory wherever it is, reports imports by ordinal
+// and handles PE32+ images of any architecture.
+func (f *File) Imports() ([]Import, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if dd.VirtualAddress == 0 {
+		return nil, nil
+	}
+	thunkSize := uint32(4)
+	if oh.pe64 {
+		thunkSize = 8
+	}
+	var all []Import
+	var desc [20]byte
+	for i := uint32(0); i < maxImportDescriptors; i++ {
+		rva, err := addRVA(dd.VirtualAddress, uint64(i)*20)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.readRVA(desc[:], rva); err != nil {
+			return nil, err
+		}
+		oft := binary.LittleEndian.Uint32(desc[0:4])
+		nameRVA := binary.LittleEndian.Uint32(desc[12:16])
+		ft := binary.LittleEndian.Uint32(desc[16:20])
+		if oft == 0 && nameRVA == 0 && ft == 0 {
+			return all, nil
+		}
+		dll, err := f.readStringRVA(nameRVA)
+		if err != nil {
+			return nil, err
+		}
+		// Prefer the import lookup table, as the import address
+		// table may have been overwritten by binding.
+		lookup := oft
+		if lookup == 0 {
+			lookup = ft
+		}
+		var thunk [8]byte
+		for j := uint32(0); j < maxImportThunks; j++ {
+			rva, err := addRVA(lookup, uint64(j)*uint64(thunkSize))
+			if err != nil {
+				return nil, err
+			}
+			if err := f.readRVA(thunk[:thunkSize], rva); err != nil {
+				return nil, err
+			}
+			var v uint64
+			var byOrdinal bool
+			if oh.pe64 {
+				v = binary.LittleEndian.Uint64(thunk[:])
+				byOrdinal = v&(1<<63) != 0
+			} else {
+				v = uint64(binary.LittleEndian.Uint32(thunk[:]))
+				byOrdinal = v&(1<<31) != 0
+			}
+			if v == 0 {
+				break
+			}
+			if len(all) == maxImports {
+				return nil, &FormatError{-1, "import directory", ErrOutOfBounds, dd.VirtualAddress}
+			}
+			e := Import{DLL: dll, Slot: ft + j*thunkSize, ByOrdinal: byOrdinal}
+			if byOrdinal {
+				e.Ordinal = uint16(v)
+			} else {
+				var hint [2]byte
+				if err := f.readRVA(hint[:], uint32(v)); err != nil {
+					return nil, err
+				}
+				e.Hint = binary.LittleEndian.Uint16(hint[:])
+				if rva, err = addRVA(uint32(v), 2); err == nil {
+					e.Name, err = f.readStringRVA(rva)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			all = append(all, e)
+		}
+	}
+	return nil, &FormatError{-1, "import directory", ErrOutOfBounds, dd.VirtualAddress}
+}
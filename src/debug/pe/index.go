@@ -0,0 +1,378 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// A FileIndex is a compact summary of a parsed PE file, to be saved
+// alongside it so that services reopening the same large binaries
+// over and over need not parse them again. See Options.Index.
+type FileIndex struct {
+	// Size, ModTime and HeaderSum identify the file indexed: its
+	// size, its modification time, if known, and the CRC-64 (ECMA)
+	// of its first HeaderSize bytes, which span the headers and the
+	// section table. An index only applies to a file that matches.
+	Size       int64
+	ModTime    time.Time
+	HeaderSize int64
+	HeaderSum  uint64
+
+	// Sections holds the section headers, with long names resolved.
+	Sections []SectionHeader
+
+	// Directories holds the file offset of each data directory
+	// of an image, or -1 for those empty or not in the file.
+	Directories []int64
+
+	// Symbols holds the names of the COFF symbols, sorted.
+	Symbols []IndexedSymbol
+}
+
+// An IndexedSymbol is an entry of the symbol name index of a FileIndex.
+type IndexedSymbol struct {
+	Name  string
+	Index uint32 // of the symbol record in File.COFFSymbols
+}
+
+// ErrStaleIndex is returned by NewFileWithOptions
+// when Options.Index does not match the file.
+var ErrStaleIndex = errors.New("pe: index does not match the file")
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// Index returns the index of f, for use with Options.Index. The
+// modification time is recorded if f reads from an *os.File, as
+// those returned by Open do. Index reads the whole symbol table;
+// it fails for files of unknown size and for loaded images.
+func (f *File) Index() (*FileIndex, error) {
+	if f.imageLayout {
+		return nil, errors.New("pe: cannot index a loaded image")
+	}
+	if f.size < 0 {
+		return nil, errors.New("pe: cannot index file: file size unknown")
+	}
+	x := &FileIndex{
+		Size:       f.size,
+		ModTime:    readerModTime(f.r),
+		HeaderSize: f.HeaderLayout().SectionTable.End(),
+	}
+	sum, err := headerSum(f.r, x.HeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	x.HeaderSum = sum
+	for _, s := range f.Sections {
+		x.Sections = append(x.Sections, s.SectionHeader)
+	}
+	if oh := f.optionalHeader(); oh != nil {
+		for i := 0; i < int(oh.numberOfRvaAndSizes) && i < IMAGE_NUMBEROF_DIRECTORY_ENTRIES; i++ {
+			dd := oh.dataDirectory(i)
+			off := int64(-1)
+			switch {
+			case dd.VirtualAddress == 0:
+			case i == IMAGE_DIRECTORY_ENTRY_SECURITY:
+				// Not mapped, so VirtualAddress is a file offset.
+				off = int64(dd.VirtualAddress)
+			default:
+				if o, err := f.fileOffset(dd.VirtualAddress, dd.Size); err == nil {
+					off = o
+				}
+			}
+			x.Directories = append(x.Directories, off)
+		}
+	}
+	st, err := f.SymbolTable()
+	if err != nil {
+		return nil, err
+	}
+	for i := range st.Symbols {
+		x.Symbols = append(x.Symbols, IndexedSymbol{st.Symbols[i].Name, st.Index[i]})
+	}
+	sort.Stable(indexedSymbolOrder(x.Symbols))
+	return x, nil
+}
+
+// indexedSymbolOrder sorts indexed symbols by name.
+type indexedSymbolOrder []IndexedSymbol
+
+func (s indexedSymbolOrder) Len() int           { return len(s) }
+func (s indexedSymbolOrder) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s indexedSymbolOrder) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// readerModTime returns the modification time of the file r
+// reads, or the zero time if r is not an *os.File.
+func readerModTime(r io.ReaderAt) time.Time {
+	if r, ok := r.(*os.File); ok {
+		if fi, err := r.Stat(); err == nil {
+			return fi.ModTime()
+		}
+	}
+	return time.Time{}
+}
+
+// headerSum returns the CRC-64 of the first n bytes of r.
+func headerSum(r io.ReaderAt, n int64) (uint64, error) {
+	h := crc64.New(crc64Table)
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, n)); err != nil {
+		return 0, formatError(0, "headers", err)
+	}
+	return h.Sum64(), nil
+}
+
+// check returns ErrStaleIndex unless x is the index of the
+// file of the given size that r reads.
+func (x *FileIndex) check(r io.ReaderAt, size int64) error {
+	if size != x.Size || x.HeaderSize < 0 || x.HeaderSize > size {
+		return ErrStaleIndex
+	}
+	if t := readerModTime(r); !t.IsZero() && !x.ModTime.IsZero() && !t.Equal(x.ModTime) {
+		return ErrStaleIndex
+	}
+	sum, err := headerSum(r, x.HeaderSize)
+	if err != nil {
+		return err
+	}
+	if sum != x.HeaderSum {
+		return ErrStaleIndex
+	}
+	return nil
+}
+
+// Lookup returns the indexes in File.COFFSymbols
+// of the symbols named name, in table order.
+func (x *FileIndex) Lookup(name string) []uint32 {
+	i := sort.Search(len(x.Symbols), func(i int) bool { return x.Symbols[i].Name >= name })
+	var idx []uint32
+	for ; i < len(x.Symbols) && x.Symbols[i].Name == name; i++ {
+		idx = append(idx, x.Symbols[i].Index)
+	}
+	return idx
+}
+
+// LookupSymbol returns the first symbol of f named name, and
+// the index of its record in f.COFFSymbols, or nil if there is
+// none. If f was opened with Options.Index, only that record is
+// read from the file; otherwise the symbol table is loaded.
+func (f *File) LookupSymbol(name string) (*Symbol, int, error) {
+	if f.index != nil && f.BigObjHeader == nil && !f.hasSymbols() {
+		idx := f.index.Lookup(name)
+		if len(idx) == 0 {
+			return nil, 0, nil
+		}
+		i := int(idx[0])
+		if uint64(i) >= uint64(f.NumberOfSymbols) {
+			return nil, 0, &FormatError{-1, "symbol index", ErrOutOfBounds, i}
+		}
+		off := int64(f.PointerToSymbolTable) + int64(i)*COFFSymbolSize
+		var b [COFFSymbolSize]byte
+		if _, err := f.r.ReadAt(b[:], off); err != nil {
+			return nil, 0, formatError(off, "COFF symbol", err)
+		}
+		var sym COFFSymbol
+		decodeCOFFSymbol(b[:], &sym)
+		c := &symbolCooker{st: f.StringTable}
+		if err := c.add(i, &sym); err != nil {
+			return nil, 0, err
+		}
+		return &c.syms[0], i, nil
+	}
+	if err := f.ensureSymbols(); err != nil {
+		return nil, 0, err
+	}
+	n := 0
+	for i := 0; i < len(f.COFFSymbols) && n < len(f.Symbols); i += 1 + int(f.COFFSymbols[i].NumberOfAuxSymbols) {
+		if f.Symbols[n].Name == name {
+			return f.Symbols[n], i, nil
+		}
+		n++
+	}
+	return nil, 0, nil
+}
+
+// fileIndexMagic starts an encoded FileIndex.
+const fileIndexMagic = "PEINDEX1"
+
+// WriteTo writes x to w in a compact binary form
+// that ReadFileIndex reads.
+func (x *FileIndex) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	var buf [binary.MaxVarintLen64]byte
+	uvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+	varint := func(v int64) {
+		bw.Write(buf[:binary.PutVarint(buf[:], v)])
+	}
+	str := func(s string) {
+		uvarint(uint64(len(s)))
+		bw.WriteString(s)
+	}
+	bw.WriteString(fileIndexMagic)
+	varint(x.Size)
+	var mtime int64
+	if !x.ModTime.IsZero() {
+		mtime = x.ModTime.UnixNano()
+	}
+	varint(mtime)
+	varint(x.HeaderSize)
+	uvarint(x.HeaderSum)
+	uvarint(uint64(len(x.Sections)))
+	for i := range x.Sections {
+		s := &x.Sections[i]
+		str(s.Name)
+		for _, v := range []uint32{s.VirtualSize, s.VirtualAddress, s.Size, s.Offset, s.PointerToRelocations, s.PointerToLineNumbers, uint32(s.NumberOfRelocations), uint32(s.NumberOfLineNumbers), s.Characteristics} {
+			uvarint(uint64(v))
+		}
+	}
+	uvarint(uint64(len(x.Directories)))
+	for _, off := range x.Directories {
+		varint(off)
+	}
+	uvarint(uint64(len(x.Symbols)))
+	for _, s := range x.Symbols {
+		str(s.Name)
+		uvarint(uint64(s.Index))
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// An indexReader decodes the fields of an encoded FileIndex.
+// Errors are sticky: once a read fails, all reads return zero.
+type indexReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *indexReader) fail(err error) {
+	if r.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = &FormatError{-1, "file index", err, nil}
+	}
+}
+
+func (r *indexReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		r.fail(err)
+	}
+	return v
+}
+
+func (r *indexReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(r.r)
+	if err != nil {
+		r.fail(err)
+	}
+	return v
+}
+
+func (r *indexReader) uint32() uint32 {
+	v := r.uvarint()
+	if v > 1<<32-1 {
+		r.fail(ErrOutOfBounds)
+		return 0
+	}
+	return uint32(v)
+}
+
+func (r *indexReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > maxStringSize {
+		r.fail(ErrOutOfBounds)
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		r.fail(err)
+		return ""
+	}
+	return string(b)
+}
+
+// count reads the number of entries of a list. The lists are not
+// preallocated, so a bad count only costs reading to the end.
+func (r *indexReader) count() int {
+	n := r.uvarint()
+	if n > 1<<31-1 {
+		r.fail(ErrOutOfBounds)
+		return 0
+	}
+	return int(n)
+}
+
+// ReadFileIndex reads a FileIndex written by FileIndex.WriteTo.
+func ReadFileIndex(r io.Reader) (*FileIndex, error) {
+	ir := &indexReader{r: bufio.NewReader(r)}
+	var magic [len(fileIndexMagic)]byte
+	if _, err := io.ReadFull(ir.r, magic[:]); err != nil || string(magic[:]) != fileIndexMagic {
+		return nil, &FormatError{0, "file index", ErrBadMagic, magic[:]}
+	}
+	x := new(FileIndex)
+	x.Size = ir.varint()
+	if mtime := ir.varint(); mtime != 0 {
+		x.ModTime = time.Unix(0, mtime)
+	}
+	x.HeaderSize = ir.varint()
+	x.HeaderSum = ir.uvarint()
+	for i, n := 0, ir.count(); i < n && ir.err == nil; i++ {
+		var s SectionHeader
+		s.Name = ir.string()
+		s.VirtualSize = ir.uint32()
+		s.VirtualAddress = ir.uint32()
+		s.Size = ir.uint32()
+		s.Offset = ir.uint32()
+		s.PointerToRelocations = ir.uint32()
+		s.PointerToLineNumbers = ir.uint32()
+		s.NumberOfRelocations = uint16(ir.uint32())
+		s.NumberOfLineNumbers = uint16(ir.uint32())
+		s.Characteristics = ir.uint32()
+		x.Sections = append(x.Sections, s)
+	}
+	for i, n := 0, ir.count(); i < n && ir.err == nil; i++ {
+		x.Directories = append(x.Directories, ir.varint())
+	}
+	for i, n := 0, ir.count(); i < n && ir.err == nil; i++ {
+		name := ir.string()
+		x.Symbols = append(x.Symbols, IndexedSymbol{name, ir.uint32()})
+	}
+	if ir.err != nil {
+		return nil, ir.err
+	}
+	return x, nil
+}
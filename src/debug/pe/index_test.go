@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestFileIndex(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := f.Index()
+		if err != nil {
+			t.Fatalf("%s: Index: %v", tt.file, err)
+		}
+		if x.ModTime.IsZero() || len(x.Sections) != len(f.Sections) || len(x.Symbols) != len(f.Symbols) {
+			t.Errorf("%s: Index() = %+v", tt.file, x)
+		}
+		var buf bytes.Buffer
+		n, err := x.WriteTo(&buf)
+		if err != nil || n != int64(buf.Len()) {
+			t.Fatalf("%s: WriteTo = %d, %v; wrote %d bytes", tt.file, n, err, buf.Len())
+		}
+		enc := buf.Bytes()
+		y, err := ReadFileIndex(bytes.NewReader(enc))
+		if err != nil {
+			t.Fatalf("%s: ReadFileIndex: %v", tt.file, err)
+		}
+		if !y.ModTime.Equal(x.ModTime) {
+			t.Errorf("%s: ModTime = %v, want %v", tt.file, y.ModTime, x.ModTime)
+		}
+		y.ModTime = x.ModTime
+		if !reflect.DeepEqual(x, y) {
+			t.Errorf("%s: ReadFileIndex = %+v, want %+v", tt.file, y, x)
+		}
+		for i := 0; i < len(enc); i++ {
+			if _, err := ReadFileIndex(bytes.NewReader(enc[:i])); err == nil {
+				t.Errorf("%s: ReadFileIndex of %d of %d bytes succeeded", tt.file, i, len(enc))
+				break
+			}
+		}
+
+		g, err := OpenWithOptions(tt.file, &Options{Index: y})
+		if err != nil {
+			t.Fatalf("%s: OpenWithOptions with index: %v", tt.file, err)
+		}
+		if g.hasSymbols() {
+			t.Errorf("%s: symbols loaded despite the index", tt.file)
+		}
+		for i, s := range g.Sections {
+			if s.SectionHeader != f.Sections[i].SectionHeader || len(s.Relocs) != len(f.Sections[i].Relocs) {
+				t.Errorf("%s: section %d = %+v, want %+v", tt.file, i, s.SectionHeader, f.Sections[i].SectionHeader)
+			}
+		}
+		if len(f.Symbols) > 0 {
+			want := f.Symbols[len(f.Symbols)-1]
+			wantIdx, err := f.SymbolIndex(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sym, i, err := g.LookupSymbol(want.Name)
+			if err != nil || sym == nil || *sym != *want || (len(x.Lookup(want.Name)) == 1 && i != wantIdx) {
+				t.Errorf("%s: LookupSymbol(%q) = %+v, %d, %v, want %+v, %d", tt.file, want.Name, sym, i, err, want, wantIdx)
+			}
+			if g.hasSymbols() {
+				t.Errorf("%s: LookupSymbol loaded the symbols", tt.file)
+			}
+			if sym2, i2, err := f.LookupSymbol(want.Name); err != nil || sym2 == nil || *sym2 != *sym || i2 != i {
+				t.Errorf("%s: LookupSymbol(%q) without index = %+v, %d, %v", tt.file, want.Name, sym2, i2, err)
+			}
+		}
+		if sym, _, err := g.LookupSymbol("no such symbol"); sym != nil || err != nil {
+			t.Errorf("%s: LookupSymbol of a missing symbol = %+v, %v", tt.file, sym, err)
+		}
+		g.Close()
+		f.Close()
+
+		// A file changed since it was indexed does not match.
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewFileWithOptions(bytes.NewReader(data), &Options{Index: x}); err != nil {
+			t.Errorf("%s: index of the same contents: %v", tt.file, err)
+		}
+		changed := append([]byte(nil), data...)
+		changed[f.HeaderLayout().FileHeader.Offset+4]++ // TimeDateStamp
+		if _, err := NewFileWithOptions(bytes.NewReader(changed), &Options{Index: x}); err != ErrStaleIndex {
+			t.Errorf("%s: index of changed headers: %v, want ErrStaleIndex", tt.file, err)
+		}
+		if _, err := NewFileWithOptions(bytes.NewReader(append(data, 0)), &Options{Index: x}); err != ErrStaleIndex {
+			t.Errorf("%s: index of grown file: %v, want ErrStaleIndex", tt.file, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A LoadConfig is the load configuration directory of an image
+// (IMAGE_LOAD_CONFIG_DIRECTORY32 or IMAGE_LOAD_CONFIG_DIRECTORY64).
+// The structure has grown with each version of Windows, and Size
+// tells how much of it the image has: the fields past it are zero.
+// Fields holding addresses are virtual addresses, not RVAs, and are
+// widened to 64 bits for PE32 images.
+type LoadConfig struct {
+	Size                          uint32
+	TimeDateStamp                 uint32
+	MajorVersion                  uint16
+	MinorVersion                  uint16
+	GlobalFlagsClear              uint32
+	GlobalFlagsSet                uint32
+	CriticalSectionDefaultTimeout uint32
+	DeCommitFreeBlockThreshold    uint64
+	DeCommitTotalFreeThreshold    uint64
+	LockPrefixTable               uint64
+	MaximumAllocationSize         uint64
+	VirtualMemoryThreshold        uint64
+	ProcessAffinityMask           uint64
+	ProcessHeapFlags              uint32
+	CSDVersion                    uint16
+	DependentLoadFlags            uint16
+	EditList                      uint64
+	SecurityCookie                uint64
+	SEHandlerTable                uint64
+	SEHandlerCount                uint64
+
+	GuardCFCheckFunctionPointer    uint64
+	GuardCFDispatchFunctionPointer uint64
+	GuardCFFunctionTable           uint64
+	GuardCFFunctionCount           uint64
+	GuardFlags                     uint32
+
+	CodeIntegrityFlags         uint16
+	CodeIntegrityCatalog       uint16
+	CodeIntegrityCatalogOffset uint32
+
+	GuardAddressTakenIatEntryTable           uint64
+	GuardAddressTakenIatEntryCount           uint64
+	GuardLongJumpTargetTable                 uint64
+	GuardLongJumpTargetCount                 uint64
+	DynamicValueRelocTable                   uint64
+	CHPEMetadataPointer                      uint64
+	GuardRFFailureRoutine                    uint64
+	GuardRFFailureRoutineFunctionPointer     uint64
+	DynamicValueRelocTableOffset             uint32
+	DynamicValueRelocTableSection            uint16
+	GuardRFVerifyStackPointerFunctionPointer uint64
+	HotPatchTableOffset                      uint32
+	EnclaveConfigurationPointer              uint64
+	VolatileMetadataPointer                  uint64
+	GuardEHContinuationTable                 uint64
+	GuardEHContinuationCount                 uint64
+	GuardXFGCheckFunctionPointer             uint64
+	GuardXFGDispatchFunctionPointer          uint64
+	GuardXFGTableDispatchFunctionPointer     uint64
+	CastGuardOsDeterminedFailureMode         uint64
+	GuardMemcpyFunctionPointer               uint64
+}
+
+// Control flow guard flags, as found in LoadConfig.GuardFlags.
+const (
+	IMAGE_GUARD_CF_INSTRUMENTED                    = 0x00000100
+	IMAGE_GUARD_CFW_INSTRUMENTED                   = 0x00000200
+	IMAGE_GUARD_CF_FUNCTION_TABLE_PRESENT          = 0x00000400
+	IMAGE_GUARD_SECURITY_COOKIE_UNUSED             = 0x00000800
+	IMAGE_GUARD_PROTECT_DELAYLOAD_IAT              = 0x00001000
+	IMAGE_GUARD_DELAYLOAD_IAT_IN_ITS_OWN_SECTION   = 0x00002000
+	IMAGE_GUARD_CF_EXPORT_SUPPRESSION_INFO_PRESENT = 0x00004000
+	IMAGE_GUARD_CF_ENABLE_EXPORT_SUPPRESSION       = 0x00008000
+	IMAGE_GUARD_CF_LONGJUMP_TABLE_PRESENT          = 0x00010000
+	IMAGE_GUARD_RF_INSTRUMENTED                    = 0x00020000
+	IMAGE_GUARD_RF_ENABLE                          = 0x00040000
+	IMAGE_GUARD_RF_STRICT                          = 0x00080000
+	IMAGE_GUARD_RETPOLINE_PRESENT                  = 0x00100000
+	IMAGE_GUARD_EH_CONTINUATION_TABLE_PRESENT      = 0x00400000
+	IMAGE_GUARD_XFG_ENABLED                        = 0x00800000
+	IMAGE_GUARD_CASTGUARD_PRESENT                  = 0x01000000
+	IMAGE_GUARD_MEMCPY_PRESENT                     = 0x02000000
+
+	// The number of metadata bytes following each RVA in
+	// the guard tables is kept in the top 4 bits.
+	IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK  = 0xf0000000
+	IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT = 28
+)
+
+// maxLoadConfigSize is the size of the largest
+// known load configuration structure.
+const maxLoadConfigSize = 320
+
+// A loadConfigReader decodes the fields of a load configuration
+// structure, or of the structures it points to, in order, reading
+// as zero those past its end.
+type loadConfigReader struct {
+	b    []byte
+	off  int
+	pe64 bool
+}
+
+func (r *loadConfigReader) u16() uint16 {
+	var v uint16
+	if r.off+2 <= len(r.b) {
+		v = binary.LittleEndian.Uint16(r.b[r.off:])
+	}
+	r.off += 2
+	return v
+}
+
+func (r *loadConfigReader) u32() uint32 {
+	var v uint32
+	if r.off+4 <= len(r.b) {
+		v = binary.LittleEndian.Uint32(r.b[r.off:])
+	}
+	r.off += 4
+	return v
+}
+
+// ptr reads a field of the size of an address.
+func (r *loadConfigReader) ptr() uint64 {
+	if !r.pe64 {
+		return uint64(r.u32())
+	}
+	var v uint64
+	if r.off+8 <= len(r.b) {
+		v = binary.LittleEndian.Uint64(r.b[r.off:])
+	}
+	r.off += 8
+	return v
+}
+
+// LoadConfig returns the load configuration directory of f,
+// or nil if f has none.
+func (f *File) LoadConfig() (*LoadConfig, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG)
+	if dd.VirtualAddress == 0 {
+		return nil, nil
+	}
+	// The loader goes by the Size field of the structure,
+	// which some linkers do not copy into the directory.
+	var sz [4]byte
+	if err := f.readRVA(sz[:], dd.VirtualAddress); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(sz[:])
+	if size < 4 {
+		return nil, &FormatError{-1, "load configuration", errors.New("bad size"), size}
+	}
+	n := size
+	if n > maxLoadConfigSize {
+		n = maxLoadConfigSize
+	}
+	b := make([]byte, n)
+	if err := f.readRVA(b, dd.VirtualAddress); err != nil {
+		return nil, err
+	}
+
+	r := &loadConfigReader{b: b, pe64: oh.pe64}
+	lc := &LoadConfig{
+		Size:                          r.u32(),
+		TimeDateStamp:                 r.u32(),
+		MajorVersion:                  r.u16(),
+		MinorVersion:                  r.u16(),
+		GlobalFlagsClear:              r.u32(),
+		GlobalFlagsSet:                r.u32(),
+		CriticalSectionDefaultTimeout: r.u32(),
+		DeCommitFreeBlockThreshold:    r.ptr(),
+		DeCommitTotalFreeThreshold:    r.ptr(),
+		LockPrefixTable:               r.ptr(),
+		MaximumAllocationSize:         r.ptr(),
+		VirtualMemoryThreshold:        r.ptr(),
+	}
+	// The two formats store these fields in different orders.
+	if oh.pe64 {
+		lc.ProcessAffinityMask = r.ptr()
+		lc.ProcessHeapFlags = r.u32()
+	} else {
+		lc.ProcessHeapFlags = r.u32()
+		lc.ProcessAffinityMask = r.ptr()
+	}
+	lc.CSDVersion = r.u16()
+	lc.DependentLoadFlags = r.u16()
+	lc.EditList = r.ptr()
+	lc.SecurityCookie = r.ptr()
+	lc.SEHandlerTable = r.ptr()
+	lc.SEHandlerCount = r.ptr()
+	lc.GuardCFCheckFunctionPointer = r.ptr()
+	lc.GuardCFDispatchFunctionPointer = r.ptr()
+	lc.GuardCFFunctionTable = r.ptr()
+	lc.GuardCFFunctionCount = r.ptr()
+	lc.GuardFlags = r.u32()
+	lc.CodeIntegrityFlags = r.u16()
+	lc.CodeIntegrityCatalog = r.u16()
+	lc.CodeIntegrityCatalogOffset = r.u32()
+	r.u32() // CodeIntegrity.Reserved
+	lc.GuardAddressTakenIatEntryTable = r.ptr()
+	lc.GuardAddressTakenIatEntryCount = r.ptr()
+	lc.GuardLongJumpTargetTable = r.ptr()
+	lc.GuardLongJumpTargetCount = r.ptr()
+	lc.DynamicValueRelocTable = r.ptr()
+	lc.CHPEMetadataPointer = r.ptr()
+	lc.GuardRFFailureRoutine = r.ptr()
+	lc.GuardRFFailureRoutineFunctionPointer = r.ptr()
+	lc.DynamicValueRelocTableOffset = r.u32()
+	lc.DynamicValueRelocTableSection = r.u16()
+	r.u16() // Reserved2
+	lc.GuardRFVerifyStackPointerFunctionPointer = r.ptr()
+	lc.HotPatchTableOffset = r.u32()
+	r.u32() // Reserved3
+	lc.EnclaveConfigurationPointer = r.ptr()
+	lc.VolatileMetadataPointer = r.ptr()
+	lc.GuardEHContinuationTable = r.ptr()
+	lc.GuardEHContinuationCount = r.ptr()
+	lc.GuardXFGCheckFunctionPointer = r.ptr()
+	lc.GuardXFGDispatchFunctionPointer = r.ptr()
+	lc.GuardXFGTableDispatchFunctionPointer = r.ptr()
+	lc.CastGuardOsDeterminedFailureMode = r.ptr()
+	lc.GuardMemcpyFunctionPointer = r.ptr()
+	return lc, nil
+}
+
+// loadConfigRVA returns the RVA of the virtual address va, found in
+// the load configuration of f. what names the data at va in errors.
+func (f *File) loadConfigRVA(va uint64, what string) (uint32, error) {
+	base := f.optionalHeader().imageBase
+	if va < base || va-base > 1<<32-1 {
+		return 0, &FormatError{-1, what, ErrOutOfBounds, va}
+	}
+	return uint32(va - base), nil
+}
+
+// A GuardTarget is an entry of a control flow guard table:
+// the RVA of a valid target, followed by metadata bytes whose
+// number GuardFlags gives.
+type GuardTarget struct {
+	RVA      uint32
+	Metadata []byte
+}
+
+// guardTable reads the guard table of count entries at the virtual
+// address va of f, described by lc. what names the table in errors.
+func (f *File) guardTable(lc *LoadConfig, va, count uint64, what string) ([]GuardTarget, error) {
+	if va == 0 || count == 0 {
+		return nil, nil
+	}
+	rva, err := f.loadConfigRVA(va, what)
+	if err != nil {
+		return nil, err
+	}
+	oh := f.optionalHeader()
+	stride := 4 + uint64(lc.GuardFlags&IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_MASK>>IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT)
+	// The count comes from the file, so check that
+	// the table fits in the image before allocating.
+	if count > uint64(oh.sizeOfImage)/stride || uint64(rva)+count*stride > uint64(oh.sizeOfImage) {
+		return nil, &FormatError{-1, what, ErrOutOfBounds, count}
+	}
+	b := make([]byte, count*stride)
+	if err := f.readRVA(b, rva); err != nil {
+		return nil, err
+	}
+	targets := make([]GuardTarget, count)
+	for i := range targets {
+		e := b[uint64(i)*stride : uint64(i+1)*stride : uint64(i+1)*stride]
+		targets[i] = GuardTarget{RVA: binary.LittleEndian.Uint32(e), Metadata: e[4:]}
+	}
+	return targets, nil
+}
+
+// GuardCFFunctions returns the table of valid indirect
+// call targets of f, or nil if f has none.
+func (f *File) GuardCFFunctions() ([]GuardTarget, error) {
+	lc, err := f.LoadConfig()
+	if lc == nil || err != nil {
+		return nil, err
+	}
+	return f.guardTable(lc, lc.GuardCFFunctionTable, lc.GuardCFFunctionCount, "guard CF function table")
+}
+
+// GuardLongJumpTargets returns the table of valid longjmp
+// targets of f, or nil if f has none.
+func (f *File) GuardLongJumpTargets() ([]GuardTarget, error) {
+	lc, err := f.LoadConfig()
+	if lc == nil || err != nil {
+		return nil, err
+	}
+	return f.guardTable(lc, lc.GuardLongJumpTargetTable, lc.GuardLongJumpTargetCount, "guard long jump target table")
+}
+
+// GuardEHContinuations returns the table of valid exception
+// handling continuation targets of f, checked by the loader under
+// CET shadow stacks, or nil if f has none.
+func (f *File) GuardEHContinuations() ([]GuardTarget, error) {
+	lc, err := f.LoadConfig()
+	if lc == nil || err != nil {
+		return nil, err
+	}
+	return f.guardTable(lc, lc.GuardEHContinuationTable, lc.GuardEHContinuationCount, "guard EH continuation table")
+}
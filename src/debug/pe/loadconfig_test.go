@@ -0,0 +1,233 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// loadConfigImage returns the image file with a new section holding
+// the contents that build returns for the section's relative and
+// absolute virtual addresses, pointed to by the load configuration
+// directory.
+func loadConfigImage(t *testing.T, file string, build func(rva uint32, va uint64) []byte) *File {
+	f, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := f.unsignedImage("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rva := f.nextSectionRVA()
+	c := build(uint32(rva), f.optionalHeader().imageBase+uint64(rva))
+	if b, err = f.addSection(b, ".lcfg", rva, c, IMAGE_SCN_CNT_INITIALIZED_DATA|IMAGE_SCN_MEM_READ); err != nil {
+		t.Fatal(err)
+	}
+	f.setDataDirectory(b, IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG, DataDirectory{VirtualAddress: uint32(rva), Size: binary.LittleEndian.Uint32(c)})
+	g, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestLoadConfig32(t *testing.T) {
+	f := loadConfigImage(t, "testdata/gcc-386-mingw-exec", func(uint32, uint64) []byte {
+		// The Windows XP structure, followed by
+		// bytes that are not part of it.
+		c := make([]byte, 0x48+16)
+		for i := range c {
+			c[i] = 0xff
+		}
+		binary.LittleEndian.PutUint32(c[0:], 0x48)
+		binary.LittleEndian.PutUint32(c[44:], 7) // ProcessHeapFlags
+		binary.LittleEndian.PutUint32(c[48:], 9) // ProcessAffinityMask
+		binary.LittleEndian.PutUint32(c[68:], 3) // SEHandlerCount
+		return c
+	})
+	lc, err := f.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.Size != 0x48 || lc.ProcessHeapFlags != 7 || lc.ProcessAffinityMask != 9 || lc.SEHandlerCount != 3 {
+		t.Errorf("LoadConfig = %+v", lc)
+	}
+	if lc.GuardFlags != 0 || lc.GuardCFFunctionTable != 0 {
+		t.Errorf("fields past Size are not zero: %+v", lc)
+	}
+	d, err := f.DataDirectory(IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Data != lc && !reflect.DeepEqual(d.Data, lc) {
+		t.Errorf("DataDirectory(%d).Data = %v, want %v", IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG, d.Data, lc)
+	}
+}
+
+func TestGuardTables(t *testing.T) {
+	f := loadConfigImage(t, "testdata/gcc-amd64-mingw-exec", func(_ uint32, va uint64) []byte {
+		c := make([]byte, maxLoadConfigSize+2*5+3*5)
+		binary.LittleEndian.PutUint32(c[0:], maxLoadConfigSize)
+		// One metadata byte per entry.
+		binary.LittleEndian.PutUint32(c[144:], IMAGE_GUARD_CF_LONGJUMP_TABLE_PRESENT|IMAGE_GUARD_EH_CONTINUATION_TABLE_PRESENT|1<<IMAGE_GUARD_CF_FUNCTION_TABLE_SIZE_SHIFT)
+		binary.LittleEndian.PutUint64(c[176:], va+maxLoadConfigSize)
+		binary.LittleEndian.PutUint64(c[184:], 2)
+		binary.LittleEndian.PutUint64(c[264:], va+maxLoadConfigSize+2*5)
+		binary.LittleEndian.PutUint64(c[272:], 3)
+		for i := 0; i < 5; i++ {
+			e := c[maxLoadConfigSize+5*i:]
+			binary.LittleEndian.PutUint32(e, 0x1000+uint32(i)*0x10)
+			e[4] = byte(i)
+		}
+		return c
+	})
+	lc, err := f.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lc.GuardLongJumpTargetCount != 2 || lc.GuardEHContinuationCount != 3 {
+		t.Errorf("LoadConfig = %+v", lc)
+	}
+	lj, err := f.GuardLongJumpTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GuardTarget{{0x1000, []byte{0}}, {0x1010, []byte{1}}}
+	if !reflect.DeepEqual(lj, want) {
+		t.Errorf("GuardLongJumpTargets = %v, want %v", lj, want)
+	}
+	eh, err := f.GuardEHContinuations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []GuardTarget{{0x1020, []byte{2}}, {0x1030, []byte{3}}, {0x1040, []byte{4}}}
+	if !reflect.DeepEqual(eh, want) {
+		t.Errorf("GuardEHContinuations = %v, want %v", eh, want)
+	}
+	if cf, err := f.GuardCFFunctions(); cf != nil || err != nil {
+		t.Errorf("GuardCFFunctions = %v, %v; want none", cf, err)
+	}
+}
+
+func TestHotPatchInfo(t *testing.T) {
+	f := loadConfigImage(t, "testdata/gcc-amd64-mingw-exec", func(rva uint32, _ uint64) []byte {
+		c := make([]byte, maxLoadConfigSize+24+8+2*32)
+		binary.LittleEndian.PutUint32(c[0:], maxLoadConfigSize)
+		binary.LittleEndian.PutUint32(c[240:], rva+maxLoadConfigSize)
+		info := c[maxLoadConfigSize:]
+		binary.LittleEndian.PutUint32(info[0:], 2)                         // Version
+		binary.LittleEndian.PutUint32(info[4:], 24)                        // Size
+		binary.LittleEndian.PutUint32(info[8:], 5)                         // SequenceNumber
+		binary.LittleEndian.PutUint32(info[12:], rva+maxLoadConfigSize+24) // BaseImageList
+		binary.LittleEndian.PutUint32(info[16:], 2)                        // BaseImageCount
+		binary.LittleEndian.PutUint32(info[20:], 0x77)                     // BufferOffset
+		for i := 0; i < 2; i++ {
+			off := uint32(maxLoadConfigSize + 24 + 8 + 32*i)
+			binary.LittleEndian.PutUint32(info[24+4*i:], rva+off)
+			base := c[off:]
+			binary.LittleEndian.PutUint32(base[0:], 5)
+			binary.LittleEndian.PutUint32(base[4:], IMAGE_HOT_PATCH_BASE_CAN_ROLL_BACK)
+			binary.LittleEndian.PutUint32(base[8:], 0x1000+uint32(i))
+			binary.LittleEndian.PutUint32(base[28:], 0x88)
+		}
+		return c
+	})
+	hp, err := f.HotPatchInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := HotPatchBase{SequenceNumber: 5, Flags: IMAGE_HOT_PATCH_BASE_CAN_ROLL_BACK, OriginalTimeDateStamp: 0x1000, BufferOffset: 0x88}
+	want := &HotPatchInfo{Version: 2, Size: 24, SequenceNumber: 5, BufferOffset: 0x77, Bases: []HotPatchBase{base, base}}
+	want.Bases[1].OriginalTimeDateStamp++
+	if !reflect.DeepEqual(hp, want) {
+		t.Errorf("HotPatchInfo = %+v, want %+v", hp, want)
+	}
+}
+
+func TestEnclaveConfig(t *testing.T) {
+	const name = "vertdll.dll"
+	f := loadConfigImage(t, "testdata/gcc-amd64-mingw-exec", func(rva uint32, va uint64) []byte {
+		c := make([]byte, maxLoadConfigSize+80+88+len(name)+1)
+		binary.LittleEndian.PutUint32(c[0:], maxLoadConfigSize)
+		binary.LittleEndian.PutUint64(c[248:], va+maxLoadConfigSize)
+		ec := c[maxLoadConfigSize:]
+		binary.LittleEndian.PutUint32(ec[0:], 80)                              // Size
+		binary.LittleEndian.PutUint32(ec[8:], IMAGE_ENCLAVE_POLICY_DEBUGGABLE) // PolicyFlags
+		binary.LittleEndian.PutUint32(ec[12:], 1)                              // NumberOfImports
+		binary.LittleEndian.PutUint32(ec[16:], rva+maxLoadConfigSize+80)       // ImportList
+		binary.LittleEndian.PutUint32(ec[20:], 88)                             // ImportEntrySize
+		ec[24] = 0xfa                                                          // FamilyID
+		binary.LittleEndian.PutUint32(ec[60:], 3)                              // SecurityVersion
+		binary.LittleEndian.PutUint64(ec[64:], 1<<30)                          // EnclaveSize
+		binary.LittleEndian.PutUint32(ec[72:], 16)                             // NumberOfThreads
+		imp := ec[80:]
+		binary.LittleEndian.PutUint32(imp[0:], IMAGE_ENCLAVE_IMPORT_MATCH_AUTHOR_ID)
+		imp[8] = 0xa0 // UniqueOrAuthorID
+		binary.LittleEndian.PutUint32(imp[72:], rva+maxLoadConfigSize+80+88)
+		copy(imp[88:], name)
+		return c
+	})
+	ec, err := f.EnclaveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EnclaveConfig{
+		Size:            80,
+		PolicyFlags:     IMAGE_ENCLAVE_POLICY_DEBUGGABLE,
+		FamilyID:        [16]byte{0xfa},
+		SecurityVersion: 3,
+		EnclaveSize:     1 << 30,
+		NumberOfThreads: 16,
+		Imports: []EnclaveImport{{
+			MatchType:        IMAGE_ENCLAVE_IMPORT_MATCH_AUTHOR_ID,
+			UniqueOrAuthorID: [32]byte{0xa0},
+			Name:             name,
+		}},
+	}
+	if !reflect.DeepEqual(ec, want) {
+		t.Errorf("EnclaveConfig = %+v, want %+v", ec, want)
+	}
+}
+
+func TestVolatileMetadata(t *testing.T) {
+	f := loadConfigImage(t, "testdata/gcc-amd64-mingw-exec", func(rva uint32, va uint64) []byte {
+		c := make([]byte, maxLoadConfigSize+24+3*4+2*8)
+		binary.LittleEndian.PutUint32(c[0:], maxLoadConfigSize)
+		binary.LittleEndian.PutUint64(c[256:], va+maxLoadConfigSize)
+		vm := c[maxLoadConfigSize:]
+		binary.LittleEndian.PutUint32(vm[0:], 24)
+		binary.LittleEndian.PutUint32(vm[4:], 1)
+		binary.LittleEndian.PutUint32(vm[8:], rva+maxLoadConfigSize+24)
+		binary.LittleEndian.PutUint32(vm[12:], 3*4)
+		binary.LittleEndian.PutUint32(vm[16:], rva+maxLoadConfigSize+24+3*4)
+		binary.LittleEndian.PutUint32(vm[20:], 2*8)
+		for i := 0; i < 3; i++ {
+			binary.LittleEndian.PutUint32(vm[24+4*i:], 0x1000+uint32(i)*4)
+		}
+		for i := 0; i < 2; i++ {
+			binary.LittleEndian.PutUint32(vm[36+8*i:], 0x1000+uint32(i)*0x100)
+			binary.LittleEndian.PutUint32(vm[40+8*i:], 0x80)
+		}
+		return c
+	})
+	vm, err := f.VolatileMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &VolatileMetadata{
+		Size:       24,
+		Version:    1,
+		AccessRVAs: []uint32{0x1000, 0x1004, 0x1008},
+		InfoRanges: []VolatileRange{{0x1000, 0x80}, {0x1100, 0x80}},
+	}
+	if !reflect.DeepEqual(vm, want) {
+		t.Errorf("VolatileMetadata = %+v, want %+v", vm, want)
+	}
+}
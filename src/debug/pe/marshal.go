@@ -0,0 +1,154 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// The header and record types implement encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler with their encodings in files,
+// so that tools can produce and consume them without repeating
+// their layouts. UnmarshalBinary requires exactly the number of
+// bytes MarshalBinary produces.
+
+// errExtraData is reported by UnmarshalBinary for
+// data past the end of the structure it decodes.
+var errExtraData = errors.New("data past the end of the structure")
+
+// encodeLE returns prefix followed by the little-endian
+// encoding of v, a pointer to a fixed-size structure.
+func encodeLE(prefix []byte, v interface{}) []byte {
+	buf := bytes.NewBuffer(prefix)
+	// Writing fixed-size data to a buffer cannot fail.
+	binary.Write(buf, binary.LittleEndian, v)
+	return buf.Bytes()
+}
+
+// decodeLE decodes b, the little-endian encoding of what,
+// into v, a pointer to a fixed-size structure.
+func decodeLE(b []byte, v interface{}, what string) error {
+	switch n := binary.Size(v); {
+	case len(b) < n:
+		return &FormatError{-1, what, ErrTruncated, len(b)}
+	case len(b) > n:
+		return &FormatError{-1, what, errExtraData, len(b)}
+	}
+	return binary.Read(bytes.NewReader(b), binary.LittleEndian, v)
+}
+
+// MarshalBinary returns the 20-byte encoding of h.
+func (h FileHeader) MarshalBinary() ([]byte, error) {
+	return encodeLE(nil, &h), nil
+}
+
+// UnmarshalBinary decodes the 20-byte encoding b into h.
+func (h *FileHeader) UnmarshalBinary(b []byte) error {
+	return decodeLE(b, h, "COFF file header")
+}
+
+// MarshalBinary returns the 224-byte encoding of h.
+func (h OptionalHeader32) MarshalBinary() ([]byte, error) {
+	return encodeLE(nil, &h), nil
+}
+
+// UnmarshalBinary decodes the 224-byte encoding b into h.
+// Optional headers with fewer data directories must be
+// padded with zeros.
+func (h *OptionalHeader32) UnmarshalBinary(b []byte) error {
+	return decodeLE(b, h, "optional header")
+}
+
+// MarshalBinary returns the 240-byte encoding of h.
+func (h OptionalHeader64) MarshalBinary() ([]byte, error) {
+	return encodeLE(nil, &h), nil
+}
+
+// UnmarshalBinary decodes the 240-byte encoding b into h.
+// Optional headers with fewer data directories must be
+// padded with zeros.
+func (h *OptionalHeader64) UnmarshalBinary(b []byte) error {
+	return decodeLE(b, h, "optional header")
+}
+
+// MarshalBinary returns the 40-byte encoding of h.
+func (h SectionHeader32) MarshalBinary() ([]byte, error) {
+	return encodeLE(nil, &h), nil
+}
+
+// UnmarshalBinary decodes the 40-byte encoding b into h.
+func (h *SectionHeader32) UnmarshalBinary(b []byte) error {
+	return decodeLE(b, h, "section header")
+}
+
+// MarshalBinary returns the COFFSymbolSize-byte encoding of sym.
+func (sym COFFSymbol) MarshalBinary() ([]byte, error) {
+	return encodeLE(nil, &sym), nil
+}
+
+// UnmarshalBinary decodes the COFFSymbolSize-byte encoding b into sym.
+func (sym *COFFSymbol) UnmarshalBinary(b []byte) error {
+	return decodeLE(b, sym, "symbol")
+}
+
+// MarshalBinary returns the COFFBigSymbolSize-byte encoding of sym.
+func (sym COFFBigSymbol) MarshalBinary() ([]byte, error) {
+	return encodeLE(nil, &sym), nil
+}
+
+// UnmarshalBinary decodes the COFFBigSymbolSize-byte encoding b into sym.
+func (sym *COFFBigSymbol) UnmarshalBinary(b []byte) error {
+	return decodeLE(b, sym, "big object symbol")
+}
+
+// anonSignature starts anonymous object headers: a machine
+// of IMAGE_FILE_MACHINE_UNKNOWN and 0xffff sections.
+var anonSignature = []byte{0, 0, 0xff, 0xff}
+
+// MarshalBinary returns the encoding of h, starting with the
+// signature that sets it apart from a COFF file header. Headers
+// of Version 2 and later are 44 bytes long and have all fields;
+// earlier ones are 32 bytes long and lack Flags, MetaDataSize
+// and MetaDataOffset.
+func (h AnonObjectHeader) MarshalBinary() ([]byte, error) {
+	b := encodeLE(append([]byte(nil), anonSignature...), &h)
+	if h.Version < 2 {
+		b = b[:anonObjectHeaderSize]
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes b, as returned by MarshalBinary, into h.
+func (h *AnonObjectHeader) UnmarshalBinary(b []byte) error {
+	ah, err := ReadAnonObjectHeader(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	n := anonObjectHeaderSize
+	if ah.Version >= 2 {
+		n = anonObjectHeaderV2Size
+	}
+	if len(b) > n {
+		return &FormatError{-1, "anonymous object header", errExtraData, len(b)}
+	}
+	*h = *ah
+	return nil
+}
+
+// MarshalBinary returns the 56-byte encoding of h, starting with
+// the signature that sets it apart from a COFF file header.
+func (h BigObjHeader) MarshalBinary() ([]byte, error) {
+	return encodeLE(append([]byte(nil), anonSignature...), &h), nil
+}
+
+// UnmarshalBinary decodes the 56-byte encoding b into h.
+func (h *BigObjHeader) UnmarshalBinary(b []byte) error {
+	if !isImportOrAnon(b) {
+		return &FormatError{-1, "big object header", ErrBadMagic, nil}
+	}
+	return decodeLE(b[len(anonSignature):], h, "big object header")
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// binaryRecord is implemented by the pointers
+// to the header and record types.
+type binaryRecord interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+func TestMarshalBinary(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh := f.base
+	oh := fh + 20
+	sh := oh + int64(f.SizeOfOptionalHeader)
+	sym := int64(f.PointerToSymbolTable)
+	s := f.Sections[1]
+	sh32 := SectionHeader32{
+		VirtualSize:          s.VirtualSize,
+		VirtualAddress:       s.VirtualAddress,
+		SizeOfRawData:        s.Size,
+		PointerToRawData:     s.Offset,
+		PointerToRelocations: s.PointerToRelocations,
+		PointerToLineNumbers: s.PointerToLineNumbers,
+		NumberOfRelocations:  s.NumberOfRelocations,
+		NumberOfLineNumbers:  s.NumberOfLineNumbers,
+		Characteristics:      s.Characteristics,
+	}
+	copy(sh32.Name[:], s.Name)
+	tests := []struct {
+		v, zero binaryRecord
+		enc     []byte
+	}{
+		{&f.FileHeader, new(FileHeader), raw[fh:oh]},
+		{f.OptionalHeader.(*OptionalHeader64), new(OptionalHeader64), raw[oh:sh]},
+		{&sh32, new(SectionHeader32), raw[sh+40 : sh+80]},
+		{&f.COFFSymbols[2], new(COFFSymbol), raw[sym+2*COFFSymbolSize : sym+3*COFFSymbolSize]},
+		{&OptionalHeader32{Magic: 0x10b, ImageBase: 0x400000}, new(OptionalHeader32), nil},
+		{&COFFBigSymbol{Value: 4, SectionNumber: 1 << 20, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}, new(COFFBigSymbol), nil},
+		{&BigObjHeader{Version: 2, Machine: IMAGE_FILE_MACHINE_AMD64, ClassID: bigObjClassID, NumberOfSections: 1 << 20}, new(BigObjHeader), nil},
+		{&AnonObjectHeader{Version: 1, Machine: IMAGE_FILE_MACHINE_I386, SizeOfData: 10}, new(AnonObjectHeader), nil},
+		{&AnonObjectHeader{Version: 2, Machine: IMAGE_FILE_MACHINE_I386, Flags: 1}, new(AnonObjectHeader), nil},
+	}
+	for _, tt := range tests {
+		b, err := tt.v.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.enc != nil && !bytes.Equal(b, tt.enc) {
+			t.Errorf("%T: MarshalBinary = %x, want %x", tt.v, b, tt.enc)
+		}
+		switch tt.v.(type) {
+		case *AnonObjectHeader, *BigObjHeader:
+			if !isImportOrAnon(b) {
+				t.Errorf("%T: MarshalBinary = %x, without the signature", tt.v, b)
+			}
+		}
+		if err := tt.zero.UnmarshalBinary(b); err != nil {
+			t.Errorf("%T: UnmarshalBinary: %v", tt.v, err)
+		} else if !reflect.DeepEqual(tt.zero, tt.v) {
+			t.Errorf("%T: UnmarshalBinary = %+v, want %+v", tt.v, tt.zero, tt.v)
+		}
+		if err := tt.zero.UnmarshalBinary(b[:len(b)-1]); err == nil {
+			t.Errorf("%T: UnmarshalBinary of a truncated encoding succeeded", tt.v)
+		}
+		if err := tt.zero.UnmarshalBinary(append(b, 0)); err == nil {
+			t.Errorf("%T: UnmarshalBinary with extra data succeeded", tt.v)
+		}
+	}
+}
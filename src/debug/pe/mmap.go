@@ -0,0 +1,97 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// OpenMmap is like OpenWithOptions, but memory-maps the named file
+// rather than reading it with system calls. The symbol table is
+// decoded straight from the mapping, and Section.Data returns slices
+// of the mapping rather than copies: they are read-only, and must
+// not be used after the File is closed. Close unmaps the file.
+// On systems without memory mapping support, OpenMmap reads the
+// whole file into memory instead.
+func OpenMmap(name string, opts *Options) (*File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		return nil, errors.New("pe: cannot map empty file " + name)
+	}
+	if size != int64(int(size)) {
+		return nil, errors.New("pe: file " + name + " is too large to map")
+	}
+	data, err := mmap(f, 0, int(size))
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: name, Err: err}
+	}
+	ff, err := NewFileFromBytes(data, opts)
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+	ff.closer = mapping(data)
+	return ff, nil
+}
+
+// mapping is an io.Closer that unmaps memory returned by mmap.
+type mapping []byte
+
+func (m mapping) Close() error {
+	return munmap(m)
+}
+
+// mmapAlign is the alignment of the file offsets passed to mmap:
+// the allocation granularity of Windows, which is a multiple of
+// the page size on the other systems.
+const mmapAlign = 64 << 10
+
+// sectionMapper maps the raw data of the sections of a file opened
+// with Options.MapSections. Closing it unmaps the data and closes
+// the file.
+type sectionMapper struct {
+	f *os.File
+
+	mu   sync.Mutex
+	maps []mapping
+}
+
+// mapRange maps size bytes of the file starting at offset off.
+func (m *sectionMapper) mapRange(off, size int64) ([]byte, error) {
+	start := off &^ (mmapAlign - 1)
+	n := off - start + size
+	if n != int64(int(n)) {
+		return nil, errTooLarge
+	}
+	b, err := mmap(m.f, start, int(n))
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: m.f.Name(), Err: err}
+	}
+	m.mu.Lock()
+	m.maps = append(m.maps, mapping(b))
+	m.mu.Unlock()
+	return b[off-start : n : n], nil
+}
+
+func (m *sectionMapper) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.maps {
+		b.Close()
+	}
+	m.maps = nil
+	return m.f.Close()
+}
@@ -0,0 +1,23 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package pe
+
+import "os"
+
+// mmap reads the file into memory, as memory mapping
+// is not supported on this system.
+func mmap(f *os.File, off int64, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if n, err := f.ReadAt(b, off); n < size {
+		return nil, err
+	}
+	return b, nil
+}
+
+func munmap(b []byte) error {
+	return nil
+}
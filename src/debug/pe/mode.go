@@ -0,0 +1,296 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A ParseMode selects how strictly NewFileWithOptions
+// checks a file against the PE specification.
+type ParseMode int
+
+const (
+	// ParseDefault is the behavior of NewFile: malformed
+	// structures that prevent parsing are errors, but
+	// layout rules of the specification are not checked.
+	ParseDefault ParseMode = iota
+
+	// ParseStrict additionally rejects files that violate
+	// layout rules of the specification, such as overlapping
+	// or misaligned sections. It suits validators.
+	ParseStrict
+
+	// ParsePermissive tolerates malformations that the Windows
+	// loader accepts or that do not prevent the rest of the file
+	// from being parsed, such as an unrecognized machine type,
+	// a bad optional header magic, an oversized optional header
+	// or an unreadable symbol table or relocation list. Tolerated
+	// problems are recorded in File.Warnings. It suits tools that
+	// analyze malware, which is often deliberately malformed.
+	ParsePermissive
+)
+
+// tolerate returns err, unless f is being parsed permissively,
+// in which case it records err in f.Warnings and returns nil.
+func (f *File) tolerate(err error) error {
+	if f.mode != ParsePermissive {
+		return err
+	}
+	f.Warnings = append(f.Warnings, err)
+	return nil
+}
+
+// salvage returns nil if f is being parsed in recovery mode,
+// after recording err in f.Errors. Otherwise it is like tolerate.
+func (f *File) salvage(err error) error {
+	if f.recover {
+		f.Errors = append(f.Errors, err)
+		return nil
+	}
+	return f.tolerate(err)
+}
+
+// readOddOptionalHeader reads the optional header at offset off,
+// whose size is not the standard one, choosing its format by its
+// magic number.
+func (f *File) readOddOptionalHeader(off int64) error {
+	var magic [2]byte
+	if _, err := f.r.ReadAt(magic[:], off); err != nil {
+		return formatError(off, "optional header", err)
+	}
+	// A short header is padded with zeros, as the loader does.
+	buf := make([]byte, sizeofOptionalHeader64)
+	n := int(f.SizeOfOptionalHeader)
+	if n > len(buf) {
+		n = len(buf)
+	}
+	if _, err := f.r.ReadAt(buf[:n], off); err != nil {
+		return formatError(off, "optional header", err)
+	}
+	var oh interface{}
+	switch binary.LittleEndian.Uint16(magic[:]) {
+	case 0x10b: // PE32
+		oh = new(OptionalHeader32)
+	case 0x20b: // PE32+
+		oh = new(OptionalHeader64)
+	default:
+		return &FormatError{off, "optional header", ErrBadMagic, binary.LittleEndian.Uint16(magic[:])}
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, oh); err != nil {
+		return formatError(off, "optional header", err)
+	}
+	f.OptionalHeader = oh
+	return nil
+}
+
+// hasShortOptionalHeader reports whether the optional header at
+// offset off has fewer than 16 data directories and a size that
+// matches their number, as the specification allows.
+func (f *File) hasShortOptionalHeader(off int64) bool {
+	var magic [2]byte
+	if _, err := f.r.ReadAt(magic[:], off); err != nil {
+		return false
+	}
+	// fixed is the size of the header without data directories.
+	var fixed int64
+	switch binary.LittleEndian.Uint16(magic[:]) {
+	case 0x10b: // PE32
+		fixed = int64(sizeofOptionalHeader32) - 16*8
+	case 0x20b: // PE32+
+		fixed = int64(sizeofOptionalHeader64) - 16*8
+	default:
+		return false
+	}
+	size := int64(f.SizeOfOptionalHeader)
+	if size < fixed || size >= fixed+16*8 || (size-fixed)%8 != 0 {
+		return false
+	}
+	var n [4]byte
+	if _, err := f.r.ReadAt(n[:], off+fixed-4); err != nil {
+		return false
+	}
+	return int64(binary.LittleEndian.Uint32(n[:])) == (size-fixed)/8
+}
+
+// checkStrict checks the layout rules that ParseStrict enforces.
+func (f *File) checkStrict() error {
+	oh := f.optionalHeader()
+	if f.TEHeader != nil {
+		// TE images keep no alignments or sizes to check.
+		return f.checkSectionOverlap(true)
+	}
+	if oh == nil {
+		if f.SizeOfOptionalHeader != 0 {
+			return &FormatError{-1, "optional header", errors.New("unexpected size"), f.SizeOfOptionalHeader}
+		}
+		return f.checkSectionOverlap(false)
+	}
+	fa, sa := oh.fileAlignment, oh.sectionAlignment
+	// FileAlignment may be below 512 if it equals SectionAlignment,
+	// as in firmware drivers, which use 32-byte alignments.
+	if fa == 0 || fa < 512 && fa != sa || fa > 64<<10 || fa&(fa-1) != 0 {
+		return &FormatError{-1, "optional header", errors.New("FileAlignment is not a power of 2 between 512 and 64K"), fa}
+	}
+	if sa < fa || sa&(sa-1) != 0 {
+		return &FormatError{-1, "optional header", errors.New("SectionAlignment is not a power of 2 at least FileAlignment"), sa}
+	}
+	if oh.sizeOfHeaders%fa != 0 {
+		return &FormatError{-1, "optional header", errors.New("SizeOfHeaders is not a multiple of FileAlignment"), oh.sizeOfHeaders}
+	}
+	if oh.sizeOfImage%sa != 0 {
+		return &FormatError{-1, "optional header", errors.New("SizeOfImage is not a multiple of SectionAlignment"), oh.sizeOfImage}
+	}
+	for _, s := range f.Sections {
+		if s.VirtualAddress%sa != 0 {
+			return &FormatError{-1, "section " + s.Name, errors.New("VirtualAddress is not a multiple of SectionAlignment"), s.VirtualAddress}
+		}
+		if s.Offset%fa != 0 {
+			return &FormatError{-1, "section " + s.Name, errors.New("PointerToRawData is not a multiple of FileAlignment"), s.Offset}
+		}
+		if s.Size%fa != 0 {
+			return &FormatError{-1, "section " + s.Name, errors.New("SizeOfRawData is not a multiple of FileAlignment"), s.Size}
+		}
+		if f.size >= 0 && s.Offset != 0 && int64(s.Offset)+int64(s.Size) > f.size {
+			return &FormatError{int64(s.Offset), "section " + s.Name, ErrOutOfBounds, s.Size}
+		}
+		if int64(s.VirtualAddress)+s.virtualSize() > int64(oh.sizeOfImage) {
+			return &FormatError{-1, "section " + s.Name, errors.New("extends beyond SizeOfImage"), s.VirtualAddress}
+		}
+	}
+	return f.checkSectionOverlap(true)
+}
+
+// checkSectionOverlap reports an error if the raw data of any two
+// sections overlaps in the file or, if virtual is set, if any two
+// sections overlap in memory.
+func (f *File) checkSectionOverlap(virtual bool) error {
+	raw, mem := f.sectionOverlaps(virtual)
+	var err error
+	for i, s := range f.Sections {
+		overlapsOf(raw, mem, i, func(j int, inRaw, inMem bool) bool {
+			t := f.Sections[j]
+			if inRaw {
+				err = &FormatError{int64(t.Offset), "section " + t.Name, fmt.Errorf("raw data overlaps section %s", s.Name), nil}
+			} else {
+				err = &FormatError{-1, "section " + t.Name, fmt.Errorf("overlaps section %s in memory", s.Name), nil}
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sectionOverlaps returns, for each section i of f, the indices
+// of the later sections whose raw data overlaps that of section i
+// and, if virtual is set, of those that overlap it in memory.
+func (f *File) sectionOverlaps(virtual bool) (raw, mem [][]int) {
+	raw = overlapping(len(f.Sections), func(i int) (int64, int64) {
+		s := f.Sections[i]
+		if s.Offset == 0 {
+			return 0, 0
+		}
+		return int64(s.Offset), int64(s.Size)
+	})
+	if virtual {
+		mem = overlapping(len(f.Sections), func(i int) (int64, int64) {
+			s := f.Sections[i]
+			return int64(s.VirtualAddress), s.virtualSize()
+		})
+	}
+	return raw, mem
+}
+
+// overlapsOf calls fn, in increasing order of j, for each j listed
+// in raw[i] or mem[i], as returned by sectionOverlaps, saying which
+// of them lists it. It stops early if fn returns false.
+func overlapsOf(raw, mem [][]int, i int, fn func(j int, inRaw, inMem bool) bool) {
+	var r, m []int
+	if raw != nil {
+		r = raw[i]
+	}
+	if mem != nil {
+		m = mem[i]
+	}
+	for len(r) > 0 || len(m) > 0 {
+		var j int
+		switch {
+		case len(m) == 0 || len(r) > 0 && r[0] <= m[0]:
+			j = r[0]
+		default:
+			j = m[0]
+		}
+		inRaw := len(r) > 0 && r[0] == j
+		inMem := len(m) > 0 && m[0] == j
+		if inRaw {
+			r = r[1:]
+		}
+		if inMem {
+			m = m[1:]
+		}
+		if !fn(j, inRaw, inMem) {
+			return
+		}
+	}
+}
+
+// overlapping returns, for each of n ranges, the indices of the
+// later ranges that overlap it, in increasing order, or nil if no
+// ranges overlap. rng returns the offset and size of range i; empty
+// ranges overlap nothing. The ranges are sorted by offset rather
+// than compared pairwise, which would be too slow for objects with
+// tens of thousands of sections.
+func overlapping(n int, rng func(i int) (off, size int64)) [][]int {
+	o := &rangeOrder{idx: make([]int, 0, n), off: make([]int64, n), end: make([]int64, n)}
+	for i := 0; i < n; i++ {
+		off, size := rng(i)
+		if size > 0 {
+			o.idx = append(o.idx, i)
+			o.off[i], o.end[i] = off, off+size
+		}
+	}
+	sort.Sort(o)
+	var res [][]int
+	for k, i := range o.idx {
+		for _, j := range o.idx[k+1:] {
+			if o.off[j] >= o.end[i] {
+				break
+			}
+			if res == nil {
+				res = make([][]int, n)
+			}
+			if j < i {
+				res[j] = append(res[j], i)
+			} else {
+				res[i] = append(res[i], j)
+			}
+		}
+	}
+	for _, js := range res {
+		sort.Ints(js)
+	}
+	return res
+}
+
+// rangeOrder sorts the indices idx of ranges by
+// their offset in off, then by index.
+type rangeOrder struct {
+	idx      []int
+	off, end []int64
+}
+
+func (o *rangeOrder) Len() int      { return len(o.idx) }
+func (o *rangeOrder) Swap(i, j int) { o.idx[i], o.idx[j] = o.idx[j], o.idx[i] }
+func (o *rangeOrder) Less(i, j int) bool {
+	a, b := o.idx[i], o.idx[j]
+	return o.off[a] < o.off[b] || o.off[a] == o.off[b] && a < b
+}
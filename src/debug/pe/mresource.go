@@ -0,0 +1,366 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// A ManagedResource is a resource of a .NET assembly, listed in the
+// ManifestResource metadata table. Resources built from .resx files
+// are in the .resources format that ParseResourceSet reads.
+type ManagedResource struct {
+	Name   string
+	Public bool // exported from the assembly, rather than private
+
+	// File or Assembly is the name of the file of the assembly or
+	// of the other assembly that holds the resource, if it is not
+	// embedded in the assembly itself.
+	File     string
+	Assembly string
+
+	// Data holds the contents of a resource embedded in the
+	// assembly, and is nil for the others.
+	Data []byte
+}
+
+// Flags of ManifestResource rows.
+const (
+	mrPublic     = 0x1
+	mrVisibility = 0x7
+)
+
+// ManagedResources returns the managed resources of the .NET
+// assembly f, in metadata order, or nil if f is not an assembly.
+// The contents of embedded resources are read from the Resources
+// directory of the CLR runtime header.
+func (f *File) ManagedResources() ([]ManagedResource, error) {
+	h, err := f.CLRHeader()
+	if h == nil || err != nil {
+		return nil, err
+	}
+	m, err := f.clrMetadata(h)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.table(mdTableManifestResource)
+	if err != nil {
+		return nil, err
+	}
+	var files, refs [][]uint32
+	if m.rows[mdTableFile] > 0 {
+		if files, err = m.table(mdTableFile); err != nil {
+			return nil, err
+		}
+	}
+	if m.rows[mdTableAssemblyRef] > 0 {
+		if refs, err = m.table(mdTableAssemblyRef); err != nil {
+			return nil, err
+		}
+	}
+	// name returns the name, in column col, of row
+	// i, counting from 1, of a table of rows.
+	name := func(rows [][]uint32, i uint32, col int, what string) (string, error) {
+		if i == 0 || uint64(i) > uint64(len(rows)) {
+			return "", &FormatError{-1, "CLR manifest resource " + what, ErrOutOfBounds, i}
+		}
+		return m.string(rows[i-1][col])
+	}
+
+	res := make([]ManagedResource, len(rows))
+	for i, row := range rows {
+		r := &res[i]
+		if r.Name, err = m.string(row[2]); err != nil {
+			return nil, err
+		}
+		r.Public = row[1]&mrVisibility == mrPublic
+		impl := row[3]
+		switch {
+		case impl == 0:
+			if r.Data, err = f.embeddedResource(h, row[0]); err != nil {
+				return nil, err
+			}
+		case impl&3 == 0: // File
+			if r.File, err = name(files, impl>>2, 1, "File"); err != nil {
+				return nil, err
+			}
+		case impl&3 == 1: // AssemblyRef
+			if r.Assembly, err = name(refs, impl>>2, 6, "AssemblyRef"); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, &FormatError{-1, "CLR manifest resource " + r.Name, errors.New("bad implementation"), impl}
+		}
+	}
+	return res, nil
+}
+
+// embeddedResource returns the contents of the resource at
+// offset off of the resources of the assembly with header h:
+// a 32-bit size followed by the data.
+func (f *File) embeddedResource(h *CLRHeader, off uint32) ([]byte, error) {
+	var b [4]byte
+	if uint64(off)+4 > uint64(h.Resources.Size) {
+		return nil, &FormatError{-1, "CLR resources", ErrOutOfBounds, off}
+	}
+	rva, err := addRVA(h.Resources.VirtualAddress, uint64(off))
+	if err != nil {
+		return nil, err
+	}
+	if err := f.readRVA(b[:], rva); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(b[:])
+	if uint64(off)+4+uint64(size) > uint64(h.Resources.Size) {
+		return nil, &FormatError{-1, "CLR resources", ErrOutOfBounds, size}
+	}
+	return f.ReadRVA(rva+4, int(size))
+}
+
+// A ResourceSet is the contents of a .resources file, the format
+// in which System.Resources.ResourceManager reads the resources
+// compiled from .resx files.
+type ResourceSet struct {
+	ReaderType string // such as System.Resources.ResourceReader
+	Version    int    // of the resource set format, 1 or 2
+	Items      []ResourceSetItem
+}
+
+// A ResourceSetItem is a named value of a ResourceSet.
+type ResourceSetItem struct {
+	Name string
+
+	// Type is the .NET type of the value, such as System.String,
+	// System.Byte[] or the full name of a serialized type. It is
+	// empty for null values.
+	Type string
+
+	// Data holds the value: the UTF-8 text of strings, the bytes of
+	// byte arrays and streams, the little-endian encoding of other
+	// primitive types, and the serialized form of other types.
+	Data []byte
+}
+
+// resourceSetMagic starts a .resources file.
+const resourceSetMagic = 0xbeefcace
+
+// resourceTypes holds the names of the types of the
+// built-in type codes of version 2 resource sets,
+// and the size of their values, or -1 if variable.
+var resourceTypes = map[uint32]struct {
+	name string
+	size int
+}{
+	0x00: {"", 0},
+	0x01: {"System.String", -1},
+	0x02: {"System.Boolean", 1},
+	0x03: {"System.Char", 2},
+	0x04: {"System.Byte", 1},
+	0x05: {"System.SByte", 1},
+	0x06: {"System.Int16", 2},
+	0x07: {"System.UInt16", 2},
+	0x08: {"System.Int32", 4},
+	0x09: {"System.UInt32", 4},
+	0x0a: {"System.Int64", 8},
+	0x0b: {"System.UInt64", 8},
+	0x0c: {"System.Single", 4},
+	0x0d: {"System.Double", 8},
+	0x0e: {"System.Decimal", 16},
+	0x0f: {"System.DateTime", 8},
+	0x10: {"System.TimeSpan", 8},
+	0x20: {"System.Byte[]", -1},
+	0x21: {"System.IO.Stream", -1},
+}
+
+// resourceUserTypes is the first type code of version
+// 2 resource sets that refers to the list of types.
+const resourceUserTypes = 0x40
+
+// A resourceSetReader reads the fields of a .resources file.
+// Errors are sticky: once a read fails, all reads return zero.
+type resourceSetReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *resourceSetReader) fail() {
+	if r.err == nil {
+		r.err = &FormatError{-1, "resource set", ErrTruncated, r.off}
+	}
+}
+
+func (r *resourceSetReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.b)-r.off {
+		r.fail()
+		return nil
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *resourceSetReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// uvarint reads an integer in the 7-bit encoding of
+// System.IO.BinaryWriter, at most 5 bytes long.
+func (r *resourceSetReader) uvarint() uint32 {
+	var v uint32
+	for shift := uint(0); shift < 35; shift += 7 {
+		b := r.bytes(1)
+		if b == nil {
+			return 0
+		}
+		v |= uint32(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			return v
+		}
+	}
+	r.fail()
+	return 0
+}
+
+// string reads a string prefixed by its length in bytes.
+func (r *resourceSetReader) string() string {
+	return string(r.bytes(int(r.uvarint())))
+}
+
+// ParseResourceSet parses b, the contents of a .resources file,
+// such as a ManagedResource whose name ends in ".resources".
+func ParseResourceSet(b []byte) (*ResourceSet, error) {
+	r := &resourceSetReader{b: b}
+	if r.uint32() != resourceSetMagic {
+		return nil, &FormatError{-1, "resource set", errors.New("bad magic number"), nil}
+	}
+	r.uint32() // version of the resource manager header
+	skip := int(r.uint32())
+	set := new(ResourceSet)
+	hdr := &resourceSetReader{b: r.bytes(skip)}
+	set.ReaderType = hdr.string()
+
+	set.Version = int(r.uint32())
+	if r.err == nil && set.Version != 1 && set.Version != 2 {
+		return nil, &FormatError{-1, "resource set", errors.New("unknown version"), set.Version}
+	}
+	n := int(r.uint32())
+	ntypes := int(r.uint32())
+	if r.err == nil && (n < 0 || ntypes < 0 || n > len(b)/8 || ntypes > len(b)) {
+		return nil, &FormatError{-1, "resource set", ErrOutOfBounds, n}
+	}
+	types := make([]string, 0, ntypes)
+	for i := 0; i < ntypes && r.err == nil; i++ {
+		types = append(types, r.string())
+	}
+	// The name hashes are aligned to 8 bytes with "PAD" bytes.
+	for r.off%8 != 0 && r.err == nil {
+		r.bytes(1)
+	}
+	r.bytes(4 * n) // name hashes
+	namePos := make([]uint32, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		namePos = append(namePos, r.uint32())
+	}
+	dataStart := int(r.uint32())
+	names := r.off
+	if r.err != nil {
+		return nil, r.err
+	}
+	if dataStart < names || dataStart > len(b) {
+		return nil, &FormatError{-1, "resource set", ErrOutOfBounds, dataStart}
+	}
+
+	set.Items = make([]ResourceSetItem, n)
+	offs := make([]int, n)
+	for i, pos := range namePos {
+		if uint64(pos) > uint64(dataStart-names) {
+			return nil, &FormatError{-1, "resource set name", ErrOutOfBounds, pos}
+		}
+		nr := &resourceSetReader{b: b[:dataStart], off: names + int(pos)}
+		name := nr.bytes(int(nr.uvarint()))
+		off := int(nr.uint32())
+		if nr.err != nil {
+			return nil, nr.err
+		}
+		if len(name)%2 != 0 || off < 0 || off > len(b)-dataStart {
+			return nil, &FormatError{-1, "resource set item", ErrOutOfBounds, off}
+		}
+		u := make([]uint16, len(name)/2)
+		for j := range u {
+			u[j] = binary.LittleEndian.Uint16(name[2*j:])
+		}
+		set.Items[i].Name = string(utf16.Decode(u))
+		offs[i] = dataStart + off
+	}
+
+	// The values of serialized types run to the next value.
+	ends := append([]int(nil), offs...)
+	sort.Ints(ends)
+	for i := range set.Items {
+		end := len(b)
+		if j := sort.SearchInts(ends, offs[i]+1); j < len(ends) {
+			end = ends[j]
+		}
+		if err := set.Items[i].decode(&resourceSetReader{b: b[:end], off: offs[i]}, set.Version, types); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// decode decodes the value of item from r, for a
+// resource set of the given version and types.
+func (item *ResourceSetItem) decode(r *resourceSetReader, version int, types []string) error {
+	code := r.uvarint()
+	switch {
+	case r.err != nil:
+		return r.err
+	case version == 1:
+		// Version 1 refers to the list of types only,
+		// with -1, encoded in 5 bytes, for null.
+		if code == 0xffffffff {
+			return nil
+		}
+		if uint64(code) >= uint64(len(types)) {
+			return &FormatError{-1, "resource set item " + item.Name, errors.New("bad type index"), code}
+		}
+		item.Type = types[code]
+		if item.Type == "System.String" || strings.HasPrefix(item.Type, "System.String,") {
+			item.Data = []byte(r.string())
+		} else {
+			item.Data = r.bytes(len(r.b) - r.off)
+		}
+	case code >= resourceUserTypes:
+		if uint64(code-resourceUserTypes) >= uint64(len(types)) {
+			return &FormatError{-1, "resource set item " + item.Name, errors.New("bad type code"), code}
+		}
+		item.Type = types[code-resourceUserTypes]
+		item.Data = r.bytes(len(r.b) - r.off)
+	default:
+		t, ok := resourceTypes[code]
+		if !ok {
+			return &FormatError{-1, "resource set item " + item.Name, errors.New("bad type code"), code}
+		}
+		item.Type = t.name
+		switch {
+		case code == 0x01:
+			item.Data = []byte(r.string())
+		case t.size < 0:
+			item.Data = r.bytes(int(r.uint32()))
+		default:
+			item.Data = r.bytes(t.size)
+		}
+	}
+	return r.err
+}
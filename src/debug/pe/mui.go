@@ -0,0 +1,175 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// Languages returns the distinct language IDs (LANGIDs) of the
+// resources in the tree d, in increasing order.
+func (d *ResourceDirectory) Languages() ([]uint16, error) {
+	res, err := d.Resources()
+	if err != nil {
+		return nil, err
+	}
+	var langs []uint16
+	for _, r := range res {
+		i := sort.Search(len(langs), func(i int) bool { return langs[i] >= r.Language })
+		if i < len(langs) && langs[i] == r.Language {
+			continue
+		}
+		langs = append(langs, 0)
+		copy(langs[i+1:], langs[i:])
+		langs[i] = r.Language
+	}
+	return langs, nil
+}
+
+// ResourcesForLanguage returns the resources of the tree d in the
+// language lang, a LANGID. If the sublanguage of lang is
+// SUBLANG_NEUTRAL (zero), as in 0x09 for English, the resources in
+// every sublanguage of its primary language match.
+func (d *ResourceDirectory) ResourcesForLanguage(lang uint16) ([]Resource, error) {
+	res, err := d.Resources()
+	if err != nil {
+		return nil, err
+	}
+	var out []Resource
+	for _, r := range res {
+		if r.Language == lang || lang>>10 == 0 && r.Language&0x3ff == lang {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// File types of MUIInfo.
+const (
+	MUIMainFile      = 0x11 // a language-neutral file, with satellite .mui files
+	MUISatelliteFile = 0x12 // a .mui file holding the resources of one language
+)
+
+// MUIInfo is the MUI resource configuration of a file, stored as
+// resource 1 of the "MUI" type, which ties a language-neutral
+// file to the .mui satellite files holding its localized
+// resources. Resource types are listed by name or by ID.
+type MUIInfo struct {
+	FileType                 uint32 // MUIMainFile or MUISatelliteFile
+	SystemAttributes         uint32
+	UltimateFallbackLocation uint32 // 1 if in the main file, 2 if in a satellite
+	ServiceChecksum          [16]byte
+	Checksum                 [16]byte
+
+	// MainNameTypes and MainIDTypes are the resource types
+	// kept in the main file.
+	MainNameTypes []string
+	MainIDTypes   []uint32
+
+	// MUINameTypes and MUIIDTypes are the resource types
+	// found in the satellite files.
+	MUINameTypes []string
+	MUIIDTypes   []uint32
+
+	Language                 string // of a satellite file, such as "en-US"
+	UltimateFallbackLanguage string
+}
+
+// DefersToMUI reports whether the file described by m is a
+// language-neutral main file whose localized resources, of the
+// types in m.MUINameTypes and m.MUIIDTypes, are in .mui files.
+func (m *MUIInfo) DefersToMUI() bool {
+	return m.FileType == MUIMainFile && (len(m.MUINameTypes) > 0 || len(m.MUIIDTypes) > 0)
+}
+
+// muiSignature starts the MUI resource configuration.
+const muiSignature = 0xfecdfecd
+
+// muiHeaderSize is the size of the fixed part
+// of the MUI resource configuration.
+const muiHeaderSize = 132
+
+// ParseMUI parses b, the data of a "MUI" resource.
+func ParseMUI(b []byte) (*MUIInfo, error) {
+	if len(b) < muiHeaderSize {
+		return nil, &FormatError{-1, "MUI resource", ErrTruncated, nil}
+	}
+	if sig := binary.LittleEndian.Uint32(b); sig != muiSignature {
+		return nil, &FormatError{-1, "MUI resource", ErrBadMagic, sig}
+	}
+	size := binary.LittleEndian.Uint32(b[4:])
+	if size < muiHeaderSize || uint64(size) > uint64(len(b)) {
+		return nil, &FormatError{-1, "MUI resource", ErrOutOfBounds, size}
+	}
+	b = b[:size]
+	m := &MUIInfo{
+		FileType:                 binary.LittleEndian.Uint32(b[16:]),
+		SystemAttributes:         binary.LittleEndian.Uint32(b[20:]),
+		UltimateFallbackLocation: binary.LittleEndian.Uint32(b[24:]),
+	}
+	copy(m.ServiceChecksum[:], b[28:44])
+	copy(m.Checksum[:], b[44:60])
+	// The variable parts, as offset and size pairs.
+	var parts [6][]byte
+	for i := range parts {
+		off := binary.LittleEndian.Uint32(b[84+8*i:])
+		n := binary.LittleEndian.Uint32(b[88+8*i:])
+		if n == 0 {
+			continue
+		}
+		if uint64(off)+uint64(n) > uint64(len(b)) {
+			return nil, &FormatError{-1, "MUI resource", ErrOutOfBounds, off}
+		}
+		parts[i] = b[off : off+n]
+	}
+	m.MainNameTypes = muiStrings(parts[0])
+	m.MainIDTypes = muiIDs(parts[1])
+	m.MUINameTypes = muiStrings(parts[2])
+	m.MUIIDTypes = muiIDs(parts[3])
+	m.Language = strings.TrimRight(decodeUTF16(parts[4]), "\x00")
+	m.UltimateFallbackLanguage = strings.TrimRight(decodeUTF16(parts[5]), "\x00")
+	return m, nil
+}
+
+// muiStrings splits the list of NUL-terminated UTF-16 strings b.
+func muiStrings(b []byte) []string {
+	var list []string
+	for _, s := range strings.Split(decodeUTF16(b), "\x00") {
+		if s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// muiIDs decodes the list of 32-bit resource type IDs b.
+func muiIDs(b []byte) []uint32 {
+	var ids []uint32
+	for ; len(b) >= 4; b = b[4:] {
+		ids = append(ids, binary.LittleEndian.Uint32(b))
+	}
+	return ids
+}
+
+// MUI returns the MUI resource configuration of f,
+// or nil if f has none.
+func (f *File) MUI() (*MUIInfo, error) {
+	d, err := f.Resources()
+	if err != nil || d == nil {
+		return nil, err
+	}
+	res, err := d.Resources()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range res {
+		if r.Type.Name == "MUI" && r.Name == (ResourceID{ID: 1}) {
+			return ParseMUI(r.Data)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestResourceLanguages(t *testing.T) {
+	var d ResourceDirectory
+	for _, lang := range []uint16{0x40c, 0x409, 0, 0x809, 0x409} {
+		d.Set(&Resource{Type: ResourceID{ID: RT_STRING}, Name: ResourceID{ID: uint16(lang) + 1}, Language: lang})
+	}
+	langs, err := d.Languages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{0, 0x409, 0x40c, 0x809}; !reflect.DeepEqual(langs, want) {
+		t.Errorf("Languages = %#x, want %#x", langs, want)
+	}
+	tests := []struct {
+		lang uint16
+		want []uint16
+	}{
+		{0x409, []uint16{0x409}},
+		{0x09, []uint16{0x409, 0x809}}, // LANG_ENGLISH, SUBLANG_NEUTRAL
+		{0x0c, []uint16{0x40c}},
+		{0, []uint16{0}},
+		{0x407, nil},
+	}
+	for _, tt := range tests {
+		res, err := d.ResourcesForLanguage(tt.lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var have []uint16
+		for _, r := range res {
+			have = append(have, r.Language)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("ResourcesForLanguage(%#x) has languages %#x, want %#x", tt.lang, have, tt.want)
+		}
+	}
+}
+
+// muiResource returns the data of a MUI resource
+// with the given file type, MUI type IDs and language.
+func muiResource(fileType uint32, muiTypes []uint32, lang string) []byte {
+	b := make([]byte, muiHeaderSize)
+	binary.LittleEndian.PutUint32(b[0:], muiSignature)
+	binary.LittleEndian.PutUint32(b[8:], 0x10000)
+	binary.LittleEndian.PutUint32(b[16:], fileType)
+	binary.LittleEndian.PutUint32(b[24:], 1)
+	part := func(i int, data []byte) {
+		binary.LittleEndian.PutUint32(b[84+8*i:], uint32(len(b)))
+		binary.LittleEndian.PutUint32(b[88+8*i:], uint32(len(data)))
+		b = append(b, data...)
+	}
+	var ids []byte
+	for _, id := range muiTypes {
+		ids = append(ids, byte(id), byte(id>>8), byte(id>>16), byte(id>>24))
+	}
+	part(1, []byte{RT_VERSION, 0, 0, 0, RT_MANIFEST, 0, 0, 0})
+	part(2, []byte{'M', 0, 'U', 0, 'I', 0, 0, 0, 'X', 0, 0, 0, 0, 0})
+	part(3, ids)
+	var name []byte
+	for _, u := range utf16.Encode([]rune(lang + "\x00")) {
+		name = append(name, byte(u), byte(u>>8))
+	}
+	part(4, name)
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+	return b
+}
+
+func TestMUI(t *testing.T) {
+	var d ResourceDirectory
+	d.Set(&Resource{
+		Type: ResourceID{Name: "MUI"}, Name: ResourceID{ID: 1}, Language: 0x409,
+		Data: muiResource(MUIMainFile, []uint32{RT_STRING, RT_DIALOG}, "en-US"),
+	})
+	s, err := NewResourceSection(&d, 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := resourceImage(s).MUI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MUIInfo{
+		FileType:                 MUIMainFile,
+		UltimateFallbackLocation: 1,
+		MainIDTypes:              []uint32{RT_VERSION, RT_MANIFEST},
+		MUINameTypes:             []string{"MUI", "X"},
+		MUIIDTypes:               []uint32{RT_STRING, RT_DIALOG},
+		Language:                 "en-US",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("MUI = %+v, want %+v", m, want)
+	}
+	if !m.DefersToMUI() {
+		t.Error("DefersToMUI = false")
+	}
+
+	m, err = ParseMUI(muiResource(MUISatelliteFile, []uint32{RT_STRING}, "fr-FR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DefersToMUI() || m.Language != "fr-FR" {
+		t.Errorf("satellite MUI = %+v", m)
+	}
+
+	b := muiResource(MUIMainFile, nil, "")
+	binary.LittleEndian.PutUint32(b[84+8*2:], 0xfffffff0)
+	if _, err := ParseMUI(b); err == nil {
+		t.Error("ParseMUI accepted a part out of bounds")
+	}
+	if _, err := ParseMUI(b[:100]); err == nil {
+		t.Error("ParseMUI accepted a truncated resource")
+	}
+}
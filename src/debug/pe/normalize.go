@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Normalize writes the image f to w with the fields of its headers
+// that follow from the rest of the image recomputed, so that tools
+// editing images need not keep track of them. The SizeOfRawData of
+// each section stored in the file is aligned to FileAlignment, and
+// the file is padded if the last section then runs past its end.
+// SizeOfCode, SizeOfInitializedData and SizeOfUninitializedData are
+// set to the total aligned sizes of the sections holding code,
+// initialized data and uninitialized data, leaving out discardable
+// ones such as debugging information, as the GNU linker does.
+// SizeOfHeaders is set to the end of the section table, or of a bound
+// import directory stored after it, aligned to FileAlignment, and
+// SizeOfImage to the end of the last section in memory, aligned to
+// SectionAlignment. Finally, the checksum is updated.
+//
+// An attribute certificate table is kept, but the signature it holds
+// no longer matches if fields other than the checksum change.
+// Normalize fails if the size of the file is not known or if f was
+// created by NewFileFromImage.
+func (f *File) Normalize(w io.Writer) error {
+	if f.imageLayout {
+		return errors.New("pe: Normalize called on a loaded image")
+	}
+	oh := f.optionalHeader()
+	if oh == nil || f.TEHeader != nil {
+		return errors.New("pe: Normalize called on a file that is not a PE image")
+	}
+	if oh.fileAlignment == 0 || oh.sectionAlignment == 0 {
+		return &FormatError{-1, "optional header", errors.New("zero alignment"), nil}
+	}
+	r, err := f.fileReader()
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	sectab := int64(f.base) + 20 + int64(f.SizeOfOptionalHeader)
+	hdrEnd := sectab + 40*int64(len(f.Sections))
+	if bound := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT); bound.VirtualAddress != 0 && int64(bound.VirtualAddress) >= hdrEnd {
+		// The bound import directory is in the headers, so
+		// its VirtualAddress is also a file offset.
+		if end := int64(bound.VirtualAddress) + int64(bound.Size); end > hdrEnd {
+			hdrEnd = end
+		}
+	}
+	sizeOfHeaders := alignUp(hdrEnd, oh.fileAlignment)
+	imageEnd := alignUp(sizeOfHeaders, oh.sectionAlignment)
+	var code, data, bss int64
+	for i, s := range f.Sections {
+		sh := sectab + 40*int64(i)
+		raw := int64(s.Size)
+		if s.Offset != 0 && s.Size != 0 {
+			if int64(s.Offset) < sizeOfHeaders {
+				return &FormatError{int64(s.Offset), "section " + s.Name, errors.New("overlaps the headers"), sizeOfHeaders}
+			}
+			raw = alignUp(raw, oh.fileAlignment)
+			end := int64(s.Offset) + raw
+			if end > 1<<32-1 {
+				return &FormatError{sh, "section " + s.Name, ErrOutOfBounds, s.Size}
+			}
+			if end > int64(len(b)) {
+				b = append(b, make([]byte, end-int64(len(b)))...)
+			}
+			binary.LittleEndian.PutUint32(b[sh+16:], uint32(raw))
+		}
+		if !s.Flags().IsDiscardable() {
+			if s.Characteristics&IMAGE_SCN_CNT_CODE != 0 {
+				code += raw
+			}
+			if s.Characteristics&IMAGE_SCN_CNT_INITIALIZED_DATA != 0 {
+				data += raw
+			}
+			if s.Characteristics&IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+				bss += alignUp(s.virtualSize(), oh.fileAlignment)
+			}
+		}
+		if end := alignUp(int64(s.VirtualAddress)+s.virtualSize(), oh.sectionAlignment); end > imageEnd {
+			imageEnd = end
+		}
+	}
+	if code > 1<<32-1 || data > 1<<32-1 || bss > 1<<32-1 || imageEnd > 1<<32-1 {
+		return errors.New("pe: image too large")
+	}
+
+	ohoff := int64(f.base) + 20
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfCode:], uint32(code))
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfInitializedData:], uint32(data))
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfUninitializedData:], uint32(bss))
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfImage:], uint32(imageEnd))
+	binary.LittleEndian.PutUint32(b[ohoff+ohSizeOfHeaders:], uint32(sizeOfHeaders))
+	f.setChecksum(b)
+	_, err = w.Write(b)
+	return err
+}
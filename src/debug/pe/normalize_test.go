@@ -0,0 +1,80 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec"} {
+		orig, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(orig))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Spoil the fields Normalize computes. The linker set
+		// them, so normalizing must restore the original file.
+		b := append([]byte(nil), orig...)
+		ohoff := int(f.base) + 20
+		for _, off := range []int{ohSizeOfCode, ohSizeOfInitializedData, ohSizeOfUninitializedData, ohSizeOfImage, ohSizeOfHeaders, ohCheckSum} {
+			binary.LittleEndian.PutUint32(b[ohoff+off:], 0x1234)
+		}
+		sh := ohoff + int(f.SizeOfOptionalHeader) + 16
+		binary.LittleEndian.PutUint32(b[sh:], f.Sections[0].Size-0x100)
+		if f, err = NewFile(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := f.Normalize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), orig) {
+			t.Errorf("%s: normalized file differs from the original", file)
+		}
+	}
+}
+
+func TestNormalizePadding(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-386-mingw-no-symbols-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := f.Sections[len(f.Sections)-1]
+	if int64(last.Offset)+int64(last.Size) != int64(len(orig)) {
+		t.Fatalf("last section ends at %#x, not at the end of the file", last.Offset+last.Size)
+	}
+	// Cut the last section short of the file alignment.
+	b := append([]byte(nil), orig[:len(orig)-0x10]...)
+	sh := int(f.base) + 20 + int(f.SizeOfOptionalHeader) + 40*(len(f.Sections)-1)
+	binary.LittleEndian.PutUint32(b[sh+16:], last.Size-0x10)
+	if f, err = NewFile(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.Normalize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != len(orig) || g.Sections[len(g.Sections)-1].Size != last.Size {
+		t.Errorf("normalized file has %#x bytes and last section size %#x, want %#x and %#x", buf.Len(), g.Sections[len(g.Sections)-1].Size, len(orig), last.Size)
+	}
+	if have, want := headerChecksum(t, buf.Bytes()); have != want {
+		t.Errorf("CheckSum = %#x, computed %#x", have, want)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "strconv"
+
+// A NotPEKind classifies the inputs of NewFile
+// that are not PE images or COFF object files.
+type NotPEKind int
+
+const (
+	// NotPEUnrecognized is a file that has neither an MS-DOS
+	// header nor the machine type of a COFF object file.
+	NotPEUnrecognized NotPEKind = iota
+
+	// NotPEMSDOS is an MS-DOS executable without a PE header.
+	NotPEMSDOS
+
+	// NotPELegacy is an MS-DOS executable extended with a
+	// 16-bit NE or a 32-bit LE or LX header rather than a PE
+	// header, as used by Windows 3.x, OS/2 and VxDs.
+	NotPELegacy
+
+	// NotPEArchive is a COFF archive, such as a static or import
+	// library, whose members can be read with NewArchive.
+	NotPEArchive
+)
+
+var notPEKindNames = [...]string{
+	"not a PE or COFF file",
+	"MS-DOS executable without a PE header",
+	"NE, LE or LX executable",
+	"COFF archive",
+}
+
+func (k NotPEKind) String() string {
+	if k >= 0 && int(k) < len(notPEKindNames) {
+		return notPEKindNames[k]
+	}
+	return "NotPEKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A NotPEError is returned by NewFile and Sniff for inputs that are
+// not PE images or COFF object files at all, rather than damaged
+// ones, so that callers handling several formats can hand them to
+// another parser.
+type NotPEError struct {
+	Kind NotPEKind
+
+	// Format is the signature of the header of NotPELegacy
+	// executables: "NE", "LE" or "LX".
+	Format string
+}
+
+func (e *NotPEError) Error() string {
+	if e.Kind == NotPELegacy {
+		return "pe: " + e.Format + " executable; not a PE image"
+	}
+	if e.Kind == NotPEArchive {
+		return "pe: COFF archive; use NewArchive"
+	}
+	return "pe: " + e.Kind.String()
+}
+
+// notPESignature returns the error for an MS-DOS executable whose
+// new header starts with sig instead of the PE signature.
+func notPESignature(sig []byte) *NotPEError {
+	switch s := string(sig[:2]); s {
+	case "NE", "LE", "LX":
+		return &NotPEError{NotPELegacy, s}
+	}
+	return &NotPEError{Kind: NotPEMSDOS}
+}
+
+// knownMachine reports whether machine is the value of one of the
+// IMAGE_FILE_MACHINE constants, and so the likely start of a COFF
+// object file.
+func knownMachine(machine uint16) bool {
+	switch machine {
+	case IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_FILE_MACHINE_AM33, IMAGE_FILE_MACHINE_AMD64,
+		IMAGE_FILE_MACHINE_ARM, IMAGE_FILE_MACHINE_ARMNT, IMAGE_FILE_MACHINE_ARM64,
+		IMAGE_FILE_MACHINE_EBC, IMAGE_FILE_MACHINE_I386, IMAGE_FILE_MACHINE_IA64,
+		IMAGE_FILE_MACHINE_M32R, IMAGE_FILE_MACHINE_MIPS16, IMAGE_FILE_MACHINE_MIPSFPU,
+		IMAGE_FILE_MACHINE_MIPSFPU16, IMAGE_FILE_MACHINE_POWERPC, IMAGE_FILE_MACHINE_POWERPCFP,
+		IMAGE_FILE_MACHINE_R4000, IMAGE_FILE_MACHINE_SH3, IMAGE_FILE_MACHINE_SH3DSP,
+		IMAGE_FILE_MACHINE_SH4, IMAGE_FILE_MACHINE_SH5, IMAGE_FILE_MACHINE_THUMB,
+		IMAGE_FILE_MACHINE_WCEMIPSV2:
+		return true
+	}
+	return false
+}
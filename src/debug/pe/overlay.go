@@ -0,0 +1,68 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"io"
+)
+
+// imageEnd returns the offset just past the last byte of the file
+// that is described by its headers: the headers themselves, the raw
+// data of every section, the COFF symbol and string tables, and the
+// attribute certificate table.
+func (f *File) imageEnd() int64 {
+	var end int64
+	grow := func(off, size int64) {
+		if off+size > end {
+			end = off + size
+		}
+	}
+	oh := f.optionalHeader()
+	if oh != nil {
+		grow(0, int64(oh.sizeOfHeaders))
+	}
+	for _, s := range f.Sections {
+		if s.Offset != 0 {
+			grow(int64(s.Offset), int64(s.Size))
+		}
+	}
+	if f.PointerToSymbolTable != 0 {
+		// The string table, including its 4-byte
+		// length, follows the symbol table.
+		grow(int64(f.PointerToSymbolTable), int64(f.NumberOfSymbols)*f.symbolSize()+4+int64(len(f.StringTable)))
+	}
+	if oh != nil {
+		// The certificate table is not mapped into memory,
+		// so its VirtualAddress is a file offset.
+		dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_SECURITY)
+		if dd.VirtualAddress != 0 {
+			grow(int64(dd.VirtualAddress), int64(dd.Size))
+		}
+	}
+	if f.size >= 0 && end > f.size {
+		end = f.size
+	}
+	return end
+}
+
+// Overlay returns the overlay of f: the data appended to the file
+// after everything its headers describe, that is, after the last
+// section, the COFF symbol and string tables and the certificate
+// table. Installers and self-extracting archives commonly store
+// their payload there. It returns the file offset of the overlay
+// and a reader for it; if there is no overlay, the reader is empty.
+// Overlay fails if the size of the underlying file is not known
+// or if f was created by NewFileFromImage.
+func (f *File) Overlay() (offset int64, r *io.SectionReader, err error) {
+	if f.imageLayout {
+		return 0, nil, errors.New("pe: loaded images have no overlay")
+	}
+	if f.size < 0 {
+		return 0, nil, errors.New("pe: cannot determine overlay: file size unknown")
+	}
+	end := f.imageEnd()
+	return end, io.NewSectionReader(f.r, end, f.size-end), nil
+}
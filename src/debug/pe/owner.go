@@ -0,0 +1,223 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// An OffsetOwner tells what a byte of a file belongs to,
+// as found by OwnerOf.
+type OffsetOwner struct {
+	FileRegion // the region holding the byte
+
+	// Field is the header field or table entry holding the byte,
+	// named as by Diff, such as "OptionalHeader.CheckSum" or
+	// "SectionTable[2].PointerToRawData", or "" if none does.
+	Field string
+
+	// Directory is the data directory, such as
+	// IMAGE_DIRECTORY_ENTRY_IMPORT, whose data holds
+	// the byte, or -1 if none does.
+	Directory int
+
+	// Resource is the resource whose data holds
+	// the byte, or nil if none does.
+	Resource *Resource
+
+	// Certificate is the index of the entry of the attribute
+	// certificate table holding the byte, or -1 if none does.
+	Certificate int
+}
+
+func (o *OffsetOwner) String() string {
+	s := o.Kind.String()
+	if o.Section != nil {
+		s += " " + o.Section.Name
+	}
+	if o.Field != "" {
+		s += " " + o.Field
+	}
+	if o.Directory >= 0 {
+		s += " " + DirectoryName(o.Directory) + " directory"
+	}
+	if r := o.Resource; r != nil {
+		s += fmt.Sprintf(" resource %v/%v/%d", r.Type, r.Name, r.Language)
+	}
+	if o.Certificate >= 0 {
+		s += " certificate " + strconv.Itoa(o.Certificate)
+	}
+	return s
+}
+
+// OwnerOf returns what the byte of the file f at offset off
+// belongs to: the region holding it, as returned by FileRegions,
+// and within that region, the header field, data directory,
+// resource or attribute certificate holding it, for tools that
+// label the offsets at which files differ. What cannot be parsed,
+// as in malformed files, is left out. OwnerOf fails if off is not
+// in the file.
+func (f *File) OwnerOf(off int64) (*OffsetOwner, error) {
+	regions, err := f.FileRegions()
+	if err != nil {
+		return nil, err
+	}
+	o := &OffsetOwner{Directory: -1, Certificate: -1}
+	for _, r := range regions {
+		// Sections may overlap the headers or each other in
+		// malformed files; the last region holding off wins.
+		if r.Offset <= off && off < r.End() {
+			o.FileRegion = r
+		}
+	}
+	if o.Size == 0 {
+		return nil, &FormatError{off, "file offset", ErrOutOfBounds, nil}
+	}
+	switch o.Kind {
+	case RegionHeaders:
+		o.Field = f.headerField(off)
+	case RegionSection:
+		f.ownerInSection(o, uint32(off-o.Offset)+o.Section.VirtualAddress)
+	case RegionSymbols:
+		if n := int64(f.NumberOfSymbols) * f.symbolSize(); off-o.Offset < n {
+			var sym interface{} = COFFSymbol{}
+			if f.BigObjHeader != nil {
+				sym = COFFBigSymbol{}
+			}
+			i := (off - o.Offset) / f.symbolSize()
+			o.Field = fieldAt("COFFSymbols["+strconv.FormatInt(i, 10)+"]", reflect.TypeOf(sym), off-o.Offset-i*f.symbolSize())
+		} else {
+			o.Field = "StringTable"
+		}
+	case RegionCertificates:
+		certs, _ := f.Certificates()
+		var p int64
+		for i, c := range certs {
+			p = alignUp(p+8+int64(len(c.Data)), 8)
+			if off-o.Offset < p {
+				o.Certificate = i
+				break
+			}
+		}
+	}
+	return o, nil
+}
+
+// headerField returns the name of the header field
+// at offset off of the file f, or "" if there is none.
+func (f *File) headerField(off int64) string {
+	l := f.HeaderLayout()
+	in := func(r Region) bool { return r.Offset <= off && off < r.End() }
+	switch {
+	case in(l.DOSHeader):
+		return fieldAt("DOSHeader", reflect.TypeOf(DOSHeader{}), off)
+	case in(l.DOSStub):
+		return "DOSStub"
+	case in(l.Signature):
+		return "Signature"
+	case in(l.FileHeader):
+		off -= l.FileHeader.Offset
+		switch {
+		case f.BigObjHeader != nil:
+			// BigObjHeader leaves out the two signature
+			// fields of ANON_OBJECT_HEADER_BIGOBJ.
+			if off < 4 {
+				return "BigObjHeader"
+			}
+			return fieldAt("BigObjHeader", reflect.TypeOf(BigObjHeader{}), off-4)
+		case f.TEHeader != nil:
+			return fieldAt("TEHeader", reflect.TypeOf(TEHeader{}), off)
+		}
+		return fieldAt("FileHeader", reflect.TypeOf(FileHeader{}), off)
+	case in(l.OptionalHeader):
+		if f.OptionalHeader == nil {
+			return "OptionalHeader"
+		}
+		return fieldAt("OptionalHeader", reflect.TypeOf(f.OptionalHeader).Elem(), off-l.OptionalHeader.Offset)
+	case in(l.SectionTable):
+		i := (off - l.SectionTable.Offset) / 40
+		return fieldAt("SectionTable["+strconv.FormatInt(i, 10)+"]", reflect.TypeOf(SectionHeader32{}), off-l.SectionTable.Offset-i*40)
+	}
+	return ""
+}
+
+// fieldAt returns the name of the field at offset off of a value of
+// type t named name, as encoding/binary lays it out, or name if t has
+// no field there.
+func fieldAt(name string, t reflect.Type, off int64) string {
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			ft := t.Field(i).Type
+			size := int64(binary.Size(reflect.Zero(ft).Interface()))
+			if off < size {
+				return fieldAt(name+"."+t.Field(i).Name, ft, off)
+			}
+			off -= size
+		}
+	case reflect.Array:
+		// Byte arrays such as names are a single field.
+		if t.Elem().Kind() != reflect.Uint8 {
+			size := int64(binary.Size(reflect.Zero(t.Elem()).Interface()))
+			if i := off / size; i < int64(t.Len()) {
+				return fieldAt(name+"["+strconv.FormatInt(i, 10)+"]", t.Elem(), off-i*size)
+			}
+		}
+	}
+	return name
+}
+
+// ownerInSection records in o the data directory
+// and resource holding the byte of f at rva.
+func (f *File) ownerInSection(o *OffsetOwner, rva uint32) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return
+	}
+	for i := 0; i < IMAGE_NUMBEROF_DIRECTORY_ENTRIES; i++ {
+		// The certificate table is not mapped into memory.
+		if i == IMAGE_DIRECTORY_ENTRY_SECURITY {
+			continue
+		}
+		dd := oh.dataDirectory(i)
+		if dd.VirtualAddress <= rva && int64(rva) < int64(dd.VirtualAddress)+int64(dd.Size) {
+			o.Directory = i
+			break
+		}
+	}
+	if dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_RESOURCE); dd.VirtualAddress == 0 || f.sectionForRVA(dd.VirtualAddress) != o.Section {
+		return
+	}
+	d, err := f.Resources()
+	if err != nil {
+		return
+	}
+	for _, t := range d.Entries {
+		if t.Dir == nil {
+			continue
+		}
+		for _, n := range t.Dir.Entries {
+			if n.Dir == nil {
+				continue
+			}
+			for _, l := range n.Dir.Entries {
+				if l.Data == nil || l.Data.RVA > rva || int64(rva) >= int64(l.Data.RVA)+int64(len(l.Data.Data)) {
+					continue
+				}
+				o.Resource = &Resource{
+					Type:     t.ResourceID,
+					Name:     n.ResourceID,
+					Language: l.ID,
+					CodePage: l.Data.CodePage,
+					Data:     l.Data.Data,
+				}
+				return
+			}
+		}
+	}
+}
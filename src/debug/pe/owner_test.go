@@ -0,0 +1,105 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestOwnerOf(t *testing.T) {
+	orig, err := ioutil.ReadFile("testdata/gcc-386-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := []Certificate{
+		{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("signed data")},
+		{WIN_CERT_REVISION_2_0, WIN_CERT_TYPE_PKCS_SIGNED_DATA, []byte("12345678")},
+	}
+	var buf bytes.Buffer
+	if err := f.WriteCertificates(&buf, certs); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("overlay")
+	g, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := g.HeaderLayout()
+	text := g.Section(".text")
+	idata := g.Section(".idata")
+	imp := g.optionalHeader().dataDirectory(IMAGE_DIRECTORY_ENTRY_IMPORT)
+	cert, _ := g.certificateTable()
+	tests := []struct {
+		off  int64
+		want string
+	}{
+		{0, "headers DOSHeader.Magic"},
+		{61, "headers DOSHeader.Lfanew"},
+		{l.DOSStub.Offset + 1, "headers DOSStub"},
+		{l.Signature.Offset, "headers Signature"},
+		{l.FileHeader.Offset + 2, "headers FileHeader.NumberOfSections"},
+		{l.OptionalHeader.Offset + 64, "headers OptionalHeader.CheckSum"},
+		{l.OptionalHeader.Offset + 96 + 2*8 + 4, "headers OptionalHeader.DataDirectory[2].Size"},
+		{l.SectionTable.Offset + 40 + 3, "headers SectionTable[1].Name"},
+		{l.SectionTable.Offset + 40 + 20, "headers SectionTable[1].PointerToRawData"},
+		{l.SectionTable.End(), "headers"},
+		{int64(text.Offset) + 5, "section .text"},
+		{int64(idata.Offset) + int64(imp.VirtualAddress-idata.VirtualAddress) + 4, "section .idata Import directory"},
+		{int64(g.PointerToSymbolTable) + 18 + 9, "symbols COFFSymbols[1].Value"},
+		{int64(cert) + 8, "certificates certificate 0"},
+		{int64(cert) + 8 + 16 + 3, "certificates certificate 1"},
+		{int64(buf.Len()) - 1, "overlay"},
+	}
+	for _, tt := range tests {
+		o, err := g.OwnerOf(tt.off)
+		if err != nil {
+			t.Errorf("OwnerOf(%#x): %v", tt.off, err)
+			continue
+		}
+		if have := o.String(); have != tt.want {
+			t.Errorf("OwnerOf(%#x) = %q, want %q", tt.off, have, tt.want)
+		}
+	}
+	for _, off := range []int64{-1, int64(buf.Len())} {
+		if o, err := g.OwnerOf(off); err == nil {
+			t.Errorf("OwnerOf(%#x) = %v, want an error", off, o)
+		}
+	}
+
+	// The data of resources is attributed to them.
+	d, err := NewResourceDirectory(testResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewResourceSection(d, 0x3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := resourceImage(s)
+	rd, err := img.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range rd.Entries {
+		for _, name := range typ.Dir.Entries {
+			for _, lang := range name.Dir.Entries {
+				if len(lang.Data.Data) == 0 {
+					continue
+				}
+				o := &OffsetOwner{FileRegion: FileRegion{Kind: RegionSection, Section: s}, Directory: -1, Certificate: -1}
+				img.ownerInSection(o, lang.Data.RVA+uint32(len(lang.Data.Data))-1)
+				if r := o.Resource; r == nil || r.Type != typ.ResourceID || r.Name != name.ResourceID || r.Language != lang.ID || o.Directory != IMAGE_DIRECTORY_ENTRY_RESOURCE {
+					t.Errorf("resource %v/%v/%d: owner %v", typ.ResourceID, name.ResourceID, lang.ID, o)
+				}
+			}
+		}
+	}
+}
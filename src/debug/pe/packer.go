@@ -0,0 +1,165 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A PackerIndicatorKind is a kind of PackerIndicator.
+type PackerIndicatorKind int
+
+const (
+	// PackerSectionName marks a section named as
+	// a well-known packer names its sections.
+	PackerSectionName PackerIndicatorKind = iota
+
+	// PackerHighEntropy marks an executable section whose
+	// entropy suggests compressed or encrypted contents.
+	PackerHighEntropy
+
+	// PackerFewImports marks an image importing only the few
+	// functions a stub needs to load the rest itself.
+	PackerFewImports
+
+	// PackerWritableCode marks a section that is both writable
+	// and executable, as needed to unpack code in place.
+	PackerWritableCode
+
+	// PackerEntryInLastSection marks an image whose entry point
+	// is in its last section, where packers append their stubs.
+	PackerEntryInLastSection
+)
+
+var packerIndicatorKindNames = [...]string{
+	"packer section name",
+	"high entropy code",
+	"few imports",
+	"writable code",
+	"entry point in last section",
+}
+
+func (k PackerIndicatorKind) String() string {
+	if k >= 0 && int(k) < len(packerIndicatorKindNames) {
+		return packerIndicatorKindNames[k]
+	}
+	return "PackerIndicatorKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A PackerIndicator is a sign that an image is packed,
+// as found by PackerIndicators.
+type PackerIndicator struct {
+	Kind    PackerIndicatorKind
+	Section string // the section concerned, or "" if none
+	Detail  string // the packer or measure behind the indicator
+}
+
+func (p PackerIndicator) String() string {
+	s := p.Kind.String()
+	if p.Section != "" {
+		s += " " + p.Section
+	}
+	if p.Detail != "" {
+		s += " (" + p.Detail + ")"
+	}
+	return s
+}
+
+// packerSections maps the names of the sections of
+// well-known packers to the names of the packers.
+var packerSections = map[string]string{
+	"UPX0":     "UPX",
+	"UPX1":     "UPX",
+	"UPX2":     "UPX",
+	".aspack":  "ASPack",
+	".adata":   "ASPack",
+	".nsp0":    "NsPack",
+	".nsp1":    "NsPack",
+	".nsp2":    "NsPack",
+	".MPRESS1": "MPRESS",
+	".MPRESS2": "MPRESS",
+	".petite":  "Petite",
+	"pec1":     "PECompact",
+	"pec2":     "PECompact",
+	"PEC2":     "PECompact",
+	".packed":  "RLPack",
+	".RLPack":  "RLPack",
+	".themida": "Themida",
+	".vmp0":    "VMProtect",
+	".vmp1":    "VMProtect",
+	".vmp2":    "VMProtect",
+	".enigma1": "Enigma",
+	".enigma2": "Enigma",
+	"FSG!":     "FSG",
+	"MEW":      "MEW",
+}
+
+// Thresholds of PackerIndicators.
+const (
+	// packerEntropy is the entropy above which the
+	// contents of a section are taken as packed.
+	packerEntropy = 7.2
+
+	// packerImports is the number of imported functions
+	// below which an image is taken as packed.
+	packerImports = 10
+)
+
+// PackerIndicators returns the signs that the image f is packed,
+// that is, that its code is compressed or encrypted and restored by
+// a stub at run time, for triage: sections named as by well-known
+// packers, executable sections with an entropy above 7.2 bits per
+// byte, fewer than 10 imported functions, sections both writable and
+// executable, and an entry point in the last section. None of these
+// proves that f is packed, but the more there are, the likelier it
+// is. PackerIndicators returns no indicators for object files.
+func (f *File) PackerIndicators() ([]PackerIndicator, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	var inds []PackerIndicator
+	for _, s := range f.Sections {
+		if packer, ok := packerSections[s.Name]; ok {
+			inds = append(inds, PackerIndicator{PackerSectionName, s.Name, packer})
+		}
+		exec := s.Characteristics&(IMAGE_SCN_CNT_CODE|IMAGE_SCN_MEM_EXECUTE) != 0
+		if exec && s.Characteristics&IMAGE_SCN_MEM_WRITE != 0 {
+			inds = append(inds, PackerIndicator{PackerWritableCode, s.Name, ""})
+		}
+		if exec && s.Size > 0 {
+			e, err := s.Entropy()
+			if err != nil {
+				return nil, err
+			}
+			if e > packerEntropy {
+				inds = append(inds, PackerIndicator{PackerHighEntropy, s.Name, fmt.Sprintf("entropy %.2f", e)})
+			}
+		}
+	}
+
+	// DLLs holding only resources need neither
+	// imports nor an entry point.
+	if ep := oh.addressOfEntryPoint; ep != 0 {
+		imports, err := f.Imports()
+		if err != nil {
+			return nil, err
+		}
+		if len(imports) < packerImports {
+			inds = append(inds, PackerIndicator{PackerFewImports, "", strconv.Itoa(len(imports)) + " imports"})
+		}
+		var last *Section
+		for _, s := range f.Sections {
+			if last == nil || s.VirtualAddress > last.VirtualAddress {
+				last = s
+			}
+		}
+		if len(f.Sections) > 1 && ep >= last.VirtualAddress && int64(ep-last.VirtualAddress) < last.virtualSize() {
+			inds = append(inds, PackerIndicator{PackerEntryInLastSection, last.Name, ""})
+		}
+	}
+	return inds, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPackerIndicators(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inds, err := f.PackerIndicators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inds) != 0 {
+		t.Errorf("unpacked file has packer indicators %v", inds)
+	}
+
+	// Rename .text as UPX does, make .data writable code and
+	// move the entry point into the last section.
+	ohoff := int(f.base) + 20
+	sectab := ohoff + int(f.SizeOfOptionalHeader)
+	copy(b[sectab:sectab+8], "UPX1\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint32(b[sectab+40+36:], uint32(f.Sections[1].Characteristics|IMAGE_SCN_MEM_EXECUTE))
+	last := f.Sections[len(f.Sections)-1]
+	binary.LittleEndian.PutUint32(b[ohoff+16:], last.VirtualAddress)
+	if f, err = NewFile(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if inds, err = f.PackerIndicators(); err != nil {
+		t.Fatal(err)
+	}
+	want := []PackerIndicator{
+		{PackerSectionName, "UPX1", "UPX"},
+		{PackerWritableCode, ".data", ""},
+		{PackerEntryInLastSection, last.Name, ""},
+	}
+	if !reflect.DeepEqual(inds, want) {
+		t.Errorf("got indicators %v, want %v", inds, want)
+	}
+}
+
+func TestPackerIndicatorsEntropy(t *testing.T) {
+	data := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+	f := &File{
+		OptionalHeader: &OptionalHeader32{SectionAlignment: 0x1000, FileAlignment: 0x200},
+		Sections: []*Section{
+			NewSection(SectionHeader{Name: ".text", VirtualAddress: 0x1000, Characteristics: IMAGE_SCN_CNT_CODE | IMAGE_SCN_MEM_EXECUTE}, data),
+			NewSection(SectionHeader{Name: ".rdata", VirtualAddress: 0x2000, Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA}, data),
+		},
+	}
+	inds, err := f.PackerIndicators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inds) != 1 || inds[0].Kind != PackerHighEntropy || inds[0].Section != ".text" {
+		t.Errorf("got indicators %v, want high entropy .text", inds)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"io"
+	"sync"
+)
+
+// readTablesParallel reads the relocations of the sections of f and,
+// unless it is to be loaded lazily, its symbol table from r, using up
+// to opts.Parallelism goroutines. Errors are then handled in the
+// order a sequential reader would have met them.
+func (f *File) readTablesParallel(r io.ReaderAt, opts *Options) error {
+	// Task 0 loads the symbol table; task i+1 reads
+	// the relocations of section i.
+	tasks := make(chan int, 1+len(f.Sections))
+	if !opts.LazySymbols && !f.symbolsLoaded {
+		tasks <- 0
+	}
+	if !f.imageLayout {
+		for i := range f.Sections {
+			tasks <- i + 1
+		}
+	}
+	close(tasks)
+
+	errs := make([]error, 1+len(f.Sections))
+	doneErrs := make([]error, len(errs))
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Parallelism && w < len(tasks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if doneErrs[i] = opts.checkDone(); doneErrs[i] != nil {
+					continue
+				}
+				if i == 0 {
+					errs[0] = f.LoadSymbols()
+					continue
+				}
+				s := f.Sections[i-1]
+				s.Relocs, errs[i] = readRelocs(&s.SectionHeader, r, f.size)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range doneErrs {
+		if err != nil {
+			return err
+		}
+	}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if err := f.salvage(err); err != nil {
+			return err
+		}
+		if i == 0 {
+			// As in parse, carry on without symbols.
+			f.symbolsLoaded = true
+		}
+	}
+	return nil
+}
@@ -4,6 +4,30 @@
 
 package pe
 
+// DOSHeader is the MS-DOS header (IMAGE_DOS_HEADER)
+// at the start of a PE image.
+type DOSHeader struct {
+	Magic    uint16 // "MZ"
+	Cblp     uint16
+	Cp       uint16
+	Crlc     uint16
+	Cparhdr  uint16
+	Minalloc uint16
+	Maxalloc uint16
+	Ss       uint16
+	Sp       uint16
+	Csum     uint16
+	Ip       uint16
+	Cs       uint16
+	Lfarlc   uint16
+	Ovno     uint16
+	Res      [4]uint16
+	Oemid    uint16
+	Oeminfo  uint16
+	Res2     [10]uint16
+	Lfanew   uint32 // file offset of the PE signature
+}
+
 type FileHeader struct {
 	Machine              uint16
 	NumberOfSections     uint16
@@ -91,6 +115,8 @@ const (
 	IMAGE_FILE_MACHINE_AM33      = 0x1d3
 	IMAGE_FILE_MACHINE_AMD64     = 0x8664
 	IMAGE_FILE_MACHINE_ARM       = 0x1c0
+	IMAGE_FILE_MACHINE_ARMNT     = 0x1c4
+	IMAGE_FILE_MACHINE_ARM64     = 0xaa64
 	IMAGE_FILE_MACHINE_EBC       = 0xebc
 	IMAGE_FILE_MACHINE_I386      = 0x14c
 	IMAGE_FILE_MACHINE_IA64      = 0x200
@@ -108,3 +134,70 @@ const (
 	IMAGE_FILE_MACHINE_THUMB     = 0x1c2
 	IMAGE_FILE_MACHINE_WCEMIPSV2 = 0x169
 )
+
+// Indexes of the data directories of the optional header.
+const (
+	IMAGE_DIRECTORY_ENTRY_EXPORT         = 0
+	IMAGE_DIRECTORY_ENTRY_IMPORT         = 1
+	IMAGE_DIRECTORY_ENTRY_RESOURCE       = 2
+	IMAGE_DIRECTORY_ENTRY_EXCEPTION      = 3
+	IMAGE_DIRECTORY_ENTRY_SECURITY       = 4
+	IMAGE_DIRECTORY_ENTRY_BASERELOC      = 5
+	IMAGE_DIRECTORY_ENTRY_DEBUG          = 6
+	IMAGE_DIRECTORY_ENTRY_ARCHITECTURE   = 7
+	IMAGE_DIRECTORY_ENTRY_GLOBALPTR      = 8
+	IMAGE_DIRECTORY_ENTRY_TLS            = 9
+	IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG    = 10
+	IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT   = 11
+	IMAGE_DIRECTORY_ENTRY_IAT            = 12
+	IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT   = 13
+	IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR = 14
+
+	// IMAGE_NUMBEROF_DIRECTORY_ENTRIES is the number of data
+	// directories in a full optional header. The last one,
+	// after IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR, is reserved.
+	IMAGE_NUMBEROF_DIRECTORY_ENTRIES = 16
+)
+
+// Subsystem values of the optional header.
+const (
+	IMAGE_SUBSYSTEM_UNKNOWN                  = 0
+	IMAGE_SUBSYSTEM_NATIVE                   = 1
+	IMAGE_SUBSYSTEM_WINDOWS_GUI              = 2
+	IMAGE_SUBSYSTEM_WINDOWS_CUI              = 3
+	IMAGE_SUBSYSTEM_OS2_CUI                  = 5
+	IMAGE_SUBSYSTEM_POSIX_CUI                = 7
+	IMAGE_SUBSYSTEM_NATIVE_WINDOWS           = 8
+	IMAGE_SUBSYSTEM_WINDOWS_CE_GUI           = 9
+	IMAGE_SUBSYSTEM_EFI_APPLICATION          = 10
+	IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER  = 11
+	IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER       = 12
+	IMAGE_SUBSYSTEM_EFI_ROM                  = 13
+	IMAGE_SUBSYSTEM_XBOX                     = 14
+	IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION = 16
+)
+
+// Section characteristics. See SectionCharacteristics.
+const (
+	IMAGE_SCN_TYPE_NO_PAD            = 0x00000008
+	IMAGE_SCN_CNT_CODE               = 0x00000020
+	IMAGE_SCN_CNT_INITIALIZED_DATA   = 0x00000040
+	IMAGE_SCN_CNT_UNINITIALIZED_DATA = 0x00000080
+	IMAGE_SCN_LNK_OTHER              = 0x00000100
+	IMAGE_SCN_LNK_INFO               = 0x00000200
+	IMAGE_SCN_LNK_REMOVE             = 0x00000800
+	IMAGE_SCN_LNK_COMDAT             = 0x00001000
+	IMAGE_SCN_GPREL                  = 0x00008000
+	IMAGE_SCN_MEM_PURGEABLE          = 0x00020000
+	IMAGE_SCN_MEM_LOCKED             = 0x00040000
+	IMAGE_SCN_MEM_PRELOAD            = 0x00080000
+	IMAGE_SCN_ALIGN_MASK             = 0x00f00000 // alignment in object files
+	IMAGE_SCN_LNK_NRELOC_OVFL        = 0x01000000
+	IMAGE_SCN_MEM_DISCARDABLE        = 0x02000000
+	IMAGE_SCN_MEM_NOT_CACHED         = 0x04000000
+	IMAGE_SCN_MEM_NOT_PAGED          = 0x08000000
+	IMAGE_SCN_MEM_SHARED             = 0x10000000
+	IMAGE_SCN_MEM_EXECUTE            = 0x20000000
+	IMAGE_SCN_MEM_READ               = 0x40000000
+	IMAGE_SCN_MEM_WRITE              = 0x80000000
+)
@@ -0,0 +1,153 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// A RegionKind is what a FileRegion holds.
+type RegionKind int
+
+const (
+	// RegionHeaders holds the headers: the DOS header and stub,
+	// the PE headers and the section table, padded to
+	// SizeOfHeaders in images.
+	RegionHeaders RegionKind = iota
+
+	// RegionSection holds the raw data of a section.
+	RegionSection
+
+	// RegionRelocations holds the COFF relocations of a section.
+	RegionRelocations
+
+	// RegionLineNumbers holds the COFF line numbers of a section.
+	RegionLineNumbers
+
+	// RegionSymbols holds the COFF symbol and string tables.
+	RegionSymbols
+
+	// RegionCertificates holds the attribute certificate table.
+	RegionCertificates
+
+	// RegionOverlay holds the overlay, as returned by Overlay.
+	RegionOverlay
+
+	// RegionGap holds bytes before the overlay that no
+	// header accounts for, such as padding between sections.
+	RegionGap
+)
+
+var regionKindNames = [...]string{
+	"headers",
+	"section",
+	"relocations",
+	"line numbers",
+	"symbols",
+	"certificates",
+	"overlay",
+	"gap",
+}
+
+func (k RegionKind) String() string {
+	if k >= 0 && int(k) < len(regionKindNames) {
+		return regionKindNames[k]
+	}
+	return "RegionKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A FileRegion is a range of bytes of a file and what it holds.
+type FileRegion struct {
+	Region
+	Kind    RegionKind
+	Section *Section // the section concerned, or nil if none
+}
+
+// FileRegions accounts for the bytes of the file f: it returns the
+// regions holding the headers, the raw data, relocations and line
+// numbers of each section, the symbol and string tables, the
+// certificate table and the overlay, with the gaps between them,
+// in order of offset. Regions are cut off at the end of the file.
+// In well-formed files they do not overlap and cover the whole
+// file, so that summing their sizes by kind tells where its size
+// goes. FileRegions fails if the size of the file is not known or
+// if f was created by NewFileFromImage.
+func (f *File) FileRegions() ([]FileRegion, error) {
+	if f.imageLayout {
+		return nil, errors.New("pe: loaded images have no file layout")
+	}
+	if f.size < 0 {
+		return nil, errors.New("pe: cannot account for file: file size unknown")
+	}
+	var regions []FileRegion
+	add := func(kind RegionKind, s *Section, off, size int64) {
+		if off+size > f.size {
+			size = f.size - off
+		}
+		if off >= 0 && size > 0 {
+			regions = append(regions, FileRegion{Region{off, size}, kind, s})
+		}
+	}
+	oh := f.optionalHeader()
+	if oh != nil {
+		add(RegionHeaders, nil, 0, int64(oh.sizeOfHeaders))
+	} else {
+		add(RegionHeaders, nil, 0, f.HeaderLayout().SectionTable.End())
+	}
+	for _, s := range f.Sections {
+		if s.Offset != 0 {
+			add(RegionSection, s, int64(s.Offset), int64(s.Size))
+		}
+		if s.PointerToRelocations != 0 && s.NumberOfRelocations != 0 {
+			n := int64(s.NumberOfRelocations)
+			if s.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL != 0 && n == 0xffff {
+				// The first relocation holds the count.
+				n = int64(len(s.Relocs)) + 1
+			}
+			add(RegionRelocations, s, int64(s.PointerToRelocations), n*relocSize)
+		}
+		if s.PointerToLineNumbers != 0 {
+			add(RegionLineNumbers, s, int64(s.PointerToLineNumbers), int64(s.NumberOfLineNumbers)*6)
+		}
+	}
+	if f.PointerToSymbolTable != 0 {
+		add(RegionSymbols, nil, int64(f.PointerToSymbolTable), int64(f.NumberOfSymbols)*f.symbolSize()+4+int64(len(f.StringTable)))
+	}
+	if oh != nil {
+		if dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_SECURITY); dd.VirtualAddress != 0 {
+			add(RegionCertificates, nil, int64(dd.VirtualAddress), int64(dd.Size))
+		}
+	}
+	sort.Stable(regionOrder(regions))
+
+	// Fill the gaps up to the overlay, then add the overlay.
+	end := f.imageEnd()
+	var gaps []FileRegion
+	var covered int64
+	for _, r := range regions {
+		if r.Offset > covered {
+			gaps = append(gaps, FileRegion{Region{covered, r.Offset - covered}, RegionGap, nil})
+		}
+		if r.End() > covered {
+			covered = r.End()
+		}
+	}
+	if covered < end {
+		gaps = append(gaps, FileRegion{Region{covered, end - covered}, RegionGap, nil})
+	}
+	add(RegionOverlay, nil, end, f.size-end)
+	regions = append(regions, gaps...)
+	sort.Stable(regionOrder(regions))
+	return regions, nil
+}
+
+// regionOrder sorts file regions by offset.
+type regionOrder []FileRegion
+
+func (r regionOrder) Len() int           { return len(r) }
+func (r regionOrder) Less(i, j int) bool { return r[i].Offset < r[j].Offset }
+func (r regionOrder) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,347 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RelocateOptions describes where the sections and symbols
+// of an object file are loaded, for File.Relocate.
+type RelocateOptions struct {
+	// Address is the address at which the section
+	// being relocated is loaded.
+	Address uint64
+
+	// ImageBase is the address that image-relative
+	// relocations (ADDR32NB) are relative to.
+	ImageBase uint64
+
+	// SymbolAddress returns the address of symbol i, where i is
+	// an index into File.COFFSymbols, as used by relocations.
+	SymbolAddress func(i uint32) (uint64, error)
+}
+
+// Relocate applies the relocations of section s of the object
+// file f to data, which holds the contents of s, as a linker would,
+// so that the code and data can run at the addresses given by opts.
+// It supports the relocations of AMD64, I386 and ARM64 objects
+// that are needed to load code into memory. Relocations are
+// applied in place, with the addend stored in data.
+//
+// Section-relative relocations (SECREL) use the symbol's value,
+// which for symbols defined in the object is its offset in its
+// section, and section index relocations (SECTION) its section
+// number.
+func (f *File) Relocate(s *Section, data []byte, opts *RelocateOptions) error {
+	if err := f.ensureSymbols(); err != nil {
+		return err
+	}
+	var apply func(c *relocContext) error
+	switch f.Machine {
+	case IMAGE_FILE_MACHINE_AMD64:
+		apply = relocateAMD64
+	case IMAGE_FILE_MACHINE_I386:
+		apply = relocate386
+	case IMAGE_FILE_MACHINE_ARM64:
+		apply = relocateARM64
+	default:
+		return fmt.Errorf("pe: relocations of machine %#x are not supported", f.Machine)
+	}
+	for i := range s.Relocs {
+		r := &s.Relocs[i]
+		if r.SymbolTableIndex >= uint32(len(f.COFFSymbols)) {
+			return &FormatError{-1, s.Name + " section relocations", ErrOutOfBounds, r.SymbolTableIndex}
+		}
+		off := int64(r.VirtualAddress) - int64(s.VirtualAddress)
+		if off < 0 || off > int64(len(data)) {
+			return &FormatError{-1, s.Name + " section relocations", ErrOutOfBounds, r.VirtualAddress}
+		}
+		c := &relocContext{
+			Reloc: r,
+			b:     data[off:],
+			p:     opts.Address + uint64(off),
+			sym:   &f.COFFSymbols[r.SymbolTableIndex],
+			opts:  opts,
+		}
+		if err := apply(c); err != nil {
+			return fmt.Errorf("pe: %s relocation %d of section %s: %v", RelocTypeString(f.Machine, r.Type), i, s.Name, err)
+		}
+	}
+	return nil
+}
+
+var (
+	errRelocTruncated   = errors.New("relocated data runs past the end of the section")
+	errRelocOverflow    = errors.New("relocated value out of range")
+	errRelocUnsupported = errors.New("unsupported relocation type")
+)
+
+// relocContext holds what is needed to apply a single relocation.
+type relocContext struct {
+	*Reloc
+	b    []byte // the section data, from the relocated location on
+	p    uint64 // the address of the relocated location
+	sym  *COFFSymbol
+	opts *RelocateOptions
+}
+
+// s returns the address of the target symbol.
+func (c *relocContext) s() (uint64, error) {
+	if c.opts.SymbolAddress == nil {
+		return 0, errors.New("no symbol addresses")
+	}
+	return c.opts.SymbolAddress(c.SymbolTableIndex)
+}
+
+// add16, add32 and add64 add v to the
+// 16, 32 or 64-bit value at the location.
+func (c *relocContext) add16(v uint64) error {
+	if len(c.b) < 2 {
+		return errRelocTruncated
+	}
+	binary.LittleEndian.PutUint16(c.b, binary.LittleEndian.Uint16(c.b)+uint16(v))
+	return nil
+}
+
+func (c *relocContext) add32(v uint64) error {
+	if len(c.b) < 4 {
+		return errRelocTruncated
+	}
+	binary.LittleEndian.PutUint32(c.b, binary.LittleEndian.Uint32(c.b)+uint32(v))
+	return nil
+}
+
+func (c *relocContext) add64(v uint64) error {
+	if len(c.b) < 8 {
+		return errRelocTruncated
+	}
+	binary.LittleEndian.PutUint64(c.b, binary.LittleEndian.Uint64(c.b)+v)
+	return nil
+}
+
+// abs32 adds the address of the target symbol, less base,
+// to the 32-bit value at the location, which must not overflow.
+func (c *relocContext) abs32(base uint64) error {
+	s, err := c.s()
+	if err != nil {
+		return err
+	}
+	if len(c.b) < 4 {
+		return errRelocTruncated
+	}
+	v := s - base + uint64(binary.LittleEndian.Uint32(c.b))
+	if s < base || v > 1<<32-1 {
+		return errRelocOverflow
+	}
+	binary.LittleEndian.PutUint32(c.b, uint32(v))
+	return nil
+}
+
+// rel32 stores the distance from the address end to the target
+// symbol, plus the addend at the location, as a signed 32-bit value.
+func (c *relocContext) rel32(end uint64) error {
+	s, err := c.s()
+	if err != nil {
+		return err
+	}
+	if len(c.b) < 4 {
+		return errRelocTruncated
+	}
+	v := int64(s-end) + int64(int32(binary.LittleEndian.Uint32(c.b)))
+	if v != int64(int32(v)) {
+		return errRelocOverflow
+	}
+	binary.LittleEndian.PutUint32(c.b, uint32(v))
+	return nil
+}
+
+// abs64 adds the address of the target symbol
+// to the 64-bit value at the location.
+func (c *relocContext) abs64() error {
+	s, err := c.s()
+	if err != nil {
+		return err
+	}
+	return c.add64(s)
+}
+
+// section and secrel apply SECTION and SECREL relocations.
+func (c *relocContext) section() error {
+	return c.add16(uint64(uint16(c.sym.SectionNumber)))
+}
+
+func (c *relocContext) secrel() error {
+	return c.add32(uint64(c.sym.Value))
+}
+
+func relocateAMD64(c *relocContext) error {
+	switch c.Type {
+	case IMAGE_REL_AMD64_ABSOLUTE:
+		return nil
+	case IMAGE_REL_AMD64_ADDR64:
+		return c.abs64()
+	case IMAGE_REL_AMD64_ADDR32:
+		return c.abs32(0)
+	case IMAGE_REL_AMD64_ADDR32NB:
+		return c.abs32(c.opts.ImageBase)
+	case IMAGE_REL_AMD64_REL32, IMAGE_REL_AMD64_REL32_1, IMAGE_REL_AMD64_REL32_2,
+		IMAGE_REL_AMD64_REL32_3, IMAGE_REL_AMD64_REL32_4, IMAGE_REL_AMD64_REL32_5:
+		return c.rel32(c.p + 4 + uint64(c.Type-IMAGE_REL_AMD64_REL32))
+	case IMAGE_REL_AMD64_SECTION:
+		return c.section()
+	case IMAGE_REL_AMD64_SECREL:
+		return c.secrel()
+	}
+	return errRelocUnsupported
+}
+
+func relocate386(c *relocContext) error {
+	switch c.Type {
+	case IMAGE_REL_I386_ABSOLUTE:
+		return nil
+	case IMAGE_REL_I386_DIR32:
+		return c.abs32(0)
+	case IMAGE_REL_I386_DIR32NB:
+		return c.abs32(c.opts.ImageBase)
+	case IMAGE_REL_I386_SECTION:
+		return c.section()
+	case IMAGE_REL_I386_SECREL:
+		return c.secrel()
+	case IMAGE_REL_I386_REL32:
+		return c.rel32(c.p + 4)
+	}
+	return errRelocUnsupported
+}
+
+func relocateARM64(c *relocContext) error {
+	switch c.Type {
+	case IMAGE_REL_ARM64_ABSOLUTE:
+		return nil
+	case IMAGE_REL_ARM64_ADDR32:
+		return c.abs32(0)
+	case IMAGE_REL_ARM64_ADDR32NB:
+		return c.abs32(c.opts.ImageBase)
+	case IMAGE_REL_ARM64_BRANCH26:
+		return c.branch(0, 26)
+	case IMAGE_REL_ARM64_PAGEBASE_REL21:
+		return c.adr(12)
+	case IMAGE_REL_ARM64_REL21:
+		return c.adr(0)
+	case IMAGE_REL_ARM64_PAGEOFFSET_12A:
+		s, err := c.s()
+		if err != nil {
+			return err
+		}
+		return c.imm12(s&0xfff, false)
+	case IMAGE_REL_ARM64_PAGEOFFSET_12L:
+		s, err := c.s()
+		if err != nil {
+			return err
+		}
+		return c.imm12(s&0xfff, true)
+	case IMAGE_REL_ARM64_SECREL:
+		return c.secrel()
+	case IMAGE_REL_ARM64_SECREL_LOW12A:
+		return c.imm12(uint64(c.sym.Value)&0xfff, false)
+	case IMAGE_REL_ARM64_SECREL_HIGH12A:
+		return c.imm12(uint64(c.sym.Value)>>12&0xfff, false)
+	case IMAGE_REL_ARM64_SECREL_LOW12L:
+		return c.imm12(uint64(c.sym.Value)&0xfff, true)
+	case IMAGE_REL_ARM64_SECTION:
+		return c.section()
+	case IMAGE_REL_ARM64_ADDR64:
+		return c.abs64()
+	case IMAGE_REL_ARM64_BRANCH19:
+		return c.branch(5, 19)
+	case IMAGE_REL_ARM64_BRANCH14:
+		return c.branch(5, 14)
+	case IMAGE_REL_ARM64_REL32:
+		return c.rel32(c.p + 4)
+	}
+	return errRelocUnsupported
+}
+
+// insn returns the ARM64 instruction at the location.
+func (c *relocContext) insn() (uint32, error) {
+	if len(c.b) < 4 {
+		return 0, errRelocTruncated
+	}
+	return binary.LittleEndian.Uint32(c.b), nil
+}
+
+// signExtend sign-extends the low bits bits of v.
+func signExtend(v uint64, bits uint) int64 {
+	return int64(v<<(64-bits)) >> (64 - bits)
+}
+
+// branch patches a branch instruction whose word offset
+// to the target is stored in bits bits starting at bit shift.
+func (c *relocContext) branch(shift, bits uint) error {
+	s, err := c.s()
+	if err != nil {
+		return err
+	}
+	ins, err := c.insn()
+	if err != nil {
+		return err
+	}
+	mask := uint32(1)<<bits - 1
+	v := int64(s-c.p) + signExtend(uint64(ins>>shift&mask), bits)<<2
+	if v&3 != 0 || v>>2 != signExtend(uint64(v>>2), bits) {
+		return errRelocOverflow
+	}
+	ins = ins&^(mask<<shift) | uint32(v>>2)&mask<<shift
+	binary.LittleEndian.PutUint32(c.b, ins)
+	return nil
+}
+
+// adr patches an ADR (shift 0) or ADRP (shift 12) instruction.
+// Like other linkers, it takes the immediate already in the
+// instruction as a byte addend to the target address.
+func (c *relocContext) adr(shift uint) error {
+	s, err := c.s()
+	if err != nil {
+		return err
+	}
+	ins, err := c.insn()
+	if err != nil {
+		return err
+	}
+	imm := signExtend(uint64(ins>>29&3|ins>>3&0x1ffffc), 21)
+	s += uint64(imm)
+	v := int64(s>>shift) - int64(c.p>>shift)
+	if v != signExtend(uint64(v), 21) {
+		return errRelocOverflow
+	}
+	ins = ins&^(3<<29|0x7ffff<<5) | uint32(v&3)<<29 | uint32(v>>2&0x7ffff)<<5
+	binary.LittleEndian.PutUint32(c.b, ins)
+	return nil
+}
+
+// imm12 adds v to the 12-bit immediate of an ADD instruction or,
+// if scaled is set, to the scaled offset of a load or store.
+func (c *relocContext) imm12(v uint64, scaled bool) error {
+	ins, err := c.insn()
+	if err != nil {
+		return err
+	}
+	if scaled {
+		size := uint(ins >> 30)
+		if ins&0x4800000 == 0x4800000 {
+			size += 4 // 128-bit SIMD and FP registers
+		}
+		if v&(1<<size-1) != 0 {
+			return errors.New("misaligned load or store offset")
+		}
+		v >>= size
+	}
+	v += uint64(ins >> 10 & 0xfff)
+	ins = ins&^(0xfff<<10) | uint32(v&0xfff)<<10
+	binary.LittleEndian.PutUint32(c.b, ins)
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestRelocateAMD64(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	const (
+		base    = 0x140000000
+		text    = base + 0x1000
+		symBase = base + 0x8000
+	)
+	opts := &RelocateOptions{
+		Address:   text,
+		ImageBase: base,
+		SymbolAddress: func(i uint32) (uint64, error) {
+			return symBase + 0x100*uint64(i), nil
+		},
+	}
+
+	s := f.Section(".text")
+	orig, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte(nil), orig...)
+	if err := f.Relocate(s, data, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range s.Relocs {
+		if r.Type != IMAGE_REL_AMD64_REL32 {
+			t.Fatalf("unexpected relocation type %#x", r.Type)
+		}
+		addend := int64(int32(binary.LittleEndian.Uint32(orig[r.VirtualAddress:])))
+		want := int64(symBase+0x100*uint64(r.SymbolTableIndex)) - int64(text+uint64(r.VirtualAddress)+4) + addend
+		if got := int64(int32(binary.LittleEndian.Uint32(data[r.VirtualAddress:]))); got != want {
+			t.Errorf("relocation at %#x: got %#x, want %#x", r.VirtualAddress, got, want)
+		}
+	}
+
+	s = f.Section(".pdata")
+	if orig, err = s.Data(); err != nil {
+		t.Fatal(err)
+	}
+	data = append([]byte(nil), orig...)
+	if err := f.Relocate(s, data, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range s.Relocs {
+		addend := uint64(binary.LittleEndian.Uint32(orig[r.VirtualAddress:]))
+		want := symBase + 0x100*uint64(r.SymbolTableIndex) - base + addend
+		if got := uint64(binary.LittleEndian.Uint32(data[r.VirtualAddress:])); got != want {
+			t.Errorf("relocation at %#x: got %#x, want %#x", r.VirtualAddress, got, want)
+		}
+	}
+
+	opts.Address = text - 1<<32
+	if err := f.Relocate(f.Section(".text"), append([]byte(nil), orig...), opts); err == nil {
+		t.Errorf("out of range relocation succeeded")
+	}
+}
+
+func TestRelocateARM64(t *testing.T) {
+	insns := []uint32{
+		0x94000000, // bl sym
+		0x90000000, // adrp x0, sym
+		0x91000000, // add x0, x0, :lo12:sym
+		0xf9400001, // ldr x1, [x0, :lo12:sym]
+		0x54000000, // b.eq sym
+	}
+	data := make([]byte, 4*len(insns))
+	for i, ins := range insns {
+		binary.LittleEndian.PutUint32(data[4*i:], ins)
+	}
+	f := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_ARM64}}
+	s := NewSection(SectionHeader{Name: ".text"}, data)
+	s.Relocs = []Reloc{
+		{0, 0, IMAGE_REL_ARM64_BRANCH26},
+		{4, 0, IMAGE_REL_ARM64_PAGEBASE_REL21},
+		{8, 0, IMAGE_REL_ARM64_PAGEOFFSET_12A},
+		{12, 0, IMAGE_REL_ARM64_PAGEOFFSET_12L},
+		{16, 0, IMAGE_REL_ARM64_BRANCH19},
+	}
+	f.Sections = []*Section{s}
+	f.COFFSymbols = []COFFSymbol{{Name: [8]byte{'s', 'y', 'm'}, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}}
+	const (
+		text = 0x10000
+		sym  = 0x23458
+	)
+	opts := &RelocateOptions{
+		Address:       text,
+		SymbolAddress: func(uint32) (uint64, error) { return sym, nil },
+	}
+	if err := f.Relocate(s, data, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := []uint32{
+		0x94000000 | (sym-text)>>2,
+		0x90000000 | (sym>>12-text>>12)&3<<29 | (sym>>12-text>>12)>>2<<5,
+		0x91000000 | (sym&0xfff)<<10,
+		0xf9400001 | (sym&0xfff)>>3<<10,
+		0x54000000 | (sym-text-16)>>2<<5,
+	}
+	for i, w := range want {
+		if got := binary.LittleEndian.Uint32(data[4*i:]); got != w {
+			t.Errorf("instruction %d = %#08x, want %#08x", i, got, w)
+		}
+	}
+
+	// b.eq reaches only 1MB.
+	s.Relocs = s.Relocs[4:]
+	opts.SymbolAddress = func(uint32) (uint64, error) { return text + 2<<20, nil }
+	binary.LittleEndian.PutUint32(data[16:], 0x54000000)
+	if err := f.Relocate(s, data, opts); err == nil {
+		t.Errorf("out of range branch succeeded")
+	}
+}
+
+func TestRelocTypeString(t *testing.T) {
+	tests := []struct {
+		machine, typ uint16
+		want         string
+	}{
+		{IMAGE_FILE_MACHINE_AMD64, IMAGE_REL_AMD64_REL32, "IMAGE_REL_AMD64_REL32"},
+		{IMAGE_FILE_MACHINE_I386, IMAGE_REL_I386_REL32, "IMAGE_REL_I386_REL32"},
+		{IMAGE_FILE_MACHINE_ARMNT, IMAGE_REL_THUMB_BRANCH24, "IMAGE_REL_THUMB_BRANCH24"},
+		{IMAGE_FILE_MACHINE_ARM64, IMAGE_REL_ARM64_PAGEBASE_REL21, "IMAGE_REL_ARM64_PAGEBASE_REL21"},
+		{IMAGE_FILE_MACHINE_I386, 0x3, "0x3"},
+		{IMAGE_FILE_MACHINE_UNKNOWN, IMAGE_REL_AMD64_ADDR64, "0x1"},
+	}
+	for _, tt := range tests {
+		if got := RelocTypeString(tt.machine, tt.typ); got != tt.want {
+			t.Errorf("RelocTypeString(%#x, %#x) = %s, want %s", tt.machine, tt.typ, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"unicode/utf16"
+)
+
+// ReadRes reads the resources of a compiled resource (.res) file,
+// as written by rc, llvm-rc and windres. The empty resource that
+// starts .res files is dropped.
+func ReadRes(r io.Reader) ([]Resource, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var res []Resource
+	for off := 0; off < len(b); {
+		if len(b)-off < 8 {
+			return nil, &FormatError{int64(off), "resource header", ErrTruncated, nil}
+		}
+		dataSize := binary.LittleEndian.Uint32(b[off:])
+		hdrSize := binary.LittleEndian.Uint32(b[off+4:])
+		if hdrSize < 8 || uint64(hdrSize)+uint64(dataSize) > uint64(len(b)-off) {
+			return nil, &FormatError{int64(off), "resource header", ErrOutOfBounds, hdrSize}
+		}
+		h := b[off+8 : off+int(hdrSize)]
+		var rs Resource
+		var n, m int
+		if rs.Type, n, err = readSzOrOrd(h); err == nil {
+			rs.Name, m, err = readSzOrOrd(h[n:])
+		}
+		p := align4(8+n+m) - 8
+		if err != nil || p+16 > len(h) {
+			return nil, &FormatError{int64(off), "resource header", ErrTruncated, nil}
+		}
+		rs.DataVersion = binary.LittleEndian.Uint32(h[p:])
+		rs.MemoryFlags = binary.LittleEndian.Uint16(h[p+4:])
+		rs.Language = binary.LittleEndian.Uint16(h[p+6:])
+		rs.Version = binary.LittleEndian.Uint32(h[p+8:])
+		rs.Characteristics = binary.LittleEndian.Uint32(h[p+12:])
+		start := off + int(hdrSize)
+		end := start + int(dataSize)
+		rs.Data = b[start:end:end]
+		off = align4(end)
+		if rs.Type == (ResourceID{}) && dataSize == 0 {
+			continue
+		}
+		res = append(res, rs)
+	}
+	return res, nil
+}
+
+// readSzOrOrd reads the resource type or name at the start of b,
+// stored either as 0xffff followed by an integer ID or as a
+// NUL-terminated UTF-16 string, and returns it with its size.
+func readSzOrOrd(b []byte) (ResourceID, int, error) {
+	if len(b) >= 2 && binary.LittleEndian.Uint16(b) == 0xffff {
+		if len(b) < 4 {
+			return ResourceID{}, 0, ErrTruncated
+		}
+		return ResourceID{ID: binary.LittleEndian.Uint16(b[2:])}, 4, nil
+	}
+	for i := 0; i+2 <= len(b); i += 2 {
+		if binary.LittleEndian.Uint16(b[i:]) == 0 {
+			return ResourceID{Name: decodeUTF16(b[:i])}, i + 2, nil
+		}
+	}
+	return ResourceID{}, 0, ErrTruncated
+}
+
+// align4 rounds n up to a multiple of 4, the alignment
+// of the headers and data of .res files.
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// WriteRes writes res to w in the compiled resource (.res) format,
+// starting with the empty resource that marks the format.
+func WriteRes(w io.Writer, res []Resource) error {
+	var hdr [32]byte
+	binary.LittleEndian.PutUint32(hdr[4:], 32)
+	binary.LittleEndian.PutUint32(hdr[8:], 0xffff)
+	binary.LittleEndian.PutUint32(hdr[12:], 0xffff)
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	for _, rs := range res {
+		if uint64(len(rs.Data)) > 1<<32-1 {
+			return errors.New("pe: resource " + rs.Type.String() + "/" + rs.Name.String() + " too large")
+		}
+		b := make([]byte, 8, 64)
+		b = appendSzOrOrd(b, rs.Type)
+		b = appendSzOrOrd(b, rs.Name)
+		b = append(b, make([]byte, align4(len(b))-len(b)+16)...)
+		p := len(b) - 16
+		binary.LittleEndian.PutUint32(b[0:], uint32(len(rs.Data)))
+		binary.LittleEndian.PutUint32(b[4:], uint32(len(b)))
+		binary.LittleEndian.PutUint32(b[p:], rs.DataVersion)
+		binary.LittleEndian.PutUint16(b[p+4:], rs.MemoryFlags)
+		binary.LittleEndian.PutUint16(b[p+6:], rs.Language)
+		binary.LittleEndian.PutUint32(b[p+8:], rs.Version)
+		binary.LittleEndian.PutUint32(b[p+12:], rs.Characteristics)
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if _, err := w.Write(rs.Data); err != nil {
+			return err
+		}
+		if pad := align4(len(rs.Data)) - len(rs.Data); pad > 0 {
+			if _, err := w.Write(make([]byte, pad)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendSzOrOrd appends id to b in the form read by readSzOrOrd.
+func appendSzOrOrd(b []byte, id ResourceID) []byte {
+	if id.Name == "" {
+		return append(b, 0xff, 0xff, byte(id.ID), byte(id.ID>>8))
+	}
+	for _, u := range utf16.Encode([]rune(id.Name)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return append(b, 0, 0)
+}
@@ -0,0 +1,401 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Predefined resource types.
+const (
+	RT_CURSOR       = 1
+	RT_BITMAP       = 2
+	RT_ICON         = 3
+	RT_MENU         = 4
+	RT_DIALOG       = 5
+	RT_STRING       = 6
+	RT_FONTDIR      = 7
+	RT_FONT         = 8
+	RT_ACCELERATOR  = 9
+	RT_RCDATA       = 10
+	RT_MESSAGETABLE = 11
+	RT_GROUP_CURSOR = 12
+	RT_GROUP_ICON   = 14
+	RT_VERSION      = 16
+	RT_DLGINCLUDE   = 17
+	RT_PLUGPLAY     = 19
+	RT_VXD          = 20
+	RT_ANICURSOR    = 21
+	RT_ANIICON      = 22
+	RT_HTML         = 23
+	RT_MANIFEST     = 24
+)
+
+// A ResourceID identifies a resource type, name or language:
+// by Name if it is not empty, and by the integer ID otherwise.
+type ResourceID struct {
+	Name string
+	ID   uint16
+}
+
+func (id ResourceID) String() string {
+	if id.Name != "" {
+		return id.Name
+	}
+	return "#" + strconv.Itoa(int(id.ID))
+}
+
+// less reports whether id sorts before other in a resource
+// directory, where named entries come first, by name, followed
+// by the entries with an integer ID, by ID.
+func (id ResourceID) less(other ResourceID) bool {
+	switch {
+	case id.Name != "" && other.Name != "":
+		return id.Name < other.Name
+	case id.Name != "" || other.Name != "":
+		return id.Name != ""
+	}
+	return id.ID < other.ID
+}
+
+// A ResourceDirectory is a directory of the resource tree of an
+// image (IMAGE_RESOURCE_DIRECTORY) with its entries. The tree has
+// three levels, keyed by resource type, name and language, and
+// the data of the resources at its leaves.
+type ResourceDirectory struct {
+	Characteristics uint32
+	TimeDateStamp   uint32
+	MajorVersion    uint16
+	MinorVersion    uint16
+	Entries         []ResourceEntry
+}
+
+// A ResourceEntry is an entry of a ResourceDirectory, which
+// leads either to a subdirectory or to the data of a resource.
+type ResourceEntry struct {
+	ResourceID
+	Dir  *ResourceDirectory // nil for data entries
+	Data *ResourceData      // nil for subdirectories
+}
+
+// ResourceData is a resource data entry
+// (IMAGE_RESOURCE_DATA_ENTRY) with the data it describes.
+type ResourceData struct {
+	RVA      uint32 // address of Data in the image; zero if not read from one
+	CodePage uint32
+	Data     []byte
+}
+
+// A Resource is a resource in flat form, as stored in .res files:
+// its data together with its type, name and language.
+type Resource struct {
+	Type     ResourceID
+	Name     ResourceID
+	Language uint16
+	CodePage uint32
+	Data     []byte
+
+	// MemoryFlags, DataVersion, Version and Characteristics are
+	// fields of .res resource headers that have no place in the
+	// resource tree of an image. They are zero for resources
+	// taken from a ResourceDirectory.
+	MemoryFlags     uint16
+	DataVersion     uint32
+	Version         uint32
+	Characteristics uint32
+}
+
+// Default limits on the resource trees read by File.Resources;
+// see Options.MaxResourceDepth and Options.MaxResourceEntries.
+const (
+	defaultMaxResourceDepth   = 32
+	defaultMaxResourceEntries = 1 << 16
+)
+
+// A ResourceLimitError reports that a resource tree exceeds one of
+// the limits set by Options.MaxResourceDepth and
+// Options.MaxResourceEntries.
+type ResourceLimitError struct {
+	Limit string // "depth" or "entries"
+	Max   int    // the value of the limit
+}
+
+func (e *ResourceLimitError) Error() string {
+	return "pe: resource tree exceeds the " + e.Limit + " limit of " + strconv.Itoa(e.Max)
+}
+
+// ErrResourceCycle is found in the Err field of the FormatError
+// returned by File.Resources for a resource directory that is its
+// own ancestor in the tree.
+var ErrResourceCycle = errors.New("resource directory contains itself")
+
+// Resources returns the resource tree of f,
+// or nil if f has no resource directory.
+// The data of the resources may share memory
+// and must not be modified.
+//
+// A directory that contains itself, directly or through its
+// subdirectories, is an error. Directories shared by several
+// entries are read once per entry, within the limits of the
+// Options f was opened with.
+func (f *File) Resources() (*ResourceDirectory, error) {
+	oh := f.optionalHeader()
+	if oh == nil {
+		return nil, nil
+	}
+	dd := oh.dataDirectory(IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if dd.VirtualAddress == 0 {
+		return nil, nil
+	}
+	b, err := f.resourceBytes(dd.VirtualAddress, dd.Size)
+	if err != nil {
+		return nil, err
+	}
+	r := &resourceReader{
+		f:          f,
+		b:          b,
+		maxDepth:   f.maxResourceDepth,
+		maxEntries: f.maxResourceEntries,
+		path:       make(map[uint32]bool),
+		sections:   make(map[*Section][]byte),
+	}
+	if r.maxDepth <= 0 {
+		r.maxDepth = defaultMaxResourceDepth
+	}
+	if r.maxEntries <= 0 {
+		r.maxEntries = defaultMaxResourceEntries
+	}
+	return r.dir(0)
+}
+
+// resourceBytes returns the size bytes of f at the relative virtual
+// address rva, which must lie within a single section.
+func (f *File) resourceBytes(rva, size uint32) ([]byte, error) {
+	s := f.sectionForRVA(rva)
+	if s == nil || int64(rva)+int64(size) > int64(s.VirtualAddress)+s.virtualSize() {
+		return nil, &FormatError{-1, fmt.Sprintf("resource data at RVA %#x", rva), ErrOutOfBounds, size}
+	}
+	b := make([]byte, size)
+	if err := f.readRVA(b, rva); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// A resourceReader reads a resource tree. Directory and name
+// offsets are relative to the start of the tree, in b; data
+// entries give the RVA of their data, which is sliced from the
+// contents of its section when possible. path holds the offsets
+// of the directories being read, from the root down, to detect
+// cycles.
+type resourceReader struct {
+	f          *File
+	b          []byte
+	maxDepth   int
+	maxEntries int
+	entries    int
+	path       map[uint32]bool
+	sections   map[*Section][]byte
+}
+
+func (r *resourceReader) dir(off uint32) (*ResourceDirectory, error) {
+	if uint64(off)+16 > uint64(len(r.b)) {
+		return nil, &FormatError{-1, "resource directory", ErrOutOfBounds, off}
+	}
+	if r.path[off] {
+		return nil, &FormatError{-1, "resource directory", ErrResourceCycle, off}
+	}
+	if len(r.path) >= r.maxDepth {
+		return nil, &ResourceLimitError{"depth", r.maxDepth}
+	}
+	r.path[off] = true
+	defer delete(r.path, off)
+	b := r.b[off:]
+	d := &ResourceDirectory{
+		Characteristics: binary.LittleEndian.Uint32(b[0:4]),
+		TimeDateStamp:   binary.LittleEndian.Uint32(b[4:8]),
+		MajorVersion:    binary.LittleEndian.Uint16(b[8:10]),
+		MinorVersion:    binary.LittleEndian.Uint16(b[10:12]),
+	}
+	n := int(binary.LittleEndian.Uint16(b[12:14])) + int(binary.LittleEndian.Uint16(b[14:16]))
+	r.entries += n
+	if r.entries > r.maxEntries {
+		return nil, &ResourceLimitError{"entries", r.maxEntries}
+	}
+	if 16+8*n > len(b) {
+		return nil, &FormatError{-1, "resource directory", ErrOutOfBounds, off}
+	}
+	d.Entries = make([]ResourceEntry, n)
+	for i := range d.Entries {
+		e := &d.Entries[i]
+		name := binary.LittleEndian.Uint32(b[16+8*i:])
+		target := binary.LittleEndian.Uint32(b[20+8*i:])
+		var err error
+		if name&(1<<31) != 0 {
+			e.Name, err = r.name(name &^ (1 << 31))
+		} else if name > 0xffff {
+			err = &FormatError{-1, "resource directory entry", errors.New("ID out of range"), name}
+		} else {
+			e.ID = uint16(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if target&(1<<31) != 0 {
+			e.Dir, err = r.dir(target &^ (1 << 31))
+		} else {
+			e.Data, err = r.data(target)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// name returns the name (IMAGE_RESOURCE_DIR_STRING_U) at off.
+func (r *resourceReader) name(off uint32) (string, error) {
+	if uint64(off)+2 > uint64(len(r.b)) {
+		return "", &FormatError{-1, "resource name", ErrOutOfBounds, off}
+	}
+	n := int(binary.LittleEndian.Uint16(r.b[off:]))
+	b := r.b[off+2:]
+	if 2*n > len(b) {
+		return "", &FormatError{-1, "resource name", ErrOutOfBounds, off}
+	}
+	return decodeUTF16(b[:2*n]), nil
+}
+
+// data returns the resource data entry at off and its data.
+func (r *resourceReader) data(off uint32) (*ResourceData, error) {
+	if uint64(off)+16 > uint64(len(r.b)) {
+		return nil, &FormatError{-1, "resource data entry", ErrOutOfBounds, off}
+	}
+	b := r.b[off:]
+	d := &ResourceData{
+		RVA:      binary.LittleEndian.Uint32(b[0:4]),
+		CodePage: binary.LittleEndian.Uint32(b[8:12]),
+	}
+	size := binary.LittleEndian.Uint32(b[4:8])
+	if s := r.f.sectionForRVA(d.RVA); s != nil {
+		sd, ok := r.sections[s]
+		if !ok {
+			var err error
+			if sd, err = s.Data(); err != nil {
+				sd = nil
+			}
+			r.sections[s] = sd
+		}
+		start := int64(d.RVA - s.VirtualAddress)
+		if end := start + int64(size); end <= int64(len(sd)) {
+			d.Data = sd[start:end:end]
+			return d, nil
+		}
+	}
+	// The data runs past the raw data of its section or
+	// the section could not be read: read it on its own.
+	var err error
+	d.Data, err = r.f.resourceBytes(d.RVA, size)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// decodeUTF16 decodes the little-endian UTF-16 text b.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// Resources returns the resources of the tree d in flat form, in
+// tree order. It fails if d does not have the three levels of type,
+// name and language directories, or if languages are named.
+func (d *ResourceDirectory) Resources() ([]Resource, error) {
+	var res []Resource
+	for _, t := range d.Entries {
+		if t.Dir == nil {
+			return nil, fmt.Errorf("pe: resource type %v is not a directory", t.ResourceID)
+		}
+		for _, n := range t.Dir.Entries {
+			if n.Dir == nil {
+				return nil, fmt.Errorf("pe: resource %v/%v is not a directory", t.ResourceID, n.ResourceID)
+			}
+			for _, l := range n.Dir.Entries {
+				if l.Data == nil || l.Name != "" {
+					return nil, fmt.Errorf("pe: resource %v/%v/%v is not a language entry", t.ResourceID, n.ResourceID, l.ResourceID)
+				}
+				res = append(res, Resource{
+					Type:     t.ResourceID,
+					Name:     n.ResourceID,
+					Language: l.ID,
+					CodePage: l.Data.CodePage,
+					Data:     l.Data.Data,
+				})
+			}
+		}
+	}
+	return res, nil
+}
+
+// NewResourceDirectory returns the resource tree holding res, with
+// the entries of each directory sorted as the loader requires:
+// named entries first, in order of name, then the others in order
+// of ID. It fails if two resources have the same type, name and
+// language.
+func NewResourceDirectory(res []Resource) (*ResourceDirectory, error) {
+	root := new(ResourceDirectory)
+	for _, r := range res {
+		t := root.subdir(r.Type)
+		n := t.subdir(r.Name)
+		lang := ResourceID{ID: r.Language}
+		if i := n.find(lang); i < len(n.Entries) && n.Entries[i].ResourceID == lang {
+			return nil, fmt.Errorf("pe: duplicate resource %v/%v/%v", r.Type, r.Name, lang)
+		}
+		n.insert(ResourceEntry{
+			ResourceID: lang,
+			Data:       &ResourceData{CodePage: r.CodePage, Data: r.Data},
+		})
+	}
+	return root, nil
+}
+
+// find returns the index of the entry with the given ID in d,
+// or the index at which to insert it if there is none.
+func (d *ResourceDirectory) find(id ResourceID) int {
+	return sort.Search(len(d.Entries), func(i int) bool { return !d.Entries[i].less(id) })
+}
+
+// insert inserts e in the sorted entries of d.
+func (d *ResourceDirectory) insert(e ResourceEntry) {
+	i := d.find(e.ResourceID)
+	d.Entries = append(d.Entries, ResourceEntry{})
+	copy(d.Entries[i+1:], d.Entries[i:])
+	d.Entries[i] = e
+}
+
+// subdir returns the subdirectory of d with the given ID,
+// adding it if needed.
+func (d *ResourceDirectory) subdir(id ResourceID) *ResourceDirectory {
+	if i := d.find(id); i < len(d.Entries) && d.Entries[i].ResourceID == id {
+		if d.Entries[i].Dir == nil {
+			// A data entry where a directory belongs,
+			// in a tree read from a malformed file.
+			d.Entries[i] = ResourceEntry{ResourceID: id, Dir: new(ResourceDirectory)}
+		}
+		return d.Entries[i].Dir
+	}
+	sub := new(ResourceDirectory)
+	d.insert(ResourceEntry{ResourceID: id, Dir: sub})
+	return sub
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testResources = []Resource{
+	{Type: ResourceID{ID: RT_MANIFEST}, Name: ResourceID{ID: 1}, Language: 0x409, Data: []byte("<assembly/>"), MemoryFlags: 0x1030},
+	{Type: ResourceID{Name: "MYTYPE"}, Name: ResourceID{ID: 1}, Language: 0x409, Data: []byte("abc")},
+	{Type: ResourceID{Name: "MYTYPE"}, Name: ResourceID{Name: "ÉTÉ"}, Language: 0x40c, Data: []byte{}, Version: 2, Characteristics: 3},
+	{Type: ResourceID{ID: RT_RCDATA}, Name: ResourceID{ID: 7}, Language: 0, Data: []byte("data"), DataVersion: 1},
+}
+
+func TestResRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteRes(&buf, testResources); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()%4 != 0 {
+		t.Errorf(".res size %d is not a multiple of 4", buf.Len())
+	}
+	res, err := ReadRes(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, testResources) {
+		t.Errorf("ReadRes(WriteRes(res)) = %+v, want %+v", res, testResources)
+	}
+}
+
+func TestReadRes(t *testing.T) {
+	// MYTYPE 1 { "abc" }, with LANGUAGE 9, 1,
+	// as laid out by resource compilers.
+	const golden = "" +
+		"00000000" + "20000000" + "ffff0000" + "ffff0000" + // empty resource
+		"00000000" + "0000" + "0000" + "00000000" + "00000000" +
+		"03000000" + "2c000000" + // DataSize, HeaderSize
+		"4d00590054005900500045000000" + "ffff0100" + "0000" + // type, name, padding
+		"00000000" + "0000" + "0904" + "00000000" + "00000000" +
+		"61626300" // data and padding
+	b, _ := hex.DecodeString(golden)
+	res, err := ReadRes(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Resource{testResources[1]}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("ReadRes = %+v, want %+v", res, want)
+	}
+	var buf bytes.Buffer
+	if err := WriteRes(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("WriteRes = %x, want %x", buf.Bytes(), b)
+	}
+	// The final padding may be missing.
+	for n := 1; n < len(b)-1; n++ {
+		if n == 32 {
+			continue // just the empty resource
+		}
+		if _, err := ReadRes(bytes.NewReader(b[:n])); err == nil {
+			t.Errorf("ReadRes of %d bytes succeeded", n)
+		}
+	}
+}
+
+func TestNewResourceDirectory(t *testing.T) {
+	d, err := NewResourceDirectory(testResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, e := range d.Entries {
+		types = append(types, e.ResourceID.String())
+	}
+	if s := strings.Join(types, " "); s != "MYTYPE #10 #24" {
+		t.Errorf("types = %s, want MYTYPE #10 #24", s)
+	}
+	res, err := d.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// In tree order, without the .res header fields.
+	var want []Resource
+	for _, i := range []int{2, 1, 3, 0} {
+		r := testResources[i]
+		want = append(want, Resource{Type: r.Type, Name: r.Name, Language: r.Language, Data: r.Data})
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("Resources = %+v, want %+v", res, want)
+	}
+	if _, err := NewResourceDirectory(append(testResources, testResources[0])); err == nil {
+		t.Error("NewResourceDirectory accepted a duplicate resource")
+	}
+}
+
+func TestNoResources(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := f.Resources()
+	if d != nil || err != nil {
+		t.Errorf("Resources = %v, %v, want nil, nil", d, err)
+	}
+}
+
+// makeResourceChain returns an image whose resource tree is a chain
+// of n directories of one entry each, the last of which leads to an
+// empty resource or, if cycle is set, back to the root.
+func makeResourceChain(n int, cycle bool) []byte {
+	b := make([]byte, 24*n+16)
+	for i := 0; i < n; i++ {
+		d := b[24*i:]
+		binary.LittleEndian.PutUint16(d[14:], 1) // NumberOfIdEntries
+		binary.LittleEndian.PutUint32(d[16:], 1)
+		next := uint32(24*(i+1)) | 1<<31
+		if i == n-1 {
+			next = uint32(24 * n) // the data entry
+			if cycle {
+				next = 1 << 31
+			}
+		}
+		binary.LittleEndian.PutUint32(d[20:], next)
+	}
+	binary.LittleEndian.PutUint32(b[24*n:], testSectionRVA)
+	return makeTestImage(b, map[int]DataDirectory{
+		IMAGE_DIRECTORY_ENTRY_RESOURCE: {testSectionRVA, uint32(len(b))},
+	})
+}
+
+func TestResourceLimits(t *testing.T) {
+	tests := []struct {
+		n     int
+		cycle bool
+		opts  *Options
+		err   error
+	}{
+		{3, false, nil, nil},
+		{40, false, nil, &ResourceLimitError{"depth", 32}},
+		{40, false, &Options{MaxResourceDepth: 40}, nil},
+		{3, false, &Options{MaxResourceDepth: 2}, &ResourceLimitError{"depth", 2}},
+		{3, false, &Options{MaxResourceEntries: 2}, &ResourceLimitError{"entries", 2}},
+		{1, true, nil, &FormatError{-1, "resource directory", ErrResourceCycle, uint32(0)}},
+		{5, true, &Options{MaxResourceDepth: 1000}, &FormatError{-1, "resource directory", ErrResourceCycle, uint32(0)}},
+	}
+	for _, tt := range tests {
+		f, err := NewFileWithOptions(bytes.NewReader(makeResourceChain(tt.n, tt.cycle)), tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := f.Resources()
+		if !reflect.DeepEqual(err, tt.err) {
+			t.Errorf("%d directories, cycle %v, %+v: Resources error = %v, want %v", tt.n, tt.cycle, tt.opts, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for i := 0; i < tt.n; i++ {
+			if len(d.Entries) != 1 {
+				t.Fatalf("%d directories: directory %d has %d entries", tt.n, i, len(d.Entries))
+			}
+			if i == tt.n-1 {
+				if d.Entries[0].Data == nil {
+					t.Errorf("%d directories: no data at the end of the chain", tt.n)
+				}
+				break
+			}
+			d = d.Entries[0].Dir
+		}
+	}
+}
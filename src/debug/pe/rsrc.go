@@ -0,0 +1,265 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Set adds r to the resource tree d, replacing the resource with
+// the same type, name and language if there is one. The header
+// fields of .res files in r are not kept.
+func (d *ResourceDirectory) Set(r *Resource) {
+	n := d.subdir(r.Type).subdir(r.Name)
+	e := ResourceEntry{
+		ResourceID: ResourceID{ID: r.Language},
+		Data:       &ResourceData{CodePage: r.CodePage, Data: r.Data},
+	}
+	if i := n.find(e.ResourceID); i < len(n.Entries) && n.Entries[i].ResourceID == e.ResourceID {
+		n.Entries[i] = e
+		return
+	}
+	n.insert(e)
+}
+
+// Delete removes the resource with the given type, name and
+// language from the tree d, along with the directories it leaves
+// empty. It reports whether d held the resource.
+func (d *ResourceDirectory) Delete(typ, name ResourceID, lang uint16) bool {
+	ids := [...]ResourceID{typ, name, {ID: lang}}
+	var path [len(ids)]*ResourceDirectory
+	var index [len(ids)]int
+	dir := d
+	for level, id := range ids {
+		if dir == nil {
+			return false
+		}
+		i := dir.find(id)
+		if i == len(dir.Entries) || dir.Entries[i].ResourceID != id {
+			return false
+		}
+		path[level], index[level] = dir, i
+		dir = dir.Entries[i].Dir
+	}
+	if path[2].Entries[index[2]].Data == nil {
+		return false
+	}
+	for level := len(ids) - 1; level >= 0; level-- {
+		p, i := path[level], index[level]
+		p.Entries = append(p.Entries[:i], p.Entries[i+1:]...)
+		if len(p.Entries) > 0 || level == 0 {
+			break
+		}
+	}
+	return true
+}
+
+// rsrcLayout records where encode puts the parts of a resource tree.
+type rsrcLayout struct {
+	dirs    map[*ResourceDirectory]uint32
+	names   map[string]uint32
+	entries map[*ResourceData]uint32
+	data    map[*ResourceData]uint32
+}
+
+// encode lays out the tree d as the contents of a .rsrc section at
+// the relative virtual address rva, in the order of the PE
+// specification: the directory tables, breadth first, then the
+// directory strings, the data entries and the resource data, each
+// resource aligned to 8 bytes. It also returns the offsets of the
+// RVA fields of the data entries, which object files relocate.
+func (d *ResourceDirectory) encode(rva uint32) ([]byte, []uint32, error) {
+	l := &rsrcLayout{
+		dirs:    make(map[*ResourceDirectory]uint32),
+		names:   make(map[string]uint32),
+		entries: make(map[*ResourceData]uint32),
+		data:    make(map[*ResourceData]uint32),
+	}
+	var off, nentries int64
+	var names []string
+	var datas []*ResourceData
+	queue := []*ResourceDirectory{d}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		if _, ok := l.dirs[dir]; ok {
+			return nil, nil, errors.New("pe: resource directory appears twice in the tree")
+		}
+		nentries += int64(len(dir.Entries))
+		if nentries > defaultMaxResourceEntries {
+			return nil, nil, errors.New("pe: too many resource directory entries")
+		}
+		l.dirs[dir] = uint32(off)
+		off += 16 + 8*int64(len(dir.Entries))
+		for i := range dir.Entries {
+			e := &dir.Entries[i]
+			if e.Name != "" {
+				if _, ok := l.names[e.Name]; !ok {
+					l.names[e.Name] = 0
+					names = append(names, e.Name)
+				}
+			}
+			switch {
+			case e.Dir != nil && e.Data == nil:
+				queue = append(queue, e.Dir)
+			case e.Data != nil && e.Dir == nil:
+				if _, ok := l.entries[e.Data]; !ok {
+					l.entries[e.Data] = 0
+					datas = append(datas, e.Data)
+				}
+			default:
+				return nil, nil, fmt.Errorf("pe: resource entry %v must have either a directory or data", e.ResourceID)
+			}
+		}
+	}
+	for _, name := range names {
+		l.names[name] = uint32(off)
+		off += 2 + 2*int64(len(utf16.Encode([]rune(name))))
+	}
+	// Offsets of directories and names have the high bit free.
+	if off >= 1<<31 {
+		return nil, nil, errors.New("pe: resource directory too large")
+	}
+	off = alignUp(off, 4)
+	for _, rd := range datas {
+		l.entries[rd] = uint32(off)
+		off += 16
+	}
+	for _, rd := range datas {
+		off = alignUp(off, 8)
+		l.data[rd] = uint32(off)
+		off += int64(len(rd.Data))
+	}
+	if int64(rva)+off > 1<<32-1 {
+		return nil, nil, errors.New("pe: resource section too large")
+	}
+
+	b := make([]byte, off)
+	var relocs []uint32
+	for dir, doff := range l.dirs {
+		p := b[doff:]
+		binary.LittleEndian.PutUint32(p[0:], dir.Characteristics)
+		binary.LittleEndian.PutUint32(p[4:], dir.TimeDateStamp)
+		binary.LittleEndian.PutUint16(p[8:], dir.MajorVersion)
+		binary.LittleEndian.PutUint16(p[10:], dir.MinorVersion)
+		var named uint16
+		for _, e := range dir.Entries {
+			if e.Name != "" {
+				named++
+			}
+		}
+		binary.LittleEndian.PutUint16(p[12:], named)
+		binary.LittleEndian.PutUint16(p[14:], uint16(len(dir.Entries))-named)
+		for i, e := range dir.Entries {
+			q := p[16+8*i:]
+			if e.Name != "" {
+				binary.LittleEndian.PutUint32(q[0:], 1<<31|l.names[e.Name])
+			} else {
+				binary.LittleEndian.PutUint32(q[0:], uint32(e.ID))
+			}
+			if e.Dir != nil {
+				binary.LittleEndian.PutUint32(q[4:], 1<<31|l.dirs[e.Dir])
+			} else {
+				binary.LittleEndian.PutUint32(q[4:], l.entries[e.Data])
+			}
+		}
+	}
+	for name, noff := range l.names {
+		u := utf16.Encode([]rune(name))
+		binary.LittleEndian.PutUint16(b[noff:], uint16(len(u)))
+		for i, c := range u {
+			binary.LittleEndian.PutUint16(b[noff+2+2*uint32(i):], c)
+		}
+	}
+	for _, rd := range datas {
+		p := b[l.entries[rd]:]
+		binary.LittleEndian.PutUint32(p[0:], rva+l.data[rd])
+		binary.LittleEndian.PutUint32(p[4:], uint32(len(rd.Data)))
+		binary.LittleEndian.PutUint32(p[8:], rd.CodePage)
+		copy(b[l.data[rd]:], rd.Data)
+		relocs = append(relocs, l.entries[rd])
+	}
+	return b, relocs, nil
+}
+
+// NewResourceSection returns a .rsrc section holding the resource
+// tree d, for an image in which the section is at the relative
+// virtual address rva. The data entries of the tree hold the RVAs
+// of the resources in the section. The VirtualSize and Size of the
+// section are the size of its contents, which the caller may need
+// to align.
+func NewResourceSection(d *ResourceDirectory, rva uint32) (*Section, error) {
+	b, _, err := d.encode(rva)
+	if err != nil {
+		return nil, err
+	}
+	return NewSection(SectionHeader{
+		Name:            ".rsrc",
+		VirtualSize:     uint32(len(b)),
+		VirtualAddress:  rva,
+		Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ,
+	}, b), nil
+}
+
+// AddResources adds the resource tree d to the object file f as a
+// .rsrc section, as cvtres does with .res files, so that linking f
+// puts the resources in the image. This lets build tools turn
+// resources into a .syso file for the Go linker, or into an object
+// for any other linker. The RVAs of the data entries are relocated
+// against a new static symbol for the section.
+func (f *File) AddResources(d *ResourceDirectory) error {
+	if f.OptionalHeader != nil || f.imageLayout {
+		return errors.New("pe: AddResources called on an image file")
+	}
+	var typ uint16
+	switch f.Machine {
+	case IMAGE_FILE_MACHINE_AMD64:
+		typ = IMAGE_REL_AMD64_ADDR32NB
+	case IMAGE_FILE_MACHINE_I386:
+		typ = IMAGE_REL_I386_DIR32NB
+	case IMAGE_FILE_MACHINE_ARM64:
+		typ = IMAGE_REL_ARM64_ADDR32NB
+	case IMAGE_FILE_MACHINE_ARM, IMAGE_FILE_MACHINE_ARMNT:
+		typ = IMAGE_REL_ARM_ADDR32NB
+	default:
+		return fmt.Errorf("pe: resources for machine %#x are not supported", f.Machine)
+	}
+	if len(f.Sections) >= maxCOFFSections {
+		return errors.New("pe: too many sections")
+	}
+	b, offs, err := d.encode(0)
+	if err != nil {
+		return err
+	}
+	s := NewSection(SectionHeader{
+		Name:            ".rsrc",
+		Characteristics: IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ,
+	}, b)
+	n := len(f.Sections) + 1
+
+	// The section symbol and its section definition record.
+	var aux [COFFSymbolSize]byte
+	binary.LittleEndian.PutUint32(aux[0:], uint32(len(b)))
+	binary.LittleEndian.PutUint16(aux[4:], uint16(len(offs)))
+	if len(offs) > 0xffff {
+		binary.LittleEndian.PutUint16(aux[4:], 0xffff)
+	}
+	var auxSym COFFSymbol
+	decodeCOFFSymbol(aux[:], &auxSym)
+	ssym := &Symbol{Name: ".rsrc", StorageClass: IMAGE_SYM_CLASS_STATIC}
+	ssym.setSectionNumber(int32(n))
+	sym, err := f.AddSymbol(ssym, []COFFSymbol{auxSym})
+	if err != nil {
+		return err
+	}
+	for _, off := range offs {
+		s.Relocs = append(s.Relocs, Reloc{VirtualAddress: off, SymbolTableIndex: uint32(sym), Type: typ})
+	}
+	f.Sections = append(f.Sections, s)
+	return nil
+}
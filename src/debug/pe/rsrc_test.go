@@ -0,0 +1,158 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// resourceImage returns an image holding only
+// the resource section s.
+func resourceImage(s *Section) *File {
+	oh := &OptionalHeader64{Magic: 0x20b, NumberOfRvaAndSizes: 16}
+	oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_RESOURCE] = DataDirectory{s.VirtualAddress, s.Size}
+	return &File{
+		FileHeader:     FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64, NumberOfSections: 1},
+		OptionalHeader: oh,
+		Sections:       []*Section{s},
+	}
+}
+
+// flatResources returns testResources in tree
+// order, without their .res header fields.
+func flatResources() []Resource {
+	var res []Resource
+	for _, i := range []int{2, 1, 3, 0} {
+		r := testResources[i]
+		res = append(res, Resource{Type: r.Type, Name: r.Name, Language: r.Language, Data: r.Data})
+	}
+	return res
+}
+
+func TestResourceSection(t *testing.T) {
+	d, err := NewResourceDirectory(testResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rva = 0x3000
+	s, err := NewResourceSection(d, rva)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := resourceImage(s)
+	rd, err := f.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rd.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := flatResources(); !reflect.DeepEqual(res, want) {
+		t.Errorf("resources = %+v, want %+v", res, want)
+	}
+	for _, r := range rd.Entries[0].Dir.Entries[0].Dir.Entries {
+		if r.Data.RVA%8 != 0 || r.Data.RVA < rva || r.Data.RVA >= rva+s.Size {
+			t.Errorf("resource data at RVA %#x", r.Data.RVA)
+		}
+	}
+
+	// Encoding the tree read back gives the same section.
+	s2, err := NewResourceSection(rd, rva)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := s.Data()
+	b2, _ := s2.Data()
+	if !bytes.Equal(b, b2) {
+		t.Error("re-encoded resource section differs")
+	}
+}
+
+func TestResourceEdit(t *testing.T) {
+	d, err := NewResourceDirectory(testResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := Resource{Type: ResourceID{ID: RT_MANIFEST}, Name: ResourceID{ID: 1}, Language: 0x409, Data: []byte("<assembly version='2'/>")}
+	icon := Resource{Type: ResourceID{ID: RT_ICON}, Name: ResourceID{ID: 1}, Language: 0x409, Data: []byte{0, 0, 1, 0}}
+	d.Set(&manifest)
+	d.Set(&icon)
+	if d.Delete(ResourceID{ID: RT_RCDATA}, ResourceID{ID: 7}, 1) {
+		t.Error("Delete of a missing language succeeded")
+	}
+	if !d.Delete(ResourceID{ID: RT_RCDATA}, ResourceID{ID: 7}, 0) {
+		t.Error("Delete of RCDATA #7 failed")
+	}
+	res, err := d.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := flatResources()
+	want = []Resource{want[0], want[1], icon, manifest}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("resources = %+v, want %+v", res, want)
+	}
+	// The RCDATA type directory went with its last resource.
+	for _, e := range d.Entries {
+		if e.ID == RT_RCDATA {
+			t.Error("empty RCDATA directory left behind")
+		}
+	}
+}
+
+func TestAddResources(t *testing.T) {
+	d, err := NewResourceDirectory(testResources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64}}
+	if err := obj.AddResources(d); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := obj.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.Section(".rsrc")
+	if s == nil {
+		t.Fatal("no .rsrc section")
+	}
+	if len(s.Relocs) != len(testResources) {
+		t.Errorf("%d relocations, want %d", len(s.Relocs), len(testResources))
+	}
+	// Link the section at RVA 0x5000.
+	const base, rva = 0x140000000, 0x5000
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Relocate(s, data, &RelocateOptions{
+		Address:       base + rva,
+		ImageBase:     base,
+		SymbolAddress: func(uint32) (uint64, error) { return base + rva, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := resourceImage(NewSection(SectionHeader{Name: ".rsrc", VirtualAddress: rva}, data))
+	rd, err := img.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := rd.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := flatResources(); !reflect.DeepEqual(res, want) {
+		t.Errorf("resources = %+v, want %+v", res, want)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// sectionForRVA returns the section containing the relative
+// virtual address rva, or nil if no section contains it.
+func (f *File) sectionForRVA(rva uint32) *Section {
+	for _, s := range f.Sections {
+		if int64(rva) >= int64(s.VirtualAddress) && int64(rva) < int64(s.VirtualAddress)+s.virtualSize() {
+			return s
+		}
+	}
+	return nil
+}
+
+// readRVA reads len(p) bytes of f, as laid out in memory,
+// starting at the relative virtual address rva.
+func (f *File) readRVA(p []byte, rva uint32) error {
+	if s := f.sectionForRVA(rva); s != nil {
+		n, err := s.VirtualReader().ReadAt(p, int64(rva-s.VirtualAddress))
+		if n == len(p) {
+			return nil
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &FormatError{-1, fmt.Sprintf("data at RVA %#x", rva), err, nil}
+	}
+	// The headers are mapped at the start of the image,
+	// at the same offset as in the file.
+	if oh := f.optionalHeader(); oh != nil && int64(rva)+int64(len(p)) <= int64(oh.sizeOfHeaders) {
+		if _, err := f.r.ReadAt(p, int64(rva)); err != nil {
+			return formatError(int64(rva), "headers", err)
+		}
+		return nil
+	}
+	return &FormatError{-1, "RVA", ErrOutOfBounds, rva}
+}
+
+// fileOffset returns the offset in the file of the n bytes
+// of f at the relative virtual address rva, which must lie
+// in the raw data of a section.
+func (f *File) fileOffset(rva, n uint32) (int64, error) {
+	s := f.sectionForRVA(rva)
+	if s == nil || s.Offset == 0 || int64(rva-s.VirtualAddress)+int64(n) > int64(s.Size) {
+		return 0, &FormatError{-1, fmt.Sprintf("file data at RVA %#x", rva), ErrOutOfBounds, n}
+	}
+	return int64(s.Offset) + int64(rva-s.VirtualAddress), nil
+}
+
+// addRVA returns rva+off. It fails rather than wrap around past
+// 4 GiB, where the sum would alias the start of the image.
+func addRVA(rva uint32, off uint64) (uint32, error) {
+	if uint64(rva)+off > 1<<32-1 {
+		return 0, &FormatError{-1, "RVA", ErrOutOfBounds, uint64(rva) + off}
+	}
+	return rva + uint32(off), nil
+}
+
+// maxStringSize is the longest NUL-terminated string
+// readStringRVA will read.
+const maxStringSize = 64 << 10
+
+// readStringRVA reads the NUL-terminated string
+// at the relative virtual address rva.
+func (f *File) readStringRVA(rva uint32) (string, error) {
+	var b []byte
+	var chunk [64]byte
+	for len(b) < maxStringSize {
+		p := chunk[:]
+		// Don't read past the end of the containing section.
+		if s := f.sectionForRVA(rva); s != nil {
+			if left := int64(s.VirtualAddress) + s.virtualSize() - int64(rva); left < int64(len(p)) {
+				p = p[:left]
+			}
+		}
+		if err := f.readRVA(p, rva); err != nil {
+			return "", err
+		}
+		for i, c := range p {
+			if c == 0 {
+				return string(append(b, p[:i]...)), nil
+			}
+		}
+		b = append(b, p...)
+		var err error
+		if rva, err = addRVA(rva, uint64(len(p))); err != nil {
+			return "", err
+		}
+	}
+	return "", &FormatError{-1, "string", ErrOutOfBounds, rva}
+}
+
+// readMapped reads len(p) bytes of the image f starting at the
+// relative virtual address rva, as the loader maps it: the headers
+// at RVA 0, each section at its RVA, zero-filled past its raw data,
+// and zeros in between, up to SizeOfImage. It follows the contract
+// of io.ReaderAt.
+func (f *File) readMapped(p []byte, rva int64) (int, error) {
+	limit := int64(1) << 32
+	var headers int64
+	if oh := f.optionalHeader(); oh != nil {
+		limit = int64(oh.sizeOfImage)
+		headers = int64(oh.sizeOfHeaders)
+	}
+	n := 0
+	for n < len(p) {
+		off := rva + int64(n)
+		if off < 0 || off >= limit {
+			return n, io.EOF
+		}
+		chunk := p[n:]
+		if int64(len(chunk)) > limit-off {
+			chunk = chunk[:limit-off]
+		}
+		if s := f.sectionForRVA(uint32(off)); s != nil {
+			if end := int64(s.VirtualAddress) + s.virtualSize(); int64(len(chunk)) > end-off {
+				chunk = chunk[:end-off]
+			}
+			m, err := s.VirtualReader().ReadAt(chunk, off-int64(s.VirtualAddress))
+			n += m
+			if m < len(chunk) {
+				return n, formatError(-1, fmt.Sprintf("data at RVA %#x", off+int64(m)), err)
+			}
+			continue
+		}
+		// Outside the sections, read up to the next one.
+		next := limit
+		for _, s := range f.Sections {
+			if va := int64(s.VirtualAddress); va > off && va < next {
+				next = va
+			}
+		}
+		if int64(len(chunk)) > next-off {
+			chunk = chunk[:next-off]
+		}
+		if off < headers {
+			if int64(len(chunk)) > headers-off {
+				chunk = chunk[:headers-off]
+			}
+			m, err := f.r.ReadAt(chunk, off)
+			n += m
+			if m < len(chunk) {
+				return n, formatError(off+int64(m), "headers", err)
+			}
+			continue
+		}
+		for i := range chunk {
+			chunk[i] = 0
+		}
+		n += len(chunk)
+	}
+	return n, nil
+}
+
+// ReadRVA returns the n bytes of the image f starting at the relative
+// virtual address rva, as laid out in memory once it is loaded: the
+// headers, then each section at its RVA, with zeros past the raw data
+// of sections and between them. Reading past SizeOfImage fails. Unlike
+// Section.VirtualReader, ReadRVA can read across sections.
+func (f *File) ReadRVA(rva uint32, n int) ([]byte, error) {
+	return f.ReadVA(f.imageBase()+uint64(rva), n)
+}
+
+// ReadVA is like ReadRVA, but takes a virtual address: the image
+// base of f plus a relative virtual address.
+func (f *File) ReadVA(va uint64, n int) ([]byte, error) {
+	if n < 0 || uint64(n) > 1<<32 {
+		return nil, fmt.Errorf("pe: bad read size %d", n)
+	}
+	if oh := f.optionalHeader(); oh != nil && uint64(n) > uint64(oh.sizeOfImage) {
+		return nil, &FormatError{-1, fmt.Sprintf("data at address %#x", va), ErrOutOfBounds, n}
+	}
+	p := make([]byte, n)
+	m, err := f.ReadAtAddr(p, va)
+	if m < n {
+		if err == io.EOF {
+			err = &FormatError{-1, fmt.Sprintf("data at address %#x", va), ErrOutOfBounds, n}
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReaderAtVA returns an io.ReaderAt whose offsets are the virtual
+// addresses of the image f, reading as ReadVA does.
+func (f *File) ReaderAtVA() io.ReaderAt {
+	return vaReaderAt{f}
+}
+
+type vaReaderAt struct {
+	f *File
+}
+
+func (r vaReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("pe: negative address")
+	}
+	return r.f.ReadAtAddr(p, uint64(off))
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "strconv"
+
+// SectionCharacteristics are the flags of a section header, a
+// combination of the IMAGE_SCN_* constants, as returned by
+// SectionHeader.Flags.
+type SectionCharacteristics uint32
+
+// scnNames are the names of the section flags, without
+// their IMAGE_SCN_, IMAGE_SCN_CNT_ or IMAGE_SCN_MEM_ prefix,
+// in the order String lists them.
+var scnNames = []struct {
+	flag SectionCharacteristics
+	name string
+}{
+	{IMAGE_SCN_TYPE_NO_PAD, "TYPE_NO_PAD"},
+	{IMAGE_SCN_CNT_CODE, "CODE"},
+	{IMAGE_SCN_CNT_INITIALIZED_DATA, "INITIALIZED_DATA"},
+	{IMAGE_SCN_CNT_UNINITIALIZED_DATA, "UNINITIALIZED_DATA"},
+	{IMAGE_SCN_LNK_OTHER, "LNK_OTHER"},
+	{IMAGE_SCN_LNK_INFO, "LNK_INFO"},
+	{IMAGE_SCN_LNK_REMOVE, "LNK_REMOVE"},
+	{IMAGE_SCN_LNK_COMDAT, "LNK_COMDAT"},
+	{IMAGE_SCN_GPREL, "GPREL"},
+	{IMAGE_SCN_MEM_PURGEABLE, "PURGEABLE"},
+	{IMAGE_SCN_MEM_LOCKED, "LOCKED"},
+	{IMAGE_SCN_MEM_PRELOAD, "PRELOAD"},
+	{IMAGE_SCN_LNK_NRELOC_OVFL, "LNK_NRELOC_OVFL"},
+	{IMAGE_SCN_MEM_DISCARDABLE, "DISCARDABLE"},
+	{IMAGE_SCN_MEM_NOT_CACHED, "NOT_CACHED"},
+	{IMAGE_SCN_MEM_NOT_PAGED, "NOT_PAGED"},
+	{IMAGE_SCN_MEM_SHARED, "SHARED"},
+	{IMAGE_SCN_MEM_EXECUTE, "EXECUTE"},
+	{IMAGE_SCN_MEM_READ, "READ"},
+	{IMAGE_SCN_MEM_WRITE, "WRITE"},
+}
+
+// String returns the names of the flags in c separated by "|",
+// such as "CODE|EXECUTE|READ", with the alignment of object file
+// sections as "ALIGN_16BYTES" and unknown flags in hexadecimal.
+func (c SectionCharacteristics) String() string {
+	if c == 0 {
+		return "0"
+	}
+	var s string
+	add := func(name string) {
+		if s != "" {
+			s += "|"
+		}
+		s += name
+	}
+	rest := c
+	for _, n := range scnNames {
+		if c&n.flag != 0 {
+			add(n.name)
+			rest &^= n.flag
+		}
+		if n.flag == IMAGE_SCN_MEM_PRELOAD && c.Alignment() != 0 {
+			add("ALIGN_" + strconv.Itoa(c.Alignment()) + "BYTES")
+			rest &^= IMAGE_SCN_ALIGN_MASK
+		}
+	}
+	if rest != 0 {
+		add("0x" + strconv.FormatUint(uint64(rest), 16))
+	}
+	return s
+}
+
+// IsExecutable reports whether c has IMAGE_SCN_MEM_EXECUTE.
+func (c SectionCharacteristics) IsExecutable() bool { return c&IMAGE_SCN_MEM_EXECUTE != 0 }
+
+// IsReadable reports whether c has IMAGE_SCN_MEM_READ.
+func (c SectionCharacteristics) IsReadable() bool { return c&IMAGE_SCN_MEM_READ != 0 }
+
+// IsWritable reports whether c has IMAGE_SCN_MEM_WRITE.
+func (c SectionCharacteristics) IsWritable() bool { return c&IMAGE_SCN_MEM_WRITE != 0 }
+
+// IsDiscardable reports whether c has IMAGE_SCN_MEM_DISCARDABLE.
+func (c SectionCharacteristics) IsDiscardable() bool { return c&IMAGE_SCN_MEM_DISCARDABLE != 0 }
+
+// IsShared reports whether c has IMAGE_SCN_MEM_SHARED.
+func (c SectionCharacteristics) IsShared() bool { return c&IMAGE_SCN_MEM_SHARED != 0 }
+
+// Alignment returns the alignment of the data of an object file
+// section with characteristics c, in bytes, or 0 if c does not
+// specify it. The 16 values of the alignment field go from 1 to
+// 8192 bytes; the last one is invalid and also returns 0.
+func (c SectionCharacteristics) Alignment() int {
+	n := uint(c&IMAGE_SCN_ALIGN_MASK) >> 20
+	if n == 0 || n == 15 {
+		return 0
+	}
+	return 1 << (n - 1)
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "testing"
+
+func TestSectionCharacteristics(t *testing.T) {
+	tests := []struct {
+		c    SectionCharacteristics
+		s    string
+		x, w bool
+	}{
+		{0, "0", false, false},
+		{0x60000020, "CODE|EXECUTE|READ", true, false},
+		{0xc0000040, "INITIALIZED_DATA|READ|WRITE", false, true},
+		{0x42000040, "INITIALIZED_DATA|DISCARDABLE|READ", false, false},
+		{0x60500020, "CODE|ALIGN_16BYTES|EXECUTE|READ", true, false},
+		{0x00f00010, "0xf00010", false, false},
+	}
+	for _, tt := range tests {
+		if s := tt.c.String(); s != tt.s {
+			t.Errorf("SectionCharacteristics(%#x).String() = %q, want %q", uint32(tt.c), s, tt.s)
+		}
+		if tt.c.IsExecutable() != tt.x || tt.c.IsWritable() != tt.w || !tt.c.IsReadable() != (tt.c&IMAGE_SCN_MEM_READ == 0) {
+			t.Errorf("SectionCharacteristics(%#x) has the wrong permissions", uint32(tt.c))
+		}
+	}
+	if c := SectionCharacteristics(0x42000040); !c.IsDiscardable() || c.IsShared() {
+		t.Errorf("%v: IsDiscardable = %v, IsShared = %v", c, c.IsDiscardable(), c.IsShared())
+	}
+	for n, want := range map[uint32]int{0: 0, 1: 1, 5: 16, 14: 8192, 15: 0} {
+		if a := SectionCharacteristics(n << 20).Alignment(); a != want {
+			t.Errorf("Alignment of field %d = %d, want %d", n, a, want)
+		}
+	}
+
+	f, err := Open("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// The linker kept the alignment of the object files.
+	if c := f.Section(".text").Flags().String(); c != "CODE|ALIGN_16BYTES|EXECUTE|READ" {
+		t.Errorf(".text characteristics %s", c)
+	}
+}
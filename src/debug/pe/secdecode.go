@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"sync"
+)
+
+// A SectionDecoder decodes the contents of section s of f,
+// for File.DecodedSection.
+type SectionDecoder func(f *File, s *Section) (interface{}, error)
+
+var (
+	sectionDecodersMu sync.RWMutex
+
+	// sectionDecoders holds the decoders of sections by
+	// name, starting with those of this package.
+	sectionDecoders = map[string]SectionDecoder{
+		".drectve": func(f *File, s *Section) (interface{}, error) {
+			b, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			return parseDirectives(b)
+		},
+		".sxdata":    decodeSymbolIndexes,
+		".gfids$y":   decodeSymbolIndexes,
+		".giats$y":   decodeSymbolIndexes,
+		".gljmp$y":   decodeSymbolIndexes,
+		".gehcont$y": decodeSymbolIndexes,
+		".eh_frame": func(f *File, s *Section) (interface{}, error) {
+			return f.FrameTable(".eh_frame")
+		},
+		".debug_frame": func(f *File, s *Section) (interface{}, error) {
+			return f.FrameTable(".debug_frame")
+		},
+		".gopclntab": func(f *File, s *Section) (interface{}, error) {
+			return f.GoSymTable()
+		},
+		".apiset": func(f *File, s *Section) (interface{}, error) {
+			b, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			return ParseAPISetSchema(b)
+		},
+	}
+)
+
+// decodeSymbolIndexes decodes the sections of object files that
+// list symbols by index: .sxdata, and the .gfids$y, .giats$y,
+// .gljmp$y and .gehcont$y sections in which the compiler lists
+// the targets of control flow guard tables.
+func decodeSymbolIndexes(f *File, s *Section) (interface{}, error) {
+	return f.symbolIndexes(s)
+}
+
+// RegisterSectionDecoder registers dec as the decoder of the
+// sections named name, replacing the previous one, if any, including
+// the decoders of this package. A nil dec removes the decoder.
+// RegisterSectionDecoder is typically called from an init function
+// and is safe for concurrent use.
+func RegisterSectionDecoder(name string, dec SectionDecoder) {
+	sectionDecodersMu.Lock()
+	defer sectionDecodersMu.Unlock()
+	if dec == nil {
+		delete(sectionDecoders, name)
+		return
+	}
+	sectionDecoders[name] = dec
+}
+
+// DecodedSection returns the contents of the first section of f
+// named name, as decoded by the decoder registered for name. It
+// returns nil if f has no such section and fails if no decoder
+// is registered. The types of the values the decoders of this
+// package return are:
+//
+//	.drectve                               []LinkerDirective
+//	.sxdata, .gfids$y, .giats$y,
+//	.gljmp$y, .gehcont$y                   []uint32, symbol indexes as by SafeSEHHandlers
+//	.eh_frame, .debug_frame                *FrameTable
+//	.gopclntab                             *gosym.Table
+//	.apiset                                *APISetSchema
+func (f *File) DecodedSection(name string) (interface{}, error) {
+	sectionDecodersMu.RLock()
+	dec := sectionDecoders[name]
+	sectionDecodersMu.RUnlock()
+	if dec == nil {
+		return nil, errors.New("pe: no decoder for section " + name)
+	}
+	s := f.Section(name)
+	if s == nil {
+		return nil, nil
+	}
+	return dec(f, s)
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Selection values of COMDAT sections, telling the linker
+// which of several definitions to keep.
+const (
+	IMAGE_COMDAT_SELECT_NODUPLICATES = 1
+	IMAGE_COMDAT_SELECT_ANY          = 2
+	IMAGE_COMDAT_SELECT_SAME_SIZE    = 3
+	IMAGE_COMDAT_SELECT_EXACT_MATCH  = 4
+	IMAGE_COMDAT_SELECT_ASSOCIATIVE  = 5
+	IMAGE_COMDAT_SELECT_LARGEST      = 6
+)
+
+// COFFSymbolAuxFormat5 is the section definition record that
+// follows the symbol of a section in an object file (auxiliary
+// format 5).
+type COFFSymbolAuxFormat5 struct {
+	Size           uint32
+	NumRelocs      uint16
+	NumLineNumbers uint16
+	Checksum       uint32
+
+	// SecNum is the number of the associated section of an
+	// IMAGE_COMDAT_SELECT_ASSOCIATIVE COMDAT section. Only big
+	// object files store its upper 16 bits.
+	SecNum    uint32
+	Selection uint8 // IMAGE_COMDAT_SELECT_* value of a COMDAT section
+}
+
+// COFFSymbolReadSectionDefAux returns the section definition record
+// of the symbol whose record has index idx in f.COFFSymbols, which
+// must be that of a section (of storage class IMAGE_SYM_CLASS_STATIC).
+// It decodes both the 18-byte records of regular object files and
+// the 20-byte ones of big object files.
+func (f *File) COFFSymbolReadSectionDefAux(idx int) (*COFFSymbolAuxFormat5, error) {
+	aux, err := f.AuxSymbols(idx)
+	if err != nil {
+		return nil, err
+	}
+	if f.COFFSymbols[idx].StorageClass != IMAGE_SYM_CLASS_STATIC {
+		return nil, errors.New("pe: section definition of a symbol that is not static")
+	}
+	if len(aux) == 0 {
+		return nil, &FormatError{-1, "section definition", errors.New("missing auxiliary record"), idx}
+	}
+	var b [COFFSymbolSize]byte
+	encodeCOFFSymbol(b[:], &aux[0])
+	d := &COFFSymbolAuxFormat5{
+		Size:           binary.LittleEndian.Uint32(b[0:]),
+		NumRelocs:      binary.LittleEndian.Uint16(b[4:]),
+		NumLineNumbers: binary.LittleEndian.Uint16(b[6:]),
+		Checksum:       binary.LittleEndian.Uint32(b[8:]),
+		SecNum:         uint32(binary.LittleEndian.Uint16(b[12:])),
+		Selection:      b[14],
+	}
+	if len(f.COFFBigSymbols) > 0 {
+		// Big object files keep the high part of
+		// the number after the reserved byte.
+		d.SecNum |= uint32(binary.LittleEndian.Uint16(b[16:])) << 16
+	}
+	return d, nil
+}
@@ -6,9 +6,11 @@ package pe
 
 import (
 	"encoding/binary"
-	"fmt"
+	"errors"
 	"io"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // SectionHeader32 represents real PE COFF section header.
@@ -25,6 +27,24 @@ type SectionHeader32 struct {
 	Characteristics      uint32
 }
 
+// sectionChunk is the number of section headers
+// NewFile reads from the file at once.
+const sectionChunk = 1024
+
+// decodeSectionHeader decodes the 40 bytes of b into sh.
+func decodeSectionHeader(b []byte, sh *SectionHeader32) {
+	copy(sh.Name[:], b[0:8])
+	sh.VirtualSize = binary.LittleEndian.Uint32(b[8:])
+	sh.VirtualAddress = binary.LittleEndian.Uint32(b[12:])
+	sh.SizeOfRawData = binary.LittleEndian.Uint32(b[16:])
+	sh.PointerToRawData = binary.LittleEndian.Uint32(b[20:])
+	sh.PointerToRelocations = binary.LittleEndian.Uint32(b[24:])
+	sh.PointerToLineNumbers = binary.LittleEndian.Uint32(b[28:])
+	sh.NumberOfRelocations = binary.LittleEndian.Uint16(b[32:])
+	sh.NumberOfLineNumbers = binary.LittleEndian.Uint16(b[34:])
+	sh.Characteristics = binary.LittleEndian.Uint32(b[36:])
+}
+
 // fullName finds real name of section sh. Normally name is stored
 // in sh.Name, but if it is longer then 8 characters, it is stored
 // in COFF string table st instead.
@@ -32,6 +52,20 @@ func (sh *SectionHeader32) fullName(st StringTable) (string, error) {
 	if sh.Name[0] != '/' {
 		return cstring(sh.Name[:]), nil
 	}
+	if sh.Name[1] == '/' {
+		// Offsets too large for seven decimal digits,
+		// as found in big object files, are encoded
+		// in base 64 as "//" and six digits.
+		var off uint32
+		for _, c := range sh.Name[2:] {
+			d := strings.IndexByte(base64Digits, c)
+			if d < 0 {
+				return "", &FormatError{-1, "section name", errors.New("bad base 64 offset"), sh.Name[:]}
+			}
+			off = off<<6 | uint32(d)
+		}
+		return st.String(off)
+	}
 	i, err := strconv.Atoi(cstring(sh.Name[1:]))
 	if err != nil {
 		return "", err
@@ -39,7 +73,173 @@ func (sh *SectionHeader32) fullName(st StringTable) (string, error) {
 	return st.String(uint32(i))
 }
 
-// TODO(brainman): copy all IMAGE_REL_* consts from ldpe.go here
+// base64Digits are the digits of the base 64
+// encoding of long section name offsets.
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Relocation types of AMD64 files.
+const (
+	IMAGE_REL_AMD64_ABSOLUTE = 0x0
+	IMAGE_REL_AMD64_ADDR64   = 0x1
+	IMAGE_REL_AMD64_ADDR32   = 0x2
+	IMAGE_REL_AMD64_ADDR32NB = 0x3
+	IMAGE_REL_AMD64_REL32    = 0x4
+	IMAGE_REL_AMD64_REL32_1  = 0x5
+	IMAGE_REL_AMD64_REL32_2  = 0x6
+	IMAGE_REL_AMD64_REL32_3  = 0x7
+	IMAGE_REL_AMD64_REL32_4  = 0x8
+	IMAGE_REL_AMD64_REL32_5  = 0x9
+	IMAGE_REL_AMD64_SECTION  = 0xa
+	IMAGE_REL_AMD64_SECREL   = 0xb
+	IMAGE_REL_AMD64_SECREL7  = 0xc
+	IMAGE_REL_AMD64_TOKEN    = 0xd
+	IMAGE_REL_AMD64_SREL32   = 0xe
+	IMAGE_REL_AMD64_PAIR     = 0xf
+	IMAGE_REL_AMD64_SSPAN32  = 0x10
+)
+
+// Relocation types of I386 files.
+const (
+	IMAGE_REL_I386_ABSOLUTE = 0x0
+	IMAGE_REL_I386_DIR16    = 0x1
+	IMAGE_REL_I386_REL16    = 0x2
+	IMAGE_REL_I386_DIR32    = 0x6
+	IMAGE_REL_I386_DIR32NB  = 0x7
+	IMAGE_REL_I386_SEG12    = 0x9
+	IMAGE_REL_I386_SECTION  = 0xa
+	IMAGE_REL_I386_SECREL   = 0xb
+	IMAGE_REL_I386_TOKEN    = 0xc
+	IMAGE_REL_I386_SECREL7  = 0xd
+	IMAGE_REL_I386_REL32    = 0x14
+)
+
+// Relocation types of ARM and Thumb-2 files.
+const (
+	IMAGE_REL_ARM_ABSOLUTE   = 0x0
+	IMAGE_REL_ARM_ADDR32     = 0x1
+	IMAGE_REL_ARM_ADDR32NB   = 0x2
+	IMAGE_REL_ARM_BRANCH24   = 0x3
+	IMAGE_REL_ARM_BRANCH11   = 0x4
+	IMAGE_REL_ARM_REL32      = 0xa
+	IMAGE_REL_ARM_SECTION    = 0xe
+	IMAGE_REL_ARM_SECREL     = 0xf
+	IMAGE_REL_ARM_MOV32      = 0x10
+	IMAGE_REL_THUMB_MOV32    = 0x11
+	IMAGE_REL_THUMB_BRANCH20 = 0x12
+	IMAGE_REL_THUMB_BRANCH24 = 0x14
+	IMAGE_REL_THUMB_BLX23    = 0x15
+	IMAGE_REL_ARM_PAIR       = 0x16
+)
+
+// Relocation types of ARM64 files.
+const (
+	IMAGE_REL_ARM64_ABSOLUTE       = 0x0
+	IMAGE_REL_ARM64_ADDR32         = 0x1
+	IMAGE_REL_ARM64_ADDR32NB       = 0x2
+	IMAGE_REL_ARM64_BRANCH26       = 0x3
+	IMAGE_REL_ARM64_PAGEBASE_REL21 = 0x4
+	IMAGE_REL_ARM64_REL21          = 0x5
+	IMAGE_REL_ARM64_PAGEOFFSET_12A = 0x6
+	IMAGE_REL_ARM64_PAGEOFFSET_12L = 0x7
+	IMAGE_REL_ARM64_SECREL         = 0x8
+	IMAGE_REL_ARM64_SECREL_LOW12A  = 0x9
+	IMAGE_REL_ARM64_SECREL_HIGH12A = 0xa
+	IMAGE_REL_ARM64_SECREL_LOW12L  = 0xb
+	IMAGE_REL_ARM64_TOKEN          = 0xc
+	IMAGE_REL_ARM64_SECTION        = 0xd
+	IMAGE_REL_ARM64_ADDR64         = 0xe
+	IMAGE_REL_ARM64_BRANCH19       = 0xf
+	IMAGE_REL_ARM64_BRANCH14       = 0x10
+	IMAGE_REL_ARM64_REL32          = 0x11
+)
+
+// relocTypeNames maps the relocation types of each machine to
+// their names. ARM and Thumb-2 (ARMNT) files share their types.
+var relocTypeNames = map[uint16]map[uint16]string{
+	IMAGE_FILE_MACHINE_AMD64: {
+		IMAGE_REL_AMD64_ABSOLUTE: "IMAGE_REL_AMD64_ABSOLUTE",
+		IMAGE_REL_AMD64_ADDR64:   "IMAGE_REL_AMD64_ADDR64",
+		IMAGE_REL_AMD64_ADDR32:   "IMAGE_REL_AMD64_ADDR32",
+		IMAGE_REL_AMD64_ADDR32NB: "IMAGE_REL_AMD64_ADDR32NB",
+		IMAGE_REL_AMD64_REL32:    "IMAGE_REL_AMD64_REL32",
+		IMAGE_REL_AMD64_REL32_1:  "IMAGE_REL_AMD64_REL32_1",
+		IMAGE_REL_AMD64_REL32_2:  "IMAGE_REL_AMD64_REL32_2",
+		IMAGE_REL_AMD64_REL32_3:  "IMAGE_REL_AMD64_REL32_3",
+		IMAGE_REL_AMD64_REL32_4:  "IMAGE_REL_AMD64_REL32_4",
+		IMAGE_REL_AMD64_REL32_5:  "IMAGE_REL_AMD64_REL32_5",
+		IMAGE_REL_AMD64_SECTION:  "IMAGE_REL_AMD64_SECTION",
+		IMAGE_REL_AMD64_SECREL:   "IMAGE_REL_AMD64_SECREL",
+		IMAGE_REL_AMD64_SECREL7:  "IMAGE_REL_AMD64_SECREL7",
+		IMAGE_REL_AMD64_TOKEN:    "IMAGE_REL_AMD64_TOKEN",
+		IMAGE_REL_AMD64_SREL32:   "IMAGE_REL_AMD64_SREL32",
+		IMAGE_REL_AMD64_PAIR:     "IMAGE_REL_AMD64_PAIR",
+		IMAGE_REL_AMD64_SSPAN32:  "IMAGE_REL_AMD64_SSPAN32",
+	},
+	IMAGE_FILE_MACHINE_I386: {
+		IMAGE_REL_I386_ABSOLUTE: "IMAGE_REL_I386_ABSOLUTE",
+		IMAGE_REL_I386_DIR16:    "IMAGE_REL_I386_DIR16",
+		IMAGE_REL_I386_REL16:    "IMAGE_REL_I386_REL16",
+		IMAGE_REL_I386_DIR32:    "IMAGE_REL_I386_DIR32",
+		IMAGE_REL_I386_DIR32NB:  "IMAGE_REL_I386_DIR32NB",
+		IMAGE_REL_I386_SEG12:    "IMAGE_REL_I386_SEG12",
+		IMAGE_REL_I386_SECTION:  "IMAGE_REL_I386_SECTION",
+		IMAGE_REL_I386_SECREL:   "IMAGE_REL_I386_SECREL",
+		IMAGE_REL_I386_TOKEN:    "IMAGE_REL_I386_TOKEN",
+		IMAGE_REL_I386_SECREL7:  "IMAGE_REL_I386_SECREL7",
+		IMAGE_REL_I386_REL32:    "IMAGE_REL_I386_REL32",
+	},
+	IMAGE_FILE_MACHINE_ARMNT: relocARMNames,
+	IMAGE_FILE_MACHINE_ARM:   relocARMNames,
+	IMAGE_FILE_MACHINE_THUMB: relocARMNames,
+	IMAGE_FILE_MACHINE_ARM64: {
+		IMAGE_REL_ARM64_ABSOLUTE:       "IMAGE_REL_ARM64_ABSOLUTE",
+		IMAGE_REL_ARM64_ADDR32:         "IMAGE_REL_ARM64_ADDR32",
+		IMAGE_REL_ARM64_ADDR32NB:       "IMAGE_REL_ARM64_ADDR32NB",
+		IMAGE_REL_ARM64_BRANCH26:       "IMAGE_REL_ARM64_BRANCH26",
+		IMAGE_REL_ARM64_PAGEBASE_REL21: "IMAGE_REL_ARM64_PAGEBASE_REL21",
+		IMAGE_REL_ARM64_REL21:          "IMAGE_REL_ARM64_REL21",
+		IMAGE_REL_ARM64_PAGEOFFSET_12A: "IMAGE_REL_ARM64_PAGEOFFSET_12A",
+		IMAGE_REL_ARM64_PAGEOFFSET_12L: "IMAGE_REL_ARM64_PAGEOFFSET_12L",
+		IMAGE_REL_ARM64_SECREL:         "IMAGE_REL_ARM64_SECREL",
+		IMAGE_REL_ARM64_SECREL_LOW12A:  "IMAGE_REL_ARM64_SECREL_LOW12A",
+		IMAGE_REL_ARM64_SECREL_HIGH12A: "IMAGE_REL_ARM64_SECREL_HIGH12A",
+		IMAGE_REL_ARM64_SECREL_LOW12L:  "IMAGE_REL_ARM64_SECREL_LOW12L",
+		IMAGE_REL_ARM64_TOKEN:          "IMAGE_REL_ARM64_TOKEN",
+		IMAGE_REL_ARM64_SECTION:        "IMAGE_REL_ARM64_SECTION",
+		IMAGE_REL_ARM64_ADDR64:         "IMAGE_REL_ARM64_ADDR64",
+		IMAGE_REL_ARM64_BRANCH19:       "IMAGE_REL_ARM64_BRANCH19",
+		IMAGE_REL_ARM64_BRANCH14:       "IMAGE_REL_ARM64_BRANCH14",
+		IMAGE_REL_ARM64_REL32:          "IMAGE_REL_ARM64_REL32",
+	},
+}
+
+var relocARMNames = map[uint16]string{
+	IMAGE_REL_ARM_ABSOLUTE:   "IMAGE_REL_ARM_ABSOLUTE",
+	IMAGE_REL_ARM_ADDR32:     "IMAGE_REL_ARM_ADDR32",
+	IMAGE_REL_ARM_ADDR32NB:   "IMAGE_REL_ARM_ADDR32NB",
+	IMAGE_REL_ARM_BRANCH24:   "IMAGE_REL_ARM_BRANCH24",
+	IMAGE_REL_ARM_BRANCH11:   "IMAGE_REL_ARM_BRANCH11",
+	IMAGE_REL_ARM_REL32:      "IMAGE_REL_ARM_REL32",
+	IMAGE_REL_ARM_SECTION:    "IMAGE_REL_ARM_SECTION",
+	IMAGE_REL_ARM_SECREL:     "IMAGE_REL_ARM_SECREL",
+	IMAGE_REL_ARM_MOV32:      "IMAGE_REL_ARM_MOV32",
+	IMAGE_REL_THUMB_MOV32:    "IMAGE_REL_THUMB_MOV32",
+	IMAGE_REL_THUMB_BRANCH20: "IMAGE_REL_THUMB_BRANCH20",
+	IMAGE_REL_THUMB_BRANCH24: "IMAGE_REL_THUMB_BRANCH24",
+	IMAGE_REL_THUMB_BLX23:    "IMAGE_REL_THUMB_BLX23",
+	IMAGE_REL_ARM_PAIR:       "IMAGE_REL_ARM_PAIR",
+}
+
+// RelocTypeString returns the name of relocation type typ
+// of files for the given machine, such as
+// "IMAGE_REL_AMD64_REL32", or the type in hexadecimal
+// if it is unknown.
+func RelocTypeString(machine, typ uint16) string {
+	if s, ok := relocTypeNames[machine][typ]; ok {
+		return s
+	}
+	return "0x" + strconv.FormatUint(uint64(typ), 16)
+}
 
 // Reloc represents a PE COFF relocation.
 // Each section contains its own relocation list.
@@ -49,18 +249,61 @@ type Reloc struct {
 	Type             uint16
 }
 
-func readRelocs(sh *SectionHeader, r io.ReadSeeker) ([]Reloc, error) {
+// relocSize is the size of a relocation record.
+const relocSize = 10
+
+// readRelocs reads the relocations of the section described by sh
+// from r. size is the size of the file, or -1 if it is not known.
+//
+// Sections with more than 65534 relocations have the
+// IMAGE_SCN_LNK_NRELOC_OVFL characteristic and a NumberOfRelocations
+// of 0xffff. The VirtualAddress of their first relocation holds the
+// real count, including that first entry, which is not returned.
+func readRelocs(sh *SectionHeader, ra io.ReaderAt, size int64) ([]Reloc, error) {
 	if sh.NumberOfRelocations <= 0 {
 		return nil, nil
 	}
-	_, err := r.Seek(int64(sh.PointerToRelocations), seekStart)
-	if err != nil {
-		return nil, fmt.Errorf("fail to seek to %q section relocations: %v", sh.Name, err)
+	off := int64(sh.PointerToRelocations)
+	n := int64(sh.NumberOfRelocations)
+	r := io.NewSectionReader(ra, off, 1<<63-1-off)
+	if sh.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL != 0 && n == 0xffff {
+		var b [relocSize]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, formatError(off, sh.Name+" section relocation count", err)
+		}
+		n = int64(binary.LittleEndian.Uint32(b[:]))
+		if n == 0 {
+			return nil, &FormatError{off, sh.Name + " section relocation count", ErrOutOfBounds, n}
+		}
+		off += relocSize
+		n--
 	}
-	relocs := make([]Reloc, sh.NumberOfRelocations)
-	err = binary.Read(r, binary.LittleEndian, relocs)
-	if err != nil {
-		return nil, fmt.Errorf("fail to read section relocations: %v", err)
+	if size >= 0 && off+n*relocSize > size {
+		return nil, &FormatError{off, sh.Name + " section relocations", ErrOutOfBounds, n}
+	}
+	// Read the relocations in chunks, so that a bogus
+	// count in a file of unknown size fails once the data
+	// runs out rather than causing a huge allocation.
+	var relocs []Reloc
+	if size >= 0 {
+		relocs = make([]Reloc, 0, n)
+	}
+	buf := make([]byte, 1024*relocSize)
+	for int64(len(relocs)) < n {
+		b := buf
+		if m := n - int64(len(relocs)); m < 1024 {
+			b = buf[:m*relocSize]
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, formatError(off, sh.Name+" section relocations", err)
+		}
+		for ; len(b) > 0; b = b[relocSize:] {
+			relocs = append(relocs, Reloc{
+				VirtualAddress:   binary.LittleEndian.Uint32(b[0:]),
+				SymbolTableIndex: binary.LittleEndian.Uint32(b[4:]),
+				Type:             binary.LittleEndian.Uint16(b[8:]),
+			})
+		}
 	}
 	return relocs, nil
 }
@@ -80,9 +323,18 @@ type SectionHeader struct {
 	Characteristics      uint32
 }
 
+// Flags returns the Characteristics of sh as SectionCharacteristics.
+func (sh *SectionHeader) Flags() SectionCharacteristics {
+	return SectionCharacteristics(sh.Characteristics)
+}
+
 // Section provides access to PE COFF section.
 type Section struct {
 	SectionHeader
+
+	// Relocs holds the relocations of the section. It can have
+	// more than NumberOfRelocations entries, for sections with the
+	// IMAGE_SCN_LNK_NRELOC_OVFL characteristic.
 	Relocs []Reloc
 
 	// Embed ReaderAt for ReadAt method.
@@ -93,19 +345,198 @@ type Section struct {
 	// with other clients.
 	io.ReaderAt
 	sr *io.SectionReader
+
+	// data holds the raw contents of the section if
+	// the whole file is in memory, and nil otherwise.
+	data []byte
+
+	// missing is the number of bytes of the section's raw data
+	// that lie beyond the end of the file, in truncated or
+	// malformed files, or, for sections that read as zeros,
+	// beyond the end of the image.
+	missing int64
+
+	// mapper, if not nil, maps the raw data of the
+	// section into memory; see Options.MapSections.
+	// mu then protects data, which is set on first use.
+	mapper *sectionMapper
+	mu     sync.Mutex
 }
 
 // Data reads and returns the contents of the PE section s.
+// If the File was opened with OpenMmap or with Options.MapSections,
+// the returned slice refers to a read-only mapping of the file, and
+// if it was created by NewFileFromBytes, to the caller's memory.
+// Data is safe for concurrent use.
 func (s *Section) Data() ([]byte, error) {
-	dat := make([]byte, s.sr.Size())
+	if s.mapper != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.data == nil {
+			b, err := s.mapper.mapRange(int64(s.Offset), int64(s.Size))
+			if err != nil {
+				return nil, err
+			}
+			s.data = b
+		}
+		return s.data, nil
+	}
+	if s.data != nil {
+		return s.data, nil
+	}
+	// Do not allocate for data that is not there.
+	size := s.sr.Size() - s.missing
+	if size != int64(int(size)) {
+		return nil, errTooLarge
+	}
+	dat := make([]byte, size)
 	n, err := s.sr.ReadAt(dat, 0)
+	if n == len(dat) && s.missing > 0 {
+		return dat, io.EOF
+	}
 	if n == len(dat) {
 		err = nil
 	}
 	return dat[0:n], err
 }
 
+// errTooLarge is returned by Data for sections
+// that do not fit in the address space.
+var errTooLarge = errors.New("pe: section too large to hold in memory")
+
 // Open returns a new ReadSeeker reading the PE section s.
 func (s *Section) Open() io.ReadSeeker {
 	return io.NewSectionReader(s.sr, 0, 1<<63-1)
 }
+
+// virtualSize returns the size of s when loaded into memory.
+// For image files this is VirtualSize, for object files,
+// which leave VirtualSize zero, it is the raw data size.
+func (s *Section) virtualSize() int64 {
+	if s.VirtualSize == 0 {
+		return int64(s.Size)
+	}
+	return int64(s.VirtualSize)
+}
+
+// VirtualReader returns a reader of the contents of s as they
+// appear in memory once the image is loaded: VirtualSize bytes,
+// where bytes past the end of the raw data read as zero and any
+// raw data past VirtualSize (file alignment padding) is ignored.
+// Unlike Data, it does not read the whole section, so it is
+// suitable for random access into very large sections.
+// For object files, whose sections have no VirtualSize,
+// VirtualReader reads the same data as s.ReadAt.
+func (s *Section) VirtualReader() *io.SectionReader {
+	size := s.virtualSize()
+	raw := s.sr.Size()
+	if raw > size {
+		raw = size
+	}
+	return io.NewSectionReader(&zeroFillReaderAt{s.sr, raw}, 0, size)
+}
+
+// zeroFillReaderAt reads the first size bytes from r
+// and zeros beyond that.
+type zeroFillReaderAt struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func (z *zeroFillReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < z.size {
+		m := p
+		if int64(len(m)) > z.size-off {
+			m = m[:z.size-off]
+		}
+		n, err = z.r.ReadAt(m, off)
+		if n < len(m) {
+			return n, err
+		}
+		off += int64(n)
+	}
+	for i := range p[n:] {
+		p[n+i] = 0
+	}
+	return len(p), nil
+}
+
+// CachedReader returns a ReaderAt for r that keeps up to
+// blocks blocks of blockSize bytes of the data read through it
+// in memory, so that repeated small reads of nearby data, as done
+// when chasing pointers inside a large section, do not each go
+// to the underlying file. r must not be modified while the
+// returned reader is in use. The returned reader is safe for
+// concurrent use.
+func CachedReader(r *io.SectionReader, blockSize, blocks int) io.ReaderAt {
+	if blockSize <= 0 {
+		blockSize = 4096
+	}
+	if blocks <= 0 {
+		blocks = 1
+	}
+	return &blockCache{
+		r:         r,
+		size:      r.Size(),
+		blockSize: int64(blockSize),
+		max:       blocks,
+		blocks:    make(map[int64][]byte),
+	}
+}
+
+// blockCache is the io.ReaderAt returned by CachedReader.
+type blockCache struct {
+	r         io.ReaderAt
+	size      int64
+	blockSize int64
+	max       int
+
+	mu     sync.Mutex
+	blocks map[int64][]byte // block number to contents
+	order  []int64          // block numbers, oldest first
+}
+
+// block returns the contents of block b, reading it if needed.
+// c.mu must be held.
+func (c *blockCache) block(b int64) ([]byte, error) {
+	if data, ok := c.blocks[b]; ok {
+		return data, nil
+	}
+	off := b * c.blockSize
+	n := c.blockSize
+	if off+n > c.size {
+		n = c.size - off
+	}
+	data := make([]byte, n)
+	if _, err := c.r.ReadAt(data, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(c.order) >= c.max {
+		delete(c.blocks, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.blocks[b] = data
+	c.order = append(c.order, b)
+	return data, nil
+}
+
+func (c *blockCache) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("pe: negative offset")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n < len(p) {
+		if off >= c.size {
+			return n, io.EOF
+		}
+		data, err := c.block(off / c.blockSize)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], data[off%c.blockSize:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"path"
+	"unicode/utf8"
+)
+
+// The functions in this file return sequences: functions that
+// call yield once for each element, in order, stopping early if
+// yield returns false. They let callers that only need a subset of
+// the elements avoid building the full slices that the corresponding
+// File fields and methods return.
+
+// SymbolsSeq returns a sequence of the COFF symbols of f, with
+// auxiliary symbol records removed, as found in f.Symbols.
+// The symbols are streamed from the underlying file, so the
+// sequence works even if the File was opened with
+// Options.LazySymbols and the symbol table was never loaded.
+// If reading the symbol table fails, the sequence ends by
+// yielding a nil Symbol and the error.
+func (f *File) SymbolsSeq() func(yield func(*Symbol, error) bool) {
+	return f.FilterSymbols(nil)
+}
+
+// A SymbolFilter selects the symbols that FilterSymbols yields.
+// Symbols must pass every filter that is set; the zero
+// SymbolFilter selects all symbols.
+type SymbolFilter struct {
+	// SectionNumbers and StorageClasses, if not empty, list
+	// the section numbers, as returned by Symbol.FullSectionNumber,
+	// and the storage classes to select.
+	SectionNumbers []int32
+	StorageClasses []uint8
+
+	// Defined selects only the symbols defined in the file,
+	// and Undefined only those that are not, including
+	// common symbols, as reported by Symbol.IsUndefined.
+	Defined   bool
+	Undefined bool
+
+	// Name, if not empty, is a pattern in the syntax of
+	// path.Match that selected names must match. As there,
+	// * and ? do not match /, which Go symbols contain.
+	Name string
+}
+
+// match reports whether sym passes the filters of sf other than
+// Name, which needs the full name of the symbol.
+func (sf *SymbolFilter) match(sym *COFFSymbol, section int32) bool {
+	undefined := section == IMAGE_SYM_UNDEFINED
+	if sf.Defined && undefined || sf.Undefined && !undefined {
+		return false
+	}
+	if len(sf.SectionNumbers) > 0 {
+		found := false
+		for _, n := range sf.SectionNumbers {
+			found = found || n == section
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(sf.StorageClasses) > 0 {
+		found := false
+		for _, c := range sf.StorageClasses {
+			found = found || c == sym.StorageClass
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterSymbols is like SymbolsSeq, but only yields the symbols
+// that filter selects. The filters are applied while streaming the
+// symbol table, and the names of symbols are only decoded for those
+// that pass the other filters. A nil filter selects all symbols.
+// If filter.Name is a malformed pattern, the sequence yields a nil
+// Symbol and path.ErrBadPattern.
+func (f *File) FilterSymbols(filter *SymbolFilter) func(yield func(*Symbol, error) bool) {
+	if filter == nil {
+		filter = new(SymbolFilter)
+	}
+	return func(yield func(*Symbol, error) bool) {
+		if filter.Name != "" {
+			if err := checkPattern(filter.Name); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+		if err := checkSymbolTable(&f.FileHeader, f.symbolSize(), f.size); err != nil {
+			yield(nil, err)
+			return
+		}
+		var aux uint8
+		var symErr error
+		stopped := false
+		err := f.WalkCOFFSymbols(func(i int, sym *COFFSymbol) bool {
+			if aux > 0 {
+				aux--
+				return true
+			}
+			aux = sym.NumberOfAuxSymbols
+			section := sectionNumber(f.COFFBigSymbols, i, sym)
+			if !filter.match(sym, section) {
+				return true
+			}
+			name, err := sym.FullName(f.StringTable)
+			if err != nil {
+				symErr = err
+				return false
+			}
+			if filter.Name != "" {
+				if ok, _ := path.Match(filter.Name, name); !ok {
+					return true
+				}
+			}
+			s := &Symbol{
+				Name:         name,
+				Value:        sym.Value,
+				Type:         sym.Type,
+				StorageClass: sym.StorageClass,
+			}
+			s.setSectionNumber(section)
+			if !yield(s, nil) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if stopped {
+			return
+		}
+		if err == nil {
+			err = symErr
+		}
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// checkPattern returns path.ErrBadPattern if pattern is malformed.
+// path.Match only reports malformed patterns once it gets to them
+// while matching a name, so it cannot be used for the check.
+func checkPattern(pattern string) error {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '\\':
+			if len(pattern) < 2 {
+				return path.ErrBadPattern
+			}
+			pattern = pattern[2:]
+		case '[':
+			pattern = pattern[1:]
+			if len(pattern) > 0 && pattern[0] == '^' {
+				pattern = pattern[1:]
+			}
+			for n := 0; ; n++ {
+				if len(pattern) > 0 && pattern[0] == ']' && n > 0 {
+					pattern = pattern[1:]
+					break
+				}
+				var err error
+				if pattern, err = skipClassChar(pattern); err != nil {
+					return err
+				}
+				if pattern[0] == '-' {
+					if pattern, err = skipClassChar(pattern[1:]); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			pattern = pattern[1:]
+		}
+	}
+	return nil
+}
+
+// skipClassChar returns the rest of pattern after the character,
+// possibly escaped, that starts it inside a character class. As in
+// path.Match, the class must not end right after the character.
+func skipClassChar(pattern string) (string, error) {
+	if len(pattern) == 0 || pattern[0] == '-' || pattern[0] == ']' {
+		return "", path.ErrBadPattern
+	}
+	if pattern[0] == '\\' {
+		pattern = pattern[1:]
+		if len(pattern) == 0 {
+			return "", path.ErrBadPattern
+		}
+	}
+	r, n := utf8.DecodeRuneInString(pattern)
+	if r == utf8.RuneError && n == 1 || len(pattern) == n {
+		return "", path.ErrBadPattern
+	}
+	return pattern[n:], nil
+}
+
+// SectionsSeq returns a sequence of the sections of f,
+// as found in f.Sections.
+func (f *File) SectionsSeq() func(yield func(*Section) bool) {
+	return func(yield func(*Section) bool) {
+		for _, s := range f.Sections {
+			if !yield(s) {
+				return
+			}
+		}
+	}
+}
+
+// ImportsSeq returns a sequence of the symbols f imports,
+// in the form returned by ImportedSymbols.
+// If reading the import table fails, the sequence ends by
+// yielding an empty string and the error.
+func (f *File) ImportsSeq() func(yield func(string, error) bool) {
+	return func(yield func(string, error) bool) {
+		stopped := false
+		err := f.walkImportedSymbols(func(sym string) bool {
+			if !yield(sym, nil) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if err != nil && !stopped {
+			yield("", err)
+		}
+	}
+}
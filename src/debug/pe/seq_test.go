@@ -0,0 +1,127 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSeq(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var syms []*Symbol
+		f.SymbolsSeq()(func(s *Symbol, err error) bool {
+			if err != nil {
+				t.Errorf("%s: SymbolsSeq: %v", tt.file, err)
+				return false
+			}
+			syms = append(syms, s)
+			return true
+		})
+		if len(syms) != len(f.Symbols) || (len(syms) > 0 && !reflect.DeepEqual(syms, f.Symbols)) {
+			t.Errorf("%s: SymbolsSeq yielded %d symbols, want %d matching f.Symbols", tt.file, len(syms), len(f.Symbols))
+		}
+
+		// Stopping early must be honored.
+		n := 0
+		f.SymbolsSeq()(func(*Symbol, error) bool {
+			n++
+			return false
+		})
+		if len(f.Symbols) > 0 && n != 1 {
+			t.Errorf("%s: SymbolsSeq called yield %d times after it returned false", tt.file, n)
+		}
+
+		var sects []*Section
+		f.SectionsSeq()(func(s *Section) bool {
+			sects = append(sects, s)
+			return true
+		})
+		if !reflect.DeepEqual(sects, f.Sections) {
+			t.Errorf("%s: SectionsSeq does not match f.Sections", tt.file)
+		}
+
+		imports, err := f.ImportedSymbols()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seqImports []string
+		f.ImportsSeq()(func(s string, err error) bool {
+			if err != nil {
+				t.Errorf("%s: ImportsSeq: %v", tt.file, err)
+				return false
+			}
+			seqImports = append(seqImports, s)
+			return true
+		})
+		if !reflect.DeepEqual(seqImports, imports) {
+			t.Errorf("%s: ImportsSeq yielded %q, want %q", tt.file, seqImports, imports)
+		}
+		f.Close()
+	}
+}
+
+func TestFilterSymbols(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	filters := []struct {
+		filter *SymbolFilter
+		keep   func(*Symbol) bool
+	}{
+		{nil, func(*Symbol) bool { return true }},
+		{&SymbolFilter{SectionNumbers: []int32{1, 3}}, func(s *Symbol) bool { return s.SectionNumber == 1 || s.SectionNumber == 3 }},
+		{&SymbolFilter{StorageClasses: []uint8{IMAGE_SYM_CLASS_STATIC}}, func(s *Symbol) bool { return s.StorageClass == IMAGE_SYM_CLASS_STATIC }},
+		{&SymbolFilter{Defined: true}, func(s *Symbol) bool { return !s.IsUndefined() }},
+		{&SymbolFilter{Undefined: true, Name: "p*"}, func(s *Symbol) bool { return s.IsUndefined() && strings.HasPrefix(s.Name, "p") }},
+		{&SymbolFilter{Name: ".[dt]*", StorageClasses: []uint8{IMAGE_SYM_CLASS_STATIC}}, func(s *Symbol) bool {
+			return s.StorageClass == IMAGE_SYM_CLASS_STATIC && (strings.HasPrefix(s.Name, ".d") || strings.HasPrefix(s.Name, ".t"))
+		}},
+	}
+	for _, tt := range filters {
+		var want, got []*Symbol
+		for _, s := range f.Symbols {
+			if tt.keep(s) {
+				want = append(want, s)
+			}
+		}
+		f.FilterSymbols(tt.filter)(func(s *Symbol, err error) bool {
+			if err != nil {
+				t.Errorf("FilterSymbols(%+v): %v", tt.filter, err)
+				return false
+			}
+			got = append(got, s)
+			return true
+		})
+		if len(want) == 0 || !reflect.DeepEqual(got, want) {
+			t.Errorf("FilterSymbols(%+v) yielded %d symbols, want %d", tt.filter, len(got), len(want))
+		}
+	}
+
+	for _, pattern := range []string{"[", "x[a", "[^", "[]", "[a-", "[a-]", "a\\", "[\\"} {
+		var errs []error
+		f.FilterSymbols(&SymbolFilter{Name: pattern})(func(s *Symbol, err error) bool {
+			errs = append(errs, err)
+			return true
+		})
+		if len(errs) != 1 || errs[0] != path.ErrBadPattern {
+			t.Errorf("FilterSymbols with bad pattern %q yielded errors %v", pattern, errs)
+		}
+	}
+	for _, pattern := range []string{"*", "a?", "[a-z]*", "[^a]", "a]x", "\\*", "[\\]]"} {
+		if err := checkPattern(pattern); err != nil {
+			t.Errorf("checkPattern(%q) = %v", pattern, err)
+		}
+	}
+}
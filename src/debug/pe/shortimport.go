@@ -0,0 +1,137 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Import types of a short import object.
+const (
+	IMPORT_OBJECT_CODE  = 0
+	IMPORT_OBJECT_DATA  = 1
+	IMPORT_OBJECT_CONST = 2
+)
+
+// Import name types of a short import object, which tell the
+// linker how to derive the imported name from the symbol name.
+const (
+	IMPORT_OBJECT_ORDINAL         = 0 // import by ordinal
+	IMPORT_OBJECT_NAME            = 1 // import the symbol name
+	IMPORT_OBJECT_NAME_NOPREFIX   = 2 // strip a leading ?, @ or _
+	IMPORT_OBJECT_NAME_UNDECORATE = 3 // also truncate at the first @
+	IMPORT_OBJECT_NAME_EXPORTAS   = 4 // use the name stored after the DLL name
+)
+
+// ShortImport is a short import object (IMPORT_OBJECT_HEADER and
+// the names following it), the form import libraries use for most
+// of their members instead of a full COFF object.
+type ShortImport struct {
+	Version       uint16
+	Machine       uint16
+	TimeDateStamp uint32
+	OrdinalOrHint uint16 // ordinal for IMPORT_OBJECT_ORDINAL, hint otherwise
+	Type          uint16 // one of the IMPORT_OBJECT_CODE constants
+	NameType      uint16 // one of the IMPORT_OBJECT_ORDINAL constants
+	Symbol        string // the public symbol name the linker resolves
+	DLL           string // the DLL to import from
+	ExportName    string // the name to import, for IMPORT_OBJECT_NAME_EXPORTAS
+}
+
+// shortImportHeaderSize is the size of IMPORT_OBJECT_HEADER.
+const shortImportHeaderSize = 20
+
+// IsShortImport reports whether the data read
+// from r starts with a short import object header.
+func IsShortImport(r io.ReaderAt) bool {
+	var sig [4]byte
+	if _, err := r.ReadAt(sig[:], 0); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint16(sig[0:]) == IMAGE_FILE_MACHINE_UNKNOWN &&
+		binary.LittleEndian.Uint16(sig[2:]) == 0xffff
+}
+
+// maxShortImportData limits the size of the names
+// read from a malformed short import object.
+const maxShortImportData = 64 << 10
+
+// NewShortImport parses the short import object read from r.
+func NewShortImport(r io.ReaderAt) (*ShortImport, error) {
+	var hdr [shortImportHeaderSize]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, formatError(0, "import object header", err)
+	}
+	if binary.LittleEndian.Uint16(hdr[0:]) != 0 || binary.LittleEndian.Uint16(hdr[2:]) != 0xffff {
+		return nil, &FormatError{0, "import object header", ErrBadMagic, hdr[0:4]}
+	}
+	types := binary.LittleEndian.Uint16(hdr[18:])
+	imp := &ShortImport{
+		Version:       binary.LittleEndian.Uint16(hdr[4:]),
+		Machine:       binary.LittleEndian.Uint16(hdr[6:]),
+		TimeDateStamp: binary.LittleEndian.Uint32(hdr[8:]),
+		OrdinalOrHint: binary.LittleEndian.Uint16(hdr[16:]),
+		Type:          types & 3,
+		NameType:      types >> 2 & 7,
+	}
+	size := binary.LittleEndian.Uint32(hdr[12:])
+	if size > maxShortImportData {
+		return nil, &FormatError{12, "import object data", ErrOutOfBounds, size}
+	}
+	data := make([]byte, size)
+	if n, err := r.ReadAt(data, shortImportHeaderSize); n < len(data) {
+		return nil, formatError(shortImportHeaderSize, "import object data", err)
+	}
+	// The data holds the symbol name, the DLL name
+	// and, for IMPORT_OBJECT_NAME_EXPORTAS, the export name,
+	// each NUL-terminated.
+	names := strings.SplitN(string(data), "\x00", 4)
+	if len(names) < 3 {
+		return nil, &FormatError{shortImportHeaderSize, "import object data", ErrTruncated, nil}
+	}
+	imp.Symbol, imp.DLL = names[0], names[1]
+	if imp.NameType == IMPORT_OBJECT_NAME_EXPORTAS {
+		if len(names) < 4 {
+			return nil, &FormatError{shortImportHeaderSize, "import object data", ErrTruncated, nil}
+		}
+		imp.ExportName = names[2]
+	}
+	return imp, nil
+}
+
+// Name returns the name imported from the DLL, as the linker
+// derives it from the symbol name, or the empty string for
+// imports by ordinal.
+func (imp *ShortImport) Name() string {
+	name := imp.Symbol
+	switch imp.NameType {
+	case IMPORT_OBJECT_ORDINAL:
+		return ""
+	case IMPORT_OBJECT_NAME_EXPORTAS:
+		return imp.ExportName
+	case IMPORT_OBJECT_NAME_NOPREFIX, IMPORT_OBJECT_NAME_UNDECORATE:
+		if name != "" && (name[0] == '?' || name[0] == '@' || name[0] == '_') {
+			name = name[1:]
+		}
+		if imp.NameType == IMPORT_OBJECT_NAME_UNDECORATE {
+			if i := strings.Index(name, "@"); i >= 0 {
+				name = name[:i]
+			}
+		}
+	}
+	return name
+}
+
+// IsShortImport reports whether the member is a short import object.
+func (m *ArchiveMember) IsShortImport() bool {
+	return IsShortImport(m.sr)
+}
+
+// ShortImport parses the member as a short import object.
+func (m *ArchiveMember) ShortImport() (*ShortImport, error) {
+	return NewShortImport(m.sr)
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"io"
+	"sort"
+	"strconv"
+)
+
+// A SlackKind is a kind of SlackRegion.
+type SlackKind int
+
+const (
+	// SlackSectionTail holds the raw data of a section past its
+	// VirtualSize, up to SizeOfRawData: the padding to the file
+	// alignment, which the loader maps along with the section.
+	SlackSectionTail SlackKind = iota
+
+	// SlackHeaders holds the bytes of the headers after the
+	// section table, up to SizeOfHeaders, which are mapped
+	// at the start of the image.
+	SlackHeaders
+
+	// SlackGap holds bytes of the file before the overlay that
+	// no header accounts for, such as padding between sections.
+	// They are not mapped.
+	SlackGap
+)
+
+var slackKindNames = [...]string{
+	"section tail",
+	"headers",
+	"gap",
+}
+
+func (k SlackKind) String() string {
+	if k >= 0 && int(k) < len(slackKindNames) {
+		return slackKindNames[k]
+	}
+	return "SlackKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A SlackRegion is a range of a file that holds no data the
+// headers describe, where code caves and hidden data are found.
+type SlackRegion struct {
+	Region
+	Kind    SlackKind
+	Section *Section // the section concerned, or nil if none
+
+	// RVA is the relative virtual address the region is
+	// loaded at, or 0 if the loader does not map it.
+	RVA uint32
+
+	sr *io.SectionReader
+}
+
+// Open returns a new ReadSeeker reading the bytes of s.
+func (s *SlackRegion) Open() io.ReadSeeker {
+	return io.NewSectionReader(s.sr, 0, 1<<63-1)
+}
+
+// Data reads and returns the bytes of s.
+func (s *SlackRegion) Data() ([]byte, error) {
+	b := make([]byte, s.sr.Size())
+	n, err := s.sr.ReadAt(b, 0)
+	if n == len(b) {
+		err = nil
+	}
+	return b[:n], err
+}
+
+// SlackRegions returns the slack space of the file f, in order of
+// offset: the tails of the raw data of sections past their virtual
+// sizes, the rest of the headers after the section table, and the
+// gaps between the regions found by FileRegions. Empty regions are
+// left out. Like FileRegions, SlackRegions fails if the size of the
+// file is not known or if f was created by NewFileFromImage.
+func (f *File) SlackRegions() ([]SlackRegion, error) {
+	regions, err := f.FileRegions()
+	if err != nil {
+		return nil, err
+	}
+	var slack []SlackRegion
+	add := func(kind SlackKind, s *Section, off, end int64, rva uint32) {
+		if end > f.size {
+			end = f.size
+		}
+		if off < end {
+			slack = append(slack, SlackRegion{
+				Region:  Region{off, end - off},
+				Kind:    kind,
+				Section: s,
+				RVA:     rva,
+				sr:      io.NewSectionReader(f.r, off, end-off),
+			})
+		}
+	}
+	if oh := f.optionalHeader(); oh != nil {
+		start := f.HeaderLayout().SectionTable.End()
+		add(SlackHeaders, nil, start, int64(oh.sizeOfHeaders), uint32(start))
+	}
+	for _, s := range f.Sections {
+		if s.Offset == 0 || s.VirtualSize == 0 || s.VirtualSize >= s.Size {
+			continue
+		}
+		var rva uint32
+		if f.OptionalHeader != nil {
+			rva = s.VirtualAddress + s.VirtualSize
+		}
+		add(SlackSectionTail, s, int64(s.Offset)+int64(s.VirtualSize), int64(s.Offset)+int64(s.Size), rva)
+	}
+	for _, r := range regions {
+		if r.Kind == RegionGap {
+			add(SlackGap, nil, r.Offset, r.End(), 0)
+		}
+	}
+	sort.Stable(slackOrder(slack))
+	return slack, nil
+}
+
+// slackOrder sorts slack regions by offset.
+type slackOrder []SlackRegion
+
+func (r slackOrder) Len() int           { return len(r) }
+func (r slackOrder) Less(i, j int) bool { return r[i].Offset < r[j].Offset }
+func (r slackOrder) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
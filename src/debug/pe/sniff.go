@@ -0,0 +1,231 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// SniffInfo summarizes the headers of a PE image or COFF object
+// file, as read by Sniff.
+type SniffInfo struct {
+	FileHeader
+
+	// Image reports whether the file has an optional header,
+	// as images do. The fields up to DataDirectory are those
+	// of the optional header, and are zero if it has none.
+	Image               bool
+	PE64                bool
+	AddressOfEntryPoint uint32
+	ImageBase           uint64
+	SizeOfImage         uint32
+	SizeOfHeaders       uint32
+	Subsystem           uint16
+	DllCharacteristics  uint16
+	DataDirectory       []DataDirectory // at most 16 entries
+
+	Sections []SectionHeader // with long names left as "/123"
+
+	// HeaderSize is the number of bytes read from the stream,
+	// up to the end of the section table.
+	HeaderSize int64
+
+	// MinSize is the size the file must at least have to hold
+	// everything its headers refer to: the raw data and the
+	// relocations of the sections, the symbol table and the
+	// certificate table.
+	MinSize int64
+}
+
+// HasDirectory reports whether the data directory i
+// of the file s describes is present.
+func (s *SniffInfo) HasDirectory(i int) bool {
+	return i >= 0 && i < len(s.DataDirectory) && s.DataDirectory[i].VirtualAddress != 0
+}
+
+// maxSniffStub limits the size of the MS-DOS stub Sniff reads.
+const maxSniffStub = 1 << 20
+
+// Sniff reads the headers of a PE image or COFF object file from the
+// start of r, through the section table, and summarizes them. Unlike
+// NewFile, it needs no random access and reads nothing past the
+// headers, so that a file can be classified as it is received.
+// Sniff does not check that the headers are consistent with each
+// other or with the rest of the file. It does not handle TE images,
+// big object files or import objects. As with NewFile, inputs that
+// are not PE images or COFF object files at all fail with a
+// *NotPEError.
+func Sniff(r io.Reader) (*SniffInfo, error) {
+	h := &sniffer{r: r}
+	if err := h.need(0, 4, "file header"); err != nil {
+		return nil, err
+	}
+	if isTE(h.b) || isImportOrAnon(h.b) {
+		return nil, errors.New("pe: Sniff does not support TE images, big object files or import objects")
+	}
+	var base int64
+	if h.b[0] == 'M' && h.b[1] == 'Z' {
+		if err := h.need(0, dosHeaderSize, "MS-DOS header"); err != nil {
+			return nil, err
+		}
+		signoff := int64(binary.LittleEndian.Uint32(h.b[0x3c:]))
+		if signoff > maxSniffStub {
+			return nil, &FormatError{0x3c, "MS-DOS header", ErrOutOfBounds, signoff}
+		}
+		if err := h.need(signoff, 4, "PE signature"); err != nil {
+			return nil, err
+		}
+		if sign := h.b[signoff : signoff+4]; string(sign) != "PE\x00\x00" {
+			return nil, notPESignature(sign)
+		}
+		base = signoff + 4
+	} else if !knownMachine(binary.LittleEndian.Uint16(h.b)) {
+		err := h.need(0, int64(len(archiveMagic)), "file header")
+		if err == nil && string(h.b[:len(archiveMagic)]) == archiveMagic {
+			return nil, &NotPEError{Kind: NotPEArchive}
+		}
+		return nil, &NotPEError{Kind: NotPEUnrecognized}
+	}
+	if err := h.need(base, 20, "COFF file header"); err != nil {
+		return nil, err
+	}
+	s := new(SniffInfo)
+	if err := decodeLE(h.b[base:base+20], &s.FileHeader, "COFF file header"); err != nil {
+		return nil, err
+	}
+
+	ohoff := base + 20
+	if n := int64(s.SizeOfOptionalHeader); n > 0 {
+		if err := h.need(ohoff, n, "optional header"); err != nil {
+			return nil, err
+		}
+		if err := s.decodeOptionalHeader(h.b[ohoff:ohoff+n], ohoff); err != nil {
+			return nil, err
+		}
+	}
+
+	sectab := ohoff + int64(s.SizeOfOptionalHeader)
+	if err := h.need(sectab, 40*int64(s.NumberOfSections), "section table"); err != nil {
+		return nil, err
+	}
+	s.HeaderSize = h.n
+	s.MinSize = h.n
+	grow := func(end int64) {
+		if end > s.MinSize {
+			s.MinSize = end
+		}
+	}
+	if s.Image {
+		grow(int64(s.SizeOfHeaders))
+	}
+	s.Sections = make([]SectionHeader, s.NumberOfSections)
+	for i := range s.Sections {
+		var sh SectionHeader32
+		decodeSectionHeader(h.b[sectab+40*int64(i):], &sh)
+		s.Sections[i] = SectionHeader{
+			Name:                 cstring(sh.Name[:]),
+			VirtualSize:          sh.VirtualSize,
+			VirtualAddress:       sh.VirtualAddress,
+			Size:                 sh.SizeOfRawData,
+			Offset:               sh.PointerToRawData,
+			PointerToRelocations: sh.PointerToRelocations,
+			PointerToLineNumbers: sh.PointerToLineNumbers,
+			NumberOfRelocations:  sh.NumberOfRelocations,
+			NumberOfLineNumbers:  sh.NumberOfLineNumbers,
+			Characteristics:      sh.Characteristics,
+		}
+		if sh.PointerToRawData != 0 {
+			grow(int64(sh.PointerToRawData) + int64(sh.SizeOfRawData))
+		}
+		if sh.PointerToRelocations != 0 {
+			grow(int64(sh.PointerToRelocations) + 10*int64(sh.NumberOfRelocations))
+		}
+	}
+	if s.PointerToSymbolTable != 0 {
+		// The string table follows the symbols
+		// and starts with its 4-byte size.
+		grow(int64(s.PointerToSymbolTable) + COFFSymbolSize*int64(s.NumberOfSymbols) + 4)
+	}
+	if s.HasDirectory(IMAGE_DIRECTORY_ENTRY_SECURITY) {
+		// The certificate table is located by file offset.
+		dd := s.DataDirectory[IMAGE_DIRECTORY_ENTRY_SECURITY]
+		grow(int64(dd.VirtualAddress) + int64(dd.Size))
+	}
+	return s, nil
+}
+
+// decodeOptionalHeader sets the fields of s from the optional
+// header b, found at file offset off.
+func (s *SniffInfo) decodeOptionalHeader(b []byte, off int64) error {
+	if len(b) < 2 {
+		return &FormatError{off, "optional header", ErrTruncated, len(b)}
+	}
+	var dirs int // offset of the data directories
+	switch magic := binary.LittleEndian.Uint16(b); magic {
+	case 0x10b:
+		dirs = 96
+	case 0x20b:
+		dirs = 112
+		s.PE64 = true
+	default:
+		return &FormatError{off, "optional header", ErrBadMagic, magic}
+	}
+	if len(b) < dirs {
+		return &FormatError{off, "optional header", ErrTruncated, len(b)}
+	}
+	s.Image = true
+	s.AddressOfEntryPoint = binary.LittleEndian.Uint32(b[16:])
+	if s.PE64 {
+		s.ImageBase = binary.LittleEndian.Uint64(b[24:])
+	} else {
+		s.ImageBase = uint64(binary.LittleEndian.Uint32(b[28:]))
+	}
+	s.SizeOfImage = binary.LittleEndian.Uint32(b[56:])
+	s.SizeOfHeaders = binary.LittleEndian.Uint32(b[60:])
+	s.Subsystem = binary.LittleEndian.Uint16(b[68:])
+	s.DllCharacteristics = binary.LittleEndian.Uint16(b[70:])
+	n := int64(binary.LittleEndian.Uint32(b[dirs-4:]))
+	if n > 16 {
+		n = 16
+	}
+	if k := int64(len(b)-dirs) / 8; n > k {
+		n = k
+	}
+	s.DataDirectory = make([]DataDirectory, n)
+	for i := range s.DataDirectory {
+		d := b[dirs+8*i:]
+		s.DataDirectory[i] = DataDirectory{
+			VirtualAddress: binary.LittleEndian.Uint32(d[0:]),
+			Size:           binary.LittleEndian.Uint32(d[4:]),
+		}
+	}
+	return nil
+}
+
+// A sniffer reads the start of a stream into b as needed.
+type sniffer struct {
+	r io.Reader
+	b []byte
+	n int64 // len(b)
+}
+
+// need reads the stream up to the end of what, the size bytes at
+// offset off, failing with a FormatError if it ends before that.
+func (h *sniffer) need(off, size int64, what string) error {
+	end := off + size
+	if end <= h.n {
+		return nil
+	}
+	b := make([]byte, end-h.n)
+	k, err := io.ReadFull(h.r, b)
+	h.b = append(h.b, b[:k]...)
+	h.n += int64(k)
+	if err != nil {
+		return formatError(off, what, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSniff(t *testing.T) {
+	for _, tt := range fileTests {
+		data, err := ioutil.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := NewFile(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := Sniff(iotest.OneByteReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Errorf("%s: Sniff: %v", tt.file, err)
+			continue
+		}
+		if s.FileHeader != f.FileHeader || s.HeaderSize != f.HeaderLayout().SectionTable.End() ||
+			s.MinSize < s.HeaderSize || s.MinSize > int64(len(data)) {
+			t.Errorf("%s: Sniff = %+v", tt.file, s)
+		}
+		if oh := f.optionalHeader(); oh != nil {
+			if !s.Image || s.PE64 != oh.pe64 || s.ImageBase != oh.imageBase || s.SizeOfImage != oh.sizeOfImage ||
+				s.Subsystem != oh.subsystem || len(s.DataDirectory) != int(oh.numberOfRvaAndSizes) {
+				t.Errorf("%s: Sniff = %+v, want optional header %+v", tt.file, s, oh)
+			}
+			for i := range s.DataDirectory {
+				if s.HasDirectory(i) != (oh.dataDirectory(i).VirtualAddress != 0) {
+					t.Errorf("%s: HasDirectory(%d) = %v", tt.file, i, s.HasDirectory(i))
+				}
+			}
+		} else if s.Image {
+			t.Errorf("%s: Sniff found an optional header", tt.file)
+		}
+		if len(s.Sections) != len(f.Sections) {
+			t.Fatalf("%s: %d sections, want %d", tt.file, len(s.Sections), len(f.Sections))
+		}
+		for i, sh := range s.Sections {
+			want := f.Sections[i].SectionHeader
+			if sh.Name[0] == '/' {
+				sh.Name = want.Name // long names are left unresolved
+			}
+			if sh != want {
+				t.Errorf("%s: section %d = %+v, want %+v", tt.file, i, sh, want)
+			}
+		}
+
+		// Sniff reads the headers and nothing more.
+		if _, err := Sniff(io.LimitReader(bytes.NewReader(data), s.HeaderSize)); err != nil {
+			t.Errorf("%s: Sniff of the headers: %v", tt.file, err)
+		}
+		_, err = Sniff(bytes.NewReader(data[:s.HeaderSize-1]))
+		if e, ok := err.(*FormatError); !ok || e.Err != ErrTruncated {
+			t.Errorf("%s: Sniff of truncated headers: %v, want ErrTruncated", tt.file, err)
+		}
+	}
+}
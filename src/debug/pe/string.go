@@ -5,9 +5,10 @@
 package pe
 
 import (
+	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
+	"io/ioutil"
 )
 
 // cstring converts ASCII byte sequence b to string.
@@ -22,45 +23,213 @@ func cstring(b []byte) string {
 // StringTable is a COFF string table.
 type StringTable []byte
 
-func readStringTable(fh *FileHeader, r io.ReadSeeker) (StringTable, error) {
+// readStringTable reads the string table that follows the symbol
+// table described by fh, made of records of recSize bytes, from r.
+// size is the size of the file, or -1 if it is not known.
+func readStringTable(fh *FileHeader, recSize int64, ra io.ReaderAt, size int64) (StringTable, error) {
 	// COFF string table is located right after COFF symbol table.
 	if fh.PointerToSymbolTable <= 0 {
 		return nil, nil
 	}
-	offset := fh.PointerToSymbolTable + COFFSymbolSize*fh.NumberOfSymbols
-	_, err := r.Seek(int64(offset), seekStart)
-	if err != nil {
-		return nil, fmt.Errorf("fail to seek to string table: %v", err)
-	}
+	offset := int64(fh.PointerToSymbolTable) + recSize*int64(fh.NumberOfSymbols)
+	r := io.NewSectionReader(ra, offset, 1<<63-1-offset)
 	var l uint32
-	err = binary.Read(r, binary.LittleEndian, &l)
+	err := binary.Read(r, binary.LittleEndian, &l)
 	if err != nil {
-		return nil, fmt.Errorf("fail to read string table length: %v", err)
+		return nil, formatError(offset, "string table length", err)
 	}
 	// string table length includes itself
 	if l <= 4 {
 		return nil, nil
 	}
 	l -= 4
-	buf := make([]byte, l)
-	_, err = io.ReadFull(r, buf)
-	if err != nil {
-		return nil, fmt.Errorf("fail to read string table: %v", err)
+	// The length comes from the file, so do not trust it for
+	// allocation: cap it by the file size if known, and read
+	// incrementally otherwise.
+	if size >= 0 && int64(l) > size-offset-4 {
+		n := size - offset - 4
+		if n < 0 {
+			n = 0
+		}
+		buf := make([]byte, n)
+		n2, _ := io.ReadFull(r, buf)
+		// Return what was read for recovery mode.
+		return StringTable(buf[:n2]), &FormatError{offset, "string table", ErrOutOfBounds, l}
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(r, int64(l)))
+	// On 32-bit hosts int(l) may be negative, so compare as int64.
+	if err != nil || int64(len(buf)) < int64(l) {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		// Return what was read for recovery mode.
+		return StringTable(buf), formatError(offset, "string table", err)
 	}
 	return StringTable(buf), nil
 }
 
+// sliceStringTable is like readStringTable for a file held in
+// data, but returns a slice of data rather than a copy.
+func sliceStringTable(fh *FileHeader, recSize int64, data []byte) (StringTable, error) {
+	if fh.PointerToSymbolTable <= 0 {
+		return nil, nil
+	}
+	offset := int64(fh.PointerToSymbolTable) + recSize*int64(fh.NumberOfSymbols)
+	if offset < 0 || offset > int64(len(data))-4 {
+		return nil, formatError(offset, "string table length", io.ErrUnexpectedEOF)
+	}
+	l := binary.LittleEndian.Uint32(data[offset:])
+	if l <= 4 {
+		return nil, nil
+	}
+	l -= 4
+	start := offset + 4
+	if int64(l) > int64(len(data))-start {
+		// Return what is there for recovery mode.
+		return StringTable(data[start:len(data):len(data)]), &FormatError{offset, "string table", ErrOutOfBounds, l}
+	}
+	end := start + int64(l)
+	// Limit the capacity, so that appending to
+	// the table does not overwrite data.
+	return StringTable(data[start:end:end]), nil
+}
+
 // TODO(brainman): decide if start parameter should be int instead of uint32
 
 // String extracts string from COFF string table st at offset start.
 func (st StringTable) String(start uint32) (string, error) {
 	// start includes 4 bytes of string table length
 	if start < 4 {
-		return "", fmt.Errorf("offset %d is before the start of string table", start)
+		return "", &FormatError{-1, "string table", ErrOutOfBounds, start}
 	}
-	start -= 4
-	if int(start) > len(st) {
-		return "", fmt.Errorf("offset %d is beyond the end of string table", start)
+	if int64(start)-4 > int64(len(st)) {
+		return "", &FormatError{-1, "string table", ErrOutOfBounds, start}
 	}
+	start -= 4
 	return cstring(st[start:]), nil
 }
+
+// Walk calls fn for every string of st, in order, with its offset,
+// which, as for String, counts the 4 bytes of the length field that
+// precedes the table in the file. Iteration stops early if fn returns
+// false. An unterminated string at the end of st is ignored.
+func (st StringTable) Walk(fn func(off uint32, s string) bool) {
+	for i := 0; i < len(st); {
+		n := bytes.IndexByte(st[i:], 0)
+		if n < 0 {
+			return
+		}
+		if !fn(uint32(i)+4, string(st[i:i+n])) {
+			return
+		}
+		i += n + 1
+	}
+}
+
+// Offset returns the offset of the string s in st, in the form
+// String takes, and whether st holds s. Only whole strings are
+// found, not the tails of longer ones.
+func (st StringTable) Offset(s string) (uint32, bool) {
+	i := st.index(s)
+	if i < 0 {
+		return 0, false
+	}
+	return uint32(i) + 4, true
+}
+
+// A StringTableBuilder builds a COFF string table, storing each
+// string once. The zero value is an empty table ready to use.
+type StringTableBuilder struct {
+	st   StringTable
+	offs map[string]uint32
+}
+
+// NewStringTableBuilder returns a StringTableBuilder that extends
+// a copy of st, so that strings already in st keep their offsets.
+func NewStringTableBuilder(st StringTable) *StringTableBuilder {
+	b := &StringTableBuilder{
+		st:   append(StringTable(nil), st...),
+		offs: make(map[string]uint32),
+	}
+	st.Walk(func(off uint32, s string) bool {
+		if _, ok := b.offs[s]; !ok {
+			b.offs[s] = off
+		}
+		return true
+	})
+	if n := len(b.st); n > 0 && b.st[n-1] != 0 {
+		// Terminate a truncated last string so that
+		// it does not run into the next one added.
+		b.st = append(b.st, 0)
+	}
+	return b
+}
+
+// Add adds s to the table, unless it holds s already,
+// and returns the offset of s, in the form String takes.
+func (b *StringTableBuilder) Add(s string) uint32 {
+	if off, ok := b.offs[s]; ok {
+		return off
+	}
+	if b.offs == nil {
+		b.offs = make(map[string]uint32)
+	}
+	off := uint32(len(b.st)) + 4
+	b.st = append(b.st, s...)
+	b.st = append(b.st, 0)
+	b.offs[s] = off
+	return off
+}
+
+// StringTable returns the table built so far. Its
+// contents change as strings are added to b.
+func (b *StringTableBuilder) StringTable() StringTable {
+	return b.st
+}
+
+// A StringCache looks up strings in a StringTable, decoding each
+// offset only once. Symbols of big object files often share long
+// names, such as those of COMDAT sections, which then also share
+// a single Go string. A StringCache is not safe for concurrent use.
+type StringCache struct {
+	st StringTable
+	m  map[uint32]string
+}
+
+// NewStringCache returns an empty StringCache for st.
+func NewStringCache(st StringTable) *StringCache {
+	return &StringCache{st: st, m: make(map[uint32]string)}
+}
+
+// Preload decodes all strings of the table up front, in a single
+// pass, which is faster than decoding them one at a time when most
+// of them are looked up. Offsets into the middle of a string, which
+// linkers use to share suffixes, are still decoded on first use.
+func (c *StringCache) Preload() {
+	c.st.Walk(func(off uint32, s string) bool {
+		c.m[off] = s
+		return true
+	})
+}
+
+// String is like StringTable.String, but remembers the result.
+func (c *StringCache) String(off uint32) (string, error) {
+	if s, ok := c.m[off]; ok {
+		return s, nil
+	}
+	s, err := c.st.String(off)
+	if err != nil {
+		return "", err
+	}
+	c.m[off] = s
+	return s, nil
+}
+
+// SymbolName is like sym.FullName, but looks up
+// long names in c rather than in the table itself.
+func (c *StringCache) SymbolName(sym *COFFSymbol) (string, error) {
+	if ok, off := isSymNameOffset(sym.Name); ok {
+		return c.String(off)
+	}
+	return cstring(sym.Name[:]), nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestStringTable(t *testing.T) {
+	st := StringTable("first\x00second\x00\x00third\x00trunc")
+	type entry struct {
+		off uint32
+		s   string
+	}
+	var got []entry
+	st.Walk(func(off uint32, s string) bool {
+		got = append(got, entry{off, s})
+		return true
+	})
+	want := []entry{{4, "first"}, {10, "second"}, {17, ""}, {18, "third"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk found %v, want %v", got, want)
+	}
+	for _, e := range want {
+		if s, err := st.String(e.off); s != e.s || err != nil {
+			t.Errorf("String(%d) = %q, %v; want %q", e.off, s, err, e.s)
+		}
+		if off, ok := st.Offset(e.s); e.s != "" && (off != e.off || !ok) {
+			t.Errorf("Offset(%q) = %d, %v; want %d", e.s, off, ok, e.off)
+		}
+	}
+	if _, ok := st.Offset("cond"); ok {
+		t.Errorf("Offset found the tail of a string")
+	}
+
+	b := NewStringTableBuilder(st)
+	if off := b.Add("second"); off != 10 {
+		t.Errorf("Add of an existing string = %d, want 10", off)
+	}
+	off := b.Add("fourth")
+	if off2 := b.Add("fourth"); off2 != off {
+		t.Errorf("adding a string twice gave offsets %d and %d", off, off2)
+	}
+	nst := b.StringTable()
+	if s, err := nst.String(off); s != "fourth" || err != nil {
+		t.Errorf("String(%d) of the built table = %q, %v; want fourth", off, s, err)
+	}
+	if s, _ := nst.String(24); s != "trunc" {
+		t.Errorf("truncated string became %q", s)
+	}
+	if string(st) != "first\x00second\x00\x00third\x00trunc" {
+		t.Errorf("building changed the original table")
+	}
+
+	var zero StringTableBuilder
+	if off := zero.Add("x"); off != 4 || string(zero.StringTable()) != "x\x00" {
+		t.Errorf("zero builder: Add = %d, table %q", off, zero.StringTable())
+	}
+}
+
+func TestStringCache(t *testing.T) {
+	st := StringTable("first\x00second\x00")
+	for _, preload := range []bool{false, true} {
+		c := NewStringCache(st)
+		if preload {
+			c.Preload()
+		}
+		// Offset 13 is the tail "cond" of "second".
+		for _, off := range []uint32{4, 10, 13, 4, 13} {
+			want, werr := st.String(off)
+			got, err := c.String(off)
+			if got != want || err != werr {
+				t.Errorf("String(%d) = %q, %v; want %q, %v", off, got, err, want, werr)
+			}
+		}
+		if _, err := c.String(100); err == nil {
+			t.Errorf("String(100) succeeded")
+		}
+		sym := COFFSymbol{}
+		binary.LittleEndian.PutUint32(sym.Name[4:], 10)
+		if s, err := c.SymbolName(&sym); s != "second" || err != nil {
+			t.Errorf("SymbolName = %q, %v; want %q", s, err, "second")
+		}
+	}
+}
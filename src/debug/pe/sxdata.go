@@ -0,0 +1,76 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Flags in the value of the @feat.00 symbol of an object file, which
+// tells the linker what features the compiler or assembler used.
+const (
+	FEAT00_SAFESEH      = 0x1    // the .sxdata section lists all exception handlers
+	FEAT00_GUARDCF      = 0x800  // compiled with /guard:cf
+	FEAT00_GUARD_EHCONT = 0x4000 // compiled with /guard:ehcont
+)
+
+// Feat00 returns the value of the absolute symbol @feat.00 of the
+// object file f, a set of FEAT00_* flags, and whether f has one.
+func (f *File) Feat00() (uint32, bool, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return 0, false, err
+	}
+	for _, s := range f.Symbols {
+		if s.Name == "@feat.00" && s.IsAbsolute() {
+			return s.Value, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// SafeSEHHandlers returns the indexes in f.COFFSymbols of the
+// exception handlers that the .sxdata section of the 32-bit x86
+// object file f registers, in order. The linker lists them in the
+// SEHandlerTable of the image when all objects have FEAT00_SAFESEH
+// set. SymbolByIndex returns the symbols of the indexes. It returns
+// none if f has no .sxdata section.
+func (f *File) SafeSEHHandlers() ([]uint32, error) {
+	s := f.Section(".sxdata")
+	if s == nil {
+		return nil, nil
+	}
+	return f.symbolIndexes(s)
+}
+
+// symbolIndexes decodes section s of f, which holds the indexes in
+// f.COFFSymbols of symbols, as 32-bit little-endian integers.
+func (f *File) symbolIndexes(s *Section) ([]uint32, error) {
+	b, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%4 != 0 {
+		return nil, &FormatError{int64(s.Offset), s.Name + " section", errors.New("size is not a multiple of 4"), len(b)}
+	}
+	if err := f.ensureSymbols(); err != nil {
+		return nil, err
+	}
+	// Mark the symbol records, as opposed to auxiliary records,
+	// rather than calling checkSymbolIndex for each entry.
+	isSym := make([]bool, len(f.COFFSymbols))
+	for i := 0; i < len(f.COFFSymbols); i += 1 + int(f.COFFSymbols[i].NumberOfAuxSymbols) {
+		isSym[i] = true
+	}
+	idx := make([]uint32, 0, len(b)/4)
+	for i := 0; i < len(b); i += 4 {
+		n := binary.LittleEndian.Uint32(b[i:])
+		if uint64(n) >= uint64(len(isSym)) || !isSym[n] {
+			return nil, &FormatError{int64(s.Offset) + int64(i), s.Name + " entry", errors.New("not a symbol index"), n}
+		}
+		idx = append(idx, n)
+	}
+	return idx, nil
+}
@@ -6,6 +6,7 @@ package pe
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
@@ -22,21 +23,120 @@ type COFFSymbol struct {
 	NumberOfAuxSymbols uint8
 }
 
-func readCOFFSymbols(fh *FileHeader, r io.ReadSeeker) ([]COFFSymbol, error) {
+// checkSymbolTable verifies that the symbol table described by fh,
+// made of records of recSize bytes, fits in a file of the given size.
+// A negative size means the size is unknown, in which case the check
+// is skipped.
+func checkSymbolTable(fh *FileHeader, recSize, size int64) error {
+	if fh.PointerToSymbolTable == 0 || size < 0 {
+		return nil
+	}
+	end := int64(fh.PointerToSymbolTable) + int64(fh.NumberOfSymbols)*recSize
+	if end > size {
+		return &FormatError{int64(fh.PointerToSymbolTable), "symbol table", ErrOutOfBounds, fh.NumberOfSymbols}
+	}
+	return nil
+}
+
+// decodeCOFFSymbol decodes the COFFSymbolSize bytes of b into sym.
+// It is much faster than binary.Read, which relies on reflection.
+func decodeCOFFSymbol(b []byte, sym *COFFSymbol) {
+	copy(sym.Name[:], b[0:8])
+	sym.Value = binary.LittleEndian.Uint32(b[8:12])
+	sym.SectionNumber = int16(binary.LittleEndian.Uint16(b[12:14]))
+	sym.Type = binary.LittleEndian.Uint16(b[14:16])
+	sym.StorageClass = b[16]
+	sym.NumberOfAuxSymbols = b[17]
+}
+
+// encodeCOFFSymbol encodes sym into the COFFSymbolSize bytes of b.
+func encodeCOFFSymbol(b []byte, sym *COFFSymbol) {
+	copy(b[0:8], sym.Name[:])
+	binary.LittleEndian.PutUint32(b[8:12], sym.Value)
+	binary.LittleEndian.PutUint16(b[12:14], uint16(sym.SectionNumber))
+	binary.LittleEndian.PutUint16(b[14:16], sym.Type)
+	b[16] = sym.StorageClass
+	b[17] = sym.NumberOfAuxSymbols
+}
+
+// readCOFFSymbolChunk reads len(syms) COFF symbol records from r into
+// syms, using buf, which must be at least len(syms)*COFFSymbolSize
+// bytes long, as scratch space.
+func readCOFFSymbolChunk(r io.Reader, buf []byte, syms []COFFSymbol) error {
+	buf = buf[:len(syms)*COFFSymbolSize]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return formatError(-1, "symbol table", err)
+	}
+	for i := range syms {
+		decodeCOFFSymbol(buf[i*COFFSymbolSize:], &syms[i])
+	}
+	return nil
+}
+
+// symbolCount returns fh.NumberOfSymbols as an int. On 32-bit
+// hosts, counts that do not fit are an error rather than negative.
+func symbolCount(fh *FileHeader) (int, error) {
+	n := int(fh.NumberOfSymbols)
+	if n < 0 || uint64(n) != uint64(fh.NumberOfSymbols) {
+		return 0, &FormatError{int64(fh.PointerToSymbolTable), "symbol table", errors.New("too many symbols for this host"), fh.NumberOfSymbols}
+	}
+	return n, nil
+}
+
+func readCOFFSymbols(fh *FileHeader, r io.ReaderAt, size int64) ([]COFFSymbol, error) {
 	if fh.PointerToSymbolTable == 0 {
 		return nil, nil
 	}
 	if fh.NumberOfSymbols <= 0 {
 		return nil, nil
 	}
-	_, err := r.Seek(int64(fh.PointerToSymbolTable), seekStart)
+	if err := checkSymbolTable(fh, COFFSymbolSize, size); err != nil {
+		return nil, err
+	}
+	sr := io.NewSectionReader(r, int64(fh.PointerToSymbolTable), int64(fh.NumberOfSymbols)*COFFSymbolSize)
+	n, err := symbolCount(fh)
 	if err != nil {
-		return nil, fmt.Errorf("fail to seek to symbol table: %v", err)
+		return nil, err
+	}
+	var syms []COFFSymbol
+	if size >= 0 {
+		// NumberOfSymbols has been checked against the file size.
+		syms = make([]COFFSymbol, 0, n)
+	}
+	// Read the table in chunks. If the file size is unknown,
+	// NumberOfSymbols could not be checked up front, and growing
+	// syms as data arrives means a bogus count fails once the data
+	// runs out rather than causing a huge allocation.
+	buf := make([]byte, walkChunk*COFFSymbolSize)
+	for len(syms) < n {
+		chunk := n - len(syms)
+		if chunk > walkChunk {
+			chunk = walkChunk
+		}
+		i := len(syms)
+		syms = append(syms, make([]COFFSymbol, chunk)...)
+		if err := readCOFFSymbolChunk(sr, buf, syms[i:]); err != nil {
+			// Return the records read so far for recovery mode.
+			return syms[:i], err
+		}
+	}
+	return syms, nil
+}
+
+// decodeCOFFSymbols is like readCOFFSymbols,
+// but decodes the symbols directly from data,
+// which holds the whole file.
+func decodeCOFFSymbols(fh *FileHeader, data []byte) ([]COFFSymbol, error) {
+	if fh.PointerToSymbolTable == 0 || fh.NumberOfSymbols == 0 {
+		return nil, nil
+	}
+	if err := checkSymbolTable(fh, COFFSymbolSize, int64(len(data))); err != nil {
+		return nil, err
 	}
+	b := data[fh.PointerToSymbolTable:]
 	syms := make([]COFFSymbol, fh.NumberOfSymbols)
-	err = binary.Read(r, binary.LittleEndian, syms)
-	if err != nil {
-		return nil, fmt.Errorf("fail to read symbol table: %v", err)
+	for i := range syms {
+		decodeCOFFSymbol(b[i*COFFSymbolSize:], &syms[i])
 	}
 	return syms, nil
 }
@@ -59,30 +159,78 @@ func (sym *COFFSymbol) FullName(st StringTable) (string, error) {
 	return cstring(sym.Name[:]), nil
 }
 
-func removeAuxSymbols(allsyms []COFFSymbol, st StringTable) ([]*Symbol, error) {
+// symbolCooker converts raw COFF symbol records, fed to it one at
+// a time in table order, into Symbols, skipping auxiliary records.
+type symbolCooker struct {
+	st    StringTable
+	big   []COFFBigSymbol // the records of a big object file, if any
+	names *StringCache    // long names looked up in st, created on first use
+	aux   uint8           // number of auxiliary records still to skip
+	syms  []Symbol
+	index []uint32
+
+	// If salvage is set, symbols whose names cannot be found
+	// are kept with an empty name, and the first such error
+	// is recorded in err.
+	salvage bool
+	err     error
+}
+
+func (c *symbolCooker) add(i int, sym *COFFSymbol) error {
+	if c.aux > 0 {
+		c.aux--
+		return nil
+	}
+	if c.names == nil {
+		c.names = NewStringCache(c.st)
+	}
+	name, err := c.names.SymbolName(sym)
+	if err != nil {
+		if !c.salvage {
+			return err
+		}
+		if c.err == nil {
+			c.err = err
+		}
+	}
+	c.aux = sym.NumberOfAuxSymbols
+	c.syms = append(c.syms, Symbol{
+		Name:         name,
+		Value:        sym.Value,
+		Type:         sym.Type,
+		StorageClass: sym.StorageClass,
+	})
+	c.syms[len(c.syms)-1].setSectionNumber(sectionNumber(c.big, i, sym))
+	c.index = append(c.index, uint32(i))
+	return nil
+}
+
+// sectionNumber returns the section number of the COFF symbol
+// record sym, record i of its table. For big object files, big
+// holds the records of the table, whose section numbers are not
+// truncated as in sym.
+func sectionNumber(big []COFFBigSymbol, i int, sym *COFFSymbol) int32 {
+	if i < len(big) {
+		return big[i].SectionNumber
+	}
+	return bigSectionNumber(sym.SectionNumber)
+}
+
+func removeAuxSymbols(allsyms []COFFSymbol, big []COFFBigSymbol, st StringTable) ([]*Symbol, error) {
 	if len(allsyms) == 0 {
 		return nil, nil
 	}
-	syms := make([]*Symbol, 0)
-	aux := uint8(0)
-	for _, sym := range allsyms {
-		if aux > 0 {
-			aux--
-			continue
-		}
-		name, err := sym.FullName(st)
-		if err != nil {
+	c := &symbolCooker{st: st, big: big}
+	for i := range allsyms {
+		if err := c.add(i, &allsyms[i]); err != nil {
 			return nil, err
 		}
-		aux = sym.NumberOfAuxSymbols
-		s := &Symbol{
-			Name:          name,
-			Value:         sym.Value,
-			SectionNumber: sym.SectionNumber,
-			Type:          sym.Type,
-			StorageClass:  sym.StorageClass,
-		}
-		syms = append(syms, s)
+	}
+	// Point into a single backing array rather
+	// than allocating every Symbol separately.
+	syms := make([]*Symbol, len(c.syms))
+	for i := range c.syms {
+		syms[i] = &c.syms[i]
 	}
 	return syms, nil
 }
@@ -95,4 +243,278 @@ type Symbol struct {
 	SectionNumber int16
 	Type          uint16
 	StorageClass  uint8
+
+	// section is the section number of a symbol of a big object
+	// file when it does not fit in SectionNumber, which then holds
+	// it truncated to 16 bits, and 0 otherwise.
+	section int32
+}
+
+// FullSectionNumber returns the section number of s. It differs
+// from SectionNumber for symbols of big object files that are
+// defined in sections past the 32767th, whose numbers
+// SectionNumber cannot hold.
+func (s *Symbol) FullSectionNumber() int32 {
+	if s.section != 0 {
+		return s.section
+	}
+	return bigSectionNumber(s.SectionNumber)
+}
+
+// setSectionNumber sets the section number of s to n.
+func (s *Symbol) setSectionNumber(n int32) {
+	s.SectionNumber = int16(n)
+	s.section = 0
+	if bigSectionNumber(s.SectionNumber) != n {
+		s.section = n
+	}
+}
+
+// LoadSymbols reads the COFF symbol table and sets f.COFFSymbols
+// and f.Symbols. It is only needed for files opened with
+// Options.LazySymbols; for other files it does nothing.
+// LoadSymbols is safe for concurrent use.
+func (f *File) LoadSymbols() error {
+	f.symbolsMu.Lock()
+	defer f.symbolsMu.Unlock()
+	return f.loadSymbols()
+}
+
+func (f *File) loadSymbols() error {
+	if f.symbolsLoaded {
+		return nil
+	}
+	fh := f.symbolTableHeader()
+	var coffsyms []COFFSymbol
+	var err error
+	switch {
+	case f.BigObjHeader != nil:
+		coffsyms, err = f.readBigSymbols(fh)
+	case f.data != nil:
+		coffsyms, err = decodeCOFFSymbols(fh, f.data)
+	default:
+		coffsyms, err = readCOFFSymbols(fh, f.r, f.size)
+	}
+	if err != nil && !f.recover {
+		return err
+	}
+	if f.recover {
+		// Keep whatever could be read, and report
+		// the first problem found.
+		c := &symbolCooker{st: f.StringTable, big: f.COFFBigSymbols, salvage: true}
+		for i := range coffsyms {
+			c.add(i, &coffsyms[i])
+		}
+		if err == nil {
+			err = c.err
+		}
+		f.COFFSymbols = coffsyms
+		f.Symbols = make([]*Symbol, len(c.syms))
+		for i := range c.syms {
+			f.Symbols[i] = &c.syms[i]
+		}
+		f.symbolsLoaded = true
+		return err
+	}
+	syms, err := removeAuxSymbols(coffsyms, f.COFFBigSymbols, f.StringTable)
+	if err != nil {
+		return err
+	}
+	f.COFFSymbols = coffsyms
+	f.Symbols = syms
+	f.symbolsLoaded = true
+	return nil
+}
+
+// ensureSymbols loads the symbol table of a File read from a
+// file. Files built by the caller have no table to load.
+func (f *File) ensureSymbols() error {
+	if f.r == nil {
+		f.symbolsMu.Lock()
+		f.symbolsLoaded = true
+		f.symbolsMu.Unlock()
+		return nil
+	}
+	return f.LoadSymbols()
+}
+
+// hasSymbols reports whether the symbols of f have been loaded.
+func (f *File) hasSymbols() bool {
+	f.symbolsMu.Lock()
+	defer f.symbolsMu.Unlock()
+	return f.symbolsLoaded
+}
+
+// symbolTableHeader returns the file header describing the
+// symbol table to read. In recovery mode, a table running past
+// the end of the file is cut short to the records present.
+func (f *File) symbolTableHeader() *FileHeader {
+	fh := &f.FileHeader
+	if !f.recover || checkSymbolTable(fh, f.symbolSize(), f.size) == nil {
+		return fh
+	}
+	cut := *fh
+	cut.NumberOfSymbols = 0
+	if n := f.size - int64(fh.PointerToSymbolTable); n > 0 {
+		cut.NumberOfSymbols = uint32(n / f.symbolSize())
+	}
+	return &cut
+}
+
+// walkChunk is the number of COFF symbol records
+// read from the file at a time.
+const walkChunk = 1024
+
+// WalkCOFFSymbols calls fn for every record of the COFF symbol table,
+// including auxiliary symbol records, in file order. i is the index
+// of the record in the table. Iteration stops early if fn returns false.
+// Records are read from the underlying file in small batches, so
+// the whole table is never held in memory, and sym is only valid
+// for the duration of the call. For big object files, the records
+// are those of COFFSymbols, converted from COFFBigSymbols, and the
+// whole table is loaded first.
+func (f *File) WalkCOFFSymbols(fn func(i int, sym *COFFSymbol) bool) error {
+	fh := f.symbolTableHeader()
+	if fh.PointerToSymbolTable == 0 || fh.NumberOfSymbols == 0 || f.imageLayout {
+		return nil
+	}
+	if f.BigObjHeader != nil {
+		if err := f.LoadSymbols(); err != nil {
+			return err
+		}
+		for i := range f.COFFSymbols {
+			if !fn(i, &f.COFFSymbols[i]) {
+				break
+			}
+		}
+		return nil
+	}
+	count, err := symbolCount(fh)
+	if err != nil {
+		return err
+	}
+	sr := io.NewSectionReader(f.r, int64(fh.PointerToSymbolTable), int64(count)*COFFSymbolSize)
+	buf := make([]byte, walkChunk*COFFSymbolSize)
+	syms := make([]COFFSymbol, walkChunk)
+	for i := 0; i < count; {
+		n := count - i
+		if n > len(syms) {
+			n = len(syms)
+		}
+		if err := readCOFFSymbolChunk(sr, buf, syms[:n]); err != nil {
+			return err
+		}
+		for j := range syms[:n] {
+			if !fn(i+j, &syms[j]) {
+				return nil
+			}
+		}
+		i += n
+	}
+	return nil
+}
+
+// A SymbolTable is a compact form of the COFF symbol table that
+// stores symbols by value rather than by pointer. It is cheaper to
+// build and to traverse than File.Symbols for files with very many
+// symbols.
+type SymbolTable struct {
+	// Symbols holds the COFF symbols with auxiliary
+	// symbol records removed, in table order.
+	Symbols []Symbol
+
+	// Index maps Symbols to the raw COFF symbol table:
+	// Index[i] is the index of Symbols[i] among all COFF symbol
+	// records, the form used by Reloc.SymbolTableIndex.
+	// The auxiliary records of Symbols[i], if any, immediately
+	// follow it in the raw table.
+	Index []uint32
+}
+
+// SymbolTable returns the symbols of f in compact form.
+// If f.COFFSymbols has not been loaded, the symbols are streamed
+// from the file without reading all raw records into memory.
+func (f *File) SymbolTable() (*SymbolTable, error) {
+	c := &symbolCooker{st: f.StringTable, big: f.COFFBigSymbols}
+	if f.hasSymbols() {
+		for i := range f.COFFSymbols {
+			if err := c.add(i, &f.COFFSymbols[i]); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		if err := checkSymbolTable(f.symbolTableHeader(), f.symbolSize(), f.size); err != nil {
+			return nil, err
+		}
+		var cookErr error
+		err := f.WalkCOFFSymbols(func(i int, sym *COFFSymbol) bool {
+			cookErr = c.add(i, sym)
+			return cookErr == nil
+		})
+		if err == nil {
+			err = cookErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &SymbolTable{Symbols: c.syms, Index: c.index}, nil
+}
+
+// SymbolByIndex returns the symbol of f.Symbols whose record has
+// index i in f.COFFSymbols, the form of index relocations use. It
+// fails if i is out of range or is the index of an auxiliary record.
+// It walks the symbol table; SymbolTable maps all indexes at once.
+func (f *File) SymbolByIndex(i int) (*Symbol, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return nil, err
+	}
+	if err := f.checkSymbolIndex(i); err != nil {
+		return nil, err
+	}
+	n := 0
+	for j := 0; j < i; j += 1 + int(f.COFFSymbols[j].NumberOfAuxSymbols) {
+		n++
+	}
+	if n >= len(f.Symbols) {
+		return nil, fmt.Errorf("pe: symbol index %d out of range", i)
+	}
+	return f.Symbols[n], nil
+}
+
+// SymbolIndex returns the index in f.COFFSymbols of the record
+// of s, which must be one of f.Symbols. It is the inverse of
+// SymbolByIndex.
+func (f *File) SymbolIndex(s *Symbol) (int, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := 0; i < len(f.COFFSymbols) && n < len(f.Symbols); i += 1 + int(f.COFFSymbols[i].NumberOfAuxSymbols) {
+		if f.Symbols[n] == s {
+			return i, nil
+		}
+		n++
+	}
+	return 0, errors.New("pe: symbol not in File.Symbols")
+}
+
+// AuxSymbols returns the auxiliary records of the symbol whose
+// record has index i in f.COFFSymbols, as a subslice of it. For big
+// object files, whose 20-byte auxiliary records hold the layout of
+// the 18-byte ones followed by padding, the records are converted by
+// dropping the padding, as in f.COFFSymbols, so that they decode the
+// same way for both formats; f.COFFBigSymbols holds the originals.
+func (f *File) AuxSymbols(i int) ([]COFFSymbol, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return nil, err
+	}
+	if err := f.checkSymbolIndex(i); err != nil {
+		return nil, err
+	}
+	n := int(f.COFFSymbols[i].NumberOfAuxSymbols)
+	if n > len(f.COFFSymbols)-i-1 {
+		return nil, &FormatError{-1, "auxiliary symbol records", ErrTruncated, i}
+	}
+	return f.COFFSymbols[i+1 : i+1+n : i+1+n], nil
 }
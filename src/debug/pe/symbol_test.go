@@ -0,0 +1,494 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// makeSymbolTable returns a synthetic COFF symbol table of n records.
+func makeSymbolTable(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		sym := COFFSymbol{
+			Value:         uint32(i),
+			SectionNumber: int16(i % 7),
+			Type:          0x20,
+			StorageClass:  2,
+		}
+		copy(sym.Name[:], "_sym")
+		binary.Write(&buf, binary.LittleEndian, &sym)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeCOFFSymbol(t *testing.T) {
+	for _, tt := range fileTests {
+		f, err := Open(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.COFFSymbols) == 0 {
+			f.Close()
+			continue
+		}
+		sr := io.NewSectionReader(f.r, int64(f.PointerToSymbolTable), int64(f.NumberOfSymbols)*COFFSymbolSize)
+		want := make([]COFFSymbol, f.NumberOfSymbols)
+		if err := binary.Read(sr, binary.LittleEndian, want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f.COFFSymbols, want) {
+			t.Errorf("%s: COFF symbols differ from binary.Read result", tt.file)
+		}
+		f.Close()
+	}
+}
+
+const benchSymbols = 100000
+
+func BenchmarkReadCOFFSymbols(b *testing.B) {
+	// readCOFFSymbols treats a zero PointerToSymbolTable as
+	// "no symbols", so put the table at offset 1.
+	data := append([]byte{0}, makeSymbolTable(benchSymbols)...)
+	fh := &FileHeader{PointerToSymbolTable: 1, NumberOfSymbols: benchSymbols}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readCOFFSymbols(fh, bytes.NewReader(data), int64(len(data))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLongSymbolNames measures the conversion of symbols
+// sharing a few long names, as the section symbols of big object
+// files do.
+func BenchmarkLongSymbolNames(b *testing.B) {
+	var sb StringTableBuilder
+	syms := make([]COFFSymbol, benchSymbols)
+	for i := range syms {
+		off := sb.Add(fmt.Sprintf(".text$mn_function_%d", i%16))
+		binary.LittleEndian.PutUint32(syms[i].Name[4:], off)
+	}
+	st := sb.StringTable()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := removeAuxSymbols(syms, nil, st); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadCOFFSymbolsBinaryRead measures the encoding/binary
+// based decoding readCOFFSymbols used to do, for comparison.
+func BenchmarkReadCOFFSymbolsBinaryRead(b *testing.B) {
+	data := makeSymbolTable(benchSymbols)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		syms := make([]COFFSymbol, benchSymbols)
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, syms); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSymbolTable(t *testing.T) {
+	for _, lazy := range []bool{false, true} {
+		for _, tt := range fileTests {
+			f, err := OpenWithOptions(tt.file, &Options{LazySymbols: lazy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			st, err := f.SymbolTable()
+			if err != nil {
+				t.Fatalf("%s: SymbolTable: %v", tt.file, err)
+			}
+			if err := f.LoadSymbols(); err != nil {
+				t.Fatal(err)
+			}
+			if len(st.Symbols) != len(f.Symbols) || len(st.Index) != len(f.Symbols) {
+				t.Fatalf("%s: SymbolTable has %d symbols and %d indexes, want %d", tt.file, len(st.Symbols), len(st.Index), len(f.Symbols))
+			}
+			for i := range st.Symbols {
+				if have, want := st.Symbols[i], *f.Symbols[i]; have != want {
+					t.Errorf("%s: symbol %d: have %#v, want %#v", tt.file, i, have, want)
+				}
+				raw := &f.COFFSymbols[st.Index[i]]
+				if name, _ := raw.FullName(f.StringTable); name != st.Symbols[i].Name {
+					t.Errorf("%s: symbol %d: Index points at %q, want %q", tt.file, i, name, st.Symbols[i].Name)
+				}
+			}
+			f.Close()
+		}
+	}
+}
+
+func TestSymbolTypes(t *testing.T) {
+	tests := []struct {
+		typ  uint16
+		name string
+		fn   bool
+	}{
+		{0, "IMAGE_SYM_TYPE_NULL", false},
+		{0x20, "IMAGE_SYM_DTYPE_FUNCTION IMAGE_SYM_TYPE_NULL", true},
+		{0x04, "IMAGE_SYM_TYPE_INT", false},
+		{0x64, "IMAGE_SYM_DTYPE_FUNCTION IMAGE_SYM_DTYPE_POINTER IMAGE_SYM_TYPE_INT", true}, // int *f()
+		{0x3f, "IMAGE_SYM_DTYPE_ARRAY IMAGE_SYM_TYPE_DWORD", false},
+	}
+	for _, tt := range tests {
+		s := Symbol{Type: tt.typ}
+		if name := SymbolTypeString(tt.typ); name != tt.name {
+			t.Errorf("SymbolTypeString(%#x) = %q, want %q", tt.typ, name, tt.name)
+		}
+		if s.IsFunction() != tt.fn || s.BaseType() != tt.typ&0xf {
+			t.Errorf("type %#x: IsFunction = %v, BaseType = %d", tt.typ, s.IsFunction(), s.BaseType())
+		}
+	}
+	for class, want := range map[uint8]string{
+		IMAGE_SYM_CLASS_EXTERNAL:        "IMAGE_SYM_CLASS_EXTERNAL",
+		IMAGE_SYM_CLASS_END_OF_FUNCTION: "IMAGE_SYM_CLASS_END_OF_FUNCTION",
+		200:                             "200",
+	} {
+		if name := SymbolClassString(class); name != want {
+			t.Errorf("SymbolClassString(%d) = %q, want %q", class, name, want)
+		}
+	}
+
+	// gcc marks its functions as such.
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, s := range f.Symbols {
+		if s.Name == "main" && (!s.IsFunction() || s.StorageClass != IMAGE_SYM_CLASS_EXTERNAL) {
+			t.Errorf("main has type %s and class %s", SymbolTypeString(s.Type), SymbolClassString(s.StorageClass))
+		}
+	}
+}
+
+// weakRecord returns the auxiliary record of a weak
+// external whose default symbol is at index tag.
+func weakRecord(tag, chars uint32) []COFFSymbol {
+	var aux COFFSymbol
+	binary.LittleEndian.PutUint32(aux.Name[0:], tag)
+	binary.LittleEndian.PutUint32(aux.Name[4:], chars)
+	return []COFFSymbol{aux}
+}
+
+func TestWeakExternals(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	main := symbolIndex(t, f, "main")
+	inner, err := f.AddSymbol(&Symbol{Name: "inner", StorageClass: IMAGE_SYM_CLASS_WEAK_EXTERNAL}, weakRecord(uint32(main), IMAGE_WEAK_EXTERN_SEARCH_ALIAS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.AddSymbol(&Symbol{Name: "outer", StorageClass: IMAGE_SYM_CLASS_WEAK_EXTERNAL}, weakRecord(uint32(inner), IMAGE_WEAK_EXTERN_SEARCH_LIBRARY)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer := g.Symbols[len(g.Symbols)-1]
+	w, err := g.WeakExternal(outer)
+	want := WeakExternal{TagIndex: uint32(inner), Characteristics: IMAGE_WEAK_EXTERN_SEARCH_LIBRARY}
+	if err != nil || w == nil || *w != want {
+		t.Errorf("WeakExternal(outer) = %+v, %v; want %+v", w, err, want)
+	}
+	if w, err := g.WeakExternal(g.Symbols[0]); w != nil || err != nil {
+		t.Errorf("WeakExternal(%s) = %+v, %v; want nil", g.Symbols[0].Name, w, err)
+	}
+	for _, s := range []*Symbol{outer, g.Symbols[len(g.Symbols)-2]} {
+		d, err := g.ResolveWeakExternal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name != "main" {
+			t.Errorf("%s resolves to %s, want main", s.Name, d.Name)
+		}
+	}
+	if d, err := g.ResolveWeakExternal(g.Symbols[0]); err != nil || d != g.Symbols[0] {
+		t.Errorf("resolving %s = %v, %v; want itself", g.Symbols[0].Name, d, err)
+	}
+
+	// A weak external that is its own default.
+	aux := &g.COFFSymbols[len(g.COFFSymbols)-1]
+	binary.LittleEndian.PutUint32(aux.Name[0:], uint32(len(g.COFFSymbols)-2))
+	if _, err := g.ResolveWeakExternal(outer); err == nil {
+		t.Errorf("resolving a cycle of weak externals succeeded")
+	}
+	binary.LittleEndian.PutUint32(aux.Name[0:], 1) // an auxiliary record
+	if _, err := g.ResolveWeakExternal(outer); err == nil {
+		t.Errorf("resolving to an auxiliary record succeeded")
+	}
+}
+
+func TestSymbolIndexes(t *testing.T) {
+	var textAux COFFSymbol
+	for _, big := range []bool{false, true} {
+		f, err := Open("testdata/gcc-amd64-mingw-obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if big {
+			var buf bytes.Buffer
+			if err := f.WriteObject(&buf, &WriteOptions{Format: ObjectBig}); err != nil {
+				t.Fatal(err)
+			}
+			if f, err = NewFile(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+		}
+		st, err := f.SymbolTable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n, i := range st.Index {
+			s, err := f.SymbolByIndex(int(i))
+			if err != nil || s != f.Symbols[n] {
+				t.Errorf("big=%v: SymbolByIndex(%d) = %v, %v; want %v", big, i, s, err, f.Symbols[n])
+			}
+			if j, err := f.SymbolIndex(f.Symbols[n]); j != int(i) || err != nil {
+				t.Errorf("big=%v: SymbolIndex(%s) = %d, %v; want %d", big, f.Symbols[n].Name, j, err, i)
+			}
+			aux, err := f.AuxSymbols(int(i))
+			if err != nil || len(aux) != int(f.COFFSymbols[i].NumberOfAuxSymbols) {
+				t.Errorf("big=%v: AuxSymbols(%d) returned %d records, %v; want %d", big, i, len(aux), err, f.COFFSymbols[i].NumberOfAuxSymbols)
+			}
+		}
+
+		// The section definition of .text reads the same in both formats.
+		i := symbolIndex(t, f, ".text")
+		aux, err := f.AuxSymbols(i)
+		if err != nil || len(aux) != 1 {
+			t.Fatalf("big=%v: AuxSymbols(.text) = %v, %v", big, aux, err)
+		}
+		if !big {
+			textAux = aux[0]
+		} else if aux[0] != textAux {
+			t.Errorf("big object .text section definition is %+v, want %+v", aux[0], textAux)
+		}
+
+		if _, err := f.SymbolByIndex(i + 1); err == nil {
+			t.Errorf("big=%v: SymbolByIndex of an auxiliary record succeeded", big)
+		}
+		if _, err := f.SymbolByIndex(len(f.COFFSymbols)); err == nil {
+			t.Errorf("big=%v: SymbolByIndex out of range succeeded", big)
+		}
+		if _, err := f.SymbolIndex(&Symbol{}); err == nil {
+			t.Errorf("big=%v: SymbolIndex of a foreign symbol succeeded", big)
+		}
+	}
+}
+
+func TestSectionDefAux(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	if err := f.WriteObject(&buf, &WriteOptions{Format: ObjectBig}); err != nil {
+		t.Fatal(err)
+	}
+	big, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*File{f, big} {
+		i := symbolIndex(t, g, ".text")
+		d, err := g.COFFSymbolReadSectionDefAux(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The section holds 36 bytes of code, padded in the file.
+		want := COFFSymbolAuxFormat5{Size: 36, NumRelocs: 3}
+		if *d != want {
+			t.Errorf("big=%v: .text section definition = %+v, want %+v", g.IsBigObj(), *d, want)
+		}
+		if _, err := g.COFFSymbolReadSectionDefAux(symbolIndex(t, g, "main")); err == nil {
+			t.Errorf("big=%v: reading the section definition of main succeeded", g.IsBigObj())
+		}
+	}
+
+	// Associative COMDAT section numbers above 65535.
+	i := symbolIndex(t, big, ".text")
+	aux := &big.COFFSymbols[i+1]
+	aux.SectionNumber = 2
+	aux.Type = IMAGE_COMDAT_SELECT_ASSOCIATIVE
+	aux.StorageClass = 1 // the low byte of the high part
+	d, err := big.COFFSymbolReadSectionDefAux(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SecNum != 0x10002 || d.Selection != IMAGE_COMDAT_SELECT_ASSOCIATIVE {
+		t.Errorf("associative section definition = %+v, want section 0x10002", *d)
+	}
+}
+
+func TestLinkerDirectives(t *testing.T) {
+	f := &File{
+		Sections: []*Section{
+			NewSection(SectionHeader{Name: ".text"}, []byte("/DEFAULTLIB:ignored")),
+			NewSection(SectionHeader{Name: ".drectve"}, []byte(`   /DEFAULTLIB:"LIBCMT" /EXPORT:foo,@2,NONAME -alternatename:a=b`)),
+			NewSection(SectionHeader{Name: ".drectve"}, []byte("\xef\xbb\xbf/INCLUDE:\"caf\xc3\xa9 sym\" /NODEFAULTLIB\x00")),
+		},
+	}
+	ds, err := f.LinkerDirectives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LinkerDirective{
+		{"DEFAULTLIB", "LIBCMT"},
+		{"EXPORT", "foo,@2,NONAME"},
+		{"ALTERNATENAME", "a=b"},
+		{"INCLUDE", "café sym"},
+		{"NODEFAULTLIB", ""},
+	}
+	if !reflect.DeepEqual(ds, want) {
+		t.Errorf("LinkerDirectives = %q, want %q", ds, want)
+	}
+
+	f.Sections[1] = NewSection(SectionHeader{Name: ".drectve"}, []byte("/EXPORT:foo bar"))
+	if _, err := f.LinkerDirectives(); err == nil {
+		t.Errorf("LinkerDirectives succeeded on a directive that is not an option")
+	}
+}
+
+func TestSafeSEH(t *testing.T) {
+	f := &File{
+		FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_I386},
+		Sections: []*Section{
+			NewSection(SectionHeader{Name: ".text"}, make([]byte, 0x10)),
+			NewSection(SectionHeader{Name: ".sxdata"}, []byte{3, 0, 0, 0, 1, 0, 0, 0}),
+		},
+		COFFSymbols: []COFFSymbol{
+			{Name: [8]byte{'@', 'f', 'e', 'a', 't', '.', '0', '0'}, Value: FEAT00_SAFESEH | FEAT00_GUARDCF, SectionNumber: -1, StorageClass: IMAGE_SYM_CLASS_STATIC},
+			{Name: [8]byte{'_', 'h', '1'}, SectionNumber: 1, Type: 0x20, StorageClass: IMAGE_SYM_CLASS_EXTERNAL, NumberOfAuxSymbols: 1},
+			{},
+			{Name: [8]byte{'_', 'h', '2'}, Value: 8, SectionNumber: 1, StorageClass: IMAGE_SYM_CLASS_STATIC},
+		},
+	}
+	if err := f.refreshSymbols(); err != nil {
+		t.Fatal(err)
+	}
+	feat, ok, err := f.Feat00()
+	if err != nil || !ok || feat != FEAT00_SAFESEH|FEAT00_GUARDCF {
+		t.Errorf("Feat00 = %#x, %v, %v, want %#x, true, nil", feat, ok, err, FEAT00_SAFESEH|FEAT00_GUARDCF)
+	}
+	idx, err := f.SafeSEHHandlers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, i := range idx {
+		s, err := f.SymbolByIndex(int(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, s.Name)
+	}
+	if want := []string{"_h2", "_h1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("SafeSEHHandlers = %v (%q), want %q", idx, names, want)
+	}
+
+	f.Sections[1] = NewSection(SectionHeader{Name: ".sxdata"}, []byte{2, 0, 0, 0})
+	if _, err := f.SafeSEHHandlers(); err == nil {
+		t.Errorf("SafeSEHHandlers succeeded on the index of an auxiliary record")
+	}
+}
+
+func TestValidateSymbols(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-obj", "testdata/gcc-amd64-mingw-obj"} {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		findings, err := f.ValidateSymbols()
+		f.Close()
+		if err != nil || findings != nil {
+			t.Errorf("%s: ValidateSymbols() = %v, %v; want no findings", file, findings, err)
+		}
+	}
+
+	// A function f with its .bf, .lf and .ef records.
+	rec := func(name string, class uint8, naux uint8) COFFSymbol {
+		sym := COFFSymbol{SectionNumber: 1, StorageClass: class, NumberOfAuxSymbols: naux}
+		copy(sym.Name[:], name)
+		return sym
+	}
+	aux := func(tag, next uint32) COFFSymbol {
+		var sym COFFSymbol
+		b := make([]byte, COFFSymbolSize)
+		binary.LittleEndian.PutUint32(b[0:], tag)
+		binary.LittleEndian.PutUint32(b[12:], next)
+		decodeCOFFSymbol(b, &sym)
+		return sym
+	}
+	fn := rec("f", IMAGE_SYM_CLASS_EXTERNAL, 1)
+	fn.Type = IMAGE_SYM_DTYPE_FUNCTION << 4
+	valid := []COFFSymbol{
+		fn, aux(2, 0),
+		rec(".bf", IMAGE_SYM_CLASS_FUNCTION, 1), aux(0, 0),
+		rec(".lf", IMAGE_SYM_CLASS_FUNCTION, 0),
+		rec(".ef", IMAGE_SYM_CLASS_FUNCTION, 1), aux(0, 0),
+		{Name: [8]uint8{4: 4}, StorageClass: IMAGE_SYM_CLASS_STATIC}, // "long_name"
+	}
+	tests := []struct {
+		edit func(recs []COFFSymbol) []COFFSymbol
+		sev  Severity
+		msg  string
+	}{
+		{func(r []COFFSymbol) []COFFSymbol { return r }, 0, ""},
+		{func(r []COFFSymbol) []COFFSymbol { r[0].SectionNumber = 2; return r }, SeverityError, "section number refers to no section"},
+		{func(r []COFFSymbol) []COFFSymbol { r[7].NumberOfAuxSymbols = 1; return r }, SeverityError, "auxiliary records run past the end of the table"},
+		{func(r []COFFSymbol) []COFFSymbol { r[7].Name[4] = 30; return r }, SeverityError, "name is outside the string table"},
+		{func(r []COFFSymbol) []COFFSymbol { r[7].Name[4] = 14; return r }, SeverityWarning, "name is not NUL-terminated"},
+		{func(r []COFFSymbol) []COFFSymbol { r[1] = aux(4, 0); return r }, SeverityWarning, "TagIndex does not refer to a .bf record"},
+		{func(r []COFFSymbol) []COFFSymbol { r[1] = aux(2, 3); return r }, SeverityWarning, "PointerToNextFunction does not refer to a function definition"},
+		{func(r []COFFSymbol) []COFFSymbol { return append(r[:5], r[7]) }, SeverityWarning, ".bf record without a .ef record"},
+		{func(r []COFFSymbol) []COFFSymbol { return append(r, rec(".lf", IMAGE_SYM_CLASS_FUNCTION, 0)) }, SeverityWarning, ".lf record outside a function"},
+	}
+	for i, tt := range tests {
+		f := &File{
+			Sections:    []*Section{NewSection(SectionHeader{Name: ".text"}, []byte{0xc3})},
+			COFFSymbols: tt.edit(append([]COFFSymbol(nil), valid...)),
+			StringTable: StringTable("long_name\x00dangling"),
+		}
+		findings, err := f.ValidateSymbols()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.msg == "" {
+			if findings != nil {
+				t.Errorf("%d: findings %v, want none", i, findings)
+			}
+			continue
+		}
+		if len(findings) != 1 || findings[0].Severity != tt.sev || findings[0].Err.Err.Error() != tt.msg {
+			t.Errorf("%d: findings %v, want a single %v: %s", i, findings, tt.sev, tt.msg)
+		}
+	}
+}
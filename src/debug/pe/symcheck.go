@@ -0,0 +1,156 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+)
+
+// ValidateSymbols checks the consistency of the COFF symbol table of
+// f, as a test oracle for compilers and linkers, and returns the
+// problems found, most severe first, or nil if there are none.
+//
+// Section numbers that refer to no section, auxiliary records that
+// run past the end of the table and long names that lie outside the
+// string table are errors. Names missing their terminating NUL, and
+// debugging records that break the chains of function definitions,
+// .bf, .lf and .ef records described by the specification, are
+// warnings: the TagIndex of a function definition must refer to a
+// .bf record, the PointerToNextFunction of a function definition or
+// a .bf record to the next such record, and each .bf record must be
+// followed by a .ef record before the next .bf one.
+//
+// Unlike loading the symbols, ValidateSymbols does not fail on bad
+// names. It only fails if the symbol table cannot be read.
+func (f *File) ValidateSymbols() ([]Finding, error) {
+	recs, err := f.symbolRecords()
+	if err != nil {
+		return nil, err
+	}
+	var v validator
+	v.checkSymbols(f, recs)
+	return v.sorted(), nil
+}
+
+// symbolRecords returns the raw COFF symbol records of f. Records
+// read from the file are not cooked into Symbols, so that names
+// outside the string table do not stop the reading.
+func (f *File) symbolRecords() ([]COFFSymbol, error) {
+	if f.r == nil || f.BigObjHeader != nil || f.hasSymbols() {
+		if err := f.ensureSymbols(); err != nil {
+			return nil, err
+		}
+		return f.COFFSymbols, nil
+	}
+	if err := checkSymbolTable(f.symbolTableHeader(), f.symbolSize(), f.size); err != nil {
+		return nil, err
+	}
+	var recs []COFFSymbol
+	err := f.WalkCOFFSymbols(func(i int, sym *COFFSymbol) bool {
+		recs = append(recs, *sym)
+		return true
+	})
+	return recs, err
+}
+
+// isFunctionDefinition reports whether sym is the
+// definition of a function, which may have a TagIndex
+// and a PointerToNextFunction in its auxiliary record.
+func isFunctionDefinition(sym *COFFSymbol) bool {
+	return sym.StorageClass == IMAGE_SYM_CLASS_EXTERNAL && sym.Type&0xf0 == IMAGE_SYM_DTYPE_FUNCTION<<4 && sym.SectionNumber > 0
+}
+
+// isBeginFunction reports whether sym is a .bf record.
+func isBeginFunction(sym *COFFSymbol) bool {
+	return sym.StorageClass == IMAGE_SYM_CLASS_FUNCTION && cstring(sym.Name[:]) == ".bf"
+}
+
+// checkSymbols checks the COFF symbol records recs of f.
+func (v *validator) checkSymbols(f *File, recs []COFFSymbol) {
+	big := f.BigObjHeader != nil && len(f.COFFBigSymbols) == len(recs)
+	primary := make([]bool, len(recs))
+	for i := 0; i < len(recs); i += 1 + int(recs[i].NumberOfAuxSymbols) {
+		primary[i] = true
+	}
+	off := func(i int) int64 {
+		if f.r == nil || f.PointerToSymbolTable == 0 {
+			return -1
+		}
+		return int64(f.PointerToSymbolTable) + int64(i)*f.symbolSize()
+	}
+
+	open := -1 // the .bf record still waiting for its .ef record
+	for i := 0; i < len(recs); i += 1 + int(recs[i].NumberOfAuxSymbols) {
+		sym := &recs[i]
+		what := "COFF symbol " + strconv.Itoa(i)
+		if i+int(sym.NumberOfAuxSymbols) >= len(recs) {
+			v.add(SeverityError, off(i), what, "auxiliary records run past the end of the table", sym.NumberOfAuxSymbols)
+		}
+		sn := int64(sym.SectionNumber)
+		if big {
+			sn = int64(f.COFFBigSymbols[i].SectionNumber)
+		}
+		if sn < IMAGE_SYM_DEBUG || sn > int64(len(f.Sections)) {
+			v.add(SeverityError, off(i), what, "section number refers to no section", sn)
+		}
+		if ok, so := isSymNameOffset(sym.Name); ok {
+			if so < 4 || int64(so)-4 >= int64(len(f.StringTable)) {
+				v.add(SeverityError, off(i), what, "name is outside the string table", so)
+			} else if bytes.IndexByte(f.StringTable[so-4:], 0) < 0 {
+				v.add(SeverityWarning, off(i), what, "name is not NUL-terminated", so)
+			}
+		}
+
+		// The indexes in the first auxiliary record, if any.
+		var aux []byte
+		if sym.NumberOfAuxSymbols > 0 && i+1 < len(recs) {
+			aux = make([]byte, COFFSymbolSize)
+			encodeCOFFSymbol(aux, &recs[i+1])
+		}
+		ref := func(field string, at int, want func(*COFFSymbol) bool, kind string) {
+			if aux == nil {
+				return
+			}
+			j := binary.LittleEndian.Uint32(aux[at:])
+			if j != 0 && (int64(j) >= int64(len(recs)) || !primary[j] || !want(&recs[j])) {
+				v.add(SeverityWarning, off(i), what, field+" does not refer to a "+kind, j)
+			}
+		}
+		switch {
+		case isFunctionDefinition(sym):
+			ref("TagIndex", 0, isBeginFunction, ".bf record")
+			ref("PointerToNextFunction", 12, isFunctionDefinition, "function definition")
+		case sym.StorageClass == IMAGE_SYM_CLASS_FUNCTION:
+			switch cstring(sym.Name[:]) {
+			case ".bf":
+				if open >= 0 {
+					v.add(SeverityWarning, off(i), what, ".bf record before the .ef record of the .bf record at index "+strconv.Itoa(open), nil)
+				}
+				open = i
+				if aux == nil {
+					v.add(SeverityWarning, off(i), what, ".bf record has no auxiliary record", nil)
+				}
+				ref("PointerToNextFunction", 12, isBeginFunction, ".bf record")
+			case ".lf":
+				if open < 0 {
+					v.add(SeverityWarning, off(i), what, ".lf record outside a function", nil)
+				}
+			case ".ef":
+				if open < 0 {
+					v.add(SeverityWarning, off(i), what, ".ef record without a .bf record", nil)
+				}
+				open = -1
+				if aux == nil {
+					v.add(SeverityWarning, off(i), what, ".ef record has no auxiliary record", nil)
+				}
+			}
+		}
+	}
+	if open >= 0 {
+		v.add(SeverityWarning, off(open), "COFF symbol "+strconv.Itoa(open), ".bf record without a .ef record", nil)
+	}
+}
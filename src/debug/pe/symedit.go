@@ -0,0 +1,261 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The methods below edit the symbol table of f in memory, for
+// writing with File.WriteObject. They identify a symbol by the
+// index of its record in f.COFFSymbols, which is the index that
+// relocations use. Each edit rebuilds f.Symbols, so Symbols
+// obtained before it are stale. WalkCOFFSymbols keeps reading the
+// table stored in the file.
+
+// checkSymbolIndex verifies that i is the index
+// of a symbol record, not of an auxiliary record.
+func (f *File) checkSymbolIndex(i int) error {
+	if i < 0 || i >= len(f.COFFSymbols) {
+		return fmt.Errorf("pe: symbol index %d out of range", i)
+	}
+	for j := 0; j < i; j += 1 + int(f.COFFSymbols[j].NumberOfAuxSymbols) {
+		if j+1+int(f.COFFSymbols[j].NumberOfAuxSymbols) > i {
+			return fmt.Errorf("pe: symbol index %d is an auxiliary record", i)
+		}
+	}
+	return nil
+}
+
+// symbolName returns the name field for a symbol named name,
+// adding the name to f.StringTable if it is longer than 8 bytes
+// and the table does not hold it yet.
+func (f *File) symbolName(name string) [8]byte {
+	var b [8]byte
+	if len(name) <= len(b) {
+		copy(b[:], name)
+		return b
+	}
+	off := f.StringTable.index(name)
+	if off < 0 {
+		off = len(f.StringTable)
+		f.StringTable = append(f.StringTable, name...)
+		f.StringTable = append(f.StringTable, 0)
+	}
+	binary.LittleEndian.PutUint32(b[4:], uint32(off+4))
+	return b
+}
+
+// refreshSymbols rebuilds f.Symbols from f.COFFSymbols.
+func (f *File) refreshSymbols() error {
+	syms, err := removeAuxSymbols(f.COFFSymbols, f.COFFBigSymbols, f.StringTable)
+	if err != nil {
+		return err
+	}
+	f.Symbols = syms
+	return nil
+}
+
+// AddSymbol appends a symbol described by sym, followed by the
+// auxiliary records aux, to the symbol table and returns its index.
+// Names longer than 8 bytes are stored in the string table.
+func (f *File) AddSymbol(sym *Symbol, aux []COFFSymbol) (int, error) {
+	if err := f.ensureSymbols(); err != nil {
+		return 0, err
+	}
+	if len(aux) > 0xff {
+		return 0, fmt.Errorf("pe: symbol %s has too many auxiliary records", sym.Name)
+	}
+	if sym.FullSectionNumber() > maxCOFFSections && len(f.COFFBigSymbols) == 0 {
+		return 0, fmt.Errorf("pe: bad section number %d for symbol %s", sym.FullSectionNumber(), sym.Name)
+	}
+	i := len(f.COFFSymbols)
+	rec := COFFSymbol{
+		Name:               f.symbolName(sym.Name),
+		Value:              sym.Value,
+		SectionNumber:      sym.SectionNumber,
+		Type:               sym.Type,
+		StorageClass:       sym.StorageClass,
+		NumberOfAuxSymbols: uint8(len(aux)),
+	}
+	if len(f.COFFBigSymbols) > 0 {
+		f.COFFBigSymbols = append(f.COFFBigSymbols, COFFBigSymbol{
+			Name:               rec.Name,
+			Value:              rec.Value,
+			SectionNumber:      sym.FullSectionNumber(),
+			Type:               rec.Type,
+			StorageClass:       rec.StorageClass,
+			NumberOfAuxSymbols: rec.NumberOfAuxSymbols,
+		})
+		for j := range aux {
+			f.COFFBigSymbols = append(f.COFFBigSymbols, bigAuxRecord(&aux[j]))
+		}
+	}
+	f.COFFSymbols = append(f.COFFSymbols, rec)
+	f.COFFSymbols = append(f.COFFSymbols, aux...)
+	return i, f.refreshSymbols()
+}
+
+// bigAuxRecord returns the auxiliary record aux
+// padded to the size of big object records.
+func bigAuxRecord(aux *COFFSymbol) COFFBigSymbol {
+	var b [COFFBigSymbolSize]byte
+	encodeCOFFSymbol(b[:], aux)
+	var sym COFFBigSymbol
+	decodeCOFFBigSymbol(b[:], &sym)
+	return sym
+}
+
+// RenameSymbol changes the name of symbol i. Names longer than
+// 8 bytes are stored in the string table. The old name is left
+// in the string table, as other symbols may share it.
+func (f *File) RenameSymbol(i int, name string) error {
+	if err := f.ensureSymbols(); err != nil {
+		return err
+	}
+	if err := f.checkSymbolIndex(i); err != nil {
+		return err
+	}
+	f.COFFSymbols[i].Name = f.symbolName(name)
+	if len(f.COFFBigSymbols) > 0 {
+		f.COFFBigSymbols[i].Name = f.COFFSymbols[i].Name
+	}
+	return f.refreshSymbols()
+}
+
+// RedefineSymbol changes the value and section number of symbol i,
+// for example to define an undefined external symbol. Section
+// numbers above 65279 need a big object file.
+func (f *File) RedefineSymbol(i int, value uint32, section int32) error {
+	if err := f.ensureSymbols(); err != nil {
+		return err
+	}
+	if err := f.checkSymbolIndex(i); err != nil {
+		return err
+	}
+	if section < -2 || section > maxCOFFSections && len(f.COFFBigSymbols) == 0 {
+		return fmt.Errorf("pe: bad section number %d for symbol %d", section, i)
+	}
+	f.COFFSymbols[i].Value = value
+	f.COFFSymbols[i].SectionNumber = int16(section)
+	if len(f.COFFBigSymbols) > 0 {
+		f.COFFBigSymbols[i].Value = value
+		f.COFFBigSymbols[i].SectionNumber = section
+	}
+	return f.refreshSymbols()
+}
+
+// DeleteSymbol removes symbol i and its auxiliary records from the
+// symbol table. The symbol indexes in relocations and in auxiliary
+// records of other symbols are renumbered. It fails if a relocation
+// or a weak external refers to the symbol; other references, which
+// only link debugging information, are cleared.
+func (f *File) DeleteSymbol(i int) error {
+	if err := f.ensureSymbols(); err != nil {
+		return err
+	}
+	if err := f.checkSymbolIndex(i); err != nil {
+		return err
+	}
+	n := uint32(1 + f.COFFSymbols[i].NumberOfAuxSymbols)
+	if i+int(n) > len(f.COFFSymbols) {
+		return fmt.Errorf("pe: auxiliary records of symbol %d are missing", i)
+	}
+	lo, hi := uint32(i), uint32(i)+n
+	for _, s := range f.Sections {
+		for _, r := range s.Relocs {
+			if lo <= r.SymbolTableIndex && r.SymbolTableIndex < hi {
+				return fmt.Errorf("pe: symbol %d is used by a relocation in section %s", i, s.Name)
+			}
+		}
+	}
+	refs := f.auxSymbolRefs()
+	for _, ref := range refs {
+		if ref.weak && (ref.sym < int(lo) || ref.sym >= int(hi)) && lo <= ref.get() && ref.get() < hi {
+			return fmt.Errorf("pe: symbol %d is the default of weak external %d", i, ref.sym)
+		}
+	}
+
+	for _, ref := range refs {
+		switch v := ref.get(); {
+		case v >= hi:
+			ref.set(v - n)
+		case v >= lo:
+			ref.set(0)
+		}
+	}
+	for _, s := range f.Sections {
+		for j := range s.Relocs {
+			if s.Relocs[j].SymbolTableIndex >= hi {
+				s.Relocs[j].SymbolTableIndex -= n
+			}
+		}
+	}
+	f.COFFSymbols = append(f.COFFSymbols[:lo], f.COFFSymbols[hi:]...)
+	if len(f.COFFBigSymbols) > 0 {
+		f.COFFBigSymbols = append(f.COFFBigSymbols[:lo], f.COFFBigSymbols[hi:]...)
+	}
+	return f.refreshSymbols()
+}
+
+// An auxSymbolRef is a symbol index stored
+// in an auxiliary symbol record.
+type auxSymbolRef struct {
+	f    *File
+	sym  int  // the symbol the record belongs to
+	aux  int  // the index of the record
+	off  int  // the offset of the index in the record
+	weak bool // the default symbol of a weak external
+}
+
+// get returns the symbol index stored at r.
+func (r auxSymbolRef) get() uint32 {
+	var b [COFFSymbolSize]byte
+	encodeCOFFSymbol(b[:], &r.f.COFFSymbols[r.aux])
+	return binary.LittleEndian.Uint32(b[r.off:])
+}
+
+// set stores the symbol index v at r.
+func (r auxSymbolRef) set(v uint32) {
+	var b [COFFSymbolSize]byte
+	encodeCOFFSymbol(b[:], &r.f.COFFSymbols[r.aux])
+	binary.LittleEndian.PutUint32(b[r.off:], v)
+	decodeCOFFSymbol(b[:], &r.f.COFFSymbols[r.aux])
+	if len(r.f.COFFBigSymbols) > 0 {
+		r.f.COFFBigSymbols[r.aux] = bigAuxRecord(&r.f.COFFSymbols[r.aux])
+	}
+}
+
+// auxSymbolRefs returns the symbol indexes stored in the auxiliary
+// records of f: the default symbols of weak externals, and the
+// links between function definitions and their .bf symbols.
+// Zero indexes, which mean no symbol, are left out.
+func (f *File) auxSymbolRefs() []auxSymbolRef {
+	var refs []auxSymbolRef
+	for i := 0; i < len(f.COFFSymbols); i += 1 + int(f.COFFSymbols[i].NumberOfAuxSymbols) {
+		sym := &f.COFFSymbols[i]
+		if sym.NumberOfAuxSymbols == 0 || i+1 >= len(f.COFFSymbols) {
+			continue
+		}
+		var offs []int
+		weak := false
+		switch {
+		case sym.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL:
+			offs, weak = []int{0}, true // TagIndex
+		case sym.StorageClass == IMAGE_SYM_CLASS_EXTERNAL && sym.Type&0xf0 == IMAGE_SYM_DTYPE_FUNCTION<<4 && sectionNumber(f.COFFBigSymbols, i, sym) > 0:
+			offs = []int{0, 12} // TagIndex, PointerToNextFunction
+		case sym.StorageClass == IMAGE_SYM_CLASS_FUNCTION && cstring(sym.Name[:]) == ".bf":
+			offs = []int{12} // PointerToNextFunction
+		}
+		for _, off := range offs {
+			ref := auxSymbolRef{f, i, i + 1, off, weak}
+			if ref.get() != 0 {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
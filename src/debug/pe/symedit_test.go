@@ -0,0 +1,112 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// relocSymbols returns the names of the symbols
+// the relocations of each section of f refer to.
+func relocSymbols(t *testing.T, f *File) [][]string {
+	var names [][]string
+	for _, s := range f.Sections {
+		var ns []string
+		for _, r := range s.Relocs {
+			n, err := f.COFFSymbols[r.SymbolTableIndex].FullName(f.StringTable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ns = append(ns, n)
+		}
+		names = append(names, ns)
+	}
+	return names
+}
+
+// symbolIndex returns the index in f.COFFSymbols of the symbol named name.
+func symbolIndex(t *testing.T, f *File, name string) int {
+	for i := range f.COFFSymbols {
+		if n, _ := f.COFFSymbols[i].FullName(f.StringTable); n == name {
+			return i
+		}
+	}
+	t.Fatalf("no symbol %s", name)
+	return -1
+}
+
+func TestEditSymbols(t *testing.T) {
+	for _, big := range []bool{false, true} {
+		f, err := Open("testdata/gcc-amd64-mingw-obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if big {
+			var buf bytes.Buffer
+			if err := f.WriteObject(&buf, &WriteOptions{Format: ObjectBig}); err != nil {
+				t.Fatal(err)
+			}
+			if f, err = NewFile(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+		}
+		relocs := relocSymbols(t, f)
+
+		if err := f.DeleteSymbol(symbolIndex(t, f, ".text")); err == nil {
+			t.Errorf("deleting a symbol used by a relocation succeeded")
+		}
+		if err := f.DeleteSymbol(1); err == nil {
+			t.Errorf("deleting an auxiliary record succeeded")
+		}
+		for _, name := range []string{".file", ".data"} {
+			if err := f.DeleteSymbol(symbolIndex(t, f, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		const long = "a_rather_long_main_function"
+		if err := f.RenameSymbol(symbolIndex(t, f, "main"), long); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.RedefineSymbol(symbolIndex(t, f, "__main"), 0x10, 1); err != nil {
+			t.Fatal(err)
+		}
+		i, err := f.AddSymbol(&Symbol{Name: "extra", StorageClass: IMAGE_SYM_CLASS_EXTERNAL}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != len(f.COFFSymbols)-1 {
+			t.Errorf("AddSymbol returned index %d, want %d", i, len(f.COFFSymbols)-1)
+		}
+		if !reflect.DeepEqual(relocSymbols(t, f), relocs) {
+			t.Errorf("relocations refer to %v, want %v", relocSymbols(t, f), relocs)
+		}
+
+		var buf bytes.Buffer
+		if err := f.WriteObject(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		g, err := NewFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(relocSymbols(t, g), relocs) {
+			t.Errorf("written relocations refer to %v, want %v", relocSymbols(t, g), relocs)
+		}
+		var names []string
+		for _, s := range g.Symbols {
+			names = append(names, s.Name)
+		}
+		want := []string{long, ".text", ".bss", ".rdata", ".xdata", ".pdata", "__main", "puts", "extra"}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("got symbols %q, want %q", names, want)
+		}
+		if s := g.Symbols[6]; s.Value != 0x10 || s.SectionNumber != 1 {
+			t.Errorf("redefined symbol = %+v", s)
+		}
+		f.Close()
+	}
+}
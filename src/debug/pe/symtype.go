@@ -0,0 +1,197 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import "strconv"
+
+// Storage classes of COFF symbols.
+const (
+	IMAGE_SYM_CLASS_END_OF_FUNCTION  = 0xff
+	IMAGE_SYM_CLASS_NULL             = 0
+	IMAGE_SYM_CLASS_AUTOMATIC        = 1
+	IMAGE_SYM_CLASS_EXTERNAL         = 2
+	IMAGE_SYM_CLASS_STATIC           = 3
+	IMAGE_SYM_CLASS_REGISTER         = 4
+	IMAGE_SYM_CLASS_EXTERNAL_DEF     = 5
+	IMAGE_SYM_CLASS_LABEL            = 6
+	IMAGE_SYM_CLASS_UNDEFINED_LABEL  = 7
+	IMAGE_SYM_CLASS_MEMBER_OF_STRUCT = 8
+	IMAGE_SYM_CLASS_ARGUMENT         = 9
+	IMAGE_SYM_CLASS_STRUCT_TAG       = 10
+	IMAGE_SYM_CLASS_MEMBER_OF_UNION  = 11
+	IMAGE_SYM_CLASS_UNION_TAG        = 12
+	IMAGE_SYM_CLASS_TYPE_DEFINITION  = 13
+	IMAGE_SYM_CLASS_UNDEFINED_STATIC = 14
+	IMAGE_SYM_CLASS_ENUM_TAG         = 15
+	IMAGE_SYM_CLASS_MEMBER_OF_ENUM   = 16
+	IMAGE_SYM_CLASS_REGISTER_PARAM   = 17
+	IMAGE_SYM_CLASS_BIT_FIELD        = 18
+	IMAGE_SYM_CLASS_BLOCK            = 100
+	IMAGE_SYM_CLASS_FUNCTION         = 101
+	IMAGE_SYM_CLASS_END_OF_STRUCT    = 102
+	IMAGE_SYM_CLASS_FILE             = 103
+	IMAGE_SYM_CLASS_SECTION          = 104
+	IMAGE_SYM_CLASS_WEAK_EXTERNAL    = 105
+	IMAGE_SYM_CLASS_CLR_TOKEN        = 107
+)
+
+// Base types of COFF symbols, in the low 4 bits of the type.
+const (
+	IMAGE_SYM_TYPE_NULL   = 0
+	IMAGE_SYM_TYPE_VOID   = 1
+	IMAGE_SYM_TYPE_CHAR   = 2
+	IMAGE_SYM_TYPE_SHORT  = 3
+	IMAGE_SYM_TYPE_INT    = 4
+	IMAGE_SYM_TYPE_LONG   = 5
+	IMAGE_SYM_TYPE_FLOAT  = 6
+	IMAGE_SYM_TYPE_DOUBLE = 7
+	IMAGE_SYM_TYPE_STRUCT = 8
+	IMAGE_SYM_TYPE_UNION  = 9
+	IMAGE_SYM_TYPE_ENUM   = 10
+	IMAGE_SYM_TYPE_MOE    = 11
+	IMAGE_SYM_TYPE_BYTE   = 12
+	IMAGE_SYM_TYPE_WORD   = 13
+	IMAGE_SYM_TYPE_UINT   = 14
+	IMAGE_SYM_TYPE_DWORD  = 15
+)
+
+// Derived types of COFF symbols, in 2-bit fields
+// above the base type.
+const (
+	IMAGE_SYM_DTYPE_NULL     = 0
+	IMAGE_SYM_DTYPE_POINTER  = 1
+	IMAGE_SYM_DTYPE_FUNCTION = 2
+	IMAGE_SYM_DTYPE_ARRAY    = 3
+)
+
+var symClassNames = map[uint8]string{
+	IMAGE_SYM_CLASS_END_OF_FUNCTION:  "IMAGE_SYM_CLASS_END_OF_FUNCTION",
+	IMAGE_SYM_CLASS_NULL:             "IMAGE_SYM_CLASS_NULL",
+	IMAGE_SYM_CLASS_AUTOMATIC:        "IMAGE_SYM_CLASS_AUTOMATIC",
+	IMAGE_SYM_CLASS_EXTERNAL:         "IMAGE_SYM_CLASS_EXTERNAL",
+	IMAGE_SYM_CLASS_STATIC:           "IMAGE_SYM_CLASS_STATIC",
+	IMAGE_SYM_CLASS_REGISTER:         "IMAGE_SYM_CLASS_REGISTER",
+	IMAGE_SYM_CLASS_EXTERNAL_DEF:     "IMAGE_SYM_CLASS_EXTERNAL_DEF",
+	IMAGE_SYM_CLASS_LABEL:            "IMAGE_SYM_CLASS_LABEL",
+	IMAGE_SYM_CLASS_UNDEFINED_LABEL:  "IMAGE_SYM_CLASS_UNDEFINED_LABEL",
+	IMAGE_SYM_CLASS_MEMBER_OF_STRUCT: "IMAGE_SYM_CLASS_MEMBER_OF_STRUCT",
+	IMAGE_SYM_CLASS_ARGUMENT:         "IMAGE_SYM_CLASS_ARGUMENT",
+	IMAGE_SYM_CLASS_STRUCT_TAG:       "IMAGE_SYM_CLASS_STRUCT_TAG",
+	IMAGE_SYM_CLASS_MEMBER_OF_UNION:  "IMAGE_SYM_CLASS_MEMBER_OF_UNION",
+	IMAGE_SYM_CLASS_UNION_TAG:        "IMAGE_SYM_CLASS_UNION_TAG",
+	IMAGE_SYM_CLASS_TYPE_DEFINITION:  "IMAGE_SYM_CLASS_TYPE_DEFINITION",
+	IMAGE_SYM_CLASS_UNDEFINED_STATIC: "IMAGE_SYM_CLASS_UNDEFINED_STATIC",
+	IMAGE_SYM_CLASS_ENUM_TAG:         "IMAGE_SYM_CLASS_ENUM_TAG",
+	IMAGE_SYM_CLASS_MEMBER_OF_ENUM:   "IMAGE_SYM_CLASS_MEMBER_OF_ENUM",
+	IMAGE_SYM_CLASS_REGISTER_PARAM:   "IMAGE_SYM_CLASS_REGISTER_PARAM",
+	IMAGE_SYM_CLASS_BIT_FIELD:        "IMAGE_SYM_CLASS_BIT_FIELD",
+	IMAGE_SYM_CLASS_BLOCK:            "IMAGE_SYM_CLASS_BLOCK",
+	IMAGE_SYM_CLASS_FUNCTION:         "IMAGE_SYM_CLASS_FUNCTION",
+	IMAGE_SYM_CLASS_END_OF_STRUCT:    "IMAGE_SYM_CLASS_END_OF_STRUCT",
+	IMAGE_SYM_CLASS_FILE:             "IMAGE_SYM_CLASS_FILE",
+	IMAGE_SYM_CLASS_SECTION:          "IMAGE_SYM_CLASS_SECTION",
+	IMAGE_SYM_CLASS_WEAK_EXTERNAL:    "IMAGE_SYM_CLASS_WEAK_EXTERNAL",
+	IMAGE_SYM_CLASS_CLR_TOKEN:        "IMAGE_SYM_CLASS_CLR_TOKEN",
+}
+
+var symTypeNames = [16]string{
+	"IMAGE_SYM_TYPE_NULL",
+	"IMAGE_SYM_TYPE_VOID",
+	"IMAGE_SYM_TYPE_CHAR",
+	"IMAGE_SYM_TYPE_SHORT",
+	"IMAGE_SYM_TYPE_INT",
+	"IMAGE_SYM_TYPE_LONG",
+	"IMAGE_SYM_TYPE_FLOAT",
+	"IMAGE_SYM_TYPE_DOUBLE",
+	"IMAGE_SYM_TYPE_STRUCT",
+	"IMAGE_SYM_TYPE_UNION",
+	"IMAGE_SYM_TYPE_ENUM",
+	"IMAGE_SYM_TYPE_MOE",
+	"IMAGE_SYM_TYPE_BYTE",
+	"IMAGE_SYM_TYPE_WORD",
+	"IMAGE_SYM_TYPE_UINT",
+	"IMAGE_SYM_TYPE_DWORD",
+}
+
+var symDTypeNames = [4]string{
+	"IMAGE_SYM_DTYPE_NULL",
+	"IMAGE_SYM_DTYPE_POINTER",
+	"IMAGE_SYM_DTYPE_FUNCTION",
+	"IMAGE_SYM_DTYPE_ARRAY",
+}
+
+// SymbolClassString returns the name of the storage class class,
+// such as "IMAGE_SYM_CLASS_EXTERNAL", or the class in decimal
+// if it is unknown.
+func SymbolClassString(class uint8) string {
+	if s, ok := symClassNames[class]; ok {
+		return s
+	}
+	return strconv.Itoa(int(class))
+}
+
+// SymbolTypeString returns the name of the complex type typ:
+// the names of its derived types, outermost first, followed by
+// the name of its base type, separated by spaces. For example,
+// 0x20, the type compilers give functions, is
+// "IMAGE_SYM_DTYPE_FUNCTION IMAGE_SYM_TYPE_NULL".
+func SymbolTypeString(typ uint16) string {
+	var s string
+	for d := typ >> 4; d != 0; d >>= 2 {
+		s += symDTypeNames[d&3] + " "
+	}
+	return s + symTypeNames[typ&0xf]
+}
+
+// BaseType returns the base type of the complex
+// type of s, one of the IMAGE_SYM_TYPE_* values.
+func (s *Symbol) BaseType() uint16 {
+	return s.Type & 0xf
+}
+
+// DerivedType returns the outermost derived type of the
+// complex type of s, one of the IMAGE_SYM_DTYPE_* values.
+func (s *Symbol) DerivedType() uint16 {
+	return s.Type >> 4 & 3
+}
+
+// IsFunction reports whether s is a function
+// according to its type. Microsoft tools set only
+// this bit of the type, to 0x20, for functions.
+func (s *Symbol) IsFunction() bool {
+	return s.DerivedType() == IMAGE_SYM_DTYPE_FUNCTION
+}
+
+// Special values of Symbol.SectionNumber. Other
+// values are 1-based indexes in File.Sections.
+const (
+	IMAGE_SYM_UNDEFINED = 0  // defined elsewhere, or common data
+	IMAGE_SYM_ABSOLUTE  = -1 // Value is an absolute value, not an address
+	IMAGE_SYM_DEBUG     = -2 // a debugging symbol, such as .file
+)
+
+// IsUndefined reports whether s is not defined in its file. An
+// external undefined symbol with a non-zero Value is a common
+// symbol, which the linker allocates Value bytes for.
+func (s *Symbol) IsUndefined() bool {
+	return s.FullSectionNumber() == IMAGE_SYM_UNDEFINED
+}
+
+// IsCommon reports whether s is a common symbol.
+func (s *Symbol) IsCommon() bool {
+	return s.IsUndefined() && s.StorageClass == IMAGE_SYM_CLASS_EXTERNAL && s.Value != 0
+}
+
+// IsAbsolute reports whether the Value of s is an
+// absolute value rather than an offset in a section.
+func (s *Symbol) IsAbsolute() bool {
+	return s.FullSectionNumber() == IMAGE_SYM_ABSOLUTE
+}
+
+// IsDebug reports whether s only carries debugging
+// or general information, such as a source file name.
+func (s *Symbol) IsDebug() bool {
+	return s.FullSectionNumber() == IMAGE_SYM_DEBUG
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// TEHeader is the header of a Terse Executable (TE) image
+// (EFI_TE_IMAGE_HEADER), the stripped-down PE format used in UEFI
+// firmware volumes. It replaces the MS-DOS header, COFF file header
+// and optional header of the PE image the TE image was made from,
+// and is directly followed by the section table.
+type TEHeader struct {
+	Signature           uint16 // "VZ"
+	Machine             uint16
+	NumberOfSections    uint8
+	Subsystem           uint8
+	StrippedSize        uint16 // size of the PE headers the TE header replaces
+	AddressOfEntryPoint uint32
+	BaseOfCode          uint32
+	ImageBase           uint64
+	DataDirectory       [2]DataDirectory // base relocation and debug directories
+}
+
+// teHeaderSize is the size of EFI_TE_IMAGE_HEADER.
+const teHeaderSize = 40
+
+// isTE reports whether sig is the start of a TE image.
+func isTE(sig []byte) bool {
+	return sig[0] == 'V' && sig[1] == 'Z'
+}
+
+// readTEHeader reads the header of the TE image f and maps it onto
+// f.FileHeader and an f.OptionalHeader holding the fields the TE
+// header keeps. The optional header is an *OptionalHeader64 for
+// 64-bit machines and an *OptionalHeader32 otherwise.
+func (f *File) readTEHeader() error {
+	h := new(TEHeader)
+	if err := binary.Read(io.NewSectionReader(f.r, 0, teHeaderSize), binary.LittleEndian, h); err != nil {
+		return formatError(0, "TE header", err)
+	}
+	if h.StrippedSize < teHeaderSize {
+		return &FormatError{6, "TE header", errors.New("StrippedSize smaller than the TE header"), h.StrippedSize}
+	}
+	f.TEHeader = h
+	f.FileHeader = FileHeader{
+		Machine:          h.Machine,
+		NumberOfSections: uint16(h.NumberOfSections),
+	}
+	switch h.Machine {
+	case IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_IA64:
+		oh := &OptionalHeader64{
+			Magic:               0x20b,
+			AddressOfEntryPoint: h.AddressOfEntryPoint,
+			BaseOfCode:          h.BaseOfCode,
+			ImageBase:           h.ImageBase,
+			Subsystem:           uint16(h.Subsystem),
+			NumberOfRvaAndSizes: 16,
+		}
+		oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC] = h.DataDirectory[0]
+		oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_DEBUG] = h.DataDirectory[1]
+		f.OptionalHeader = oh
+	default:
+		oh := &OptionalHeader32{
+			Magic:               0x10b,
+			AddressOfEntryPoint: h.AddressOfEntryPoint,
+			BaseOfCode:          h.BaseOfCode,
+			ImageBase:           uint32(h.ImageBase),
+			Subsystem:           uint16(h.Subsystem),
+			NumberOfRvaAndSizes: 16,
+		}
+		oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC] = h.DataDirectory[0]
+		oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_DEBUG] = h.DataDirectory[1]
+		f.OptionalHeader = oh
+	}
+	return nil
+}
+
+// teOffset converts off, a file offset in the PE image the TE
+// image f was made from, to the offset of the same data in f.
+func (f *File) teOffset(off uint32) (uint32, error) {
+	stripped := uint32(f.TEHeader.StrippedSize) - teHeaderSize
+	if off < teHeaderSize+stripped {
+		return 0, &FormatError{-1, "TE image", errors.New("data offset within stripped headers"), off}
+	}
+	return off - stripped, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+)
+
+// makeTE converts the PE image in file to a TE image,
+// as the EDK II GenFw tool does.
+func makeTE(t *testing.T, file string) (*File, []byte) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oh := f.OptionalHeader.(*OptionalHeader64)
+	sectab := f.HeaderLayout().SectionTable.Offset
+	h := TEHeader{
+		Signature:           0x5a56,
+		Machine:             f.Machine,
+		NumberOfSections:    uint8(len(f.Sections)),
+		Subsystem:           uint8(oh.Subsystem),
+		StrippedSize:        uint16(sectab),
+		AddressOfEntryPoint: oh.AddressOfEntryPoint,
+		BaseOfCode:          oh.BaseOfCode,
+		ImageBase:           oh.ImageBase,
+		DataDirectory:       [2]DataDirectory{oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC], oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_DEBUG]},
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &h)
+	buf.Write(raw[sectab:])
+	return f, buf.Bytes()
+}
+
+func TestTE(t *testing.T) {
+	pf, te := makeTE(t, "testdata/gcc-amd64-mingw-exec")
+	f, err := NewFile(bytes.NewReader(te))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.TEHeader == nil {
+		t.Fatal("TEHeader is nil")
+	}
+	if f.Machine != pf.Machine || len(f.Sections) != len(pf.Sections) {
+		t.Fatalf("file header = %+v, want machine %#x and %d sections", f.FileHeader, pf.Machine, len(pf.Sections))
+	}
+	oh, ok := f.OptionalHeader.(*OptionalHeader64)
+	if !ok {
+		t.Fatalf("OptionalHeader is %T, want *OptionalHeader64", f.OptionalHeader)
+	}
+	poh := pf.OptionalHeader.(*OptionalHeader64)
+	if oh.ImageBase != poh.ImageBase || oh.AddressOfEntryPoint != poh.AddressOfEntryPoint ||
+		oh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC] != poh.DataDirectory[IMAGE_DIRECTORY_ENTRY_BASERELOC] {
+		t.Errorf("optional header = %+v, want fields of %+v", oh, poh)
+	}
+	for i, s := range f.Sections {
+		ps := pf.Sections[i]
+		if s.VirtualAddress != ps.VirtualAddress || s.Size != ps.Size {
+			t.Errorf("section %d: header = %+v, want %+v", i, s.SectionHeader, ps.SectionHeader)
+		}
+		have, err := s.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ps.Data()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("section %s: data differs from the PE image", ps.Name)
+		}
+	}
+	if l := f.HeaderLayout(); l.FileHeader != (Region{0, teHeaderSize}) || l.SectionTable.Offset != teHeaderSize {
+		t.Errorf("HeaderLayout = %+v", l)
+	}
+	if kind := f.Describe().Kind; kind != "te" {
+		t.Errorf("Describe().Kind = %q, want te", kind)
+	}
+}
+
+func TestTEBadStrippedSize(t *testing.T) {
+	_, te := makeTE(t, "testdata/gcc-amd64-mingw-exec")
+	binary.LittleEndian.PutUint16(te[6:], 0x10)
+	if _, err := NewFile(bytes.NewReader(te)); err == nil {
+		t.Error("NewFile succeeded with a StrippedSize smaller than the TE header")
+	}
+	// Section data may not lie within the stripped headers.
+	binary.LittleEndian.PutUint16(te[6:], 0xf000)
+	if _, err := NewFile(bytes.NewReader(te)); err == nil {
+		t.Error("NewFile succeeded with section data within the stripped headers")
+	}
+}
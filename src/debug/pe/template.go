@@ -0,0 +1,352 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A Dialog is a dialog box template, the data of an RT_DIALOG
+// resource, in either the DLGTEMPLATE or the DLGTEMPLATEEX format.
+// Fields found only in DLGTEMPLATEEX are zero for DLGTEMPLATE.
+type Dialog struct {
+	Extended bool // DLGTEMPLATEEX
+	HelpID   uint32
+	Style    uint32
+	ExStyle  uint32
+	X, Y     int16
+	CX, CY   int16
+	Menu     ResourceID // zero if none
+	Class    ResourceID // zero for the predefined dialog class
+	Title    string
+
+	// The font fields are set if Style has DS_SETFONT or DS_SHELLFONT.
+	PointSize uint16
+	Weight    uint16
+	Italic    bool
+	CharSet   uint8
+	Font      string
+
+	Controls []DialogControl
+}
+
+// A DialogControl is a control of a Dialog
+// (DLGITEMTEMPLATE or DLGITEMTEMPLATEEX).
+type DialogControl struct {
+	HelpID  uint32
+	Style   uint32
+	ExStyle uint32
+	X, Y    int16
+	CX, CY  int16
+	ID      uint32     // 16 bits in DLGITEMTEMPLATE
+	Class   ResourceID // a name, or the atom of a predefined class
+	Title   ResourceID // text, or the ID of a resource such as an icon
+	Extra   []byte     // creation data passed to the control
+}
+
+// ClassName returns the name of the window class of c,
+// such as "Button" for the predefined class 0x80.
+func (c *DialogControl) ClassName() string {
+	if c.Class.Name == "" && c.Class.ID >= 0x80 && c.Class.ID <= 0x85 {
+		return [...]string{"Button", "Edit", "Static", "ListBox", "ScrollBar", "ComboBox"}[c.Class.ID-0x80]
+	}
+	return c.Class.String()
+}
+
+// dsSetFont is the DS_SETFONT dialog style, also part of
+// DS_SHELLFONT, which adds the font fields to a template.
+const dsSetFont = 0x40
+
+// ParseDialog parses b, the data of an RT_DIALOG resource.
+func ParseDialog(b []byte) (*Dialog, error) {
+	r := &templateReader{b: b, what: "dialog template"}
+	d := new(Dialog)
+	if len(b) >= 4 && binary.LittleEndian.Uint16(b[2:]) == 0xffff {
+		if v := r.u16(); v != 1 {
+			return nil, &FormatError{-1, r.what, errors.New("unknown version"), v}
+		}
+		r.u16()
+		d.Extended = true
+		d.HelpID = r.u32()
+		d.ExStyle = r.u32()
+		d.Style = r.u32()
+	} else {
+		d.Style = r.u32()
+		d.ExStyle = r.u32()
+	}
+	n := r.u16()
+	d.X, d.Y, d.CX, d.CY = int16(r.u16()), int16(r.u16()), int16(r.u16()), int16(r.u16())
+	d.Menu = r.szOrOrd()
+	d.Class = r.szOrOrd()
+	d.Title = r.sz()
+	if d.Style&dsSetFont != 0 {
+		d.PointSize = r.u16()
+		if d.Extended {
+			d.Weight = r.u16()
+			d.Italic = r.u8() != 0
+			d.CharSet = r.u8()
+		}
+		d.Font = r.sz()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	// Each control takes at least 18 bytes,
+	// which bounds n for truncated templates.
+	if int(n)*18 > len(b) {
+		return nil, &FormatError{-1, r.what, ErrTruncated, int(n)}
+	}
+	d.Controls = make([]DialogControl, n)
+	for i := range d.Controls {
+		c := &d.Controls[i]
+		r.align4()
+		if d.Extended {
+			c.HelpID = r.u32()
+			c.ExStyle = r.u32()
+			c.Style = r.u32()
+		} else {
+			c.Style = r.u32()
+			c.ExStyle = r.u32()
+		}
+		c.X, c.Y, c.CX, c.CY = int16(r.u16()), int16(r.u16()), int16(r.u16()), int16(r.u16())
+		if d.Extended {
+			c.ID = r.u32()
+		} else {
+			c.ID = uint32(r.u16())
+		}
+		c.Class = r.szOrOrd()
+		c.Title = r.szOrOrd()
+		if size := int(r.u16()); size > 0 {
+			c.Extra = r.bytes(size)
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+	return d, nil
+}
+
+// A Menu is a menu template, the data of an RT_MENU resource,
+// in either the MENUITEMTEMPLATE or the MENUEX_TEMPLATE format.
+type Menu struct {
+	Extended bool   // MENUEX_TEMPLATE
+	HelpID   uint32 // of the menu bar, in MENUEX_TEMPLATE
+	Items    []MenuItem
+}
+
+// A MenuItem is an item of a Menu. Items that open a submenu
+// hold its items in Items. Type, State and HelpID are found
+// only in MENUEX_TEMPLATE.
+type MenuItem struct {
+	Flags  uint16 // MF_* flags, or MFR_* flags in MENUEX_TEMPLATE
+	Type   uint32 // MFT_* flags
+	State  uint32 // MFS_* flags
+	ID     uint32 // command ID; 16 bits in MENUITEMTEMPLATE
+	HelpID uint32 // of a submenu
+	Text   string
+	Items  []MenuItem
+}
+
+// Menu item flags that structure a menu template.
+const (
+	mfPopup   = 0x10 // MF_POPUP
+	mfEnd     = 0x80 // MF_END
+	mfrPopup  = 0x01 // MFR_POPUP
+	mfrEnd    = 0x80 // MFR_END
+	menuDepth = 32   // maximum nesting of submenus
+)
+
+// ParseMenu parses b, the data of an RT_MENU resource.
+func ParseMenu(b []byte) (*Menu, error) {
+	r := &templateReader{b: b, what: "menu template"}
+	m := new(Menu)
+	version := r.u16()
+	off := r.u16()
+	switch version {
+	case 0:
+		r.bytes(int(off))
+	case 1:
+		if off < 4 {
+			return nil, &FormatError{-1, r.what, ErrOutOfBounds, int(off)}
+		}
+		m.Extended = true
+		m.HelpID = r.u32()
+		r.bytes(int(off) - 4)
+	default:
+		return nil, &FormatError{-1, r.what, errors.New("unknown version"), int(version)}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.off == len(b) {
+		return m, nil
+	}
+	var err error
+	m.Items, err = r.menuItems(m.Extended, 0)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// menuItems reads the items of a menu up to
+// and including the one flagged as the last.
+func (r *templateReader) menuItems(extended bool, depth int) ([]MenuItem, error) {
+	if depth > menuDepth {
+		return nil, &FormatError{-1, r.what, errors.New("submenus nested too deeply"), depth}
+	}
+	var items []MenuItem
+	for {
+		var it MenuItem
+		var popup, end bool
+		if extended {
+			r.align4()
+			it.Type = r.u32()
+			it.State = r.u32()
+			it.ID = r.u32()
+			it.Flags = r.u16()
+			it.Text = r.sz()
+			popup, end = it.Flags&mfrPopup != 0, it.Flags&mfrEnd != 0
+			if popup {
+				r.align4()
+				it.HelpID = r.u32()
+			}
+		} else {
+			it.Flags = r.u16()
+			popup, end = it.Flags&mfPopup != 0, it.Flags&mfEnd != 0
+			if !popup {
+				it.ID = uint32(r.u16())
+			}
+			it.Text = r.sz()
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		if popup {
+			var err error
+			if it.Items, err = r.menuItems(extended, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, it)
+		if end {
+			return items, nil
+		}
+	}
+}
+
+// An Accelerator is an entry of a keyboard accelerator table,
+// the data of an RT_ACCELERATOR resource (ACCELTABLEENTRY).
+type Accelerator struct {
+	Flags uint16 // FVIRTKEY, FSHIFT, FCONTROL, FALT and FNOINVERT
+	Key   uint16 // a virtual-key code if Flags has FVIRTKEY, a character otherwise
+	ID    uint16 // the command ID
+}
+
+// ParseAccelerators parses b, the data of an RT_ACCELERATOR
+// resource. The table ends with the entry flagged as the last,
+// or with the data.
+func ParseAccelerators(b []byte) ([]Accelerator, error) {
+	if len(b)%8 != 0 {
+		return nil, &FormatError{-1, "accelerator table", ErrTruncated, len(b)}
+	}
+	var accels []Accelerator
+	for ; len(b) > 0; b = b[8:] {
+		a := Accelerator{
+			Flags: binary.LittleEndian.Uint16(b[0:]),
+			Key:   binary.LittleEndian.Uint16(b[2:]),
+			ID:    binary.LittleEndian.Uint16(b[4:]),
+		}
+		accels = append(accels, a)
+		if a.Flags&0x80 != 0 {
+			break
+		}
+	}
+	return accels, nil
+}
+
+// A templateReader reads the fields of a resource template in b,
+// which are aligned relative to its start. The first error is
+// kept in err, after which reads return zero values.
+type templateReader struct {
+	b    []byte
+	off  int
+	what string
+	err  error
+}
+
+func (r *templateReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.b)-r.off {
+		r.err = &FormatError{-1, r.what, ErrTruncated, r.off}
+		return nil
+	}
+	p := r.b[r.off : r.off+n : r.off+n]
+	r.off += n
+	return p
+}
+
+func (r *templateReader) u8() uint8 {
+	if p := r.bytes(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (r *templateReader) u16() uint16 {
+	if p := r.bytes(2); p != nil {
+		return binary.LittleEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (r *templateReader) u32() uint32 {
+	if p := r.bytes(4); p != nil {
+		return binary.LittleEndian.Uint32(p)
+	}
+	return 0
+}
+
+// align4 skips to the next multiple of 4 bytes,
+// which may be the end of the template.
+func (r *templateReader) align4() {
+	if r.err == nil && align4(r.off) <= len(r.b) {
+		r.off = align4(r.off)
+	}
+}
+
+// szOrOrd reads a sz_Or_Ord field: a string, an integer ID
+// or, if it starts with a zero word, nothing.
+func (r *templateReader) szOrOrd() ResourceID {
+	if r.err != nil {
+		return ResourceID{}
+	}
+	id, n, err := readSzOrOrd(r.b[r.off:])
+	if err != nil {
+		r.err = &FormatError{-1, r.what, err, r.off}
+		return ResourceID{}
+	}
+	r.off += n
+	return id
+}
+
+// sz reads a NUL-terminated UTF-16 string.
+func (r *templateReader) sz() string {
+	if r.err != nil {
+		return ""
+	}
+	for i := r.off; i+2 <= len(r.b); i += 2 {
+		if binary.LittleEndian.Uint16(r.b[i:]) == 0 {
+			s := decodeUTF16(r.b[r.off:i])
+			r.off = i + 2
+			return s
+		}
+	}
+	r.err = &FormatError{-1, r.what, ErrTruncated, r.off}
+	return ""
+}
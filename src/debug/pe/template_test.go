@@ -0,0 +1,249 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+// A templateWriter builds resource templates for tests.
+type templateWriter []byte
+
+func (w *templateWriter) u16(vs ...uint16) {
+	for _, v := range vs {
+		*w = append(*w, byte(v), byte(v>>8))
+	}
+}
+
+func (w *templateWriter) u32(vs ...uint32) {
+	for _, v := range vs {
+		*w = append(*w, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+}
+
+func (w *templateWriter) sz(s string) {
+	w.u16(utf16.Encode([]rune(s))...)
+	w.u16(0)
+}
+
+func (w *templateWriter) align4() {
+	for len(*w)%4 != 0 {
+		*w = append(*w, 0)
+	}
+}
+
+func TestParseDialog(t *testing.T) {
+	// A DLGTEMPLATE with a font and two controls.
+	var w templateWriter
+	w.u32(0x80c800c0, 0) // WS_POPUP|WS_CAPTION|WS_SYSMENU|DS_MODALFRAME|DS_SETFONT
+	w.u16(2, 10, 20, 200, 100)
+	w.u16(0)      // no menu
+	w.u16(0)      // dialog class
+	w.sz("About") // title
+	w.u16(8)
+	w.sz("MS Shell Dlg")
+	w.align4()
+	w.u32(0x50010001, 0) // BS_DEFPUSHBUTTON|WS_TABSTOP|WS_VISIBLE|WS_CHILD
+	w.u16(140, 80, 50, 14, 1)
+	w.u16(0xffff, 0x80)
+	w.sz("OK")
+	w.u16(0)
+	w.align4()
+	w.u32(0x50000003, 0) // SS_ICON
+	w.u16(10, 10, 20, 20, 0xffff)
+	w.u16(0xffff, 0x82)
+	w.u16(0xffff, 101)
+	w.u16(2, 0xabcd)
+	d, err := ParseDialog(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Dialog{
+		Style: 0x80c800c0,
+		X:     10, Y: 20, CX: 200, CY: 100,
+		Title:     "About",
+		PointSize: 8,
+		Font:      "MS Shell Dlg",
+		Controls: []DialogControl{
+			{Style: 0x50010001, X: 140, Y: 80, CX: 50, CY: 14, ID: 1, Class: ResourceID{ID: 0x80}, Title: ResourceID{Name: "OK"}},
+			{Style: 0x50000003, X: 10, Y: 10, CX: 20, CY: 20, ID: 0xffff, Class: ResourceID{ID: 0x82}, Title: ResourceID{ID: 101}, Extra: []byte{0xcd, 0xab}},
+		},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("ParseDialog = %+v, want %+v", d, want)
+	}
+	if name := d.Controls[1].ClassName(); name != "Static" {
+		t.Errorf("ClassName = %q, want Static", name)
+	}
+	for n := 0; n < len(w)-2; n++ {
+		if _, err := ParseDialog(w[:n]); err == nil {
+			t.Errorf("ParseDialog accepted %d of %d bytes", n, len(w))
+		}
+	}
+}
+
+func TestParseDialogEx(t *testing.T) {
+	// A DLGTEMPLATEEX with a menu, a class and one control.
+	var w templateWriter
+	w.u16(1, 0xffff)
+	w.u32(7, 0x100, 0x10c80048) // help ID, WS_EX_WINDOWEDGE, DS_SHELLFONT
+	w.u16(1, 0, 0, 300, 200)
+	w.u16(0xffff, 5) // menu 5
+	w.sz("MyDialog")
+	w.sz("Settings")
+	w.u16(9, 400)
+	w = append(w, 1, 0) // italic, ANSI_CHARSET
+	w.sz("Segoe UI")
+	w.align4()
+	w.u32(0, 0x200, 0x50010000) // WS_EX_CLIENTEDGE
+	w.u16(5, 5, 100, 12)
+	w.u32(1001)
+	w.sz("SysListView32")
+	w.u16(0)
+	w.u16(0)
+	d, err := ParseDialog(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Dialog{
+		Extended: true,
+		HelpID:   7,
+		ExStyle:  0x100,
+		Style:    0x10c80048,
+		CX:       300, CY: 200,
+		Menu:      ResourceID{ID: 5},
+		Class:     ResourceID{Name: "MyDialog"},
+		Title:     "Settings",
+		PointSize: 9,
+		Weight:    400,
+		Italic:    true,
+		Font:      "Segoe UI",
+		Controls: []DialogControl{
+			{ExStyle: 0x200, Style: 0x50010000, X: 5, Y: 5, CX: 100, CY: 12, ID: 1001, Class: ResourceID{Name: "SysListView32"}},
+		},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("ParseDialog = %+v, want %+v", d, want)
+	}
+	if name := d.Controls[0].ClassName(); name != "SysListView32" {
+		t.Errorf("ClassName = %q, want SysListView32", name)
+	}
+
+	w[0] = 2
+	if _, err := ParseDialog(w); err == nil {
+		t.Error("ParseDialog accepted DLGTEMPLATEEX version 2")
+	}
+}
+
+func TestParseMenu(t *testing.T) {
+	var w templateWriter
+	w.u16(0, 0)
+	w.u16(0x10) // MF_POPUP
+	w.sz("&File")
+	w.u16(0, 100)
+	w.sz("&Open")
+	w.u16(0x800, 0) // MF_SEPARATOR
+	w.sz("")
+	w.u16(0x80, 101) // MF_END
+	w.sz("E&xit")
+	w.u16(0x90) // MF_POPUP|MF_END
+	w.sz("&Help")
+	w.u16(0x81, 200) // MF_GRAYED|MF_END
+	w.sz("&About")
+	m, err := ParseMenu(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Menu{
+		Items: []MenuItem{
+			{Flags: 0x10, Text: "&File", Items: []MenuItem{
+				{ID: 100, Text: "&Open"},
+				{Flags: 0x800},
+				{Flags: 0x80, ID: 101, Text: "E&xit"},
+			}},
+			{Flags: 0x90, Text: "&Help", Items: []MenuItem{
+				{Flags: 0x81, ID: 200, Text: "&About"},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseMenu = %+v, want %+v", m, want)
+	}
+	// A header alone is an empty menu.
+	for n := 5; n < len(w); n++ {
+		if _, err := ParseMenu(w[:n]); err == nil {
+			t.Errorf("ParseMenu accepted %d of %d bytes", n, len(w))
+		}
+	}
+
+	// A popup that opens itself until the nesting limit.
+	w = templateWriter{}
+	w.u16(0, 0)
+	for i := 0; i < 100; i++ {
+		w.u16(0x10)
+		w.sz("x")
+	}
+	if _, err := ParseMenu(w); err == nil {
+		t.Error("ParseMenu accepted deeply nested submenus")
+	}
+}
+
+func TestParseMenuEx(t *testing.T) {
+	var w templateWriter
+	w.u16(1, 4)
+	w.u32(9) // help ID
+	w.u32(0, 0, 0)
+	w.u16(0x81) // MFR_POPUP|MFR_END
+	w.sz("&Edit")
+	w.align4()
+	w.u32(10)        // help ID of the submenu
+	w.u32(0, 3, 300) // MFS_DISABLED
+	w.u16(0)
+	w.sz("&Undo")
+	w.align4()
+	w.u32(0x800, 0, 0) // MFT_SEPARATOR
+	w.u16(0x80)
+	w.sz("")
+	m, err := ParseMenu(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Menu{
+		Extended: true,
+		HelpID:   9,
+		Items: []MenuItem{
+			{Flags: 0x81, Text: "&Edit", HelpID: 10, Items: []MenuItem{
+				{State: 3, ID: 300, Text: "&Undo"},
+				{Type: 0x800, Flags: 0x80},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseMenu = %+v, want %+v", m, want)
+	}
+}
+
+func TestParseAccelerators(t *testing.T) {
+	var w templateWriter
+	w.u16(0x09, 'O', 100, 0)  // FVIRTKEY|FCONTROL
+	w.u16(0x91, 0x73, 101, 0) // FVIRTKEY|FALT|last, VK_F4
+	w.u16(0, 'x', 102, 0)     // after the last entry
+	a, err := ParseAccelerators(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Accelerator{
+		{Flags: 0x09, Key: 'O', ID: 100},
+		{Flags: 0x91, Key: 0x73, ID: 101},
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("ParseAccelerators = %+v, want %+v", a, want)
+	}
+	if _, err := ParseAccelerators(w[:12]); err == nil {
+		t.Error("ParseAccelerators accepted a partial entry")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Toolchain is the family of compilers and
+// linkers that built an image. See ToolchainInfo.
+type Toolchain int
+
+const (
+	ToolchainUnknown Toolchain = iota
+	ToolchainMSVC              // Microsoft Visual C++ and link.exe
+	ToolchainMinGW             // GCC and the GNU linker, for the Windows C runtime
+	ToolchainClang             // Clang and LLD
+	ToolchainCygwin            // GCC for the Cygwin or MSYS runtime
+	ToolchainGo                // the Go toolchain
+)
+
+var toolchainNames = [...]string{
+	"unknown",
+	"MSVC",
+	"mingw-gcc",
+	"clang",
+	"cygwin",
+	"Go",
+}
+
+func (t Toolchain) String() string {
+	if t >= 0 && int(t) < len(toolchainNames) {
+		return toolchainNames[t]
+	}
+	return "Toolchain(" + strconv.Itoa(int(t)) + ")"
+}
+
+// A ToolchainInfo is the toolchain that built an image,
+// as guessed by File.Toolchain, and the evidence for it.
+type ToolchainInfo struct {
+	Toolchain Toolchain
+
+	// Runtimes lists the runtime DLLs the image imports,
+	// such as cygwin1.dll, msys-2.0.dll or ucrtbase.dll,
+	// in lower case and sorted.
+	Runtimes []string
+
+	Linker string // the linker version, such as "2.30"
+	Rich   bool   // the MS-DOS stub holds a Rich header
+	DWARF  bool   // the image has .debug_* sections
+
+	// Evidence lists the facts the classification rests on.
+	Evidence []string
+}
+
+// runtimeDLLPrefixes lists the prefixes of the names of the
+// runtime DLLs that Toolchain reports, with the toolchain
+// importing each implies, if any.
+var runtimeDLLPrefixes = []struct {
+	prefix    string
+	toolchain Toolchain
+}{
+	{"cygwin1.dll", ToolchainCygwin},
+	{"msys-", ToolchainCygwin},
+	{"msvcrt.dll", ToolchainUnknown},
+	{"msvcr", ToolchainUnknown},
+	{"msvcp", ToolchainUnknown},
+	{"vcruntime", ToolchainUnknown},
+	{"ucrtbase", ToolchainUnknown},
+	{"api-ms-win-crt-", ToolchainUnknown},
+	{"libgcc_s_", ToolchainMinGW},
+	{"libstdc++-", ToolchainMinGW},
+	{"libc++.dll", ToolchainClang},
+	{"libunwind.dll", ToolchainClang},
+}
+
+// Toolchain guesses the toolchain that built the image f, as
+// triage tools do, from the conventions of each:
+//
+//   - Go binaries have Go build information or a Go line table,
+//     even when linked externally.
+//   - Cygwin and MSYS binaries import cygwin1.dll or msys-*.dll,
+//     or, for the runtime itself, have a .cygheap section.
+//   - The Microsoft linker hides a Rich header in the MS-DOS stub.
+//   - The GNU linker sets the linker version of the optional
+//     header to its own, 2.x; LLD sets 14.0 but writes no Rich
+//     header. Binaries that import libgcc or libc++ are taken as
+//     built by GCC or Clang whatever the linker.
+//
+// Binaries built by another compiler with one of these linkers are
+// reported as built by the linker's toolchain. Toolchain returns
+// ToolchainUnknown for object files, which have no linker version.
+func (f *File) Toolchain() (*ToolchainInfo, error) {
+	info := new(ToolchainInfo)
+	oh := f.optionalHeader()
+	if oh == nil {
+		return info, nil
+	}
+	var major, minor uint8
+	switch oh := f.OptionalHeader.(type) {
+	case *OptionalHeader32:
+		major, minor = oh.MajorLinkerVersion, oh.MinorLinkerVersion
+	case *OptionalHeader64:
+		major, minor = oh.MajorLinkerVersion, oh.MinorLinkerVersion
+	}
+	info.Linker = strconv.Itoa(int(major)) + "." + strconv.Itoa(int(minor))
+	info.Rich = bytes.Contains(f.DOSStub, []byte("Rich"))
+	for _, s := range f.Sections {
+		if strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+			info.DWARF = true
+		}
+	}
+
+	imports, err := f.Imports()
+	if err != nil {
+		return nil, err
+	}
+	implied := ToolchainUnknown
+	seen := make(map[string]bool)
+	for _, imp := range imports {
+		dll := strings.ToLower(imp.DLL)
+		if seen[dll] {
+			continue
+		}
+		seen[dll] = true
+		for _, rt := range runtimeDLLPrefixes {
+			if strings.HasPrefix(dll, rt.prefix) {
+				info.Runtimes = append(info.Runtimes, dll)
+				if implied == ToolchainUnknown && rt.toolchain != ToolchainUnknown {
+					implied = rt.toolchain
+					info.Evidence = append(info.Evidence, "imports "+dll)
+				}
+				break
+			}
+		}
+	}
+	sort.Strings(info.Runtimes)
+
+	_, buildInfo, err := f.GoBuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	var pclntab []byte
+	if buildInfo == nil {
+		if _, pclntab, err = f.GoPCLNTab(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case buildInfo != nil:
+		info.Toolchain = ToolchainGo
+		info.Evidence = []string{"Go build information"}
+	case pclntab != nil:
+		info.Toolchain = ToolchainGo
+		info.Evidence = []string{"Go line table"}
+	case implied == ToolchainCygwin:
+		info.Toolchain = ToolchainCygwin
+	case f.Section(".cygheap") != nil:
+		info.Toolchain = ToolchainCygwin
+		info.Evidence = append(info.Evidence, ".cygheap section")
+	case implied != ToolchainUnknown:
+		info.Toolchain = implied
+	case info.Rich:
+		info.Toolchain = ToolchainMSVC
+		info.Evidence = append(info.Evidence, "Rich header")
+	case major == 2:
+		info.Toolchain = ToolchainMinGW
+		info.Evidence = append(info.Evidence, "GNU linker version "+info.Linker)
+	case major == 14:
+		info.Toolchain = ToolchainClang
+		info.Evidence = append(info.Evidence, "linker version "+info.Linker+" without Rich header")
+	}
+	return info, nil
+}
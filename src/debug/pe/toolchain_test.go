@@ -0,0 +1,84 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestToolchain(t *testing.T) {
+	mingw, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(mingw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cygwin bytes.Buffer
+	if err := f.WriteWithImports(&cygwin, []Import{{DLL: "cygwin1.dll", Name: "cygwin_internal"}}); err != nil {
+		t.Fatal(err)
+	}
+	// The linker version follows the magic number
+	// of the optional header.
+	linker := int(f.DOSHeader.Lfanew) + 4 + 20 + 2
+	msvc := append([]byte(nil), mingw...)
+	copy(msvc[0x70:], "Rich") // in the MS-DOS stub
+	msvc[linker], msvc[linker+1] = 14, 29
+	lld := makeTestImage(make([]byte, 16), nil)
+	lld[0x40+4+20+2] = 14
+	goData := append(make([]byte, 16), buildInfoMagic...)
+	goBin := makeTestImage(append(goData, make([]byte, 16)...), nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		want Toolchain
+		rich bool
+	}{
+		{"mingw", mingw, ToolchainMinGW, false},
+		{"cygwin", cygwin.Bytes(), ToolchainCygwin, false},
+		{"msvc", msvc, ToolchainMSVC, true},
+		{"lld", lld, ToolchainClang, false},
+		{"go", goBin, ToolchainGo, false},
+	}
+	for _, tt := range tests {
+		f, err := NewFile(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		info, err := f.Toolchain()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if info.Toolchain != tt.want || info.Rich != tt.rich || len(info.Evidence) == 0 {
+			t.Errorf("%s: Toolchain() = %+v, want %v", tt.name, info, tt.want)
+		}
+	}
+
+	info, err := f.Toolchain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info.Runtimes, []string{"msvcrt.dll"}) || info.Linker[:2] != "2." || !info.DWARF {
+		t.Errorf("mingw: Toolchain() = %+v", info)
+	}
+	if s := ToolchainMinGW.String(); s != "mingw-gcc" {
+		t.Errorf("ToolchainMinGW.String() = %q", s)
+	}
+
+	obj, err := Open("testdata/gcc-amd64-mingw-obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if info, err := obj.Toolchain(); err != nil || info.Toolchain != ToolchainUnknown {
+		t.Errorf("object: Toolchain() = %+v, %v", info, err)
+	}
+}
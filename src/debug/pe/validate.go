@@ -0,0 +1,226 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Severity ranks a Finding of Validate.
+type Severity int
+
+const (
+	// SeverityInfo marks something unusual but harmless.
+	SeverityInfo Severity = iota
+
+	// SeverityWarning marks a violation of the specification
+	// that the Windows loader tolerates.
+	SeverityWarning
+
+	// SeverityError marks a problem that makes the loader
+	// reject the image or the image fail once loaded.
+	SeverityError
+)
+
+var severityNames = [...]string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A Finding is a problem found by Validate.
+type Finding struct {
+	Severity Severity
+	Err      *FormatError // what is wrong, and where
+}
+
+func (f Finding) String() string {
+	return f.Severity.String() + ": " + f.Err.Error()
+}
+
+// Characteristics of the file header used below.
+const (
+	fileExecutableImage = 0x0002 // IMAGE_FILE_EXECUTABLE_IMAGE
+	fileDLL             = 0x2000 // IMAGE_FILE_DLL
+)
+
+// dirReserved is the index of the last data
+// directory, which is reserved and must be zero.
+const dirReserved = IMAGE_NUMBEROF_DIRECTORY_ENTRIES - 1
+
+// Validate checks the invariants of f that matter to the Windows
+// loader and returns the problems found, most severe first, or nil
+// if there are none. It checks the file and section alignments, that
+// sections neither overlap nor extend beyond the file or the image,
+// that data directories lie within the image, that the entry point
+// is in an executable section and that reserved fields are zero.
+// Unlike opening f with ParseStrict, it reports every problem rather
+// than stopping at the first. Only the section checks apply to
+// object files and TE images.
+func (f *File) Validate() []Finding {
+	var v validator
+	oh := f.optionalHeader()
+	if oh != nil && f.TEHeader == nil {
+		v.checkHeaders(f, oh)
+	}
+	v.checkSections(f, oh)
+	if oh != nil {
+		v.checkDirectories(f, oh)
+		v.checkEntryPoint(f, oh)
+	}
+	return v.sorted()
+}
+
+// A validator collects the findings of Validate.
+type validator struct {
+	findings []Finding
+}
+
+// sorted returns the findings of v by severity, most severe
+// first, keeping the order within each severity.
+func (v *validator) sorted() []Finding {
+	var sorted []Finding
+	for sev := SeverityError; sev >= SeverityInfo; sev-- {
+		for _, fd := range v.findings {
+			if fd.Severity == sev {
+				sorted = append(sorted, fd)
+			}
+		}
+	}
+	return sorted
+}
+
+func (v *validator) add(sev Severity, off int64, what, msg string, val interface{}) {
+	v.findings = append(v.findings, Finding{sev, &FormatError{off, what, errors.New(msg), val}})
+}
+
+// checkHeaders checks the file and optional headers of the image f.
+func (v *validator) checkHeaders(f *File, oh *optionalHeaderInfo) {
+	if f.Characteristics&fileExecutableImage == 0 {
+		v.add(SeverityError, -1, "file header", "IMAGE_FILE_EXECUTABLE_IMAGE is not set", f.Characteristics)
+	}
+	fa, sa := oh.fileAlignment, oh.sectionAlignment
+	// FileAlignment may be below 512 if it equals SectionAlignment,
+	// as in firmware drivers, which use 32-byte alignments.
+	if fa == 0 || fa < 512 && fa != sa || fa > 64<<10 || fa&(fa-1) != 0 {
+		v.add(SeverityWarning, -1, "optional header", "FileAlignment is not a power of 2 between 512 and 64K", fa)
+	}
+	if sa == 0 || sa < fa || sa&(sa-1) != 0 {
+		v.add(SeverityError, -1, "optional header", "SectionAlignment is not a power of 2 at least FileAlignment", sa)
+	}
+	if fa != 0 && oh.sizeOfHeaders%fa != 0 {
+		v.add(SeverityWarning, -1, "optional header", "SizeOfHeaders is not a multiple of FileAlignment", oh.sizeOfHeaders)
+	}
+	if sa != 0 && oh.sizeOfImage%sa != 0 {
+		v.add(SeverityWarning, -1, "optional header", "SizeOfImage is not a multiple of SectionAlignment", oh.sizeOfImage)
+	}
+	if end := int64(f.base) + 20 + int64(f.SizeOfOptionalHeader) + 40*int64(len(f.Sections)); end > int64(oh.sizeOfHeaders) {
+		v.add(SeverityError, -1, "optional header", "SizeOfHeaders does not cover the section table", oh.sizeOfHeaders)
+	}
+	if oh.win32VersionValue != 0 {
+		v.add(SeverityWarning, -1, "optional header", "Win32VersionValue is not zero", oh.win32VersionValue)
+	}
+	if oh.loaderFlags != 0 {
+		v.add(SeverityWarning, -1, "optional header", "LoaderFlags is not zero", oh.loaderFlags)
+	}
+	for _, i := range []int{IMAGE_DIRECTORY_ENTRY_ARCHITECTURE, dirReserved} {
+		if dd := oh.dataDirectory(i); dd != (DataDirectory{}) {
+			v.add(SeverityWarning, -1, directoryNames[i]+" data directory", "reserved directory is not zero", dd)
+		}
+	}
+}
+
+// checkSections checks the section table of f. oh is
+// the optional header of f, or nil if it has none.
+func (v *validator) checkSections(f *File, oh *optionalHeaderInfo) {
+	image := oh != nil && f.TEHeader == nil
+	raw, mem := f.sectionOverlaps(image)
+	for i, s := range f.Sections {
+		what := "section " + s.Name
+		if image {
+			if sa := oh.sectionAlignment; sa != 0 && s.VirtualAddress%sa != 0 {
+				v.add(SeverityError, -1, what, "VirtualAddress is not a multiple of SectionAlignment", s.VirtualAddress)
+			}
+			if fa := oh.fileAlignment; fa != 0 && s.Offset%fa != 0 {
+				v.add(SeverityWarning, -1, what, "PointerToRawData is not a multiple of FileAlignment", s.Offset)
+			}
+			if fa := oh.fileAlignment; fa != 0 && s.Size%fa != 0 {
+				v.add(SeverityWarning, -1, what, "SizeOfRawData is not a multiple of FileAlignment", s.Size)
+			}
+			if int64(s.VirtualAddress)+s.virtualSize() > int64(oh.sizeOfImage) {
+				v.add(SeverityError, -1, what, "extends beyond SizeOfImage", s.VirtualAddress)
+			}
+			if s.PointerToLineNumbers != 0 || s.NumberOfLineNumbers != 0 {
+				v.add(SeverityInfo, -1, what, "has deprecated line numbers", s.NumberOfLineNumbers)
+			}
+		}
+		if f.size >= 0 && s.Offset != 0 && int64(s.Offset)+int64(s.Size) > f.size {
+			v.add(SeverityError, int64(s.Offset), what, "extends beyond the end of the file", s.Size)
+		}
+		overlapsOf(raw, mem, i, func(j int, inRaw, inMem bool) bool {
+			t := f.Sections[j]
+			if inRaw {
+				v.add(SeverityWarning, int64(t.Offset), "section "+t.Name, "raw data overlaps section "+s.Name, nil)
+			}
+			if inMem {
+				v.add(SeverityError, -1, "section "+t.Name, "overlaps section "+s.Name+" in memory", nil)
+			}
+			return true
+		})
+	}
+}
+
+// checkDirectories checks that the data directories of the
+// image f lie within it.
+func (v *validator) checkDirectories(f *File, oh *optionalHeaderInfo) {
+	for i := range oh.dataDirectories {
+		dd := oh.dataDirectory(i)
+		if dd.VirtualAddress == 0 || i == IMAGE_DIRECTORY_ENTRY_ARCHITECTURE || i == dirReserved {
+			continue
+		}
+		what := directoryNames[i] + " data directory"
+		end := int64(dd.VirtualAddress) + int64(dd.Size)
+		if i == IMAGE_DIRECTORY_ENTRY_SECURITY {
+			// The certificate table is not loaded, so
+			// its VirtualAddress is a file offset.
+			if f.size >= 0 && end > f.size {
+				v.add(SeverityError, int64(dd.VirtualAddress), what, "extends beyond the end of the file", dd.Size)
+			}
+			continue
+		}
+		if f.TEHeader == nil && end > int64(oh.sizeOfImage) {
+			v.add(SeverityError, -1, what, "extends beyond SizeOfImage", dd.VirtualAddress)
+		} else if dd.Size == 0 {
+			v.add(SeverityInfo, -1, what, "has an address but no size", dd.VirtualAddress)
+		}
+	}
+}
+
+// checkEntryPoint checks that the entry point of
+// the image f is in an executable section.
+func (v *validator) checkEntryPoint(f *File, oh *optionalHeaderInfo) {
+	ep := oh.addressOfEntryPoint
+	if ep == 0 {
+		// DLLs may do without an entry point.
+		if f.Characteristics&fileDLL == 0 {
+			v.add(SeverityWarning, -1, "optional header", "image has no entry point", nil)
+		}
+		return
+	}
+	for _, s := range f.Sections {
+		if ep < s.VirtualAddress || int64(ep-s.VirtualAddress) >= s.virtualSize() {
+			continue
+		}
+		if s.Characteristics&(IMAGE_SCN_CNT_CODE|IMAGE_SCN_MEM_EXECUTE) == 0 {
+			v.add(SeverityError, -1, "optional header", "entry point is in section "+s.Name+", which is not executable", ep)
+		}
+		return
+	}
+	v.add(SeverityError, -1, "optional header", "entry point is in no section", ep)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, file := range []string{"testdata/gcc-386-mingw-exec", "testdata/gcc-amd64-mingw-exec", "testdata/gcc-amd64-mingw-obj"} {
+		f, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fd := range f.Validate() {
+			if fd.Severity > SeverityInfo {
+				t.Errorf("%s: %v", file, fd)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestValidateFindings(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/gcc-amd64-mingw-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFile(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ohoff := int(f.base) + 20
+	sectab := ohoff + int(f.SizeOfOptionalHeader)
+	// Point the entry point into .data, make .rdata overlap .data
+	// in memory, and set LoaderFlags.
+	binary.LittleEndian.PutUint32(b[ohoff+16:], f.Section(".data").VirtualAddress)
+	binary.LittleEndian.PutUint32(b[sectab+2*40+12:], f.Section(".data").VirtualAddress+0x10)
+	binary.LittleEndian.PutUint32(b[ohoff+104:], 1) // PE32+ LoaderFlags
+	if f, err = NewFile(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fd := range f.Validate() {
+		if fd.Severity > SeverityInfo {
+			got = append(got, fd.String())
+		}
+	}
+	want := []string{
+		"error: section .rdata: overlaps section .data in memory",
+		"error: section .rdata: VirtualAddress is not a multiple of SectionAlignment",
+		"error: optional header: entry point is in section .data, which is not executable",
+		"warning: optional header: LoaderFlags is not zero",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("finding %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestOverlapping(t *testing.T) {
+	ranges := [][2]int64{{0, 10}, {5, 5}, {20, 0}, {10, 10}, {15, 1}, {0, 1}, {30, 5}, {34, 100}, {12, 0}}
+	got := overlapping(len(ranges), func(i int) (int64, int64) { return ranges[i][0], ranges[i][1] })
+	for i, a := range ranges {
+		var want, have []int
+		for j := i + 1; j < len(ranges); j++ {
+			b := ranges[j]
+			if a[1] > 0 && b[1] > 0 && a[0] < b[0]+b[1] && b[0] < a[0]+a[1] {
+				want = append(want, j)
+			}
+		}
+		if got != nil {
+			have = got[i]
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("range %d overlaps %v, want %v", i, have, want)
+		}
+	}
+}
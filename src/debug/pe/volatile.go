@@ -0,0 +1,94 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A VolatileMetadata is the volatile metadata of an image
+// (IMAGE_VOLATILE_METADATA), which tells emulators of x86 and x64
+// code on ARM64 which memory accesses need the strong ordering of
+// the emulated architecture.
+type VolatileMetadata struct {
+	Size    uint32
+	Version uint32
+
+	// AccessRVAs holds the RVAs of the instructions that
+	// access volatile memory, from the VolatileAccessTable.
+	AccessRVAs []uint32
+
+	// InfoRanges holds the ranges of code the volatile access
+	// table describes, from the VolatileInfoRangeTable.
+	InfoRanges []VolatileRange
+}
+
+// A VolatileRange is a range of code described by volatile
+// metadata (IMAGE_VOLATILE_RANGE_METADATA).
+type VolatileRange struct {
+	RVA  uint32
+	Size uint32
+}
+
+// VolatileMetadata returns the volatile metadata that the load
+// configuration of f points to, or nil if f has none.
+func (f *File) VolatileMetadata() (*VolatileMetadata, error) {
+	lc, err := f.LoadConfig()
+	if lc == nil || lc.VolatileMetadataPointer == 0 || err != nil {
+		return nil, err
+	}
+	rva, err := f.loadConfigRVA(lc.VolatileMetadataPointer, "volatile metadata")
+	if err != nil {
+		return nil, err
+	}
+	var b [24]byte
+	if err := f.readRVA(b[:], rva); err != nil {
+		return nil, err
+	}
+	vm := &VolatileMetadata{
+		Size:    binary.LittleEndian.Uint32(b[0:]),
+		Version: binary.LittleEndian.Uint32(b[4:]),
+	}
+	access, err := f.volatileTable(binary.LittleEndian.Uint32(b[8:]), binary.LittleEndian.Uint32(b[12:]), 4, "volatile access table")
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(access); i += 4 {
+		vm.AccessRVAs = append(vm.AccessRVAs, binary.LittleEndian.Uint32(access[i:]))
+	}
+	ranges, err := f.volatileTable(binary.LittleEndian.Uint32(b[16:]), binary.LittleEndian.Uint32(b[20:]), 8, "volatile info range table")
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(ranges); i += 8 {
+		vm.InfoRanges = append(vm.InfoRanges, VolatileRange{
+			RVA:  binary.LittleEndian.Uint32(ranges[i:]),
+			Size: binary.LittleEndian.Uint32(ranges[i+4:]),
+		})
+	}
+	return vm, nil
+}
+
+// volatileTable reads the volatile metadata table of size bytes at
+// rva, made of entries of entrySize bytes. what names it in errors.
+func (f *File) volatileTable(rva, size, entrySize uint32, what string) ([]byte, error) {
+	if rva == 0 || size == 0 {
+		return nil, nil
+	}
+	if size%entrySize != 0 {
+		return nil, &FormatError{-1, what, errors.New("size is not a multiple of the entry size"), size}
+	}
+	// The size comes from the file, so check that
+	// the table fits in the image before allocating.
+	if uint64(rva)+uint64(size) > uint64(f.optionalHeader().sizeOfImage) {
+		return nil, &FormatError{-1, what, ErrOutOfBounds, size}
+	}
+	b := make([]byte, size)
+	if err := f.readRVA(b, rva); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
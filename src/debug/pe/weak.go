@@ -0,0 +1,75 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Search characteristics of weak externals, telling the linker
+// where to look for a definition before using the default symbol.
+const (
+	IMAGE_WEAK_EXTERN_SEARCH_NOLIBRARY = 1
+	IMAGE_WEAK_EXTERN_SEARCH_LIBRARY   = 2
+	IMAGE_WEAK_EXTERN_SEARCH_ALIAS     = 3
+	IMAGE_WEAK_EXTERN_ANTI_DEPENDENCY  = 4
+)
+
+// A WeakExternal is the auxiliary record of a weak external symbol
+// (auxiliary format 3), as returned by File.WeakExternal.
+// If the linker finds no other definition of
+// the symbol, it uses the symbol at TagIndex instead.
+type WeakExternal struct {
+	TagIndex        uint32 // index of the default symbol in File.COFFSymbols
+	Characteristics uint32 // IMAGE_WEAK_EXTERN_* value
+}
+
+// WeakExternal returns the auxiliary record of the weak external
+// symbol s, one of f.Symbols. It returns nil if s is not a weak
+// external.
+func (f *File) WeakExternal(s *Symbol) (*WeakExternal, error) {
+	if s.StorageClass != IMAGE_SYM_CLASS_WEAK_EXTERNAL {
+		return nil, nil
+	}
+	i, err := f.SymbolIndex(s)
+	if err != nil {
+		return nil, err
+	}
+	auxs, err := f.AuxSymbols(i)
+	if err != nil {
+		return nil, err
+	}
+	if len(auxs) == 0 {
+		return nil, &FormatError{-1, "weak external " + s.Name, errors.New("missing auxiliary record"), nil}
+	}
+	// The record uses the bytes of the name field.
+	aux := &auxs[0]
+	return &WeakExternal{
+		TagIndex:        binary.LittleEndian.Uint32(aux.Name[0:]),
+		Characteristics: binary.LittleEndian.Uint32(aux.Name[4:]),
+	}, nil
+}
+
+// ResolveWeakExternal returns the symbol that the weak external s
+// stands for when no other definition of its name is linked in: its
+// default symbol, or, if that is a weak external too, what that one
+// resolves to. Other symbols resolve to themselves. s must be one
+// of f.Symbols.
+func (f *File) ResolveWeakExternal(s *Symbol) (*Symbol, error) {
+	for n := 0; s.StorageClass == IMAGE_SYM_CLASS_WEAK_EXTERNAL; n++ {
+		if n == len(f.Symbols) {
+			return nil, &FormatError{-1, "weak external " + s.Name, errors.New("default symbols form a cycle"), nil}
+		}
+		w, err := f.WeakExternal(s)
+		if err != nil {
+			return nil, err
+		}
+		if s, err = f.SymbolByIndex(int(w.TagIndex)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,423 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// maxCOFFSections is the largest section number a regular COFF
+// object can use (IMAGE_SYM_SECTION_MAX); the numbers above it
+// are reserved for special meanings.
+const maxCOFFSections = 0xfeff
+
+// An ObjectFormat selects the format File.WriteObject writes.
+type ObjectFormat int
+
+const (
+	// ObjectAuto writes a regular COFF object, unless there are
+	// too many sections for it, in which case it writes a big
+	// object file.
+	ObjectAuto ObjectFormat = iota
+
+	// ObjectCOFF always writes a regular COFF object.
+	ObjectCOFF
+
+	// ObjectBig always writes a big object file, as compilers
+	// do with /bigobj or -mbig-obj.
+	ObjectBig
+)
+
+// WriteOptions controls the behavior of File.WriteObject.
+type WriteOptions struct {
+	// Format selects the object file format to write.
+	Format ObjectFormat
+
+	// Deterministic makes the output depend only on the logical
+	// contents of f, for reproducible builds: the timestamp is
+	// zeroed, the string table is rebuilt to hold only the names
+	// in use, section names first and then symbol names in order,
+	// and the relocations of each section are sorted by address,
+	// on machines where their order does not matter.
+	Deterministic bool
+}
+
+// NewSection returns a new section with header h and contents
+// data, for building an object file to write with
+// File.WriteObject. The Size of the section is set to len(data).
+func NewSection(h SectionHeader, data []byte) *Section {
+	s := &Section{SectionHeader: h, data: data}
+	s.Size = uint32(len(data))
+	s.sr = io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+	s.ReaderAt = s.sr
+	return s
+}
+
+// hasRawData reports whether s has contents stored in the file,
+// as opposed to uninitialized data, which only has a size.
+// Sections read from a file have contents if they have a
+// PointerToRawData; those built by NewSection always do.
+func (s *Section) hasRawData() bool {
+	return s.Size > 0 && s.Characteristics&IMAGE_SCN_CNT_UNINITIALIZED_DATA == 0 && (s.Offset != 0 || s.data != nil)
+}
+
+// WriteObject writes f to w as a COFF object file. f is either an
+// object file read by NewFile or one built by the caller from
+// NewSection and COFF symbol records.
+//
+// The file is laid out anew: the section table follows the header,
+// and the contents and relocations of every section, the symbol
+// table and the string table follow it in order. Line numbers,
+// which are deprecated, are dropped. The symbol records are taken
+// from f.COFFBigSymbols if it is not empty, and from f.COFFSymbols
+// otherwise; f.Symbols is ignored. Section names longer than 8
+// bytes are added to the string table if it does not hold them
+// already. Sections with 65535 or more relocations are given the
+// IMAGE_SCN_LNK_NRELOC_OVFL characteristic, which stores the
+// count in an extra first relocation. Otherwise, unless
+// opts.Deterministic is set, the timestamp, string table and
+// relocations are written as they are.
+//
+// Regular COFF objects are limited to 65279 sections. Big object
+// files, which have 32-bit section numbers and 20-byte symbol
+// records, are written when opts.Format asks for them or, with
+// ObjectAuto, when f has more sections than that. A nil opts is
+// the same as the zero WriteOptions.
+func (f *File) WriteObject(w io.Writer, opts *WriteOptions) error {
+	if opts == nil {
+		opts = new(WriteOptions)
+	}
+	if f.OptionalHeader != nil || f.imageLayout {
+		return errors.New("pe: WriteObject called on an image file")
+	}
+	if err := f.ensureSymbols(); err != nil {
+		return err
+	}
+	var big bool
+	switch opts.Format {
+	case ObjectAuto:
+		big = len(f.Sections) > maxCOFFSections
+	case ObjectCOFF:
+		if len(f.Sections) > maxCOFFSections {
+			return fmt.Errorf("pe: %d sections are too many for a COFF object", len(f.Sections))
+		}
+	case ObjectBig:
+		big = true
+	default:
+		return fmt.Errorf("pe: unknown object format %d", opts.Format)
+	}
+
+	syms, err := f.encodeSymbols(big)
+	if err != nil {
+		return err
+	}
+	stb := NewStringTableBuilder(f.StringTable)
+	timestamp := f.TimeDateStamp
+	if opts.Deterministic {
+		stb = NewStringTableBuilder(nil)
+		timestamp = 0
+	}
+	names := make([][8]byte, len(f.Sections))
+	for i, s := range f.Sections {
+		names[i] = sectionNameField(s.Name, stb)
+	}
+	if opts.Deterministic {
+		if err := f.renameSymbols(syms, big, stb); err != nil {
+			return err
+		}
+	}
+	st := stb.StringTable()
+
+	hdrSize := int64(20)
+	if big {
+		hdrSize = bigObjHeaderSize
+	}
+	hdr := make([]byte, hdrSize+40*int64(len(f.Sections)))
+	off := int64(len(hdr))
+	for i, s := range f.Sections {
+		if int64(len(s.Relocs)) >= 1<<32-1 {
+			return fmt.Errorf("pe: section %s has too many relocations", s.Name)
+		}
+		b := hdr[hdrSize+40*int64(i):]
+		copy(b[0:8], names[i][:])
+		binary.LittleEndian.PutUint32(b[8:], s.VirtualSize)
+		binary.LittleEndian.PutUint32(b[12:], s.VirtualAddress)
+		binary.LittleEndian.PutUint32(b[16:], s.Size)
+		if s.hasRawData() {
+			binary.LittleEndian.PutUint32(b[20:], uint32(off))
+			off += int64(s.Size)
+		}
+		chars := s.Characteristics &^ IMAGE_SCN_LNK_NRELOC_OVFL
+		if len(s.Relocs) > 0 {
+			binary.LittleEndian.PutUint32(b[24:], uint32(off))
+			binary.LittleEndian.PutUint16(b[32:], uint16(len(s.Relocs)))
+			if len(s.Relocs) >= 0xffff {
+				// The count is stored in an extra first relocation.
+				chars |= IMAGE_SCN_LNK_NRELOC_OVFL
+				binary.LittleEndian.PutUint16(b[32:], 0xffff)
+				off += relocSize
+			}
+			off += relocSize * int64(len(s.Relocs))
+		}
+		binary.LittleEndian.PutUint32(b[36:], chars)
+	}
+	var symtab uint32
+	if len(syms) > 0 || len(st) > 0 {
+		symtab = uint32(off)
+		off += int64(len(syms)) + 4 + int64(len(st))
+	}
+	if off > 1<<32-1 {
+		return errors.New("pe: object file too large")
+	}
+	nsyms := uint32(len(syms) / COFFSymbolSize)
+	if big {
+		nsyms = uint32(len(syms) / COFFBigSymbolSize)
+		h := f.putBigObjHeader(hdr, timestamp)
+		binary.LittleEndian.PutUint32(h[44:], uint32(len(f.Sections)))
+		binary.LittleEndian.PutUint32(h[48:], symtab)
+		binary.LittleEndian.PutUint32(h[52:], nsyms)
+	} else {
+		binary.LittleEndian.PutUint16(hdr[0:], f.Machine)
+		binary.LittleEndian.PutUint16(hdr[2:], uint16(len(f.Sections)))
+		binary.LittleEndian.PutUint32(hdr[4:], timestamp)
+		binary.LittleEndian.PutUint32(hdr[8:], symtab)
+		binary.LittleEndian.PutUint32(hdr[12:], nsyms)
+		binary.LittleEndian.PutUint16(hdr[18:], f.Characteristics)
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+
+	for _, s := range f.Sections {
+		if s.hasRawData() {
+			n, err := io.Copy(w, io.NewSectionReader(s.sr, 0, int64(s.Size)))
+			if err != nil {
+				return err
+			}
+			if n != int64(s.Size) {
+				return fmt.Errorf("pe: section %s has %d bytes of data, want %d", s.Name, n, s.Size)
+			}
+		}
+		if len(s.Relocs) > 0 {
+			relocs := s.Relocs
+			if opts.Deterministic && relocOrderFree(f.Machine) {
+				relocs = append([]Reloc(nil), relocs...)
+				sort.Stable(relocOrder(relocs))
+			}
+			if len(relocs) >= 0xffff {
+				relocs = append([]Reloc{{VirtualAddress: uint32(len(relocs) + 1)}}, relocs...)
+			}
+			b := make([]byte, relocSize*len(relocs))
+			for i, r := range relocs {
+				binary.LittleEndian.PutUint32(b[relocSize*i:], r.VirtualAddress)
+				binary.LittleEndian.PutUint32(b[relocSize*i+4:], r.SymbolTableIndex)
+				binary.LittleEndian.PutUint16(b[relocSize*i+8:], r.Type)
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	if symtab == 0 {
+		return nil
+	}
+	var l [4]byte
+	binary.LittleEndian.PutUint32(l[:], uint32(4+len(st)))
+	for _, b := range [][]byte{syms, l[:], st} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putBigObjHeader fills in the big object header at the start of hdr
+// from f, except for the section and symbol table fields, and
+// returns it. The fields only big object files have are kept from
+// f.BigObjHeader, if f has one.
+func (f *File) putBigObjHeader(hdr []byte, timestamp uint32) []byte {
+	h := hdr[:bigObjHeaderSize]
+	var bh BigObjHeader
+	if f.BigObjHeader != nil {
+		bh = *f.BigObjHeader
+	}
+	if bh.Version < 2 {
+		bh.Version = 2
+	}
+	binary.LittleEndian.PutUint16(h[2:], 0xffff)
+	binary.LittleEndian.PutUint16(h[4:], bh.Version)
+	binary.LittleEndian.PutUint16(h[6:], f.Machine)
+	binary.LittleEndian.PutUint32(h[8:], timestamp)
+	binary.LittleEndian.PutUint32(h[12:], bigObjClassID.Data1)
+	binary.LittleEndian.PutUint16(h[16:], bigObjClassID.Data2)
+	binary.LittleEndian.PutUint16(h[18:], bigObjClassID.Data3)
+	copy(h[20:28], bigObjClassID.Data4[:])
+	binary.LittleEndian.PutUint32(h[28:], bh.SizeOfData)
+	binary.LittleEndian.PutUint32(h[32:], bh.Flags)
+	binary.LittleEndian.PutUint32(h[36:], bh.MetaDataSize)
+	binary.LittleEndian.PutUint32(h[40:], bh.MetaDataOffset)
+	return h
+}
+
+// encodeSymbols encodes the symbol table of f, as 20-byte big
+// object records if big is set and as regular COFF records
+// otherwise. Auxiliary records have the same layout in both
+// formats, except for the padding of big object records.
+func (f *File) encodeSymbols(big bool) ([]byte, error) {
+	size := COFFSymbolSize
+	if big {
+		size = COFFBigSymbolSize
+	}
+	aux := 0
+	if len(f.COFFBigSymbols) > 0 {
+		b := make([]byte, len(f.COFFBigSymbols)*size)
+		for i := range f.COFFBigSymbols {
+			sym := &f.COFFBigSymbols[i]
+			rec := b[i*size:]
+			switch {
+			case big:
+				encodeCOFFBigSymbol(rec, sym)
+			case aux > 0:
+				var raw [COFFBigSymbolSize]byte
+				encodeCOFFBigSymbol(raw[:], sym)
+				copy(rec[:COFFSymbolSize], raw[:])
+			default:
+				if sym.SectionNumber > maxCOFFSections {
+					return nil, fmt.Errorf("pe: symbol %d is in section %d, too many for a COFF object", i, sym.SectionNumber)
+				}
+				csym := sym.coffSymbol()
+				encodeCOFFSymbol(rec, &csym)
+			}
+			if aux > 0 {
+				aux--
+			} else {
+				aux = int(sym.NumberOfAuxSymbols)
+			}
+		}
+		return b, nil
+	}
+	b := make([]byte, len(f.COFFSymbols)*size)
+	for i := range f.COFFSymbols {
+		sym := &f.COFFSymbols[i]
+		rec := b[i*size:]
+		if big && aux == 0 {
+			bsym := COFFBigSymbol{
+				Name:               sym.Name,
+				Value:              sym.Value,
+				SectionNumber:      bigSectionNumber(sym.SectionNumber),
+				Type:               sym.Type,
+				StorageClass:       sym.StorageClass,
+				NumberOfAuxSymbols: sym.NumberOfAuxSymbols,
+			}
+			encodeCOFFBigSymbol(rec, &bsym)
+		} else {
+			encodeCOFFSymbol(rec, sym)
+		}
+		if aux > 0 {
+			aux--
+		} else {
+			aux = int(sym.NumberOfAuxSymbols)
+		}
+	}
+	return b, nil
+}
+
+// bigSectionNumber widens the section number n of a regular COFF
+// symbol. Only the special values IMAGE_SYM_ABSOLUTE (-1) and
+// IMAGE_SYM_DEBUG (-2) are negative; other numbers are unsigned.
+func bigSectionNumber(n int16) int32 {
+	if n == -1 || n == -2 {
+		return int32(n)
+	}
+	return int32(uint16(n))
+}
+
+// renameSymbols moves the long names of the symbol records syms,
+// as encoded by encodeSymbols, from the string table of f to st,
+// in order, and updates the records to match.
+func (f *File) renameSymbols(syms []byte, big bool, st *StringTableBuilder) error {
+	size := COFFSymbolSize
+	if big {
+		size = COFFBigSymbolSize
+	}
+	for i := 0; i+size <= len(syms); i += size {
+		rec := syms[i : i+size]
+		if binary.LittleEndian.Uint32(rec) == 0 {
+			if off := binary.LittleEndian.Uint32(rec[4:]); off != 0 {
+				name, err := f.StringTable.String(off)
+				if err != nil {
+					return err
+				}
+				binary.LittleEndian.PutUint32(rec[4:], st.Add(name))
+			}
+		}
+		// Skip the auxiliary records, held in
+		// the last byte of the symbol record.
+		i += int(rec[size-1]) * size
+	}
+	return nil
+}
+
+// relocOrderFree reports whether the relocations of a section may be
+// reordered on machine: it has no relocation types, such as the PAIR
+// relocations of MIPS, that must follow another relocation.
+func relocOrderFree(machine uint16) bool {
+	switch machine {
+	case IMAGE_FILE_MACHINE_I386, IMAGE_FILE_MACHINE_AMD64, IMAGE_FILE_MACHINE_ARM64, IMAGE_FILE_MACHINE_ARMNT:
+		return true
+	}
+	return false
+}
+
+// relocOrder sorts relocations by address.
+type relocOrder []Reloc
+
+func (r relocOrder) Len() int           { return len(r) }
+func (r relocOrder) Less(i, j int) bool { return r[i].VirtualAddress < r[j].VirtualAddress }
+func (r relocOrder) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// sectionNameField returns the name field of a section header for
+// the section named name, adding the name to the string table
+// built by st if it is too long for the field.
+func sectionNameField(name string, st *StringTableBuilder) [8]byte {
+	var b [8]byte
+	if len(name) <= len(b) {
+		copy(b[:], name)
+		return b
+	}
+	off := int(st.Add(name))
+	if off <= 9999999 {
+		copy(b[:], "/"+strconv.Itoa(off))
+		return b
+	}
+	b[0], b[1] = '/', '/'
+	for i := len(b) - 1; i >= 2; i-- {
+		b[i] = base64Digits[off&63]
+		off >>= 6
+	}
+	return b
+}
+
+// index returns the position in st of the string s,
+// not counting the length field, or -1 if st does not hold s.
+func (st StringTable) index(s string) int {
+	for i := 0; i < len(st); {
+		n := bytes.IndexByte(st[i:], 0)
+		if n < 0 {
+			break
+		}
+		if string(st[i:i+n]) == s {
+			return i
+		}
+		i += n + 1
+	}
+	return -1
+}
@@ -0,0 +1,201 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// sameObject reports the differences between
+// the sections and symbols of two object files.
+func sameObject(t *testing.T, name string, f, want *File) {
+	if len(f.Sections) != len(want.Sections) {
+		t.Errorf("%s: got %d sections, want %d", name, len(f.Sections), len(want.Sections))
+		return
+	}
+	for i, s := range f.Sections {
+		w := want.Sections[i]
+		if s.Name != w.Name || s.Size != w.Size || s.Characteristics != w.Characteristics || !reflect.DeepEqual(s.Relocs, w.Relocs) {
+			t.Errorf("%s: section %d = %+v, want %+v", name, i, s.SectionHeader, w.SectionHeader)
+		}
+		sd, _ := s.Data()
+		wd, _ := w.Data()
+		if !bytes.Equal(sd, wd) {
+			t.Errorf("%s: section %s has different contents", name, s.Name)
+		}
+	}
+	if !reflect.DeepEqual(f.Symbols, want.Symbols) {
+		t.Errorf("%s: symbols differ", name)
+	}
+	if !reflect.DeepEqual(f.COFFSymbols, want.COFFSymbols) {
+		t.Errorf("%s: COFF symbols differ", name)
+	}
+}
+
+func TestWriteObject(t *testing.T) {
+	for _, name := range []string{"testdata/gcc-amd64-mingw-obj", "testdata/gcc-386-mingw-obj"} {
+		obj, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := NewFile(bytes.NewReader(obj))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bigWant, err := NewFile(bytes.NewReader(makeBigObj(obj)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, src := range []*File{want, bigWant} {
+			for _, format := range []ObjectFormat{ObjectAuto, ObjectCOFF, ObjectBig} {
+				var buf bytes.Buffer
+				if err := src.WriteObject(&buf, &WriteOptions{Format: format}); err != nil {
+					t.Fatalf("%s: format %d: %v", name, format, err)
+				}
+				f, err := NewFile(bytes.NewReader(buf.Bytes()))
+				if err != nil {
+					t.Fatalf("%s: format %d: %v", name, format, err)
+				}
+				if f.IsBigObj() != (format == ObjectBig) {
+					t.Errorf("%s: format %d: IsBigObj = %v", name, format, f.IsBigObj())
+				}
+				if f.Machine != want.Machine || f.TimeDateStamp != want.TimeDateStamp {
+					t.Errorf("%s: format %d: file header = %+v", name, format, f.FileHeader)
+				}
+				sameObject(t, name, f, want)
+			}
+		}
+	}
+}
+
+func TestWriteObjectManySections(t *testing.T) {
+	const n = 70000
+	f := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64}}
+	for i := 0; i < n; i++ {
+		f.Sections = append(f.Sections, NewSection(SectionHeader{Name: ".text$x", Characteristics: 0x60000020}, []byte{0xc3}))
+	}
+	f.Sections[n-1].Name = ".text$a_long_section_name"
+	f.COFFBigSymbols = []COFFBigSymbol{{Name: [8]byte{'f'}, SectionNumber: n, StorageClass: 2}}
+	if err := f.WriteObject(ioutil.Discard, &WriteOptions{Format: ObjectCOFF}); err == nil {
+		t.Errorf("writing %d sections as a COFF object succeeded", n)
+	}
+	var buf bytes.Buffer
+	if err := f.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsBigObj() {
+		t.Fatal("file with many sections was not written as a big object")
+	}
+	if len(g.Sections) != n {
+		t.Fatalf("got %d sections, want %d", len(g.Sections), n)
+	}
+	if name := g.Sections[n-1].Name; name != ".text$a_long_section_name" {
+		t.Errorf("last section is named %q", name)
+	}
+	if d, _ := g.Sections[n/2].Data(); !bytes.Equal(d, []byte{0xc3}) {
+		t.Errorf("section %d has contents %x", n/2, d)
+	}
+	if len(g.COFFBigSymbols) != 1 || g.COFFBigSymbols[0].SectionNumber != n {
+		t.Errorf("got symbols %+v", g.COFFBigSymbols)
+	}
+}
+
+func TestWriteObjectManyRelocs(t *testing.T) {
+	const n = 70000
+	f := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64}}
+	s := NewSection(SectionHeader{Name: ".data", Characteristics: 0xc0000040}, make([]byte, 8*n))
+	for i := 0; i < n; i++ {
+		s.Relocs = append(s.Relocs, Reloc{uint32(8 * i), 0, IMAGE_REL_AMD64_ADDR64})
+	}
+	small := NewSection(SectionHeader{Name: ".rdata", Characteristics: 0x40000040 | IMAGE_SCN_LNK_NRELOC_OVFL}, make([]byte, 8))
+	small.Relocs = []Reloc{{0, 0, IMAGE_REL_AMD64_ADDR64}}
+	f.Sections = []*Section{s, small}
+	f.COFFSymbols = []COFFSymbol{{Name: [8]byte{'x'}, StorageClass: IMAGE_SYM_CLASS_EXTERNAL}}
+	var buf bytes.Buffer
+	if err := f.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := g.Sections[0]
+	if gs.NumberOfRelocations != 0xffff || gs.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL == 0 {
+		t.Errorf("section header = %+v", gs.SectionHeader)
+	}
+	if !reflect.DeepEqual(gs.Relocs, s.Relocs) {
+		t.Errorf("got %d relocations, want %d", len(gs.Relocs), n)
+	}
+	if gs := g.Sections[1]; gs.NumberOfRelocations != 1 || gs.Characteristics&IMAGE_SCN_LNK_NRELOC_OVFL != 0 {
+		t.Errorf("section header = %+v", gs.SectionHeader)
+	}
+}
+
+func TestWriteObjectDeterministic(t *testing.T) {
+	// newObject returns the same object, with a timestamp, unused
+	// strings in its string table and relocations in some order.
+	newObject := func(timestamp uint32, junk string, relocs []Reloc) *File {
+		st := StringTable(junk + "\x00_long_symbol_name\x00")
+		long := [8]byte{4: byte(4 + len(junk) + 1)}
+		f := &File{FileHeader: FileHeader{Machine: IMAGE_FILE_MACHINE_AMD64, TimeDateStamp: timestamp}, StringTable: st}
+		s := NewSection(SectionHeader{Name: ".data$long_section", Characteristics: 0xc0000040}, make([]byte, 32))
+		s.Relocs = relocs
+		f.Sections = []*Section{s}
+		f.COFFSymbols = []COFFSymbol{
+			{Name: [8]byte{'.', 'd', 'a', 't', 'a'}, SectionNumber: 1, StorageClass: IMAGE_SYM_CLASS_STATIC, NumberOfAuxSymbols: 1},
+			{Name: [8]byte{4: 1}}, // auxiliary record, not a name
+			{Name: long, SectionNumber: 1, StorageClass: IMAGE_SYM_CLASS_EXTERNAL},
+		}
+		return f
+	}
+	r := []Reloc{{16, 2, IMAGE_REL_AMD64_ADDR64}, {0, 0, IMAGE_REL_AMD64_ADDR64}, {8, 2, IMAGE_REL_AMD64_ADDR32NB}}
+	a := newObject(1234, "", r)
+	b := newObject(5678, "junk_name_nobody_uses", []Reloc{r[2], r[0], r[1]})
+
+	var out [2][]byte
+	for i, f := range []*File{a, b} {
+		var buf bytes.Buffer
+		if err := f.WriteObject(&buf, &WriteOptions{Deterministic: true}); err != nil {
+			t.Fatal(err)
+		}
+		out[i] = buf.Bytes()
+	}
+	if !bytes.Equal(out[0], out[1]) {
+		t.Fatal("deterministic output differs for the same object")
+	}
+	g, err := NewFile(bytes.NewReader(out[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.TimeDateStamp != 0 || g.Sections[0].Name != ".data$long_section" || g.Symbols[1].Name != "_long_symbol_name" {
+		t.Errorf("file header %+v, section %s, symbols %+v", g.FileHeader, g.Sections[0].Name, g.Symbols)
+	}
+	if want := []Reloc{r[1], r[2], r[0]}; !reflect.DeepEqual(g.Sections[0].Relocs, want) {
+		t.Errorf("relocations = %v, want %v", g.Sections[0].Relocs, want)
+	}
+	if want := StringTable(".data$long_section\x00_long_symbol_name\x00"); !bytes.Equal(g.StringTable, want) {
+		t.Errorf("string table = %q, want %q", g.StringTable, want)
+	}
+
+	// Otherwise the object is written as it is.
+	var buf bytes.Buffer
+	if err := b.WriteObject(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	g, err = NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.TimeDateStamp != 5678 || !reflect.DeepEqual(g.Sections[0].Relocs, b.Sections[0].Relocs) || !bytes.HasPrefix(g.StringTable, b.StringTable) {
+		t.Errorf("file header %+v, relocations %v, string table %q", g.FileHeader, g.Sections[0].Relocs, g.StringTable)
+	}
+}
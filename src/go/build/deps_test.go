@@ -238,11 +238,12 @@ var pkgDeps = map[string][]string{
 	"context":                  {"errors", "fmt", "reflect", "sync", "time"},
 	"database/sql":             {"L4", "container/list", "context", "database/sql/driver", "database/sql/internal"},
 	"database/sql/driver":      {"L4", "context", "time", "database/sql/internal"},
+	"debug/binary":             {"L0"},
 	"debug/dwarf":              {"L4"},
 	"debug/elf":                {"L4", "OS", "debug/dwarf", "compress/zlib"},
 	"debug/gosym":              {"L4"},
 	"debug/macho":              {"L4", "OS", "debug/dwarf"},
-	"debug/pe":                 {"L4", "OS", "debug/dwarf"},
+	"debug/pe":                 {"L4", "OS", "compress/zlib", "crypto/md5", "crypto/x509/pkix", "debug/binary", "debug/dwarf", "debug/gosym", "encoding/asn1", "encoding/hex", "math/big", "syscall"},
 	"debug/plan9obj":           {"L4", "OS"},
 	"encoding":                 {"L4"},
 	"encoding/ascii85":         {"L4"},